@@ -6,15 +6,30 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/elsbrock/plundrio/internal/api"
+	"github.com/elsbrock/plundrio/internal/arr"
 	"github.com/elsbrock/plundrio/internal/config"
+	"github.com/elsbrock/plundrio/internal/cron"
 	"github.com/elsbrock/plundrio/internal/download"
+	"github.com/elsbrock/plundrio/internal/events"
 	"github.com/elsbrock/plundrio/internal/log"
+	"github.com/elsbrock/plundrio/internal/notify"
+	"github.com/elsbrock/plundrio/internal/provider"
+	"github.com/elsbrock/plundrio/internal/provider/premiumize"
+	"github.com/elsbrock/plundrio/internal/provider/realdebrid"
+	"github.com/elsbrock/plundrio/internal/push"
+	"github.com/elsbrock/plundrio/internal/report"
+	"github.com/elsbrock/plundrio/internal/scheduler"
 	"github.com/elsbrock/plundrio/internal/server"
+	"github.com/elsbrock/plundrio/internal/state"
+	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -35,6 +50,7 @@ var runCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		// Initialize Viper
 		viper.SetEnvPrefix("PLDR")
+		viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
 		viper.AutomaticEnv()
 
 		configFile, _ := cmd.Flags().GetString("config")
@@ -64,14 +80,189 @@ var runCmd = &cobra.Command{
 		targetDir := viper.GetString("target")
 		putioFolder := strings.ToLower(viper.GetString("folder"))
 		oauthToken := viper.GetString("token")
+		extraTokens := splitList(viper.GetStringSlice("extra-tokens"))
+		providerName := viper.GetString("provider")
+		fallbackProviders := splitList(viper.GetStringSlice("fallback-providers"))
+		realDebridToken := viper.GetString("realdebrid-token")
+		premiumizeAPIKey := viper.GetString("premiumize-apikey")
 		listenAddr := viper.GetString("listen")
+		statusListen := viper.GetString("status-listen")
+		statusRedactNames := viper.GetBool("status-redact-names")
 		workerCount := viper.GetInt("workers")
+		profile := viper.GetString("profile")
+		downloader := viper.GetString("downloader")
+		connections := viper.GetInt("connections")
+		hostConnections := viper.GetInt("host-connections")
+		maxQueuedJobs := viper.GetInt("max-queued-jobs")
+		volumeWriters := viper.GetInt("volume-writers")
+		skipTrash := viper.GetBool("skip-trash")
+		emptyTrashInterval := viper.GetDuration("empty-trash-interval")
+		mirrorInterval := viper.GetDuration("mirror-interval")
+		watchDir := viper.GetString("watch-dir")
+		watchMode := viper.GetString("watch-mode")
+		watchPollInterval := viper.GetDuration("watch-poll-interval")
+		bandwidthStrategy := viper.GetString("bandwidth-strategy")
+		speedLimit := viper.GetInt("speed-limit")
+		altSpeedLimit := viper.GetInt("alt-speed-limit")
+		maxDownloadRate, rateErr := download.ParseRate(viper.GetString("max-download-rate"))
+		downloadQueueSize := viper.GetInt("download-queue-size")
+		maxLoad := viper.GetFloat64("max-load")
+		maxMemoryPercent := viper.GetInt("max-memory-percent")
+		maxDiskLatency := viper.GetDuration("max-disk-latency")
+		stateDir := viper.GetString("state-dir")
+		diskReserve := viper.GetInt("disk-reserve-mb")
+		historyDays := viper.GetInt("history-days")
+		migrateMode := viper.GetString("migrate-mode")
+		importExisting := viper.GetBool("import-existing")
+		targetType := viper.GetString("target-type")
+		incompleteDir := viper.GetString("incomplete-dir")
+		incompleteSuffix := viper.GetString("incomplete-suffix")
+		networkVerify := viper.GetString("network-verify")
+		verifyChecksums := viper.GetBool("verify-checksums")
+		collisionPolicy := viper.GetString("collision-policy")
+		copyStrategy := viper.GetString("copy-strategy")
+		retentionDays := viper.GetInt("retention-days")
+		retentionDryRun := viper.GetBool("retention-dry-run")
+		cleanupOn := viper.GetString("cleanup-on")
+		notifyURL := viper.GetString("notify-url")
+		notifyTitleTemplate := viper.GetString("notify-title-template")
+		notifyBodyTemplate := viper.GetString("notify-body-template")
+		notifyPayloadTemplate := viper.GetString("notify-payload-template")
+		pushSubject := viper.GetString("push-subject")
+		progressCloudWeight := viper.GetInt("progress-cloud-weight")
+		slowSpeedThreshold := viper.GetInt("slow-speed-threshold")
+		slowSpeedDuration := viper.GetDuration("slow-speed-duration")
+		maxRetryCycles := viper.GetInt("max-retry-cycles")
+		retryBudget := viper.GetInt("retry-budget")
+		partialPolicy := viper.GetString("partial-policy")
+		reportPeriod := viper.GetString("report-period")
+		reportFile := viper.GetString("report-file")
+		sharedTargetDir := viper.GetString("shared-target-dir")
+		foreignTransfers := viper.GetString("foreign-transfers")
+		foreignTargetDir := viper.GetString("foreign-target-dir")
+		foreignMatch := viper.GetString("foreign-match")
+		corsOrigins := splitList(viper.GetStringSlice("cors-origins"))
+		corsHeaders := splitList(viper.GetStringSlice("cors-headers"))
+		quotaAction := viper.GetString("quota-action")
+		putioDebug := viper.GetBool("putio-debug")
+		var apiUsers []config.APIUser
+		if err := viper.UnmarshalKey("api-users", &apiUsers); err != nil {
+			log.Fatal("config").Err(err).Msg("Invalid api-users configuration")
+		}
+		var arrInstances []config.ArrInstance
+		if err := viper.UnmarshalKey("arr", &arrInstances); err != nil {
+			log.Fatal("config").Err(err).Msg("Invalid arr configuration")
+		}
+		var volumeLimits []config.VolumeLimit
+		if err := viper.UnmarshalKey("volumes", &volumeLimits); err != nil {
+			log.Fatal("config").Err(err).Msg("Invalid volumes configuration")
+		}
+		var providerRoutes []config.ProviderRoute
+		if err := viper.UnmarshalKey("provider-routes", &providerRoutes); err != nil {
+			log.Fatal("config").Err(err).Msg("Invalid provider-routes configuration")
+		}
+		var maintenanceWindows []config.MaintenanceWindow
+		if err := viper.UnmarshalKey("maintenance-windows", &maintenanceWindows); err != nil {
+			log.Fatal("config").Err(err).Msg("Invalid maintenance-windows configuration")
+		}
+		var downloadWindows []config.DownloadWindow
+		if err := viper.UnmarshalKey("download-windows", &downloadWindows); err != nil {
+			log.Fatal("config").Err(err).Msg("Invalid download-windows configuration")
+		}
+		var schedules []config.Schedule
+		if err := viper.UnmarshalKey("schedules", &schedules); err != nil {
+			log.Fatal("config").Err(err).Msg("Invalid schedules configuration")
+		}
+		var mirrors []config.Mirror
+		if err := viper.UnmarshalKey("mirrors", &mirrors); err != nil {
+			log.Fatal("config").Err(err).Msg("Invalid mirrors configuration")
+		}
+		var retentionCategories map[string]int
+		if err := viper.UnmarshalKey("retention-categories", &retentionCategories); err != nil {
+			log.Fatal("config").Err(err).Msg("Invalid retention-categories")
+		}
+		var categorySpeedLimits map[string]int
+		if err := viper.UnmarshalKey("category-speed-limits", &categorySpeedLimits); err != nil {
+			log.Fatal("config").Err(err).Msg("Invalid category-speed-limits")
+		}
+		for category, limit := range categorySpeedLimits {
+			if limit < 0 {
+				log.Fatal("config").Str("category", category).Int("limit", limit).Msg("Speed limits in category-speed-limits must not be negative")
+			}
+		}
 
 		log.Debug("config").
 			Str("target_dir", targetDir).
 			Str("putio_folder", putioFolder).
+			Int("extra_tokens", len(extraTokens)).
+			Str("provider", providerName).
+			Strs("fallback_providers", fallbackProviders).
+			Interface("provider_routes", providerRoutes).
 			Str("listen_addr", listenAddr).
+			Str("status_listen", statusListen).
+			Bool("status_redact_names", statusRedactNames).
 			Int("workers", workerCount).
+			Str("profile", profile).
+			Str("downloader", downloader).
+			Int("connections", connections).
+			Int("host_connections", hostConnections).
+			Int("max_queued_jobs", maxQueuedJobs).
+			Int("volume_writers", volumeWriters).
+			Interface("volumes", volumeLimits).
+			Interface("maintenance_windows", maintenanceWindows).
+			Interface("download_windows", downloadWindows).
+			Interface("schedules", schedules).
+			Bool("skip_trash", skipTrash).
+			Dur("empty_trash_interval", emptyTrashInterval).
+			Interface("mirrors", mirrors).
+			Dur("mirror_interval", mirrorInterval).
+			Str("watch_dir", watchDir).
+			Str("watch_mode", watchMode).
+			Dur("watch_poll_interval", watchPollInterval).
+			Str("bandwidth_strategy", bandwidthStrategy).
+			Int("speed_limit_kbps", speedLimit).
+			Int("alt_speed_limit_kbps", altSpeedLimit).
+			Int("max_download_rate_kbps", maxDownloadRate).
+			Interface("category_speed_limits", categorySpeedLimits).
+			Int("download_queue_size", downloadQueueSize).
+			Float64("max_load", maxLoad).
+			Int("max_memory_percent", maxMemoryPercent).
+			Dur("max_disk_latency", maxDiskLatency).
+			Str("state_dir", stateDir).
+			Int("disk_reserve_mb", diskReserve).
+			Int("history_days", historyDays).
+			Str("migrate_mode", migrateMode).
+			Bool("import_existing", importExisting).
+			Str("target_type", targetType).
+			Str("incomplete_dir", incompleteDir).
+			Str("incomplete_suffix", incompleteSuffix).
+			Str("network_verify", networkVerify).
+			Bool("verify_checksums", verifyChecksums).
+			Str("collision_policy", collisionPolicy).
+			Str("copy_strategy", copyStrategy).
+			Int("retention_days", retentionDays).
+			Interface("retention_categories", retentionCategories).
+			Bool("retention_dry_run", retentionDryRun).
+			Str("cleanup_on", cleanupOn).
+			Int("arr_instances", len(arrInstances)).
+			Bool("notifications", notifyURL != "").
+			Bool("web_push", pushSubject != "").
+			Int("progress_cloud_weight", progressCloudWeight).
+			Int("slow_speed_threshold_kbps", slowSpeedThreshold).
+			Dur("slow_speed_duration", slowSpeedDuration).
+			Int("max_retry_cycles", maxRetryCycles).
+			Int("retry_budget", retryBudget).
+			Str("partial_policy", partialPolicy).
+			Str("report_period", reportPeriod).
+			Str("report_file", reportFile).
+			Str("shared_target_dir", sharedTargetDir).
+			Str("foreign_transfers", foreignTransfers).
+			Str("foreign_target_dir", foreignTargetDir).
+			Str("foreign_match", foreignMatch).
+			Strs("cors_origins", corsOrigins).
+			Int("api_users", len(apiUsers)).
+			Str("quota_action", quotaAction).
+			Bool("putio_debug", putioDebug).
 			Msg("Configuration loaded")
 
 		// Validate required configuration values
@@ -82,12 +273,225 @@ var runCmd = &cobra.Command{
 				Msg("OAuth token found in config file - consider using environment variable PLDR_TOKEN instead")
 		}
 
-		if targetDir == "" || putioFolder == "" || oauthToken == "" {
+		providerNames := append([]string{providerName}, fallbackProviders...)
+		for i, name := range providerNames {
+			if name != config.ProviderPutio && name != config.ProviderRealDebrid && name != config.ProviderPremiumize {
+				log.Fatal("config").Str("provider", name).Msg("Invalid provider (use putio, realdebrid or premiumize)")
+			}
+			if slices.Contains(providerNames[:i], name) {
+				log.Fatal("config").Str("provider", name).Msg("Provider configured more than once")
+			}
+		}
+
+		// Every route needs a category or match expression and a known provider.
+		// Providers only named in routes are set up after the others, so their
+		// credentials are checked below as well.
+		for _, route := range providerRoutes {
+			if route.Category == "" && route.Match == "" {
+				log.Fatal("config").Str("provider", route.Provider).Msg("Invalid provider-routes entry (set a category, a match expression or both)")
+			}
+			if _, err := regexp.Compile(route.Match); err != nil {
+				log.Fatal("config").Str("match", route.Match).Err(err).Msg("Invalid provider-routes match expression")
+			}
+			if route.Provider != config.ProviderPutio && route.Provider != config.ProviderRealDebrid && route.Provider != config.ProviderPremiumize {
+				log.Fatal("config").Str("provider", route.Provider).Msg("Invalid provider-routes provider (use putio, realdebrid or premiumize)")
+			}
+			if !slices.Contains(providerNames, route.Provider) {
+				providerNames = append(providerNames, route.Provider)
+			}
+		}
+
+		if targetDir == "" || (slices.Contains(providerNames, config.ProviderPutio) && (putioFolder == "" || oauthToken == "")) {
 			log.Error("config").Msg("Not all required configuration values were provided")
 			cmd.Usage()
 			os.Exit(1)
 		}
 
+		if slices.Contains(providerNames, config.ProviderRealDebrid) && realDebridToken == "" {
+			log.Fatal("config").Msg("The realdebrid provider needs a Real-Debrid API token (realdebrid-token)")
+		}
+
+		if slices.Contains(providerNames, config.ProviderPremiumize) && premiumizeAPIKey == "" {
+			log.Fatal("config").Msg("The premiumize provider needs a Premiumize API key (premiumize-apikey)")
+		}
+
+		if profile != config.ProfileDefault && profile != config.ProfileLowPower {
+			log.Fatal("config").Str("profile", profile).Msg("Invalid profile (use default or low-power)")
+		}
+
+		// Profiles bring their own worker count unless one is set explicitly
+		if profile != config.ProfileDefault && !viper.IsSet("workers") {
+			workerCount = download.GetProfileConfig(profile).DefaultWorkerCount
+		}
+
+		if connections < 0 {
+			log.Fatal("config").Int("connections", connections).Msg("Invalid connections (use 0 for the profile default)")
+		}
+
+		if hostConnections < 0 {
+			log.Fatal("config").Int("host_connections", hostConnections).Msg("Invalid host connections (use 0 for unlimited)")
+		}
+
+		if maxRetryCycles < 0 {
+			log.Fatal("config").Int("cycles", maxRetryCycles).Msg("Invalid max retry cycles (use 0 to quarantine failed transfers right away)")
+		}
+		if retryBudget < 0 {
+			log.Fatal("config").Int("budget", retryBudget).Msg("Invalid retry budget (use 0 for unlimited)")
+		}
+
+		if partialPolicy != config.PartialPolicyFail && partialPolicy != config.PartialPolicyComplete {
+			log.Fatal("config").Str("policy", partialPolicy).Msg("Invalid partial policy (use fail or complete)")
+		}
+
+		if speedLimit < 0 || altSpeedLimit < 0 {
+			log.Fatal("config").
+				Int("speed_limit", speedLimit).
+				Int("alt_speed_limit", altSpeedLimit).
+				Msg("Invalid speed limit (use 0 for unlimited)")
+		}
+		if rateErr != nil {
+			log.Fatal("config").Err(rateErr).Msg("Invalid max download rate (use 0 for unlimited)")
+		}
+		if diskReserve < 0 {
+			log.Fatal("config").Int("reserve", diskReserve).Msg("Invalid disk reserve (use 0 to only require room for the files)")
+		}
+		if historyDays < 0 {
+			log.Fatal("config").Int("days", historyDays).Msg("Invalid history days (use 0 to keep the history forever)")
+		}
+		if downloadQueueSize < 0 {
+			log.Fatal("config").Int("size", downloadQueueSize).Msg("Invalid download queue size (use 0 for one per worker)")
+		}
+		if maxLoad < 0 {
+			log.Fatal("config").Float64("load", maxLoad).Msg("Invalid max load (use 0 to disable)")
+		}
+		if maxMemoryPercent < 0 || maxMemoryPercent > 100 {
+			log.Fatal("config").Int("percent", maxMemoryPercent).Msg("Invalid max memory percent (use 1 to 100, or 0 to disable)")
+		}
+		if maxDiskLatency < 0 {
+			log.Fatal("config").Dur("latency", maxDiskLatency).Msg("Invalid max disk latency (use 0 to disable)")
+		}
+
+		if volumeWriters < 0 {
+			log.Fatal("config").Int("writers", volumeWriters).Msg("Invalid volume writers (use 0 for unlimited)")
+		}
+		for _, limit := range volumeLimits {
+			if !filepath.IsAbs(limit.Path) || limit.Writers < 0 {
+				log.Fatal("config").Str("path", limit.Path).Int("writers", limit.Writers).Msg("Invalid volumes entry (use an absolute path and 0 or more writers)")
+			}
+		}
+
+		tokens := make(map[string]bool)
+		for _, user := range apiUsers {
+			if user.Name == "" || user.Token == "" {
+				log.Fatal("config").Str("name", user.Name).Msg("Invalid api-users entry (set a name and a token)")
+			}
+			if tokens[user.Token] {
+				log.Fatal("config").Str("name", user.Name).Msg("Invalid api-users entry (token is used by another user)")
+			}
+			tokens[user.Token] = true
+			if user.MaxTransfers < 0 || user.MonthlyGB < 0 {
+				log.Fatal("config").Str("name", user.Name).Msg("Invalid api-users quota (use 0 for unlimited)")
+			}
+		}
+		if quotaAction != config.QuotaActionReject && quotaAction != config.QuotaActionQueue {
+			log.Fatal("config").Str("action", quotaAction).Msg("Invalid quota action (use reject or queue)")
+		}
+
+		for _, window := range maintenanceWindows {
+			if _, err := cron.Parse(window.Start); err != nil || window.Duration <= 0 {
+				log.Fatal("config").Str("start", window.Start).Dur("duration", window.Duration).Err(err).Msg("Invalid maintenance-windows entry (use a cron expression and a positive duration)")
+			}
+		}
+		for _, window := range downloadWindows {
+			if _, err := cron.Parse(window.Start); err != nil || window.Duration <= 0 {
+				log.Fatal("config").Str("start", window.Start).Dur("duration", window.Duration).Err(err).Msg("Invalid download-windows entry (use a cron expression and a positive duration)")
+			}
+		}
+		for _, schedule := range schedules {
+			if err := scheduler.Validate(schedule); err != nil {
+				log.Fatal("config").Str("action", schedule.Action).Str("cron", schedule.Cron).Err(err).Msg("Invalid schedules entry")
+			}
+		}
+
+		for _, mirror := range mirrors {
+			if mirror.Folder <= 0 || mirror.Target != "" && !filepath.IsAbs(mirror.Target) {
+				log.Fatal("config").Int64("folder", mirror.Folder).Str("target", mirror.Target).Msg("Invalid mirrors entry (use a folder ID and an absolute target directory)")
+			}
+		}
+		if mirrorInterval < 0 {
+			log.Fatal("config").Dur("interval", mirrorInterval).Msg("Invalid mirror interval (use 0 to check on schedules only)")
+		}
+		if watchDir != "" && !filepath.IsAbs(watchDir) {
+			log.Fatal("config").Str("dir", watchDir).Msg("Invalid watch directory (use an absolute path)")
+		}
+		if watchMode != config.WatchModeAuto && watchMode != config.WatchModeNotify && watchMode != config.WatchModePoll {
+			log.Fatal("config").Str("mode", watchMode).Msg("Invalid watch mode (use auto, notify or poll)")
+		}
+		if watchPollInterval <= 0 {
+			log.Fatal("config").Dur("interval", watchPollInterval).Msg("Invalid watch poll interval (must be positive)")
+		}
+
+		if downloader != config.DownloaderAuto && downloader != config.DownloaderAria2c && downloader != config.DownloaderNative {
+			log.Fatal("config").Str("downloader", downloader).Msg("Invalid downloader (use auto, aria2c or native)")
+		}
+
+		if bandwidthStrategy != config.BandwidthStrategyFair && bandwidthStrategy != config.BandwidthStrategyFinishFirst {
+			log.Fatal("config").Str("strategy", bandwidthStrategy).Msg("Invalid bandwidth strategy (use fair or finish-first)")
+		}
+
+		if migrateMode != config.MigrateModeOff && migrateMode != config.MigrateModeMove && migrateMode != config.MigrateModeLink {
+			log.Fatal("config").Str("mode", migrateMode).Msg("Invalid migrate mode (use off, move or link)")
+		}
+
+		if collisionPolicy != config.CollisionPolicySuffix && collisionPolicy != config.CollisionPolicySkip && collisionPolicy != config.CollisionPolicyOverwriteIfLarger {
+			log.Fatal("config").Str("policy", collisionPolicy).Msg("Invalid collision policy (use suffix, skip or overwrite-if-larger)")
+		}
+
+		if targetType != config.TargetTypeAuto && targetType != config.TargetTypeLocal && targetType != config.TargetTypeMount {
+			log.Fatal("config").Str("type", targetType).Msg("Invalid target type (use auto, local or mount)")
+		}
+		if incompleteDir != "" && !filepath.IsAbs(incompleteDir) {
+			log.Fatal("config").Str("dir", incompleteDir).Msg("Invalid incomplete directory (use an absolute path)")
+		}
+		if strings.ContainsAny(incompleteSuffix, `/\`) {
+			log.Fatal("config").Str("suffix", incompleteSuffix).Msg("Invalid incomplete suffix (must not contain path separators)")
+		}
+		if networkVerify != config.NetworkVerifyOff && networkVerify != config.NetworkVerifySize && networkVerify != config.NetworkVerifySample {
+			log.Fatal("config").Str("mode", networkVerify).Msg("Invalid network verify mode (use off, size or sample)")
+		}
+		if copyStrategy != config.CopyStrategyReflink && copyStrategy != config.CopyStrategyCopy && copyStrategy != config.CopyStrategySymlink {
+			log.Fatal("config").Str("strategy", copyStrategy).Msg("Invalid copy strategy (use reflink, copy or symlink)")
+		}
+
+		if cleanupOn != config.CleanupOnDownload && cleanupOn != config.CleanupOnImport {
+			log.Fatal("config").Str("cleanup_on", cleanupOn).Msg("Invalid cleanup trigger (use download or import)")
+		}
+
+		if progressCloudWeight < 0 || progressCloudWeight > 100 {
+			log.Fatal("config").Int("weight", progressCloudWeight).Msg("Invalid progress cloud weight (use 0 to 100)")
+		}
+
+		if reportPeriod != config.ReportPeriodOff && reportPeriod != config.ReportPeriodDaily && reportPeriod != config.ReportPeriodWeekly {
+			log.Fatal("config").Str("period", reportPeriod).Msg("Invalid report period (use off, daily or weekly)")
+		}
+
+		if sharedTargetDir != "" && !filepath.IsAbs(sharedTargetDir) {
+			log.Fatal("config").Str("dir", sharedTargetDir).Msg("Shared target directory must be an absolute path")
+		}
+
+		if foreignTransfers != config.ForeignTransfersDownload && foreignTransfers != config.ForeignTransfersIgnore && foreignTransfers != config.ForeignTransfersMatch {
+			log.Fatal("config").Str("mode", foreignTransfers).Msg("Invalid foreign transfers mode (use download, ignore or match)")
+		}
+		if foreignTargetDir != "" && !filepath.IsAbs(foreignTargetDir) {
+			log.Fatal("config").Str("dir", foreignTargetDir).Msg("Foreign target directory must be an absolute path")
+		}
+		if foreignTransfers == config.ForeignTransfersMatch && foreignMatch == "" {
+			log.Fatal("config").Msg("Foreign transfers mode match needs a foreign-match expression")
+		}
+		if _, err := regexp.Compile(foreignMatch); err != nil {
+			log.Fatal("config").Str("match", foreignMatch).Err(err).Msg("Invalid foreign-match expression")
+		}
+
 		// Verify target directory exists
 		stat, err := os.Stat(targetDir)
 		if err != nil {
@@ -105,42 +509,256 @@ var runCmd = &cobra.Command{
 			TargetDir:   targetDir,
 			PutioFolder: putioFolder,
 			OAuthToken:  oauthToken,
+			ExtraTokens: extraTokens,
 			ListenAddr:  listenAddr,
-			WorkerCount: workerCount,
+
+			StatusListen:      statusListen,
+			StatusRedactNames: statusRedactNames,
+
+			Provider:          providerName,
+			FallbackProviders: fallbackProviders,
+			ProviderRoutes:    providerRoutes,
+			RealDebridToken:   realDebridToken,
+			PremiumizeAPIKey:  premiumizeAPIKey,
+
+			WorkerCount:     workerCount,
+			Profile:         profile,
+			Downloader:      downloader,
+			Connections:     connections,
+			HostConnections: hostConnections,
+
+			MaxQueuedJobs: maxQueuedJobs,
+			VolumeWriters: volumeWriters,
+			VolumeLimits:  volumeLimits,
+
+			MaintenanceWindows: maintenanceWindows,
+			DownloadWindows:    downloadWindows,
+			Schedules:          schedules,
+			Mirrors:            mirrors,
+			MirrorInterval:     mirrorInterval,
+			WatchDir:           watchDir,
+			WatchMode:          watchMode,
+			WatchPollInterval:  watchPollInterval,
+
+			SkipTrash:          skipTrash,
+			EmptyTrashInterval: emptyTrashInterval,
+			BandwidthStrategy:  bandwidthStrategy,
+			SpeedLimit:         speedLimit,
+			AltSpeedLimit:      altSpeedLimit,
+			MaxDownloadRate:    maxDownloadRate,
+			DownloadQueueSize:  downloadQueueSize,
+			MaxLoad:            maxLoad,
+			MaxMemoryPercent:   maxMemoryPercent,
+			MaxDiskLatency:     maxDiskLatency,
+			StateDir:           stateDir,
+			DiskReserveMB:      diskReserve,
+			HistoryDays:        historyDays,
+			MigrateMode:        migrateMode,
+			ImportExisting:     importExisting,
+			TargetType:         targetType,
+			IncompleteDir:      incompleteDir,
+			IncompleteSuffix:   incompleteSuffix,
+			NetworkVerify:      networkVerify,
+			VerifyChecksums:    verifyChecksums,
+			CollisionPolicy:    collisionPolicy,
+			CopyStrategy:       copyStrategy,
+
+			CategorySpeedLimits: categorySpeedLimits,
+
+			RetentionDays:       retentionDays,
+			RetentionCategories: retentionCategories,
+			RetentionDryRun:     retentionDryRun,
+			CleanupOn:           cleanupOn,
+			Arr:                 arrInstances,
+
+			NotifyURL:             notifyURL,
+			NotifyTitleTemplate:   notifyTitleTemplate,
+			NotifyBodyTemplate:    notifyBodyTemplate,
+			NotifyPayloadTemplate: notifyPayloadTemplate,
+			PushSubject:           pushSubject,
+
+			ProgressCloudWeight: progressCloudWeight,
+
+			SlowSpeedThreshold: slowSpeedThreshold,
+			SlowSpeedDuration:  slowSpeedDuration,
+
+			MaxRetryCycles: maxRetryCycles,
+			RetryBudget:    retryBudget,
+			PartialPolicy:  partialPolicy,
+
+			ReportPeriod: reportPeriod,
+			ReportFile:   reportFile,
+
+			SharedTargetDir: sharedTargetDir,
+
+			ForeignTransfers: foreignTransfers,
+			ForeignTargetDir: foreignTargetDir,
+			ForeignMatch:     foreignMatch,
+
+			CORSOrigins: corsOrigins,
+			CORSHeaders: corsHeaders,
+			APIUsers:    apiUsers,
+			QuotaAction: quotaAction,
+
+			PutioDebug: putioDebug,
 		}
 
-		// Initialize Put.io API client
-		client := api.NewClient(cfg.OAuthToken)
+		// Open the state store used to remember settings between runs
+		var store *state.Store
+		if cfg.StateDir != "" {
+			if store, err = state.New(cfg.StateDir); err != nil {
+				log.Warn("state").Err(err).Msg("State persistence disabled")
+				store = nil
+			}
+		}
 
-		// Authenticate and get account info
-		log.Info("auth").Msg("Authenticating with Put.io...")
-		if err := client.Authenticate(); err != nil {
-			log.Fatal("auth").Err(err).Msg("Failed to authenticate with Put.io")
+		// Use the connection count found by the speed test unless one is set explicitly
+		if store != nil && !viper.IsSet("connections") {
+			applyTuning(store, cfg)
 		}
-		log.Info("auth").Msg("Authentication successful")
 
-		// Create/get folder ID
-		log.Info("setup").Str("folder", cfg.PutioFolder).Msg("Setting up Put.io folder")
-		folderID, err := client.EnsureFolder(cfg.PutioFolder)
+		// Set up the providers transfers are added to and downloaded from; the
+		// Put.io client is only there with Put.io among them and comes first,
+		// as it finds the folder ID
+		var client *api.Client
+		if slices.Contains(providerNames, config.ProviderPutio) {
+			client = setupPutio(cfg)
+		}
+		providers := make([]provider.Provider, 0, len(providerNames))
+		for _, name := range providerNames {
+			switch name {
+			case config.ProviderRealDebrid:
+				providers = append(providers, realdebrid.New(cfg.RealDebridToken, cfg.FolderID))
+			case config.ProviderPremiumize:
+				providers = append(providers, premiumize.New(cfg.PremiumizeAPIKey, cfg.FolderID))
+			default:
+				providers = append(providers, client)
+			}
+		}
+		dlProvider := providers[0]
+		if len(providers) > 1 {
+			chain := 1 + len(cfg.FallbackProviders)
+			failover := provider.NewFailover(providers[0], providers[1:chain]...)
+			for _, p := range providers[chain:] {
+				failover.Include(p)
+			}
+			dlProvider = failover
+		}
+		if cfg.Provider != config.ProviderPutio || len(providers) > 1 {
+			log.Info("auth").Strs("providers", providerNames).Msg("Authenticating with providers...")
+			if err := dlProvider.Authenticate(context.Background()); err != nil {
+				log.Fatal("auth").Err(err).Msg("Failed to authenticate with providers")
+			}
+			log.Info("auth").Msg("Authentication successful")
+		}
+
+		// Set up *arr API integration
+		arrGroup, err := arr.NewGroup(cfg.Arr)
 		if err != nil {
-			log.Fatal("setup").Str("folder", cfg.PutioFolder).Err(err).Msg("Failed to create/get folder")
+			log.Fatal("config").Err(err).Msg("Invalid arr configuration")
+		}
+
+		// Set up notifications
+		var notifier *notify.Notifier
+		if cfg.NotifyURL != "" {
+			notifier, err = notify.New(cfg.NotifyURL, notify.Templates{
+				Title:   cfg.NotifyTitleTemplate,
+				Body:    cfg.NotifyBodyTemplate,
+				Payload: cfg.NotifyPayloadTemplate,
+			})
+			if err != nil {
+				log.Fatal("config").Err(err).Msg("Invalid notification template")
+			}
+		}
+
+		// Set up Web Push notifications for the dashboard
+		var pusher *push.Pusher
+		if cfg.PushSubject != "" {
+			pusher, err = push.New(cfg.StateDir, cfg.PushSubject)
+			if err != nil {
+				log.Fatal("config").Err(err).Msg("Failed to set up Web Push")
+			}
+		}
+
+		// Initialize download manager and subscribe to its events
+		dlManager := download.New(cfg, dlProvider)
+		dlManager.SetArr(arrGroup)
+		bus := dlManager.Events()
+		bus.Handle("audit", events.Log)
+		if len(arrGroup) > 0 {
+			bus.Handle("arr", arrGroup.HandleEvent, events.TransferCompleted, events.TransferErrored)
+		}
+		if notifier != nil {
+			bus.Handle("notify", notifier.HandleEvent, events.TransferCompleted, events.TransferFailed, events.TransferErrored, events.TransferSlow)
+		}
+		if pusher != nil {
+			bus.Handle("push", pusher.HandleEvent, events.TransferCompleted, events.TransferFailed, events.TransferErrored)
+		}
+		reportStop := make(chan struct{})
+		defer close(reportStop)
+		if cfg.ReportPeriod != config.ReportPeriodOff || scheduled(cfg.Schedules, config.ActionReport) {
+			period := cfg.ReportPeriod
+			if period == config.ReportPeriodOff {
+				period = "scheduled"
+			}
+			collector := report.NewCollector(period)
+			bus.Handle("report", collector.HandleEvent, events.TransferCompleted, events.TransferFailed, events.TransferErrored)
+			// Scheduled reports cover the period so far without ending it
+			dlManager.Scheduler().Register(config.ActionReport, func(context.Context) error {
+				deliverReport(cfg, notifier, collector.Summary(time.Now()))
+				return nil
+			})
+			if cfg.ReportPeriod != config.ReportPeriodOff {
+				go collector.Run(reportStop, func(summary report.Summary) {
+					deliverReport(cfg, notifier, summary)
+				})
+			}
+		}
+		// Bring existing downloads along if the target directory changed since the last run
+		if store != nil {
+			migrateTargetDir(store, cfg, dlManager)
 		}
-		cfg.FolderID = folderID
-		log.Info("setup").
-			Str("folder", cfg.PutioFolder).
-			Int64("folder_id", folderID).
-			Msg("Using Put.io folder")
 
-		// Initialize download manager
-		dlManager := download.New(cfg, client)
 		dlManager.Start()
 		defer dlManager.Stop()
 		log.Info("manager").
 			Int("workers", cfg.WorkerCount).
 			Msg("Download manager started")
 
+		// Follow token and target directory changes when the config file is edited
+		if configFile != "" {
+			configToken := cfg.OAuthToken
+			viper.OnConfigChange(func(e fsnotify.Event) {
+				if newToken := viper.GetString("token"); client != nil && newToken != "" && newToken != configToken {
+					configToken = newToken
+					log.Info("config").Str("file", e.Name).Msg("Token changed in config file")
+					if err := client.SetToken(context.Background(), newToken); err != nil {
+						log.Error("config").Err(err).Msg("Failed to replace token")
+					}
+				}
+
+				newTarget := viper.GetString("target")
+				if newTarget == "" || newTarget == dlManager.DefaultTargetDir() {
+					return
+				}
+				log.Info("config").
+					Str("file", e.Name).
+					Str("target_dir", newTarget).
+					Msg("Target directory changed in config file")
+				if err := dlManager.ChangeTargetDir(newTarget); err != nil {
+					log.Error("config").Err(err).Msg("Failed to change target directory")
+					return
+				}
+				if store != nil {
+					saveTargetDir(store, newTarget)
+				}
+			})
+			viper.WatchConfig()
+		}
+
 		// Initialize and start RPC server
 		srv := server.New(cfg, client, dlManager)
+		srv.SetPush(pusher)
 		go func() {
 			log.Info("server").
 				Str("addr", cfg.ListenAddr).
@@ -169,6 +787,34 @@ var runCmd = &cobra.Command{
 	},
 }
 
+// setupPutio creates the Put.io client, authenticates it and sets up the
+// Put.io folder transfers are saved to
+func setupPutio(cfg *config.Config) *api.Client {
+	client := api.NewClient(cfg.OAuthToken, cfg.ExtraTokens...)
+	client.SetCapture(cfg.PutioDebug)
+
+	// Authenticate and get account info
+	log.Info("auth").Msg("Authenticating with Put.io...")
+	if err := client.Authenticate(context.Background()); err != nil {
+		log.Fatal("auth").Err(err).Msg("Failed to authenticate with Put.io")
+	}
+	log.Info("auth").Str("username", client.AuthState().Username).Msg("Authentication successful")
+
+	// Create/get folder ID
+	log.Info("setup").Str("folder", cfg.PutioFolder).Msg("Setting up Put.io folder")
+	folderID, err := client.EnsureFolder(context.Background(), cfg.PutioFolder)
+	if err != nil {
+		log.Fatal("setup").Str("folder", cfg.PutioFolder).Err(err).Msg("Failed to create/get folder")
+	}
+	cfg.FolderID = folderID
+	log.Info("setup").
+		Str("folder", cfg.PutioFolder).
+		Int64("folder_id", folderID).
+		Msg("Using Put.io folder")
+
+	return client
+}
+
 var generateConfigCmd = &cobra.Command{
 	Use:   "generate-config",
 	Short: "Generate sample configuration file",
@@ -179,12 +825,130 @@ var generateConfigCmd = &cobra.Command{
 target: /path/to/downloads	# Target directory for downloads
 folder: "plundrio"					# Folder name on Put.io
 token: "" 									# Get a token with get-token
+extra-tokens: []						# Further tokens of the account, API calls rotate across all tokens
+provider: "putio"						# Service transfers are added to and downloaded from (putio, realdebrid, premiumize)
+fallback-providers: []					# Providers new transfers go to in order when the provider rejects them or is down
+realdebrid-token: ""					# Real-Debrid API token for the realdebrid provider, better set PLDR_REALDEBRID_TOKEN
+premiumize-apikey: ""					# Premiumize API key for the premiumize provider, better set PLDR_PREMIUMIZE_APIKEY
 listen: ":9091"							# Transmission RPC server address
+status-listen: ""						# Extra address serving only the read-only status page (empty disables)
+status-redact-names: false	# Hide transfer names on the status page
 workers: 4									# Number of download workers
+profile: "default"					# Resource profile, low-power for Raspberry Pi and NAS devices (default, low-power)
+downloader: "auto"					# What downloads files, auto uses aria2c if installed (auto, aria2c, native)
+connections: 0							# Connections shared between downloads (0 = profile default, see speedtest)
+host-connections: 0					# Connections to the same put.io server across downloads (0 = unlimited)
+volume-writers: 0						# Concurrent downloads writing to the same volume (0 = unlimited)
+max-queued-jobs: 0					# Download jobs kept in memory, more are spilled to state-dir (0 = 5 per worker)
 log_level: "info"					  # Log level (trace,debug,info,warn,error,fatal,panic,none,pretty)
+skip-trash: false						# Permanently delete remote files instead of trashing them
+empty-trash-interval: 0			# Empty the Put.io trash periodically (e.g. "6h", 0 disables)
+mirror-interval: 15m				# How often mirrors are checked for new and deleted files (0 = on schedules only)
+watch-dir: ""								# Add .torrent and .magnet files dropped into this directory (empty disables)
+watch-mode: "auto"					# Notice new files in watch-dir (auto, notify, poll; auto polls network shares)
+watch-poll-interval: 10s		# How often watch-dir is listed when it is polled
+bandwidth-strategy: "fair"	# Share connections between downloads (fair, finish-first)
+speed-limit: 0							# Download speed limit per download in KB/s (0 = unlimited)
+alt-speed-limit: 0						# Alternative speed limit switched on by clients in KB/s (0 = unlimited)
+max-download-rate: "0"			# Speed limit of all downloads together in KB/s or with K, M, G (e.g. "50M", 0 = unlimited)
+download-queue-size: 0					# Downloads running at once (0 = one per worker)
+max-load: 0									# Run fewer downloads while the load average per CPU is above this (Linux, 0 disables)
+max-memory-percent: 0				# Run fewer downloads while more than this percentage of memory is in use (Linux, 0 disables)
+max-disk-latency: 0					# Run fewer downloads while disk requests take longer on average (Linux, e.g. "50ms", 0 disables)
+state-dir: ""								# Directory for state kept between runs (default ~/.local/state/plundrio)
+disk-reserve-mb: 1024				# MB kept free next to downloads, downloads that do not fit wait for space
+history-days: 90						# Days finished downloads stay in the download history (0 keeps them forever)
+migrate-mode: "off"					# Move or link existing downloads when target changes (off, move, link)
+import-existing: false			# Use files already in the target directory on first start instead of downloading them
+target-type: "auto"					# How files are written to the target directory, mount for rclone/FUSE (auto, local, mount)
+incomplete-dir: ""					# Download into this directory and move files to the target once verified (empty = in place)
+incomplete-suffix: ""				# Append this to file names while downloading, e.g. ".part"
+network-verify: "size"			# Check downloads on NFS/SMB shares after writing them (off, size, sample)
+verify-checksums: true			# Compare downloads with the CRC32 checksum put.io reports
+collision-policy: "suffix"	# Files of two transfers with the same local path (suffix, skip, overwrite-if-larger)
+copy-strategy: "reflink"		# Moves across filesystems clone, copy or symlink files (reflink, copy, symlink)
+retention-days: 0						# Delete local downloads after N days (0 keeps them forever)
+retention-dry-run: false		# Only log what retention would delete
+cleanup-on: "download"			# Delete remote files after download or after *arr import (download, import)
+notify-url: ""							# Webhook for completed/failed transfer notifications (empty disables)
+# notify-title-template: "plundrio: {{.Name}} {{.Type}}"		# Go text/template for the title
+# notify-body-template: "{{.Name}} ({{size .Size}}) in {{duration .Duration}}"	# Go text/template for the body
+# notify-payload-template: '{"text": {{json .Body}}}'			# Go text/template for the JSON payload
+push-subject: "https://github.com/elsbrock/plundrio"	# Contact sent with dashboard Web Push notifications (empty disables)
+progress-cloud-weight: 50		# Share of put.io's progress in the reported progress in percent (rest is local)
+slow-speed-threshold: 0			# Notify when a transfer stays below this speed in KB/s (0 disables)
+slow-speed-duration: "10m"	# How long a transfer must stay slow before notifying
+max-retry-cycles: 3					# Automatic retries of failed files before a transfer is quarantined
+retry-budget: 0							# Download retries per hour across all transfers before retries back off (0 = unlimited)
+partial-policy: "fail"			# Quarantined transfers with downloaded files count as (fail, complete)
+report-period: "off"				# Summarize activity every day or week (off, daily, weekly)
+report-file: ""							# Append summaries to this file (empty only logs and notifies)
+shared-target-dir: ""				# Download directory for files shared by friends (empty uses target)
+foreign-transfers: "download"		# Transfers not added through plundrio (download, ignore, match)
+foreign-target-dir: ""				# Download directory for transfers not added through plundrio (empty uses target)
+foreign-match: ""						# Regular expression names of foreign transfers must match in match mode
+cors-origins: []						# Origins allowed to call the API from a browser ("*" allows any)
+cors-headers: [Content-Type, X-Requested-With]	# Request headers allowed in cross-origin API calls
+quota-action: "reject"				# Transfers added beyond an api-users quota (reject, queue)
+putio-debug: false					# Capture put.io API requests for bug reports, see /api/debug/putio
+# arr:												# Sonarr/Radarr instances to coordinate with (config file only)
+#   - name: sonarr
+#     type: sonarr						# sonarr or radarr
+#     url: http://localhost:8989
+#     api-key: ""
+#     category: tv-sonarr				# Category it adds transfers with (empty checks its history instead)
+# api-users:								# Users identified by their API token, transfers they add are attributed to them (config file only)
+#   - name: alice
+#     token: ""							# Sent as Bearer token, X-Api-Key or Transmission RPC password
+#     max-transfers: 0					# Transfers not downloaded yet at once (0 = unlimited)
+#     monthly-gb: 0							# GB downloaded per calendar month (0 = unlimited)
+# volumes:										# Per-volume download limits overriding volume-writers (config file only)
+#   - path: /mnt/usb						# Any path on the volume
+#     writers: 1
+# provider-routes:					# Send new transfers to another provider first, the first matching route applies
+#   - category: radarr-4k			# Category, the last element of the download directory of the *arr download client
+#     provider: premiumize
+#   - match: "(?i)2160p.*remux"		# Regular expression matching the transfer name
+#     provider: realdebrid
+# maintenance-windows:				# Pause downloads and polling, e.g. during backups (config file only)
+#   - start: "0 2 * * *"				# Cron expression for the start (minute hour day month weekday)
+#     duration: 2h
+# download-windows:					# Start downloads only in these periods, e.g. on metered connections (config file only)
+#   - start: "0 1 * * 1-5"			# 01:00 to 07:00 on weekdays
+#     duration: 6h
+# schedules:							# Run actions on cron expressions (config file only)
+#   - action: scan						# scan, empty-trash, cleanup, report or mirror
+#     cron: "*/30 * * * *"				# Cron expression, or "@every 6h" for a fixed interval
+# mirrors:										# Keep put.io folders in sync with local directories (config file only)
+#   - folder: 123456789				# ID of the folder on put.io
+#     target: /data/mirror		# Directory the folder is mirrored to (empty = target directory)
+#     delete: false						# Delete local files that were deleted on put.io
+# retention-categories:				# Per-category retention in days for <target>/<category> subdirectories
+#   tv-sonarr: 7
+#   radarr: 14
+# category-speed-limits:				# Speed limit in KB/s for each transfer of a category (config file only)
+#   tv-sonarr: 10240
 
 # Environment variables:
-# PLDR_TARGET, PLDR_FOLDER, PLDR_TOKEN, PLDR_LISTEN, PLDR_WORKERS, PLDR_LOG_LEVEL
+# PLDR_TARGET, PLDR_FOLDER, PLDR_TOKEN, PLDR_EXTRA_TOKENS, PLDR_PROVIDER,
+# PLDR_FALLBACK_PROVIDERS, PLDR_REALDEBRID_TOKEN, PLDR_PREMIUMIZE_APIKEY, PLDR_LISTEN,
+# PLDR_STATUS_LISTEN, PLDR_STATUS_REDACT_NAMES, PLDR_WORKERS, PLDR_PROFILE,
+# PLDR_DOWNLOADER, PLDR_CONNECTIONS, PLDR_HOST_CONNECTIONS, PLDR_VOLUME_WRITERS,
+# PLDR_MAX_QUEUED_JOBS, PLDR_LOG_LEVEL, PLDR_SKIP_TRASH, PLDR_EMPTY_TRASH_INTERVAL,
+# PLDR_MIRROR_INTERVAL, PLDR_WATCH_DIR, PLDR_WATCH_MODE, PLDR_WATCH_POLL_INTERVAL,
+# PLDR_BANDWIDTH_STRATEGY, PLDR_SPEED_LIMIT, PLDR_ALT_SPEED_LIMIT,
+# PLDR_MAX_DOWNLOAD_RATE, PLDR_DOWNLOAD_QUEUE_SIZE, PLDR_MAX_LOAD,
+# PLDR_MAX_MEMORY_PERCENT, PLDR_MAX_DISK_LATENCY, PLDR_STATE_DIR,
+# PLDR_DISK_RESERVE_MB, PLDR_HISTORY_DAYS, PLDR_MIGRATE_MODE, PLDR_IMPORT_EXISTING,
+# PLDR_TARGET_TYPE, PLDR_INCOMPLETE_DIR, PLDR_INCOMPLETE_SUFFIX, PLDR_NETWORK_VERIFY,
+# PLDR_VERIFY_CHECKSUMS, PLDR_COLLISION_POLICY, PLDR_COPY_STRATEGY,
+# PLDR_RETENTION_DAYS, PLDR_RETENTION_DRY_RUN, PLDR_CLEANUP_ON, PLDR_NOTIFY_URL,
+# PLDR_NOTIFY_TITLE_TEMPLATE, PLDR_NOTIFY_BODY_TEMPLATE, PLDR_NOTIFY_PAYLOAD_TEMPLATE,
+# PLDR_PUSH_SUBJECT, PLDR_PROGRESS_CLOUD_WEIGHT, PLDR_SLOW_SPEED_THRESHOLD,
+# PLDR_SLOW_SPEED_DURATION, PLDR_MAX_RETRY_CYCLES, PLDR_RETRY_BUDGET,
+# PLDR_PARTIAL_POLICY, PLDR_REPORT_PERIOD, PLDR_REPORT_FILE, PLDR_SHARED_TARGET_DIR,
+# PLDR_FOREIGN_TRANSFERS, PLDR_FOREIGN_TARGET_DIR, PLDR_FOREIGN_MATCH,
+# PLDR_CORS_ORIGINS, PLDR_CORS_HEADERS, PLDR_QUOTA_ACTION, PLDR_PUTIO_DEBUG
 `
 
 		outputPath := "plundrio-config.yaml"
@@ -283,13 +1047,213 @@ func init() {
 	runCmd.Flags().StringP("target", "t", "", "Target directory for downloads (required)")
 	runCmd.Flags().StringP("folder", "f", "plundrio", "Put.io folder name")
 	runCmd.Flags().StringP("token", "k", "", "Put.io OAuth token (required)")
+	runCmd.Flags().StringSlice("extra-tokens", nil, "Further Put.io OAuth tokens of the same account, API calls rotate across all tokens")
+	runCmd.Flags().String("provider", config.ProviderPutio, "Service transfers are added to and downloaded from (putio, realdebrid, premiumize)")
+	runCmd.Flags().StringSlice("fallback-providers", nil, "Providers new transfers go to in order when the provider rejects them or is down")
+	runCmd.Flags().String("realdebrid-token", "", "Real-Debrid API token, needed with the realdebrid provider")
+	runCmd.Flags().String("premiumize-apikey", "", "Premiumize API key, needed with the premiumize provider")
 	runCmd.Flags().StringP("listen", "l", ":9091", "Listen address")
+	runCmd.Flags().String("status-listen", "", "Extra address serving only the read-only status page (empty disables)")
+	runCmd.Flags().Bool("status-redact-names", false, "Hide transfer names on the status page")
 	runCmd.Flags().IntP("workers", "w", 4, "Number of workers")
+	runCmd.Flags().String("profile", config.ProfileDefault, "Resource profile, low-power caps workers, connections, queue sizes and polling for Raspberry Pi and NAS devices (default, low-power)")
+	runCmd.Flags().String("downloader", config.DownloaderAuto, "What downloads files: aria2c, the built-in segmented downloader (native), or aria2c if it is installed (auto)")
+	runCmd.Flags().Int("connections", 0, "Connections shared between concurrent downloads (0 uses the profile default or the result of speedtest)")
+	runCmd.Flags().Int("host-connections", 0, "Connections all downloads together may open to the same put.io download server (0 = unlimited)")
+	runCmd.Flags().Int("volume-writers", 0, "Concurrent downloads writing to the same volume (0 = unlimited)")
+	runCmd.Flags().Int("max-queued-jobs", 0, "Download jobs kept in memory, further jobs are spilled to the state directory (0 = 5 per worker)")
 	runCmd.Flags().String("log-level", "", "Log level (trace,debug,info,warn,error,fatal,none,pretty)")
+	runCmd.Flags().Bool("skip-trash", false, "Permanently delete remote files instead of moving them to the Put.io trash")
+	runCmd.Flags().Duration("empty-trash-interval", 0, "Interval for emptying the Put.io trash (0 disables)")
+	runCmd.Flags().Duration("mirror-interval", 15*time.Minute, "How often the folders of mirrors are checked for new and deleted files (0 checks on schedules only)")
+	runCmd.Flags().String("watch-dir", "", "Blackhole directory: .torrent and .magnet files dropped into it are added as transfers (empty disables)")
+	runCmd.Flags().String("watch-mode", config.WatchModeAuto, "How new files in the watch directory are noticed, auto polls network shares and uses notifications otherwise (auto, notify, poll)")
+	runCmd.Flags().Duration("watch-poll-interval", 10*time.Second, "How often the watch directory is listed when it is polled")
+	runCmd.Flags().String("bandwidth-strategy", config.BandwidthStrategyFair, "How connections are shared between downloads (fair, finish-first)")
+	runCmd.Flags().Int("speed-limit", 0, "Download speed limit per download in KB/s (0 = unlimited)")
+	runCmd.Flags().Int("alt-speed-limit", 0, "Alternative speed limit per download in KB/s that Transmission clients can switch on (0 = unlimited)")
+	runCmd.Flags().String("max-download-rate", "0", "Speed limit of all downloads together in KB/s or with a K, M or G suffix, e.g. 50M (0 = unlimited)")
+	runCmd.Flags().Int("download-queue-size", 0, "Downloads running at once, at most one per worker (0 = one per worker)")
+	runCmd.Flags().Float64("max-load", 0, "Run fewer downloads at once while the 1-minute load average per CPU is above this, Linux only (0 disables)")
+	runCmd.Flags().Int("max-memory-percent", 0, "Run fewer downloads at once while more than this percentage of memory is in use, Linux only (0 disables)")
+	runCmd.Flags().Duration("max-disk-latency", 0, "Run fewer downloads at once while requests to the download disk take longer than this on average, Linux only (0 disables)")
+	runCmd.Flags().String("state-dir", defaultStateDir(), "Directory for state kept between runs (empty disables)")
+	runCmd.Flags().Int("disk-reserve-mb", 1024, "MB to keep free on the disk of the download directory, downloads that do not fit wait until there is space")
+	runCmd.Flags().Int("history-days", 90, "Days finished downloads are kept in the download history (0 keeps them forever)")
+	runCmd.Flags().String("migrate-mode", config.MigrateModeOff, "Move or link existing downloads when the target directory changes (off, move, link)")
+	runCmd.Flags().Bool("import-existing", false, "On first start, use files already in the target directory, e.g. from rclone, instead of downloading them again")
+	runCmd.Flags().String("incomplete-dir", "", "Directory files are downloaded into and moved out of once verified, so they only appear in the target directory when complete (empty downloads in place)")
+	runCmd.Flags().String("incomplete-suffix", "", "Suffix appended to the names of files while they are downloaded, e.g. .part")
+	runCmd.Flags().String("target-type", config.TargetTypeAuto, "How files are written to the target directory, mount writes in order over one connection for rclone and other FUSE mounts (auto, local, mount)")
+	runCmd.Flags().String("network-verify", config.NetworkVerifySize, "How downloads on NFS and SMB shares are checked after writing them, sample also compares parts with put.io (off, size, sample)")
+	runCmd.Flags().Bool("verify-checksums", true, "Compare downloaded files with the CRC32 checksum put.io reports and download them again if they differ")
+	runCmd.Flags().String("collision-policy", config.CollisionPolicySuffix, "What to do when files of two transfers have the same local path (suffix, skip, overwrite-if-larger)")
+	runCmd.Flags().String("copy-strategy", config.CopyStrategyReflink, "How downloads are moved when they cannot be renamed, e.g. across filesystems (reflink, copy, symlink)")
+	runCmd.Flags().Int("retention-days", 0, "Delete local downloads after this many days (0 keeps them forever)")
+	runCmd.Flags().Bool("retention-dry-run", false, "Only log what the retention policy would delete")
+	runCmd.Flags().String("cleanup-on", config.CleanupOnDownload, "When to delete remote files (download, import)")
+	runCmd.Flags().String("notify-url", "", "Webhook URL for transfer notifications (empty disables)")
+	runCmd.Flags().String("notify-title-template", "", "Go text/template for notification titles")
+	runCmd.Flags().String("notify-body-template", "", "Go text/template for notification bodies")
+	runCmd.Flags().String("notify-payload-template", "", "Go text/template for the JSON payload posted to the webhook")
+	runCmd.Flags().String("push-subject", "https://github.com/elsbrock/plundrio", "mailto: or https: contact sent to push services with dashboard notifications (empty disables Web Push)")
+	runCmd.Flags().Int("progress-cloud-weight", 50, "Share of put.io's progress in the progress reported to Transmission clients in percent (the rest is the local download)")
+	runCmd.Flags().Int("slow-speed-threshold", 0, "Notify when a transfer stays below this speed in KB/s (0 disables)")
+	runCmd.Flags().Duration("slow-speed-duration", 10*time.Minute, "How long a transfer must stay below the slow speed threshold before notifying")
+	runCmd.Flags().Int("max-retry-cycles", 3, "How often failed files of a transfer are downloaded again automatically before it is quarantined")
+	runCmd.Flags().Int("retry-budget", 0, "Download retries per hour across all transfers before retries back off (0 = unlimited)")
+	runCmd.Flags().String("partial-policy", config.PartialPolicyFail, "What *arr applications see of quarantined transfers with downloaded files (fail, complete)")
+	runCmd.Flags().String("report-period", config.ReportPeriodOff, "Summarize activity every day or week (off, daily, weekly)")
+	runCmd.Flags().String("report-file", "", "Append activity summaries to this file (empty only logs and notifies)")
+	runCmd.Flags().String("shared-target-dir", "", "Download directory for files shared by put.io friends (empty uses the target directory)")
+	runCmd.Flags().String("foreign-transfers", config.ForeignTransfersDownload, "What to do with transfers in the put.io folder that were not added through plundrio (download, ignore, match)")
+	runCmd.Flags().String("foreign-target-dir", "", "Download directory for transfers not added through plundrio (empty uses the target directory)")
+	runCmd.Flags().String("foreign-match", "", "Regular expression the names of transfers not added through plundrio must match to be downloaded in match mode")
+	runCmd.Flags().StringSlice("cors-origins", nil, "Origins allowed to call the API from a browser (\"*\" allows any)")
+	runCmd.Flags().StringSlice("cors-headers", []string{"Content-Type", "X-Requested-With"}, "Request headers allowed in cross-origin API calls")
+	runCmd.Flags().String("quota-action", config.QuotaActionReject, "What happens to transfers added beyond an api-users quota (reject, queue)")
+	runCmd.Flags().Bool("putio-debug", false, "Capture sanitized put.io API requests and responses, available at /api/debug/putio")
+
+	// Logs command flags
+	logsCmd.Flags().String("url", defaultDaemonURL, "URL of the running daemon (env PLDR_URL)")
+	logsCmd.Flags().BoolP("follow", "f", false, "Keep streaming new log lines")
+	logsCmd.Flags().String("level", "info", "Minimum log level (debug,info,warn,error,fatal)")
+	logsCmd.Flags().String("component", "", "Only show lines of this component (e.g. download, rpc, server)")
+	logsCmd.Flags().IntP("tail", "n", 100, "Number of recent lines to show")
+	logsCmd.Flags().Bool("json", false, "Print lines as JSON")
+	logsCmd.Flags().Int64("transfer", 0, "Show the log and aria2c output captured for this transfer ID")
+
+	// Add, search and download command flags
+	for _, cmd := range []*cobra.Command{addCmd, scanCmd, healthCmd, setTokenCmd, searchCmd, downloadCmd, redownloadCmd} {
+		cmd.Flags().String("url", defaultDaemonURL, "URL of the running daemon (env PLDR_URL)")
+	}
+
+	// Transfer management command flags
+	for _, cmd := range []*cobra.Command{pauseCmd, resumeCmd, cancelCmd, retryCmd} {
+		cmd.Flags().String("url", defaultDaemonURL, "URL of the running daemon (env PLDR_URL)")
+		cmd.Flags().Bool("all", false, "Select all transfers")
+		cmd.Flags().Bool("dry-run", false, "Only show which transfers would be affected")
+	}
+	cancelCmd.Flags().Bool("delete-local-data", false, "Also delete files that were already downloaded")
+
+	// Shared command flags
+	sharedCmd.PersistentFlags().String("url", defaultDaemonURL, "URL of the running daemon (env PLDR_URL)")
+	sharedCmd.PersistentFlags().String("friend", "", "Only files shared by this friend")
+	sharedDownloadCmd.Flags().Bool("all", false, "Download all shared files")
+	sharedCmd.AddCommand(sharedDownloadCmd)
+
+	// Speed test command flags
+	speedtestCmd.Flags().String("config", "", "Config file to read the token, folder and state directory from")
+	speedtestCmd.Flags().StringP("token", "k", "", "Put.io OAuth token")
+	speedtestCmd.Flags().StringP("folder", "f", "plundrio", "Put.io folder to pick the test file from")
+	speedtestCmd.Flags().String("state-dir", defaultStateDir(), "Directory the accepted result is saved in (empty only prints it)")
+	speedtestCmd.Flags().StringSlice("steps", []string{"1", "2", "4", "8", "16"}, "Connection counts to test")
+	speedtestCmd.Flags().Duration("duration", 15*time.Second, "How long to download with each connection count")
+	speedtestCmd.Flags().BoolP("yes", "y", false, "Save the recommendation without asking")
+
+	// Config command flags
+	configCmd.PersistentFlags().String("url", defaultDaemonURL, "URL of the running daemon (env PLDR_URL)")
+	configCmd.AddCommand(configGetCmd)
+	configCmd.AddCommand(configSetCmd)
 
 	rootCmd.AddCommand(runCmd)
 	rootCmd.AddCommand(getTokenCmd)
 	rootCmd.AddCommand(generateConfigCmd)
+	rootCmd.AddCommand(logsCmd)
+	rootCmd.AddCommand(addCmd)
+	rootCmd.AddCommand(searchCmd)
+	rootCmd.AddCommand(scanCmd)
+	rootCmd.AddCommand(healthCmd)
+	rootCmd.AddCommand(setTokenCmd)
+	rootCmd.AddCommand(downloadCmd)
+	rootCmd.AddCommand(redownloadCmd)
+	rootCmd.AddCommand(sharedCmd)
+	rootCmd.AddCommand(pauseCmd)
+	rootCmd.AddCommand(resumeCmd)
+	rootCmd.AddCommand(cancelCmd)
+	rootCmd.AddCommand(retryCmd)
+	rootCmd.AddCommand(configCmd)
+	rootCmd.AddCommand(speedtestCmd)
+}
+
+// splitList splits comma separated entries, as lists set through environment
+// variables arrive as a single value
+func splitList(values []string) []string {
+	var list []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
+
+// defaultStateDir returns the default directory for state kept between runs
+func defaultStateDir() string {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "plundrio")
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".local", "state", "plundrio")
+	}
+	return ""
+}
+
+// targetState records the target directory used by the last run
+type targetState struct {
+	TargetDir string `json:"target_dir"`
+}
+
+// applyTuning sets the connection count saved by the speed test
+func applyTuning(store *state.Store, cfg *config.Config) {
+	var tuning download.Tuning
+	if err := store.Load(download.TuningState, &tuning); err != nil {
+		log.Warn("tuning").Err(err).Msg("Failed to load speed test results")
+		return
+	}
+	if tuning.Connections <= 0 {
+		return
+	}
+	cfg.Connections = tuning.Connections
+	log.Info("tuning").
+		Int("connections", tuning.Connections).
+		Time("measured_at", tuning.MeasuredAt).
+		Msg("Using connection count from speed test")
+}
+
+// migrateTargetDir migrates existing downloads if the target directory changed since the last run
+func migrateTargetDir(store *state.Store, cfg *config.Config, dlManager *download.Manager) {
+	var last targetState
+	if err := store.Load("target", &last); err != nil {
+		log.Warn("migrate").Err(err).Msg("Failed to load previous target directory")
+	}
+
+	if last.TargetDir != "" && last.TargetDir != cfg.TargetDir {
+		if cfg.MigrateMode == config.MigrateModeOff {
+			log.Warn("migrate").
+				Str("old_dir", last.TargetDir).
+				Str("new_dir", cfg.TargetDir).
+				Msg("Target directory changed, existing downloads stay in the old directory (see migrate-mode)")
+		} else if err := dlManager.MigrateTargetDir(last.TargetDir); err != nil {
+			log.Error("migrate").
+				Str("old_dir", last.TargetDir).
+				Str("new_dir", cfg.TargetDir).
+				Err(err).
+				Msg("Failed to migrate existing downloads")
+			return
+		}
+	}
+
+	saveTargetDir(store, cfg.TargetDir)
+}
+
+// saveTargetDir remembers the current target directory for the next run
+func saveTargetDir(store *state.Store, dir string) {
+	if err := store.Save("target", targetState{TargetDir: dir}); err != nil {
+		log.Warn("state").Err(err).Msg("Failed to save target directory")
+	}
 }
 
 func main() {
@@ -297,3 +1261,41 @@ func main() {
 		log.Fatal("main").Err(err).Msg("Command execution failed")
 	}
 }
+
+// scheduled reports whether any schedule runs action
+func scheduled(schedules []config.Schedule, action string) bool {
+	for _, schedule := range schedules {
+		if schedule.Action == action {
+			return true
+		}
+	}
+	return false
+}
+
+// deliverReport logs a summary, sends it as notification and appends it to
+// the report file, depending on what is configured
+func deliverReport(cfg *config.Config, notifier *notify.Notifier, summary report.Summary) {
+	text := summary.Text()
+	log.Info("report").
+		Str("period", summary.Period).
+		Int("completed", summary.Completed).
+		Int("failed", summary.Failed).
+		Int64("bytes", summary.Bytes).
+		Msg("Summary generated")
+
+	if notifier != nil {
+		notifier.NotifyText(notify.EventReport, summary.Title(), text)
+	}
+
+	if cfg.ReportFile != "" {
+		f, err := os.OpenFile(cfg.ReportFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			log.Error("report").Str("file", cfg.ReportFile).Err(err).Msg("Failed to open report file")
+			return
+		}
+		defer f.Close()
+		if _, err := f.WriteString(summary.Title() + "\n" + text + "\n"); err != nil {
+			log.Error("report").Str("file", cfg.ReportFile).Err(err).Msg("Failed to write report file")
+		}
+	}
+}
@@ -0,0 +1,618 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/log"
+	"github.com/elsbrock/plundrio/internal/notify"
+	"github.com/elsbrock/plundrio/pkg/client"
+	"github.com/rs/zerolog"
+	"github.com/spf13/cobra"
+)
+
+// defaultDaemonURL is where commands look for the running daemon
+const defaultDaemonURL = "http://localhost:9091"
+
+var logsCmd = &cobra.Command{
+	Use:   "logs",
+	Short: "Show logs of the running daemon",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		follow, _ := cmd.Flags().GetBool("follow")
+		level, _ := cmd.Flags().GetString("level")
+		component, _ := cmd.Flags().GetString("component")
+		tail, _ := cmd.Flags().GetInt("tail")
+		raw, _ := cmd.Flags().GetBool("json")
+		transferID, _ := cmd.Flags().GetInt64("transfer")
+
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer cancel()
+
+		// Print lines the way the daemon prints them, unless raw JSON is wanted
+		output := zerolog.ConsoleWriter{Out: os.Stdout, TimeFormat: time.RFC3339}
+		printEntry := func(entry client.LogEntry) {
+			if raw {
+				os.Stdout.Write(append(entry.Raw, '\n'))
+				return
+			}
+			output.Write(entry.Raw)
+		}
+
+		var err error
+		if cmd.Flags().Changed("transfer") {
+			if follow {
+				log.Fatal("logs").Msg("--follow cannot be combined with --transfer")
+			}
+			err = daemonClient(cmd).TransferLog(ctx, transferID, tail, printEntry)
+		} else {
+			err = daemonClient(cmd).Logs(ctx, client.LogOptions{
+				Level:     level,
+				Component: component,
+				Tail:      tail,
+				Follow:    follow,
+			}, printEntry)
+		}
+		if err != nil && ctx.Err() == nil {
+			log.Fatal("logs").Err(err).Msg("Failed to read logs")
+		}
+	},
+}
+
+// daemonClient returns a client for the daemon given with --url or PLDR_URL
+func daemonClient(cmd *cobra.Command) *client.Client {
+	url, _ := cmd.Flags().GetString("url")
+	if !cmd.Flags().Changed("url") {
+		if env := os.Getenv("PLDR_URL"); env != "" {
+			url = env
+		}
+	}
+	return client.New(url, nil)
+}
+
+var addCmd = &cobra.Command{
+	Use:   "add URL...",
+	Short: "Add magnet links or HTTP/FTP URLs to the running daemon",
+	Long: `Add magnet links or plain HTTP/FTP URLs. Put.io fetches each of them into the
+configured folder, and the daemon then downloads them like any other transfer.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		c := daemonClient(cmd)
+		failed := false
+		for _, url := range args {
+			if err := c.AddURL(ctx, url); err != nil {
+				log.Error("add").Str("url", url).Err(err).Msg("Failed")
+				failed = true
+				continue
+			}
+			fmt.Printf("added: %s\n", url)
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+var scanCmd = &cobra.Command{
+	Use:   "scan",
+	Short: "Make the running daemon check the put.io folder right away",
+	Long: `Make the daemon look for new and finished transfers in the put.io folder
+right away instead of waiting for the next poll, e.g. after adding a transfer
+in the put.io web interface.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		if err := daemonClient(cmd).Scan(ctx); err != nil {
+			log.Fatal("scan").Err(err).Msg("Failed")
+		}
+		fmt.Println("scanned")
+	},
+}
+
+var healthCmd = &cobra.Command{
+	Use:   "health",
+	Short: "Check whether put.io accepts the token of the running daemon",
+	Long: `Show whether the daemon is healthy. It exits with status 1 if put.io
+rejected its token; get a new one with "plundrio get-token" and replace it
+with "plundrio set-token".`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		health, err := daemonClient(cmd).Health(ctx)
+		if err != nil {
+			log.Fatal("health").Err(err).Msg("Failed")
+		}
+		fmt.Println(health.Status)
+		if health.Auth.Username != "" {
+			fmt.Printf("user: %s\n", health.Auth.Username)
+		}
+		if !health.Auth.CheckedAt.IsZero() {
+			fmt.Printf("checked: %s\n", health.Auth.CheckedAt.Format(time.RFC3339))
+		}
+		if health.Auth.Error != "" {
+			fmt.Printf("error: %s\n", health.Auth.Error)
+		}
+		if len(health.Auth.Tokens) > 1 {
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "\nTOKEN\tREQUESTS\tRATE LIMITED\tSTATE")
+			for _, token := range health.Auth.Tokens {
+				state := "ok"
+				switch {
+				case token.Rejected:
+					state = "rejected"
+				case token.LimitedUntil != nil:
+					state = "limited until " + token.LimitedUntil.Local().Format(time.Kitchen)
+				}
+				fmt.Fprintf(w, "%s\t%d\t%d\t%s\n", token.Token, token.Requests, token.RateLimited, state)
+			}
+			w.Flush()
+		}
+		if health.Auth.Reauthenticate {
+			os.Exit(1)
+		}
+	},
+}
+
+var setTokenCmd = &cobra.Command{
+	Use:   "set-token TOKEN",
+	Short: "Replace the put.io token of the running daemon",
+	Long: `Replace the put.io token of the daemon without a restart, e.g. after the
+old one was revoked. The token is only used once put.io accepted it, and until
+the daemon restarts; change it in the configuration too.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		state, err := daemonClient(cmd).SetToken(ctx, strings.TrimSpace(args[0]))
+		if err != nil {
+			log.Fatal("auth").Err(err).Msg("Failed")
+		}
+		fmt.Printf("token replaced, authenticated as %s\n", state.Username)
+	},
+}
+
+var searchCmd = &cobra.Command{
+	Use:   "search QUERY",
+	Short: "Search the files of the put.io account",
+	Long: `Search the files and folders of the put.io account, including those not in
+the configured folder. Queue results for download with "plundrio download ID".`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		files, err := daemonClient(cmd).SearchFiles(ctx, strings.Join(args, " "))
+		if err != nil {
+			log.Fatal("search").Err(err).Msg("Failed to search files")
+		}
+		if len(files) == 0 {
+			fmt.Println("no files found")
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tTYPE\tSIZE\tNAME")
+		for _, f := range files {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", f.ID, fileKind(f), notify.FormatSize(f.Size), f.Name)
+		}
+		w.Flush()
+	},
+}
+
+// fileKind describes whether a put.io file is a file or a folder
+func fileKind(f client.RemoteFile) string {
+	if f.Folder {
+		return "folder"
+	}
+	return "file"
+}
+
+var downloadCmd = &cobra.Command{
+	Use:   "download FILE_ID...",
+	Short: "Download files or folders that are already on put.io",
+	Long: `Queue files or folders that are already on put.io, e.g. found with
+"plundrio search", for download by the running daemon. Unlike transfers, the
+files are kept on put.io afterwards.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		c := daemonClient(cmd)
+		failed := false
+		for _, arg := range args {
+			fileID, err := strconv.ParseInt(arg, 10, 64)
+			if err != nil {
+				log.Error("download").Str("file_id", arg).Msg("Invalid file ID")
+				failed = true
+				continue
+			}
+			transferID, err := c.DownloadFile(ctx, fileID)
+			if err != nil {
+				log.Error("download").Int64("file_id", fileID).Err(err).Msg("Failed")
+				failed = true
+				continue
+			}
+			fmt.Printf("queued: %d as transfer %d\n", fileID, transferID)
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+var redownloadCmd = &cobra.Command{
+	Use:   "redownload PATH...",
+	Short: "Download files again, e.g. ones found to be corrupt",
+	Long: `Delete the local copy of downloaded files and download them again with
+the running daemon. This works as long as the transfer of a file is still
+tracked by the daemon and the file still exists on put.io, e.g. for files
+queued with "plundrio download" or while cleanup-on import waits for an import.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		c := daemonClient(cmd)
+		failed := false
+		for _, arg := range args {
+			path, err := filepath.Abs(arg)
+			if err != nil {
+				log.Error("redownload").Str("path", arg).Err(err).Msg("Invalid path")
+				failed = true
+				continue
+			}
+			if err := c.RedownloadFile(ctx, path); err != nil {
+				log.Error("redownload").Str("path", path).Err(err).Msg("Failed")
+				failed = true
+				continue
+			}
+			fmt.Printf("queued: %s\n", path)
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+var sharedCmd = &cobra.Command{
+	Use:   "shared",
+	Short: "List files shared by put.io friends",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		files := sharedFiles(ctx, cmd)
+		if len(files) == 0 {
+			fmt.Println("no shared files")
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tTYPE\tSIZE\tFRIEND\tNAME")
+		for _, f := range files {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", f.ID, fileKind(f.RemoteFile), notify.FormatSize(f.Size), f.Friend, f.Name)
+		}
+		w.Flush()
+	},
+}
+
+var sharedDownloadCmd = &cobra.Command{
+	Use:   "download [ID]...",
+	Short: "Download files shared by put.io friends",
+	Long: `Queue files or folders shared by put.io friends for download into the
+daemon's shared-target-dir, by ID or all of them with --all (limited to one
+friend with --friend). Shared files are kept on put.io.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		all, _ := cmd.Flags().GetBool("all")
+		if all == (len(args) > 0) {
+			log.Fatal("shared").Msg("Give file IDs or --all")
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		var ids []int64
+		if all {
+			for _, f := range sharedFiles(ctx, cmd) {
+				ids = append(ids, f.ID)
+			}
+		}
+		for _, arg := range args {
+			id, err := strconv.ParseInt(arg, 10, 64)
+			if err != nil {
+				log.Fatal("shared").Str("file_id", arg).Msg("Invalid file ID")
+			}
+			ids = append(ids, id)
+		}
+
+		c := daemonClient(cmd)
+		failed := false
+		for _, id := range ids {
+			transferID, err := c.DownloadSharedFile(ctx, id)
+			if err != nil {
+				log.Error("shared").Int64("file_id", id).Err(err).Msg("Failed")
+				failed = true
+				continue
+			}
+			fmt.Printf("queued: %d as transfer %d\n", id, transferID)
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+// sharedFiles returns the shared files, limited to those of the friend given with --friend
+func sharedFiles(ctx context.Context, cmd *cobra.Command) []client.SharedFile {
+	friend, _ := cmd.Flags().GetString("friend")
+	files, err := daemonClient(cmd).SharedFiles(ctx)
+	if err != nil {
+		log.Fatal("shared").Err(err).Msg("Failed to list shared files")
+	}
+	if friend == "" {
+		return files
+	}
+
+	var selected []client.SharedFile
+	for _, f := range files {
+		if strings.EqualFold(f.Friend, friend) {
+			selected = append(selected, f)
+		}
+	}
+	return selected
+}
+
+// transferAction is a management command applied to selected transfers
+type transferAction struct {
+	verb string // Past tense for the output, e.g. "paused"
+	skip func(client.Transfer) bool
+	run  func(ctx context.Context, c *client.Client, t client.Transfer) error
+}
+
+var pauseCmd = &cobra.Command{
+	Use:   "pause [ID|PATTERN]...",
+	Short: "Pause transfers of the running daemon",
+	Long: `Pause transfers by ID or by name pattern (e.g. "*S01*", case-insensitive).
+Use --all to pause every transfer, e.g. before a backup window.`,
+	Run: transferCommand(transferAction{
+		verb: "paused",
+		skip: func(t client.Transfer) bool { return t.Paused },
+		run: func(ctx context.Context, c *client.Client, t client.Transfer) error {
+			return c.PauseTransfer(ctx, t.ID)
+		},
+	}),
+}
+
+var resumeCmd = &cobra.Command{
+	Use:   "resume [ID|PATTERN]...",
+	Short: "Resume paused transfers of the running daemon",
+	Long:  `Resume transfers by ID or by name pattern (e.g. "*S01*", case-insensitive), or all with --all.`,
+	Run: transferCommand(transferAction{
+		verb: "resumed",
+		skip: func(t client.Transfer) bool { return !t.Paused },
+		run: func(ctx context.Context, c *client.Client, t client.Transfer) error {
+			return c.ResumeTransfer(ctx, t.ID)
+		},
+	}),
+}
+
+var cancelCmd = &cobra.Command{
+	Use:   "cancel [ID|PATTERN]...",
+	Short: "Cancel transfers of the running daemon",
+	Long: `Cancel transfers by ID or by name pattern (e.g. "*S01*", case-insensitive), or all with --all.
+Cancelled transfers stop downloading and are removed from Put.io.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		deleteLocalData, _ := cmd.Flags().GetBool("delete-local-data")
+		transferCommand(transferAction{
+			verb: "cancelled",
+			run: func(ctx context.Context, c *client.Client, t client.Transfer) error {
+				return c.CancelTransfer(ctx, t.ID, deleteLocalData)
+			},
+		})(cmd, args)
+	},
+}
+
+var retryCmd = &cobra.Command{
+	Use:   "retry [ID|PATTERN]...",
+	Short: "Retry failed or quarantined transfers of the running daemon",
+	Long: `Download the failed files of transfers again, by ID or by name pattern
+(e.g. "*S01*", case-insensitive), or of all failed transfers with --all.
+Transfers whose files keep failing are quarantined after max-retry-cycles
+automatic retries and are only retried this way.`,
+	Run: transferCommand(transferAction{
+		verb: "retried",
+		skip: func(t client.Transfer) bool { return t.LocalState != "failed" && t.LocalState != "quarantined" },
+		run: func(ctx context.Context, c *client.Client, t client.Transfer) error {
+			return c.RetryTransfer(ctx, t.ID)
+		},
+	}),
+}
+
+// transferCommand runs an action on the transfers selected by the arguments
+func transferCommand(action transferAction) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		all, _ := cmd.Flags().GetBool("all")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		if all == (len(args) > 0) {
+			log.Fatal(cmd.Name()).Msg("Give transfer IDs or name patterns, or --all")
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		c := daemonClient(cmd)
+		transfers, err := c.ListTransfers(ctx)
+		if err != nil {
+			log.Fatal(cmd.Name()).Err(err).Msg("Failed to list transfers")
+		}
+
+		selected, err := selectTransfers(transfers, args, all)
+		if err != nil {
+			log.Fatal(cmd.Name()).Err(err).Msg("Invalid selection")
+		}
+
+		failed := false
+		for _, t := range selected {
+			if action.skip != nil && action.skip(t) {
+				continue
+			}
+			if dryRun {
+				fmt.Printf("would be %s: %d %s\n", action.verb, t.ID, t.Name)
+				continue
+			}
+			if err := action.run(ctx, c, t); err != nil {
+				log.Error(cmd.Name()).Int64("transfer_id", t.ID).Str("name", t.Name).Err(err).Msg("Failed")
+				failed = true
+				continue
+			}
+			fmt.Printf("%s: %d %s\n", action.verb, t.ID, t.Name)
+		}
+		if failed {
+			os.Exit(1)
+		}
+	}
+}
+
+// selectTransfers returns the transfers matching any of the IDs or
+// case-insensitive name patterns, or all of them
+func selectTransfers(transfers []client.Transfer, args []string, all bool) ([]client.Transfer, error) {
+	if all {
+		return transfers, nil
+	}
+
+	var selected []client.Transfer
+	for _, arg := range args {
+		matched := false
+		id, idErr := strconv.ParseInt(arg, 10, 64)
+		pattern := strings.ToLower(arg)
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", arg, err)
+		}
+		for _, t := range transfers {
+			if idErr == nil && t.ID == id {
+				matched = true
+			} else if ok, _ := filepath.Match(pattern, strings.ToLower(t.Name)); ok {
+				matched = true
+			} else {
+				continue
+			}
+			if !containsTransfer(selected, t.ID) {
+				selected = append(selected, t)
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("no transfer matches %q", arg)
+		}
+	}
+	return selected, nil
+}
+
+// containsTransfer reports whether a transfer is in the list
+func containsTransfer(transfers []client.Transfer, id int64) bool {
+	for _, t := range transfers {
+		if t.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Read or change the configuration of the running daemon",
+}
+
+var configGetCmd = &cobra.Command{
+	Use:   "get [KEY]",
+	Short: "Show all configuration values, or a single one",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		c := daemonClient(cmd)
+
+		if len(args) == 1 {
+			value, err := c.ConfigValue(ctx, args[0])
+			if err != nil {
+				log.Fatal("config").Str("key", args[0]).Err(err).Msg("Failed to read configuration")
+			}
+			fmt.Println(formatConfigValue(value.Value))
+			return
+		}
+
+		values, err := c.Config(ctx)
+		if err != nil {
+			log.Fatal("config").Err(err).Msg("Failed to read configuration")
+		}
+		keys := make([]string, 0, len(values))
+		for key := range values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			note := ""
+			if !values[key].Mutable {
+				note = "\t# requires restart"
+			}
+			fmt.Printf("%s: %s%s\n", key, formatConfigValue(values[key].Value), note)
+		}
+	},
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set KEY VALUE",
+	Short: "Change a configuration value of the running daemon",
+	Long: `Change a configuration value of the running daemon. Only settings that are
+safe to change while running are accepted (log-level, speed-limit,
+alt-speed-limit, max-download-rate, download-queue-size, bandwidth-strategy,
+skip-trash, retention-dry-run). Changes apply right away and last until the daemon
+restarts, so also update the configuration file to keep them.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		value, err := daemonClient(cmd).SetConfig(ctx, args[0], args[1])
+		if err != nil {
+			log.Fatal("config").Str("key", args[0]).Err(err).Msg("Failed to change configuration")
+		}
+		fmt.Printf("%s: %s\n", args[0], formatConfigValue(value.Value))
+	},
+}
+
+// formatConfigValue prints strings and numbers as they are and everything else as JSON
+func formatConfigValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64, bool:
+		return fmt.Sprint(v)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/elsbrock/go-putio"
+	"github.com/elsbrock/plundrio/internal/api"
+	"github.com/elsbrock/plundrio/internal/download"
+	"github.com/elsbrock/plundrio/internal/log"
+	"github.com/elsbrock/plundrio/internal/notify"
+	"github.com/elsbrock/plundrio/internal/speedtest"
+	"github.com/elsbrock/plundrio/internal/state"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// minSpeedTestSize is the smallest file a speed test is meaningful with
+const minSpeedTestSize = 100 * 1024 * 1024
+
+var speedtestCmd = &cobra.Command{
+	Use:   "speedtest [FILE_ID]",
+	Short: "Find the best number of connections for downloads from put.io",
+	Long: `Download a file from put.io with an increasing number of parallel
+connections and report the speed of each. The file is the given file (or the
+largest file in the given folder), by default the largest file in the
+configured put.io folder. Nothing is written to disk.
+
+The fewest connections reaching at least 95% of the best speed are
+recommended. Once accepted, "plundrio run" uses them unless connections is
+configured explicitly.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		viper.SetEnvPrefix("PLDR")
+		viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
+		viper.AutomaticEnv()
+		if configFile, _ := cmd.Flags().GetString("config"); configFile != "" {
+			viper.SetConfigFile(configFile)
+			if err := viper.ReadInConfig(); err != nil {
+				log.Fatal("config").Str("file", configFile).Err(err).Msg("Error reading config file")
+			}
+		}
+		viper.BindPFlags(cmd.Flags())
+
+		steps, err := parseConnectionSteps(viper.GetStringSlice("steps"))
+		if err != nil {
+			log.Fatal("speedtest").Err(err).Msg("Invalid steps")
+		}
+		duration := viper.GetDuration("duration")
+		if duration <= 0 {
+			log.Fatal("speedtest").Dur("duration", duration).Msg("Invalid duration")
+		}
+		token := viper.GetString("token")
+		if token == "" {
+			log.Fatal("config").Msg("No put.io token configured (use --token or PLDR_TOKEN)")
+		}
+
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer cancel()
+
+		client := api.NewClient(token)
+		file, err := speedTestFile(ctx, client, args, strings.ToLower(viper.GetString("folder")))
+		if err != nil {
+			log.Fatal("speedtest").Err(err).Msg("Failed to find a file to test with")
+		}
+		if file.Size < minSpeedTestSize {
+			log.Warn("speedtest").
+				Str("file", file.Name).
+				Int64("size", file.Size).
+				Msg("File is small, results may be inaccurate")
+		}
+		fmt.Printf("testing with %s (%s), %s per step\n\n", file.Name, notify.FormatSize(file.Size), duration)
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "CONNECTIONS\tSPEED\tDOWNLOADED\tFIRST BYTE\tFAILED")
+		var results []speedtest.Result
+		for _, connections := range steps {
+			// Download URLs expire, so each step gets a fresh one
+			url, err := client.GetDownloadURL(ctx, file.ID)
+			if err != nil {
+				log.Fatal("speedtest").Err(err).Msg("Failed to get download URL")
+			}
+			result, err := speedtest.Run(ctx, http.DefaultClient, url, file.Size, connections, duration)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				log.Error("speedtest").Int("connections", connections).Err(err).Msg("Step failed")
+				continue
+			}
+			results = append(results, result)
+			fmt.Fprintf(w, "%d\t%s/s\t%s\t%s\t%d\n",
+				result.Connections,
+				notify.FormatSize(int64(result.Speed)),
+				notify.FormatSize(result.Bytes),
+				result.FirstByte.Round(time.Millisecond),
+				result.Failures)
+			w.Flush()
+		}
+
+		best, ok := speedtest.Recommend(results)
+		if !ok {
+			log.Fatal("speedtest").Msg("No step downloaded anything")
+		}
+		fmt.Printf("\nrecommended: %d connections (%s/s)\n", best.Connections, notify.FormatSize(int64(best.Speed)))
+
+		stateDir := viper.GetString("state-dir")
+		if stateDir == "" {
+			fmt.Printf("set connections: %d in the configuration to use it\n", best.Connections)
+			return
+		}
+		if !viper.GetBool("yes") && !confirm(fmt.Sprintf("use %d connections from now on?", best.Connections)) {
+			return
+		}
+		store, err := state.New(stateDir)
+		if err != nil {
+			log.Fatal("state").Err(err).Msg("Failed to open state directory")
+		}
+		// Keep what the daemon learned about the servers
+		var tuning download.Tuning
+		if err := store.Load(download.TuningState, &tuning); err != nil {
+			log.Warn("state").Err(err).Msg("Failed to load learned settings, overwriting them")
+		}
+		tuning.Connections, tuning.Speed, tuning.MeasuredAt = best.Connections, best.Speed, time.Now()
+		if err := store.Save(download.TuningState, tuning); err != nil {
+			log.Fatal("state").Err(err).Msg("Failed to save speed test result")
+		}
+		fmt.Println("saved, restart plundrio to apply")
+	},
+}
+
+// speedTestFile returns the file to test with: the given file, the largest
+// file in the given folder, or the largest file in the configured folder
+func speedTestFile(ctx context.Context, client *api.Client, args []string, folder string) (*putio.File, error) {
+	var folderID int64
+	if len(args) > 0 {
+		id, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid file ID: %s", args[0])
+		}
+		folderID = id
+	} else {
+		root, err := client.GetFiles(ctx, 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range root {
+			if f.IsDir() && f.Name == folder {
+				folderID = f.ID
+			}
+		}
+		if folderID == 0 {
+			return nil, fmt.Errorf("folder %q not found, pass a file ID", folder)
+		}
+	}
+
+	files, err := client.GetAllTransferFiles(ctx, folderID)
+	if err != nil {
+		return nil, err
+	}
+	var largest *putio.File
+	for _, f := range files {
+		if largest == nil || f.Size > largest.Size {
+			largest = f
+		}
+	}
+	if largest == nil {
+		return nil, fmt.Errorf("no files in folder %d, pass a file ID", folderID)
+	}
+	return largest, nil
+}
+
+// parseConnectionSteps parses the connection counts to test
+func parseConnectionSteps(values []string) ([]int, error) {
+	var steps []int
+	for _, value := range splitList(values) {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid connection count: %s", value)
+		}
+		steps = append(steps, n)
+	}
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("no connection counts given")
+	}
+	return steps, nil
+}
+
+// confirm asks a yes/no question on the terminal, defaulting to no
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
@@ -0,0 +1,361 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/elsbrock/go-putio"
+	"github.com/elsbrock/plundrio/internal/log"
+	"github.com/elsbrock/plundrio/internal/metrics"
+)
+
+// ErrTokenRejected is returned when Put.io does not accept the OAuth token,
+// e.g. because it was revoked
+var ErrTokenRejected = errors.New("token rejected by Put.io")
+
+// defaultRateLimitWait is how long a token is rested after Put.io limited
+// its rate without saying for how long
+const defaultRateLimitWait = time.Minute
+
+// AuthState is what is known about the OAuth tokens
+type AuthState struct {
+	Valid          bool         `json:"valid"`
+	Reauthenticate bool         `json:"reauthenticate"` // Put.io rejected all tokens, a new one is needed
+	Username       string       `json:"username,omitempty"`
+	CheckedAt      time.Time    `json:"checked_at"` // last successful or failed check
+	Error          string       `json:"error,omitempty"`
+	Tokens         []TokenUsage `json:"tokens,omitempty"`
+}
+
+// TokenUsage is how much a token was used and whether Put.io limits or rejects it
+type TokenUsage struct {
+	Token        string     `json:"token"` // last characters only
+	Requests     int64      `json:"requests"`
+	RateLimited  int64      `json:"rate_limited"` // requests answered with 429 Too Many Requests
+	LimitedUntil *time.Time `json:"limited_until,omitempty"`
+	Rejected     bool       `json:"rejected"`
+}
+
+// tokenSlot is a token and its rate accounting
+type tokenSlot struct {
+	token        string
+	requests     int64
+	rateLimited  int64
+	limitedUntil time.Time
+	rejected     bool
+}
+
+// auth holds the OAuth tokens, which can be replaced while running, and what
+// is known about them. API calls rotate across all tokens Put.io accepts,
+// skipping those it currently limits.
+type auth struct {
+	mu       sync.Mutex
+	tokens   []*tokenSlot // the first is the primary token, replaced by SetToken
+	next     int
+	state    AuthState
+	onChange func(AuthState)
+}
+
+// newAuth creates the auth of the given tokens
+func newAuth(tokens []string) *auth {
+	a := &auth{}
+	for _, token := range tokens {
+		a.tokens = append(a.tokens, &tokenSlot{token: token})
+	}
+	return a
+}
+
+// pick returns the token for the next request: the next one in turn that is
+// neither rejected nor rate limited. If all are, the one limited the
+// shortest is used, or the primary token if all were rejected.
+func (a *auth) pick(except *tokenSlot) *tokenSlot {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	var fallback *tokenSlot
+	for i := range a.tokens {
+		slot := a.tokens[(a.next+i)%len(a.tokens)]
+		if slot.rejected || slot == except {
+			continue
+		}
+		if now.Before(slot.limitedUntil) {
+			if fallback == nil || slot.limitedUntil.Before(fallback.limitedUntil) {
+				fallback = slot
+			}
+			continue
+		}
+		a.next = (a.next + i + 1) % len(a.tokens)
+		return slot
+	}
+	if except != nil {
+		return nil
+	}
+	if fallback == nil {
+		fallback = a.tokens[0]
+	}
+	return fallback
+}
+
+// rateLimited rests a token Put.io limited for as long as it asked
+func (a *auth) rateLimited(slot *tokenSlot, retryAfter string) {
+	wait := defaultRateLimitWait
+	if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds > 0 {
+		wait = time.Duration(seconds) * time.Second
+	}
+
+	a.mu.Lock()
+	slot.rateLimited++
+	slot.limitedUntil = time.Now().Add(wait)
+	a.mu.Unlock()
+	log.Debug("auth").Str("token", maskToken(slot.token)).Dur("wait", wait).Msg("Token rate limited by Put.io")
+}
+
+// rejected stops using a token Put.io did not accept
+func (a *auth) rejected(slot *tokenSlot, status string) {
+	a.mu.Lock()
+	slot.rejected = true
+	state := a.state
+	usable, known := 0, false
+	for _, s := range a.tokens {
+		if !s.rejected {
+			usable++
+		}
+		known = known || s == slot
+	}
+	a.mu.Unlock()
+	if !known {
+		// A token being checked before it replaces the primary one
+		return
+	}
+
+	if usable > 0 {
+		log.Warn("auth").
+			Str("token", maskToken(slot.token)).
+			Int("remaining", usable).
+			Msg("Put.io rejected a token, using the others")
+	}
+	state.CheckedAt = time.Now()
+	state.Error = fmt.Sprintf("%s: %s", ErrTokenRejected, status)
+	a.update(state)
+}
+
+// accept uses a token Put.io accepted again
+func (a *auth) accept(slot *tokenSlot) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	slot.rejected = false
+}
+
+// update changes the state, once all tokens were rejected it needs
+// reauthentication, and reports when that begins or ends
+func (a *auth) update(state AuthState) {
+	a.mu.Lock()
+	state.Reauthenticate = true
+	for _, slot := range a.tokens {
+		if !slot.rejected {
+			state.Reauthenticate = false
+		}
+	}
+	if state.Reauthenticate {
+		state.Valid = false
+	}
+	changed := state.Reauthenticate != a.state.Reauthenticate
+	a.state = state
+	onChange := a.onChange
+	a.mu.Unlock()
+
+	if changed && onChange != nil {
+		onChange(state)
+	}
+}
+
+// maskToken returns the last characters of a token, enough to tell tokens apart
+func maskToken(token string) string {
+	if len(token) <= 4 {
+		return "…"
+	}
+	return "…" + token[len(token)-4:]
+}
+
+// authTransport authorizes requests with a token and notices when Put.io
+// rejects or rate limits it, whichever request that happens on. Without a
+// fixed token it rotates across all of them and retries rate limited
+// requests with another.
+type authTransport struct {
+	auth *auth
+	slot *tokenSlot // fixed token, or nil to rotate
+	base http.RoundTripper
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	slot := t.slot
+	if slot == nil {
+		slot = t.auth.pick(nil)
+	}
+	resp, err := t.send(req, slot)
+	if err != nil || resp.StatusCode != http.StatusTooManyRequests || t.slot != nil {
+		return resp, err
+	}
+
+	// Try another token once, if the body can be sent again
+	if req.Body != nil && req.GetBody == nil {
+		return resp, nil
+	}
+	other := t.auth.pick(slot)
+	if other == nil {
+		return resp, nil
+	}
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return resp, nil
+		}
+		retry.Body = body
+	}
+	resp.Body.Close()
+	return t.send(retry, other)
+}
+
+// send sends a request with a token and records how Put.io answered
+func (t *authTransport) send(req *http.Request, slot *tokenSlot) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+slot.token)
+	t.auth.mu.Lock()
+	slot.requests++
+	t.auth.mu.Unlock()
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		t.auth.rejected(slot, resp.Status)
+	case http.StatusTooManyRequests:
+		t.auth.rateLimited(slot, resp.Header.Get("Retry-After"))
+	}
+	return resp, nil
+}
+
+// authorizedClient creates a Put.io client authorizing its requests with the
+// tokens of c, or only with slot if given
+func (c *Client) authorizedClient(slot *tokenSlot) *putio.Client {
+	return putio.NewClient(&http.Client{Timeout: requestTimeout, Transport: &authTransport{
+		auth: c.auth,
+		slot: slot,
+		base: &captureTransport{capture: c.capture, base: metrics.Transport(c.Name(), nil)},
+	}})
+}
+
+// isUnauthorized reports whether the Put.io API answered with 401 Unauthorized
+func isUnauthorized(err error) bool {
+	var errResp *putio.ErrorResponse
+	return errors.As(err, &errResp) && errResp.Response != nil && errResp.Response.StatusCode == http.StatusUnauthorized
+}
+
+// Authenticate verifies the OAuth tokens by fetching account info with each.
+// It fails only if none of them works.
+func (c *Client) Authenticate(ctx context.Context) error {
+	c.auth.mu.Lock()
+	slots := append([]*tokenSlot(nil), c.auth.tokens...)
+	c.auth.mu.Unlock()
+
+	state := AuthState{CheckedAt: time.Now()}
+	var firstErr error
+	for i, slot := range slots {
+		username, err := c.checkToken(ctx, slot)
+		if err == nil {
+			c.auth.accept(slot)
+			if !state.Valid {
+				state.Valid, state.Username = true, username
+			}
+			continue
+		}
+		if len(slots) > 1 {
+			err = fmt.Errorf("token %d: %w", i+1, err)
+		}
+		if firstErr == nil {
+			firstErr = err
+			state.Error = err.Error()
+		}
+	}
+	c.auth.update(state)
+
+	if !state.Valid {
+		return firstErr
+	}
+	return nil
+}
+
+// checkToken fetches the account info with a token and returns the username
+func (c *Client) checkToken(ctx context.Context, slot *tokenSlot) (string, error) {
+	account, err := c.authorizedClient(slot).Account.Info(ctx)
+	switch {
+	case err != nil && isUnauthorized(err):
+		return "", fmt.Errorf("authentication failed: %w", ErrTokenRejected)
+	case err != nil:
+		// Put.io could not be reached, the token may well be fine
+		return "", fmt.Errorf("authentication failed: %w", err)
+	case account.Username == "":
+		// Just verify we got a valid user ID
+		return "", fmt.Errorf("invalid account info received")
+	}
+	return account.Username, nil
+}
+
+// AuthState returns what is known about the OAuth tokens and how much each was used
+func (c *Client) AuthState() AuthState {
+	c.auth.mu.Lock()
+	defer c.auth.mu.Unlock()
+
+	state := c.auth.state
+	now := time.Now()
+	for _, slot := range c.auth.tokens {
+		usage := TokenUsage{
+			Token:       maskToken(slot.token),
+			Requests:    slot.requests,
+			RateLimited: slot.rateLimited,
+			Rejected:    slot.rejected,
+		}
+		if now.Before(slot.limitedUntil) {
+			until := slot.limitedUntil
+			usage.LimitedUntil = &until
+		}
+		state.Tokens = append(state.Tokens, usage)
+	}
+	return state
+}
+
+// OnAuthChange registers a function called when Put.io rejected all tokens
+// or accepts one again
+func (c *Client) OnAuthChange(fn func(AuthState)) {
+	c.auth.mu.Lock()
+	defer c.auth.mu.Unlock()
+	c.auth.onChange = fn
+}
+
+// SetToken replaces the primary OAuth token without a restart. The new token
+// is checked first and only used if Put.io accepts it.
+func (c *Client) SetToken(ctx context.Context, token string) error {
+	if token == "" {
+		return fmt.Errorf("token must not be empty")
+	}
+	slot := &tokenSlot{token: token}
+	username, err := c.checkToken(ctx, slot)
+	if err != nil {
+		return err
+	}
+
+	c.auth.mu.Lock()
+	c.auth.tokens[0] = slot
+	c.auth.mu.Unlock()
+	c.auth.update(AuthState{Valid: true, Username: username, CheckedAt: time.Now()})
+	return nil
+}
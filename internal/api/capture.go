@@ -0,0 +1,175 @@
+package api
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// captureSize is how many API exchanges are kept
+	captureSize = 200
+
+	// captureBodyLimit is how much of a request or response body is kept
+	captureBodyLimit = 16 * 1024
+)
+
+// redacted replaces secrets in captured exchanges
+const redacted = "REDACTED"
+
+var (
+	// secretHeaders are left out of captured exchanges
+	secretHeaders = []string{"Authorization", "Cookie", "Set-Cookie"}
+
+	// secretJSON and secretQuery find tokens and passwords in bodies
+	secretJSON  = regexp.MustCompile(`("[a-z_]*(?:token|password|secret)[a-z_]*"\s*:\s*)"[^"]*"`)
+	secretQuery = regexp.MustCompile(`((?:oauth_token|access_token|token|password)=)[^&"\s]+`)
+)
+
+// Exchange is a captured Put.io API request and its response, with tokens
+// and other secrets removed
+type Exchange struct {
+	Time            time.Time     `json:"time"`
+	Duration        time.Duration `json:"duration"`
+	Method          string        `json:"method"`
+	URL             string        `json:"url"`
+	RequestHeaders  http.Header   `json:"request_headers,omitempty"`
+	RequestBody     string        `json:"request_body,omitempty"`
+	Status          int           `json:"status,omitempty"`
+	ResponseHeaders http.Header   `json:"response_headers,omitempty"`
+	ResponseBody    string        `json:"response_body,omitempty"`
+	Error           string        `json:"error,omitempty"` // the request failed without a response
+}
+
+// capture keeps the most recent API exchanges while enabled
+type capture struct {
+	enabled   atomic.Bool
+	mu        sync.Mutex
+	exchanges []Exchange
+	next      int // Position of the next exchange once exchanges is full
+}
+
+// add records an exchange, replacing the oldest once full
+func (c *capture) add(e Exchange) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.exchanges) < captureSize {
+		c.exchanges = append(c.exchanges, e)
+		return
+	}
+	c.exchanges[c.next] = e
+	c.next = (c.next + 1) % captureSize
+}
+
+// captureTransport records the requests sent through it while capturing is enabled
+type captureTransport struct {
+	capture *capture
+	base    http.RoundTripper
+}
+
+func (t *captureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.capture.enabled.Load() {
+		return t.base.RoundTrip(req)
+	}
+
+	e := Exchange{
+		Time:           time.Now(),
+		Method:         req.Method,
+		URL:            sanitizeURL(req.URL),
+		RequestHeaders: sanitizeHeaders(req.Header),
+	}
+	// Bodies that cannot be read twice are not captured
+	if req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			head, _ := io.ReadAll(io.LimitReader(body, captureBodyLimit))
+			body.Close()
+			e.RequestBody = sanitizeBody(head)
+		}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	e.Duration = time.Since(e.Time)
+	if err != nil {
+		e.Error = err.Error()
+		t.capture.add(e)
+		return nil, err
+	}
+
+	e.Status = resp.StatusCode
+	e.ResponseHeaders = sanitizeHeaders(resp.Header)
+	head, err := io.ReadAll(io.LimitReader(resp.Body, captureBodyLimit))
+	e.ResponseBody = sanitizeBody(head)
+	if err != nil {
+		e.Error = err.Error()
+	}
+	t.capture.add(e)
+
+	// The caller still gets the complete body
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), resp.Body), resp.Body}
+	return resp, nil
+}
+
+// sanitizeURL returns a URL with token query parameters redacted
+func sanitizeURL(u *url.URL) string {
+	return secretQuery.ReplaceAllString(u.String(), "${1}"+redacted)
+}
+
+// sanitizeHeaders returns a copy of headers with secrets redacted
+func sanitizeHeaders(headers http.Header) http.Header {
+	sanitized := headers.Clone()
+	for _, name := range secretHeaders {
+		if sanitized.Get(name) != "" {
+			sanitized.Set(name, redacted)
+		}
+	}
+	return sanitized
+}
+
+// sanitizeBody returns a body as text with tokens and passwords redacted
+func sanitizeBody(body []byte) string {
+	text := secretJSON.ReplaceAllString(string(body), `${1}"`+redacted+`"`)
+	text = secretQuery.ReplaceAllString(text, "${1}"+redacted)
+	if len(body) == captureBodyLimit {
+		text += "…"
+	}
+	return strings.ToValidUTF8(text, "?")
+}
+
+// SetCapture turns capturing Put.io API exchanges for debugging on or off.
+// Exchanges captured before stay available.
+func (c *Client) SetCapture(enabled bool) {
+	c.capture.enabled.Store(enabled)
+}
+
+// Capturing reports whether Put.io API exchanges are captured
+func (c *Client) Capturing() bool {
+	return c.capture.enabled.Load()
+}
+
+// Captured returns the captured Put.io API exchanges, oldest first
+func (c *Client) Captured() []Exchange {
+	c.capture.mu.Lock()
+	defer c.capture.mu.Unlock()
+
+	exchanges := make([]Exchange, 0, len(c.capture.exchanges))
+	for i := range c.capture.exchanges {
+		exchanges = append(exchanges, c.capture.exchanges[(c.capture.next+i)%len(c.capture.exchanges)])
+	}
+	return exchanges
+}
+
+// ClearCaptured forgets the captured Put.io API exchanges
+func (c *Client) ClearCaptured() {
+	c.capture.mu.Lock()
+	defer c.capture.mu.Unlock()
+	c.capture.exchanges, c.capture.next = nil, 0
+}
@@ -3,48 +3,49 @@ package api
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/elsbrock/go-putio"
-	"golang.org/x/oauth2"
+	"github.com/elsbrock/plundrio/internal/provider"
 )
 
+// ErrFileNotFound is returned when a file no longer exists on Put.io
+var ErrFileNotFound = provider.ErrFileNotFound
+
+// requestTimeout bounds a single API request, so a stuck connection or TLS
+// handshake cannot hold up its caller
+const requestTimeout = 30 * time.Second
+
+// Client is the Put.io provider
+var _ provider.Provider = (*Client)(nil)
+
 // Client wraps the official Put.io client
 type Client struct {
-	client *putio.Client
-	ctx    context.Context
+	client  *putio.Client
+	auth    *auth
+	capture *capture
 }
 
-// NewClient creates a new Put.io API client
-func NewClient(oauthToken string) *Client {
-	ctx := context.Background()
-	tokenSource := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: oauthToken})
-	oauthClient := oauth2.NewClient(ctx, tokenSource)
-
-	return &Client{
-		client: putio.NewClient(oauthClient),
-		ctx:    ctx,
+// NewClient creates a new Put.io API client. API calls rotate across the
+// OAuth token and the extra tokens, which should belong to the same account.
+func NewClient(oauthToken string, extraTokens ...string) *Client {
+	c := &Client{
+		auth:    newAuth(append([]string{oauthToken}, extraTokens...)),
+		capture: &capture{},
 	}
-}
-
-// Authenticate verifies the OAuth token by fetching account info
-func (c *Client) Authenticate() error {
-	account, err := c.client.Account.Info(c.ctx)
-	if err != nil {
-		return fmt.Errorf("authentication failed: %w", err)
-	}
-
-	// Just verify we got a valid user ID
-	if account.Username == "" {
-		return fmt.Errorf("invalid account info received")
-	}
-
-	return nil
+	c.client = c.authorizedClient(nil)
+	return c
 }
 
 // GetAccountInfo returns the Put.io account information
-func (c *Client) GetAccountInfo() (*putio.AccountInfo, error) {
-	account, err := c.client.Account.Info(c.ctx)
+func (c *Client) GetAccountInfo(ctx context.Context) (*putio.AccountInfo, error) {
+	account, err := c.client.Account.Info(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -52,9 +53,9 @@ func (c *Client) GetAccountInfo() (*putio.AccountInfo, error) {
 }
 
 // EnsureFolder creates a folder if it doesn't exist or returns the ID if it does
-func (c *Client) EnsureFolder(name string) (int64, error) {
+func (c *Client) EnsureFolder(ctx context.Context, name string) (int64, error) {
 	// List files at root to find folder
-	files, _, err := c.client.Files.List(c.ctx, 0)
+	files, _, err := c.client.Files.List(ctx, 0)
 	if err != nil {
 		return 0, err
 	}
@@ -67,7 +68,7 @@ func (c *Client) EnsureFolder(name string) (int64, error) {
 	}
 
 	// Create folder if it doesn't exist
-	folder, err := c.client.Files.CreateFolder(c.ctx, name, 0)
+	folder, err := c.client.Files.CreateFolder(ctx, name, 0)
 	if err != nil {
 		return 0, err
 	}
@@ -75,9 +76,10 @@ func (c *Client) EnsureFolder(name string) (int64, error) {
 	return folder.ID, nil
 }
 
-// AddTransfer adds a new transfer (torrent) to Put.io
-func (c *Client) AddTransfer(magnetLink string, folderID int64) error {
-	transfer, err := c.client.Transfers.Add(c.ctx, magnetLink, folderID, "")
+// AddTransfer adds a new transfer to Put.io. The URL can be a magnet link or
+// an HTTP or FTP URL that Put.io fetches.
+func (c *Client) AddTransfer(ctx context.Context, url string, folderID int64) error {
+	transfer, err := c.client.Transfers.Add(ctx, url, folderID, "")
 	if err != nil {
 		return err
 	}
@@ -89,9 +91,14 @@ func (c *Client) AddTransfer(magnetLink string, folderID int64) error {
 	return nil
 }
 
-// GetTransfers returns the list of current transfers
-func (c *Client) GetTransfers() ([]*putio.Transfer, error) {
-	transfers, err := c.client.Transfers.List(c.ctx)
+// Name identifies Put.io as provider
+func (c *Client) Name() string {
+	return "putio"
+}
+
+// ListTransfers returns the list of current transfers
+func (c *Client) ListTransfers(ctx context.Context) ([]*putio.Transfer, error) {
+	transfers, err := c.client.Transfers.List(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -105,17 +112,26 @@ func (c *Client) GetTransfers() ([]*putio.Transfer, error) {
 }
 
 // GetDownloadURL gets the download URL for a file
-func (c *Client) GetDownloadURL(fileID int64) (string, error) {
-	url, err := c.client.Files.URL(c.ctx, fileID, false)
+func (c *Client) GetDownloadURL(ctx context.Context, fileID int64) (string, error) {
+	url, err := c.client.Files.URL(ctx, fileID, false)
 	if err != nil {
+		if isNotFound(err) {
+			return "", fmt.Errorf("%w: %v", ErrFileNotFound, err)
+		}
 		return "", err
 	}
 	return url, nil
 }
 
+// isNotFound reports whether the Put.io API answered with 404 Not Found
+func isNotFound(err error) bool {
+	var errResp *putio.ErrorResponse
+	return errors.As(err, &errResp) && errResp.Response != nil && errResp.Response.StatusCode == http.StatusNotFound
+}
+
 // DeleteTransfer removes a transfer from Put.io
-func (c *Client) DeleteTransfer(transferID int64) error {
-	err := c.client.Transfers.Cancel(c.ctx, transferID)
+func (c *Client) DeleteTransfer(ctx context.Context, transferID int64) error {
+	err := c.client.Transfers.Cancel(ctx, transferID)
 	if err != nil {
 		return err
 	}
@@ -123,8 +139,8 @@ func (c *Client) DeleteTransfer(transferID int64) error {
 }
 
 // GetFiles gets the contents of a folder
-func (c *Client) GetFiles(folderID int64) ([]*putio.File, error) {
-	files, _, err := c.client.Files.List(c.ctx, folderID)
+func (c *Client) GetFiles(ctx context.Context, folderID int64) ([]*putio.File, error) {
+	files, _, err := c.client.Files.List(ctx, folderID)
 	if err != nil {
 		return nil, err
 	}
@@ -137,19 +153,147 @@ func (c *Client) GetFiles(folderID int64) ([]*putio.File, error) {
 	return result, nil
 }
 
+// GetFile returns a file or folder by its ID
+func (c *Client) GetFile(ctx context.Context, fileID int64) (*putio.File, error) {
+	file, err := c.client.Files.Get(ctx, fileID)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, fmt.Errorf("%w: %v", ErrFileNotFound, err)
+		}
+		return nil, err
+	}
+	return &file, nil
+}
+
+// SearchFiles returns the first page of files and folders in the account
+// matching the query, as found by Put.io's search
+func (c *Client) SearchFiles(ctx context.Context, query string) ([]*putio.File, error) {
+	result, err := c.client.Files.Search(ctx, url.PathEscape(query), 1)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]*putio.File, len(result.Files))
+	for i := range result.Files {
+		files[i] = &result.Files[i]
+	}
+	return files, nil
+}
+
+// sharedRootFolderType is the folder type of the folder holding the files
+// friends shared with the account
+const sharedRootFolderType = "SHARED_ROOT"
+
+// SharedFile is a file or folder a friend shared with the account
+type SharedFile struct {
+	*putio.File
+	Friend string // Name of the friend who shared it
+}
+
+// folderEntry is a listed file including its folder type, which the putio
+// library does not expose
+type folderEntry struct {
+	putio.File
+	FolderType string `json:"folder_type"`
+}
+
+// listFolder lists the children of a folder including their folder types
+func (c *Client) listFolder(ctx context.Context, folderID int64) ([]folderEntry, error) {
+	req, err := c.client.NewRequest(ctx, http.MethodGet, "/v2/files/list?per_page=1000&parent_id="+strconv.FormatInt(folderID, 10), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Files []folderEntry `json:"files"`
+	}
+	if _, err := c.client.Do(req, &response); err != nil {
+		return nil, err
+	}
+	return response.Files, nil
+}
+
+// SharedFiles returns the files and folders friends shared with the account.
+// Put.io lists them in a folder per friend inside the shared items folder of
+// the root folder.
+func (c *Client) SharedFiles(ctx context.Context) ([]*SharedFile, error) {
+	root, err := c.listFolder(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var shared []*SharedFile
+	for _, entry := range root {
+		if entry.FolderType != sharedRootFolderType {
+			continue
+		}
+		friends, err := c.GetFiles(ctx, entry.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, friend := range friends {
+			files, err := c.GetFiles(ctx, friend.ID)
+			if err != nil {
+				return nil, err
+			}
+			for _, file := range files {
+				shared = append(shared, &SharedFile{File: file, Friend: friend.Name})
+			}
+		}
+	}
+	return shared, nil
+}
+
 // DeleteFile removes a file from Put.io
-func (c *Client) DeleteFile(fileID int64) error {
-	err := c.client.Files.Delete(c.ctx, fileID)
+func (c *Client) DeleteFile(ctx context.Context, fileID int64) error {
+	err := c.client.Files.Delete(ctx, fileID)
 	if err != nil {
+		if isNotFound(err) {
+			return fmt.Errorf("%w: %v", ErrFileNotFound, err)
+		}
 		return err
 	}
 	return nil
 }
 
-// UploadFile uploads a torrent file to Put.io
-func (c *Client) UploadFile(data []byte, filename string, folderID int64) error {
+// DeleteFilePermanently removes a file from Put.io, bypassing the trash
+func (c *Client) DeleteFilePermanently(ctx context.Context, fileID int64) error {
+	params := url.Values{}
+	params.Set("file_ids", strconv.FormatInt(fileID, 10))
+	params.Set("skip_trash", "true")
+	if err := c.postForm(ctx, "/v2/files/delete", params); err != nil {
+		if isNotFound(err) {
+			return fmt.Errorf("%w: %v", ErrFileNotFound, err)
+		}
+		return err
+	}
+	return nil
+}
+
+// EmptyTrash permanently deletes all files in the Put.io trash
+func (c *Client) EmptyTrash(ctx context.Context) error {
+	if err := c.postForm(ctx, "/v2/trash/empty", url.Values{}); err != nil {
+		return fmt.Errorf("failed to empty trash: %w", err)
+	}
+	return nil
+}
+
+// postForm sends a form-encoded POST request for endpoints not covered by the putio library
+func (c *Client) postForm(ctx context.Context, path string, params url.Values) error {
+	req, err := c.client.NewRequest(ctx, http.MethodPost, path, strings.NewReader(params.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	_, err = c.client.Do(req, &struct{}{})
+	return err
+}
+
+// AddTorrent uploads a torrent file to Put.io, which adds a transfer for it
+func (c *Client) AddTorrent(ctx context.Context, data []byte, filename string, folderID int64) error {
 	reader := bytes.NewReader(data)
-	_, err := c.client.Files.Upload(c.ctx, reader, filename, folderID)
+	_, err := c.client.Files.Upload(ctx, reader, filename, folderID)
 	if err != nil {
 		return fmt.Errorf("failed to upload file: %w", err)
 	}
@@ -157,9 +301,9 @@ func (c *Client) UploadFile(data []byte, filename string, folderID int64) error
 }
 
 // GetAllTransferFiles recursively gets all files in a transfer
-func (c *Client) GetAllTransferFiles(fileID int64) ([]*putio.File, error) {
+func (c *Client) GetAllTransferFiles(ctx context.Context, fileID int64) ([]*putio.File, error) {
 	// First check if the fileID is a file itself
-	file, err := c.client.Files.Get(c.ctx, fileID)
+	file, err := c.client.Files.Get(ctx, fileID)
 	if err != nil {
 		return nil, err
 	}
@@ -174,7 +318,7 @@ func (c *Client) GetAllTransferFiles(fileID int64) ([]*putio.File, error) {
 	var getFiles func(id int64) error
 
 	getFiles = func(id int64) error {
-		files, err := c.GetFiles(id)
+		files, err := c.GetFiles(ctx, id)
 		if err != nil {
 			return err
 		}
@@ -199,8 +343,8 @@ func (c *Client) GetAllTransferFiles(fileID int64) ([]*putio.File, error) {
 }
 
 // RetryTransfer retries a failed transfer
-func (c *Client) RetryTransfer(transferID int64) (*putio.Transfer, error) {
-	transfer, err := c.client.Transfers.Retry(c.ctx, transferID)
+func (c *Client) RetryTransfer(ctx context.Context, transferID int64) (*putio.Transfer, error) {
+	transfer, err := c.client.Transfers.Retry(ctx, transferID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to retry transfer: %w", err)
 	}
@@ -0,0 +1,177 @@
+package arr
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/config"
+)
+
+// History event types reported by Sonarr and Radarr
+const (
+	EventGrabbed  = "grabbed"
+	EventImported = "downloadFolderImported"
+	EventFailed   = "downloadFailed"
+)
+
+// Client talks to the v3 API of a single Sonarr or Radarr instance
+type Client struct {
+	name       string
+	kind       string
+	baseURL    string
+	apiKey     string
+	category   string // download client category, empty if not configured
+	httpClient *http.Client
+}
+
+// HistoryRecord is a single entry of the *arr download history
+type HistoryRecord struct {
+	ID          int64  `json:"id"`
+	EventType   string `json:"eventType"`
+	DownloadID  string `json:"downloadId"`
+	SourceTitle string `json:"sourceTitle"`
+}
+
+// NewClient creates a client for a configured *arr instance
+func NewClient(instance config.ArrInstance) (*Client, error) {
+	kind := strings.ToLower(instance.Type)
+	if kind != config.ArrTypeSonarr && kind != config.ArrTypeRadarr {
+		return nil, fmt.Errorf("unsupported *arr type %q (use sonarr or radarr)", instance.Type)
+	}
+	if instance.URL == "" || instance.APIKey == "" {
+		return nil, fmt.Errorf("*arr instance %q needs url and api-key", instance.Name)
+	}
+
+	name := instance.Name
+	if name == "" {
+		name = kind
+	}
+
+	return &Client{
+		name:       name,
+		kind:       kind,
+		baseURL:    strings.TrimRight(instance.URL, "/"),
+		apiKey:     instance.APIKey,
+		category:   instance.Category,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// Name returns the configured name of the instance
+func (c *Client) Name() string {
+	return c.name
+}
+
+// Handles reports whether a download in the given category belongs to the
+// instance. Without a configured category, the instance's history is asked
+// whether it grabbed the download.
+func (c *Client) Handles(hash, category string) (bool, error) {
+	if c.category != "" {
+		return strings.EqualFold(c.category, category), nil
+	}
+	records, err := c.History(hash)
+	if err != nil {
+		return false, err
+	}
+	return len(records) > 0, nil
+}
+
+// History returns the history records for a download, identified by its torrent hash
+func (c *Client) History(hash string) ([]HistoryRecord, error) {
+	params := url.Values{}
+	params.Set("downloadId", strings.ToUpper(hash))
+	params.Set("pageSize", "50")
+
+	var page struct {
+		Records []HistoryRecord `json:"records"`
+	}
+	if err := c.do(http.MethodGet, "/api/v3/history?"+params.Encode(), nil, &page); err != nil {
+		return nil, err
+	}
+	return page.Records, nil
+}
+
+// IsImported reports whether the instance imported the download
+func (c *Client) IsImported(hash string) (bool, error) {
+	records, err := c.History(hash)
+	if err != nil {
+		return false, err
+	}
+	for _, record := range records {
+		if record.EventType == EventImported {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// TriggerImport asks the instance to scan and import a completed download
+func (c *Client) TriggerImport(hash, path string) error {
+	command := "DownloadedEpisodesScan"
+	if c.kind == config.ArrTypeRadarr {
+		command = "DownloadedMoviesScan"
+	}
+
+	body := map[string]string{
+		"name":             command,
+		"path":             path,
+		"downloadClientId": strings.ToUpper(hash),
+		"importMode":       "Auto",
+	}
+	return c.do(http.MethodPost, "/api/v3/command", body, nil)
+}
+
+// MarkFailed marks the grab of a download as failed so the instance can search for another release
+func (c *Client) MarkFailed(hash string) error {
+	records, err := c.History(hash)
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		if record.EventType == EventGrabbed {
+			return c.do(http.MethodPost, fmt.Sprintf("/api/v3/history/failed/%d", record.ID), nil, nil)
+		}
+	}
+	return nil
+}
+
+// do sends an API request and decodes the JSON response into v if given
+func (c *Client) do(method, path string, body interface{}, v interface{}) error {
+	reader := bytes.NewReader(nil)
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Api-Key", c.apiKey)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s request failed: %w", c.name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s returned status %d for %s", c.name, resp.StatusCode, path)
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
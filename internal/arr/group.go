@@ -0,0 +1,106 @@
+package arr
+
+import (
+	"github.com/elsbrock/plundrio/internal/config"
+	"github.com/elsbrock/plundrio/internal/events"
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// Group fans requests out to all configured *arr instances
+type Group []*Client
+
+// NewGroup creates clients for all configured *arr instances
+func NewGroup(instances []config.ArrInstance) (Group, error) {
+	group := make(Group, 0, len(instances))
+	for _, instance := range instances {
+		client, err := NewClient(instance)
+		if err != nil {
+			return nil, err
+		}
+		group = append(group, client)
+	}
+	return group, nil
+}
+
+// TriggerImport asks the instances a completed download belongs to, by its
+// category or their history, to import it
+func (g Group) TriggerImport(hash, path, category string) {
+	for _, client := range g {
+		handles, err := client.Handles(hash, category)
+		if err != nil {
+			log.Warn("arr").
+				Str("instance", client.Name()).
+				Str("hash", hash).
+				Err(err).
+				Msg("Failed to query history")
+			continue
+		}
+		if !handles {
+			continue
+		}
+		if err := client.TriggerImport(hash, path); err != nil {
+			log.Warn("arr").
+				Str("instance", client.Name()).
+				Str("hash", hash).
+				Err(err).
+				Msg("Failed to trigger import")
+			continue
+		}
+		log.Info("arr").
+			Str("instance", client.Name()).
+			Str("hash", hash).
+			Str("path", path).
+			Msg("Triggered import")
+	}
+}
+
+// IsImported reports whether any instance imported the download
+func (g Group) IsImported(hash string) bool {
+	for _, client := range g {
+		imported, err := client.IsImported(hash)
+		if err != nil {
+			log.Debug("arr").
+				Str("instance", client.Name()).
+				Str("hash", hash).
+				Err(err).
+				Msg("Failed to query history")
+			continue
+		}
+		if imported {
+			return true
+		}
+	}
+	return false
+}
+
+// MarkFailed marks the download as failed in every instance that grabbed it
+func (g Group) MarkFailed(hash string) {
+	for _, client := range g {
+		if err := client.MarkFailed(hash); err != nil {
+			log.Warn("arr").
+				Str("instance", client.Name()).
+				Str("hash", hash).
+				Err(err).
+				Msg("Failed to mark download as failed")
+			continue
+		}
+		log.Info("arr").
+			Str("instance", client.Name()).
+			Str("hash", hash).
+			Msg("Marked download as failed")
+	}
+}
+
+// HandleEvent triggers imports of completed downloads and lets the instances
+// search for another release when Put.io gave up on a transfer
+func (g Group) HandleEvent(e events.Event) {
+	if e.Hash == "" {
+		return
+	}
+	switch e.Type {
+	case events.TransferCompleted:
+		g.TriggerImport(e.Hash, e.Path, e.Category)
+	case events.TransferErrored:
+		g.MarkFailed(e.Hash)
+	}
+}
@@ -0,0 +1,114 @@
+package arr
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/elsbrock/plundrio/internal/config"
+	"github.com/elsbrock/plundrio/internal/events"
+)
+
+// arrServer is a fake *arr instance with a history of grabbed downloads
+type arrServer struct {
+	*httptest.Server
+	grabbed map[string]bool // upper case hashes
+
+	mu       sync.Mutex
+	commands []map[string]string
+}
+
+func newArrServer(t *testing.T, grabbed ...string) *arrServer {
+	s := &arrServer{grabbed: make(map[string]bool)}
+	for _, hash := range grabbed {
+		s.grabbed[strings.ToUpper(hash)] = true
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/api/v3/history":
+			var page struct {
+				Records []HistoryRecord `json:"records"`
+			}
+			if hash := r.URL.Query().Get("downloadId"); s.grabbed[hash] {
+				page.Records = append(page.Records, HistoryRecord{ID: 1, EventType: EventGrabbed, DownloadID: hash})
+			}
+			json.NewEncoder(w).Encode(page)
+		case "/api/v3/command":
+			var command map[string]string
+			json.NewDecoder(r.Body).Decode(&command)
+			s.mu.Lock()
+			s.commands = append(s.commands, command)
+			s.mu.Unlock()
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// triggered returns the paths of the import scans the instance was asked for
+func (s *arrServer) triggered() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var paths []string
+	for _, command := range s.commands {
+		paths = append(paths, command["name"]+" "+command["path"])
+	}
+	return paths
+}
+
+func TestTriggerImportRouting(t *testing.T) {
+	sonarr := newArrServer(t, "aaaa")
+	radarr := newArrServer(t, "bbbb")
+	anime := newArrServer(t)
+	group, err := NewGroup([]config.ArrInstance{
+		{Name: "sonarr", Type: "sonarr", URL: sonarr.URL, APIKey: "key"},
+		{Name: "radarr", Type: "Radarr", URL: radarr.URL + "/", APIKey: "key"},
+		{Name: "anime", Type: "sonarr", URL: anime.URL, APIKey: "key", Category: "tv-anime"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	group.HandleEvent(events.Event{Type: events.TransferCompleted, Hash: "aaaa", Path: "/downloads/show", Category: "tv-sonarr"})
+	group.HandleEvent(events.Event{Type: events.TransferCompleted, Hash: "bbbb", Path: "/downloads/movie", Category: "radarr"})
+	group.HandleEvent(events.Event{Type: events.TransferCompleted, Hash: "cccc", Path: "/downloads/anime", Category: "TV-Anime"})
+	group.HandleEvent(events.Event{Type: events.TransferCompleted, Hash: "dddd", Path: "/downloads/other"})
+	group.HandleEvent(events.Event{Type: events.TransferCompleted, Path: "/downloads/no-hash", Category: "tv-anime"})
+
+	for _, tt := range []struct {
+		name   string
+		server *arrServer
+		want   string
+	}{
+		{"history without category", sonarr, "DownloadedEpisodesScan /downloads/show"},
+		{"radarr command", radarr, "DownloadedMoviesScan /downloads/movie"},
+		{"category", anime, "DownloadedEpisodesScan /downloads/anime"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.server.triggered(); len(got) != 1 || got[0] != tt.want {
+				t.Errorf("triggered %q, want only %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewGroupErrors(t *testing.T) {
+	for _, instance := range []config.ArrInstance{
+		{Type: "lidarr", URL: "http://localhost", APIKey: "key"},
+		{Type: "sonarr", APIKey: "key"},
+		{Type: "radarr", URL: "http://localhost"},
+	} {
+		if _, err := NewGroup([]config.ArrInstance{instance}); err == nil {
+			t.Errorf("NewGroup(%+v) succeeded", instance)
+		}
+	}
+}
@@ -1,5 +1,268 @@
 package config
 
+import "time"
+
+// Providers are the services transfers are added to and downloaded from
+const (
+	// ProviderPutio uses Put.io
+	ProviderPutio = "putio"
+
+	// ProviderRealDebrid uses Real-Debrid, which only takes magnet links and
+	// torrent files
+	ProviderRealDebrid = "realdebrid"
+
+	// ProviderPremiumize uses Premiumize.me
+	ProviderPremiumize = "premiumize"
+)
+
+// Bandwidth strategies control how aria2c connections are shared between concurrent downloads
+const (
+	// BandwidthStrategyFair splits connections evenly across active downloads
+	BandwidthStrategyFair = "fair"
+
+	// BandwidthStrategyFinishFirst gives the first download all connections so it completes fastest
+	BandwidthStrategyFinishFirst = "finish-first"
+)
+
+// Downloaders fetch the files of a transfer
+const (
+	// DownloaderAuto uses aria2c if it is installed and the native downloader otherwise
+	DownloaderAuto = "auto"
+
+	// DownloaderAria2c runs aria2c for every download
+	DownloaderAria2c = "aria2c"
+
+	// DownloaderNative downloads files in segments over several HTTP connections without aria2c
+	DownloaderNative = "native"
+)
+
+// Migration modes control what happens to existing downloads when the target directory changes
+const (
+	// MigrateModeOff leaves existing downloads in the old target directory
+	MigrateModeOff = "off"
+
+	// MigrateModeMove moves existing downloads to the new target directory
+	MigrateModeMove = "move"
+
+	// MigrateModeLink hard-links existing downloads into the new target directory
+	MigrateModeLink = "link"
+)
+
+// Copy strategies control how downloads are moved when a rename is not possible,
+// e.g. because source and destination are on different filesystems
+const (
+	// CopyStrategyReflink clones files on filesystems that support it (Btrfs,
+	// XFS) and copies them otherwise
+	CopyStrategyReflink = "reflink"
+
+	// CopyStrategyCopy always copies files
+	CopyStrategyCopy = "copy"
+
+	// CopyStrategySymlink leaves files where they are and links them from the
+	// destination. It only applies to migrations, other moves copy files.
+	CopyStrategySymlink = "symlink"
+)
+
+// Target types control how files are written to the target directory
+const (
+	// TargetTypeAuto writes to FUSE mounts such as rclone mount like TargetTypeMount
+	// and to other filesystems like TargetTypeLocal
+	TargetTypeAuto = "auto"
+
+	// TargetTypeLocal writes files over several connections into preallocated files
+	TargetTypeLocal = "local"
+
+	// TargetTypeMount writes files in order over a single connection without
+	// preallocating them, which network mounts and their write caches handle best
+	TargetTypeMount = "mount"
+)
+
+// Network verify modes control how downloads on network filesystems (NFS,
+// SMB) are checked once they are written
+const (
+	// NetworkVerifyOff trusts the network filesystem like a local one
+	NetworkVerifyOff = "off"
+
+	// NetworkVerifySize reads the size of the file back from the server
+	NetworkVerifySize = "size"
+
+	// NetworkVerifySample also compares samples of the file with the source
+	NetworkVerifySample = "sample"
+)
+
+// Watch modes control how the watch directory notices new files
+const (
+	// WatchModeAuto polls directories on network shares and uses the
+	// notifications of the operating system for all others
+	WatchModeAuto = "auto"
+
+	// WatchModeNotify uses the notifications of the operating system
+	WatchModeNotify = "notify"
+
+	// WatchModePoll lists the directory every watch-poll-interval
+	WatchModePoll = "poll"
+)
+
+// Cleanup triggers control when remote files are deleted after a download
+const (
+	// CleanupOnDownload deletes remote files as soon as the download completes
+	CleanupOnDownload = "download"
+
+	// CleanupOnImport deletes remote files once an *arr application imported the download
+	CleanupOnImport = "import"
+)
+
+// Partial policies control what *arr applications are told about transfers
+// whose files partly failed for good
+const (
+	// PartialPolicyFail reports the transfer as stopped with an error
+	PartialPolicyFail = "fail"
+
+	// PartialPolicyComplete reports the transfer as completed with the files
+	// that could be downloaded
+	PartialPolicyComplete = "complete"
+)
+
+// Collision policies control what happens when files of two transfers resolve to the same local path
+const (
+	// CollisionPolicySuffix adds a counter to the name of the later file
+	CollisionPolicySuffix = "suffix"
+
+	// CollisionPolicySkip leaves the later file out
+	CollisionPolicySkip = "skip"
+
+	// CollisionPolicyOverwriteIfLarger keeps the larger file and leaves the smaller one out
+	CollisionPolicyOverwriteIfLarger = "overwrite-if-larger"
+)
+
+// Foreign transfer modes control what happens to transfers in the put.io
+// folder that were not added through plundrio, e.g. by others sharing the account
+const (
+	// ForeignTransfersDownload downloads them like transfers added through plundrio
+	ForeignTransfersDownload = "download"
+
+	// ForeignTransfersIgnore leaves them alone
+	ForeignTransfersIgnore = "ignore"
+
+	// ForeignTransfersMatch downloads those whose name matches ForeignMatch
+	ForeignTransfersMatch = "match"
+)
+
+// Quota actions control what happens to transfers an API user adds beyond their quota
+const (
+	// QuotaActionReject refuses the transfer
+	QuotaActionReject = "reject"
+
+	// QuotaActionQueue holds the transfer back until the quota allows it
+	QuotaActionQueue = "queue"
+)
+
+// Report periods control how often activity summaries are generated
+const (
+	// ReportPeriodOff disables summary reports
+	ReportPeriodOff = "off"
+
+	// ReportPeriodDaily summarizes each day after midnight
+	ReportPeriodDaily = "daily"
+
+	// ReportPeriodWeekly summarizes each week after midnight on Monday
+	ReportPeriodWeekly = "weekly"
+)
+
+// Profiles tune workers, connections, queue sizes and polling for the hardware plundrio runs on
+const (
+	// ProfileDefault suits desktops and servers
+	ProfileDefault = "default"
+
+	// ProfileLowPower suits Raspberry Pis and consumer NAS devices
+	ProfileLowPower = "low-power"
+)
+
+// Supported *arr application types
+const (
+	ArrTypeSonarr = "sonarr"
+	ArrTypeRadarr = "radarr"
+)
+
+// ArrInstance describes a Sonarr or Radarr instance plundrio coordinates with
+type ArrInstance struct {
+	Name   string `mapstructure:"name"`
+	Type   string `mapstructure:"type"`
+	URL    string `mapstructure:"url"`
+	APIKey string `mapstructure:"api-key"`
+	// Category is the download client category the instance adds transfers
+	// with. Without it, the instance's history tells whether it grabbed a
+	// download.
+	Category string `mapstructure:"category"`
+}
+
+// APIUser is someone using plundrio through the API or a Transmission client
+// with their own token, so the transfers they add are attributed to them and
+// count against their quota
+type APIUser struct {
+	Name         string `mapstructure:"name" json:"name"`
+	Token        string `mapstructure:"token" json:"-"`
+	MaxTransfers int    `mapstructure:"max-transfers" json:"max_transfers,omitempty"` // transfers not downloaded yet at once (0 means unlimited)
+	MonthlyGB    int    `mapstructure:"monthly-gb" json:"monthly_gb,omitempty"`       // GB downloaded per calendar month (0 means unlimited)
+}
+
+// ProviderRoute sends new transfers of a category, or whose name matches a
+// regular expression, to a provider first
+type ProviderRoute struct {
+	Category string `mapstructure:"category" json:"category,omitempty"`
+	Match    string `mapstructure:"match" json:"match,omitempty"`
+	Provider string `mapstructure:"provider" json:"provider"`
+}
+
+// VolumeLimit caps the number of concurrent downloads to the volume a path is on
+type VolumeLimit struct {
+	Path    string `mapstructure:"path" json:"path"`
+	Writers int    `mapstructure:"writers" json:"writers"`
+}
+
+// Mirror keeps a local copy of a folder on put.io: new files are downloaded
+// and, with Delete, files deleted on put.io are deleted locally as well
+type Mirror struct {
+	Folder int64  `mapstructure:"folder" json:"folder"`           // ID of the folder on put.io
+	Target string `mapstructure:"target" json:"target,omitempty"` // directory the folder is mirrored to (empty uses the target directory)
+	Delete bool   `mapstructure:"delete" json:"delete,omitempty"` // delete local files that were deleted on put.io
+}
+
+// MaintenanceWindow is a recurring period in which downloads and polling are
+// paused, e.g. while backups run. It begins whenever the cron expression Start
+// matches and lasts for Duration.
+type MaintenanceWindow struct {
+	Start    string        `mapstructure:"start" json:"start"`
+	Duration time.Duration `mapstructure:"duration" json:"duration"`
+}
+
+// DownloadWindow is a recurring period in which downloads may start, e.g. at
+// night on a metered connection. It begins whenever the cron expression Start
+// matches and lasts for Duration.
+type DownloadWindow struct {
+	Start    string        `mapstructure:"start" json:"start"`
+	Duration time.Duration `mapstructure:"duration" json:"duration"`
+}
+
+// Actions schedules can run
+const (
+	ActionScan       = "scan"        // Check put.io for new and finished transfers
+	ActionEmptyTrash = "empty-trash" // Empty the put.io trash
+	ActionCleanup    = "cleanup"     // Delete downloads past their retention period
+	ActionReport     = "report"      // Deliver the activity summary of the current period
+	ActionMirror     = "mirror"      // Download new files of mirrored folders
+)
+
+// ScheduleActions are the actions schedules can run
+var ScheduleActions = []string{ActionScan, ActionEmptyTrash, ActionCleanup, ActionReport, ActionMirror}
+
+// Schedule runs Action whenever the cron expression Cron matches. Cron may
+// also be "@every <duration>" for a fixed interval.
+type Schedule struct {
+	Action string `mapstructure:"action" json:"action"`
+	Cron   string `mapstructure:"cron" json:"cron"`
+}
+
 // Config holds the runtime configuration
 type Config struct {
 	// TargetDir is where completed downloads will be stored
@@ -14,9 +277,247 @@ type Config struct {
 	// OAuthToken is the Put.io OAuth token
 	OAuthToken string
 
+	// ExtraTokens are further OAuth tokens of the same account; API calls
+	// rotate across them and OAuthToken to spread the API rate limit
+	ExtraTokens []string
+
+	// Provider is the service transfers are added to and downloaded from
+	// (putio, realdebrid, premiumize)
+	Provider string
+
+	// FallbackProviders take new transfers in order when Provider rejects
+	// them or is down
+	FallbackProviders []string
+
+	// ProviderRoutes send new transfers to other providers than Provider
+	// first; the first matching route applies
+	ProviderRoutes []ProviderRoute
+
+	// RealDebridToken is the Real-Debrid API token, used with the realdebrid provider
+	RealDebridToken string
+
+	// PremiumizeAPIKey is the Premiumize API key, used with the premiumize provider
+	PremiumizeAPIKey string
+
 	// ListenAddr is the address to listen for transmission-rpc requests
 	ListenAddr string
 
+	// StatusListen is an extra address serving only the read-only status
+	// page, for homelab dashboards (empty serves it on ListenAddr only)
+	StatusListen string
+
+	// StatusRedactNames hides transfer names on the status page
+	StatusRedactNames bool
+
 	// WorkerCount is the number of concurrent download workers (default: 4)
 	WorkerCount int
+
+	// Profile is the resource profile (default, low-power)
+	Profile string
+
+	// Downloader is what downloads files (auto, aria2c, native)
+	Downloader string
+
+	// Connections is the number of connections shared between concurrent downloads (0 uses the profile default)
+	Connections int
+
+	// HostConnections is how many connections all downloads together
+	// may open to the same download server (0 means unlimited)
+	HostConnections int
+
+	// VolumeWriters is how many downloads may write to the same volume at once (0 means unlimited)
+	VolumeWriters int
+
+	// VolumeLimits overrides VolumeWriters for the volumes of the given paths
+	VolumeLimits []VolumeLimit
+
+	// MaxQueuedJobs is how many download jobs are kept in memory; further jobs
+	// are spilled to the state directory (0 uses five per worker)
+	MaxQueuedJobs int
+
+	// MaintenanceWindows are periods in which downloads and polling are paused
+	MaintenanceWindows []MaintenanceWindow
+
+	// DownloadWindows are periods in which downloads start, outside of them
+	// downloads wait (empty means downloads start any time)
+	DownloadWindows []DownloadWindow
+
+	// Schedules are actions run on cron expressions
+	Schedules []Schedule
+
+	// Mirrors are put.io folders kept in sync with a local directory (config file only)
+	Mirrors []Mirror
+
+	// MirrorInterval is how often mirrored folders are checked for changes (0 only checks on schedules)
+	MirrorInterval time.Duration
+
+	// WatchDir is a blackhole directory, .torrent and .magnet files dropped
+	// into it are added as transfers (empty disables)
+	WatchDir string
+
+	// WatchMode is how new files in WatchDir are noticed (auto, notify, poll)
+	WatchMode string
+
+	// WatchPollInterval is how often WatchDir is listed when it is polled
+	WatchPollInterval time.Duration
+
+	// SkipTrash permanently deletes remote files instead of moving them to the Put.io trash
+	SkipTrash bool
+
+	// EmptyTrashInterval is how often the Put.io trash is emptied (0 disables)
+	EmptyTrashInterval time.Duration
+
+	// BandwidthStrategy is how connections are shared between concurrent downloads (fair, finish-first)
+	BandwidthStrategy string
+
+	// SpeedLimit is the download speed limit per download in KB/s (0 means unlimited)
+	SpeedLimit int
+
+	// AltSpeedLimit is the alternative speed limit per download in KB/s that
+	// can be switched on at runtime, like Transmission's turtle mode (0 means unlimited)
+	AltSpeedLimit int
+
+	// MaxDownloadRate is the speed limit of all downloads together in KB/s (0 means unlimited)
+	MaxDownloadRate int
+
+	// CategorySpeedLimits are speed limits in KB/s for each transfer of a
+	// category, i.e. of a subdirectory of the target directory
+	CategorySpeedLimits map[string]int
+
+	// DownloadQueueSize is how many downloads run at once (0 means one per worker)
+	DownloadQueueSize int
+
+	// StateDir is where plundrio keeps state between runs (empty disables persistence)
+	StateDir string
+
+	// DiskReserveMB is how many MB are kept free on the disk of the target directory; downloads that do not fit wait
+	DiskReserveMB int
+
+	// HistoryDays is how many days finished downloads are kept in the download history (0 keeps them forever)
+	HistoryDays int
+
+	// CopyStrategy is how downloads are moved when a rename is not possible (reflink, copy, symlink)
+	CopyStrategy string
+
+	// CollisionPolicy is what happens when files of two transfers share a local path (suffix, skip, overwrite-if-larger)
+	CollisionPolicy string
+
+	// MigrateMode is how existing downloads follow a changed target directory (off, move, link)
+	MigrateMode string
+
+	// ImportExisting adopts files already in the target directory on the first start instead of downloading them again
+	ImportExisting bool
+
+	// TargetType is how files are written to the target directory (auto, local, mount)
+	TargetType string
+
+	// IncompleteDir is where files are written while they are downloaded, they
+	// are moved to the target directory once verified (empty writes in place)
+	IncompleteDir string
+
+	// IncompleteSuffix is appended to the names of files while they are downloaded
+	IncompleteSuffix string
+
+	// NetworkVerify is how downloads on NFS and SMB shares are checked after writing them (off, size, sample)
+	NetworkVerify string
+
+	// VerifyChecksums compares downloaded files with the CRC32 checksum the provider reports
+	VerifyChecksums bool
+
+	// MaxLoad is the load average per CPU above which fewer downloads run at once (0 disables)
+	MaxLoad float64
+
+	// MaxMemoryPercent is the share of memory in use above which fewer downloads run at once (0 disables)
+	MaxMemoryPercent int
+
+	// MaxDiskLatency is the average I/O latency of the download disk above which
+	// fewer downloads run at once (0 disables)
+	MaxDiskLatency time.Duration
+
+	// RetentionDays is how many days local downloads are kept before deletion (0 keeps them forever)
+	RetentionDays int
+
+	// RetentionCategories overrides RetentionDays for downloads in category subdirectories
+	RetentionCategories map[string]int
+
+	// RetentionDryRun only reports expired downloads instead of deleting them
+	RetentionDryRun bool
+
+	// CleanupOn is when remote files are deleted (download, import)
+	CleanupOn string
+
+	// Arr lists the *arr instances to coordinate with through their APIs
+	Arr []ArrInstance
+
+	// NotifyURL is the webhook notifications are posted to (empty disables notifications)
+	NotifyURL string
+
+	// NotifyTitleTemplate, NotifyBodyTemplate and NotifyPayloadTemplate are Go
+	// text/template strings for notifications (empty uses the defaults)
+	NotifyTitleTemplate   string
+	NotifyBodyTemplate    string
+	NotifyPayloadTemplate string
+
+	// PushSubject is the mailto: or https: contact sent to push services with
+	// Web Push notifications for the dashboard (empty disables Web Push)
+	PushSubject string
+
+	// ProgressCloudWeight is the share in percent of put.io's progress in the
+	// reported progress of a transfer; the rest is the local download
+	ProgressCloudWeight int
+
+	// SlowSpeedThreshold is the speed in KB/s below which a transfer counts as slow (0 disables alerts)
+	SlowSpeedThreshold int
+
+	// SlowSpeedDuration is how long a transfer must stay slow before an alert is raised
+	SlowSpeedDuration time.Duration
+
+	// RetryBudget is how many download retries all transfers together may
+	// make per hour before retries back off (0 means unlimited)
+	RetryBudget int
+
+	// MaxRetryCycles is how often the failed files of a transfer are downloaded
+	// again automatically before the transfer is quarantined
+	MaxRetryCycles int
+
+	// PartialPolicy is how a quarantined transfer with downloaded files is
+	// reported (fail, complete)
+	PartialPolicy string
+
+	// ReportPeriod is how often an activity summary is generated (off, daily, weekly)
+	ReportPeriod string
+
+	// ReportFile is a file summaries are appended to (empty only logs and notifies)
+	ReportFile string
+
+	// SharedTargetDir is where files shared by put.io friends are downloaded to
+	// (empty uses the target directory)
+	SharedTargetDir string
+
+	// ForeignTransfers is what happens to transfers in the put.io folder that
+	// were not added through plundrio (download, ignore, match)
+	ForeignTransfers string
+
+	// ForeignTargetDir is where foreign transfers are downloaded to (empty uses the target directory)
+	ForeignTargetDir string
+
+	// ForeignMatch is the regular expression the names of foreign transfers
+	// must match to be downloaded in match mode
+	ForeignMatch string
+
+	// CORSOrigins lists the origins browsers may call the API from ("*" allows any, empty disables CORS)
+	CORSOrigins []string
+
+	// CORSHeaders lists the request headers browsers may send with API calls
+	CORSHeaders []string
+
+	// APIUsers identifies API and RPC requests by their token; transfers added
+	// with a token are attributed to its user (config file only)
+	APIUsers []APIUser
+
+	// QuotaAction is what happens to transfers added beyond an API user's quota (reject, queue)
+	QuotaAction string
+
+	// PutioDebug captures sanitized Put.io API requests and responses for bug reports
+	PutioDebug bool
 }
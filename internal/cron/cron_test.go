@@ -0,0 +1,141 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+// date returns the minute of a day in UTC
+func date(year int, month time.Month, day, hour, minute int) time.Time {
+	return time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"@weird",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"5-1 * * * *",
+		"1-2-3 * * * *",
+		"* * * foo *",
+		"* * * * monday",
+		"1,,2 * * * *",
+	} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q) succeeded", expr)
+		}
+	}
+}
+
+func TestParseString(t *testing.T) {
+	s, err := Parse("@Daily")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.String() != "@Daily" {
+		t.Errorf("String() = %q, want @Daily", s.String())
+	}
+}
+
+func TestMatches(t *testing.T) {
+	// 2024-06-01 is a Saturday
+	for _, tt := range []struct {
+		expr string
+		t    time.Time
+		want bool
+	}{
+		{"* * * * *", date(2024, 6, 1, 13, 37), true},
+		{"@daily", date(2024, 6, 1, 0, 0), true},
+		{"@daily", date(2024, 6, 1, 0, 1), false},
+		{"@hourly", date(2024, 6, 1, 13, 0), true},
+
+		// Sunday is both 0 and 7
+		{"0 0 * * 0", date(2024, 6, 2, 0, 0), true},
+		{"0 0 * * 7", date(2024, 6, 2, 0, 0), true},
+		{"0 0 * * sun", date(2024, 6, 2, 0, 0), true},
+		{"0 0 * * 5-7", date(2024, 6, 2, 0, 0), true},
+		{"0 0 * * 7", date(2024, 6, 3, 0, 0), false},
+
+		// Steps, ranges and lists
+		{"*/15 * * * *", date(2024, 6, 1, 0, 45), true},
+		{"*/15 * * * *", date(2024, 6, 1, 0, 50), false},
+		{"5/20 * * * *", date(2024, 6, 1, 0, 45), true},
+		{"5/20 * * * *", date(2024, 6, 1, 0, 40), false},
+		{"0 8-18/2 * * *", date(2024, 6, 1, 18, 0), true},
+		{"0 8-18/2 * * *", date(2024, 6, 1, 19, 0), false},
+		{"0,30 1,13 * * *", date(2024, 6, 1, 13, 30), true},
+
+		// Names in any case
+		{"0 9 * JAN,jul Mon-Fri", date(2024, 7, 1, 9, 0), true},
+		{"0 9 * JAN,jul Mon-Fri", date(2024, 7, 6, 9, 0), false},
+		{"0 9 * JAN,jul Mon-Fri", date(2024, 6, 3, 9, 0), false},
+
+		// A restricted day of month and day of week match if either matches
+		{"0 0 1 * mon", date(2024, 6, 1, 0, 0), true},
+		{"0 0 1 * mon", date(2024, 6, 3, 0, 0), true},
+		{"0 0 1 * mon", date(2024, 6, 4, 0, 0), false},
+
+		// unless one of them starts with *, then both have to
+		{"0 0 */2 * mon", date(2024, 6, 3, 0, 0), true},
+		{"0 0 */2 * mon", date(2024, 6, 1, 0, 0), false},
+		{"0 0 */2 * mon", date(2024, 6, 10, 0, 0), false},
+		{"0 0 1 * */2", date(2024, 6, 1, 0, 0), true},
+		{"0 0 1 * */2", date(2024, 7, 1, 0, 0), false},
+	} {
+		s, err := Parse(tt.expr)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", tt.expr, err)
+		}
+		if got := s.Matches(tt.t); got != tt.want {
+			t.Errorf("%q.Matches(%s) = %v, want %v", tt.expr, tt.t.Format("Mon 2006-01-02 15:04"), got, tt.want)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("time zone database not available: %v", err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"next minute", "* * * * *", date(2024, 6, 1, 12, 0).Add(30 * time.Second), date(2024, 6, 1, 12, 1)},
+		{"strictly after", "0 12 * * *", date(2024, 6, 1, 12, 0), date(2024, 6, 2, 12, 0)},
+		{"next weekday", "30 2 * * mon-fri", date(2024, 6, 7, 3, 0), date(2024, 6, 10, 2, 30)},
+		{"new year", "@yearly", date(2024, 12, 31, 23, 59), date(2025, 1, 1, 0, 0)},
+		{"step", "5/20 * * * *", date(2024, 6, 1, 12, 46), date(2024, 6, 1, 13, 5)},
+		{"sunday as 7", "0 0 * * 7", date(2024, 6, 1, 12, 0), date(2024, 6, 2, 0, 0)},
+		{"leap day", "0 0 29 2 *", date(2024, 3, 1, 0, 0), date(2028, 2, 29, 0, 0)},
+		{"never", "0 0 30 2 *", date(2024, 1, 1, 0, 0), time.Time{}},
+		{"either day", "0 0 13 * fri", date(2024, 6, 1, 0, 0), date(2024, 6, 7, 0, 0)},
+
+		// The local time 02:30 does not exist when the clocks go forward,
+		// and 02:00 happens twice when they go back
+		{"skipped by daylight saving time", "30 2 * * *", time.Date(2024, 3, 31, 0, 0, 0, 0, berlin), time.Date(2024, 4, 1, 2, 30, 0, 0, berlin)},
+		{"repeated by daylight saving time", "0 * * * *", time.Date(2024, 10, 27, 0, 0, 0, 0, time.UTC).In(berlin), time.Date(2024, 10, 27, 1, 0, 0, 0, time.UTC).In(berlin)},
+		{"after daylight saving time", "0 3 * * *", time.Date(2024, 3, 31, 1, 0, 0, 0, berlin), time.Date(2024, 3, 31, 3, 0, 0, 0, berlin)},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := s.Next(tt.from); !got.Equal(tt.want) {
+				t.Errorf("Next(%s) = %s, want %s", tt.from, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package download
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// aria2cCommand creates an aria2c command. aria2c translates its messages,
+// so it runs with the C locale to keep the error messages recognizable.
+func aria2cCommand(ctx context.Context, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "aria2c", args...)
+	cmd.Env = append(os.Environ(), "LC_ALL=C")
+	return cmd
+}
+
+// aria2cExitCode describes an exit code documented by aria2c
+type aria2cExitCode struct {
+	Type      string // DownloadError type
+	Code      string // DownloadError code
+	Message   string
+	Transient bool // Retrying the download may succeed
+}
+
+// aria2cExitCodes maps the error codes of aria2c downloads to download
+// errors. Codes for BitTorrent, Metalink and RPC features plundrio does not
+// use are left out.
+var aria2cExitCodes = map[int]aria2cExitCode{
+	1:  {"Aria2cFailed", ErrorCodeUnknown, "unknown error", false},
+	2:  {"Timeout", ErrorCodeNetwork, "timed out", true},
+	3:  {"ResourceNotFound", ErrorCodeRemoteGone, "resource not found", false},
+	4:  {"ResourceNotFound", ErrorCodeRemoteGone, "too many resources not found", false},
+	5:  {"TooSlow", ErrorCodeNetwork, "download speed too slow", true},
+	6:  {"NetworkProblem", ErrorCodeNetwork, "network problem", true},
+	7:  {"Unfinished", ErrorCodeCancelled, "aria2c was stopped with downloads unfinished", true},
+	8:  {"ResumeUnsupported", ErrorCodeNetwork, "server does not support resuming", false},
+	9:  {"DiskFull", ErrorCodeDiskFull, "not enough disk space", false},
+	10: {"PieceLengthMismatch", ErrorCodeFilesystem, "piece length differs from control file", false},
+	11: {"AlreadyDownloading", ErrorCodeFilesystem, "file is already being downloaded", true},
+	13: {"FileExists", ErrorCodeFilesystem, "file already exists", false},
+	14: {"FileSystemError", ErrorCodeFilesystem, "renaming file failed", false},
+	15: {"FileSystemError", ErrorCodeFilesystem, "could not open existing file", false},
+	16: {"FileSystemError", ErrorCodeFilesystem, "could not create or truncate file", false},
+	17: {"FileSystemError", ErrorCodeFilesystem, "file I/O error", false},
+	18: {"FileSystemError", ErrorCodeFilesystem, "could not create directory", false},
+	19: {"NetworkProblem", ErrorCodeNetwork, "name resolution failed", true},
+	21: {"ServerError", ErrorCodeNetwork, "FTP command failed", true},
+	22: {"ServerError", ErrorCodeNetwork, "unexpected HTTP response", true},
+	23: {"ServerError", ErrorCodeNetwork, "too many redirects", false},
+	24: {"AuthFailed", ErrorCodeAuthFailed, "HTTP authorization failed", false},
+	28: {"InvalidOption", ErrorCodeUnknown, "invalid aria2c option", false},
+	29: {"ServerError", ErrorCodeNetwork, "server temporarily unable to handle the request", true},
+	32: {"ChecksumMismatch", ErrorCodeChecksumMismatch, "checksum validation failed", true},
+}
+
+// isAria2cForbidden reports whether an aria2c error message tells that the
+// server refused the download, which happens once a Put.io URL has expired
+func isAria2cForbidden(message string) bool {
+	return strings.Contains(message, "status=403")
+}
+
+// isAria2cRateLimited reports whether an aria2c error message tells that the
+// server refused the download because of too many requests
+func isAria2cRateLimited(message string) bool {
+	return strings.Contains(message, "status=429")
+}
@@ -0,0 +1,384 @@
+package download
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+const (
+	aria2PollInterval   = time.Second      // how often the status of running downloads is asked for
+	aria2StartTimeout   = 10 * time.Second // how long aria2c may take to accept RPC calls
+	aria2RemoveTimeout  = 10 * time.Second // how long aria2c may take to let go of a removed download
+	aria2ShutdownWait   = 5 * time.Second  // how long aria2c may take to exit before it is killed
+	aria2MaxConcurrent  = 1000             // downloads aria2c runs at once; plundrio limits them itself
+	aria2MaxResults     = 1000             // finished downloads aria2c remembers until plundrio removes them
+	aria2RequestTimeout = 30 * time.Second // for a single RPC call
+)
+
+// Status of a download as reported by aria2c
+const (
+	aria2StatusActive   = "active"
+	aria2StatusWaiting  = "waiting"
+	aria2StatusPaused   = "paused"
+	aria2StatusError    = "error"
+	aria2StatusComplete = "complete"
+	aria2StatusRemoved  = "removed"
+)
+
+// aria2Daemon is an aria2c process running with its JSON-RPC interface
+// enabled. All aria2c downloads of the manager are handed to it, instead of
+// starting a process per download and scraping its console output.
+type aria2Daemon struct {
+	cmd    *exec.Cmd
+	url    string // of the JSON-RPC endpoint
+	secret string // the RPC secret, so other local processes cannot use it
+	client *http.Client
+	exited chan struct{} // closed when the process exited
+}
+
+// aria2Status is the part of aria2.tellStatus plundrio uses. aria2c sends
+// numbers as strings.
+type aria2Status struct {
+	Status          string `json:"status"`
+	TotalLength     string `json:"totalLength"`
+	CompletedLength string `json:"completedLength"`
+	DownloadSpeed   string `json:"downloadSpeed"`
+	ErrorCode       string `json:"errorCode"`
+	ErrorMessage    string `json:"errorMessage"`
+}
+
+// aria2StatusKeys are the keys aria2.tellStatus is asked for
+var aria2StatusKeys = []string{"status", "totalLength", "completedLength", "downloadSpeed", "errorCode", "errorMessage"}
+
+// unfinished reports whether aria2c is still working on the download
+func (s aria2Status) unfinished() bool {
+	return s.Status == aria2StatusActive || s.Status == aria2StatusWaiting || s.Status == aria2StatusPaused
+}
+
+// progress returns the downloaded and total bytes and the current speed in
+// bytes per second. The total is 0 until aria2c knows the size.
+func (s aria2Status) progress() (completed, total int64, speed float64) {
+	completed, _ = strconv.ParseInt(s.CompletedLength, 10, 64)
+	total, _ = strconv.ParseInt(s.TotalLength, 10, 64)
+	speed, _ = strconv.ParseFloat(s.DownloadSpeed, 64)
+	return completed, total, speed
+}
+
+// err converts a failed download into a DownloadError. An expired put.io URL
+// and rate limiting are told by the HTTP status in the message:
+//
+//	The response status is not successful. status=403
+func (s aria2Status) err(name string) error {
+	switch {
+	case isAria2cForbidden(s.ErrorMessage):
+		return NewURLExpiredError(name)
+	case isAria2cRateLimited(s.ErrorMessage):
+		return NewRateLimitedError(name)
+	}
+	code, err := strconv.Atoi(s.ErrorCode)
+	if err != nil || code <= 0 {
+		code = 1
+	}
+	return NewAria2cError(name, code)
+}
+
+// aria2RPCError is an error returned by an aria2c RPC call
+type aria2RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *aria2RPCError) Error() string {
+	return fmt.Sprintf("aria2c RPC error %d: %s", e.Code, e.Message)
+}
+
+// startAria2Daemon starts aria2c with RPC on a free local port and waits
+// until it answers. overallLimit is the speed limit of all downloads
+// together in KB/s (0 means unlimited).
+func startAria2Daemon(overallLimit int) (*aria2Daemon, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to find a port for aria2c: %w", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	secret := make([]byte, 16)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to create aria2c RPC secret: %w", err)
+	}
+
+	d := &aria2Daemon{
+		url:    fmt.Sprintf("http://127.0.0.1:%d/jsonrpc", port),
+		secret: hex.EncodeToString(secret),
+		client: &http.Client{Timeout: aria2RequestTimeout},
+		exited: make(chan struct{}),
+	}
+	d.cmd = aria2cCommand(context.Background(),
+		"--enable-rpc",
+		"--rpc-listen-all=false",
+		"--rpc-listen-port="+strconv.Itoa(port),
+		"--rpc-secret="+d.secret,
+		"--stop-with-process="+strconv.Itoa(os.Getpid()), // do not outlive plundrio
+		"--max-concurrent-downloads="+strconv.Itoa(aria2MaxConcurrent),
+		"--max-download-result="+strconv.Itoa(aria2MaxResults),
+		"--max-overall-download-limit="+aria2Limit(overallLimit),
+		"--max-tries=5",
+		"--connect-timeout=30",
+		"--timeout=60",
+		"--allow-overwrite=true",
+		"--auto-file-renaming=false",
+		"--continue=true", // Resume support
+		"--summary-interval=0",
+		"--console-log-level=warn",
+	)
+	output, err := d.cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdout pipe: %w", err)
+	}
+	d.cmd.Stderr = d.cmd.Stdout
+	if err := d.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start aria2c: %w", err)
+	}
+
+	go d.logOutput(output)
+	go func() {
+		err := d.cmd.Wait()
+		log.Debug("aria2c").Err(err).Msg("aria2c exited")
+		close(d.exited)
+	}()
+
+	// aria2c needs a moment to open its RPC port
+	deadline := time.Now().Add(aria2StartTimeout)
+	for {
+		var version struct {
+			Version string `json:"version"`
+		}
+		err := d.call(context.Background(), "aria2.getVersion", &version)
+		if err == nil {
+			log.Info("aria2c").
+				Str("version", version.Version).
+				Int("port", port).
+				Msg("Started aria2c")
+			return d, nil
+		}
+		select {
+		case <-d.exited:
+			return nil, fmt.Errorf("aria2c exited right after starting: %w", err)
+		case <-time.After(100 * time.Millisecond):
+		}
+		if time.Now().After(deadline) {
+			d.kill()
+			return nil, fmt.Errorf("aria2c did not accept RPC calls in time: %w", err)
+		}
+	}
+}
+
+// logOutput logs what aria2c prints, which are warnings and errors only
+func (d *aria2Daemon) logOutput(output io.Reader) {
+	scanner := bufio.NewScanner(output)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			log.Debug("aria2c").Str("aria2c_output", line).Msg("aria2c output")
+		}
+	}
+}
+
+// running reports whether the aria2c process is still alive
+func (d *aria2Daemon) running() bool {
+	select {
+	case <-d.exited:
+		return false
+	default:
+		return true
+	}
+}
+
+// call invokes an aria2c RPC method and decodes its result into result,
+// which may be nil
+func (d *aria2Daemon) call(ctx context.Context, method string, result interface{}, params ...interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      "plundrio",
+		"method":  method,
+		"params":  append([]interface{}{"token:" + d.secret}, params...),
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("aria2c RPC call %s failed: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	var reply struct {
+		Result json.RawMessage `json:"result"`
+		Error  *aria2RPCError  `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return fmt.Errorf("invalid aria2c RPC response to %s: %w", method, err)
+	}
+	if reply.Error != nil {
+		return reply.Error
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(reply.Result, result)
+}
+
+// addURI starts downloading a URL with the given per-download options and
+// returns the GID aria2c identifies the download by
+func (d *aria2Daemon) addURI(ctx context.Context, url string, options map[string]string) (string, error) {
+	var gid string
+	err := d.call(ctx, "aria2.addUri", &gid, []string{url}, options)
+	return gid, err
+}
+
+// status returns the status of a download
+func (d *aria2Daemon) status(ctx context.Context, gid string) (aria2Status, error) {
+	var status aria2Status
+	err := d.call(ctx, "aria2.tellStatus", &status, gid, aria2StatusKeys)
+	return status, err
+}
+
+// remove stops a download, keeping the partial file and its control file so
+// the download can be continued later, and waits until aria2c let go of the
+// file. aria2c forgets the download afterwards.
+func (d *aria2Daemon) remove(gid string) {
+	ctx, cancel := context.WithTimeout(context.Background(), aria2RemoveTimeout)
+	defer cancel()
+
+	if err := d.call(ctx, "aria2.forceRemove", nil, gid); err == nil {
+		// aria2c stops the download in the background
+		for ctx.Err() == nil {
+			status, err := d.status(ctx, gid)
+			if err != nil || !status.unfinished() {
+				break
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+	d.forget(gid)
+}
+
+// forget drops the result of a finished download from aria2c's memory
+func (d *aria2Daemon) forget(gid string) {
+	ctx, cancel := context.WithTimeout(context.Background(), aria2RequestTimeout)
+	defer cancel()
+	if err := d.call(ctx, "aria2.removeDownloadResult", nil, gid); err != nil {
+		log.Debug("aria2c").Str("gid", gid).Err(err).Msg("Failed to remove download result")
+	}
+}
+
+// changeOption changes options of a running download
+func (d *aria2Daemon) changeOption(ctx context.Context, gid string, options map[string]string) error {
+	return d.call(ctx, "aria2.changeOption", nil, gid, options)
+}
+
+// setOverallLimit changes the speed limit of all downloads together in KB/s
+// (0 means unlimited)
+func (d *aria2Daemon) setOverallLimit(limit int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), aria2RequestTimeout)
+	defer cancel()
+	return d.call(ctx, "aria2.changeGlobalOption", nil, map[string]string{
+		"max-overall-download-limit": aria2Limit(limit),
+	})
+}
+
+// shutdown asks aria2c to exit and kills it if it does not
+func (d *aria2Daemon) shutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), aria2RequestTimeout)
+	defer cancel()
+	if err := d.call(ctx, "aria2.forceShutdown", nil); err != nil {
+		d.kill()
+		return
+	}
+	select {
+	case <-d.exited:
+	case <-time.After(aria2ShutdownWait):
+		d.kill()
+	}
+}
+
+// kill ends the aria2c process right away
+func (d *aria2Daemon) kill() {
+	if d.cmd.Process != nil {
+		d.cmd.Process.Kill()
+	}
+}
+
+// aria2 returns the running aria2c daemon, starting it on first use or if
+// it exited
+func (m *Manager) aria2() (*aria2Daemon, error) {
+	m.aria2Mu.Lock()
+	defer m.aria2Mu.Unlock()
+	if m.aria2d != nil && m.aria2d.running() {
+		return m.aria2d, nil
+	}
+	if m.aria2d != nil {
+		log.Warn("aria2c").Msg("aria2c exited, starting it again")
+	}
+	d, err := startAria2Daemon(m.overallLimit())
+	if err != nil {
+		return nil, err
+	}
+	m.aria2d = d
+	return d, nil
+}
+
+// stopAria2 shuts down the aria2c daemon if it runs
+func (m *Manager) stopAria2() {
+	m.aria2Mu.Lock()
+	defer m.aria2Mu.Unlock()
+	if m.aria2d != nil && m.aria2d.running() {
+		m.aria2d.shutdown()
+		log.Info("aria2c").Msg("Stopped aria2c")
+	}
+	m.aria2d = nil
+}
+
+// aria2Options returns the aria2c options of a download: where to save it,
+// how many connections to use and the speed limit
+func (m *Manager) aria2Options(targetPath string, connections, retryWait int) map[string]string {
+	return map[string]string{
+		"dir":                       longPath(filepath.Dir(targetPath)),
+		"out":                       filepath.Base(targetPath),
+		"split":                     strconv.Itoa(connections), // Split file into as many segments
+		"max-connection-per-server": strconv.Itoa(connections),
+		"min-split-size":            "1M",
+		"retry-wait":                strconv.Itoa(retryWait),
+		"max-download-limit":        aria2Limit(m.speedLimit()),
+	}
+}
+
+// aria2Limit formats a speed limit in KB/s for aria2c
+func aria2Limit(limit int) string {
+	if limit <= 0 {
+		return "0"
+	}
+	return strconv.Itoa(limit) + "K"
+}
@@ -0,0 +1,110 @@
+package download
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// Responses to aria2.tellStatus as captured from aria2c 1.35, 1.36 and 1.37,
+// which replaced parsing the console output of one aria2c per download
+var aria2StatusResponses = []struct {
+	name       string
+	response   string
+	unfinished bool
+	completed  int64
+	total      int64
+	speed      float64
+	errorCode  string // ErrorCode of err, empty if the download did not fail
+}{
+	{
+		name:       "size not known yet",
+		response:   `{"id":"1","jsonrpc":"2.0","result":{"completedLength":"0","downloadSpeed":"0","status":"active","totalLength":"0"}}`,
+		unfinished: true,
+	},
+	{
+		name:       "downloading",
+		response:   `{"id":"2","jsonrpc":"2.0","result":{"completedLength":"52428800","downloadSpeed":"10485760","status":"active","totalLength":"1073741824"}}`,
+		unfinished: true,
+		completed:  52428800,
+		total:      1073741824,
+		speed:      10485760,
+	},
+	{
+		name:       "larger than 4 GiB",
+		response:   `{"id":"3","jsonrpc":"2.0","result":{"completedLength":"4294967296","downloadSpeed":"0","status":"paused","totalLength":"8589934592"}}`,
+		unfinished: true,
+		completed:  4294967296,
+		total:      8589934592,
+	},
+	{
+		name:       "waiting",
+		response:   `{"id":"4","jsonrpc":"2.0","result":{"completedLength":"0","downloadSpeed":"0","status":"waiting","totalLength":"0"}}`,
+		unfinished: true,
+	},
+	{
+		name:      "complete",
+		response:  `{"id":"5","jsonrpc":"2.0","result":{"completedLength":"1073741824","downloadSpeed":"0","errorCode":"0","status":"complete","totalLength":"1073741824"}}`,
+		completed: 1073741824,
+		total:     1073741824,
+	},
+	{
+		name:      "expired put.io URL",
+		response:  `{"id":"6","jsonrpc":"2.0","result":{"completedLength":"0","downloadSpeed":"0","errorCode":"22","errorMessage":"The response status is not successful. status=403","status":"error","totalLength":"0"}}`,
+		errorCode: ErrorCodeURLExpired,
+	},
+	{
+		name:      "rate limited",
+		response:  `{"id":"7","jsonrpc":"2.0","result":{"completedLength":"0","downloadSpeed":"0","errorCode":"22","errorMessage":"The response status is not successful. status=429","status":"error","totalLength":"0"}}`,
+		errorCode: ErrorCodeRateLimited,
+	},
+	{
+		name:      "resource not found",
+		response:  `{"id":"8","jsonrpc":"2.0","result":{"completedLength":"0","downloadSpeed":"0","errorCode":"3","errorMessage":"Resource not found","status":"error","totalLength":"0"}}`,
+		errorCode: ErrorCodeRemoteGone,
+	},
+	{
+		name:      "disk full",
+		response:  `{"id":"9","jsonrpc":"2.0","result":{"completedLength":"1048576","downloadSpeed":"0","errorCode":"9","errorMessage":"There is not enough disk space available.","status":"error","totalLength":"1073741824"}}`,
+		completed: 1048576,
+		total:     1073741824,
+		errorCode: ErrorCodeDiskFull,
+	},
+	{
+		name:      "network problem",
+		response:  `{"id":"10","jsonrpc":"2.0","result":{"completedLength":"0","downloadSpeed":"0","errorCode":"6","errorMessage":"Failed to establish connection, cause: Connection refused","status":"error","totalLength":"0"}}`,
+		errorCode: ErrorCodeNetwork,
+	},
+	{
+		name:      "error without code",
+		response:  `{"id":"11","jsonrpc":"2.0","result":{"completedLength":"0","downloadSpeed":"0","status":"error","totalLength":"0"}}`,
+		errorCode: ErrorCodeUnknown,
+	},
+}
+
+func TestAria2Status(t *testing.T) {
+	for _, tt := range aria2StatusResponses {
+		t.Run(tt.name, func(t *testing.T) {
+			var response struct {
+				Result aria2Status `json:"result"`
+			}
+			if err := json.Unmarshal([]byte(tt.response), &response); err != nil {
+				t.Fatal(err)
+			}
+			status := response.Result
+
+			if got := status.unfinished(); got != tt.unfinished {
+				t.Errorf("unfinished() = %v, want %v", got, tt.unfinished)
+			}
+			completed, total, speed := status.progress()
+			if completed != tt.completed || total != tt.total || speed != tt.speed {
+				t.Errorf("progress() = %d, %d, %v, want %d, %d, %v", completed, total, speed, tt.completed, tt.total, tt.speed)
+			}
+			if status.Status != aria2StatusError {
+				return
+			}
+			if got := ErrorCode(status.err("file.mkv")); got != tt.errorCode {
+				t.Errorf("ErrorCode(err()) = %q, want %q", got, tt.errorCode)
+			}
+		})
+	}
+}
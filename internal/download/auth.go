@@ -0,0 +1,46 @@
+package download
+
+import (
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/api"
+	"github.com/elsbrock/plundrio/internal/events"
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// authWatcher is a provider reporting when its credentials are rejected or
+// accepted again, such as Put.io
+type authWatcher interface {
+	OnAuthChange(fn func(api.AuthState))
+}
+
+// validateTokenPeriodically checks the Put.io token now and then, so a
+// revoked token is noticed even while nothing is downloading
+func (m *Manager) validateTokenPeriodically() {
+	ticker := time.NewTicker(m.dlConfig.TokenCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stopChan:
+			return
+		case <-ticker.C:
+			if err := m.provider.Authenticate(m.ctx); err != nil {
+				log.Warn("auth").Err(err).Msg("Failed to validate Put.io token")
+			}
+		}
+	}
+}
+
+// authChanged reports when Put.io rejected the token or accepts it again
+func (m *Manager) authChanged(state api.AuthState) {
+	if state.Reauthenticate {
+		log.Error("auth").
+			Str("error", state.Error).
+			Msg("Put.io rejected the token, reauthenticate with get-token and replace it")
+		m.publish(events.Event{Type: events.SystemAuthRejected, Error: state.Error})
+		return
+	}
+	log.Info("auth").Str("username", state.Username).Msg("Put.io accepts the token again")
+	m.publish(events.Event{Type: events.SystemAuthRestored})
+}
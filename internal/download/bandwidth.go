@@ -0,0 +1,155 @@
+package download
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/config"
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// acquireConnections reserves a download slot and returns the number of aria2c
+// connections the new download may use under the configured bandwidth strategy.
+// Callers must call releaseConnections once the download has finished.
+func (m *Manager) acquireConnections() int {
+	active := int(atomic.AddInt32(&m.activeDownloads, 1))
+	budget := m.dlConfig.ConnectionBudget
+
+	switch m.Settings().BandwidthStrategy {
+	case config.BandwidthStrategyFinishFirst:
+		// The first download gets everything, later ones trickle along
+		if active == 1 {
+			return budget
+		}
+		return 1
+	default:
+		// Every worker gets an even share up front, so that all of them
+		// downloading at once stay within the budget
+		return max(budget/m.workerCount(), 1)
+	}
+}
+
+// releaseConnections frees the download slot reserved by acquireConnections
+func (m *Manager) releaseConnections() {
+	atomic.AddInt32(&m.activeDownloads, -1)
+}
+
+// workerCount returns the effective number of download workers
+func (m *Manager) workerCount() int {
+	if m.cfg.WorkerCount > 0 {
+		return m.cfg.WorkerCount
+	}
+	return m.dlConfig.DefaultWorkerCount
+}
+
+// speedLimit returns the speed limit in KB/s currently in effect (0 means unlimited)
+func (m *Manager) speedLimit() int {
+	if !m.UnthrottledUntil().IsZero() {
+		return 0
+	}
+	settings := m.Settings()
+	if settings.AltSpeedEnabled {
+		return settings.AltSpeedLimit
+	}
+	return settings.SpeedLimit
+}
+
+// overallLimit returns the speed limit of all downloads together in KB/s
+// currently in effect (0 means unlimited)
+func (m *Manager) overallLimit() int {
+	if !m.UnthrottledUntil().IsZero() {
+		return 0
+	}
+	return m.Settings().MaxDownloadRate
+}
+
+// applyOverallLimit hands the speed limit of all downloads together to the
+// native downloader and aria2c, so it applies to running downloads too
+func (m *Manager) applyOverallLimit() {
+	m.aria2Mu.Lock()
+	defer m.aria2Mu.Unlock()
+	limit := m.overallLimit()
+	m.overall.setRate(float64(limit) * 1024)
+	if m.aria2d == nil || !m.aria2d.running() {
+		return
+	}
+	if err := m.aria2d.setOverallLimit(limit); err != nil {
+		log.Warn("bandwidth").Int("limit_kbps", limit).Err(err).Msg("Failed to change the speed limit of aria2c")
+	}
+}
+
+// ParseRate parses a download rate in KB/s. A suffix of K, M or G gives the
+// rate in KiB/s, MiB/s or GiB/s like aria2c takes it, so "50M" and "51200"
+// are the same rate. An empty rate is unlimited.
+func ParseRate(value string) (int, error) {
+	number := strings.TrimSpace(value)
+	if number == "" {
+		return 0, nil
+	}
+	multiplier := 1.0
+	switch strings.ToUpper(number[len(number)-1:]) {
+	case "K":
+		number = number[:len(number)-1]
+	case "M":
+		number, multiplier = number[:len(number)-1], 1<<10
+	case "G":
+		number, multiplier = number[:len(number)-1], 1<<20
+	}
+	// !(rate >= 0) also rejects NaN
+	rate, err := strconv.ParseFloat(number, 64)
+	if err != nil || !(rate >= 0) || rate*multiplier > math.MaxInt32 {
+		return 0, fmt.Errorf("invalid rate %q (use KB/s or a number with K, M or G)", value)
+	}
+	return int(math.Round(rate * multiplier)), nil
+}
+
+// Unthrottle lifts the speed limits for the given duration. Downloads started
+// during that window run unlimited, and the limits of all downloads together
+// and of transfers are lifted for running ones too; afterwards the configured limits apply
+// again automatically. A zero duration ends an active override immediately.
+func (m *Manager) Unthrottle(d time.Duration) time.Time {
+	defer m.applyTransferLimits()
+	defer m.applyOverallLimit()
+	m.throttleMu.Lock()
+	defer m.throttleMu.Unlock()
+
+	if m.unthrottleTimer != nil {
+		m.unthrottleTimer.Stop()
+		m.unthrottleTimer = nil
+	}
+
+	if d <= 0 {
+		m.unthrottledUntil = time.Time{}
+		log.Info("bandwidth").Msg("Speed limit override cancelled")
+		return m.unthrottledUntil
+	}
+
+	m.unthrottledUntil = time.Now().Add(d)
+	m.unthrottleTimer = time.AfterFunc(d, func() {
+		m.throttleMu.Lock()
+		m.unthrottledUntil = time.Time{}
+		m.unthrottleTimer = nil
+		m.throttleMu.Unlock()
+		m.applyOverallLimit()
+		m.applyTransferLimits()
+		log.Info("bandwidth").Msg("Speed limit override expired, limit restored")
+	})
+
+	log.Info("bandwidth").
+		Dur("duration", d).
+		Time("until", m.unthrottledUntil).
+		Msg("Speed limit temporarily lifted")
+
+	return m.unthrottledUntil
+}
+
+// UnthrottledUntil returns when the current speed limit override ends (zero if none)
+func (m *Manager) UnthrottledUntil() time.Time {
+	m.throttleMu.Lock()
+	defer m.throttleMu.Unlock()
+	return m.unthrottledUntil
+}
@@ -0,0 +1,79 @@
+package download
+
+import (
+	"testing"
+
+	"github.com/elsbrock/plundrio/internal/config"
+)
+
+func TestAcquireConnections(t *testing.T) {
+	for _, tt := range []struct {
+		strategy string
+		workers  int
+		want     []int
+	}{
+		{config.BandwidthStrategyFair, 4, []int{4, 4, 4, 4}},
+		{config.BandwidthStrategyFair, 3, []int{5, 5, 5}},
+		{config.BandwidthStrategyFair, 32, []int{1, 1, 1}},
+		{config.BandwidthStrategyFinishFirst, 4, []int{16, 1, 1, 1}},
+	} {
+		t.Run(tt.strategy, func(t *testing.T) {
+			m := &Manager{
+				cfg:      &config.Config{WorkerCount: tt.workers, BandwidthStrategy: tt.strategy},
+				dlConfig: &DownloadConfig{ConnectionBudget: 16},
+			}
+			total := 0
+			for i, want := range tt.want {
+				got := m.acquireConnections()
+				if got != want {
+					t.Errorf("download %d got %d connections, want %d", i+1, got, want)
+				}
+				total += got
+			}
+			if tt.strategy == config.BandwidthStrategyFair && tt.workers <= 16 && total > 16 {
+				t.Errorf("downloads use %d connections together, more than the budget of 16", total)
+			}
+
+			// Released slots are handed out again
+			for range tt.want {
+				m.releaseConnections()
+			}
+			if got := m.acquireConnections(); got != tt.want[0] {
+				t.Errorf("after releasing got %d connections, want %d", got, tt.want[0])
+			}
+		})
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	for _, tt := range []struct {
+		value string
+		want  int
+	}{
+		{"", 0},
+		{"  ", 0},
+		{"0", 0},
+		{"51200", 51200},
+		{" 512 ", 512},
+		{"512K", 512},
+		{"512k", 512},
+		{"50M", 51200},
+		{"1.5m", 1536},
+		{"2G", 2 << 20},
+		{"0.4", 0},
+		{"0.5", 1},
+	} {
+		got, err := ParseRate(tt.value)
+		if err != nil {
+			t.Errorf("ParseRate(%q) failed: %v", tt.value, err)
+		} else if got != tt.want {
+			t.Errorf("ParseRate(%q) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+
+	for _, value := range []string{"M", "fast", "-1", "-5M", "10MB", "1e30", "4096G", "Inf", "NaN", "10 M"} {
+		if got, err := ParseRate(value); err == nil {
+			t.Errorf("ParseRate(%q) = %d, want an error", value, got)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package download
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/events"
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// processBatch downloads a batch of small files and updates the transfer state
+// for each of them. Files that did not make it are retried individually.
+func (m *Manager) processBatch(job downloadJob) {
+	// Files whose path a larger file of another transfer took over are left out
+	batch := make([]downloadJob, 0, len(job.Batch))
+	for _, file := range job.Batch {
+		if !m.ownsPath(file) {
+			m.publish(m.fileEvent(events.FileSkipped, file, NewPathCollisionError(file.Name)))
+			m.handleFileSkipped(file)
+			continue
+		}
+		batch = append(batch, file)
+	}
+	if len(batch) == 0 {
+		return
+	}
+	job.Batch = batch
+
+	// Only aria2c downloads batches at once, the native downloader takes
+	// the files one after the other
+	if m.httpClient != nil {
+		for _, file := range job.Batch {
+			m.processJob(file)
+		}
+		return
+	}
+
+	failed, err := m.downloadBatch(job)
+	if err != nil {
+		if downloadErr, ok := err.(*DownloadError); ok && downloadErr.Type == "DownloadCancelled" {
+			// Interrupted by a pause, pick it up again on resume (or drop it if cancelled)
+			if !m.stopping() && m.holdIfPaused(job) {
+				log.Info("download").
+					Int64("transfer_id", job.TransferID).
+					Int("files", len(job.Batch)).
+					Msg("Batch download stopped")
+				return
+			}
+			log.Info("download").
+				Int64("transfer_id", job.TransferID).
+				Int("files", len(job.Batch)).
+				Msg("Batch download cancelled due to shutdown")
+			for _, file := range job.Batch {
+				m.activeFiles.Delete(file.FileID)
+			}
+			return
+		}
+		log.Warn("download").
+			Int64("transfer_id", job.TransferID).
+			Int("files", len(job.Batch)).
+			Err(err).
+			Msg("Batch download failed, falling back to individual downloads")
+	}
+
+	for _, file := range job.Batch {
+		if _, retry := failed[file.FileID]; retry {
+			m.processJob(file)
+			continue
+		}
+		m.publish(m.fileEvent(events.FileCompleted, file, nil))
+		m.handleFileCompletion(file.TransferID, file.FileID)
+	}
+}
+
+// downloadBatch downloads all files of a batch with aria2c, several at once
+// over a connection each, which is faster for small files than splitting them.
+// It returns the set of files that were not downloaded completely.
+func (m *Manager) downloadBatch(job downloadJob) (map[int64]struct{}, error) {
+	ctx, cancel := m.newStopContext(job.TransferID)
+	defer cancel()
+
+	startTime := time.Now()
+	failed := make(map[int64]struct{})
+
+	// Look up the URLs and create the directories of all files first
+	targetDirs := make(map[int64]string)
+	fileURLs := make(map[int64]string)
+	var urls []string
+	for _, file := range job.Batch {
+		url, err := m.provider.GetDownloadURL(ctx, file.FileID)
+		if err != nil {
+			log.Warn("download").
+				Str("file_name", file.Name).
+				Int64("transfer_id", file.TransferID).
+				Err(err).
+				Msg("Failed to get download URL for batched file")
+			failed[file.FileID] = struct{}{}
+			continue
+		}
+
+		targetDirs[file.FileID] = m.TargetDir(file.TransferID)
+		writePath := m.incompletePath(filepath.Join(targetDirs[file.FileID], file.Name))
+		if err := os.MkdirAll(longPath(filepath.Dir(writePath)), 0755); err != nil {
+			failed[file.FileID] = struct{}{}
+			continue
+		}
+
+		urls = append(urls, url)
+		fileURLs[file.FileID] = url
+	}
+
+	if len(failed) == len(job.Batch) {
+		return failed, fmt.Errorf("no files in batch could be prepared")
+	}
+
+	// Batches take a single slot in the download queue and count as one writer
+	// on the volume their files are written to
+	releaseSlot, err := m.acquireQueueSlot(ctx, job.TransferID)
+	if err != nil {
+		return nil, NewDownloadCancelledError(fmt.Sprintf("batch of %d files", len(job.Batch)), "download stopped")
+	}
+	defer releaseSlot()
+	releaseVolume, err := m.acquireVolume(ctx, filepath.Dir(m.incompletePath(m.jobPath(job.Batch[0]))))
+	if err != nil {
+		return nil, NewDownloadCancelledError(fmt.Sprintf("batch of %d files", len(job.Batch)), "download stopped")
+	}
+	defer releaseVolume()
+
+	// Small files are not worth splitting, so use the connections to fetch
+	// several files in parallel instead
+	connections := m.acquireConnections()
+	defer m.releaseConnections()
+	connections, releaseHosts, err := m.acquireHostConnections(ctx, serversOf(urls), connections)
+	if err != nil {
+		return nil, NewDownloadCancelledError(fmt.Sprintf("batch of %d files", len(job.Batch)), "download stopped")
+	}
+	defer releaseHosts()
+
+	d, err := m.aria2()
+	if err != nil {
+		for _, file := range job.Batch {
+			failed[file.FileID] = struct{}{}
+		}
+		return failed, err
+	}
+
+	log.Info("download").
+		Int64("transfer_id", job.TransferID).
+		Int("files", len(job.Batch)-len(failed)).
+		Int("connections", connections).
+		Msg("Starting batch download with aria2c")
+
+	// Each file is fetched over a single connection, as many files at once
+	// as there are connections
+	var pending []downloadJob
+	for _, file := range job.Batch {
+		if _, ok := failed[file.FileID]; !ok {
+			pending = append(pending, file)
+		}
+	}
+	_, leave := m.joinTransferLimit(job.TransferID)
+	defer leave()
+	active := make(map[string]downloadJob) // by GID
+	ticker := time.NewTicker(aria2PollInterval)
+	defer ticker.Stop()
+	for len(pending) > 0 || len(active) > 0 {
+		for len(active) < connections && len(pending) > 0 {
+			file := pending[0]
+			pending = pending[1:]
+			writePath := m.incompletePath(filepath.Join(targetDirs[file.FileID], file.Name))
+			gid, err := d.addURI(ctx, fileURLs[file.FileID], m.aria2Options(writePath, 1, defaultRetryWait))
+			if err != nil {
+				failed[file.FileID] = struct{}{}
+				continue
+			}
+			active[gid] = file
+			m.addAria2Download(d, job.TransferID, gid)
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+		}
+		if ctx.Err() != nil {
+			for gid := range active {
+				d.remove(gid)
+				m.removeAria2Download(d, job.TransferID, gid)
+			}
+			return nil, NewDownloadCancelledError(fmt.Sprintf("batch of %d files", len(job.Batch)), "download stopped")
+		}
+
+		for gid, file := range active {
+			status, err := d.status(ctx, gid)
+			if err != nil {
+				failed[file.FileID] = struct{}{}
+				delete(active, gid)
+				m.removeAria2Download(d, job.TransferID, gid)
+				continue
+			}
+			switch status.Status {
+			case aria2StatusComplete:
+			case aria2StatusError, aria2StatusRemoved:
+				log.TransferOutput(file.TransferID, "aria2c", file.Name, status.ErrorMessage)
+				log.Debug("download").
+					Str("file_name", file.Name).
+					Int64("transfer_id", file.TransferID).
+					Str("status", status.Status).
+					Str("aria2c_output", status.ErrorMessage).
+					Msg("aria2c did not complete batched file")
+				failed[file.FileID] = struct{}{}
+			default:
+				continue
+			}
+			d.forget(gid)
+			delete(active, gid)
+			m.removeAria2Download(d, job.TransferID, gid)
+		}
+	}
+
+	// aria2c reported the outcome of each file; check that the completed ones
+	// have their full size on disk before moving them into place
+	var totalSize int64
+	for _, file := range job.Batch {
+		if _, ok := failed[file.FileID]; ok {
+			continue
+		}
+		targetPath := filepath.Join(targetDirs[file.FileID], file.Name)
+		writePath := m.incompletePath(targetPath)
+		if finalPath := filepath.Join(m.TargetDir(file.TransferID), file.Name); finalPath != targetPath {
+			if writePath == targetPath {
+				if err := m.relocateFinished(targetPath, finalPath); err != nil {
+					failed[file.FileID] = struct{}{}
+					continue
+				}
+				writePath = finalPath
+			}
+			targetPath = finalPath
+		}
+		info, err := os.Stat(longPath(writePath))
+		if err != nil || info.Size() != file.Size {
+			failed[file.FileID] = struct{}{}
+			continue
+		}
+		if _, err := os.Stat(longPath(writePath + ".aria2")); err == nil {
+			failed[file.FileID] = struct{}{}
+			continue
+		}
+		if err := m.finishIncomplete(writePath, targetPath); err != nil {
+			failed[file.FileID] = struct{}{}
+			continue
+		}
+		totalSize += info.Size()
+	}
+
+	// Update transfer context with the completed file sizes
+	if transferCtx, exists := m.coordinator.GetTransferContext(job.TransferID); exists {
+		transferCtx.DownloadedSize += totalSize
+	}
+
+	log.Info("download").
+		Int64("transfer_id", job.TransferID).
+		Int("completed", len(job.Batch)-len(failed)).
+		Int("failed", len(failed)).
+		Float64("size_mb", float64(totalSize)/1024/1024).
+		Dur("duration", time.Since(startTime)).
+		Msg("Batch download completed with aria2c")
+
+	return failed, nil
+}
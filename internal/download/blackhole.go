@@ -0,0 +1,204 @@
+package download
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/config"
+	"github.com/elsbrock/plundrio/internal/log"
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	// blackholeSettle is how long a file in the watch directory must stay
+	// unchanged before it is added, so that files still being copied, e.g. onto
+	// an SMB share, are not read half-written
+	blackholeSettle = 2 * time.Second
+
+	blackholeAdded  = "added"  // subdirectory added files are moved to
+	blackholeFailed = "failed" // subdirectory files that could not be added are moved to
+)
+
+// blackholeStamp is what a file in the watch directory looked like when it
+// was last listed
+type blackholeStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// watchBlackhole adds the .torrent and .magnet files dropped into the watch
+// directory as transfers. New files are noticed through the notifications of
+// the operating system (inotify, kqueue, ReadDirectoryChangesW); directories
+// on network shares, which do not report changes made by other machines, and
+// systems without notifications are listed every watch-poll-interval instead.
+func (m *Manager) watchBlackhole() {
+	dir := m.cfg.WatchDir
+	if err := os.MkdirAll(longPath(dir), 0755); err != nil {
+		log.Error("blackhole").Str("dir", dir).Err(err).Msg("Failed to create watch directory")
+		return
+	}
+
+	var watcher *fsnotify.Watcher
+	switch {
+	case m.cfg.WatchMode == config.WatchModePoll:
+	case m.cfg.WatchMode == config.WatchModeAuto && networkShare(dir):
+		log.Info("blackhole").Str("dir", dir).Msg("Watch directory is on a network share, polling it")
+	default:
+		var err error
+		if watcher, err = fsnotify.NewWatcher(); err == nil {
+			if err = watcher.Add(dir); err != nil {
+				watcher.Close()
+				watcher = nil
+			}
+		}
+		if err != nil {
+			log.Warn("blackhole").Str("dir", dir).Err(err).Msg("Notifications are not available, polling watch directory")
+		}
+	}
+
+	var events <-chan fsnotify.Event
+	var errs <-chan error
+	var poll <-chan time.Time
+	if watcher != nil {
+		defer watcher.Close()
+		events, errs = watcher.Events, watcher.Errors
+	} else {
+		ticker := time.NewTicker(m.cfg.WatchPollInterval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+	log.Info("blackhole").
+		Str("dir", dir).
+		Bool("notify", watcher != nil).
+		Dur("poll_interval", m.cfg.WatchPollInterval).
+		Msg("Watching directory for torrent and magnet files")
+
+	seen := make(map[string]blackholeStamp)
+	// Files dropped while plundrio was not running are picked up right away
+	scan := time.NewTimer(0)
+	defer scan.Stop()
+	for {
+		select {
+		case <-m.stopChan:
+			return
+
+		case <-poll:
+			m.scanBlackhole(seen)
+
+		case event, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			if blackholeFile(event.Name) {
+				scan.Reset(blackholeSettle)
+			}
+
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			// Events may have been lost, e.g. when the buffer of
+			// ReadDirectoryChangesW overflowed
+			log.Warn("blackhole").Err(err).Msg("Watch directory notification failed, listing it")
+			scan.Reset(blackholeSettle)
+
+		case <-scan.C:
+			if m.scanBlackhole(seen) {
+				scan.Reset(blackholeSettle)
+			}
+		}
+	}
+}
+
+// blackholeFile reports whether a file in the watch directory is added
+func blackholeFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".torrent", ".magnet":
+		return true
+	}
+	return false
+}
+
+// scanBlackhole adds the files in the watch directory that did not change
+// since it was last listed, and reports whether files are still changing
+func (m *Manager) scanBlackhole(seen map[string]blackholeStamp) bool {
+	dir := m.cfg.WatchDir
+	entries, err := os.ReadDir(longPath(dir))
+	if err != nil {
+		log.Warn("blackhole").Str("dir", dir).Err(err).Msg("Failed to list watch directory")
+		return false
+	}
+
+	changing := false
+	listed := make(map[string]struct{}, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || !blackholeFile(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		name := entry.Name()
+		listed[name] = struct{}{}
+		stamp := blackholeStamp{size: info.Size(), modTime: info.ModTime()}
+		if last, ok := seen[name]; !ok || last != stamp || time.Since(stamp.modTime) < blackholeSettle {
+			seen[name] = stamp
+			changing = true
+			continue
+		}
+		delete(seen, name)
+		m.addBlackholeFile(filepath.Join(dir, name))
+	}
+	for name := range seen {
+		if _, ok := listed[name]; !ok {
+			delete(seen, name)
+		}
+	}
+	return changing
+}
+
+// addBlackholeFile adds a file from the watch directory as a transfer and
+// moves it to the added subdirectory, or to the failed one if it could not be
+// added. Moving the files out also keeps kqueue on macOS and BSD from holding
+// one of them open per file ever dropped.
+func (m *Manager) addBlackholeFile(path string) {
+	name := filepath.Base(path)
+	data, err := os.ReadFile(longPath(path))
+	if err == nil {
+		if strings.EqualFold(filepath.Ext(name), ".magnet") {
+			link := strings.TrimSpace(string(data))
+			if link == "" {
+				err = errors.New("magnet file is empty")
+			} else {
+				err = m.AddTransfer(link, "", Annotation{})
+			}
+		} else {
+			err = m.AddTorrent(data, name, "", Annotation{})
+		}
+	}
+
+	sub := blackholeAdded
+	if err != nil {
+		sub = blackholeFailed
+		log.Error("blackhole").Str("file", path).Err(err).Msg("Failed to add file from watch directory")
+	} else {
+		log.Info("blackhole").Str("file", path).Msg("Added file from watch directory")
+	}
+
+	dst := filepath.Join(filepath.Dir(path), sub, name)
+	moveErr := os.MkdirAll(longPath(filepath.Dir(dst)), 0755)
+	if moveErr == nil {
+		moveErr = os.Rename(longPath(path), longPath(dst))
+	}
+	if moveErr != nil {
+		// Left in place it would be added again
+		log.Warn("blackhole").Str("file", path).Err(moveErr).Msg("Failed to move file out of watch directory, deleting it")
+		os.Remove(longPath(path))
+	}
+}
@@ -0,0 +1,160 @@
+package download
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/elsbrock/plundrio/internal/config"
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// pathClaim records which file of which transfer owns a local path
+type pathClaim struct {
+	TransferID int64
+	FileID     int64
+	Size       int64
+}
+
+// pathLock serializes the downloads to a local path
+type pathLock struct {
+	mu   sync.Mutex
+	refs int // holders and waiters, the lock is dropped at 0
+}
+
+// jobPath returns the local path a job downloads to
+func (m *Manager) jobPath(job downloadJob) string {
+	return filepath.Join(m.TargetDir(job.TransferID), job.Name)
+}
+
+// claimPath claims the local path of a job for its file. If a file of another
+// transfer already claimed it, the collision policy decides: the job is
+// renamed with a suffix, left out, or takes over the path if it is larger.
+// It returns false if the job must be left out.
+func (m *Manager) claimPath(job *downloadJob) bool {
+	m.claimsMu.Lock()
+	defer m.claimsMu.Unlock()
+
+	path := m.jobPath(*job)
+	claim := pathClaim{TransferID: job.TransferID, FileID: job.FileID, Size: job.Size}
+	owner, claimed := m.claims[path]
+	if !claimed || owner.TransferID == job.TransferID || !m.claimActive(owner) {
+		m.claims[path] = claim
+		return true
+	}
+
+	logger := log.Warn("download").
+		Str("file_name", job.Name).
+		Int64("transfer_id", job.TransferID).
+		Int64("owner_transfer_id", owner.TransferID).
+		Str("policy", m.cfg.CollisionPolicy)
+
+	switch m.cfg.CollisionPolicy {
+	case config.CollisionPolicySkip:
+		logger.Msg("Another transfer downloads to the same path, skipping file")
+		return false
+
+	case config.CollisionPolicyOverwriteIfLarger:
+		if job.Size <= owner.Size {
+			logger.Msg("Another transfer downloads a file at least as large to the same path, skipping file")
+			return false
+		}
+		m.claims[path] = claim
+		m.supersede(owner)
+		logger.Msg("Another transfer downloads a smaller file to the same path, replacing it")
+		return true
+
+	default:
+		for i := 2; ; i++ {
+			name := suffixedName(job.Name, i)
+			suffixed := filepath.Join(filepath.Dir(path), filepath.Base(name))
+			if _, taken := m.claims[suffixed]; !taken {
+				logger.Str("new_name", name).Msg("Another transfer downloads to the same path, renaming file")
+				job.Name = name
+				m.claims[suffixed] = claim
+				return true
+			}
+		}
+	}
+}
+
+// claimActive reports whether the transfer owning a claim still uses it.
+// m.claimsMu must be held.
+func (m *Manager) claimActive(owner pathClaim) bool {
+	ctx, ok := m.coordinator.GetTransferContext(owner.TransferID)
+	if !ok {
+		return false
+	}
+	ctx.Mu.RLock()
+	defer ctx.Mu.RUnlock()
+	return ctx.State != TransferLifecycleCancelled
+}
+
+// supersede stops verifying a file whose path was taken over by a larger file
+// of another transfer. A download of the file that did not start yet is
+// skipped when it comes up, see ownsPath.
+func (m *Manager) supersede(owner pathClaim) {
+	ctx, ok := m.coordinator.GetTransferContext(owner.TransferID)
+	if !ok {
+		return
+	}
+	ctx.Mu.Lock()
+	defer ctx.Mu.Unlock()
+	for i, file := range ctx.wanted {
+		if file.FileID == owner.FileID {
+			ctx.wanted = append(ctx.wanted[:i], ctx.wanted[i+1:]...)
+			return
+		}
+	}
+}
+
+// ownsPath reports whether a job may still download to its local path, which
+// is not the case once a larger file of another transfer took it over
+func (m *Manager) ownsPath(job downloadJob) bool {
+	m.claimsMu.Lock()
+	defer m.claimsMu.Unlock()
+	owner, claimed := m.claims[m.jobPath(job)]
+	return !claimed || owner.FileID == job.FileID
+}
+
+// releaseClaims forgets the paths claimed by the files of a transfer
+func (m *Manager) releaseClaims(transferID int64) {
+	m.claimsMu.Lock()
+	defer m.claimsMu.Unlock()
+	for path, owner := range m.claims {
+		if owner.TransferID == transferID {
+			delete(m.claims, path)
+		}
+	}
+}
+
+// lockPath waits until no other download writes to path and returns a
+// function to release it again
+func (m *Manager) lockPath(path string) func() {
+	m.claimsMu.Lock()
+	lock, ok := m.pathLocks[path]
+	if !ok {
+		lock = &pathLock{}
+		m.pathLocks[path] = lock
+	}
+	lock.refs++
+	m.claimsMu.Unlock()
+
+	lock.mu.Lock()
+	return func() {
+		lock.mu.Unlock()
+		m.claimsMu.Lock()
+		if lock.refs--; lock.refs == 0 {
+			delete(m.pathLocks, path)
+		}
+		m.claimsMu.Unlock()
+	}
+}
+
+// suffixedName inserts a counter before the extension of a file name, e.g.
+// "Show/episode.mkv" becomes "Show/episode (2).mkv"
+func suffixedName(name string, n int) string {
+	ext := filepath.Ext(name)
+	return fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), n, ext)
+}
@@ -0,0 +1,212 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/log"
+	"github.com/elsbrock/plundrio/internal/provider"
+	"github.com/elsbrock/plundrio/internal/state"
+)
+
+// CompletionsState is the name of the state document journaling the
+// completions of transfers whose source files are being deleted
+const CompletionsState = "completions"
+
+// completionTimeout bounds the steps of a completion, which shutting down
+// does not interrupt
+const completionTimeout = 2 * time.Minute
+
+// Completion is a journaled completion: the source files of a transfer are
+// deleted from its provider once its files were verified locally
+type Completion struct {
+	TransferID int64            `json:"transfer_id"`
+	Name       string           `json:"name"`
+	Provider   string           `json:"provider"`
+	FileID     int64            `json:"file_id"` // file or folder deleted from the provider
+	Dir        string           `json:"dir"`     // where the files were downloaded to
+	Files      []CompletionFile `json:"files"`
+	StartedAt  time.Time        `json:"started_at"`
+}
+
+// CompletionFile is a downloaded file of a journaled completion
+type CompletionFile struct {
+	Name string `json:"name"` // path relative to Dir
+	Size int64  `json:"size"`
+}
+
+// Completions lists the journaled completions by transfer ID
+type Completions struct {
+	Transfers map[int64]Completion `json:"transfers"`
+}
+
+// completionJournal records completions before their source files are
+// deleted and forgets them afterwards. Completions still in the journal on
+// start were interrupted, e.g. by a crash, and are replayed.
+type completionJournal struct {
+	mu      sync.Mutex
+	store   *state.Store // nil without a state directory
+	entries map[int64]Completion
+}
+
+// newCompletionJournal loads the completions earlier runs did not finish
+// from the state directory
+func newCompletionJournal(stateDir string) *completionJournal {
+	j := &completionJournal{entries: make(map[int64]Completion)}
+	if stateDir == "" {
+		return j
+	}
+
+	store, err := state.New(stateDir)
+	if err != nil {
+		log.Warn("cleanup").Err(err).Msg("Completions will not be journaled")
+		return j
+	}
+	j.store = store
+
+	var completions Completions
+	if err := store.Load(CompletionsState, &completions); err != nil {
+		log.Warn("cleanup").Err(err).Msg("Failed to load journaled completions")
+		return j
+	}
+	if completions.Transfers != nil {
+		j.entries = completions.Transfers
+	}
+	return j
+}
+
+// save writes the journal. The caller must hold mu.
+func (j *completionJournal) save() {
+	if j.store == nil {
+		return
+	}
+	if err := j.store.Save(CompletionsState, Completions{Transfers: j.entries}); err != nil {
+		log.Warn("cleanup").Err(err).Msg("Failed to save journaled completions")
+	}
+}
+
+// begin records a completion before its source files are deleted
+func (j *completionJournal) begin(c Completion) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.entries[c.TransferID] = c
+	j.save()
+}
+
+// finish forgets a completion once it is done
+func (j *completionJournal) finish(transferID int64) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, ok := j.entries[transferID]; !ok {
+		return
+	}
+	delete(j.entries, transferID)
+	j.save()
+}
+
+// pending returns the completions that were not finished
+func (j *completionJournal) pending() []Completion {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	completions := make([]Completion, 0, len(j.entries))
+	for _, c := range j.entries {
+		completions = append(completions, c)
+	}
+	return completions
+}
+
+// completionContext returns the context the steps of a completion run with.
+// Shutting down does not cancel it, so source files are never left half
+// deleted, but the steps give up after completionTimeout.
+func (m *Manager) completionContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(m.ctx), completionTimeout)
+}
+
+// deleteSourceFile journals the completion of a transfer and deletes its
+// source files from the provider. The caller must hold ctx.Mu.
+func (m *Manager) deleteSourceFile(ctx *TransferContext) error {
+	p := provider.Of(m.provider, ctx.FileID)
+	completion := Completion{
+		TransferID: ctx.ID,
+		Name:       ctx.Name,
+		Provider:   p.Name(),
+		FileID:     ctx.FileID,
+		Dir:        m.TargetDir(ctx.ID),
+		StartedAt:  time.Now(),
+	}
+	for _, file := range ctx.wanted {
+		completion.Files = append(completion.Files, CompletionFile{Name: file.Name, Size: file.Size})
+	}
+	m.completions.begin(completion)
+
+	deleteCtx, cancel := m.completionContext()
+	defer cancel()
+	if err := m.deleteRemoteFile(deleteCtx, p, ctx.FileID); err != nil {
+		// Left in the journal, the deletion is tried again on the next start
+		return err
+	}
+	m.completions.finish(ctx.ID)
+	return nil
+}
+
+// replayCompletions finishes the completions an earlier run was interrupted
+// in. Source files are only deleted if the downloaded files are still all
+// there; otherwise the transfer is downloaded again once it is checked.
+func (m *Manager) replayCompletions() {
+	for _, completion := range m.completions.pending() {
+		files := make([]wantedFile, 0, len(completion.Files))
+		for _, file := range completion.Files {
+			files = append(files, wantedFile{Name: file.Name, Size: file.Size})
+		}
+		if missing := missingFiles(completion.Dir, files); len(missing) > 0 {
+			log.Warn("cleanup").
+				Int64("transfer_id", completion.TransferID).
+				Str("name", completion.Name).
+				Int("missing_files", len(missing)).
+				Msg("Not finishing interrupted completion, downloaded files are missing")
+			m.completions.finish(completion.TransferID)
+			continue
+		}
+
+		var p provider.Provider
+		for _, member := range provider.All(m.provider) {
+			if member.Name() == completion.Provider {
+				p = member
+			}
+		}
+		if p == nil {
+			log.Warn("cleanup").
+				Int64("transfer_id", completion.TransferID).
+				Str("provider", completion.Provider).
+				Msg("Not finishing interrupted completion, provider is no longer configured")
+			m.completions.finish(completion.TransferID)
+			continue
+		}
+
+		ctx, cancel := m.completionContext()
+		err := m.deleteRemoteFile(ctx, p, completion.FileID)
+		if err != nil && !errors.Is(err, provider.ErrFileNotFound) {
+			// The file may have been deleted right before the interruption,
+			// and not every provider reports deleting it again as not found
+			if _, getErr := p.GetFile(ctx, completion.FileID); errors.Is(getErr, provider.ErrFileNotFound) {
+				err = nil
+			}
+		}
+		cancel()
+		if err != nil && !errors.Is(err, provider.ErrFileNotFound) {
+			log.Error("cleanup").
+				Int64("transfer_id", completion.TransferID).
+				Int64("file_id", completion.FileID).
+				Err(err).
+				Msg("Failed to finish interrupted completion")
+			continue
+		}
+		m.completions.finish(completion.TransferID)
+		log.Info("cleanup").
+			Int64("transfer_id", completion.TransferID).
+			Str("name", completion.Name).
+			Msg("Finished interrupted completion")
+	}
+}
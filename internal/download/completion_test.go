@@ -0,0 +1,160 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/elsbrock/go-putio"
+	"github.com/elsbrock/plundrio/internal/config"
+	"github.com/elsbrock/plundrio/internal/provider"
+)
+
+// journalProvider is a named provider that deletes files like
+// deletingProvider and reports them gone once gone is set
+type journalProvider struct {
+	deletingProvider
+	gone bool
+}
+
+func (p *journalProvider) Name() string {
+	return "putio"
+}
+
+func (p *journalProvider) GetFile(ctx context.Context, fileID int64) (*putio.File, error) {
+	if p.gone {
+		return nil, fmt.Errorf("file %d: %w", fileID, provider.ErrFileNotFound)
+	}
+	return &putio.File{ID: fileID}, nil
+}
+
+// completionManager returns a manager journaling completions in stateDir
+// that downloads to dir
+func completionManager(stateDir, dir string, p provider.Provider) *Manager {
+	return &Manager{
+		cfg:         &config.Config{},
+		provider:    p,
+		ctx:         context.Background(),
+		targetDir:   dir,
+		targetDirs:  newTargetDirOverrides(""),
+		completions: newCompletionJournal(stateDir),
+	}
+}
+
+func TestCompletionJournal(t *testing.T) {
+	stateDir := t.TempDir()
+	j := newCompletionJournal(stateDir)
+	j.begin(Completion{TransferID: 1, Name: "one"})
+	j.begin(Completion{TransferID: 2, Name: "two", Files: []CompletionFile{{Name: "two/a.mkv", Size: 5}}})
+	j.finish(1)
+	j.finish(3)
+
+	want := []Completion{{TransferID: 2, Name: "two", Files: []CompletionFile{{Name: "two/a.mkv", Size: 5}}}}
+	if got := newCompletionJournal(stateDir).pending(); !reflect.DeepEqual(got, want) {
+		t.Errorf("pending after loading = %+v, want %+v", got, want)
+	}
+
+	// Without a state directory completions are only kept in memory
+	j = newCompletionJournal("")
+	j.begin(Completion{TransferID: 1})
+	if got := j.pending(); len(got) != 1 {
+		t.Errorf("pending = %+v, want the completion", got)
+	}
+}
+
+func TestDeleteSourceFile(t *testing.T) {
+	stateDir := t.TempDir()
+	p := &journalProvider{deletingProvider: deletingProvider{err: errors.New("put.io is down")}}
+	m := completionManager(stateDir, "/downloads", p)
+	ctx := &TransferContext{ID: 1, Name: "Show", FileID: 10, wanted: []wantedFile{{FileID: 11, Name: "Show/e01.mkv", Size: 100}}}
+
+	// A failed deletion is left in the journal for the next start
+	if err := m.deleteSourceFile(ctx); err == nil {
+		t.Fatal("deleteSourceFile succeeded while the provider fails")
+	}
+	pending := newCompletionJournal(stateDir).pending()
+	if len(pending) != 1 {
+		t.Fatalf("journaled %d completions, want 1", len(pending))
+	}
+	if c := pending[0]; c.TransferID != 1 || c.Provider != "putio" || c.FileID != 10 || c.Dir != "/downloads" ||
+		!reflect.DeepEqual(c.Files, []CompletionFile{{Name: "Show/e01.mkv", Size: 100}}) || c.StartedAt.IsZero() {
+		t.Errorf("completion = %+v", c)
+	}
+
+	p.err = nil
+	if err := m.deleteSourceFile(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(p.deleted, []int64{10}) {
+		t.Errorf("deleted = %v, want [10]", p.deleted)
+	}
+	if pending := newCompletionJournal(stateDir).pending(); len(pending) != 0 {
+		t.Errorf("journal = %+v, want it empty", pending)
+	}
+}
+
+func TestReplayCompletions(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		provider string
+		files    []string // written to the target directory
+		err      error    // of deleting the source file
+		gone     bool     // the source file is no longer there
+		deleted  bool
+		finished bool
+	}{
+		{name: "deleted", provider: "putio", files: []string{"Show/e01.mkv"}, deleted: true, finished: true},
+		{name: "files missing", provider: "putio", finished: true},
+		{name: "provider removed", provider: "other", files: []string{"Show/e01.mkv"}, finished: true},
+		{name: "already deleted", provider: "putio", files: []string{"Show/e01.mkv"}, err: provider.ErrFileNotFound, finished: true},
+		{name: "deleted before", provider: "putio", files: []string{"Show/e01.mkv"}, err: errors.New("forbidden"), gone: true, finished: true},
+		{name: "still failing", provider: "putio", files: []string{"Show/e01.mkv"}, err: errors.New("put.io is down")},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			stateDir, dir := t.TempDir(), t.TempDir()
+			writeFiles(t, dir, tt.files...)
+			p := &journalProvider{deletingProvider: deletingProvider{err: tt.err}, gone: tt.gone}
+			m := completionManager(stateDir, dir, p)
+			m.completions.begin(Completion{
+				TransferID: 1,
+				Name:       "Show",
+				Provider:   tt.provider,
+				FileID:     10,
+				Dir:        dir,
+				Files:      []CompletionFile{{Name: "Show/e01.mkv", Size: int64(len("Show/e01.mkv"))}},
+			})
+
+			m.replayCompletions()
+			if deleted := len(p.deleted) > 0; deleted != tt.deleted {
+				t.Errorf("deleted = %v, want %v", p.deleted, tt.deleted)
+			}
+			pending := newCompletionJournal(stateDir).pending()
+			if finished := len(pending) == 0; finished != tt.finished {
+				t.Errorf("journal = %+v, want finished %v", pending, tt.finished)
+			}
+		})
+	}
+}
+
+func TestReplayCompletionsPartialFile(t *testing.T) {
+	stateDir, dir := t.TempDir(), t.TempDir()
+	writeFiles(t, dir, "Show/e01.mkv", "Show/e01.mkv.aria2")
+	p := &journalProvider{}
+	m := completionManager(stateDir, filepath.Dir(dir), p)
+	m.completions.begin(Completion{
+		TransferID: 1,
+		Provider:   "putio",
+		FileID:     10,
+		Dir:        dir,
+		Files:      []CompletionFile{{Name: "Show/e01.mkv", Size: int64(len("Show/e01.mkv"))}},
+	})
+
+	// An unfinished download does not count as downloaded
+	m.replayCompletions()
+	if len(p.deleted) != 0 {
+		t.Errorf("deleted = %v, want nothing", p.deleted)
+	}
+}
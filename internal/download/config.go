@@ -1,6 +1,10 @@
 package download
 
-import "time"
+import (
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/config"
+)
 
 // DownloadConfig contains configuration options for the download manager
 type DownloadConfig struct {
@@ -27,18 +31,118 @@ type DownloadConfig struct {
 
 	// CopyTimeout is the timeout for waiting for the copy operation to complete after cancellation
 	CopyTimeout time.Duration
+
+	// ConnectionBudget is the total number of aria2c connections shared between active downloads
+	ConnectionBudget int
+
+	// SmallFileThreshold is the size below which files are grouped into batches (0 disables batching)
+	SmallFileThreshold int64
+
+	// SmallFileBatchSize is the maximum number of small files downloaded together in one batch
+	SmallFileBatchSize int
+
+	// RetentionCheckInterval is how often local downloads are checked against the retention policy
+	RetentionCheckInterval time.Duration
+
+	// ImportCheckInterval is how often completed downloads are checked for *arr imports
+	ImportCheckInterval time.Duration
+
+	// HistorySize is how many transfer events are kept in memory for the history
+	HistorySize int
+
+	// SlowSpeedCheckInterval is how often download speeds are compared against the slow threshold
+	SlowSpeedCheckInterval time.Duration
+
+	// MaintenanceCheckInterval is how often maintenance windows are checked for their start or end
+	MaintenanceCheckInterval time.Duration
+
+	// WindowCheckInterval is how often download windows are checked for their start or end
+	WindowCheckInterval time.Duration
+
+	// TuningSaveInterval is how often learned connection counts and retry waits are saved
+	TuningSaveInterval time.Duration
+
+	// ThroughputSaveInterval is how often the download speed history is saved
+	ThroughputSaveInterval time.Duration
+
+	// QueueSaveInterval is how often the progress of the files being
+	// downloaded is saved; queued, completed and failed files are saved as it
+	// happens
+	QueueSaveInterval time.Duration
+
+	// SpaceCheckInterval is how often downloads waiting for disk space check for it
+	SpaceCheckInterval time.Duration
+
+	// LoadCheckInterval is how often the system load is checked with max-load,
+	// max-memory-percent or max-disk-latency
+	LoadCheckInterval time.Duration
+
+	// TokenCheckInterval is how often the Put.io token is checked for revocation
+	TokenCheckInterval time.Duration
+
+	// ReconcileInterval is how often local transfer state is compared with the provider
+	ReconcileInterval time.Duration
 }
 
 // GetDefaultConfig returns a DownloadConfig with reasonable default values
 func GetDefaultConfig() *DownloadConfig {
 	return &DownloadConfig{
-		DefaultWorkerCount:     3,                // 3 concurrent downloads by default
-		BufferMultiple:         5,                // Buffer size = 5 * worker count
-		ProgressUpdateInterval: 5 * time.Second,  // Log progress every 5 seconds
-		TransferCheckInterval:  30 * time.Second, // Check for new transfers every 30 seconds
-		IdleConnectionTimeout:  90 * time.Second, // Keep idle connections for 90 seconds
-		DownloadHeaderTimeout:  30 * time.Second, // 30 second timeout for response headers
-		DownloadStallTimeout:   2 * time.Minute,  // Cancel download if stalled for 2 minutes
-		CopyTimeout:            10 * time.Second, // Wait 10 seconds for copy to complete after cancellation
+		DefaultWorkerCount:       3,                // 3 concurrent downloads by default
+		BufferMultiple:           5,                // Buffer size = 5 * worker count
+		ProgressUpdateInterval:   5 * time.Second,  // Log progress every 5 seconds
+		TransferCheckInterval:    30 * time.Second, // Check for new transfers every 30 seconds
+		IdleConnectionTimeout:    90 * time.Second, // Keep idle connections for 90 seconds
+		DownloadHeaderTimeout:    30 * time.Second, // 30 second timeout for response headers
+		DownloadStallTimeout:     2 * time.Minute,  // Cancel download if stalled for 2 minutes
+		CopyTimeout:              10 * time.Second, // Wait 10 seconds for copy to complete after cancellation
+		ConnectionBudget:         16,               // 16 connections shared across all downloads
+		SmallFileThreshold:       8 * 1024 * 1024,  // Batch files smaller than 8MB
+		SmallFileBatchSize:       25,               // Up to 25 small files per batch
+		RetentionCheckInterval:   time.Hour,        // Check retention hourly
+		ImportCheckInterval:      time.Minute,      // Look for imports every minute
+		HistorySize:              500,              // Remember the last 500 transfer events
+		SlowSpeedCheckInterval:   30 * time.Second, // Sample download speeds every 30 seconds
+		MaintenanceCheckInterval: 30 * time.Second, // Start and end maintenance windows within 30 seconds
+		WindowCheckInterval:      30 * time.Second, // Open and close download windows within 30 seconds
+		TuningSaveInterval:       5 * time.Minute,  // Save learned settings every 5 minutes
+		ThroughputSaveInterval:   5 * time.Minute,  // Save the speed history every 5 minutes
+		QueueSaveInterval:        30 * time.Second, // Save download progress every 30 seconds
+		SpaceCheckInterval:       30 * time.Second, // Start downloads waiting for disk space within 30 seconds
+		LoadCheckInterval:        15 * time.Second, // Adapt to the system load every 15 seconds
+		TokenCheckInterval:       15 * time.Minute, // Check the token every 15 minutes
+		ReconcileInterval:        10 * time.Minute, // Compare local state with the provider every 10 minutes
+	}
+}
+
+// GetLowPowerConfig returns a DownloadConfig for devices with little memory
+// and CPU, such as a Raspberry Pi or a consumer NAS: fewer workers and
+// connections, a shorter queue and less frequent polling
+func GetLowPowerConfig() *DownloadConfig {
+	cfg := GetDefaultConfig()
+	cfg.DefaultWorkerCount = 2                    // 2 concurrent downloads
+	cfg.BufferMultiple = 2                        // Buffer size = 2 * worker count
+	cfg.ProgressUpdateInterval = 15 * time.Second // Log progress every 15 seconds
+	cfg.TransferCheckInterval = 2 * time.Minute   // Check for new transfers every 2 minutes
+	cfg.ConnectionBudget = 4                      // 4 connections shared across all downloads
+	cfg.SmallFileBatchSize = 10                   // Up to 10 small files per batch
+	cfg.RetentionCheckInterval = 6 * time.Hour    // Check retention every 6 hours
+	cfg.ImportCheckInterval = 5 * time.Minute     // Look for imports every 5 minutes
+	cfg.HistorySize = 100                         // Remember the last 100 transfer events
+	cfg.SlowSpeedCheckInterval = 2 * time.Minute  // Sample download speeds every 2 minutes
+	cfg.TuningSaveInterval = 15 * time.Minute     // Save learned settings every 15 minutes, sparing SD cards
+	cfg.ThroughputSaveInterval = 15 * time.Minute // Save the speed history every 15 minutes
+	cfg.QueueSaveInterval = 2 * time.Minute       // Save download progress every 2 minutes
+	cfg.SpaceCheckInterval = 2 * time.Minute      // Start downloads waiting for disk space within 2 minutes
+	cfg.LoadCheckInterval = 30 * time.Second      // Adapt to the system load every 30 seconds
+	cfg.TokenCheckInterval = time.Hour            // Check the token hourly
+	cfg.ReconcileInterval = 30 * time.Minute      // Compare local state with the provider every 30 minutes
+	return cfg
+}
+
+// GetProfileConfig returns the DownloadConfig of a resource profile
+func GetProfileConfig(profile string) *DownloadConfig {
+	if profile == config.ProfileLowPower {
+		return GetLowPowerConfig()
 	}
+	return GetDefaultConfig()
 }
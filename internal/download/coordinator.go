@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/elsbrock/go-putio"
+	"github.com/elsbrock/plundrio/internal/events"
 	"github.com/elsbrock/plundrio/internal/log"
 )
 
@@ -40,7 +41,9 @@ func (tc *TransferCoordinator) InitiateTransfer(id int64, name string, fileID in
 		State:      TransferLifecycleInitial,
 		Transfer:   transfer,
 	}
+	added := tc.manager.transferEvent(ctx, events.TransferAdded, nil)
 	tc.transfers.Store(id, ctx)
+	tc.manager.publish(added)
 
 	log.Info("transfer").
 		Int64("id", id).
@@ -67,6 +70,7 @@ func (tc *TransferCoordinator) StartDownload(transferID int64) error {
 
 	ctx.State = TransferLifecycleDownloading
 	ctx.StartTime = time.Now() // Track when download started
+	tc.manager.publish(tc.manager.transferEvent(ctx, events.TransferDownloading, nil))
 
 	log.Info("transfer").
 		Int64("id", transferID).
@@ -123,8 +127,58 @@ func (tc *TransferCoordinator) FileCompleted(transferID int64) error {
 		Float64("bytes_progress", bytesProgress).
 		Msg("File completed")
 
-	// Check if all files are done (completed + failed = total)
-	if completed+ctx.FailedFiles >= ctx.TotalFiles {
+	tc.checkFilesDone(ctx, transferID)
+	return nil
+}
+
+// FileSkipped leaves a file that no longer exists on Put.io out of the
+// transfer, so the transfer can complete with the remaining files
+func (tc *TransferCoordinator) FileSkipped(transferID int64, fileID int64, size int64) error {
+	ctx, ok := tc.GetTransferContext(transferID)
+	if !ok {
+		return nil
+	}
+
+	ctx.Mu.Lock()
+	defer ctx.Mu.Unlock()
+
+	if ctx.State == TransferLifecycleCompleted {
+		return nil
+	}
+	if ctx.State != TransferLifecycleDownloading && ctx.State != TransferLifecycleFailed {
+		return fmt.Errorf("cannot skip file: transfer %d is in state %s", transferID, ctx.State)
+	}
+
+	skipped := atomic.AddInt32(&ctx.SkippedFiles, 1)
+	if ctx.TotalSize >= size {
+		ctx.TotalSize -= size
+	}
+	for i, file := range ctx.wanted {
+		if file.FileID == fileID {
+			ctx.wanted = append(ctx.wanted[:i], ctx.wanted[i+1:]...)
+			break
+		}
+	}
+
+	log.Info("transfer").
+		Int64("id", transferID).
+		Str("name", ctx.Name).
+		Int32("skipped", skipped).
+		Int32("total", ctx.TotalFiles).
+		Int64("total_bytes", ctx.TotalSize).
+		Msg("File skipped")
+
+	tc.checkFilesDone(ctx, transferID)
+	return nil
+}
+
+// checkFilesDone updates the state of a transfer once all of its files are
+// completed, failed or skipped. The caller must hold ctx.Mu.
+func (tc *TransferCoordinator) checkFilesDone(ctx *TransferContext, transferID int64) {
+	completed := ctx.CompletedFiles
+
+	// Check if all files are done (completed + failed + skipped = total)
+	if completed+ctx.FailedFiles+ctx.SkippedFiles >= ctx.TotalFiles {
 		// Only mark as completed if there are no failed files
 		if ctx.FailedFiles == 0 {
 			// We already have the lock, so just update the state
@@ -152,12 +206,61 @@ func (tc *TransferCoordinator) FileCompleted(transferID int64) error {
 				Msg("Transfer has failed files, keeping for retry")
 		}
 	}
+}
+
+// handleUnverifiedFiles puts files that failed verification back into the
+// download, or fails the transfer if they keep failing. The caller must hold
+// ctx.Mu.
+func (tc *TransferCoordinator) handleUnverifiedFiles(ctx *TransferContext, missing []wantedFile) error {
+	ctx.verifyFailures++
+	n := int32(len(missing))
+	ctx.CompletedFiles -= n
+	for _, file := range missing {
+		ctx.DownloadedSize = max(ctx.DownloadedSize-file.Size, 0)
+	}
 
-	return nil
+	if ctx.verifyFailures > maxVerifyFailures {
+		ctx.FailedFiles += n
+		ctx.State = TransferLifecycleFailed
+		err := NewVerifyFailedError(n, ctx.verifyFailures)
+		ctx.Error = err
+		for _, file := range missing {
+			ctx.failed = append(ctx.failed, failedFile{file, err})
+			tc.manager.recordFailure(downloadJob{
+				FileID:     file.FileID,
+				Name:       file.Name,
+				TransferID: ctx.ID,
+				Size:       file.Size,
+				CRC32:      file.CRC32,
+			}, ctx.Name, err)
+		}
+		ctx.failedAt = time.Now()
+		tc.manager.publish(tc.manager.transferEvent(ctx, events.TransferFailed, err))
+		log.Error("transfer").
+			Int64("id", ctx.ID).
+			Str("name", ctx.Name).
+			Int32("files", n).
+			Msg("Files keep failing verification, giving up")
+		return err
+	}
+
+	ctx.State = TransferLifecycleDownloading
+	log.Warn("transfer").
+		Int64("id", ctx.ID).
+		Str("name", ctx.Name).
+		Int32("files", n).
+		Int("attempt", ctx.verifyFailures).
+		Msg("Files missing or incomplete, downloading them again before completing the transfer")
+
+	// Queueing may block, and the workers need ctx.Mu to finish files
+	go tc.manager.redownloadFiles(ctx.ID, missing)
+	return fmt.Errorf("cannot complete transfer: %d files failed verification", n)
 }
 
-// FileFailure marks a file as failed but keeps the transfer context
-func (tc *TransferCoordinator) FileFailure(transferID int64) error {
+// FileFailure marks a file as failed but keeps the transfer context, so the
+// file can be retried later. The error of the file is kept as the error of
+// the transfer.
+func (tc *TransferCoordinator) FileFailure(transferID int64, file wantedFile, err error) error {
 	ctx, ok := tc.GetTransferContext(transferID)
 	if !ok {
 		// If transfer not found, it might have been already completed
@@ -182,6 +285,9 @@ func (tc *TransferCoordinator) FileFailure(transferID int64) error {
 
 	// Mark transfer as failed but don't delete it
 	ctx.State = TransferLifecycleFailed
+	ctx.Error = err
+	ctx.failed = append(ctx.failed, failedFile{file, err})
+	ctx.failedAt = time.Now()
 
 	log.Error("transfer").
 		Int64("id", transferID).
@@ -191,8 +297,10 @@ func (tc *TransferCoordinator) FileFailure(transferID int64) error {
 		Int32("total", total).
 		Msg("File failed but keeping transfer for retry")
 
-	// Check if all files are processed (completed + failed = total)
-	if completed+failed >= total {
+	// Check if all files are processed (completed + failed + skipped = total)
+	if completed+failed+ctx.SkippedFiles >= total {
+		tc.manager.publish(tc.manager.transferEvent(ctx, events.TransferFailed,
+			fmt.Errorf("%d of %d files failed to download: %w", failed, total, err)))
 		log.Info("transfer").
 			Int64("id", transferID).
 			Str("name", ctx.Name).
@@ -228,7 +336,7 @@ func (tc *TransferCoordinator) CompleteTransfer(transferID int64) error {
 	ctx.State = TransferLifecycleCompleted
 
 	// Double-check that all files are actually completed
-	if ctx.CompletedFiles+ctx.FailedFiles < ctx.TotalFiles {
+	if ctx.CompletedFiles+ctx.FailedFiles+ctx.SkippedFiles < ctx.TotalFiles {
 		log.Warn("transfer").
 			Int64("id", transferID).
 			Str("name", ctx.Name).
@@ -237,7 +345,13 @@ func (tc *TransferCoordinator) CompleteTransfer(transferID int64) error {
 			Int32("total", ctx.TotalFiles).
 			Msg("Attempting to complete transfer before all files are done")
 		return fmt.Errorf("cannot complete transfer: %d/%d files still pending",
-			ctx.TotalFiles-(ctx.CompletedFiles+ctx.FailedFiles), ctx.TotalFiles)
+			ctx.TotalFiles-(ctx.CompletedFiles+ctx.FailedFiles+ctx.SkippedFiles), ctx.TotalFiles)
+	}
+
+	// Only report the transfer as completed once every file is really there,
+	// so *arr applications never import a partial transfer
+	if missing := tc.manager.unverifiedFiles(ctx); len(missing) > 0 {
+		return tc.handleUnverifiedFiles(ctx, missing)
 	}
 
 	log.Info("transfer").
@@ -257,9 +371,13 @@ func (tc *TransferCoordinator) CompleteTransfer(transferID int64) error {
 
 	// Mark the transfer as processed instead of removing it
 	ctx.State = TransferLifecycleProcessed
+	tc.manager.publish(tc.manager.transferEvent(ctx, events.TransferCompleted, nil))
 
-	// Mark the transfer as processed in the processor, passing the original transfer for RPC visibility
-	tc.manager.GetTransferProcessor().MarkTransferProcessed(transferID, ctx.Transfer)
+	// Mark the transfer as processed in the processor, passing the original transfer for RPC visibility.
+	// Manually queued files have no transfer to show.
+	if !ctx.Manual {
+		tc.manager.GetTransferProcessor().MarkTransferProcessed(transferID, ctx.Transfer)
+	}
 
 	log.Info("transfer").
 		Int64("id", transferID).
@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package download
+
+// freeSpace is not known on this platform, so downloads never wait for space
+func freeSpace(path string) (int64, bool) {
+	return 0, false
+}
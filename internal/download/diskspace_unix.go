@@ -0,0 +1,30 @@
+//go:build linux || darwin || freebsd
+
+package download
+
+import (
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// freeSpace returns the bytes available to plundrio on the filesystem a path
+// is on, or false if they are unknown. The path does not need to exist yet;
+// its closest existing parent is used.
+func freeSpace(path string) (int64, bool) {
+	for {
+		if _, err := os.Stat(path); err == nil {
+			var stat unix.Statfs_t
+			if err := unix.Statfs(path, &stat); err != nil {
+				return 0, false
+			}
+			return int64(stat.Bavail) * int64(stat.Bsize), true
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return 0, false
+		}
+		path = parent
+	}
+}
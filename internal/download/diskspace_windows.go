@@ -0,0 +1,34 @@
+//go:build windows
+
+package download
+
+import (
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/windows"
+)
+
+// freeSpace returns the bytes available to plundrio on the volume a path is
+// on, or false if they are unknown. The path does not need to exist yet; its
+// closest existing parent is used.
+func freeSpace(path string) (int64, bool) {
+	for {
+		if _, err := os.Stat(path); err == nil {
+			name, err := windows.UTF16PtrFromString(path)
+			if err != nil {
+				return 0, false
+			}
+			var available, total, free uint64
+			if err := windows.GetDiskFreeSpaceEx(name, &available, &total, &free); err != nil {
+				return 0, false
+			}
+			return int64(available), true
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return 0, false
+		}
+		path = parent
+	}
+}
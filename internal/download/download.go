@@ -1,76 +1,120 @@
 package download
 
 import (
-	"bufio"
 	"context"
+	"errors"
 	"fmt"
-	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"regexp"
-	"strconv"
 	"strings"
 	"time"
 
+	"github.com/elsbrock/plundrio/internal/events"
 	"github.com/elsbrock/plundrio/internal/log"
+	"github.com/elsbrock/plundrio/internal/provider"
 )
 
 // downloadWorker processes download jobs from the queue
 func (m *Manager) downloadWorker() {
 	for {
-		select {
-		case <-m.stopChan:
+		job, ok := m.jobs.pop(m.stopChan)
+		if !ok {
 			// Immediate shutdown requested
 			log.Info("download").Msg("Worker stopping due to shutdown request")
 			return
-		case job, ok := <-m.jobs:
-			if !ok {
-				return
-			}
-			state := &DownloadState{
-				FileID:     job.FileID,
-				Name:       job.Name,
-				TransferID: job.TransferID,
-				StartTime:  time.Now(),
-			}
-			err := m.downloadWithRetry(state)
-			if err != nil {
-				if downloadErr, ok := err.(*DownloadError); ok && downloadErr.Type == "DownloadCancelled" {
-					log.Info("download").
-						Str("file_name", job.Name).
-						Msg("Download cancelled due to shutdown")
-					// Just remove from active files for cancelled downloads
-					m.activeFiles.Delete(job.FileID)
-					// Don't call FailTransfer for cancellations
-					continue
-				}
-				// Handle permanent failures
-				log.Error("download").
-					Str("file_name", job.Name).
-					Err(err).
-					Msg("Failed to download file")
+		}
+		if m.holdIfPaused(job) || m.holdForSpace(job) {
+			continue
+		}
+		if len(job.Batch) > 0 {
+			m.processBatch(job)
+			continue
+		}
+		m.processJob(job)
+	}
+}
 
-				// Just remove the file from active files but don't fail the entire transfer
-				// We'll keep the transfer context so we can retry later
-				m.activeFiles.Delete(job.FileID)
+// processJob downloads a single file and updates the transfer state accordingly
+func (m *Manager) processJob(job downloadJob) {
+	state := &DownloadState{
+		FileID:     job.FileID,
+		Name:       job.Name,
+		TransferID: job.TransferID,
+		Size:       job.Size,
+		CRC32:      job.CRC32,
+		StartTime:  time.Now(),
+	}
+	// A larger file of another transfer took over the path
+	if !m.ownsPath(job) {
+		m.publish(m.fileEvent(events.FileSkipped, job, NewPathCollisionError(job.Name)))
+		m.handleFileSkipped(job)
+		return
+	}
 
-				// Mark this file as failed in the transfer context
-				m.handleFileFailure(job.TransferID)
-				continue
+	m.publish(m.fileEvent(events.FileStarted, job, nil))
+	unlock := m.lockPath(m.jobPath(job))
+	err := m.downloadWithRetry(state)
+	unlock()
+	if err != nil {
+		if downloadErr, ok := err.(*DownloadError); ok && downloadErr.Type == "DownloadCancelled" {
+			// Interrupted by a pause, pick it up again on resume (or drop it if cancelled)
+			if !m.stopping() && m.holdIfPaused(job) {
+				log.Info("download").
+					Str("file_name", job.Name).
+					Int64("transfer_id", job.TransferID).
+					Msg("Download stopped")
+				return
 			}
-			// Pass both transferID and fileID to handleFileCompletion
-			// The file cleanup is now handled inside handleFileCompletion
-			m.handleFileCompletion(job.TransferID, job.FileID)
-			// Do NOT call m.activeFiles.Delete here - now handled in handleFileCompletion
+			log.Info("download").
+				Str("file_name", job.Name).
+				Int64("transfer_id", job.TransferID).
+				Msg("Download cancelled due to shutdown")
+			// Just remove from active files for cancelled downloads
+			m.activeFiles.Delete(job.FileID)
+			// Don't call FailTransfer for cancellations
+			return
 		}
+		// Files deleted from Put.io will never download, leave them out
+		var downloadErr *DownloadError
+		if errors.As(err, &downloadErr) && downloadErr.Type == "FileMissing" {
+			log.Warn("download").
+				Str("file_name", job.Name).
+				Int64("transfer_id", job.TransferID).
+				Msg("File no longer exists on Put.io, skipping it")
+			m.publish(m.fileEvent(events.FileSkipped, job, downloadErr))
+			m.handleFileSkipped(job)
+			return
+		}
+
+		// Handle permanent failures
+		log.Error("download").
+			Str("file_name", job.Name).
+			Int64("transfer_id", job.TransferID).
+			Err(err).
+			Msg("Failed to download file")
+
+		// Just remove the file from active files but don't fail the entire transfer
+		// We'll keep the transfer context so we can retry later
+		m.activeFiles.Delete(job.FileID)
+
+		// Mark this file as failed in the transfer context
+		m.publish(m.fileEvent(events.FileFailed, job, err))
+		m.handleFileFailure(job, err)
+		return
 	}
+	m.publish(m.fileEvent(events.FileCompleted, job, nil))
+	// Pass both transferID and fileID to handleFileCompletion
+	// The file cleanup is now handled inside handleFileCompletion
+	m.handleFileCompletion(job.TransferID, job.FileID)
+	// Do NOT call m.activeFiles.Delete here - now handled in handleFileCompletion
 }
 
 // downloadWithRetry attempts to download a file with retries on transient errors
 func (m *Manager) downloadWithRetry(state *DownloadState) error {
 	const maxRetries = 3
+	const maxURLRefreshes = 5
 	var lastErr error
+	refreshes := 0
 
 	for attempt := 1; attempt <= maxRetries; attempt++ {
 		if err := m.downloadFile(state); err != nil {
@@ -79,18 +123,35 @@ func (m *Manager) downloadWithRetry(state *DownloadState) error {
 				return err
 			}
 
+			// An expired URL is not a failed attempt; downloadFile fetches a
+			// fresh one and aria2c continues the partial download
+			if downloadErr, ok := err.(*DownloadError); ok && downloadErr.Type == "URLExpired" && refreshes < maxURLRefreshes {
+				refreshes++
+				attempt--
+				log.Info("download").
+					Str("file_name", state.Name).
+					Int64("transfer_id", state.TransferID).
+					Int("refresh", refreshes).
+					Msg("Download URL expired, resuming with a fresh URL")
+				continue
+			}
+
 			lastErr = err
 			if !isTransientError(err) {
 				return fmt.Errorf("permanent error on attempt %d: %w", attempt, err)
 			}
 			log.Warn("download").
 				Str("file_name", state.Name).
+				Int64("transfer_id", state.TransferID).
 				Int("attempt", attempt).
 				Err(err).
 				Msg("Retrying download after error")
-			time.Sleep(time.Second * time.Duration(attempt))
+			if !m.waitForRetry(state, time.Second*time.Duration(attempt)) {
+				return NewDownloadCancelledError(state.Name, "download stopped")
+			}
 			continue
 		}
+		m.retries.succeeded()
 		return nil
 	}
 	return fmt.Errorf("failed after %d attempts, last error: %w", maxRetries, lastErr)
@@ -107,6 +168,12 @@ func isTransientError(err error) bool {
 		return false
 	}
 
+	// aria2c exit codes tell whether a retry makes sense
+	var downloadErr *DownloadError
+	if errors.As(err, &downloadErr) {
+		return downloadErr.Transient
+	}
+
 	// Check for grab errors
 	if err.Error() == "connection reset" ||
 		err.Error() == "connection refused" ||
@@ -125,122 +192,148 @@ func isTransientError(err error) bool {
 	return false
 }
 
-// downloadFile downloads a file from Put.io using aria2c for multi-connection downloads
+// downloadFile downloads a file from Put.io over several connections, with
+// aria2c or the native downloader
 func (m *Manager) downloadFile(state *DownloadState) error {
-	// Create a context that's cancelled when stopChan is closed
-	ctx, cancel := context.WithCancel(context.Background())
-
-	// Set up cancellation from stopChan
-	go func() {
-		select {
-		case <-m.stopChan:
-			cancel()
-		case <-ctx.Done():
-		}
-	}()
-
+	// Create a context that's cancelled when stopChan is closed or the transfer is paused
+	ctx, cancel := m.newStopContext(state.TransferID)
 	defer cancel()
 
 	// Get download URL
-	url, err := m.client.GetDownloadURL(state.FileID)
+	url, err := m.provider.GetDownloadURL(ctx, state.FileID)
 	if err != nil {
+		if ctx.Err() != nil {
+			return NewDownloadCancelledError(state.Name, "download stopped")
+		}
+		if errors.Is(err, provider.ErrFileNotFound) {
+			return NewFileMissingError(state.Name)
+		}
 		return fmt.Errorf("failed to get download URL: %w", err)
 	}
 
-	// Prepare target path
-	targetPath := filepath.Join(m.cfg.TargetDir, state.Name)
-	targetDir := filepath.Dir(targetPath)
-	if err := os.MkdirAll(targetDir, 0755); err != nil {
+	// Prepare target path and the path the file is written to until it is
+	// complete
+	targetPath := filepath.Join(m.TargetDir(state.TransferID), state.Name)
+	writePath := m.incompletePath(targetPath)
+	targetDir := filepath.Dir(writePath)
+	if err := os.MkdirAll(longPath(targetDir), 0755); err != nil {
 		return fmt.Errorf("failed to create directory: %w", err)
 	}
 
-	// Check if file exists from previous non-aria2c download
-	// If it does and there's no .aria2 control file, remove it
-	if _, err := os.Stat(targetPath); err == nil {
-		aria2ControlFile := targetPath + ".aria2"
-		if _, err := os.Stat(aria2ControlFile); os.IsNotExist(err) {
-			// File exists but not from aria2c, remove it so aria2c can start fresh
+	// Check if file exists from a download the current downloader cannot
+	// continue. If it does and there's no control file of its own, remove it
+	controlSuffix := ".aria2"
+	if m.httpClient != nil {
+		controlSuffix = nativeControlSuffix
+	}
+	if _, err := os.Stat(longPath(writePath)); err == nil {
+		controlFile := longPath(writePath + controlSuffix)
+		if _, err := os.Stat(controlFile); os.IsNotExist(err) {
+			// File exists but cannot be continued, remove it so the download starts fresh
 			log.Info("download").
 				Str("file_name", state.Name).
+				Int64("transfer_id", state.TransferID).
 				Msg("Removing existing partial download from previous session")
-			if err := os.Remove(targetPath); err != nil {
+			if err := os.Remove(longPath(writePath)); err != nil {
 				log.Warn("download").
 					Str("file_name", state.Name).
+					Int64("transfer_id", state.TransferID).
 					Err(err).
 					Msg("Failed to remove existing file, continuing anyway")
 			}
 		}
 	}
 
-	// aria2c arguments for maximum speed
-	args := []string{
-		"-x", "16", // 16 connections per server
-		"-s", "16", // Split file into 16 segments
-		"-k", "1M", // Min split size 1MB
-		"--max-tries=5",
-		"--retry-wait=3",
-		"--connect-timeout=30",
-		"--timeout=60",
-		"--allow-overwrite=true",
-		"--auto-file-renaming=false",
-		"--continue=true", // Resume support
-		"--summary-interval=0", // Disable summary to reduce output
-		"--console-log-level=notice", // Reduce console spam
-		"-d", targetDir,
-		"-o", filepath.Base(targetPath),
-		url,
+	// Wait for a slot in the download queue and until the volume takes
+	// another writer
+	releaseSlot, err := m.acquireQueueSlot(ctx, state.TransferID)
+	if err != nil {
+		return NewDownloadCancelledError(state.Name, "download stopped")
 	}
-
-	log.Info("download").
-		Str("file_name", state.Name).
-		Str("target_path", targetPath).
-		Msg("Starting download with aria2c (16 connections)")
-
-	// Create aria2c command
-	cmd := exec.CommandContext(ctx, "aria2c", args...)
-
-	// Get stdout pipe for progress tracking
-	stdout, err := cmd.StdoutPipe()
+	defer releaseSlot()
+	releaseVolume, err := m.acquireVolume(ctx, targetDir)
 	if err != nil {
-		return fmt.Errorf("failed to create stdout pipe: %w", err)
+		return NewDownloadCancelledError(state.Name, "download stopped")
 	}
-
-	// Get stderr pipe
-	stderr, err := cmd.StderrPipe()
+	defer releaseVolume()
+
+	// Reserve connections according to the bandwidth strategy, but use no
+	// more than were worth it with the server before or the server takes
+	server := serverOf(url)
+	connections := m.tuner.connections(server, m.acquireConnections())
+	defer m.releaseConnections()
+	// Mounts such as rclone's upload what is written through a cache that
+	// handles files written from start to end best
+	state.mount = m.writesToMount(targetDir)
+	if state.mount {
+		connections = 1
+	}
+	connections, releaseHost, err := m.acquireHostConnections(ctx, serversOf([]string{url}), connections)
 	if err != nil {
-		return fmt.Errorf("failed to create stderr pipe: %w", err)
+		return NewDownloadCancelledError(state.Name, "download stopped")
 	}
+	defer releaseHost()
 
-	// Start the command
-	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("failed to start aria2c: %w", err)
+	log.Info("download").
+		Str("file_name", state.Name).
+		Int64("transfer_id", state.TransferID).
+		Str("target_path", targetPath).
+		Str("write_path", writePath).
+		Int("connections", connections).
+		Str("downloader", m.downloader()).
+		Bool("mount", state.mount).
+		Msg("Starting download")
+
+	if m.httpClient != nil {
+		err = m.downloadNative(ctx, state, url, writePath, connections, m.tuner.retryWait(server))
+	} else {
+		err = m.downloadAria2c(ctx, state, url, writePath, connections, server)
 	}
 
-	// Monitor progress in goroutine
-	progressDone := make(chan struct{})
-	go m.monitorAria2cProgress(ctx, state, stdout, stderr, progressDone)
-
-	// Wait for command to complete
-	cmdErr := cmd.Wait()
-
-	// Signal progress monitor to stop
-	close(progressDone)
-
 	// Check for cancellation
 	if ctx.Err() != nil {
 		return NewDownloadCancelledError(state.Name, "download stopped")
 	}
+	if err != nil {
+		if isTransientError(err) {
+			m.tuner.recordFailure(server)
+		}
+		return err
+	}
 
-	// Check for command errors
-	if cmdErr != nil {
-		return fmt.Errorf("aria2c failed: %w", cmdErr)
+	state.mu.Lock()
+	var averageSpeed float64
+	if state.speedSamples > 0 {
+		averageSpeed = state.speedSum / float64(state.speedSamples)
+	}
+	state.mu.Unlock()
+	m.tuner.recordSuccess(server, connections, averageSpeed)
+
+	// Follow the transfer if its target directory changed during the download
+	if finalPath := filepath.Join(m.TargetDir(state.TransferID), state.Name); finalPath != targetPath {
+		if writePath == targetPath {
+			if err := m.relocateFinished(targetPath, finalPath); err != nil {
+				return fmt.Errorf("failed to move download to new target directory: %w", err)
+			}
+			writePath = finalPath
+		}
+		targetPath = finalPath
 	}
 
 	// Verify file exists and get size
-	fileInfo, err := os.Stat(targetPath)
+	fileInfo, err := statRetry(longPath(writePath))
 	if err != nil {
 		return fmt.Errorf("failed to verify downloaded file: %w", err)
 	}
+	if err := m.verifyWritten(ctx, state, url, writePath, fileInfo); err != nil {
+		return err
+	}
+	if err := m.verifyChecksum(state, writePath, fileInfo); err != nil {
+		return err
+	}
+	if err := m.finishIncomplete(writePath, targetPath); err != nil {
+		return fmt.Errorf("failed to move download to target directory: %w", err)
+	}
 
 	totalSize := fileInfo.Size()
 	elapsed := time.Since(state.StartTime).Seconds()
@@ -261,79 +354,154 @@ func (m *Manager) downloadFile(state *DownloadState) error {
 
 	log.Info("download").
 		Str("file_name", state.Name).
+		Int64("transfer_id", state.TransferID).
 		Float64("size_mb", float64(totalSize)/1024/1024).
 		Float64("speed_mbps", averageSpeedMBps).
 		Dur("duration", time.Since(state.StartTime)).
 		Str("target_path", targetPath).
-		Msg("Download completed with aria2c")
+		Str("downloader", m.downloader()).
+		Msg("Download completed")
 
 	return nil
 }
 
-// monitorAria2cProgress monitors aria2c output for progress updates
-func (m *Manager) monitorAria2cProgress(ctx context.Context, state *DownloadState, stdout, stderr io.ReadCloser, done chan struct{}) {
-	// Regex to parse aria2c progress output
-	// Example: [#1 SIZE:1.2GiB/10.5GiB(11%) CN:16 DL:45.2MiB ETA:3m12s]
-	progressRegex := regexp.MustCompile(`\[#\d+.*?(\d+)%.*?DL:([\d.]+)(KiB|MiB|GiB).*?ETA:([^\]]+)\]`)
+// downloadAria2c downloads a file with the aria2c daemon
+func (m *Manager) downloadAria2c(ctx context.Context, state *DownloadState, url, targetPath string, connections int, server string) error {
+	d, err := m.aria2()
+	if err != nil {
+		return err
+	}
+	_, leave := m.joinTransferLimit(state.TransferID)
+	defer leave()
+
+	options := m.aria2Options(targetPath, connections, m.tuner.retryWait(server))
+	if state.mount {
+		options["file-allocation"] = "none"
+	}
+	gid, err := d.addURI(ctx, url, options)
+	if err != nil {
+		// Cancellation is left to downloadFile
+		if ctx.Err() != nil {
+			return nil
+		}
+		return NewNetworkError(state.Name, err)
+	}
+	m.addAria2Download(d, state.TransferID, gid)
+	defer m.removeAria2Download(d, state.TransferID, gid)
+	return m.monitorAria2c(ctx, d, gid, state)
+}
+
+// newStopContext returns a context that is cancelled when the manager stops
+// or the transfer is paused
+func (m *Manager) newStopContext(transferID int64) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	paused := m.pauseSignal(transferID)
 
-	scanner := bufio.NewScanner(io.MultiReader(stdout, stderr))
+	// Set up cancellation from stopChan and pauses
+	go func() {
+		select {
+		case <-m.stopChan:
+			cancel()
+		case <-paused:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel
+}
+
+// stopping reports whether the manager is shutting down
+func (m *Manager) stopping() bool {
+	select {
+	case <-m.stopChan:
+		return true
+	default:
+		return false
+	}
+}
+
+// monitorAria2c asks aria2c for the status of a download every second and
+// updates the download state until the download finished. Once ctx is done
+// the download is removed from aria2c, which keeps the partial file and its
+// control file, so it continues where it stopped when started again.
+func (m *Manager) monitorAria2c(ctx context.Context, d *aria2Daemon, gid string, state *DownloadState) error {
+	defer m.fileSpeeds.Delete(state.FileID)
+
+	ticker := time.NewTicker(aria2PollInterval)
+	defer ticker.Stop()
 	lastProgress := float64(0)
 	lastLogTime := time.Now()
 
 	for {
 		select {
-		case <-done:
-			return
 		case <-ctx.Done():
-			return
-		default:
-			if scanner.Scan() {
-				line := scanner.Text()
-
-				// Parse progress line
-				matches := progressRegex.FindStringSubmatch(line)
-				if len(matches) >= 5 {
-					progress, _ := strconv.ParseFloat(matches[1], 64)
-					speed, _ := strconv.ParseFloat(matches[2], 64)
-					speedUnit := matches[3]
-					eta := matches[4]
-
-					// Convert speed to MB/s
-					speedMBps := speed
-					switch speedUnit {
-					case "KiB":
-						speedMBps = speed / 1024
-					case "GiB":
-						speedMBps = speed * 1024
-					}
-
-					// Update state
-					state.mu.Lock()
-					state.Progress = progress
-					state.downloaded = int64(progress) // Approximate
-					state.LastProgress = time.Now()
-					state.mu.Unlock()
-
-					// Log progress every 5 seconds
-					if time.Since(lastLogTime) >= m.dlConfig.ProgressUpdateInterval && progress != lastProgress {
-						log.Info("download").
-							Str("file_name", state.Name).
-							Float64("progress_percent", progress).
-							Float64("speed_mbps", speedMBps).
-							Str("eta", eta).
-							Msg("Download progress")
-
-						lastProgress = progress
-						lastLogTime = time.Now()
-					}
-				} else if strings.Contains(line, "Exception") || strings.Contains(line, "error") || strings.Contains(line, "ERROR") || strings.Contains(line, "failed") {
-					// Log aria2c error messages
-					log.Error("download").
-						Str("file_name", state.Name).
-						Str("aria2c_output", line).
-						Msg("aria2c error output")
-				}
+			// Cancellation is left to downloadFile
+			d.remove(gid)
+			return nil
+		case <-ticker.C:
+		}
+
+		status, err := d.status(ctx, gid)
+		if err != nil {
+			if ctx.Err() != nil {
+				continue
+			}
+			d.remove(gid)
+			return NewNetworkError(state.Name, err)
+		}
+
+		// The percentage is unknown until aria2c knows the size
+		completed, total, speed := status.progress()
+		state.mu.Lock()
+		state.downloaded = completed
+		if total > 0 {
+			state.Progress = float64(completed) / float64(total) * 100
+		}
+		if speed > 0 {
+			state.speedSum += speed
+			state.speedSamples++
+		}
+		progress := state.Progress
+		state.LastProgress = time.Now()
+		state.mu.Unlock()
+		m.fileSpeeds.Store(state.FileID, speed)
+
+		switch status.Status {
+		case aria2StatusComplete:
+			d.forget(gid)
+			return nil
+		case aria2StatusError:
+			d.forget(gid)
+			log.TransferOutput(state.TransferID, "aria2c", state.Name, status.ErrorMessage)
+			log.Error("download").
+				Str("file_name", state.Name).
+				Int64("transfer_id", state.TransferID).
+				Str("aria2c_error_code", status.ErrorCode).
+				Str("aria2c_output", status.ErrorMessage).
+				Msg("aria2c failed to download file")
+			return status.err(state.Name)
+		case aria2StatusRemoved:
+			d.forget(gid)
+			return NewDownloadCancelledError(state.Name, "removed from aria2c")
+		}
+
+		// Log progress every 5 seconds
+		if time.Since(lastLogTime) >= m.dlConfig.ProgressUpdateInterval && progress != lastProgress {
+			eta := ""
+			if speed > 0 && total > 0 {
+				eta = (time.Duration(float64(total-completed)/speed) * time.Second).Round(time.Second).String()
 			}
+			log.Info("download").
+				Str("file_name", state.Name).
+				Int64("transfer_id", state.TransferID).
+				Float64("progress_percent", progress).
+				Float64("speed_mbps", speed/1024/1024).
+				Str("eta", eta).
+				Msg("Download progress")
+
+			lastProgress = progress
+			lastLogTime = time.Now()
 		}
 	}
 }
@@ -0,0 +1,179 @@
+package download
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/events"
+	"github.com/elsbrock/plundrio/internal/log"
+	"github.com/elsbrock/plundrio/internal/state"
+)
+
+// HistoryState is the name of the state document the download history is
+// kept in
+const HistoryState = "history"
+
+// Outcomes of a download in the history
+const (
+	OutcomeCompleted = "completed"
+	OutcomeFailed    = "failed"
+	OutcomeCancelled = "cancelled"
+)
+
+// HistoryEntry is a finished download: completed, failed or cancelled
+type HistoryEntry struct {
+	Time            time.Time `json:"time"` // when the download finished
+	TransferID      int64     `json:"transfer_id"`
+	Name            string    `json:"name"`
+	Category        string    `json:"category,omitempty"`
+	Outcome         string    `json:"outcome"`
+	Size            int64     `json:"size"`
+	DurationSeconds int64     `json:"duration_seconds"`
+	SpeedBps        float64   `json:"speed_bps"` // average speed
+	Error           string    `json:"error,omitempty"`
+	ErrorCode       string    `json:"error_code,omitempty"`
+	RequestedBy     string    `json:"requested_by,omitempty"` // API user the transfer was added by
+}
+
+// History lists the finished downloads, oldest first
+type History struct {
+	Entries []HistoryEntry `json:"entries"`
+}
+
+// HistoryQuery filters and pages the download history. Empty fields match
+// every download.
+type HistoryQuery struct {
+	Outcome     string
+	Category    string
+	RequestedBy string
+	Search      string    // part of the name, ignoring case
+	Since       time.Time // only downloads finished at or after this time
+	Limit       int       // 0 returns all matching downloads
+	Offset      int
+}
+
+// downloadRecords keeps the history of finished downloads, dropping those
+// older than the configured number of days
+type downloadRecords struct {
+	mu      sync.Mutex
+	store   *state.Store // nil without a state directory
+	entries []HistoryEntry
+	days    int // 0 keeps downloads forever
+}
+
+// newDownloadRecords loads the download history of earlier runs from the
+// state directory
+func newDownloadRecords(stateDir string, days int) *downloadRecords {
+	r := &downloadRecords{days: days}
+	if stateDir == "" {
+		return r
+	}
+
+	store, err := state.New(stateDir)
+	if err != nil {
+		log.Warn("history").Err(err).Msg("Download history will not be remembered")
+		return r
+	}
+	r.store = store
+
+	var history History
+	if err := store.Load(HistoryState, &history); err != nil {
+		log.Warn("history").Err(err).Msg("Failed to load download history")
+		return r
+	}
+	r.entries = history.Entries
+	r.prune(time.Now())
+	return r
+}
+
+// prune drops the downloads that finished before the retention period. The
+// caller must hold mu.
+func (r *downloadRecords) prune(now time.Time) {
+	if r.days <= 0 {
+		return
+	}
+	cutoff := now.AddDate(0, 0, -r.days)
+	i, _ := slices.BinarySearchFunc(r.entries, cutoff, func(entry HistoryEntry, t time.Time) int {
+		return entry.Time.Compare(t)
+	})
+	r.entries = slices.Delete(r.entries, 0, i)
+}
+
+// recordDownload adds a completed, failed or cancelled transfer to the
+// download history
+func (m *Manager) recordDownload(event events.Event) {
+	var outcome string
+	switch event.Type {
+	case events.TransferCompleted:
+		outcome = OutcomeCompleted
+	case events.TransferFailed:
+		outcome = OutcomeFailed
+	case events.TransferCancelled:
+		outcome = OutcomeCancelled
+	default:
+		return
+	}
+	entry := HistoryEntry{
+		Time:            event.Time,
+		TransferID:      event.TransferID,
+		Name:            event.Name,
+		Category:        event.Category,
+		Outcome:         outcome,
+		Size:            event.Size,
+		DurationSeconds: int64(event.Duration.Seconds()),
+		SpeedBps:        event.Speed,
+		Error:           event.Error,
+		ErrorCode:       event.ErrorCode,
+		RequestedBy:     event.RequestedBy,
+	}
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+
+	r := m.records
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, entry)
+	r.prune(time.Now())
+
+	if r.store == nil {
+		return
+	}
+	if err := r.store.Save(HistoryState, History{Entries: r.entries}); err != nil {
+		log.Warn("history").Err(err).Msg("Failed to save download history")
+	}
+}
+
+// DownloadHistory returns the finished downloads matching a query, newest
+// first, and how many matched before paging
+func (m *Manager) DownloadHistory(query HistoryQuery) ([]HistoryEntry, int) {
+	search := strings.ToLower(query.Search)
+	r := m.records
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	matched := []HistoryEntry{}
+	for i := len(r.entries) - 1; i >= 0; i-- {
+		entry := r.entries[i]
+		if !query.Since.IsZero() && entry.Time.Before(query.Since) {
+			break
+		}
+		if query.Outcome != "" && entry.Outcome != query.Outcome ||
+			query.Category != "" && entry.Category != query.Category ||
+			query.RequestedBy != "" && entry.RequestedBy != query.RequestedBy ||
+			search != "" && !strings.Contains(strings.ToLower(entry.Name), search) {
+			continue
+		}
+		matched = append(matched, entry)
+	}
+
+	total := len(matched)
+	start := min(query.Offset, total)
+	end := total
+	if query.Limit > 0 {
+		end = min(start+query.Limit, total)
+	}
+	return matched[start:end], total
+}
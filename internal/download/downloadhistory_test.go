@@ -0,0 +1,109 @@
+package download
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/events"
+)
+
+// historyNames returns the names of history entries in order
+func historyNames(entries []HistoryEntry) []string {
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name)
+	}
+	return names
+}
+
+func TestRecordDownload(t *testing.T) {
+	stateDir := t.TempDir()
+	m := &Manager{records: newDownloadRecords(stateDir, 30)}
+	now := time.Now()
+	m.recordDownload(events.Event{Type: events.TransferCompleted, Time: now.AddDate(0, 0, -31), Name: "expired"})
+	m.recordDownload(events.Event{
+		Type:        events.TransferCompleted,
+		Time:        now.Add(-time.Hour),
+		TransferID:  1,
+		Name:        "Show",
+		Category:    "tv",
+		Size:        1000,
+		Duration:    90 * time.Second,
+		Speed:       11.5,
+		RequestedBy: "alice",
+	})
+	m.recordDownload(events.Event{Type: events.TransferFailed, TransferID: 2, Name: "Movie", Error: "disk full", ErrorCode: ErrorCodeDiskFull})
+	m.recordDownload(events.Event{Type: events.TransferAdded, TransferID: 3, Name: "added"})
+
+	// The history survives a restart, without downloads older than 30 days
+	m = &Manager{records: newDownloadRecords(stateDir, 30)}
+	entries, total := m.DownloadHistory(HistoryQuery{})
+	if total != 2 {
+		t.Fatalf("history = %+v, want 2 downloads", entries)
+	}
+	failed := entries[0]
+	if failed.Outcome != OutcomeFailed || failed.Error != "disk full" || failed.ErrorCode != ErrorCodeDiskFull || failed.Time.IsZero() {
+		t.Errorf("failed download = %+v", failed)
+	}
+	want := HistoryEntry{
+		Time:            entries[1].Time,
+		TransferID:      1,
+		Name:            "Show",
+		Category:        "tv",
+		Outcome:         OutcomeCompleted,
+		Size:            1000,
+		DurationSeconds: 90,
+		SpeedBps:        11.5,
+		RequestedBy:     "alice",
+	}
+	if !reflect.DeepEqual(entries[1], want) || !entries[1].Time.Equal(now.Add(-time.Hour)) {
+		t.Errorf("completed download = %+v, want %+v", entries[1], want)
+	}
+}
+
+func TestRecordDownloadKeepsForever(t *testing.T) {
+	m := &Manager{records: newDownloadRecords("", 0)}
+	m.recordDownload(events.Event{Type: events.TransferCancelled, Time: time.Now().AddDate(-5, 0, 0), Name: "old"})
+	if entries, total := m.DownloadHistory(HistoryQuery{}); total != 1 || entries[0].Outcome != OutcomeCancelled {
+		t.Errorf("history = %+v, want the cancelled download", entries)
+	}
+}
+
+func TestDownloadHistoryQuery(t *testing.T) {
+	now := time.Now()
+	m := &Manager{records: newDownloadRecords("", 0)}
+	m.records.entries = []HistoryEntry{
+		{Time: now.Add(-5 * time.Hour), Name: "Old Show", Category: "tv", Outcome: OutcomeCompleted},
+		{Time: now.Add(-4 * time.Hour), Name: "Movie", Category: "movies", Outcome: OutcomeFailed, RequestedBy: "alice"},
+		{Time: now.Add(-3 * time.Hour), Name: "New Show", Category: "tv", Outcome: OutcomeCompleted, RequestedBy: "alice"},
+		{Time: now.Add(-2 * time.Hour), Name: "Album", Outcome: OutcomeCancelled},
+		{Time: now.Add(-time.Hour), Name: "Another show", Category: "tv", Outcome: OutcomeCompleted},
+	}
+
+	for _, tt := range []struct {
+		name  string
+		query HistoryQuery
+		want  []string
+		total int
+	}{
+		{"all, newest first", HistoryQuery{}, []string{"Another show", "Album", "New Show", "Movie", "Old Show"}, 5},
+		{"outcome", HistoryQuery{Outcome: OutcomeCompleted}, []string{"Another show", "New Show", "Old Show"}, 3},
+		{"category", HistoryQuery{Category: "movies"}, []string{"Movie"}, 1},
+		{"user", HistoryQuery{RequestedBy: "alice"}, []string{"New Show", "Movie"}, 2},
+		{"search ignores case", HistoryQuery{Search: "SHOW"}, []string{"Another show", "New Show", "Old Show"}, 3},
+		{"since", HistoryQuery{Since: now.Add(-3 * time.Hour)}, []string{"Another show", "Album", "New Show"}, 3},
+		{"combined", HistoryQuery{Category: "tv", Since: now.Add(-4 * time.Hour), Search: "show"}, []string{"Another show", "New Show"}, 2},
+		{"page", HistoryQuery{Limit: 2, Offset: 1}, []string{"Album", "New Show"}, 5},
+		{"last page", HistoryQuery{Limit: 2, Offset: 4}, []string{"Old Show"}, 5},
+		{"beyond the last page", HistoryQuery{Limit: 2, Offset: 10}, []string{}, 5},
+		{"nothing matches", HistoryQuery{Search: "nothing"}, []string{}, 0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, total := m.DownloadHistory(tt.query)
+			if got := historyNames(entries); !reflect.DeepEqual(got, tt.want) || total != tt.total {
+				t.Errorf("history = %v of %d, want %v of %d", got, total, tt.want, tt.total)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package download
+
+import (
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/cron"
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// downloadWindows parses the configured download windows, leaving out
+// invalid ones
+func (m *Manager) downloadWindows() []timeWindow {
+	var windows []timeWindow
+	for _, window := range m.cfg.DownloadWindows {
+		schedule, err := cron.Parse(window.Start)
+		if err != nil || window.Duration <= 0 {
+			log.Error("schedule").
+				Str("start", window.Start).
+				Dur("duration", window.Duration).
+				Err(err).
+				Msg("Ignoring invalid download window")
+			continue
+		}
+		windows = append(windows, timeWindow{start: schedule, duration: window.Duration})
+	}
+	return windows
+}
+
+// nextWindowStart returns when the first of the windows begins after now
+func nextWindowStart(windows []timeWindow, now time.Time) time.Time {
+	var next time.Time
+	for _, window := range windows {
+		if start := window.start.Next(now); !start.IsZero() && (next.IsZero() || start.Before(next)) {
+			next = start
+		}
+	}
+	return next
+}
+
+// enforceDownloadWindows holds back downloads while no download window is
+// open and queues them once one opens. Downloads already running when a
+// window closes are finished.
+func (m *Manager) enforceDownloadWindows() {
+	windows := m.downloadWindows()
+	if len(windows) == 0 {
+		return
+	}
+
+	check := func(now time.Time) {
+		for _, window := range windows {
+			if window.active(now) {
+				m.openDownloadWindow()
+				return
+			}
+		}
+		m.closeDownloadWindow(nextWindowStart(windows, now))
+	}
+
+	check(time.Now())
+	ticker := time.NewTicker(m.dlConfig.WindowCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stopChan:
+			return
+		case now := <-ticker.C:
+			check(now)
+		}
+	}
+}
+
+// closeDownloadWindow holds back downloads that have not started yet until
+// the next download window opens at next
+func (m *Manager) closeDownloadWindow(next time.Time) {
+	m.pauseMu.Lock()
+	closed := m.windowClosed
+	m.windowClosed = true
+	m.windowOpensAt = next
+	m.pauseMu.Unlock()
+	if closed {
+		return
+	}
+
+	log.Info("schedule").Time("next_window", next).Msg("Outside of download windows, new downloads wait")
+}
+
+// openDownloadWindow queues the downloads held back outside of download
+// windows again
+func (m *Manager) openDownloadWindow() {
+	m.pauseMu.Lock()
+	if !m.windowClosed {
+		m.pauseMu.Unlock()
+		return
+	}
+	m.windowClosed = false
+	m.windowOpensAt = time.Time{}
+	jobs := m.windowJobs
+	m.windowJobs = nil
+	m.pauseMu.Unlock()
+
+	// Jobs of transfers paused in the meantime are held back again by the workers
+	for _, job := range jobs {
+		m.requeue(job)
+	}
+
+	log.Info("schedule").Int("jobs", len(jobs)).Msg("Download window opened, starting downloads")
+}
+
+// ScheduledUntil returns when the downloads of a transfer held back outside
+// of download windows start, or false if none of them waits for a window
+func (m *Manager) ScheduledUntil(transferID int64) (time.Time, bool) {
+	m.pauseMu.Lock()
+	defer m.pauseMu.Unlock()
+	if !m.windowClosed {
+		return time.Time{}, false
+	}
+	for _, job := range m.windowJobs {
+		if job.TransferID == transferID {
+			return m.windowOpensAt, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -1,13 +1,44 @@
 package download
 
 import (
+	"errors"
 	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"github.com/elsbrock/go-putio"
+	"github.com/elsbrock/plundrio/internal/provider"
+)
+
+// Error codes classify failures of transfers and files. Unlike error messages
+// they are stable, so API clients can branch on them.
+const (
+	ErrorCodeRemoteGone       = "remote-gone"       // the file no longer exists on put.io
+	ErrorCodeRemoteFailed     = "remote-failed"     // put.io failed to fetch the transfer
+	ErrorCodeDiskFull         = "disk-full"         // not enough space in the target directory
+	ErrorCodeChecksumMismatch = "checksum-mismatch" // the downloaded data is corrupt
+	ErrorCodeVerifyFailed     = "verify-failed"     // downloaded files are missing or incomplete
+	ErrorCodeRateLimited      = "rate-limited"      // put.io refused too many requests
+	ErrorCodeAria2Missing     = "aria2-missing"     // aria2c is not installed
+	ErrorCodeAuthFailed       = "auth-failed"       // the put.io token was rejected
+	ErrorCodeURLExpired       = "url-expired"       // the download URL expired too often
+	ErrorCodeNetwork          = "network"           // connecting to or downloading from put.io failed
+	ErrorCodeFilesystem       = "filesystem"        // writing the file failed
+	ErrorCodePathCollision    = "path-collision"    // another transfer downloads to the same path
+	ErrorCodeCancelled        = "cancelled"
+	ErrorCodeUnknown          = "unknown"
 )
 
 // DownloadError is the base error type for download-related errors
 type DownloadError struct {
-	Type    string
-	Message string
+	Type      string
+	Code      string // one of the ErrorCode constants
+	Message   string
+	Transient bool // Retrying the download may succeed
 }
 
 // Error implements the error interface
@@ -19,14 +50,45 @@ func (e *DownloadError) Error() string {
 func NewDownloadCancelledError(filename, reason string) error {
 	return &DownloadError{
 		Type:    "DownloadCancelled",
+		Code:    ErrorCodeCancelled,
 		Message: fmt.Sprintf("Download of %s was cancelled: %s", filename, reason),
 	}
 }
 
+// NewFileMissingError creates a new error for files that no longer exist on Put.io
+func NewFileMissingError(filename string) error {
+	return &DownloadError{
+		Type:    "FileMissing",
+		Code:    ErrorCodeRemoteGone,
+		Message: fmt.Sprintf("%s no longer exists on Put.io", filename),
+	}
+}
+
+// NewPathCollisionError creates a new error for files left out because another
+// transfer downloads to the same local path
+func NewPathCollisionError(filename string) error {
+	return &DownloadError{
+		Type:    "PathCollision",
+		Code:    ErrorCodePathCollision,
+		Message: fmt.Sprintf("Another transfer downloads to %s", filename),
+	}
+}
+
+// NewURLExpiredError creates a new error for downloads whose Put.io download URL expired
+func NewURLExpiredError(filename string) error {
+	return &DownloadError{
+		Type:      "URLExpired",
+		Code:      ErrorCodeURLExpired,
+		Message:   fmt.Sprintf("Download URL of %s expired", filename),
+		Transient: true,
+	}
+}
+
 // NewTransferNotFoundError creates a new error for transfer not found situations
 func NewTransferNotFoundError(transferID int64) error {
 	return &DownloadError{
 		Type:    "TransferNotFound",
+		Code:    ErrorCodeUnknown,
 		Message: fmt.Sprintf("Transfer ID %d not found", transferID),
 	}
 }
@@ -35,6 +97,175 @@ func NewTransferNotFoundError(transferID int64) error {
 func NewNoFilesFoundError(transferID int64) error {
 	return &DownloadError{
 		Type:    "NoFilesFound",
+		Code:    ErrorCodeRemoteGone,
 		Message: fmt.Sprintf("No files found for transfer %d", transferID),
 	}
 }
+
+// NewAria2cError creates a new error for an aria2c download that failed with
+// the given error code
+func NewAria2cError(filename string, errorCode int) error {
+	code, ok := aria2cExitCodes[errorCode]
+	if !ok {
+		code = aria2cExitCodes[1]
+	}
+	return &DownloadError{
+		Type:      code.Type,
+		Code:      code.Code,
+		Message:   fmt.Sprintf("aria2c could not download %s: %s (error code %d)", filename, code.Message, errorCode),
+		Transient: code.Transient,
+	}
+}
+
+// NewRateLimitedError creates a new error for downloads put.io refused because
+// of too many requests
+func NewRateLimitedError(filename string) error {
+	return &DownloadError{
+		Type:      "RateLimited",
+		Code:      ErrorCodeRateLimited,
+		Message:   fmt.Sprintf("Put.io refused to serve %s: too many requests", filename),
+		Transient: true,
+	}
+}
+
+// NewHTTPStatusError creates a new error for downloads the server answered
+// with an unexpected HTTP status
+func NewHTTPStatusError(filename string, status int) error {
+	switch status {
+	case http.StatusForbidden:
+		// Put.io refuses expired download URLs
+		return NewURLExpiredError(filename)
+	case http.StatusTooManyRequests:
+		return NewRateLimitedError(filename)
+	case http.StatusNotFound, http.StatusGone:
+		return &DownloadError{
+			Type:    "ResourceNotFound",
+			Code:    ErrorCodeRemoteGone,
+			Message: fmt.Sprintf("Server could not find %s (HTTP %d)", filename, status),
+		}
+	case http.StatusUnauthorized:
+		return &DownloadError{
+			Type:    "AuthFailed",
+			Code:    ErrorCodeAuthFailed,
+			Message: fmt.Sprintf("Server refused to serve %s without authorization (HTTP %d)", filename, status),
+		}
+	}
+	return &DownloadError{
+		Type:      "ServerError",
+		Code:      ErrorCodeNetwork,
+		Message:   fmt.Sprintf("Unexpected response downloading %s (HTTP %d)", filename, status),
+		Transient: status >= 500 || status == http.StatusRequestTimeout,
+	}
+}
+
+// NewNetworkError creates a new error for downloads that failed because a
+// connection to the server failed
+func NewNetworkError(filename string, err error) error {
+	return &DownloadError{
+		Type:      "NetworkProblem",
+		Code:      ErrorCodeNetwork,
+		Message:   fmt.Sprintf("Downloading %s failed: %v", filename, err),
+		Transient: true,
+	}
+}
+
+// NewFileSystemError creates a new error for downloads that could not be
+// written to disk
+func NewFileSystemError(filename string, err error) error {
+	if errors.Is(err, syscall.ENOSPC) {
+		return &DownloadError{
+			Type:    "DiskFull",
+			Code:    ErrorCodeDiskFull,
+			Message: fmt.Sprintf("Not enough disk space for %s: %v", filename, err),
+		}
+	}
+	return &DownloadError{
+		Type:    "FileSystemError",
+		Code:    ErrorCodeFilesystem,
+		Message: fmt.Sprintf("Writing %s failed: %v", filename, err),
+	}
+}
+
+// NewChecksumMismatchError creates a new error for downloads whose size or
+// checksum differs from what the provider reports
+func NewChecksumMismatchError(filename, detail string) error {
+	return &DownloadError{
+		Type:      "ChecksumMismatch",
+		Code:      ErrorCodeChecksumMismatch,
+		Message:   fmt.Sprintf("%s is corrupt: %s", filename, detail),
+		Transient: true,
+	}
+}
+
+// NewShortWriteError creates a new error for downloads whose data did not
+// fully arrive on a network filesystem
+func NewShortWriteError(filename, detail string) error {
+	return &DownloadError{
+		Type:      "ShortWrite",
+		Code:      ErrorCodeVerifyFailed,
+		Message:   fmt.Sprintf("%s was not written completely: %s", filename, detail),
+		Transient: true,
+	}
+}
+
+// NewVerifyFailedError creates a new error for files that keep failing
+// verification after being downloaded
+func NewVerifyFailedError(files int32, attempts int) error {
+	return &DownloadError{
+		Type:    "VerifyFailed",
+		Code:    ErrorCodeVerifyFailed,
+		Message: fmt.Sprintf("%d files failed verification %d times", files, attempts),
+	}
+}
+
+// ErrorCode classifies an error into one of the ErrorCode constants, or
+// returns an empty string for no error
+func ErrorCode(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	var downloadErr *DownloadError
+	if errors.As(err, &downloadErr) && downloadErr.Code != "" {
+		return downloadErr.Code
+	}
+	var putioErr *putio.ErrorResponse
+	if errors.As(err, &putioErr) && putioErr.Response != nil {
+		switch putioErr.Response.StatusCode {
+		case 401, 403:
+			return ErrorCodeAuthFailed
+		case 404:
+			return ErrorCodeRemoteGone
+		case 429:
+			return ErrorCodeRateLimited
+		}
+	}
+
+	switch {
+	case errors.Is(err, exec.ErrNotFound):
+		return ErrorCodeAria2Missing
+	case errors.Is(err, provider.ErrFileNotFound):
+		return ErrorCodeRemoteGone
+	case errors.Is(err, syscall.ENOSPC):
+		return ErrorCodeDiskFull
+	case errors.Is(err, os.ErrPermission):
+		return ErrorCodeFilesystem
+	}
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		return ErrorCodeFilesystem
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return ErrorCodeNetwork
+	}
+
+	message := err.Error()
+	switch {
+	case strings.Contains(message, "429"):
+		return ErrorCodeRateLimited
+	case strings.Contains(message, "401") || strings.Contains(message, "authentication failed"):
+		return ErrorCodeAuthFailed
+	}
+	return ErrorCodeUnknown
+}
@@ -0,0 +1,240 @@
+package download
+
+import (
+	"sync"
+	"time"
+
+	"github.com/elsbrock/go-putio"
+)
+
+// speedWindowLength is how far back speeds are averaged for estimates. Long
+// enough to smooth out aria2c's and put.io's jumpy readings, short enough to
+// follow a real change of speed within a few minutes.
+const speedWindowLength = 2 * time.Minute
+
+// speedSample is a speed in bytes per second measured at a point in time
+type speedSample struct {
+	at    time.Time
+	speed float64
+}
+
+// speedWindow averages the speeds measured over the last speedWindowLength
+type speedWindow struct {
+	samples []speedSample
+}
+
+// add records a speed and drops samples that fell out of the window
+func (w *speedWindow) add(now time.Time, speed float64) {
+	w.samples = append(w.samples, speedSample{at: now, speed: speed})
+	w.trim(now)
+}
+
+// trim drops the samples that fell out of the window
+func (w *speedWindow) trim(now time.Time) {
+	i := 0
+	for i < len(w.samples) && now.Sub(w.samples[i].at) > speedWindowLength {
+		i++
+	}
+	w.samples = w.samples[i:]
+}
+
+// average returns the average speed over the window, or false without
+// samples. A nil window has no samples.
+func (w *speedWindow) average(now time.Time) (float64, bool) {
+	if w == nil {
+		return 0, false
+	}
+	w.trim(now)
+	if len(w.samples) == 0 {
+		return 0, false
+	}
+	var sum float64
+	for _, s := range w.samples {
+		sum += s.speed
+	}
+	return sum / float64(len(w.samples)), true
+}
+
+// speedModel keeps windowed speeds of both halves of a transfer: put.io
+// fetching the torrent and plundrio downloading its files
+type speedModel struct {
+	mu      sync.Mutex
+	cloud   map[int64]*speedWindow // transfer ID -> put.io's download speed
+	local   map[int64]*speedWindow // transfer ID -> local download speed
+	overall speedWindow            // local download speed of all transfers, while any downloads
+}
+
+// sample records the speed of each transfer in speeds and forgets transfers
+// without recent samples
+func sample(windows map[int64]*speedWindow, now time.Time, speeds map[int64]float64) {
+	for id, speed := range speeds {
+		w, ok := windows[id]
+		if !ok {
+			w = &speedWindow{}
+			windows[id] = w
+		}
+		w.add(now, speed)
+	}
+	for id, w := range windows {
+		if w.trim(now); len(w.samples) == 0 {
+			delete(windows, id)
+		}
+	}
+}
+
+// sampleCloudSpeeds records put.io's download speed of the transfers it is fetching
+func (m *Manager) sampleCloudSpeeds(transfers []*putio.Transfer) {
+	speeds := make(map[int64]float64)
+	for _, t := range transfers {
+		if t.Status == "DOWNLOADING" {
+			speeds[t.ID] = float64(t.DownloadSpeed)
+		}
+	}
+
+	m.speeds.mu.Lock()
+	defer m.speeds.mu.Unlock()
+	if m.speeds.cloud == nil {
+		m.speeds.cloud = make(map[int64]*speedWindow)
+	}
+	sample(m.speeds.cloud, time.Now(), speeds)
+}
+
+// sampleLocalSpeedsPeriodically records the local download speed of each
+// transfer for estimates
+func (m *Manager) sampleLocalSpeedsPeriodically() {
+	ticker := time.NewTicker(m.dlConfig.ProgressUpdateInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stopChan:
+			return
+		case now := <-ticker.C:
+			speeds := m.transferSpeeds()
+
+			m.speeds.mu.Lock()
+			if m.speeds.local == nil {
+				m.speeds.local = make(map[int64]*speedWindow)
+			}
+			sample(m.speeds.local, now, speeds)
+			if len(speeds) > 0 {
+				var total float64
+				for _, speed := range speeds {
+					total += speed
+				}
+				m.speeds.overall.add(now, total)
+			}
+			m.speeds.mu.Unlock()
+		}
+	}
+}
+
+// EstimateTimeLeft returns how long a transfer still takes, with cloudLeft
+// bytes left for the provider to fetch and localLeft bytes left to download
+// afterwards, or false if there is nothing to estimate from. Each half uses
+// the speed averaged over the last minutes; the provider's own estimate
+// stands in until its speed was sampled, and the local half of transfers
+// that are not downloading yet assumes the speed recent downloads reached.
+func (m *Manager) EstimateTimeLeft(t *putio.Transfer, cloudLeft, localLeft int64) (time.Duration, bool) {
+	now := time.Now()
+	m.speeds.mu.Lock()
+	defer m.speeds.mu.Unlock()
+
+	var left time.Duration
+	if cloudLeft > 0 {
+		if speed, ok := m.speeds.cloud[t.ID].average(now); ok && speed > 0 {
+			left += time.Duration(float64(cloudLeft) / speed * float64(time.Second))
+		} else if t.EstimatedTime > 0 {
+			left += time.Duration(t.EstimatedTime) * time.Second
+		} else {
+			return 0, false
+		}
+	}
+
+	if localLeft > 0 {
+		speed, ok := m.speeds.local[t.ID].average(now)
+		if !ok || speed <= 0 {
+			speed, ok = m.speeds.overall.average(now)
+		}
+		if !ok || speed <= 0 {
+			return 0, false
+		}
+		left += time.Duration(float64(localLeft) / speed * float64(time.Second))
+	}
+	return left.Round(time.Second), true
+}
+
+// QueueEstimate sums up what is left of all transfers
+type QueueEstimate struct {
+	Speed       float64       // current local download speed of all transfers, bytes per second
+	QueuedBytes int64         // bytes left to download, including transfers put.io still fetches
+	Transfers   int           // transfers with bytes left
+	TimeLeft    time.Duration // time until the whole queue is downloaded
+	Known       bool          // whether TimeLeft could be estimated
+}
+
+// EstimateQueue returns the combined speed, the bytes left and how long the
+// whole queue still takes. The queue is done once its bytes are downloaded
+// at the speed recent downloads reached, but not before put.io fetched the
+// transfer it takes longest for plus the local download of that transfer.
+func (m *Manager) EstimateQueue() QueueEstimate {
+	var q QueueEstimate
+	for _, speed := range m.transferSpeeds() {
+		q.Speed += speed
+	}
+
+	tracked := make(map[int64]bool)
+	m.coordinator.GetAllTransfers(func(ctx *TransferContext) {
+		ctx.Mu.RLock()
+		defer ctx.Mu.RUnlock()
+		tracked[ctx.ID] = true
+		switch ctx.State {
+		case TransferLifecycleInitial, TransferLifecycleDownloading:
+			if left := ctx.TotalSize - ctx.DownloadedSize; left > 0 {
+				q.QueuedBytes += left
+				q.Transfers++
+			}
+		}
+	})
+
+	// Transfers put.io is still fetching, or finished but not downloaded yet
+	var cloud []*putio.Transfer
+	if processor := m.GetTransferProcessor(); processor != nil {
+		for _, t := range processor.GetTransfers() {
+			if tracked[t.ID] || t.Status == "ERROR" || t.Size <= 0 {
+				continue
+			}
+			if _, processed := processor.processedTransfers.Load(t.ID); processed {
+				continue
+			}
+			q.QueuedBytes += int64(t.Size)
+			q.Transfers++
+			cloud = append(cloud, t)
+		}
+	}
+
+	if q.QueuedBytes == 0 {
+		q.Known = true
+		return q
+	}
+	m.speeds.mu.Lock()
+	speed, ok := m.speeds.overall.average(time.Now())
+	m.speeds.mu.Unlock()
+	if !ok || speed <= 0 {
+		return q
+	}
+	q.TimeLeft = time.Duration(float64(q.QueuedBytes) / speed * float64(time.Second))
+	q.Known = true
+
+	for _, t := range cloud {
+		cloudLeft := int64(t.Size) - t.Downloaded
+		if cloudLeft <= 0 {
+			continue
+		}
+		if left, ok := m.EstimateTimeLeft(t, cloudLeft, int64(t.Size)); ok && left > q.TimeLeft {
+			q.TimeLeft = left
+		}
+	}
+	q.TimeLeft = q.TimeLeft.Round(time.Second)
+	return q
+}
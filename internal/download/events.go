@@ -0,0 +1,121 @@
+package download
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/events"
+)
+
+// Events returns the bus transfer, file and system events are published on
+func (m *Manager) Events() *events.Bus {
+	return m.events
+}
+
+// History returns recent transfer events, oldest first
+func (m *Manager) History() []events.Event {
+	return m.history.Events()
+}
+
+// historyTypes are the events kept in the recent history
+var historyTypes = map[events.Type]bool{
+	events.TransferAdded:      true,
+	events.TransferCompleted:  true,
+	events.TransferFailed:     true,
+	events.TransferErrored:    true,
+	events.TransferImported:   true,
+	events.TransferRemoved:    true,
+	events.TransferPaused:     true,
+	events.TransferResumed:    true,
+	events.TransferCancelled:  true,
+	events.TransferSlow:       true,
+	events.TransferReconciled: true,
+}
+
+// publish records an event, then sends it to the subscribers of the event
+// bus. The bus drops events for subscribers that fall behind, so the state
+// plundrio keeps is updated here before publishing rather than by
+// subscribers.
+func (m *Manager) publish(event events.Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	m.record(event)
+	m.events.Publish(event)
+}
+
+// Publish records and publishes an event that happened outside the manager,
+// such as a transfer removed through the RPC interface
+func (m *Manager) Publish(event events.Event) {
+	m.publish(event)
+}
+
+// record updates the event history, the download history, the monthly usage
+// of API users and the saved queue
+func (m *Manager) record(event events.Event) {
+	if historyTypes[event.Type] {
+		m.history.Record(event)
+	}
+	switch event.Type {
+	case events.TransferCompleted:
+		m.recordUsage(event)
+		m.recordDownload(event)
+		m.forgetSaved(event)
+	case events.TransferFailed:
+		m.recordDownload(event)
+	case events.TransferCancelled:
+		m.recordDownload(event)
+		m.forgetSaved(event)
+	case events.TransferQuarantined, events.TransferRemoved:
+		m.forgetSaved(event)
+	}
+}
+
+// transferEvent builds an event from a transfer context.
+// The caller must hold ctx.Mu.
+func (m *Manager) transferEvent(ctx *TransferContext, eventType events.Type, err error) events.Event {
+	event := events.Event{
+		Type:       eventType,
+		TransferID: ctx.ID,
+		Name:       ctx.Name,
+		Category:   m.Category(ctx.ID),
+		Path:       filepath.Join(m.TargetDir(ctx.ID), ctx.Name),
+		Size:       ctx.TotalSize,
+	}
+	if ctx.Transfer != nil {
+		event.Hash = ctx.Transfer.Hash
+	}
+	if note, ok := m.Annotation(ctx.ID); ok {
+		event.Notes = note.Notes
+		event.Metadata = note.Metadata
+		event.RequestedBy = note.RequestedBy
+	}
+	if !ctx.StartTime.IsZero() {
+		event.Duration = time.Since(ctx.StartTime)
+		if seconds := event.Duration.Seconds(); seconds > 0 {
+			event.Speed = float64(ctx.DownloadedSize) / seconds
+		}
+	}
+	if err != nil {
+		event.Error = err.Error()
+		event.ErrorCode = ErrorCode(err)
+	}
+	return event
+}
+
+// fileEvent builds an event for a single file of a transfer
+func (m *Manager) fileEvent(eventType events.Type, job downloadJob, err error) events.Event {
+	event := events.Event{
+		Type:       eventType,
+		TransferID: job.TransferID,
+		FileID:     job.FileID,
+		FileName:   job.Name,
+		Path:       filepath.Join(m.TargetDir(job.TransferID), job.Name),
+		Size:       job.Size,
+	}
+	if err != nil {
+		event.Error = err.Error()
+		event.ErrorCode = ErrorCode(err)
+	}
+	return event
+}
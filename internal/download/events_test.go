@@ -0,0 +1,78 @@
+package download
+
+import (
+	"testing"
+
+	"github.com/elsbrock/plundrio/internal/events"
+	"github.com/elsbrock/plundrio/internal/state"
+)
+
+func TestPublishRecordsEveryEvent(t *testing.T) {
+	dir := t.TempDir()
+	m := &Manager{
+		events:  events.NewBus(),
+		history: events.NewRecorder(2000),
+		quotas:  newQuotas(dir),
+		records: newDownloadRecords(dir, 30),
+		saved:   newSavedQueue(dir),
+	}
+	defer m.saved.close()
+
+	// A subscriber that never reads has events dropped once its buffer is
+	// full, which must not affect what is recorded
+	stalled := m.events.Subscribe("stalled", events.TransferCompleted)
+	defer stalled.Close()
+
+	const n = 1000
+	m.saved.update(func(tx *state.Tx) error {
+		for id := int64(1); id <= n; id++ {
+			if err := tx.Put(queueTransfers, state.Key(id), SavedTransfer{}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	for id := int64(1); id <= n; id++ {
+		m.publish(events.Event{Type: events.TransferCompleted, TransferID: id, Size: 10, RequestedBy: "alice"})
+	}
+
+	if got := len(m.History()); got != n {
+		t.Errorf("history has %d events, want %d", got, n)
+	}
+	if _, total := m.DownloadHistory(HistoryQuery{}); total != n {
+		t.Errorf("download history has %d entries, want %d", total, n)
+	}
+	if got := m.MonthlyUsage("alice"); got != n*10 {
+		t.Errorf("monthly usage = %d, want %d", got, n*10)
+	}
+	if saved := m.saved.load(); len(saved) != 0 {
+		t.Errorf("%d transfers are still saved, want none", len(saved))
+	}
+	if got := len(stalled.Events()); got != cap(stalled.Events()) {
+		t.Errorf("stalled subscriber has %d events, want a full buffer of %d", got, cap(stalled.Events()))
+	}
+}
+
+func TestRecordSkipsEventsOutsideTheHistory(t *testing.T) {
+	dir := t.TempDir()
+	m := &Manager{
+		events:  events.NewBus(),
+		history: events.NewRecorder(10),
+		quotas:  newQuotas(dir),
+		records: newDownloadRecords(dir, 30),
+		saved:   newSavedQueue(""),
+	}
+
+	m.publish(events.Event{Type: events.FileCompleted, TransferID: 1})
+	m.publish(events.Event{Type: events.TransferFailed, TransferID: 2})
+	m.publish(events.Event{Type: events.TransferQuarantined, TransferID: 3})
+
+	history := m.History()
+	if len(history) != 1 || history[0].Type != events.TransferFailed {
+		t.Errorf("history = %v, want only the failed transfer", history)
+	}
+	entries, _ := m.DownloadHistory(HistoryQuery{})
+	if len(entries) != 1 || entries[0].Outcome != OutcomeFailed || entries[0].Time.IsZero() {
+		t.Errorf("download history = %+v, want one failed download with its time", entries)
+	}
+}
@@ -0,0 +1,163 @@
+package download
+
+import (
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/log"
+	"github.com/elsbrock/plundrio/internal/state"
+)
+
+// ExistingState is the name of the state document recording that the files
+// already in the target directory were indexed
+const ExistingState = "existing"
+
+// ExistingScan records the scan of the target directory on the first start
+type ExistingScan struct {
+	ScannedAt time.Time `json:"scanned_at"`
+	Dir       string    `json:"dir"`
+	Files     int       `json:"files"`
+}
+
+// existingKey identifies local files that may be a file at the provider
+type existingKey struct {
+	name string // base name
+	size int64
+}
+
+// existingFiles indexes the files found in the target directory on the first
+// start, e.g. downloaded by rclone or by hand, so that files of transfers
+// already there are adopted instead of downloaded again
+type existingFiles struct {
+	mu    sync.Mutex
+	files map[existingKey][]string // local paths by base name and size
+}
+
+// scanExisting indexes the files in the target directory unless an earlier
+// run did so already. It returns nil if there is nothing to adopt.
+func (m *Manager) scanExisting() *existingFiles {
+	if !m.cfg.ImportExisting || m.cfg.StateDir == "" {
+		return nil
+	}
+	store, err := state.New(m.cfg.StateDir)
+	if err != nil {
+		log.Warn("download").Err(err).Msg("Not importing existing files")
+		return nil
+	}
+	var scan ExistingScan
+	if err := store.Load(ExistingState, &scan); err != nil {
+		log.Warn("download").Err(err).Msg("Not importing existing files")
+		return nil
+	}
+	if !scan.ScannedAt.IsZero() {
+		return nil
+	}
+
+	dir := m.DefaultTargetDir()
+	existing := &existingFiles{files: make(map[existingKey][]string)}
+	count := 0
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !d.Type().IsRegular() {
+			return nil
+		}
+		for _, suffix := range controlSuffixes {
+			if strings.HasSuffix(path, suffix) {
+				return nil
+			}
+		}
+		if isPartial(path) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		key := existingKey{name: d.Name(), size: info.Size()}
+		existing.files[key] = append(existing.files[key], path)
+		count++
+		return nil
+	})
+
+	// The index is only built once, transfers listed in this run use it
+	scan = ExistingScan{ScannedAt: time.Now(), Dir: dir, Files: count}
+	if err := store.Save(ExistingState, scan); err != nil {
+		log.Warn("download").Err(err).Msg("Failed to save scan of existing files")
+	}
+	log.Info("download").
+		Str("dir", dir).
+		Int("files", count).
+		Msg("Indexed existing files to import")
+	if count == 0 {
+		return nil
+	}
+	return existing
+}
+
+// fileCRC32 returns the CRC32 checksum of a file as put.io reports it
+func fileCRC32(path string) (string, error) {
+	file, err := os.Open(longPath(path))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := crc32.NewIEEE()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%08x", hash.Sum32()), nil
+}
+
+// adoptExisting links a file found in the target directory on the first
+// start into the local path of a job if it has the same name and size, and
+// the same CRC32 checksum if the provider reports one. It reports whether
+// the job no longer needs to be downloaded.
+func (m *Manager) adoptExisting(job downloadJob) bool {
+	if m.existing == nil {
+		return false
+	}
+	target := m.jobPath(job)
+	m.existing.mu.Lock()
+	candidates := m.existing.files[existingKey{name: filepath.Base(job.Name), size: job.Size}]
+	m.existing.mu.Unlock()
+
+	for _, path := range candidates {
+		if path == target {
+			continue
+		}
+		if job.CRC32 != "" {
+			sum, err := fileCRC32(path)
+			if err != nil || !strings.EqualFold(sum, job.CRC32) {
+				continue
+			}
+		}
+
+		if err := os.MkdirAll(longPath(filepath.Dir(target)), 0755); err != nil {
+			log.Warn("download").Str("file_name", job.Name).Err(err).Msg("Failed to import existing file")
+			return false
+		}
+		if err := linkPath(path, target); err != nil {
+			log.Warn("download").
+				Str("file_name", job.Name).
+				Str("existing", path).
+				Err(err).
+				Msg("Failed to import existing file")
+			return false
+		}
+		log.Info("download").
+			Str("file_name", job.Name).
+			Int64("transfer_id", job.TransferID).
+			Str("existing", path).
+			Bool("crc32_checked", job.CRC32 != "").
+			Msg("Imported existing file instead of downloading it")
+		return true
+	}
+	return false
+}
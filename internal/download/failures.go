@@ -0,0 +1,269 @@
+package download
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/elsbrock/go-putio"
+	"github.com/elsbrock/plundrio/internal/log"
+	"github.com/elsbrock/plundrio/internal/state"
+)
+
+// FailuresState is the name of the state document the files that failed to
+// download are kept in
+const FailuresState = "failures"
+
+// maxFailures is how many failed files are kept; the oldest are dropped first
+const maxFailures = 1000
+
+// Failure is a file that failed to download after all its attempts. It is
+// kept until the file is downloaded, so that it can be retried even after
+// its transfer is no longer tracked.
+type Failure struct {
+	Time         time.Time `json:"time"` // when the file failed last
+	TransferID   int64     `json:"transfer_id"`
+	TransferName string    `json:"transfer_name"`
+	FileID       int64     `json:"file_id"`
+	Name         string    `json:"name"` // path relative to the target directory
+	Size         int64     `json:"size"`
+	CRC32        string    `json:"crc32,omitempty"`
+	TargetDir    string    `json:"target_dir"`
+	Error        string    `json:"error"`
+	ErrorCode    string    `json:"error_code,omitempty"`
+	Attempts     int       `json:"attempts"` // times the file failed
+	Retrying     bool      `json:"retrying"` // queued again since it failed last
+}
+
+// Failures lists the files that failed to download, oldest first
+type Failures struct {
+	Files []Failure `json:"files"`
+}
+
+// failureList keeps the files that failed to download
+type failureList struct {
+	mu    sync.Mutex
+	store *state.Store // nil without a state directory
+	files []Failure
+}
+
+// newFailureList loads the files that failed to download in earlier runs from
+// the state directory
+func newFailureList(stateDir string) *failureList {
+	f := &failureList{}
+	if stateDir == "" {
+		return f
+	}
+
+	store, err := state.New(stateDir)
+	if err != nil {
+		log.Warn("failures").Err(err).Msg("Failed files will not be remembered")
+		return f
+	}
+	f.store = store
+
+	var saved Failures
+	if err := store.Load(FailuresState, &saved); err != nil {
+		log.Warn("failures").Err(err).Msg("Failed to load failed files")
+		return f
+	}
+	f.files = saved.Files
+	// Downloads queued again did not survive the restart
+	for i := range f.files {
+		f.files[i].Retrying = false
+	}
+	return f
+}
+
+// record adds a file that failed to download, or updates it if it failed
+// before
+func (f *failureList) record(failure Failure) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if i := slices.IndexFunc(f.files, func(file Failure) bool { return file.FileID == failure.FileID }); i >= 0 {
+		failure.Attempts += f.files[i].Attempts
+		f.files = slices.Delete(f.files, i, i+1)
+	}
+	f.files = append(f.files, failure)
+	if len(f.files) > maxFailures {
+		f.files = slices.Delete(f.files, 0, len(f.files)-maxFailures)
+	}
+	f.save()
+}
+
+// remove drops a file that was downloaded after all
+func (f *failureList) remove(fileID int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	before := len(f.files)
+	f.files = slices.DeleteFunc(f.files, func(file Failure) bool { return file.FileID == fileID })
+	if len(f.files) != before {
+		f.save()
+	}
+}
+
+// retrying marks files as queued again
+func (f *failureList) retrying(fileIDs []int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i := range f.files {
+		if slices.Contains(fileIDs, f.files[i].FileID) {
+			f.files[i].Retrying = true
+		}
+	}
+	f.save()
+}
+
+// list returns the failed files, all of them if fileIDs is empty
+func (f *failureList) list(fileIDs []int64) []Failure {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	files := make([]Failure, 0, len(f.files))
+	for _, file := range f.files {
+		if len(fileIDs) == 0 || slices.Contains(fileIDs, file.FileID) {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// save writes the failed files to the state directory. The caller must hold
+// mu.
+func (f *failureList) save() {
+	if f.store == nil {
+		return
+	}
+	if err := f.store.Save(FailuresState, Failures{Files: f.files}); err != nil {
+		log.Warn("failures").Err(err).Msg("Failed to save failed files")
+	}
+}
+
+// recordFailure remembers a file that failed to download after all its
+// attempts
+func (m *Manager) recordFailure(job downloadJob, transferName string, err error) {
+	failure := Failure{
+		Time:         time.Now(),
+		TransferID:   job.TransferID,
+		TransferName: transferName,
+		FileID:       job.FileID,
+		Name:         job.Name,
+		Size:         job.Size,
+		CRC32:        job.CRC32,
+		TargetDir:    m.TargetDir(job.TransferID),
+		ErrorCode:    ErrorCode(err),
+		Attempts:     1,
+	}
+	if err != nil {
+		failure.Error = err.Error()
+	}
+	m.failures.record(failure)
+}
+
+// Failures returns the files that failed to download, oldest first
+func (m *Manager) Failures() []Failure {
+	return m.failures.list(nil)
+}
+
+// RetryFailures downloads files that failed to download again, all of them if
+// fileIDs is empty. Files of transfers that are still tracked are retried
+// with their transfer, others are queued like files queued by hand under the
+// ID of their transfer, which keeps them on Put.io. Files that are already
+// downloading again are left alone. It returns how many files were queued.
+func (m *Manager) RetryFailures(fileIDs []int64) (int, error) {
+	processor := m.GetTransferProcessor()
+	if processor == nil {
+		return 0, errors.New("download manager is not running")
+	}
+
+	byTransfer := make(map[int64][]Failure)
+	var order []int64
+	for _, file := range m.failures.list(fileIDs) {
+		if _, active := m.activeFiles.Load(file.FileID); active {
+			continue
+		}
+		if _, ok := byTransfer[file.TransferID]; !ok {
+			order = append(order, file.TransferID)
+		}
+		byTransfer[file.TransferID] = append(byTransfer[file.TransferID], file)
+	}
+
+	retried := 0
+	var errs []error
+	for _, transferID := range order {
+		files := byTransfer[transferID]
+		ids := make([]int64, 0, len(files))
+		for _, file := range files {
+			ids = append(ids, file.FileID)
+		}
+
+		if ctx, ok := m.coordinator.GetTransferContext(transferID); ok {
+			ctx.Mu.Lock()
+			if ctx.State == TransferLifecycleFailed || ctx.State == TransferLifecycleQuarantined {
+				retried += m.retryFailedFiles(ctx, ids)
+			}
+			ctx.Mu.Unlock()
+			continue
+		}
+
+		if err := m.requeueFailures(processor, transferID, files); err != nil {
+			errs = append(errs, fmt.Errorf("transfer %d: %w", transferID, err))
+			continue
+		}
+		m.failures.retrying(ids)
+		retried += len(files)
+	}
+	return retried, errors.Join(errs...)
+}
+
+// requeueFailures queues failed files of a transfer that is no longer tracked
+func (m *Manager) requeueFailures(processor *TransferProcessor, transferID int64, files []Failure) error {
+	name := files[0].TransferName
+	if dir := files[0].TargetDir; dir != "" {
+		if err := m.SetTargetDir(transferID, name, dir, false); err != nil {
+			return err
+		}
+	}
+
+	ctx := m.coordinator.InitiateTransfer(transferID, name, 0, len(files), nil)
+	ctx.Mu.Lock()
+	ctx.Manual = true
+	ctx.Mu.Unlock()
+	if err := m.coordinator.StartDownload(transferID); err != nil {
+		m.coordinator.FailTransfer(transferID, err)
+		return err
+	}
+
+	log.Info("failures").
+		Int64("transfer_id", transferID).
+		Str("name", name).
+		Int("files", len(files)).
+		Msg("Queueing failed files of a transfer that is no longer tracked")
+
+	jobs := make([]downloadJob, 0, len(files))
+	for _, file := range files {
+		jobs = append(jobs, downloadJob{
+			FileID:     file.FileID,
+			Name:       file.Name,
+			TransferID: transferID,
+			Size:       file.Size,
+			CRC32:      file.CRC32,
+		})
+	}
+	transfer := &putio.Transfer{ID: transferID, Name: name}
+
+	// Queueing blocks while the workers are busy, so it happens in the background
+	m.workerWg.Add(1)
+	go func() {
+		defer m.workerWg.Done()
+		if processor.queueTransferFiles(transfer, jobs) == 0 {
+			m.coordinator.CompleteTransfer(transferID)
+		}
+	}()
+	return nil
+}
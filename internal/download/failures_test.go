@@ -0,0 +1,110 @@
+package download
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/elsbrock/plundrio/internal/config"
+)
+
+// fileIDs returns the IDs of failed files in order
+func fileIDs(files []Failure) []int64 {
+	ids := make([]int64, 0, len(files))
+	for _, file := range files {
+		ids = append(ids, file.FileID)
+	}
+	return ids
+}
+
+func TestFailureList(t *testing.T) {
+	stateDir := t.TempDir()
+	f := newFailureList(stateDir)
+	f.record(Failure{FileID: 1, Name: "a.mkv", Error: "first", Attempts: 1})
+	f.record(Failure{FileID: 2, Name: "b.mkv", Attempts: 1})
+	f.record(Failure{FileID: 3, Name: "c.mkv", Attempts: 1})
+	f.record(Failure{FileID: 1, Name: "a.mkv", Error: "second", Attempts: 1})
+	f.retrying([]int64{2})
+	f.remove(3)
+	f.remove(4)
+
+	// Files that failed again move to the end with their attempts added up
+	files := f.list(nil)
+	if got, want := fileIDs(files), []int64{2, 1}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("files = %v, want %v", got, want)
+	}
+	if files[1].Attempts != 2 || files[1].Error != "second" {
+		t.Errorf("file 1 = %+v, want 2 attempts and the last error", files[1])
+	}
+	if !files[0].Retrying {
+		t.Error("file 2 is not marked as retrying")
+	}
+	if got, want := fileIDs(f.list([]int64{1, 5})), []int64{1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("selected files = %v, want %v", got, want)
+	}
+
+	// Retries do not survive a restart, the files do
+	loaded := newFailureList(stateDir).list(nil)
+	if got, want := fileIDs(loaded), []int64{2, 1}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("loaded files = %v, want %v", got, want)
+	}
+	if loaded[0].Retrying || loaded[1].Attempts != 2 {
+		t.Errorf("loaded files = %+v, want file 2 not retrying and file 1 with 2 attempts", loaded)
+	}
+}
+
+func TestFailureListLimit(t *testing.T) {
+	f := newFailureList("")
+	for id := int64(1); id <= maxFailures+2; id++ {
+		f.record(Failure{FileID: id, Attempts: 1})
+	}
+	files := f.list(nil)
+	if len(files) != maxFailures || files[0].FileID != 3 || files[len(files)-1].FileID != maxFailures+2 {
+		t.Errorf("kept %d files from %d to %d, want the last %d", len(files), files[0].FileID, files[len(files)-1].FileID, maxFailures)
+	}
+}
+
+func TestRecordFailure(t *testing.T) {
+	m := &Manager{
+		targetDir:  "/downloads",
+		targetDirs: newTargetDirOverrides(""),
+		failures:   newFailureList(""),
+	}
+	m.targetDirs.set(1, "/downloads/tv")
+	job := downloadJob{FileID: 10, Name: "Show/e01.mkv", TransferID: 1, Size: 100, CRC32: "abc"}
+	err := NewNetworkError("e01.mkv", errors.New("connection reset"))
+	m.recordFailure(job, "Show", err)
+	m.recordFailure(job, "Show", err)
+
+	files := m.Failures()
+	if len(files) != 1 {
+		t.Fatalf("recorded %d files, want 1", len(files))
+	}
+	got := files[0]
+	if got.Time.IsZero() {
+		t.Error("failure time was not recorded")
+	}
+	want := Failure{
+		Time:         got.Time,
+		TransferID:   1,
+		TransferName: "Show",
+		FileID:       10,
+		Name:         "Show/e01.mkv",
+		Size:         100,
+		CRC32:        "abc",
+		TargetDir:    "/downloads/tv",
+		Error:        err.Error(),
+		ErrorCode:    ErrorCodeNetwork,
+		Attempts:     2,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("failure = %+v, want %+v", got, want)
+	}
+}
+
+func TestRetryFailuresNotRunning(t *testing.T) {
+	m := &Manager{cfg: &config.Config{}, failures: newFailureList("")}
+	if _, err := m.RetryFailures(nil); err == nil {
+		t.Error("RetryFailures succeeded without a running manager")
+	}
+}
@@ -0,0 +1,44 @@
+package download
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// TransferFile is a file of a transfer and how much of it is downloaded
+type TransferFile struct {
+	Name      string // Path relative to the target directory
+	Size      int64
+	Completed int64 // Bytes downloaded, the whole size once the file is complete
+}
+
+// TransferFiles returns the files of a transfer that are downloaded. Files
+// still being downloaded count as not downloaded at all, since aria2c
+// allocates them in full up front. It returns nil for transfers whose files
+// are not known yet.
+func (m *Manager) TransferFiles(transferID int64) []TransferFile {
+	ctx, ok := m.coordinator.GetTransferContext(transferID)
+	if !ok {
+		return nil
+	}
+	ctx.Mu.RLock()
+	wanted := append([]wantedFile(nil), ctx.wanted...)
+	processed := ctx.State == TransferLifecycleProcessed
+	ctx.Mu.RUnlock()
+
+	dir := m.TargetDir(transferID)
+	files := make([]TransferFile, 0, len(wanted))
+	for _, file := range wanted {
+		f := TransferFile{Name: file.Name, Size: file.Size}
+		if processed {
+			f.Completed = file.Size
+		} else {
+			path := longPath(filepath.Join(dir, file.Name))
+			if info, err := os.Stat(path); err == nil && info.Size() == file.Size && !isPartial(path) {
+				f.Completed = file.Size
+			}
+		}
+		files = append(files, f)
+	}
+	return files
+}
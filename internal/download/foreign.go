@@ -0,0 +1,154 @@
+package download
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elsbrock/go-putio"
+	"github.com/elsbrock/plundrio/internal/config"
+	"github.com/elsbrock/plundrio/internal/log"
+	"github.com/elsbrock/plundrio/internal/state"
+)
+
+// OwnedState is the name of the state document listing the transfers added through plundrio
+const OwnedState = "owned"
+
+// ownedTTL is how long a transfer added through plundrio is remembered,
+// plenty for put.io to finish it and plundrio to download it
+const ownedTTL = 30 * 24 * time.Hour
+
+// Owned lists the transfers added through plundrio by info hash, or by link
+// for transfers put.io fetches from a URL, with when they were added
+type Owned struct {
+	Transfers map[string]time.Time `json:"transfers"`
+}
+
+// ownedTransfers tells transfers added through plundrio from those added
+// elsewhere, such as the put.io web interface or others sharing the account
+type ownedTransfers struct {
+	mu    sync.Mutex
+	store *state.Store // nil without a state directory
+	added map[string]time.Time
+}
+
+// newOwnedTransfers loads the transfers earlier runs added from the state directory
+func newOwnedTransfers(stateDir string) *ownedTransfers {
+	o := &ownedTransfers{added: make(map[string]time.Time)}
+	if stateDir == "" {
+		return o
+	}
+
+	store, err := state.New(stateDir)
+	if err != nil {
+		log.Warn("foreign").Err(err).Msg("Added transfers will not be remembered")
+		return o
+	}
+	o.store = store
+
+	var owned Owned
+	if err := store.Load(OwnedState, &owned); err != nil {
+		log.Warn("foreign").Err(err).Msg("Failed to load added transfers")
+		return o
+	}
+	if owned.Transfers != nil {
+		o.added = owned.Transfers
+	}
+	return o
+}
+
+// add remembers a transfer added through plundrio by its info hash or link
+func (o *ownedTransfers) add(key string) {
+	if key == "" {
+		return
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	now := time.Now()
+	for k, added := range o.added {
+		if now.Sub(added) > ownedTTL {
+			delete(o.added, k)
+		}
+	}
+	o.added[strings.ToLower(key)] = now
+
+	if o.store == nil {
+		return
+	}
+	if err := o.store.Save(OwnedState, Owned{Transfers: o.added}); err != nil {
+		log.Warn("foreign").Err(err).Msg("Failed to save added transfers")
+	}
+}
+
+// has reports whether a transfer was added through plundrio
+func (o *ownedTransfers) has(t *putio.Transfer) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, key := range []string{t.Hash, t.Source, t.MagnetURI, t.TorrentLink} {
+		if key == "" {
+			continue
+		}
+		if _, ok := o.added[strings.ToLower(key)]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ownedKey returns what a transfer added from a magnet link or URL is
+// remembered by: the info hash if the link has one, the link otherwise
+func ownedKey(link string) string {
+	if hash := MagnetHash(link); hash != "" {
+		return hash
+	}
+	return link
+}
+
+// compileForeignMatch compiles the expression names of foreign transfers
+// must match, or returns nil if it is empty or invalid
+func compileForeignMatch(expr string) *regexp.Regexp {
+	if expr == "" {
+		return nil
+	}
+	match, err := regexp.Compile(expr)
+	if err != nil {
+		log.Error("foreign").Str("match", expr).Err(err).Msg("Ignoring invalid foreign-match expression")
+		return nil
+	}
+	return match
+}
+
+// acceptTransfer reports whether a transfer in the put.io folder is handled
+// by plundrio. Transfers added through plundrio always are, others depending
+// on the foreign transfers mode; those are sent to the foreign target
+// directory if one is set.
+func (m *Manager) acceptTransfer(t *putio.Transfer) bool {
+	if m.owned.has(t) {
+		return true
+	}
+
+	switch m.cfg.ForeignTransfers {
+	case config.ForeignTransfersIgnore:
+		return false
+	case config.ForeignTransfersMatch:
+		if m.foreignMatch == nil || !m.foreignMatch.MatchString(t.Name) {
+			return false
+		}
+	}
+
+	if dir := m.cfg.ForeignTargetDir; dir != "" {
+		if _, overridden := m.targetDirs.get(t.ID); !overridden {
+			if err := m.SetTargetDir(t.ID, "", dir, false); err != nil {
+				log.Error("foreign").
+					Int64("transfer_id", t.ID).
+					Str("dir", dir).
+					Err(err).
+					Msg("Failed to use foreign target directory")
+			}
+		}
+	}
+	return true
+}
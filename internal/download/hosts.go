@@ -0,0 +1,108 @@
+package download
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/elsbrock/plundrio/internal/config"
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// hostLimiter caps the aria2c connections all downloads together open to the
+// same download server, as put.io throttles clients opening too many
+type hostLimiter struct {
+	mu      sync.Mutex
+	inUse   map[string]int // host -> connections reserved by running downloads
+	changed chan struct{}  // closed when connections are released
+}
+
+// wake lets downloads waiting for connections check again
+func (l *hostLimiter) wake() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.changed != nil {
+		close(l.changed)
+		l.changed = nil
+	}
+}
+
+// acquireHostConnections reserves up to wanted connections to each of hosts
+// under the configured per-server cap and returns how many the download may
+// use and a function releasing them. With the fair strategy a download gets
+// no more than its share of the cap over the worker pool, so later downloads
+// do not wait for the first to finish. It waits while a server has no
+// connections left and fails if ctx ends while waiting.
+func (m *Manager) acquireHostConnections(ctx context.Context, hosts []string, wanted int) (int, func(), error) {
+	limit := m.cfg.HostConnections
+	if limit <= 0 || len(hosts) == 0 {
+		return wanted, func() {}, nil
+	}
+	if m.Settings().BandwidthStrategy != config.BandwidthStrategyFinishFirst {
+		wanted = min(wanted, max(limit/m.workerCount(), 1))
+	}
+
+	l := &m.hosts
+	logged := false
+	for {
+		l.mu.Lock()
+		if l.inUse == nil {
+			l.inUse = make(map[string]int)
+		}
+		granted := wanted
+		for _, host := range hosts {
+			granted = min(granted, limit-l.inUse[host])
+		}
+		if granted > 0 {
+			for _, host := range hosts {
+				l.inUse[host] += granted
+			}
+			l.mu.Unlock()
+			return granted, func() { m.releaseHostConnections(hosts, granted) }, nil
+		}
+		if l.changed == nil {
+			l.changed = make(chan struct{})
+		}
+		changed := l.changed
+		l.mu.Unlock()
+
+		if !logged {
+			log.Debug("download").
+				Strs("hosts", hosts).
+				Int("host_connections", limit).
+				Msg("Waiting for connections to the download server")
+			logged = true
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return 0, nil, ctx.Err()
+		}
+	}
+}
+
+// releaseHostConnections frees connections reserved by acquireHostConnections
+func (m *Manager) releaseHostConnections(hosts []string, connections int) {
+	m.hosts.mu.Lock()
+	for _, host := range hosts {
+		if m.hosts.inUse[host] -= connections; m.hosts.inUse[host] <= 0 {
+			delete(m.hosts.inUse, host)
+		}
+	}
+	m.hosts.mu.Unlock()
+	m.hosts.wake()
+}
+
+// serversOf returns the distinct download servers of urls
+func serversOf(urls []string) []string {
+	seen := make(map[string]bool)
+	var hosts []string
+	for _, u := range urls {
+		if host := serverOf(u); host != "" && !seen[host] {
+			seen[host] = true
+			hosts = append(hosts, host)
+		}
+	}
+	sort.Strings(hosts)
+	return hosts
+}
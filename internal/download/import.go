@@ -0,0 +1,246 @@
+package download
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/events"
+	"github.com/elsbrock/plundrio/internal/log"
+	"github.com/elsbrock/plundrio/internal/provider"
+	"github.com/elsbrock/plundrio/internal/state"
+)
+
+// ImportsState is the name of the state document the transfers waiting to be
+// imported are kept in
+const ImportsState = "imports"
+
+// PendingImport is a processed transfer waiting to be picked up by an *arr
+// application. It is kept until its source file was deleted, so that a
+// failed deletion is retried.
+type PendingImport struct {
+	TransferID int64     `json:"transfer_id"`
+	Name       string    `json:"name"`
+	Hash       string    `json:"hash,omitempty"`
+	FileID     int64     `json:"file_id"`
+	Path       string    `json:"path"`
+	ImportedAt time.Time `json:"imported_at,omitempty"` // zero until imported
+}
+
+// PendingImports lists the transfers waiting to be imported
+type PendingImports struct {
+	Transfers []PendingImport `json:"transfers"`
+}
+
+// pendingImports keeps the transfers waiting to be imported
+type pendingImports struct {
+	mu        sync.Mutex
+	store     *state.Store // nil without a state directory
+	transfers []PendingImport
+}
+
+// newPendingImports loads the transfers waiting to be imported in earlier
+// runs from the state directory
+func newPendingImports(stateDir string) *pendingImports {
+	p := &pendingImports{}
+	if stateDir == "" {
+		return p
+	}
+
+	store, err := state.New(stateDir)
+	if err != nil {
+		log.Warn("import").Err(err).Msg("Transfers waiting for import will not be remembered")
+		return p
+	}
+	p.store = store
+
+	var saved PendingImports
+	if err := store.Load(ImportsState, &saved); err != nil {
+		log.Warn("import").Err(err).Msg("Failed to load transfers waiting for import")
+		return p
+	}
+	p.transfers = saved.Transfers
+	return p
+}
+
+// add adds a transfer waiting to be imported, replacing an earlier entry of it
+func (p *pendingImports) add(pending PendingImport) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.transfers = slices.DeleteFunc(p.transfers, func(t PendingImport) bool { return t.TransferID == pending.TransferID })
+	p.transfers = append(p.transfers, pending)
+	p.save()
+}
+
+// imported marks a transfer as imported. It returns the transfer and whether
+// it was imported just now, or false if it is not waiting for import.
+func (p *pendingImports) imported(transferID int64) (PendingImport, bool, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	i := slices.IndexFunc(p.transfers, func(t PendingImport) bool { return t.TransferID == transferID })
+	if i < 0 {
+		return PendingImport{}, false, false
+	}
+	if !p.transfers[i].ImportedAt.IsZero() {
+		return p.transfers[i], false, true
+	}
+	p.transfers[i].ImportedAt = time.Now()
+	p.save()
+	return p.transfers[i], true, true
+}
+
+// remove drops a transfer once its source file was deleted
+func (p *pendingImports) remove(transferID int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	before := len(p.transfers)
+	p.transfers = slices.DeleteFunc(p.transfers, func(t PendingImport) bool { return t.TransferID == transferID })
+	if len(p.transfers) != before {
+		p.save()
+	}
+}
+
+// list returns the transfers waiting to be imported or for their source file
+// to be deleted
+func (p *pendingImports) list() []PendingImport {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Clone(p.transfers)
+}
+
+// save writes the transfers to the state directory. The caller must hold mu.
+func (p *pendingImports) save() {
+	if p.store == nil {
+		return
+	}
+	if err := p.store.Save(ImportsState, PendingImports{Transfers: p.transfers}); err != nil {
+		log.Warn("import").Err(err).Msg("Failed to save transfers waiting for import")
+	}
+}
+
+// awaitImport defers remote cleanup of a transfer until its files were imported
+func (m *Manager) awaitImport(ctx *TransferContext) {
+	var hash string
+	if ctx.Transfer != nil {
+		hash = ctx.Transfer.Hash
+	}
+
+	m.imports.add(PendingImport{
+		TransferID: ctx.ID,
+		Name:       ctx.Name,
+		Hash:       hash,
+		FileID:     ctx.FileID,
+		Path:       filepath.Join(m.TargetDir(ctx.ID), ctx.Name),
+	})
+	log.Info("import").
+		Int64("transfer_id", ctx.ID).
+		Str("name", ctx.Name).
+		Msg("Waiting for import before cleaning up")
+}
+
+// MarkImported records that a transfer was imported and runs the deferred
+// cleanup. It is called by import detection and by *arr integrations. The
+// transfer is kept until its source file was deleted; if that fails, it is
+// tried again on the next import check.
+func (m *Manager) MarkImported(transferID int64) {
+	pending, first, ok := m.imports.imported(transferID)
+	if !ok {
+		return
+	}
+
+	if first {
+		m.importedAt.Store(pending.Path, pending.ImportedAt)
+		log.Info("import").
+			Int64("transfer_id", pending.TransferID).
+			Str("name", pending.Name).
+			Msg("Download was imported")
+		m.publish(events.Event{
+			Type:       events.TransferImported,
+			TransferID: pending.TransferID,
+			Hash:       pending.Hash,
+			Name:       pending.Name,
+			Path:       pending.Path,
+		})
+	}
+
+	if err := m.DeleteRemoteFile(pending.FileID); err != nil && !errors.Is(err, provider.ErrFileNotFound) {
+		log.Error("cleanup").
+			Int64("transfer_id", pending.TransferID).
+			Int64("file_id", pending.FileID).
+			Err(err).
+			Msg("Failed to delete source file after import, will try again")
+		return
+	}
+	m.imports.remove(transferID)
+	log.Info("cleanup").
+		Int64("transfer_id", pending.TransferID).
+		Msg("Deleted source file after import")
+}
+
+// ImportedAt returns when the download at the given path was imported
+func (m *Manager) ImportedAt(path string) (time.Time, bool) {
+	if value, ok := m.importedAt.Load(path); ok {
+		return value.(time.Time), true
+	}
+	return time.Time{}, false
+}
+
+// isImported reports whether an *arr application picked up a download. The
+// download counts as imported once it disappeared (moved) or all of its files
+// have additional hard links (hardlink import).
+func isImported(path string) bool {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return true
+	}
+
+	files, linked := 0, 0
+	filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		files++
+		if links, ok := linkCount(info); ok && links > 1 {
+			linked++
+		}
+		return nil
+	})
+	return files > 0 && files == linked
+}
+
+// detectImports checks all pending transfers for completed imports, either
+// on disk or through the history of the configured *arr instances. Imported
+// transfers whose source file could not be deleted are tried again.
+func (m *Manager) detectImports() {
+	for _, pending := range m.imports.list() {
+		if !pending.ImportedAt.IsZero() || isImported(pending.Path) ||
+			(pending.Hash != "" && len(m.arr) > 0 && m.arr.IsImported(pending.Hash)) {
+			m.MarkImported(pending.TransferID)
+		}
+	}
+}
+
+// detectImportsPeriodically watches pending transfers until the manager stops
+func (m *Manager) detectImportsPeriodically() {
+	ticker := time.NewTicker(m.dlConfig.ImportCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stopChan:
+			return
+		case <-ticker.C:
+			m.detectImports()
+		}
+	}
+}
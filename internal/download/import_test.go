@@ -0,0 +1,109 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/elsbrock/plundrio/internal/config"
+	"github.com/elsbrock/plundrio/internal/events"
+	"github.com/elsbrock/plundrio/internal/provider"
+)
+
+// deletingProvider records the files deleted from it, failing while err is set
+type deletingProvider struct {
+	provider.Provider
+	err     error
+	deleted []int64
+}
+
+func (p *deletingProvider) DeleteFile(ctx context.Context, fileID int64) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.deleted = append(p.deleted, fileID)
+	return nil
+}
+
+// importManager returns a manager with transfers waiting for import kept in dir
+func importManager(dir string, p provider.Provider) *Manager {
+	return &Manager{
+		cfg:      &config.Config{},
+		provider: p,
+		ctx:      context.Background(),
+		events:   events.NewBus(),
+		history:  events.NewRecorder(100),
+		quotas:   newQuotas(dir),
+		records:  newDownloadRecords(dir, 30),
+		saved:    newSavedQueue(""),
+		imports:  newPendingImports(dir),
+	}
+}
+
+func TestMarkImportedRetriesFailedDeletion(t *testing.T) {
+	dir := t.TempDir()
+	p := &deletingProvider{err: errors.New("put.io is down")}
+	m := importManager(dir, p)
+	m.imports.add(PendingImport{TransferID: 1, Name: "show", FileID: 10, Path: dir + "/show"})
+
+	m.MarkImported(1)
+	pending := m.imports.list()
+	if len(pending) != 1 || pending[0].ImportedAt.IsZero() {
+		t.Fatalf("pending imports = %+v, want the transfer marked as imported", pending)
+	}
+	if _, ok := m.ImportedAt(dir + "/show"); !ok {
+		t.Error("import time was not recorded")
+	}
+
+	// The next check tries again, without reporting the import twice
+	p.err = nil
+	m.detectImports()
+	if len(p.deleted) != 1 || p.deleted[0] != 10 {
+		t.Errorf("deleted = %v, want [10]", p.deleted)
+	}
+	if pending := m.imports.list(); len(pending) != 0 {
+		t.Errorf("pending imports = %+v, want none", pending)
+	}
+	imported := 0
+	for _, event := range m.History() {
+		if event.Type == events.TransferImported {
+			imported++
+		}
+	}
+	if imported != 1 {
+		t.Errorf("import was reported %d times, want once", imported)
+	}
+}
+
+func TestMarkImportedFileAlreadyGone(t *testing.T) {
+	dir := t.TempDir()
+	m := importManager(dir, &deletingProvider{err: fmt.Errorf("file 10: %w", provider.ErrFileNotFound)})
+	m.imports.add(PendingImport{TransferID: 1, FileID: 10, Path: dir + "/show"})
+
+	m.MarkImported(1)
+	if pending := m.imports.list(); len(pending) != 0 {
+		t.Errorf("pending imports = %+v, want none", pending)
+	}
+}
+
+func TestPendingImportsSurviveRestart(t *testing.T) {
+	dir := t.TempDir()
+	imports := newPendingImports(dir)
+	imports.add(PendingImport{TransferID: 1, Name: "a", Hash: "h1", FileID: 10, Path: "/downloads/a"})
+	imports.add(PendingImport{TransferID: 2, Name: "b", FileID: 20, Path: "/downloads/b"})
+	imports.add(PendingImport{TransferID: 1, Name: "a", Hash: "h1", FileID: 11, Path: "/downloads/a"})
+	imports.imported(2)
+	imports.remove(3)
+
+	loaded := newPendingImports(dir).list()
+	if len(loaded) != 2 {
+		t.Fatalf("loaded %d transfers, want 2", len(loaded))
+	}
+	if loaded[0].TransferID != 2 || loaded[0].ImportedAt.IsZero() {
+		t.Errorf("first = %+v, want transfer 2 marked as imported", loaded[0])
+	}
+	if loaded[1].TransferID != 1 || loaded[1].FileID != 11 || loaded[1].Hash != "h1" || !loaded[1].ImportedAt.IsZero() {
+		t.Errorf("second = %+v, want transfer 1 with file 11 waiting", loaded[1])
+	}
+}
@@ -0,0 +1,57 @@
+package download
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// incompleteMoveSuffix is appended to a finished file while it is copied from
+// the incomplete directory to another filesystem
+const incompleteMoveSuffix = ".moving"
+
+// incompletePath returns where a file is written while it is downloaded. With
+// incomplete-dir, that is the same place relative to the target directory
+// below the incomplete directory; files outside the target directory keep
+// their full path below it. incomplete-suffix is appended to the name. Without
+// either, files are written in place.
+func (m *Manager) incompletePath(targetPath string) string {
+	path := targetPath
+	if dir := m.cfg.IncompleteDir; dir != "" {
+		rel, err := filepath.Rel(m.DefaultTargetDir(), targetPath)
+		if err != nil || !filepath.IsLocal(rel) {
+			rel = strings.TrimPrefix(targetPath, filepath.VolumeName(targetPath))
+		}
+		path = filepath.Join(dir, rel)
+	}
+	return path + m.cfg.IncompleteSuffix
+}
+
+// finishIncomplete moves a verified download from where it was written to its
+// target path. Within a filesystem this is a rename; on another filesystem the
+// file is copied next to the target path first and then renamed, so consumers
+// such as the *arr applications never see a file before it is complete.
+func (m *Manager) finishIncomplete(writePath, targetPath string) error {
+	if writePath == targetPath {
+		return nil
+	}
+	src, dst := longPath(writePath), longPath(targetPath)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(src, dst); err != nil {
+		moving := targetPath + incompleteMoveSuffix
+		if err := movePath(writePath, moving, m.moveStrategy()); err != nil {
+			return err
+		}
+		if err := os.Rename(longPath(moving), dst); err != nil {
+			return err
+		}
+	}
+
+	// A download that was written in place before may have left a control file
+	for _, suffix := range controlSuffixes {
+		os.Remove(dst + suffix)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package download
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/hex"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// MagnetHash returns the info hash of a magnet link as lowercase hex, or an
+// empty string if it has none
+func MagnetHash(link string) string {
+	u, err := url.Parse(link)
+	if err != nil || u.Scheme != "magnet" {
+		return ""
+	}
+	for _, xt := range u.Query()["xt"] {
+		hash, ok := strings.CutPrefix(strings.ToLower(xt), "urn:btih:")
+		if !ok {
+			continue
+		}
+		switch len(hash) {
+		case 40:
+			if _, err := hex.DecodeString(hash); err == nil {
+				return hash
+			}
+		case 32:
+			if b, err := base32.StdEncoding.DecodeString(strings.ToUpper(hash)); err == nil {
+				return hex.EncodeToString(b)
+			}
+		}
+	}
+	return ""
+}
+
+// TorrentHash returns the info hash of a .torrent file, the SHA-1 of its
+// bencoded info dictionary, as lowercase hex, or an empty string if the file
+// cannot be parsed
+func TorrentHash(data []byte) string {
+	if len(data) == 0 || data[0] != 'd' {
+		return ""
+	}
+	for i := 1; i < len(data) && data[i] != 'e'; {
+		key, next, ok := bencodeString(data, i)
+		if !ok {
+			return ""
+		}
+		end, ok := bencodeSkip(data, next)
+		if !ok {
+			return ""
+		}
+		if key == "info" {
+			sum := sha1.Sum(data[next:end])
+			return hex.EncodeToString(sum[:])
+		}
+		i = end
+	}
+	return ""
+}
+
+// bencodeString reads the bencoded string at i and returns it with the
+// position after it
+func bencodeString(data []byte, i int) (string, int, bool) {
+	colon := bytes.IndexByte(data[i:], ':')
+	if colon <= 0 {
+		return "", 0, false
+	}
+	n, err := strconv.Atoi(string(data[i : i+colon]))
+	start := i + colon + 1
+	if err != nil || n < 0 || start+n > len(data) {
+		return "", 0, false
+	}
+	return string(data[start : start+n]), start + n, true
+}
+
+// bencodeSkip returns the position after the bencoded value at i
+func bencodeSkip(data []byte, i int) (int, bool) {
+	if i >= len(data) {
+		return 0, false
+	}
+	switch c := data[i]; {
+	case c == 'i':
+		end := bytes.IndexByte(data[i:], 'e')
+		if end < 0 {
+			return 0, false
+		}
+		return i + end + 1, true
+	case c == 'l' || c == 'd':
+		// Dictionary keys are strings, so entries are skipped like list items
+		i++
+		for i < len(data) && data[i] != 'e' {
+			var ok bool
+			if i, ok = bencodeSkip(data, i); !ok {
+				return 0, false
+			}
+		}
+		if i >= len(data) {
+			return 0, false
+		}
+		return i + 1, true
+	case c >= '0' && c <= '9':
+		_, next, ok := bencodeString(data, i)
+		return next, ok
+	}
+	return 0, false
+}
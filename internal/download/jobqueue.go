@@ -0,0 +1,308 @@
+package download
+
+import (
+	"cmp"
+	"container/heap"
+	"slices"
+	"sync"
+
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// Directions a transfer can be moved in the download queue
+const (
+	MoveUp     = "up"
+	MoveDown   = "down"
+	MoveTop    = "top"
+	MoveBottom = "bottom"
+)
+
+// queuedJob is a job waiting in the job queue
+type queuedJob struct {
+	job      downloadJob
+	priority int   // priority of the transfer when the job was queued or reordered
+	seq      int64 // order the job was queued in
+}
+
+// jobHeap orders queued jobs by transfer priority, then by the position of
+// their transfer in the queue, then by the order they were queued in
+type jobHeap struct {
+	jobs      []queuedJob
+	positions map[int64]int64 // position of transfers with queued jobs, lower first
+}
+
+func (h *jobHeap) Len() int { return len(h.jobs) }
+
+func (h *jobHeap) Less(i, j int) bool {
+	a, b := h.jobs[i], h.jobs[j]
+	if a.priority != b.priority {
+		return a.priority > b.priority
+	}
+	if pa, pb := h.positions[a.job.TransferID], h.positions[b.job.TransferID]; pa != pb {
+		return pa < pb
+	}
+	return a.seq < b.seq
+}
+
+func (h *jobHeap) Swap(i, j int) { h.jobs[i], h.jobs[j] = h.jobs[j], h.jobs[i] }
+
+func (h *jobHeap) Push(x any) { h.jobs = append(h.jobs, x.(queuedJob)) }
+
+func (h *jobHeap) Pop() any {
+	last := h.jobs[len(h.jobs)-1]
+	h.jobs = h.jobs[:len(h.jobs)-1]
+	return last
+}
+
+// jobQueue holds the download jobs waiting for a worker, at most capacity of
+// them. Workers take the jobs of the transfer with the highest priority
+// first, and transfers with the same priority in the order they were queued
+// in, which can be changed while their jobs wait.
+type jobQueue struct {
+	mu       sync.Mutex
+	heap     jobHeap
+	counts   map[int64]int // number of queued jobs by transfer
+	capacity int
+	next     int64 // position of the next transfer queued
+	seq      int64
+	closed   bool
+	changed  chan struct{} // closed when a job is queued or taken, or the queue closes
+}
+
+// newJobQueue creates a job queue holding up to capacity jobs
+func newJobQueue(capacity int) *jobQueue {
+	return &jobQueue{
+		heap:     jobHeap{positions: make(map[int64]int64)},
+		counts:   make(map[int64]int),
+		capacity: capacity,
+	}
+}
+
+// wait returns a channel that is closed on the next change. q.mu must be held.
+func (q *jobQueue) wait() <-chan struct{} {
+	if q.changed == nil {
+		q.changed = make(chan struct{})
+	}
+	return q.changed
+}
+
+// notify wakes everyone waiting for a change. q.mu must be held.
+func (q *jobQueue) notify() {
+	if q.changed != nil {
+		close(q.changed)
+		q.changed = nil
+	}
+}
+
+// Len returns the number of queued jobs
+func (q *jobQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.heap.Len()
+}
+
+// Cap returns the number of jobs the queue holds at most
+func (q *jobQueue) Cap() int {
+	return q.capacity
+}
+
+// push queues a job of a transfer with the given priority, waiting for room
+// if the queue is full. It returns false if stop closed or the queue was
+// closed before the job was queued.
+func (q *jobQueue) push(job downloadJob, priority int, stop <-chan struct{}) bool {
+	q.mu.Lock()
+	for !q.closed && q.heap.Len() >= q.capacity {
+		changed := q.wait()
+		q.mu.Unlock()
+		select {
+		case <-changed:
+		case <-stop:
+			return false
+		}
+		q.mu.Lock()
+	}
+	defer q.mu.Unlock()
+	if q.closed {
+		return false
+	}
+
+	if q.counts[job.TransferID] == 0 {
+		q.heap.positions[job.TransferID] = q.next
+		q.next++
+	}
+	q.counts[job.TransferID]++
+	q.seq++
+	heap.Push(&q.heap, queuedJob{job: job, priority: priority, seq: q.seq})
+	q.notify()
+	return true
+}
+
+// pop takes the next job, waiting for one if the queue is empty. It returns
+// false once stop or the queue is closed.
+func (q *jobQueue) pop(stop <-chan struct{}) (downloadJob, bool) {
+	q.mu.Lock()
+	for !q.closed && q.heap.Len() == 0 {
+		changed := q.wait()
+		q.mu.Unlock()
+		select {
+		case <-changed:
+		case <-stop:
+			return downloadJob{}, false
+		}
+		q.mu.Lock()
+	}
+	defer q.mu.Unlock()
+	if q.closed {
+		return downloadJob{}, false
+	}
+
+	job := heap.Pop(&q.heap).(queuedJob).job
+	q.counts[job.TransferID]--
+	if q.counts[job.TransferID] == 0 {
+		delete(q.counts, job.TransferID)
+		delete(q.heap.positions, job.TransferID)
+	}
+	q.notify()
+	return job, true
+}
+
+// close drops the queued jobs and wakes everyone waiting to push or pop
+func (q *jobQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.heap.jobs = nil
+	clear(q.counts)
+	clear(q.heap.positions)
+	q.notify()
+}
+
+// reorder sorts the queued jobs again after priorities changed
+func (q *jobQueue) reorder(priority func(transferID int64) int) {
+	q.mu.Lock()
+	ids := make([]int64, 0, len(q.counts))
+	for id := range q.counts {
+		ids = append(ids, id)
+	}
+	q.mu.Unlock()
+
+	// Priorities are looked up without holding q.mu
+	priorities := make(map[int64]int, len(ids))
+	for _, id := range ids {
+		priorities[id] = priority(id)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i := range q.heap.jobs {
+		if p, ok := priorities[q.heap.jobs[i].job.TransferID]; ok {
+			q.heap.jobs[i].priority = p
+		}
+	}
+	heap.Init(&q.heap)
+}
+
+// transfers returns the transfers with queued jobs in the order their jobs
+// are taken, and their priorities. q.mu must be held.
+func (q *jobQueue) transfers() ([]int64, map[int64]int) {
+	priorities := make(map[int64]int, len(q.counts))
+	for _, job := range q.heap.jobs {
+		priorities[job.job.TransferID] = job.priority
+	}
+	ids := make([]int64, 0, len(priorities))
+	for id := range priorities {
+		ids = append(ids, id)
+	}
+	slices.SortFunc(ids, func(a, b int64) int {
+		if priorities[a] != priorities[b] {
+			return cmp.Compare(priorities[b], priorities[a])
+		}
+		return cmp.Compare(q.heap.positions[a], q.heap.positions[b])
+	})
+	return ids, priorities
+}
+
+// Transfers returns the transfers with queued jobs in the order their jobs
+// are taken
+func (q *jobQueue) Transfers() []int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	ids, _ := q.transfers()
+	return ids
+}
+
+// move moves a transfer with queued jobs one place up or down, or to the
+// top or bottom of the queue. Transfers only change places with transfers
+// of the same priority, so it returns the priority the transfer needs to
+// take its new place, and false if it has no queued jobs or is at the end
+// already.
+func (q *jobQueue) move(transferID int64, direction string) (int, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	ids, priorities := q.transfers()
+	i := slices.Index(ids, transferID)
+	if i < 0 {
+		return 0, false
+	}
+	var target int
+	switch direction {
+	case MoveUp:
+		target = i - 1
+	case MoveDown:
+		target = i + 1
+	case MoveTop:
+		target = 0
+	case MoveBottom:
+		target = len(ids) - 1
+	default:
+		return 0, false
+	}
+	if target < 0 || target >= len(ids) || target == i {
+		return 0, false
+	}
+	priority := priorities[ids[target]]
+
+	ids = slices.Delete(ids, i, i+1)
+	ids = slices.Insert(ids, target, transferID)
+	for position, id := range ids {
+		q.heap.positions[id] = int64(position)
+	}
+	q.next = int64(len(ids))
+	for i := range q.heap.jobs {
+		if q.heap.jobs[i].job.TransferID == transferID {
+			q.heap.jobs[i].priority = priority
+		}
+	}
+	heap.Init(&q.heap)
+	return priority, true
+}
+
+// QueuedTransfers returns the transfers with queued jobs in the order they
+// are downloaded
+func (m *Manager) QueuedTransfers() []int64 {
+	return m.jobs.Transfers()
+}
+
+// QueuePosition returns the place of a transfer among the transfers with
+// queued jobs, starting at 1, or 0 if none of its jobs is queued
+func (m *Manager) QueuePosition(transferID int64) int {
+	return slices.Index(m.QueuedTransfers(), transferID) + 1
+}
+
+// MoveInQueue moves a transfer with queued jobs one place up or down, or to
+// the top or bottom of the download queue. A transfer moving past one of
+// another priority takes that priority. It returns false if the transfer
+// has no queued jobs or cannot move further.
+func (m *Manager) MoveInQueue(transferID int64, direction string) bool {
+	priority, ok := m.jobs.move(transferID, direction)
+	if !ok {
+		return false
+	}
+	log.Info("download").
+		Int64("transfer_id", transferID).
+		Str("direction", direction).
+		Msg("Moved transfer in download queue")
+	m.SetPriority(transferID, priority)
+	return true
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package download
+
+import "os"
+
+// linkCount is not supported on this platform
+func linkCount(info os.FileInfo) (uint64, bool) {
+	return 0, false
+}
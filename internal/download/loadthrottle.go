@@ -0,0 +1,144 @@
+package download
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// loadRelaxFactor is how far below every threshold the system must be before
+// more downloads run at once again, so that the limit does not flap
+const loadRelaxFactor = 0.8
+
+// loadThrottle lowers how many downloads run at once while the system is
+// busy, e.g. with media server transcodes: every check above a threshold lets
+// one download fewer run, down to one, and every check well below all of them
+// one more again
+type loadThrottle struct {
+	mu     sync.Mutex
+	limit  int    // downloads that may run at once, 0 while not throttled
+	reason string // why downloads are throttled
+	ios    uint64 // I/O requests the target disk completed at the last check
+	ioMs   uint64 // milliseconds they took
+}
+
+// loadThrottled reports whether any of max-load, max-memory-percent and
+// max-disk-latency is set
+func (m *Manager) loadThrottled() bool {
+	return m.cfg.MaxLoad > 0 || m.cfg.MaxMemoryPercent > 0 || m.cfg.MaxDiskLatency > 0
+}
+
+// loadLimit returns how many downloads may run at once because of the system
+// load, or 0 if that is not limited
+func (m *Manager) loadLimit() int {
+	if !m.UnthrottledUntil().IsZero() {
+		return 0
+	}
+	m.load.mu.Lock()
+	defer m.load.mu.Unlock()
+	return m.load.limit
+}
+
+// throttleForLoadPeriodically checks the system load now and then
+func (m *Manager) throttleForLoadPeriodically() {
+	ticker := time.NewTicker(m.dlConfig.LoadCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stopChan:
+			return
+		case <-ticker.C:
+			m.checkLoad()
+		}
+	}
+}
+
+// checkLoad measures the load average, memory and latency of the disk
+// downloads are written to, and lowers or raises the number of downloads
+// that may run at once. Measures that are unknown count as fine.
+func (m *Manager) checkLoad() {
+	var busy []string
+	relaxed := true
+	check := func(name string, value, threshold float64, format string) {
+		if threshold <= 0 {
+			return
+		}
+		if value > threshold {
+			busy = append(busy, fmt.Sprintf("%s "+format+" above "+format, name, value, threshold))
+		}
+		if value >= threshold*loadRelaxFactor {
+			relaxed = false
+		}
+	}
+
+	if load, ok := loadAverage(); ok {
+		check("load", load, m.cfg.MaxLoad, "%.2f")
+	}
+	if used, ok := memoryUsed(); ok {
+		check("memory", float64(used), float64(m.cfg.MaxMemoryPercent), "%.0f%%")
+	}
+
+	t := &m.load
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	dir := m.DefaultTargetDir()
+	if m.cfg.IncompleteDir != "" {
+		dir = m.cfg.IncompleteDir
+	}
+	if ios, ms, ok := diskCounters(dir); ok {
+		if t.ios > 0 && ios > t.ios {
+			latency := float64(ms-t.ioMs) / float64(ios-t.ios)
+			check("disk latency", latency, float64(m.cfg.MaxDiskLatency.Milliseconds()), "%.0fms")
+		}
+		t.ios, t.ioMs = ios, ms
+	}
+
+	switch {
+	case len(busy) > 0:
+		limit := t.limit
+		if limit == 0 {
+			// Start from what runs now, so the first busy check has an effect
+			limit = max(m.runningDownloads(), 1)
+		}
+		t.limit = max(limit-1, 1)
+		t.reason = busy[0]
+		log.Warn("download").
+			Strs("busy", busy).
+			Int("limit", t.limit).
+			Msg("System is busy, running fewer downloads at once")
+
+	case relaxed && t.limit > 0:
+		t.limit++
+		if t.limit >= m.workerCount() {
+			t.limit = 0
+			t.reason = ""
+			log.Info("download").Msg("System is no longer busy, downloads are not limited anymore")
+		} else {
+			log.Info("download").Int("limit", t.limit).Msg("System is less busy, running more downloads at once")
+		}
+		m.queue.wake()
+	}
+}
+
+// runningDownloads returns how many downloads hold a download queue slot
+func (m *Manager) runningDownloads() int {
+	m.queue.mu.Lock()
+	defer m.queue.mu.Unlock()
+	return m.queue.running
+}
+
+// LoadThrottle returns how many downloads may run at once because the system
+// is busy and why, or 0 if they are not limited
+func (m *Manager) LoadThrottle() (int, string) {
+	limit := m.loadLimit()
+	if limit == 0 {
+		return 0, ""
+	}
+	m.load.mu.Lock()
+	defer m.load.mu.Unlock()
+	return limit, m.load.reason
+}
@@ -0,0 +1,380 @@
+package download
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/elsbrock/plundrio/internal/config"
+	"github.com/elsbrock/plundrio/internal/log"
+	"github.com/elsbrock/plundrio/internal/state"
+)
+
+// LocationsState is the name of the state document the target directories of
+// transfers stored outside the default target directory are kept in
+const LocationsState = "locations"
+
+// Locations lists the target directories of transfers stored outside the
+// default target directory, by transfer ID
+type Locations struct {
+	TargetDirs map[int64]string `json:"target_dirs"`
+}
+
+// targetDirOverrides keeps the target directories of transfers stored outside
+// the default target directory, so that they are still found after a restart
+type targetDirOverrides struct {
+	mu    sync.RWMutex
+	store *state.Store // nil without a state directory
+	dirs  map[int64]string
+}
+
+// newTargetDirOverrides loads the target directories set in earlier runs from
+// the state directory
+func newTargetDirOverrides(stateDir string) *targetDirOverrides {
+	o := &targetDirOverrides{dirs: make(map[int64]string)}
+	if stateDir == "" {
+		return o
+	}
+
+	store, err := state.New(stateDir)
+	if err != nil {
+		log.Warn("location").Err(err).Msg("Target directories of transfers will not be remembered")
+		return o
+	}
+	o.store = store
+
+	var saved Locations
+	if err := store.Load(LocationsState, &saved); err != nil {
+		log.Warn("location").Err(err).Msg("Failed to load target directories of transfers")
+		return o
+	}
+	if saved.TargetDirs != nil {
+		o.dirs = saved.TargetDirs
+	}
+	return o
+}
+
+// get returns the target directory of a transfer, if it has its own
+func (o *targetDirOverrides) get(transferID int64) (string, bool) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	dir, ok := o.dirs[transferID]
+	return dir, ok
+}
+
+// set gives a transfer its own target directory
+func (o *targetDirOverrides) set(transferID int64, dir string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if current, ok := o.dirs[transferID]; ok && current == dir {
+		return
+	}
+	o.dirs[transferID] = dir
+	o.save()
+}
+
+// delete makes a transfer use the default target directory again
+func (o *targetDirOverrides) delete(transferID int64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if _, ok := o.dirs[transferID]; !ok {
+		return
+	}
+	delete(o.dirs, transferID)
+	o.save()
+}
+
+// all returns the target directories of all transfers that have their own
+func (o *targetDirOverrides) all() map[int64]string {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return maps.Clone(o.dirs)
+}
+
+// save writes the target directories to the state directory. The caller
+// must hold mu.
+func (o *targetDirOverrides) save() {
+	if o.store == nil {
+		return
+	}
+	if err := o.store.Save(LocationsState, Locations{TargetDirs: o.dirs}); err != nil {
+		log.Warn("location").Err(err).Msg("Failed to save target directories of transfers")
+	}
+}
+
+// setTargetDirOverride points a transfer at a target directory, dropping the
+// override if it is the default one
+func (m *Manager) setTargetDirOverride(transferID int64, dir string) {
+	if dir == m.DefaultTargetDir() {
+		m.targetDirs.delete(transferID)
+		return
+	}
+	m.targetDirs.set(transferID, dir)
+}
+
+// TargetDir returns the local directory a transfer is downloaded to
+func (m *Manager) TargetDir(transferID int64) string {
+	if dir, ok := m.targetDirs.get(transferID); ok {
+		return dir
+	}
+	return m.DefaultTargetDir()
+}
+
+// Category returns the category of a transfer, which is the name of the
+// subdirectory of the default target directory it is downloaded to
+func (m *Manager) Category(transferID int64) string {
+	dir := m.TargetDir(transferID)
+	if filepath.Dir(dir) == m.DefaultTargetDir() {
+		return filepath.Base(dir)
+	}
+	return ""
+}
+
+// SetTargetDir changes where the files of a transfer are stored. Files queued
+// afterwards are downloaded to the new directory; when move is set, files that
+// were already downloaded are moved there as well. Files still being
+// downloaded stay where they are written and are relocated once they finish.
+func (m *Manager) SetTargetDir(transferID int64, name string, dir string, move bool) error {
+	if !filepath.IsAbs(dir) {
+		return fmt.Errorf("target directory must be an absolute path: %s", dir)
+	}
+	dir = filepath.Clean(dir)
+
+	oldDir := m.TargetDir(transferID)
+	if oldDir == dir {
+		return nil
+	}
+
+	if err := os.MkdirAll(longPath(dir), 0755); err != nil {
+		return fmt.Errorf("failed to create target directory: %w", err)
+	}
+
+	// Downloads starting from now on use the new directory, so the files
+	// that are busy afterwards are all that must be left alone
+	m.setTargetDirOverride(transferID, dir)
+
+	if move && name != "" {
+		src := filepath.Join(oldDir, name)
+		dst := filepath.Join(dir, name)
+		moved, err := moveFinished(src, dst, m.busyPaths(transferID), m.moveStrategy())
+		if err != nil {
+			m.setTargetDirOverride(transferID, oldDir)
+			return fmt.Errorf("failed to move downloaded files: %w", err)
+		}
+		if moved > 0 {
+			log.Info("location").
+				Int64("transfer_id", transferID).
+				Str("from", src).
+				Str("to", dst).
+				Int("files", moved).
+				Msg("Moved downloaded files")
+		}
+	}
+
+	log.Info("location").
+		Int64("transfer_id", transferID).
+		Str("name", name).
+		Str("old_dir", oldDir).
+		Str("new_dir", dir).
+		Bool("move", move).
+		Msg("Changed transfer target directory")
+
+	return nil
+}
+
+// busyPaths returns the local paths the files of a transfer that are queued
+// or being downloaded are written to, together with their control files
+func (m *Manager) busyPaths(transferID int64) map[string]bool {
+	active := make(map[int64]bool)
+	m.activeFiles.Range(func(key, value interface{}) bool {
+		if value.(int64) == transferID {
+			active[key.(int64)] = true
+		}
+		return true
+	})
+
+	m.claimsMu.Lock()
+	defer m.claimsMu.Unlock()
+	busy := make(map[string]bool)
+	for path, claim := range m.claims {
+		if !active[claim.FileID] {
+			continue
+		}
+		for _, p := range []string{path, m.incompletePath(path)} {
+			busy[p] = true
+			for _, suffix := range controlSuffixes {
+				busy[p+suffix] = true
+			}
+		}
+	}
+	return busy
+}
+
+// moveFinished moves the finished files below src, or src itself if it is a
+// file, to the same place below dst. Busy files and files a downloader can
+// still continue stay where they are, as do the directories left holding
+// them. It fails before moving anything if a file already exists at the
+// destination, and returns how many files were moved.
+func moveFinished(src, dst string, busy map[string]bool, strategy string) (int, error) {
+	var files, dirs []string
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == src {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			dirs = append(dirs, path)
+			return nil
+		}
+		if busy[path] || isPartial(path) || slices.ContainsFunc(controlSuffixes, func(suffix string) bool {
+			return filepath.Ext(path) == suffix
+		}) {
+			return nil
+		}
+		files = append(files, path)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	targets := make([]string, len(files))
+	for i, file := range files {
+		rel, err := filepath.Rel(src, file)
+		if err != nil {
+			return 0, err
+		}
+		targets[i] = filepath.Join(dst, rel)
+		if _, err := os.Lstat(longPath(targets[i])); err == nil {
+			return 0, fmt.Errorf("destination already exists: %s", targets[i])
+		}
+	}
+
+	for i, file := range files {
+		if err := movePath(file, targets[i], strategy); err != nil {
+			return i, err
+		}
+	}
+
+	// Directories are listed before their contents, so the deepest come
+	// last; those still holding busy files stay
+	for _, dir := range slices.Backward(dirs) {
+		os.Remove(longPath(dir))
+	}
+	return len(files), nil
+}
+
+// relocateFinished moves a finished download to its current target path if the
+// transfer's target directory changed while it was being downloaded
+func (m *Manager) relocateFinished(oldPath, newPath string) error {
+	if oldPath == newPath {
+		return nil
+	}
+	oldPath, newPath = longPath(oldPath), longPath(newPath)
+
+	// The file may already have been moved along with its directory
+	if _, err := os.Stat(oldPath); err == nil {
+		if err := os.MkdirAll(filepath.Dir(newPath), 0755); err != nil {
+			return err
+		}
+		if err := movePath(oldPath, newPath, m.moveStrategy()); err != nil {
+			return err
+		}
+	}
+
+	// Downloaders remove their control file by the original path, so a moved one would linger
+	for _, suffix := range controlSuffixes {
+		os.Remove(newPath + suffix)
+	}
+	return nil
+}
+
+// moveStrategy returns the copy strategy for downloads moved while plundrio
+// still manages them: out of the incomplete directory or an old target
+// directory. A symlink would point into a directory that is cleaned up, so
+// these are copied instead; only migrations link files.
+func (m *Manager) moveStrategy() string {
+	if m.cfg.CopyStrategy == config.CopyStrategySymlink {
+		return config.CopyStrategyCopy
+	}
+	return m.cfg.CopyStrategy
+}
+
+// movePath moves a file or directory. When it cannot be renamed, e.g. because
+// source and destination are on different filesystems, the copy strategy
+// decides whether it is copied and deleted or left in place and symlinked.
+func movePath(src, dst, strategy string) error {
+	src, dst = longPath(src), longPath(dst)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	if strategy == config.CopyStrategySymlink {
+		return os.Symlink(src, dst)
+	}
+	if err := copyPath(src, dst, strategy == config.CopyStrategyReflink); err != nil {
+		os.RemoveAll(dst)
+		return err
+	}
+	return os.RemoveAll(src)
+}
+
+// copyPath recursively copies a file or directory, cloning files instead of
+// copying their data if reflink is set and the filesystem supports it
+func copyPath(src, dst string, reflink bool) error {
+	src, dst = longPath(src), longPath(dst)
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return copyFile(src, dst, info.Mode(), reflink)
+	}
+
+	if err := os.MkdirAll(dst, info.Mode()); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := copyPath(filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name()), reflink); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyFile copies a single regular file
+func copyFile(src, dst string, mode os.FileMode, reflink bool) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if reflink && cloneFile(out, in) == nil {
+		return out.Close()
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,146 @@
+package download
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/elsbrock/plundrio/internal/config"
+)
+
+// writeFiles creates files with their names as content below dir
+func writeFiles(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// exists reports whether there is a file at path
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+func TestMoveFinished(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "old", "Show"), filepath.Join(dir, "new", "Show")
+	writeFiles(t, src,
+		"e01.mkv",
+		"Season 1/e02.mkv",
+		"Season 1/e03.mkv",         // being downloaded
+		"e04.mkv", "e04.mkv.aria2", // interrupted
+		"e05.mkv", "e05.mkv.plundrio",
+		"Extras/trailer.mkv",
+	)
+	busy := map[string]bool{filepath.Join(src, "Season 1", "e03.mkv"): true}
+
+	moved, err := moveFinished(src, dst, busy, config.CopyStrategyCopy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved != 3 {
+		t.Errorf("moved %d files, want 3", moved)
+	}
+	for _, name := range []string{"e01.mkv", "Season 1/e02.mkv", "Extras/trailer.mkv"} {
+		if !exists(filepath.Join(dst, name)) || exists(filepath.Join(src, name)) {
+			t.Errorf("%s was not moved", name)
+		}
+	}
+	for _, name := range []string{"Season 1/e03.mkv", "e04.mkv", "e04.mkv.aria2", "e05.mkv", "e05.mkv.plundrio"} {
+		if !exists(filepath.Join(src, name)) || exists(filepath.Join(dst, name)) {
+			t.Errorf("%s was moved", name)
+		}
+	}
+	if exists(filepath.Join(src, "Extras")) {
+		t.Error("emptied directory was left behind")
+	}
+}
+
+func TestMoveFinishedConflict(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "old", "Show"), filepath.Join(dir, "new", "Show")
+	writeFiles(t, src, "e01.mkv", "e02.mkv")
+	writeFiles(t, dst, "e02.mkv")
+
+	if _, err := moveFinished(src, dst, nil, config.CopyStrategyCopy); err == nil {
+		t.Fatal("moving onto an existing file succeeded")
+	}
+	if !exists(filepath.Join(src, "e01.mkv")) || exists(filepath.Join(dst, "e01.mkv")) {
+		t.Error("files were moved although one of them conflicted")
+	}
+}
+
+func TestMoveFinishedSingleFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "old/movie.mkv")
+
+	moved, err := moveFinished(filepath.Join(dir, "old", "movie.mkv"), filepath.Join(dir, "new", "movie.mkv"), nil, config.CopyStrategyCopy)
+	if err != nil || moved != 1 {
+		t.Fatalf("moveFinished = %d, %v, want 1 file", moved, err)
+	}
+	if !exists(filepath.Join(dir, "new", "movie.mkv")) {
+		t.Error("file was not moved")
+	}
+
+	// Nothing downloaded yet is nothing to move
+	if moved, err := moveFinished(filepath.Join(dir, "old", "missing"), filepath.Join(dir, "new", "missing"), nil, ""); err != nil || moved != 0 {
+		t.Errorf("moveFinished of a missing path = %d, %v", moved, err)
+	}
+}
+
+func TestSetTargetDirLeavesDownloadsInProgress(t *testing.T) {
+	dir := t.TempDir()
+	defaultDir, otherDir := filepath.Join(dir, "downloads"), filepath.Join(dir, "tv")
+	writeFiles(t, defaultDir, "Show/e01.mkv", "Show/e02.mkv", "Show/e02.mkv.aria2")
+
+	m := &Manager{
+		cfg:        &config.Config{},
+		targetDir:  defaultDir,
+		targetDirs: newTargetDirOverrides(filepath.Join(dir, "state")),
+		claims:     map[string]pathClaim{filepath.Join(defaultDir, "Show", "e02.mkv"): {TransferID: 1, FileID: 2}},
+	}
+	m.activeFiles.Store(int64(2), int64(1))
+
+	if err := m.SetTargetDir(1, "Show", otherDir, true); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.TargetDir(1); got != otherDir {
+		t.Errorf("TargetDir = %s, want %s", got, otherDir)
+	}
+	if !exists(filepath.Join(otherDir, "Show", "e01.mkv")) {
+		t.Error("finished file was not moved")
+	}
+	if !exists(filepath.Join(defaultDir, "Show", "e02.mkv")) || !exists(filepath.Join(defaultDir, "Show", "e02.mkv.aria2")) {
+		t.Error("file being downloaded was moved")
+	}
+
+	// A conflict keeps the transfer where it was
+	writeFiles(t, defaultDir, "Show/e01.mkv")
+	if err := m.SetTargetDir(1, "Show", defaultDir, true); err == nil {
+		t.Error("moving onto an existing file succeeded")
+	}
+	if got := m.TargetDir(1); got != otherDir {
+		t.Errorf("TargetDir after a failed move = %s, want %s", got, otherDir)
+	}
+}
+
+func TestTargetDirOverridesSurviveRestart(t *testing.T) {
+	dir := t.TempDir()
+	overrides := newTargetDirOverrides(dir)
+	overrides.set(1, "/tv")
+	overrides.set(2, "/movies")
+	overrides.set(3, "/other")
+	overrides.delete(3)
+
+	loaded := newTargetDirOverrides(dir).all()
+	if len(loaded) != 2 || loaded[1] != "/tv" || loaded[2] != "/movies" {
+		t.Errorf("loaded %v, want transfers 1 and 2", loaded)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package download
+
+// longPath returns path unchanged; only Windows limits the path length
+func longPath(path string) string {
+	return path
+}
@@ -0,0 +1,27 @@
+//go:build windows
+
+package download
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// maxPath is the longest directory path Windows accepts without the
+// extended-length prefix (MAX_PATH minus room for an 8.3 file name)
+const maxPath = 248
+
+// longPath returns path in extended-length form if it is too long for the
+// classic Windows APIs, e.g. C:\very\long\path becomes \\?\C:\very\long\path
+// and the UNC share \\server\share\path becomes \\?\UNC\server\share\path.
+// aria2c does not add the prefix itself, so paths handed to it need it too.
+func longPath(path string) string {
+	if len(path) < maxPath || !filepath.IsAbs(path) || strings.HasPrefix(path, `\\?\`) {
+		return path
+	}
+	path = filepath.Clean(path)
+	if strings.HasPrefix(path, `\\`) {
+		return `\\?\UNC\` + path[2:]
+	}
+	return `\\?\` + path
+}
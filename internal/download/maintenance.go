@@ -0,0 +1,132 @@
+package download
+
+import (
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/cron"
+	"github.com/elsbrock/plundrio/internal/events"
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// timeWindow is a parsed maintenance or download window
+type timeWindow struct {
+	start    *cron.Schedule
+	duration time.Duration
+}
+
+// active reports whether the window covers t, i.e. whether it started less
+// than its duration before t
+func (w timeWindow) active(t time.Time) bool {
+	start := t.Truncate(time.Minute)
+	for ; t.Sub(start) < w.duration; start = start.Add(-time.Minute) {
+		if w.start.Matches(start) {
+			return true
+		}
+	}
+	return false
+}
+
+// maintenanceWindows parses the configured maintenance windows, leaving out
+// invalid ones
+func (m *Manager) maintenanceWindows() []timeWindow {
+	var windows []timeWindow
+	for _, window := range m.cfg.MaintenanceWindows {
+		schedule, err := cron.Parse(window.Start)
+		if err != nil || window.Duration <= 0 {
+			log.Error("maintenance").
+				Str("start", window.Start).
+				Dur("duration", window.Duration).
+				Err(err).
+				Msg("Ignoring invalid maintenance window")
+			continue
+		}
+		windows = append(windows, timeWindow{start: schedule, duration: window.Duration})
+	}
+	return windows
+}
+
+// enforceMaintenanceWindows pauses downloads and polling while a maintenance
+// window is active and resumes them once it is over
+func (m *Manager) enforceMaintenanceWindows() {
+	windows := m.maintenanceWindows()
+	if len(windows) == 0 {
+		return
+	}
+
+	check := func(now time.Time) {
+		active := false
+		for _, window := range windows {
+			if window.active(now) {
+				active = true
+				break
+			}
+		}
+		if active {
+			m.beginMaintenance()
+		} else {
+			m.endMaintenance()
+		}
+	}
+
+	check(time.Now())
+	ticker := time.NewTicker(m.dlConfig.MaintenanceCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stopChan:
+			return
+		case now := <-ticker.C:
+			check(now)
+		}
+	}
+}
+
+// InMaintenance reports whether a maintenance window is active
+func (m *Manager) InMaintenance() bool {
+	m.pauseMu.Lock()
+	defer m.pauseMu.Unlock()
+	return m.maintenance
+}
+
+// beginMaintenance interrupts all running downloads and holds back queued
+// ones until the maintenance window ends
+func (m *Manager) beginMaintenance() {
+	m.pauseMu.Lock()
+	if m.maintenance {
+		m.pauseMu.Unlock()
+		return
+	}
+	m.maintenance = true
+	for transferID, signal := range m.pauseSignals {
+		close(signal)
+		delete(m.pauseSignals, transferID)
+	}
+	m.pauseMu.Unlock()
+
+	log.Info("maintenance").Msg("Maintenance window started, pausing downloads and polling")
+	m.publish(events.Event{Type: events.SystemMaintenanceStarted})
+}
+
+// endMaintenance queues the downloads held back during maintenance again
+func (m *Manager) endMaintenance() {
+	m.pauseMu.Lock()
+	if !m.maintenance {
+		m.pauseMu.Unlock()
+		return
+	}
+	m.maintenance = false
+	jobs := m.maintenanceJobs
+	m.maintenanceJobs = nil
+	m.pauseMu.Unlock()
+
+	// Jobs of transfers paused in the meantime are held back again by the workers
+	for _, job := range jobs {
+		m.requeue(job)
+	}
+
+	log.Info("maintenance").
+		Int("jobs", len(jobs)).
+		Msg("Maintenance window ended, resuming downloads and polling")
+	m.publish(events.Event{Type: events.SystemMaintenanceEnded})
+}
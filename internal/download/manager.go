@@ -1,11 +1,19 @@
 package download
 
 import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"regexp"
 	"sync"
+	"time"
 
-	"github.com/elsbrock/plundrio/internal/api"
+	"github.com/elsbrock/plundrio/internal/arr"
 	"github.com/elsbrock/plundrio/internal/config"
+	"github.com/elsbrock/plundrio/internal/events"
 	"github.com/elsbrock/plundrio/internal/log"
+	"github.com/elsbrock/plundrio/internal/provider"
+	"github.com/elsbrock/plundrio/internal/scheduler"
 )
 
 // Manager handles downloading completed transfers from Put.io.
@@ -14,21 +22,86 @@ import (
 // downloads efficiently while maintaining control over system resources.
 type Manager struct {
 	cfg      *config.Config
-	client   *api.Client
-	dlConfig *DownloadConfig // Download-specific configuration
+	provider provider.Provider
+	routes   []providerRoute  // send new transfers to other providers first
+	dlConfig *DownloadConfig  // Download-specific configuration
+	arr      arr.Group        // *arr instances to query for imports, may be empty
+	events   *events.Bus      // publishes transfer, file and system events
+	history  *events.Recorder // recent transfer events
+	notes    *annotations     // notes and metadata attached to transfers
+	quotas   *quotas          // monthly usage of API users
+	records  *downloadRecords // finished downloads, kept for history-days
+	mirrored *mirroredFolders // files of the mirrored folders when they were last checked
+	failures *failureList     // files that failed to download after all their attempts
+
+	owned        *ownedTransfers // transfers added through plundrio, to tell them from foreign ones
+	foreignMatch *regexp.Regexp  // names of foreign transfers to download in match mode, may be nil
 
 	coordinator *TransferCoordinator // Coordinates transfer lifecycle
+	existing    *existingFiles       // files in the target directory on the first start, nil once adopted or disabled
+	completions *completionJournal   // completions deleting source files, replayed if interrupted
 	activeFiles sync.Map             // map[int64]int64 - tracks files being downloaded, FileID -> TransferID
+	fileSpeeds  sync.Map             // map[int64]float64 - current aria2c speed in bytes per second, FileID -> speed
+	targetDirs  *targetDirOverrides  // per-transfer target directory overrides, saved in the state directory
+
+	claimsMu  sync.Mutex           // protects claims and pathLocks
+	claims    map[string]pathClaim // local path -> file downloading to it
+	pathLocks map[string]*pathLock // local path -> lock held while downloading to it
+
+	imports    *pendingImports // processed transfers awaiting import, saved in the state directory
+	importedAt sync.Map        // map[string]time.Time - local path -> time of import
+
+	targetMu  sync.RWMutex // protects targetDir
+	targetDir string       // default target directory, may change on config reload
 
 	stopChan chan struct{}
 	stopOnce sync.Once
+	ctx      context.Context    // cancelled on stop, ends provider calls in flight
+	cancel   context.CancelFunc // cancels ctx
+	scans    chan chan struct{} // requests to check transfers right away, closed once checked
 
 	workerWg  sync.WaitGroup // tracks worker goroutines
 	monitorWg sync.WaitGroup // tracks monitor goroutine
 
-	jobs    chan downloadJob
-	mu      sync.Mutex // protects job queueing
-	running bool       // tracks if manager is running
+	jobs    *jobQueue
+	spill   *spillQueue // jobs that did not fit into jobs, nil without a state directory
+	saved   *savedQueue // transfers being downloaded, saved to continue them on the next start
+	mu      sync.Mutex  // protects job queueing
+	running bool        // tracks if manager is running
+
+	activeDownloads int32                // number of running downloads, accessed atomically
+	httpClient      *http.Client         // used by the native downloader, nil when aria2c downloads
+	aria2Mu         sync.Mutex           // protects aria2d
+	aria2d          *aria2Daemon         // downloads files when aria2c is used, started on first use
+	overall         *rateLimiter         // limits all native downloads together
+	retries         *retryBudget         // caps retries per hour across all transfers
+	limits          transferLimits       // speed limits of transfers with running downloads
+	volumes         volumeLimiter        // caps concurrent downloads per volume
+	hosts           hostLimiter          // caps connections per download server across downloads
+	queue           downloadQueue        // caps concurrent downloads below the worker count
+	load            loadThrottle         // caps concurrent downloads while the system is busy
+	tuner           *tuner               // learns connection counts and retry waits per server
+	speeds          speedModel           // windowed speeds for time left estimates
+	throughput      *throughput          // speed history at several resolutions
+	scheduler       *scheduler.Scheduler // runs scans, trash emptying and cleanup on schedules
+
+	pauseMu         sync.Mutex              // protects pausedJobs, pauseSignals, cancelled, maintenance, download window state and spaceJobs
+	pausedJobs      map[int64][]downloadJob // paused transfers and the jobs held back for them
+	pauseSignals    map[int64]chan struct{} // closed to interrupt the downloads of a transfer when it is paused
+	cancelled       map[int64]struct{}      // cancelled transfers whose jobs are dropped
+	maintenance     bool                    // a maintenance window is active
+	maintenanceJobs []downloadJob           // jobs held back until the maintenance window ends
+	windowClosed    bool                    // download windows are configured and none is open
+	windowOpensAt   time.Time               // start of the next download window while closed
+	windowJobs      []downloadJob           // jobs held back until a download window opens
+	spaceJobs       []downloadJob           // jobs held back until they fit on the disk
+
+	settingsMu sync.RWMutex // protects the cfg fields that can change at runtime, see Settings
+	altSpeed   bool         // alternative speed limit in use, protected by settingsMu
+
+	throttleMu       sync.Mutex  // protects speed limit override state
+	unthrottledUntil time.Time   // end of the current speed limit override
+	unthrottleTimer  *time.Timer // restores the speed limit when the override ends
 
 	processor *TransferProcessor // Handles transfer processing
 }
@@ -43,24 +116,83 @@ func (m *Manager) GetCoordinator() *TransferCoordinator {
 	return m.coordinator
 }
 
+// Provider returns the cloud service transfers are added to and downloaded from
+func (m *Manager) Provider() provider.Provider {
+	return m.provider
+}
+
 // New creates a new download manager
-func New(cfg *config.Config, client *api.Client) *Manager {
-	// Get default download configuration
-	dlConfig := GetDefaultConfig()
+func New(cfg *config.Config, p provider.Provider) *Manager {
+	// Get download configuration of the resource profile
+	dlConfig := GetProfileConfig(cfg.Profile)
+	if cfg.Connections > 0 {
+		dlConfig.ConnectionBudget = cfg.Connections
+	}
 
 	// Override with user config if provided
 	workerCount := cfg.WorkerCount
 	if workerCount <= 0 {
 		workerCount = dlConfig.DefaultWorkerCount
 	}
+	queueSize := cfg.MaxQueuedJobs
+	if queueSize <= 0 {
+		queueSize = workerCount * dlConfig.BufferMultiple
+	}
 
+	ctx, cancel := context.WithCancel(context.Background())
 	m := &Manager{
 		cfg:         cfg,
-		client:      client,
+		provider:    p,
+		routes:      compileRoutes(cfg.ProviderRoutes),
 		dlConfig:    dlConfig,
 		stopChan:    make(chan struct{}),
-		jobs:        make(chan downloadJob, workerCount*dlConfig.BufferMultiple),
+		ctx:         ctx,
+		cancel:      cancel,
+		scans:       make(chan chan struct{}),
+		jobs:        newJobQueue(queueSize),
 		activeFiles: sync.Map{},
+		targetDir:   cfg.TargetDir,
+		events:      events.NewBus(),
+		history:     events.NewRecorder(dlConfig.HistorySize),
+		tuner:       newTuner(cfg.StateDir),
+		throughput:  newThroughput(cfg.StateDir),
+		scheduler:   scheduler.New(),
+		overall:     &rateLimiter{rate: float64(cfg.MaxDownloadRate) * 1024},
+		retries:     &retryBudget{limit: cfg.RetryBudget},
+		limits:      transferLimits{transfers: make(map[int64]*transferLimit)},
+
+		notes:        newAnnotations(cfg.StateDir),
+		quotas:       newQuotas(cfg.StateDir),
+		records:      newDownloadRecords(cfg.StateDir, cfg.HistoryDays),
+		mirrored:     newMirroredFolders(cfg.StateDir),
+		failures:     newFailureList(cfg.StateDir),
+		owned:        newOwnedTransfers(cfg.StateDir),
+		foreignMatch: compileForeignMatch(cfg.ForeignMatch),
+		completions:  newCompletionJournal(cfg.StateDir),
+		saved:        newSavedQueue(cfg.StateDir),
+		imports:      newPendingImports(cfg.StateDir),
+		targetDirs:   newTargetDirOverrides(cfg.StateDir),
+
+		claims:    make(map[string]pathClaim),
+		pathLocks: make(map[string]*pathLock),
+
+		pausedJobs:   make(map[int64][]downloadJob),
+		pauseSignals: make(map[int64]chan struct{}),
+		cancelled:    make(map[int64]struct{}),
+	}
+	if useNativeDownloader(cfg.Downloader) {
+		m.httpClient = newNativeClient(dlConfig)
+	}
+	m.registerActions()
+	for _, member := range provider.All(p) {
+		if watcher, ok := member.(authWatcher); ok {
+			watcher.OnAuthChange(m.authChanged)
+		}
+	}
+
+	// Jobs beyond the queue size go to disk if there is a state directory
+	if cfg.StateDir != "" {
+		m.spill = newSpillQueue(filepath.Join(cfg.StateDir, "queue.spill"))
 	}
 
 	// Initialize coordinator and processor
@@ -74,9 +206,34 @@ func New(cfg *config.Config, client *api.Client) *Manager {
 			return NewTransferNotFoundError(transferID)
 		}
 
+		// Files queued by hand belong to the user and stay on Put.io
+		if state.Manual {
+			log.Debug("cleanup").
+				Int64("transfer_id", transferID).
+				Int64("file_id", state.FileID).
+				Msg("Keeping source file of manually queued download")
+			return nil
+		}
+
+		// Failed files of a partially completed transfer can still be
+		// downloaded from Put.io later
+		if state.FailedFiles > 0 {
+			log.Info("cleanup").
+				Int64("transfer_id", transferID).
+				Int32("failed_files", state.FailedFiles).
+				Msg("Keeping source files of partially completed transfer")
+			return nil
+		}
+
+		// Defer deletion until the download was imported if configured
+		if m.cfg.CleanupOn == config.CleanupOnImport {
+			m.awaitImport(state)
+			return nil
+		}
+
 		// Delete only the source file from Put.io, but keep the transfer
 		// This allows *arr applications to see completed transfers
-		if err := m.client.DeleteFile(state.FileID); err != nil {
+		if err := m.deleteSourceFile(state); err != nil {
 			log.Error("cleanup").
 				Int64("transfer_id", transferID).
 				Int64("file_id", state.FileID).
@@ -96,6 +253,11 @@ func New(cfg *config.Config, client *api.Client) *Manager {
 	return m
 }
 
+// SetArr configures the *arr instances used to detect imports. It must be called before Start.
+func (m *Manager) SetArr(group arr.Group) {
+	m.arr = group
+}
+
 // Start begins monitoring transfers and downloading completed ones
 func (m *Manager) Start() {
 	m.mu.Lock()
@@ -106,10 +268,17 @@ func (m *Manager) Start() {
 	m.running = true
 	m.mu.Unlock()
 
-	workerCount := m.cfg.WorkerCount
-	if workerCount <= 0 {
-		workerCount = m.dlConfig.DefaultWorkerCount
-	}
+	// Finish completions an earlier run was interrupted in before the
+	// transfers are checked again
+	m.replayCompletions()
+	m.existing = m.scanExisting()
+
+	workerCount := m.workerCount()
+	log.Info("download").
+		Str("downloader", m.downloader()).
+		Str("target_type", m.targetType(m.DefaultTargetDir())).
+		Int("workers", workerCount).
+		Msg("Starting download workers")
 
 	// Start download workers with proper synchronization
 	for i := 0; i < workerCount; i++ {
@@ -126,6 +295,150 @@ func (m *Manager) Start() {
 		defer m.monitorWg.Done()
 		m.monitorTransfers()
 	}()
+
+	// Start sampling download speeds for time left estimates
+	m.monitorWg.Add(1)
+	go func() {
+		defer m.monitorWg.Done()
+		m.sampleLocalSpeedsPeriodically()
+	}()
+
+	// Start recording the speed history
+	m.monitorWg.Add(1)
+	go func() {
+		defer m.monitorWg.Done()
+		m.recordThroughputPeriodically()
+	}()
+
+	// Start saving the progress of the transfers being downloaded
+	if m.saved.enabled() {
+		m.monitorWg.Add(1)
+		go func() {
+			defer m.monitorWg.Done()
+			m.saveProgressPeriodically()
+		}()
+	}
+
+	// Start moving spilled jobs back to the queue
+	if m.spill != nil {
+		m.monitorWg.Add(1)
+		go func() {
+			defer m.monitorWg.Done()
+			m.feedSpilledJobs()
+		}()
+	}
+
+	// Start import detection if cleanup waits for imports
+	if m.cfg.CleanupOn == config.CleanupOnImport {
+		m.monitorWg.Add(1)
+		go func() {
+			defer m.monitorWg.Done()
+			m.detectImportsPeriodically()
+		}()
+	}
+
+	// Start slow download detection if configured
+	if m.cfg.SlowSpeedThreshold > 0 {
+		m.monitorWg.Add(1)
+		go func() {
+			defer m.monitorWg.Done()
+			m.detectSlowTransfersPeriodically()
+		}()
+	}
+
+	// Start keeping learned settings for the next run
+	if m.tuner.store != nil {
+		m.monitorWg.Add(1)
+		go func() {
+			defer m.monitorWg.Done()
+			m.saveTuningPeriodically()
+		}()
+	}
+
+	// Start pausing for maintenance windows if configured
+	if len(m.cfg.MaintenanceWindows) > 0 {
+		m.monitorWg.Add(1)
+		go func() {
+			defer m.monitorWg.Done()
+			m.enforceMaintenanceWindows()
+		}()
+	}
+
+	// Start adding files dropped into the watch directory if configured
+	if m.cfg.WatchDir != "" {
+		m.monitorWg.Add(1)
+		go func() {
+			defer m.monitorWg.Done()
+			m.watchBlackhole()
+		}()
+	}
+
+	// Start holding back downloads outside of download windows if configured
+	if len(m.cfg.DownloadWindows) > 0 {
+		m.monitorWg.Add(1)
+		go func() {
+			defer m.monitorWg.Done()
+			m.enforceDownloadWindows()
+		}()
+	}
+
+	// Start running fewer downloads while the system is busy if configured
+	if m.loadThrottled() {
+		m.monitorWg.Add(1)
+		go func() {
+			defer m.monitorWg.Done()
+			m.throttleForLoadPeriodically()
+		}()
+	}
+
+	// Start downloads waiting for disk space once they fit
+	m.monitorWg.Add(1)
+	go func() {
+		defer m.monitorWg.Done()
+		m.waitForSpace()
+	}()
+
+	// Start reconciling local transfer state with the provider
+	m.monitorWg.Add(1)
+	go func() {
+		defer m.monitorWg.Done()
+		m.reconcilePeriodically()
+	}()
+
+	// Start checking the token for revocation
+	m.monitorWg.Add(1)
+	go func() {
+		defer m.monitorWg.Done()
+		m.validateTokenPeriodically()
+	}()
+
+	// Start running scheduled actions, including trash emptying and
+	// retention enforcement
+	m.startSchedules()
+
+	m.publish(events.Event{Type: events.SystemStarted})
+}
+
+// ProviderOf returns the name of the provider a transfer was added to when
+// fallback providers are configured, or an empty string with a single provider
+func (m *Manager) ProviderOf(transferID int64) string {
+	if len(provider.All(m.provider)) < 2 {
+		return ""
+	}
+	return provider.Of(m.provider, transferID).Name()
+}
+
+// DeleteRemoteFile removes a file from Put.io, bypassing the trash if configured
+func (m *Manager) DeleteRemoteFile(fileID int64) error {
+	return m.deleteRemoteFile(m.ctx, provider.Of(m.provider, fileID), fileID)
+}
+
+// deleteRemoteFile deletes a file or folder from the provider it belongs to
+func (m *Manager) deleteRemoteFile(ctx context.Context, p provider.Provider, fileID int64) error {
+	if trash, ok := p.(provider.Trash); ok && m.Settings().SkipTrash {
+		return trash.DeleteFilePermanently(ctx, fileID)
+	}
+	return p.DeleteFile(ctx, fileID)
 }
 
 // Stop gracefully shuts down the manager
@@ -138,23 +451,28 @@ func (m *Manager) Stop() {
 	m.running = false
 	m.mu.Unlock()
 
+	m.publish(events.Event{Type: events.SystemStopping})
+
+	// What was going on is reported once everything stopped
+	inFlight := m.inFlightFiles()
+	droppedJobs := m.jobs.Len() + m.spilledJobs()
+
 	m.stopOnce.Do(func() {
 		// Signal workers to stop via stopChan
 		close(m.stopChan)
-		// Close jobs channel to prevent new submissions
-		close(m.jobs)
-		// Drain any remaining jobs to prevent deadlock
-		go func() {
-			for range m.jobs {
-				// Drain jobs channel
-			}
-		}()
+		m.cancel()
+		// Close the job queue to prevent new submissions and drop queued jobs
+		m.jobs.close()
 	})
 
 	// Wait for all workers to finish
 	m.workerWg.Wait()
 	// Wait for monitor to finish
 	m.monitorWg.Wait()
+	m.saved.close()
+	// aria2c is only stopped once no download uses it anymore
+	m.stopAria2()
+	m.writeShutdownReport(inFlight, droppedJobs)
 }
 
 // QueueDownload adds a download job to the queue if not already downloading
@@ -162,6 +480,19 @@ func (m *Manager) QueueDownload(job downloadJob) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	// Batches are tracked per contained file
+	if len(job.Batch) > 0 {
+		for _, file := range job.Batch {
+			m.activeFiles.Store(file.FileID, file.TransferID)
+		}
+		if !m.sendJob(job) {
+			for _, file := range job.Batch {
+				m.activeFiles.Delete(file.FileID)
+			}
+		}
+		return
+	}
+
 	// Check if file is already being downloaded
 	if _, exists := m.activeFiles.Load(job.FileID); exists {
 		return
@@ -169,10 +500,7 @@ func (m *Manager) QueueDownload(job downloadJob) {
 
 	// Mark file as being downloaded before queueing, storing TransferID
 	m.activeFiles.Store(job.FileID, job.TransferID)
-	select {
-	case m.jobs <- job:
-		// Successfully queued
-	case <-m.stopChan:
+	if !m.sendJob(job) {
 		// Manager is shutting down, just remove from active files
 		m.activeFiles.Delete(job.FileID)
 	}
@@ -212,6 +540,8 @@ func (m *Manager) cleanupTransfer(transferID int64) {
 // handleFileCompletion updates transfer state when a file completes downloading
 // This is called for successful downloads only with the specific fileID that completed
 func (m *Manager) handleFileCompletion(transferID int64, fileID int64) {
+	m.failures.remove(fileID)
+
 	// First increment the completion counter in the transfer coordinator
 	if err := m.coordinator.FileCompleted(transferID); err != nil {
 		log.Error("transfers").
@@ -221,6 +551,7 @@ func (m *Manager) handleFileCompletion(transferID int64, fileID int64) {
 			Msg("Failed to handle file completion")
 		return
 	}
+	m.saveFileDone(transferID, fileID, SavedFileCompleted, nil)
 
 	// Log detailed completion info
 	log.Debug("transfers").
@@ -231,6 +562,27 @@ func (m *Manager) handleFileCompletion(transferID int64, fileID int64) {
 	// Now that the counter has been incremented, remove the file from active tracking
 	m.activeFiles.Delete(fileID)
 
+	m.finalizeIfDone(transferID)
+}
+
+// handleFileSkipped leaves a file that no longer exists on Put.io out of its
+// transfer and finalizes the transfer if this was the last file
+func (m *Manager) handleFileSkipped(job downloadJob) {
+	if err := m.coordinator.FileSkipped(job.TransferID, job.FileID, job.Size); err != nil {
+		log.Error("transfers").
+			Int64("transfer_id", job.TransferID).
+			Int64("file_id", job.FileID).
+			Err(err).
+			Msg("Failed to handle skipped file")
+		return
+	}
+	m.activeFiles.Delete(job.FileID)
+	m.finalizeIfDone(job.TransferID)
+}
+
+// finalizeIfDone completes a transfer once it is marked as completed and none
+// of its files are downloading anymore
+func (m *Manager) finalizeIfDone(transferID int64) {
 	// Check if the transfer is marked as completed
 	ctx, ok := m.coordinator.GetTransferContext(transferID)
 	if !ok {
@@ -290,11 +642,22 @@ func (m *Manager) handleFileCompletion(transferID int64, fileID int64) {
 
 // handleFileFailure marks a file as failed in the transfer context
 // This is called when a file fails to download
-func (m *Manager) handleFileFailure(transferID int64) {
-	if err := m.coordinator.FileFailure(transferID); err != nil {
+func (m *Manager) handleFileFailure(job downloadJob, fileErr error) {
+	name := job.Name
+	if ctx, ok := m.coordinator.GetTransferContext(job.TransferID); ok {
+		ctx.Mu.RLock()
+		name = ctx.Name
+		ctx.Mu.RUnlock()
+	}
+	m.recordFailure(job, name, fileErr)
+
+	file := wantedFile{FileID: job.FileID, Name: job.Name, Size: job.Size, CRC32: job.CRC32}
+	if err := m.coordinator.FileFailure(job.TransferID, file, fileErr); err != nil {
 		log.Error("transfers").
-			Int64("transfer_id", transferID).
+			Int64("transfer_id", job.TransferID).
 			Err(err).
 			Msg("Failed to handle file failure")
+		return
 	}
+	m.saveFileDone(job.TransferID, job.FileID, SavedFileFailed, fileErr)
 }
@@ -0,0 +1,106 @@
+package download
+
+import (
+	"fmt"
+
+	"github.com/elsbrock/go-putio"
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// manualTransferID returns the ID a manually queued file is tracked under.
+// Put.io transfer IDs are positive, so negated file IDs never collide with them.
+func manualTransferID(fileID int64) int64 {
+	return -fileID
+}
+
+// QueueFile downloads a file or folder that is already on Put.io, such as a
+// search result, the same way as the files of a finished transfer. Unlike
+// transfers, the file is kept on Put.io afterwards. Files are stored in
+// targetDir, or the default target directory if it is empty. It returns the ID
+// the download is tracked under.
+func (m *Manager) QueueFile(fileID int64, targetDir string) (int64, error) {
+	processor := m.GetTransferProcessor()
+	if processor == nil {
+		return 0, fmt.Errorf("download manager is not running")
+	}
+
+	id := manualTransferID(fileID)
+	if m.manualQueued(id) {
+		return 0, fmt.Errorf("file %d is already queued", fileID)
+	}
+
+	file, err := m.provider.GetFile(m.ctx, fileID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get file: %w", err)
+	}
+	files, err := m.provider.GetAllTransferFiles(m.ctx, fileID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list files: %w", err)
+	}
+	if len(files) == 0 {
+		return 0, NewNoFilesFoundError(id)
+	}
+
+	if err := m.queueFiles(processor, file, files, targetDir); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// manualQueued reports whether the files queued by hand under an ID are still
+// being downloaded
+func (m *Manager) manualQueued(id int64) bool {
+	ctx, ok := m.coordinator.GetTransferContext(id)
+	if !ok {
+		return false
+	}
+	ctx.Mu.RLock()
+	state := ctx.State
+	ctx.Mu.RUnlock()
+	return state != TransferLifecycleFailed && state != TransferLifecycleCancelled && state != TransferLifecycleProcessed
+}
+
+// queueFiles downloads files below a file or folder on Put.io, tracked under
+// the ID manualTransferID returns for it
+func (m *Manager) queueFiles(processor *TransferProcessor, file *putio.File, files []*putio.File, targetDir string) error {
+	fileID := file.ID
+	id := manualTransferID(fileID)
+	if targetDir == "" {
+		targetDir = m.DefaultTargetDir()
+	}
+	if err := m.SetTargetDir(id, file.Name, targetDir, false); err != nil {
+		return err
+	}
+
+	// Files are named and placed like those of a transfer with the same name
+	transfer := &putio.Transfer{ID: id, Name: file.Name, FileID: fileID}
+	ctx := m.coordinator.InitiateTransfer(id, file.Name, fileID, len(files), nil)
+	ctx.Mu.Lock()
+	ctx.Manual = true
+	ctx.Mu.Unlock()
+	if err := m.coordinator.StartDownload(id); err != nil {
+		m.coordinator.FailTransfer(id, err)
+		return err
+	}
+
+	log.Info("transfers").
+		Int64("id", id).
+		Int64("file_id", fileID).
+		Str("name", file.Name).
+		Int("files", len(files)).
+		Msg("Queued Put.io file for download")
+
+	// Queueing blocks while the workers are busy, so it happens in the background
+	m.workerWg.Add(1)
+	go func() {
+		defer m.workerWg.Done()
+		if processor.queueTransferFiles(transfer, newDownloadJobs(transfer, files)) == 0 {
+			log.Info("transfers").
+				Str("name", file.Name).
+				Int64("id", id).
+				Msg("All files already exist, completing transfer")
+			m.coordinator.CompleteTransfer(id)
+		}
+	}()
+	return nil
+}
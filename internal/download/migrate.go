@@ -0,0 +1,280 @@
+package download
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/elsbrock/plundrio/internal/config"
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// DefaultTargetDir returns the target directory used by transfers without an override
+func (m *Manager) DefaultTargetDir() string {
+	m.targetMu.RLock()
+	defer m.targetMu.RUnlock()
+	return m.targetDir
+}
+
+// ChangeTargetDir switches the default target directory, migrating existing
+// downloads according to the configured migration mode
+func (m *Manager) ChangeTargetDir(dir string) error {
+	oldDir := m.DefaultTargetDir()
+	if oldDir == dir {
+		return nil
+	}
+
+	if err := m.migrateTargetDir(oldDir, dir); err != nil {
+		return err
+	}
+
+	m.targetMu.Lock()
+	m.targetDir = dir
+	m.targetMu.Unlock()
+
+	log.Info("migrate").
+		Str("old_dir", oldDir).
+		Str("new_dir", dir).
+		Msg("Default target directory changed")
+	return nil
+}
+
+// MigrateTargetDir brings the downloads in oldDir, the default target
+// directory of an earlier run, over to the current one according to the
+// configured migration mode
+func (m *Manager) MigrateTargetDir(oldDir string) error {
+	return m.migrateTargetDir(oldDir, m.DefaultTargetDir())
+}
+
+// migrateTargetDir moves or links the downloads plundrio knows of from oldDir
+// into newDir, including partial downloads and their control files, and
+// points the transfers with their own directory below oldDir at the same
+// place below newDir. Anything else in oldDir stays, as do the downloads of
+// transfers with files queued or downloading, which keep oldDir as their own
+// directory until they are done. Entries that already exist in newDir are
+// left alone. Moves that cannot rename follow the copy strategy.
+func (m *Manager) migrateTargetDir(oldDir, newDir string) error {
+	mode := m.cfg.MigrateMode
+	if mode == config.MigrateModeOff || mode == "" || oldDir == newDir {
+		return nil
+	}
+	if mode != config.MigrateModeMove && mode != config.MigrateModeLink {
+		return fmt.Errorf("unknown migration mode: %s", mode)
+	}
+	if _, inside := relativeTo(oldDir, newDir); inside {
+		return fmt.Errorf("new target directory %s is inside the old one %s", newDir, oldDir)
+	}
+	if err := os.MkdirAll(longPath(newDir), 0755); err != nil {
+		return fmt.Errorf("failed to create new target directory: %w", err)
+	}
+
+	// Transfers still downloading stay where their partial files are
+	downloads := m.knownDownloads(oldDir)
+	busy := m.busyTransfers()
+	for _, download := range downloads {
+		for id, rel := range download.transfers {
+			if !busy[id] {
+				continue
+			}
+			m.targetDirs.set(id, filepath.Join(oldDir, filepath.Dir(rel)))
+			log.Warn("migrate").
+				Int64("transfer_id", id).
+				Str("path", filepath.Join(oldDir, rel)).
+				Msg("Leaving download in progress in the old target directory")
+		}
+	}
+
+	migrated := 0
+	for _, download := range downloads {
+		if download.busy(busy) {
+			continue
+		}
+		src := filepath.Join(oldDir, download.rel)
+		dst := filepath.Join(newDir, download.rel)
+		if _, err := os.Lstat(longPath(src)); err != nil {
+			continue
+		}
+		if _, err := os.Lstat(longPath(dst)); err == nil {
+			log.Warn("migrate").
+				Str("path", dst).
+				Msg("Skipping migration, destination already exists")
+			continue
+		}
+
+		var err error
+		switch mode {
+		case config.MigrateModeMove:
+			err = movePath(src, dst, m.cfg.CopyStrategy)
+			if dir := filepath.Dir(src); dir != oldDir {
+				// Category directories left empty
+				os.Remove(longPath(dir))
+			}
+		case config.MigrateModeLink:
+			if err = os.MkdirAll(longPath(filepath.Dir(dst)), 0755); err == nil {
+				err = linkPath(src, dst)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to migrate %s: %w", download.rel, err)
+		}
+		migrated++
+	}
+
+	// Transfers in a directory below the old one follow their files
+	for id, dir := range m.targetDirs.all() {
+		rel, inside := relativeTo(oldDir, dir)
+		if !inside || busy[id] {
+			continue
+		}
+		if dir = filepath.Join(newDir, rel); dir == newDir {
+			m.targetDirs.delete(id)
+		} else {
+			m.targetDirs.set(id, dir)
+		}
+	}
+
+	log.Info("migrate").
+		Str("old_dir", oldDir).
+		Str("new_dir", newDir).
+		Str("mode", mode).
+		Int("entries", migrated).
+		Msg("Migrated existing downloads")
+	return nil
+}
+
+// knownDownload is a file or directory in a target directory holding the
+// downloads of transfers
+type knownDownload struct {
+	rel       string           // path below the target directory
+	transfers map[int64]string // paths of the transfers' downloads at or below rel
+}
+
+// busy reports whether any transfer of the download is busy
+func (d knownDownload) busy(busy map[int64]bool) bool {
+	for id := range d.transfers {
+		if busy[id] {
+			return true
+		}
+	}
+	return false
+}
+
+// knownDownloads returns the downloads plundrio made in dir, which is or was
+// the default target directory: those in the download history, in the
+// saved queue, waiting for import or being tracked, in dir itself or in a
+// category directory below it. Downloads at or below the path of another
+// are merged into it, as they are migrated along with it.
+func (m *Manager) knownDownloads(dir string) []knownDownload {
+	paths := make(map[string]map[int64]bool)
+	add := func(transferID int64, path string) {
+		if rel, inside := relativeTo(dir, path); inside && rel != "." {
+			if paths[rel] == nil {
+				paths[rel] = make(map[int64]bool)
+			}
+			paths[rel][transferID] = true
+		}
+	}
+	// Transfers with their own directory are found there, the others in dir
+	targetDir := func(transferID int64) string {
+		if override, ok := m.targetDirs.get(transferID); ok {
+			return override
+		}
+		return dir
+	}
+
+	m.records.mu.Lock()
+	for _, entry := range m.records.entries {
+		add(entry.TransferID, filepath.Join(dir, entry.Category, entry.Name))
+	}
+	m.records.mu.Unlock()
+	for _, transfer := range m.saved.load() {
+		if transfer.Transfer != nil {
+			add(transfer.Transfer.ID, filepath.Join(targetDir(transfer.Transfer.ID), transfer.Transfer.Name))
+		}
+	}
+	for _, pending := range m.imports.list() {
+		add(pending.TransferID, pending.Path)
+	}
+	m.coordinator.GetAllTransfers(func(ctx *TransferContext) {
+		ctx.Mu.RLock()
+		name := ctx.Name
+		ctx.Mu.RUnlock()
+		add(ctx.ID, filepath.Join(targetDir(ctx.ID), name))
+	})
+
+	// Sorted by their parts, paths below another follow it right away
+	rels := slices.SortedFunc(maps.Keys(paths), func(a, b string) int {
+		return slices.Compare(strings.Split(a, string(filepath.Separator)), strings.Split(b, string(filepath.Separator)))
+	})
+	var downloads []knownDownload
+	for _, rel := range rels {
+		if n := len(downloads); n > 0 {
+			if _, nested := relativeTo(downloads[n-1].rel, rel); nested {
+				for id := range paths[rel] {
+					downloads[n-1].transfers[id] = rel
+				}
+				continue
+			}
+		}
+		download := knownDownload{rel: rel, transfers: make(map[int64]string)}
+		for id := range paths[rel] {
+			download.transfers[id] = rel
+		}
+		downloads = append(downloads, download)
+	}
+	return downloads
+}
+
+// busyTransfers returns the transfers with files queued or being downloaded
+func (m *Manager) busyTransfers() map[int64]bool {
+	busy := make(map[int64]bool)
+	m.activeFiles.Range(func(key, value interface{}) bool {
+		busy[value.(int64)] = true
+		return true
+	})
+	return busy
+}
+
+// relativeTo returns the path of path relative to base, and whether it is
+// base itself or below it
+func relativeTo(base, path string) (string, bool) {
+	rel, err := filepath.Rel(base, path)
+	if err != nil || !filepath.IsLocal(rel) {
+		return "", false
+	}
+	return rel, true
+}
+
+// linkPath recursively hard-links a file or directory, falling back to
+// symbolic links when source and destination are on different filesystems
+func linkPath(src, dst string) error {
+	src, dst = longPath(src), longPath(dst)
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		if err := os.Link(src, dst); err != nil {
+			return os.Symlink(src, dst)
+		}
+		return nil
+	}
+
+	if err := os.MkdirAll(dst, info.Mode()); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := linkPath(filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
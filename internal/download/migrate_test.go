@@ -0,0 +1,132 @@
+package download
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/elsbrock/plundrio/internal/config"
+)
+
+// migrationManager returns a manager with oldDir as its default target
+// directory, knowing of downloads in the history, the imports and its
+// tracked transfers, one of them still downloading
+func migrationManager(t *testing.T, oldDir, mode string) *Manager {
+	t.Helper()
+	writeFiles(t, oldDir,
+		"Show/e01.mkv",
+		"tv/Series/e01.mkv", "tv/Series/e02.mkv", "tv/Series/e02.mkv.aria2",
+		"Busy/e01.mkv", "Busy/e01.mkv.aria2",
+		"Imported/movie.mkv",
+		"unknown.txt",
+	)
+
+	m := &Manager{
+		cfg:        &config.Config{MigrateMode: mode, CopyStrategy: config.CopyStrategyCopy},
+		targetDir:  oldDir,
+		targetDirs: newTargetDirOverrides(""),
+		records:    newDownloadRecords("", 0),
+		saved:      newSavedQueue(""),
+		imports:    newPendingImports(""),
+	}
+	m.coordinator = NewTransferCoordinator(m)
+	m.records.entries = []HistoryEntry{
+		{TransferID: 1, Name: "Show", Outcome: OutcomeCompleted},
+		{TransferID: 2, Name: "Series", Category: "tv", Outcome: OutcomeCompleted},
+		{TransferID: 5, Name: "e01.mkv", Category: "Show", Outcome: OutcomeCompleted},
+	}
+	m.targetDirs.set(2, filepath.Join(oldDir, "tv"))
+	m.imports.add(PendingImport{TransferID: 4, Name: "Imported", Path: filepath.Join(oldDir, "Imported")})
+	m.coordinator.transfers.Store(int64(3), &TransferContext{ID: 3, Name: "Busy"})
+	m.activeFiles.Store(int64(30), int64(3))
+	return m
+}
+
+func TestChangeTargetDirMovesKnownDownloads(t *testing.T) {
+	dir := t.TempDir()
+	oldDir, newDir := filepath.Join(dir, "old"), filepath.Join(dir, "new")
+	m := migrationManager(t, oldDir, config.MigrateModeMove)
+
+	if err := m.ChangeTargetDir(newDir); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.DefaultTargetDir(); got != newDir {
+		t.Errorf("DefaultTargetDir = %s, want %s", got, newDir)
+	}
+	for _, name := range []string{"Show/e01.mkv", "tv/Series/e01.mkv", "tv/Series/e02.mkv", "tv/Series/e02.mkv.aria2", "Imported/movie.mkv"} {
+		if !exists(filepath.Join(newDir, name)) || exists(filepath.Join(oldDir, name)) {
+			t.Errorf("%s was not moved", name)
+		}
+	}
+	for _, name := range []string{"Busy/e01.mkv", "Busy/e01.mkv.aria2", "unknown.txt"} {
+		if !exists(filepath.Join(oldDir, name)) || exists(filepath.Join(newDir, name)) {
+			t.Errorf("%s was moved", name)
+		}
+	}
+	if exists(filepath.Join(oldDir, "tv")) {
+		t.Error("emptied category directory was left behind")
+	}
+
+	for _, tt := range []struct {
+		transferID int64
+		want       string
+	}{
+		{1, newDir},
+		{2, filepath.Join(newDir, "tv")},
+		{3, oldDir},
+	} {
+		if got := m.TargetDir(tt.transferID); got != tt.want {
+			t.Errorf("TargetDir(%d) = %s, want %s", tt.transferID, got, tt.want)
+		}
+	}
+}
+
+func TestMigrateTargetDirLinks(t *testing.T) {
+	dir := t.TempDir()
+	oldDir, newDir := filepath.Join(dir, "old"), filepath.Join(dir, "new")
+	m := migrationManager(t, oldDir, config.MigrateModeLink)
+	m.targetDir = newDir
+
+	if err := m.MigrateTargetDir(oldDir); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"Show/e01.mkv", "tv/Series/e01.mkv", "Imported/movie.mkv"} {
+		if !exists(filepath.Join(newDir, name)) || !exists(filepath.Join(oldDir, name)) {
+			t.Errorf("%s was not linked", name)
+		}
+	}
+	if exists(filepath.Join(newDir, "unknown.txt")) || exists(filepath.Join(newDir, "Busy")) {
+		t.Error("unknown or busy downloads were linked")
+	}
+}
+
+func TestMigrateTargetDirRejectsNestedTarget(t *testing.T) {
+	dir := t.TempDir()
+	oldDir := filepath.Join(dir, "old")
+	m := migrationManager(t, oldDir, config.MigrateModeMove)
+
+	err := m.ChangeTargetDir(filepath.Join(oldDir, "new"))
+	if err == nil || !strings.Contains(err.Error(), "inside the old one") {
+		t.Fatalf("ChangeTargetDir into the old directory = %v, want an error", err)
+	}
+	if got := m.DefaultTargetDir(); got != oldDir {
+		t.Errorf("DefaultTargetDir = %s, want %s", got, oldDir)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(oldDir, "new")); len(entries) != 0 {
+		t.Errorf("new directory has %d entries, want none", len(entries))
+	}
+}
+
+func TestMigrateTargetDirOff(t *testing.T) {
+	dir := t.TempDir()
+	oldDir, newDir := filepath.Join(dir, "old"), filepath.Join(dir, "new")
+	m := migrationManager(t, oldDir, config.MigrateModeOff)
+
+	if err := m.ChangeTargetDir(newDir); err != nil {
+		t.Fatal(err)
+	}
+	if exists(newDir) || !exists(filepath.Join(oldDir, "Show", "e01.mkv")) {
+		t.Error("downloads were migrated with migrate-mode off")
+	}
+}
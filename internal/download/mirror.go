@@ -0,0 +1,258 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/elsbrock/go-putio"
+	"github.com/elsbrock/plundrio/internal/config"
+	"github.com/elsbrock/plundrio/internal/log"
+	"github.com/elsbrock/plundrio/internal/state"
+)
+
+// MirrorState is the name of the state document the files of mirrored folders
+// are kept in
+const MirrorState = "mirror"
+
+// MirroredFolders keeps what plundrio knows about each mirrored folder
+type MirroredFolders struct {
+	Folders map[int64]MirroredFolder `json:"folders"` // by folder ID
+}
+
+// MirroredFolder lists the files a mirrored folder had on put.io and locally
+// when it was last checked, so that files deleted on put.io can be deleted
+// locally, and the files deleted locally, which are not downloaded again
+type MirroredFolder struct {
+	Files      []string `json:"files"`                // names of the files on put.io
+	Local      []string `json:"local,omitempty"`      // names of the files downloaded completely
+	Tombstones []string `json:"tombstones,omitempty"` // names of the files deleted locally
+}
+
+// MirrorStatus is a mirror with what its last check found
+type MirrorStatus struct {
+	config.Mirror
+	Files      int      `json:"files"`      // files on put.io
+	Downloaded int      `json:"downloaded"` // files downloaded completely
+	Tombstones []string `json:"tombstones"` // files deleted locally, which are not downloaded again
+}
+
+// mirroredFolders keeps what plundrio knows about the mirrored folders
+type mirroredFolders struct {
+	run     sync.Mutex   // held while the folders are checked
+	mu      sync.Mutex   // protects folders
+	store   *state.Store // nil without a state directory
+	folders map[int64]MirroredFolder
+}
+
+// newMirroredFolders loads the files of the mirrored folders from the state
+// directory
+func newMirroredFolders(stateDir string) *mirroredFolders {
+	f := &mirroredFolders{folders: make(map[int64]MirroredFolder)}
+	if stateDir == "" {
+		return f
+	}
+
+	store, err := state.New(stateDir)
+	if err != nil {
+		log.Warn("mirror").Err(err).Msg("Mirrored files will not be remembered")
+		return f
+	}
+	f.store = store
+
+	var saved MirroredFolders
+	if err := store.Load(MirrorState, &saved); err != nil {
+		log.Warn("mirror").Err(err).Msg("Failed to load mirrored files")
+		return f
+	}
+	if saved.Folders != nil {
+		f.folders = saved.Folders
+	}
+	return f
+}
+
+// folder returns what is known about a mirrored folder
+func (f *mirroredFolders) folder(folderID int64) MirroredFolder {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.folders[folderID]
+}
+
+// update remembers the files a folder has on put.io and locally now, and adds
+// tombstones for the files deleted locally. Tombstones of files that are gone
+// from put.io or were put back locally are dropped.
+func (f *mirroredFolders) update(folderID int64, files, local, deleted []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var tombstones []string
+	for _, name := range f.folders[folderID].Tombstones {
+		if slices.Contains(files, name) && !slices.Contains(local, name) {
+			tombstones = append(tombstones, name)
+		}
+	}
+	f.folders[folderID] = MirroredFolder{Files: files, Local: local, Tombstones: append(tombstones, deleted...)}
+	f.save()
+}
+
+// save writes the mirrored folders to the state directory. The caller must
+// hold mu.
+func (f *mirroredFolders) save() {
+	if f.store == nil {
+		return
+	}
+	if err := f.store.Save(MirrorState, MirroredFolders{Folders: f.folders}); err != nil {
+		log.Warn("mirror").Err(err).Msg("Failed to save mirrored files")
+	}
+}
+
+// Mirrors returns the configured mirrors with what their last check found
+func (m *Manager) Mirrors() []MirrorStatus {
+	mirrors := make([]MirrorStatus, 0, len(m.cfg.Mirrors))
+	for _, mirror := range m.cfg.Mirrors {
+		folder := m.mirrored.folder(mirror.Folder)
+		mirrors = append(mirrors, MirrorStatus{
+			Mirror:     mirror,
+			Files:      len(folder.Files),
+			Downloaded: len(folder.Local),
+			Tombstones: append([]string{}, folder.Tombstones...),
+		})
+	}
+	return mirrors
+}
+
+// RestoreMirrored drops the tombstone of a file deleted locally from a
+// mirrored folder, or those of all its files if name is empty, so that the
+// next check downloads them again. It returns how many were dropped.
+func (m *Manager) RestoreMirrored(folderID int64, name string) (int, error) {
+	if !slices.ContainsFunc(m.cfg.Mirrors, func(mirror config.Mirror) bool { return mirror.Folder == folderID }) {
+		return 0, fmt.Errorf("folder %d is not mirrored", folderID)
+	}
+
+	f := m.mirrored
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	folder := f.folders[folderID]
+	before := len(folder.Tombstones)
+	folder.Tombstones = slices.DeleteFunc(folder.Tombstones, func(tombstone string) bool {
+		return name == "" || tombstone == name
+	})
+	restored := before - len(folder.Tombstones)
+	if restored > 0 {
+		f.folders[folderID] = folder
+		f.save()
+		log.Info("mirror").Int64("folder_id", folderID).Str("name", name).Int("files", restored).Msg("Restored files deleted locally")
+	}
+	return restored, nil
+}
+
+// mirror checks every mirrored folder for changes
+func (m *Manager) mirror(ctx context.Context) error {
+	m.mirrored.run.Lock()
+	defer m.mirrored.run.Unlock()
+
+	var errs []error
+	for _, mirror := range m.cfg.Mirrors {
+		if err := m.mirrorFolder(ctx, mirror); err != nil {
+			log.Error("mirror").Int64("folder_id", mirror.Folder).Err(err).Msg("Failed to mirror folder")
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// mirrorFolder downloads the files of a folder on put.io that are missing in
+// its local copy or changed, like QueueFile does, and deletes local files that
+// were deleted on put.io if the mirror says so. Only files plundrio saw in the
+// folder before are deleted or replaced, other local files are left alone.
+// Files that were downloaded and then deleted locally get a tombstone and are
+// not downloaded again until they are restored.
+func (m *Manager) mirrorFolder(ctx context.Context, mirror config.Mirror) error {
+	processor := m.GetTransferProcessor()
+	if processor == nil {
+		return errors.New("download manager is not running")
+	}
+	// The next check picks up what changed while files are downloaded
+	if m.manualQueued(manualTransferID(mirror.Folder)) {
+		log.Debug("mirror").Int64("folder_id", mirror.Folder).Msg("Mirrored folder is still being downloaded")
+		return nil
+	}
+
+	folder, err := m.provider.GetFile(ctx, mirror.Folder)
+	if err != nil {
+		return err
+	}
+	files, err := m.provider.GetAllTransferFiles(ctx, mirror.Folder)
+	if err != nil {
+		return err
+	}
+
+	targetDir := mirror.Target
+	if targetDir == "" {
+		targetDir = m.DefaultTargetDir()
+	}
+	// Files are placed like those of a transfer named like the folder
+	root := filepath.Join(targetDir, folder.Name)
+	last := m.mirrored.folder(mirror.Folder)
+
+	names := make([]string, 0, len(files))
+	var local, deleted []string
+	var missing []*putio.File
+	for _, file := range files {
+		names = append(names, file.Name)
+		path := longPath(filepath.Join(root, file.Name))
+		info, err := os.Stat(path)
+		written := err == nil && !isPartial(path)
+		if written && info.Size() == file.Size {
+			local = append(local, file.Name)
+			continue
+		}
+		if slices.Contains(last.Tombstones, file.Name) {
+			continue
+		}
+		if os.IsNotExist(err) && slices.Contains(last.Local, file.Name) {
+			log.Info("mirror").Str("file_name", file.Name).Int64("folder_id", mirror.Folder).Msg("File deleted locally, not downloading it again")
+			deleted = append(deleted, file.Name)
+			continue
+		}
+		if written && slices.Contains(last.Files, file.Name) {
+			// Changed on put.io; downloading it again would continue from
+			// the old file
+			log.Info("mirror").Str("file_name", file.Name).Int64("folder_id", mirror.Folder).Msg("File changed on put.io, replacing it")
+			os.Remove(path)
+		}
+		missing = append(missing, file)
+	}
+
+	if mirror.Delete {
+		for _, name := range last.Files {
+			if slices.Contains(names, name) {
+				continue
+			}
+			path := filepath.Join(root, name)
+			if err := os.Remove(longPath(path)); err != nil {
+				if !os.IsNotExist(err) {
+					log.Warn("mirror").Str("path", path).Err(err).Msg("Failed to delete file deleted on put.io")
+				}
+				continue
+			}
+			log.Info("mirror").Str("path", path).Int64("folder_id", mirror.Folder).Msg("Deleted file deleted on put.io")
+		}
+	}
+	m.mirrored.update(mirror.Folder, names, local, deleted)
+
+	if len(missing) == 0 {
+		log.Debug("mirror").Int64("folder_id", mirror.Folder).Str("name", folder.Name).Msg("Mirrored folder is up to date")
+		return nil
+	}
+	log.Info("mirror").
+		Int64("folder_id", mirror.Folder).
+		Str("name", folder.Name).
+		Int("files", len(missing)).
+		Msg("Downloading new files of mirrored folder")
+	return m.queueFiles(processor, folder, missing, targetDir)
+}
@@ -0,0 +1,128 @@
+package download
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/elsbrock/go-putio"
+	"github.com/elsbrock/plundrio/internal/config"
+	"github.com/elsbrock/plundrio/internal/provider"
+)
+
+// folderProvider serves a folder on put.io and the files in it
+type folderProvider struct {
+	provider.Provider
+	folder *putio.File
+	files  []*putio.File
+}
+
+func (p *folderProvider) GetFile(ctx context.Context, fileID int64) (*putio.File, error) {
+	return p.folder, nil
+}
+
+func (p *folderProvider) GetAllTransferFiles(ctx context.Context, fileID int64) ([]*putio.File, error) {
+	return p.files, nil
+}
+
+func TestMirroredFoldersUpdate(t *testing.T) {
+	stateDir := t.TempDir()
+	f := newMirroredFolders(stateDir)
+	f.update(1, []string{"a", "b", "c"}, []string{"a", "b"}, nil)
+	f.update(1, []string{"a", "b", "c"}, []string{"a"}, []string{"b"})
+
+	// Tombstones are kept while the file is on put.io and not put back
+	f.update(1, []string{"a", "b", "c", "d"}, []string{"a"}, []string{"c"})
+	want := MirroredFolder{Files: []string{"a", "b", "c", "d"}, Local: []string{"a"}, Tombstones: []string{"b", "c"}}
+	if got := newMirroredFolders(stateDir).folder(1); !reflect.DeepEqual(got, want) {
+		t.Errorf("folder after loading = %+v, want %+v", got, want)
+	}
+
+	f.update(1, []string{"a", "c"}, []string{"a", "c"}, nil)
+	if got := f.folder(1).Tombstones; len(got) != 0 {
+		t.Errorf("tombstones = %v, want those of files gone from put.io or put back dropped", got)
+	}
+}
+
+func TestRestoreMirrored(t *testing.T) {
+	stateDir := t.TempDir()
+	m := &Manager{
+		cfg:      &config.Config{Mirrors: []config.Mirror{{Folder: 1, Target: "/mirror"}}},
+		mirrored: newMirroredFolders(stateDir),
+	}
+	m.mirrored.update(1, []string{"a", "b", "c"}, nil, []string{"a", "b", "c"})
+
+	if _, err := m.RestoreMirrored(2, ""); err == nil {
+		t.Error("restoring files of a folder that is not mirrored succeeded")
+	}
+	if n, err := m.RestoreMirrored(1, "b"); err != nil || n != 1 {
+		t.Errorf("RestoreMirrored(1, b) = %d, %v, want 1", n, err)
+	}
+	if n, err := m.RestoreMirrored(1, "missing"); err != nil || n != 0 {
+		t.Errorf("RestoreMirrored(1, missing) = %d, %v, want 0", n, err)
+	}
+
+	m.mirrored = newMirroredFolders(stateDir)
+	want := []MirrorStatus{{Mirror: config.Mirror{Folder: 1, Target: "/mirror"}, Files: 3, Tombstones: []string{"a", "c"}}}
+	if got := m.Mirrors(); !reflect.DeepEqual(got, want) {
+		t.Errorf("mirrors = %+v, want %+v", got, want)
+	}
+
+	if n, err := m.RestoreMirrored(1, ""); err != nil || n != 2 {
+		t.Errorf("RestoreMirrored(1) = %d, %v, want 2", n, err)
+	}
+}
+
+func TestMirrorFolder(t *testing.T) {
+	target := t.TempDir()
+	root := filepath.Join(target, "Folder")
+	writeFiles(t, root, "a.mkv", "deleted on put.io.mkv", "not mirrored.txt")
+
+	p := &folderProvider{
+		folder: &putio.File{ID: 1, Name: "Folder"},
+		files: []*putio.File{
+			{Name: "a.mkv", Size: int64(len("a.mkv"))},
+			{Name: "deleted locally.mkv", Size: 10},
+			{Name: "tombstoned.mkv", Size: 10},
+		},
+	}
+	m := &Manager{
+		cfg:       &config.Config{Mirrors: []config.Mirror{{Folder: 1, Target: target, Delete: true}}},
+		provider:  p,
+		processor: &TransferProcessor{},
+		mirrored:  newMirroredFolders(""),
+	}
+	m.coordinator = NewTransferCoordinator(m)
+	m.mirrored.folders[1] = MirroredFolder{
+		Files:      []string{"a.mkv", "deleted locally.mkv", "deleted on put.io.mkv", "tombstoned.mkv"},
+		Local:      []string{"a.mkv", "deleted locally.mkv", "deleted on put.io.mkv"},
+		Tombstones: []string{"tombstoned.mkv", "gone.mkv"},
+	}
+
+	// Nothing is downloaded: files deleted locally stay deleted
+	if err := m.mirror(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want := MirroredFolder{
+		Files:      []string{"a.mkv", "deleted locally.mkv", "tombstoned.mkv"},
+		Local:      []string{"a.mkv"},
+		Tombstones: []string{"tombstoned.mkv", "deleted locally.mkv"},
+	}
+	if got := m.mirrored.folder(1); !reflect.DeepEqual(got, want) {
+		t.Errorf("folder = %+v, want %+v", got, want)
+	}
+	if exists(filepath.Join(root, "deleted on put.io.mkv")) {
+		t.Error("file deleted on put.io was kept")
+	}
+	if !exists(filepath.Join(root, "a.mkv")) || !exists(filepath.Join(root, "not mirrored.txt")) {
+		t.Error("files on put.io or unknown to the mirror were deleted")
+	}
+}
+
+func TestMirrorFolderNotRunning(t *testing.T) {
+	m := &Manager{cfg: &config.Config{Mirrors: []config.Mirror{{Folder: 1}}}, mirrored: newMirroredFolders("")}
+	if err := m.mirror(context.Background()); err == nil {
+		t.Error("mirroring succeeded without a running manager")
+	}
+}
@@ -0,0 +1,43 @@
+package download
+
+import (
+	"strings"
+
+	"github.com/elsbrock/plundrio/internal/config"
+)
+
+// isFUSE reports whether a filesystem type reported by the system is a FUSE
+// filesystem, such as fuse.rclone for rclone mount
+func isFUSE(fsType string) bool {
+	return fsType == "fuse" || strings.HasPrefix(fsType, "fuse.") || fsType == "fuseblk"
+}
+
+// isNetworkFS reports whether a filesystem type reported by the system is an
+// NFS or SMB share
+func isNetworkFS(fsType string) bool {
+	switch fsType {
+	case "nfs", "nfs4", "cifs", "smb3", "smbfs":
+		return true
+	}
+	return false
+}
+
+// targetType returns how files are written to a directory: the configured
+// target type, or with auto, mount for directories on FUSE filesystems and
+// local for all others
+func (m *Manager) targetType(dir string) string {
+	switch m.cfg.TargetType {
+	case config.TargetTypeLocal, config.TargetTypeMount:
+		return m.cfg.TargetType
+	}
+	if isFUSE(filesystemType(dir)) {
+		return config.TargetTypeMount
+	}
+	return config.TargetTypeLocal
+}
+
+// writesToMount reports whether files are written to a directory like to a
+// mount: in order, over a single connection and without preallocating them
+func (m *Manager) writesToMount(dir string) bool {
+	return m.targetType(dir) == config.TargetTypeMount
+}
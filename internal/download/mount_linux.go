@@ -0,0 +1,63 @@
+//go:build linux
+
+package download
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// filesystemType returns the type of the filesystem a path is on as listed in
+// /proc/self/mounts, e.g. ext4 or fuse.rclone, or an empty string if it is
+// unknown. The path does not need to exist yet.
+func filesystemType(path string) string {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return ""
+	}
+	for {
+		if resolved, err := filepath.EvalSymlinks(path); err == nil {
+			path = resolved
+			break
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			break
+		}
+		path = parent
+	}
+
+	file, err := os.Open("/proc/self/mounts")
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	// The mount point closest to the path wins, later mounts hide earlier ones
+	var fsType string
+	longest := -1
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			continue
+		}
+		mountPoint := unescapeMountPath(fields[1])
+		if path != mountPoint && !strings.HasPrefix(path, strings.TrimSuffix(mountPoint, "/")+"/") {
+			continue
+		}
+		if len(mountPoint) >= longest {
+			longest = len(mountPoint)
+			fsType = fields[2]
+		}
+	}
+	return fsType
+}
+
+// unescapeMountPath decodes the octal escapes of spaces, tabs, newlines and
+// backslashes in a path listed in /proc/self/mounts
+func unescapeMountPath(path string) string {
+	return strings.NewReplacer(`\040`, " ", `\011`, "\t", `\012`, "\n", `\134`, `\`).Replace(path)
+}
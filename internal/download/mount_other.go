@@ -0,0 +1,9 @@
+//go:build !linux
+
+package download
+
+// filesystemType is not known on this platform, so auto writes to all target
+// directories like to local ones
+func filesystemType(path string) string {
+	return ""
+}
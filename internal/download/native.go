@@ -0,0 +1,497 @@
+package download
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/config"
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// nativeControlSuffix is appended to the path of a file the native
+// downloader is working on to name its control file, like aria2c's .aria2
+const nativeControlSuffix = ".plundrio"
+
+const (
+	nativeMinSegment   = 1 << 20         // smallest segment a file is split into, like aria2c's -k 1M
+	nativeMaxTries     = 5               // requests per segment before the download fails, like aria2c's --max-tries
+	nativeBufferSize   = 256 << 10       // bytes read from a connection at once
+	nativeSaveInterval = 5 * time.Second // how often the control file is written during a download
+)
+
+// controlSuffixes are the suffixes of the control files the downloaders keep
+// next to files they have not finished yet
+var controlSuffixes = []string{".aria2", nativeControlSuffix}
+
+// isPartial reports whether a downloader left a control file next to the
+// file at path, which means it is not completely downloaded
+func isPartial(path string) bool {
+	for _, suffix := range controlSuffixes {
+		if _, err := os.Stat(path + suffix); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// useNativeDownloader reports whether files are downloaded by the native
+// downloader rather than aria2c
+func useNativeDownloader(downloader string) bool {
+	switch downloader {
+	case config.DownloaderNative:
+		return true
+	case config.DownloaderAria2c:
+		return false
+	}
+	_, err := exec.LookPath("aria2c")
+	return err != nil
+}
+
+// downloader names what downloads files, for logs
+func (m *Manager) downloader() string {
+	if m.httpClient != nil {
+		return config.DownloaderNative
+	}
+	return config.DownloaderAria2c
+}
+
+// newNativeClient creates the HTTP client of the native downloader. Only
+// connecting and waiting for the response headers time out, as downloads
+// take as long as they take; stalled downloads are noticed by monitorNative.
+func newNativeClient(cfg *DownloadConfig) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = cfg.DownloadHeaderTimeout
+	transport.IdleConnTimeout = cfg.IdleConnectionTimeout
+	transport.MaxIdleConnsPerHost = cfg.ConnectionBudget
+	transport.DisableCompression = true // ranges refer to the file, not a compressed stream
+	return &http.Client{Transport: transport}
+}
+
+// nativeSegment is a range of a file downloaded over one connection
+type nativeSegment struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`  // exclusive, -1 if the size is unknown
+	Done  int64 `json:"done"` // bytes downloaded from Start on
+}
+
+// nativeControl is the control file of a download, telling how far each
+// segment got
+type nativeControl struct {
+	Size     int64            `json:"size"`
+	Segments []*nativeSegment `json:"segments"`
+}
+
+// splitSegments splits a file into one segment per connection, but none
+// smaller than nativeMinSegment
+func splitSegments(size int64, connections int) []*nativeSegment {
+	n := int64(max(connections, 1))
+	if limit := size / nativeMinSegment; n > limit {
+		n = max(limit, 1)
+	}
+	length := size / n
+	segments := make([]*nativeSegment, 0, n)
+	for i := int64(0); i < n; i++ {
+		segment := &nativeSegment{Start: i * length, End: (i + 1) * length}
+		if i == n-1 {
+			segment.End = size
+		}
+		segments = append(segments, segment)
+	}
+	return segments
+}
+
+// loadNativeControl reads the control file of an interrupted download of a
+// file of the given size, or returns nil if there is none to continue
+func loadNativeControl(path string, size int64) *nativeControl {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var control nativeControl
+	if err := json.Unmarshal(data, &control); err != nil || control.Size != size || len(control.Segments) == 0 {
+		return nil
+	}
+	return &control
+}
+
+// rateLimiter spreads the reads of one or all downloads so they stay below a
+// speed limit
+type rateLimiter struct {
+	mu   sync.Mutex
+	rate float64   // bytes per second, 0 is unlimited
+	next time.Time // when the bytes read so far are paid off
+}
+
+// setRate changes the speed limit, 0 is unlimited
+func (l *rateLimiter) setRate(rate float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rate = rate
+}
+
+// wait blocks until n more bytes fit within the speed limit
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	if l.rate <= 0 {
+		l.mu.Unlock()
+		return nil
+	}
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(float64(n) / l.rate * float64(time.Second)))
+	delay := l.next.Sub(now)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// nativeDownload is a file being downloaded by the native downloader
+type nativeDownload struct {
+	state     *DownloadState
+	client    *http.Client
+	url       string
+	ranges    bool // the server serves ranges, so segments can be downloaded and resumed
+	file      *os.File
+	limiter   *rateLimiter // limits this download
+	transfer  *rateLimiter // limits all downloads of the transfer together
+	overall   *rateLimiter // limits all downloads together
+	retryWait time.Duration
+
+	mu      sync.Mutex // protects control
+	control nativeControl
+	path    string // of the control file
+}
+
+// downloaded returns the bytes downloaded so far
+func (d *nativeDownload) downloaded() int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var done int64
+	for _, segment := range d.control.Segments {
+		done += segment.Done
+	}
+	return done
+}
+
+// save writes the control file
+func (d *nativeDownload) save() {
+	d.mu.Lock()
+	data, err := json.Marshal(d.control)
+	d.mu.Unlock()
+	if err == nil {
+		err = os.WriteFile(d.path, data, 0644)
+	}
+	if err != nil {
+		log.Warn("download").
+			Str("file_name", d.state.Name).
+			Int64("transfer_id", d.state.TransferID).
+			Err(err).
+			Msg("Failed to save download progress, an interruption restarts the download")
+	}
+}
+
+// downloadNative downloads a file over up to connections HTTP connections,
+// each fetching a segment of it with Range requests. How far each segment got
+// is kept in a control file next to the download, so an interrupted download
+// continues where it stopped, also with a fresh URL. Servers that do not serve
+// ranges are downloaded from over a single connection from the start.
+func (m *Manager) downloadNative(ctx context.Context, state *DownloadState, url, targetPath string, connections, retryWait int) error {
+	size, ranges, err := m.probeNative(ctx, url, state.Name)
+	if err != nil {
+		return err
+	}
+
+	transferLimiter, leave := m.joinTransferLimit(state.TransferID)
+	defer leave()
+
+	d := &nativeDownload{
+		state:     state,
+		client:    m.httpClient,
+		url:       url,
+		ranges:    ranges,
+		limiter:   &rateLimiter{rate: float64(m.speedLimit()) * 1024},
+		transfer:  transferLimiter,
+		overall:   m.overall,
+		retryWait: time.Duration(retryWait) * time.Second,
+		path:      longPath(targetPath + nativeControlSuffix),
+	}
+	resumed := false
+	if control := loadNativeControl(d.path, size); ranges && control != nil {
+		d.control = *control
+		resumed = true
+	} else if ranges {
+		d.control = nativeControl{Size: size, Segments: splitSegments(size, connections)}
+	} else {
+		d.control = nativeControl{Size: size, Segments: []*nativeSegment{{End: size}}}
+	}
+
+	d.file, err = os.OpenFile(longPath(targetPath), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return NewFileSystemError(state.Name, err)
+	}
+	defer d.file.Close()
+	if !resumed && !state.mount {
+		if err := d.file.Truncate(max(size, 0)); err != nil {
+			return NewFileSystemError(state.Name, err)
+		}
+	}
+	d.save()
+
+	log.Info("download").
+		Str("file_name", state.Name).
+		Int64("transfer_id", state.TransferID).
+		Int("segments", len(d.control.Segments)).
+		Int64("resumed_bytes", d.downloaded()).
+		Bool("ranges", ranges).
+		Msg("Downloading segments")
+
+	segmentCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	var wg sync.WaitGroup
+	for _, segment := range d.control.Segments {
+		if segment.End >= 0 && segment.Start+segment.Done >= segment.End {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := d.fetchSegment(segmentCtx, segment); err != nil {
+				cancel(err)
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	monitorDone := make(chan struct{})
+	go func() {
+		m.monitorNative(d, done, cancel)
+		close(monitorDone)
+	}()
+	wg.Wait()
+	close(done)
+	<-monitorDone
+
+	if err := context.Cause(segmentCtx); err != nil {
+		d.save()
+		return err
+	}
+	if err := d.file.Close(); err != nil {
+		return NewFileSystemError(state.Name, err)
+	}
+	os.Remove(d.path)
+	return nil
+}
+
+// probeNative requests the first byte of a file to learn its size and
+// whether the server serves ranges. The size is -1 if the server does not
+// tell it.
+func (m *Manager) probeNative(ctx context.Context, url, name string) (int64, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, false, err
+	}
+	req.Header.Set("Range", "bytes=0-0")
+	resp, err := m.httpClient.Do(req)
+	if err != nil {
+		return 0, false, NewNetworkError(name, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		// Content-Range: bytes 0-0/1234567
+		_, total, _ := strings.Cut(resp.Header.Get("Content-Range"), "/")
+		if size, err := strconv.ParseInt(total, 10, 64); err == nil {
+			return size, true, nil
+		}
+		return -1, false, nil
+	case http.StatusOK:
+		return resp.ContentLength, false, nil
+	case http.StatusRequestedRangeNotSatisfiable:
+		// Empty files have no first byte
+		return 0, true, nil
+	}
+	return 0, false, NewHTTPStatusError(name, resp.StatusCode)
+}
+
+// fetchSegment downloads what is left of a segment, retrying network
+// problems and server errors like aria2c does
+func (d *nativeDownload) fetchSegment(ctx context.Context, segment *nativeSegment) error {
+	var err error
+	for try := 1; try <= nativeMaxTries; try++ {
+		if err = d.fetch(ctx, segment); err == nil || ctx.Err() != nil || !retryableSegmentError(err) {
+			return err
+		}
+		log.TransferOutput(d.state.TransferID, "native", d.state.Name,
+			fmt.Sprintf("segment %d-%d failed (try %d of %d): %v", segment.Start, segment.End, try, nativeMaxTries, err))
+
+		timer := time.NewTimer(d.retryWait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return err
+}
+
+// retryableSegmentError reports whether requesting a segment again may
+// succeed. Expired URLs and rate limits are left to downloadWithRetry, which
+// gets a fresh URL or waits longer.
+func retryableSegmentError(err error) bool {
+	var downloadErr *DownloadError
+	if !errors.As(err, &downloadErr) {
+		return false
+	}
+	return downloadErr.Transient && downloadErr.Type != "URLExpired" && downloadErr.Type != "RateLimited"
+}
+
+// fetch requests the rest of a segment and writes it to the file
+func (d *nativeDownload) fetch(ctx context.Context, segment *nativeSegment) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.url, nil)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	if !d.ranges {
+		// Without ranges every request starts over
+		segment.Done = 0
+	}
+	offset, end := segment.Start+segment.Done, segment.End
+	d.mu.Unlock()
+
+	expected := http.StatusOK
+	if d.ranges {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, end-1))
+		expected = http.StatusPartialContent
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return NewNetworkError(d.state.Name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != expected {
+		return NewHTTPStatusError(d.state.Name, resp.StatusCode)
+	}
+
+	buf := make([]byte, nativeBufferSize)
+	for {
+		n, readErr := resp.Body.Read(buf)
+		if end >= 0 && offset+int64(n) > end {
+			n = int(end - offset)
+		}
+		if n > 0 {
+			if err := d.limiter.wait(ctx, n); err != nil {
+				return err
+			}
+			if err := d.transfer.wait(ctx, n); err != nil {
+				return err
+			}
+			if err := d.overall.wait(ctx, n); err != nil {
+				return err
+			}
+			if _, err := d.file.WriteAt(buf[:n], offset); err != nil {
+				return NewFileSystemError(d.state.Name, err)
+			}
+			offset += int64(n)
+			d.mu.Lock()
+			segment.Done += int64(n)
+			d.mu.Unlock()
+		}
+		if readErr == io.EOF || (end >= 0 && offset >= end) {
+			break
+		}
+		if readErr != nil {
+			return NewNetworkError(d.state.Name, readErr)
+		}
+	}
+	if end >= 0 && offset < end {
+		return NewNetworkError(d.state.Name, io.ErrUnexpectedEOF)
+	}
+	return nil
+}
+
+// monitorNative reports the progress of a native download like
+// monitorAria2c does, saves the control file now and then and
+// cancels the download when no data arrived for DownloadStallTimeout
+func (m *Manager) monitorNative(d *nativeDownload, done chan struct{}, cancel context.CancelCauseFunc) {
+	state := d.state
+	defer m.fileSpeeds.Delete(state.FileID)
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	last, lastTick := d.downloaded(), time.Now()
+	lastChange, lastSave, lastLog := lastTick, lastTick, lastTick
+
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			downloaded := d.downloaded()
+			speed := float64(downloaded-last) / now.Sub(lastTick).Seconds()
+			if downloaded != last {
+				lastChange = now
+			}
+			last, lastTick = downloaded, now
+
+			state.mu.Lock()
+			state.downloaded = downloaded
+			if d.control.Size > 0 {
+				state.Progress = float64(downloaded) / float64(d.control.Size) * 100
+			}
+			if speed > 0 {
+				state.speedSum += speed
+				state.speedSamples++
+			}
+			progress := state.Progress
+			state.LastProgress = now
+			state.mu.Unlock()
+			m.fileSpeeds.Store(state.FileID, speed)
+
+			if now.Sub(lastChange) >= m.dlConfig.DownloadStallTimeout {
+				cancel(NewNetworkError(state.Name, fmt.Errorf("no data received for %s", m.dlConfig.DownloadStallTimeout)))
+			}
+			if now.Sub(lastSave) >= nativeSaveInterval {
+				d.save()
+				lastSave = now
+			}
+			if now.Sub(lastLog) >= m.dlConfig.ProgressUpdateInterval {
+				eta := ""
+				if speed > 0 && d.control.Size > 0 {
+					eta = (time.Duration(float64(d.control.Size-downloaded)/speed) * time.Second).Round(time.Second).String()
+				}
+				log.Info("download").
+					Str("file_name", state.Name).
+					Int64("transfer_id", state.TransferID).
+					Float64("progress_percent", progress).
+					Float64("speed_mbps", speed/1024/1024).
+					Str("eta", eta).
+					Msg("Download progress")
+				lastLog = now
+			}
+		}
+	}
+}
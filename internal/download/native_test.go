@@ -0,0 +1,357 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/config"
+)
+
+// fileServer serves a file like the download servers of put.io do, or like
+// servers that do not serve ranges or do not tell the size
+type fileServer struct {
+	content    []byte
+	ranges     bool // serve Range requests
+	size       bool // send the Content-Length of responses without ranges
+	cutRequest int  // number of the request that is cut off halfway, 0 for none
+
+	mu       sync.Mutex
+	requests []string // Range headers of the requests so far
+}
+
+func (f *fileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.requests = append(f.requests, r.Header.Get("Range"))
+	n := len(f.requests)
+	f.mu.Unlock()
+
+	if f.ranges && len(f.content) == 0 && r.Header.Get("Range") != "" {
+		// Empty files have no range to serve. ServeContent answers 200
+		// instead, but most servers answer 416.
+		w.Header().Set("Content-Range", "bytes */0")
+		w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+	if f.ranges {
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(f.content))
+		return
+	}
+	if f.size {
+		w.Header().Set("Content-Length", strconv.Itoa(len(f.content)))
+	}
+	w.WriteHeader(http.StatusOK)
+	w.(http.Flusher).Flush()
+	if n == f.cutRequest {
+		w.Write(f.content[:len(f.content)/2])
+		panic(http.ErrAbortHandler)
+	}
+	w.Write(f.content)
+}
+
+// downloadRequests returns the Range headers of the requests after the
+// probe, sorted
+func (f *fileServer) downloadRequests() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	requests := slices.Clone(f.requests[1:])
+	slices.Sort(requests)
+	return requests
+}
+
+// testContent returns n bytes that differ from one offset to the next
+func testContent(n int) []byte {
+	content := make([]byte, n)
+	for i := range content {
+		content[i] = byte(i * 7 % 251)
+	}
+	return content
+}
+
+// nativeManager returns a manager that downloads with the native downloader
+func nativeManager(dir string) *Manager {
+	return &Manager{
+		cfg:        &config.Config{},
+		dlConfig:   &DownloadConfig{DownloadStallTimeout: time.Minute, ProgressUpdateInterval: time.Minute},
+		httpClient: newNativeClient(&DownloadConfig{ConnectionBudget: 4}),
+		overall:    &rateLimiter{},
+		notes:      newAnnotations(""),
+		targetDir:  dir,
+		targetDirs: newTargetDirOverrides(""),
+		limits:     transferLimits{transfers: make(map[int64]*transferLimit)},
+	}
+}
+
+// downloadTest downloads the file at url to path over up to four connections
+func (m *Manager) downloadTest(url, path string) error {
+	state := &DownloadState{TransferID: 1, FileID: 1, Name: filepath.Base(path)}
+	return m.downloadNative(context.Background(), state, url, path, 4, 0)
+}
+
+// checkDownloaded fails the test unless path has the content and its
+// control file is gone
+func checkDownloaded(t *testing.T, path string, content []byte) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Errorf("downloaded %d bytes that differ from the %d bytes served", len(data), len(content))
+	}
+	if exists(path + nativeControlSuffix) {
+		t.Error("control file was left behind")
+	}
+}
+
+func TestSplitSegments(t *testing.T) {
+	for _, tt := range []struct {
+		size        int64
+		connections int
+		want        []nativeSegment
+	}{
+		{0, 4, []nativeSegment{{0, 0, 0}}},
+		{nativeMinSegment / 2, 4, []nativeSegment{{0, nativeMinSegment / 2, 0}}},
+		{nativeMinSegment * 3 / 2, 4, []nativeSegment{{0, nativeMinSegment * 3 / 2, 0}}},
+		{4 * nativeMinSegment, 0, []nativeSegment{{0, 4 * nativeMinSegment, 0}}},
+		{4 * nativeMinSegment, 2, []nativeSegment{{0, 2 * nativeMinSegment, 0}, {2 * nativeMinSegment, 4 * nativeMinSegment, 0}}},
+		{3*nativeMinSegment + 2, 16, []nativeSegment{
+			{0, nativeMinSegment, 0},
+			{nativeMinSegment, 2 * nativeMinSegment, 0},
+			{2 * nativeMinSegment, 3*nativeMinSegment + 2, 0},
+		}},
+	} {
+		t.Run(fmt.Sprintf("%d bytes over %d connections", tt.size, tt.connections), func(t *testing.T) {
+			var got []nativeSegment
+			for _, segment := range splitSegments(tt.size, tt.connections) {
+				got = append(got, *segment)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("segments = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadNativeControl(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	for _, tt := range []struct {
+		name string
+		path string
+		want *nativeControl
+	}{
+		{"missing", filepath.Join(dir, "missing"), nil},
+		{"corrupt", write("corrupt", `{"size":`), nil},
+		{"other size", write("other", `{"size":99,"segments":[{"start":0,"end":99,"done":5}]}`), nil},
+		{"no segments", write("empty", `{"size":100,"segments":[]}`), nil},
+		{"valid", write("valid", `{"size":100,"segments":[{"start":0,"end":50,"done":5},{"start":50,"end":100,"done":50}]}`),
+			&nativeControl{Size: 100, Segments: []*nativeSegment{{0, 50, 5}, {50, 100, 50}}}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := loadNativeControl(tt.path, 100); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("loadNativeControl = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProbeNative(t *testing.T) {
+	content := testContent(1000)
+	for _, tt := range []struct {
+		name    string
+		handler http.Handler
+		size    int64
+		ranges  bool
+	}{
+		{"ranges", &fileServer{content: content, ranges: true}, 1000, true},
+		{"empty file", &fileServer{content: nil, ranges: true}, 0, true},
+		{"no ranges", &fileServer{content: content, size: true}, 1000, false},
+		{"unknown size", &fileServer{content: content}, -1, false},
+		{"range of unknown total", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Range", "bytes 0-0/*")
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(content[:1])
+		}), -1, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.handler)
+			defer server.Close()
+
+			size, ranges, err := nativeManager(t.TempDir()).probeNative(context.Background(), server.URL, "file.bin")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if size != tt.size || ranges != tt.ranges {
+				t.Errorf("probe = %d, %v, want %d, %v", size, ranges, tt.size, tt.ranges)
+			}
+		})
+	}
+
+	t.Run("error status", func(t *testing.T) {
+		server := httptest.NewServer(http.NotFoundHandler())
+		defer server.Close()
+		if _, _, err := nativeManager(t.TempDir()).probeNative(context.Background(), server.URL, "file.bin"); err == nil {
+			t.Error("probe of a missing file succeeded")
+		}
+	})
+}
+
+func TestDownloadNative(t *testing.T) {
+	content := testContent(4 * nativeMinSegment)
+	for _, tt := range []struct {
+		name     string
+		server   *fileServer
+		requests []string
+	}{
+		{
+			name:   "ranges",
+			server: &fileServer{content: content, ranges: true},
+			requests: []string{
+				fmt.Sprintf("bytes=0-%d", nativeMinSegment-1),
+				fmt.Sprintf("bytes=%d-%d", nativeMinSegment, 2*nativeMinSegment-1),
+				fmt.Sprintf("bytes=%d-%d", 2*nativeMinSegment, 3*nativeMinSegment-1),
+				fmt.Sprintf("bytes=%d-%d", 3*nativeMinSegment, len(content)-1),
+			},
+		},
+		{"no ranges", &fileServer{content: content, size: true}, []string{""}},
+		{"unknown size", &fileServer{content: content}, []string{""}},
+		{"no ranges after a broken connection", &fileServer{content: content, size: true, cutRequest: 2}, []string{"", ""}},
+		{"unknown size after a broken connection", &fileServer{content: content, cutRequest: 2}, []string{"", ""}},
+		{"empty file", &fileServer{content: []byte{}, ranges: true}, nil},
+		{"empty file without ranges", &fileServer{content: []byte{}, size: true}, nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.server)
+			defer server.Close()
+
+			path := filepath.Join(t.TempDir(), "file.bin")
+			if err := nativeManager(filepath.Dir(path)).downloadTest(server.URL, path); err != nil {
+				t.Fatal(err)
+			}
+			checkDownloaded(t, path, tt.server.content)
+			if got := tt.server.downloadRequests(); !slices.Equal(got, tt.requests) {
+				t.Errorf("requests = %q, want %q", got, tt.requests)
+			}
+		})
+	}
+}
+
+func TestDownloadNativeResume(t *testing.T) {
+	content := testContent(4*nativeMinSegment + 123)
+	size := int64(len(content))
+
+	// prepare writes what an interrupted download left behind: half of
+	// every segment and a control file of a file of controlSize bytes
+	prepare := func(t *testing.T, path string, controlSize int64) []*nativeSegment {
+		t.Helper()
+		segments := splitSegments(size, 4)
+		partial := make([]byte, size)
+		for _, segment := range segments {
+			segment.Done = (segment.End - segment.Start) / 2
+			copy(partial[segment.Start:], content[segment.Start:segment.Start+segment.Done])
+		}
+		if err := os.WriteFile(path, partial, 0644); err != nil {
+			t.Fatal(err)
+		}
+		data, err := json.Marshal(nativeControl{Size: controlSize, Segments: segments})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path+nativeControlSuffix, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return segments
+	}
+
+	t.Run("continues every segment", func(t *testing.T) {
+		server := &fileServer{content: content, ranges: true}
+		ts := httptest.NewServer(server)
+		defer ts.Close()
+
+		path := filepath.Join(t.TempDir(), "file.bin")
+		var want []string
+		for _, segment := range prepare(t, path, size) {
+			want = append(want, fmt.Sprintf("bytes=%d-%d", segment.Start+segment.Done, segment.End-1))
+		}
+		slices.Sort(want)
+
+		if err := nativeManager(filepath.Dir(path)).downloadTest(ts.URL, path); err != nil {
+			t.Fatal(err)
+		}
+		checkDownloaded(t, path, content)
+		if got := server.downloadRequests(); !slices.Equal(got, want) {
+			t.Errorf("requests = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("starts over for another size", func(t *testing.T) {
+		server := &fileServer{content: content, ranges: true}
+		ts := httptest.NewServer(server)
+		defer ts.Close()
+
+		path := filepath.Join(t.TempDir(), "file.bin")
+		var want []string
+		for _, segment := range prepare(t, path, size+1) {
+			want = append(want, fmt.Sprintf("bytes=%d-%d", segment.Start, segment.End-1))
+		}
+		slices.Sort(want)
+
+		if err := nativeManager(filepath.Dir(path)).downloadTest(ts.URL, path); err != nil {
+			t.Fatal(err)
+		}
+		checkDownloaded(t, path, content)
+		if got := server.downloadRequests(); !slices.Equal(got, want) {
+			t.Errorf("requests = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("starts over without ranges", func(t *testing.T) {
+		server := &fileServer{content: content, size: true}
+		ts := httptest.NewServer(server)
+		defer ts.Close()
+
+		path := filepath.Join(t.TempDir(), "file.bin")
+		prepare(t, path, size)
+
+		if err := nativeManager(filepath.Dir(path)).downloadTest(ts.URL, path); err != nil {
+			t.Fatal(err)
+		}
+		checkDownloaded(t, path, content)
+		if got, want := server.downloadRequests(), []string{""}; !slices.Equal(got, want) {
+			t.Errorf("requests = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("keeps the progress of a failed download", func(t *testing.T) {
+		ts := httptest.NewServer(http.NotFoundHandler())
+		ts.Close()
+
+		path := filepath.Join(t.TempDir(), "file.bin")
+		prepare(t, path, size)
+		if err := nativeManager(filepath.Dir(path)).downloadTest(ts.URL, path); err == nil {
+			t.Fatal("download from a closed server succeeded")
+		}
+		if loadNativeControl(path+nativeControlSuffix, size) == nil {
+			t.Error("control file of the interrupted download was lost")
+		}
+	})
+}
@@ -0,0 +1,157 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/config"
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+const (
+	staleRetries     = 3                      // how often a stale NFS file handle is looked up again
+	staleRetryWait   = 500 * time.Millisecond // wait before looking it up again
+	verifySamples    = 8                      // parts of a file compared with the source in sample mode
+	verifySampleSize = 64 << 10               // bytes per part
+)
+
+// statRetry returns the file info of a path like os.Stat, but looks the path
+// up again when an NFS server reports a stale file handle, which happens
+// right after files were renamed or replaced on another client
+func statRetry(path string) (os.FileInfo, error) {
+	info, err := os.Stat(path)
+	for try := 1; try <= staleRetries && errors.Is(err, syscall.ESTALE); try++ {
+		time.Sleep(staleRetryWait)
+		info, err = os.Stat(path)
+	}
+	return info, err
+}
+
+// verifyWritten checks a download on an NFS or SMB share once it is written,
+// as network filesystems may report a write as done that never fully reached
+// the server. The size is read back from the server; with network-verify
+// sample, parts of the file are also compared with the source. A file that
+// fails the check is removed, so it is downloaded again from the start.
+func (m *Manager) verifyWritten(ctx context.Context, state *DownloadState, url, targetPath string, info os.FileInfo) error {
+	mode := m.cfg.NetworkVerify
+	if mode == "" || mode == config.NetworkVerifyOff {
+		return nil
+	}
+	fsType := filesystemType(filepath.Dir(targetPath))
+	if !isNetworkFS(fsType) {
+		return nil
+	}
+
+	err := verifySize(state, info)
+	if err == nil && mode == config.NetworkVerifySample {
+		err = m.compareSamples(ctx, state, url, targetPath, info.Size())
+	}
+	if err != nil {
+		log.Warn("download").
+			Str("file_name", state.Name).
+			Int64("transfer_id", state.TransferID).
+			Str("filesystem", fsType).
+			Err(err).
+			Msg("Download failed verification on network filesystem, downloading it again")
+		os.Remove(longPath(targetPath))
+		return err
+	}
+	log.Debug("download").
+		Str("file_name", state.Name).
+		Int64("transfer_id", state.TransferID).
+		Str("filesystem", fsType).
+		Str("mode", mode).
+		Msg("Verified download on network filesystem")
+	return nil
+}
+
+// verifySize compares the size the server reports for a file with the
+// expected size
+func verifySize(state *DownloadState, info os.FileInfo) error {
+	if state.Size > 0 && info.Size() != state.Size {
+		return NewShortWriteError(state.Name, fmt.Sprintf("size is %d bytes instead of %d", info.Size(), state.Size))
+	}
+	return nil
+}
+
+// sampleOffsets returns where the parts compared with the source start:
+// spread evenly from the start to the end of the file
+func sampleOffsets(size int64) []int64 {
+	if size <= verifySampleSize {
+		return []int64{0}
+	}
+	last := size - verifySampleSize
+	offsets := make([]int64, 0, verifySamples)
+	for i := int64(0); i < verifySamples; i++ {
+		offsets = append(offsets, last*i/(verifySamples-1))
+	}
+	return offsets
+}
+
+// compareSamples compares parts of a file read back from the server with the
+// same parts of the source. Parts that cannot be fetched from the source are
+// not compared, a network problem is no reason to download the file again.
+func (m *Manager) compareSamples(ctx context.Context, state *DownloadState, url, targetPath string, size int64) error {
+	if size <= 0 {
+		return nil
+	}
+	// A newly opened file is read from the server, not from what this client
+	// remembers writing
+	file, err := os.Open(longPath(targetPath))
+	if err != nil {
+		return NewShortWriteError(state.Name, err.Error())
+	}
+	defer file.Close()
+
+	client := m.httpClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	local := make([]byte, verifySampleSize)
+	for _, offset := range sampleOffsets(size) {
+		length := min(int64(verifySampleSize), size-offset)
+		source, err := fetchRange(ctx, client, url, offset, length)
+		if err != nil {
+			log.Debug("download").
+				Str("file_name", state.Name).
+				Int64("offset", offset).
+				Err(err).
+				Msg("Could not fetch part of the source to compare")
+			continue
+		}
+		n, err := file.ReadAt(local[:length], offset)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return NewShortWriteError(state.Name, err.Error())
+		}
+		if !bytes.Equal(local[:n], source) {
+			return NewShortWriteError(state.Name, fmt.Sprintf("%d bytes at offset %d differ from the source", length, offset))
+		}
+	}
+	return nil
+}
+
+// fetchRange downloads length bytes of a file starting at offset
+func fetchRange(ctx context.Context, client *http.Client, url string, offset, length int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return nil, fmt.Errorf("server answered %s to a range request", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, length))
+}
@@ -0,0 +1,19 @@
+//go:build darwin || freebsd
+
+package download
+
+import "golang.org/x/sys/unix"
+
+// networkShare reports whether a directory is on a network share, where
+// kqueue does not see changes made by other machines
+func networkShare(dir string) bool {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(dir, &stat); err != nil {
+		return false
+	}
+	switch unix.ByteSliceToString(stat.Fstypename[:]) {
+	case "nfs", "smbfs", "afpfs", "webdav":
+		return true
+	}
+	return false
+}
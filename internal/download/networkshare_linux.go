@@ -0,0 +1,9 @@
+//go:build linux
+
+package download
+
+// networkShare reports whether a directory is on an NFS or SMB share, where
+// inotify does not see changes made by other machines
+func networkShare(dir string) bool {
+	return isNetworkFS(filesystemType(dir))
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package download
+
+// networkShare is not known on this platform, so directories are treated as
+// local ones
+func networkShare(dir string) bool {
+	return false
+}
@@ -0,0 +1,24 @@
+//go:build windows
+
+package download
+
+import (
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/windows"
+)
+
+// networkShare reports whether a directory is on a UNC path or a mapped
+// network drive. Not every SMB server sends change notifications, and
+// ReadDirectoryChangesW misses changes on those that do not.
+func networkShare(dir string) bool {
+	if strings.HasPrefix(dir, `\\`) {
+		return true
+	}
+	root, err := windows.UTF16PtrFromString(filepath.VolumeName(dir) + `\`)
+	if err != nil {
+		return false
+	}
+	return windows.GetDriveType(root) == windows.DRIVE_REMOTE
+}
@@ -0,0 +1,188 @@
+package download
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elsbrock/go-putio"
+	"github.com/elsbrock/plundrio/internal/log"
+	"github.com/elsbrock/plundrio/internal/state"
+)
+
+// NotesState is the name of the state document holding the notes and
+// metadata attached to transfers
+const NotesState = "notes"
+
+// notesTTL is how long notes are kept after they were last changed, long
+// after the transfer left put.io so they still show in the history
+const notesTTL = 90 * 24 * time.Hour
+
+// Annotation is free-form text and key/value metadata attached to a transfer,
+// such as the source URL or a ticket ID, and the user who added it
+type Annotation struct {
+	Notes       string            `json:"notes,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	RequestedBy string            `json:"requested_by,omitempty"` // API user the transfer was added by
+	Priority    int               `json:"priority,omitempty"`     // PriorityLow, PriorityNormal or PriorityHigh
+	SpeedLimit  int               `json:"speed_limit,omitempty"`  // KB/s for all files of the transfer together, 0 uses the category's
+	UpdatedAt   time.Time         `json:"updated_at"`
+}
+
+// Empty reports whether the annotation has neither notes, metadata, a user,
+// a priority nor a speed limit
+func (a Annotation) Empty() bool {
+	return a.Notes == "" && len(a.Metadata) == 0 && a.RequestedBy == "" && a.Priority == PriorityNormal && a.SpeedLimit == 0
+}
+
+// Notes lists the annotations of transfers by ID, and those of transfers
+// added through plundrio the provider does not list yet by info hash or link
+type Notes struct {
+	Transfers map[int64]Annotation  `json:"transfers"`
+	Pending   map[string]Annotation `json:"pending,omitempty"`
+}
+
+// annotations keeps the notes and metadata of transfers in the state directory
+type annotations struct {
+	mu        sync.Mutex
+	store     *state.Store // nil without a state directory
+	transfers map[int64]Annotation
+	pending   map[string]Annotation
+}
+
+// newAnnotations loads the annotations of earlier runs from the state directory
+func newAnnotations(stateDir string) *annotations {
+	a := &annotations{
+		transfers: make(map[int64]Annotation),
+		pending:   make(map[string]Annotation),
+	}
+	if stateDir == "" {
+		return a
+	}
+
+	store, err := state.New(stateDir)
+	if err != nil {
+		log.Warn("notes").Err(err).Msg("Transfer notes will not be remembered")
+		return a
+	}
+	a.store = store
+
+	var notes Notes
+	if err := store.Load(NotesState, &notes); err != nil {
+		log.Warn("notes").Err(err).Msg("Failed to load transfer notes")
+		return a
+	}
+	if notes.Transfers != nil {
+		a.transfers = notes.Transfers
+	}
+	if notes.Pending != nil {
+		a.pending = notes.Pending
+	}
+	return a
+}
+
+// save drops annotations that were not changed for a long time and writes
+// the rest to the state directory. a.mu must be held.
+func (a *annotations) save() {
+	now := time.Now()
+	for id, note := range a.transfers {
+		if now.Sub(note.UpdatedAt) > notesTTL {
+			delete(a.transfers, id)
+		}
+	}
+	for key, note := range a.pending {
+		if now.Sub(note.UpdatedAt) > ownedTTL {
+			delete(a.pending, key)
+		}
+	}
+
+	if a.store == nil {
+		return
+	}
+	if err := a.store.Save(NotesState, Notes{Transfers: a.transfers, Pending: a.pending}); err != nil {
+		log.Warn("notes").Err(err).Msg("Failed to save transfer notes")
+	}
+}
+
+// claim moves the annotations of transfers added with notes to their IDs once
+// the provider lists them
+func (a *annotations) claim(transfers []*putio.Transfer) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.pending) == 0 {
+		return
+	}
+
+	claimed := false
+	for _, t := range transfers {
+		for _, key := range []string{t.Hash, t.Source, t.MagnetURI, t.TorrentLink} {
+			if key == "" {
+				continue
+			}
+			key = strings.ToLower(key)
+			if note, ok := a.pending[key]; ok {
+				delete(a.pending, key)
+				a.transfers[t.ID] = note
+				claimed = true
+			}
+		}
+	}
+	if claimed {
+		a.save()
+	}
+}
+
+// Annotation returns the notes and metadata attached to a transfer
+func (m *Manager) Annotation(transferID int64) (Annotation, bool) {
+	m.notes.mu.Lock()
+	defer m.notes.mu.Unlock()
+	note, ok := m.notes.transfers[transferID]
+	return note, ok
+}
+
+// SetAnnotation replaces the notes and metadata attached to a transfer. An
+// empty annotation removes them. The user who added the transfer, its
+// priority and its speed limit are kept.
+func (m *Manager) SetAnnotation(transferID int64, note Annotation) {
+	m.notes.mu.Lock()
+	defer m.notes.mu.Unlock()
+	note.RequestedBy = m.notes.transfers[transferID].RequestedBy
+	note.Priority = m.notes.transfers[transferID].Priority
+	note.SpeedLimit = m.notes.transfers[transferID].SpeedLimit
+	if note.Empty() {
+		delete(m.notes.transfers, transferID)
+	} else {
+		note.UpdatedAt = time.Now()
+		m.notes.transfers[transferID] = note
+	}
+	m.notes.save()
+
+	log.Info("notes").
+		Int64("transfer_id", transferID).
+		Int("metadata", len(note.Metadata)).
+		Bool("notes", note.Notes != "").
+		Msg("Changed transfer notes")
+}
+
+// annotateAdded remembers the notes, metadata and user of a transfer added
+// through plundrio by its info hash or link until the provider lists it
+func (m *Manager) annotateAdded(key string, note Annotation) {
+	if key == "" || note.Empty() {
+		return
+	}
+	m.notes.mu.Lock()
+	defer m.notes.mu.Unlock()
+	note.UpdatedAt = time.Now()
+	m.notes.pending[strings.ToLower(key)] = note
+	m.notes.save()
+}
+
+// forgetAdded drops the annotation of a transfer the provider did not take
+func (m *Manager) forgetAdded(key string) {
+	m.notes.mu.Lock()
+	defer m.notes.mu.Unlock()
+	if _, ok := m.notes.pending[strings.ToLower(key)]; ok {
+		delete(m.notes.pending, strings.ToLower(key))
+		m.notes.save()
+	}
+}
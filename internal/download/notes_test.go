@@ -0,0 +1,87 @@
+package download
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/elsbrock/go-putio"
+)
+
+func TestSetAnnotation(t *testing.T) {
+	stateDir := t.TempDir()
+	m := &Manager{notes: newAnnotations(stateDir)}
+	m.notes.transfers[1] = Annotation{RequestedBy: "alice", Priority: PriorityHigh, SpeedLimit: 100, UpdatedAt: time.Now()}
+
+	// Notes and metadata are replaced, the user, priority and speed limit kept
+	m.SetAnnotation(1, Annotation{Notes: "from the tracker", Metadata: map[string]string{"ticket": "42"}, RequestedBy: "mallory"})
+	m.SetAnnotation(2, Annotation{Notes: "gone soon"})
+	m.SetAnnotation(2, Annotation{})
+
+	loaded := &Manager{notes: newAnnotations(stateDir)}
+	note, ok := loaded.Annotation(1)
+	if !ok {
+		t.Fatal("annotation was not saved")
+	}
+	if note.Notes != "from the tracker" || !reflect.DeepEqual(note.Metadata, map[string]string{"ticket": "42"}) ||
+		note.RequestedBy != "alice" || note.Priority != PriorityHigh || note.SpeedLimit != 100 || note.UpdatedAt.IsZero() {
+		t.Errorf("annotation = %+v", note)
+	}
+	if _, ok := loaded.Annotation(2); ok {
+		t.Error("empty annotation was kept")
+	}
+}
+
+func TestAnnotateAdded(t *testing.T) {
+	stateDir := t.TempDir()
+	m := &Manager{notes: newAnnotations(stateDir)}
+	m.annotateAdded("ABCDEF", Annotation{Notes: "by hash", RequestedBy: "alice"})
+	m.annotateAdded("https://example.com/a.torrent", Annotation{Notes: "by link"})
+	m.annotateAdded("magnet:?xt=urn:btih:rejected", Annotation{Notes: "not taken"})
+	m.annotateAdded("", Annotation{Notes: "no key"})
+	m.annotateAdded("empty", Annotation{})
+	m.forgetAdded("MAGNET:?xt=urn:btih:rejected")
+
+	// Annotations wait for their transfers across restarts
+	m = &Manager{notes: newAnnotations(stateDir)}
+	if len(m.notes.pending) != 2 {
+		t.Errorf("pending = %v, want the hash and the link", m.notes.pending)
+	}
+	m.notes.claim([]*putio.Transfer{
+		{ID: 1, Hash: "abcdef"},
+		{ID: 2, Source: "https://example.com/a.torrent"},
+		{ID: 3, Hash: "unknown"},
+	})
+
+	m = &Manager{notes: newAnnotations(stateDir)}
+	if note, _ := m.Annotation(1); note.Notes != "by hash" || note.RequestedBy != "alice" {
+		t.Errorf("annotation of transfer 1 = %+v, want the one added by hash", note)
+	}
+	if note, _ := m.Annotation(2); note.Notes != "by link" {
+		t.Errorf("annotation of transfer 2 = %+v, want the one added by link", note)
+	}
+	if _, ok := m.Annotation(3); ok {
+		t.Error("transfer 3 got an annotation")
+	}
+	if len(m.notes.pending) != 0 {
+		t.Errorf("pending = %v, want none", m.notes.pending)
+	}
+}
+
+func TestAnnotationsExpire(t *testing.T) {
+	stateDir := t.TempDir()
+	a := newAnnotations(stateDir)
+	a.transfers[1] = Annotation{Notes: "old", UpdatedAt: time.Now().Add(-notesTTL - time.Hour)}
+	a.transfers[2] = Annotation{Notes: "recent", UpdatedAt: time.Now().Add(-notesTTL + time.Hour)}
+	a.pending["old"] = Annotation{Notes: "old", UpdatedAt: time.Now().Add(-ownedTTL - time.Hour)}
+	a.pending["recent"] = Annotation{Notes: "recent", UpdatedAt: time.Now()}
+	a.save()
+
+	loaded := newAnnotations(stateDir)
+	if _, ok := loaded.transfers[1]; ok || len(loaded.transfers) != 1 {
+		t.Errorf("transfers = %v, want only the recent one", loaded.transfers)
+	}
+	if _, ok := loaded.pending["old"]; ok || len(loaded.pending) != 1 {
+		t.Errorf("pending = %v, want only the recent one", loaded.pending)
+	}
+}
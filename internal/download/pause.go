@@ -0,0 +1,176 @@
+package download
+
+import (
+	"github.com/elsbrock/plundrio/internal/events"
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// PauseTransfer stops downloading the files of a transfer. Running downloads
+// are interrupted and, like queued ones, held back until the transfer is
+// resumed; aria2c continues partial files where they left off.
+func (m *Manager) PauseTransfer(transferID int64) {
+	m.pauseMu.Lock()
+	if _, paused := m.pausedJobs[transferID]; paused {
+		m.pauseMu.Unlock()
+		return
+	}
+	m.pausedJobs[transferID] = nil
+	if signal, ok := m.pauseSignals[transferID]; ok {
+		close(signal)
+		delete(m.pauseSignals, transferID)
+	}
+	m.pauseMu.Unlock()
+
+	log.Info("transfers").
+		Int64("transfer_id", transferID).
+		Msg("Transfer paused")
+	m.publish(events.Event{Type: events.TransferPaused, TransferID: transferID})
+}
+
+// ResumeTransfer queues the held back downloads of a paused transfer again
+func (m *Manager) ResumeTransfer(transferID int64) {
+	m.pauseMu.Lock()
+	jobs, paused := m.pausedJobs[transferID]
+	delete(m.pausedJobs, transferID)
+	m.pauseMu.Unlock()
+
+	if !paused {
+		return
+	}
+
+	for _, job := range jobs {
+		m.requeue(job)
+	}
+
+	log.Info("transfers").
+		Int64("transfer_id", transferID).
+		Int("jobs", len(jobs)).
+		Msg("Transfer resumed")
+	m.publish(events.Event{Type: events.TransferResumed, TransferID: transferID})
+}
+
+// CancelTransfer stops downloading a transfer for good. Running downloads are
+// interrupted, queued and held back ones are dropped and the transfer is
+// marked as cancelled. Transfers that already finished are left alone.
+func (m *Manager) CancelTransfer(transferID int64) {
+	ctx, tracked := m.coordinator.GetTransferContext(transferID)
+	if tracked {
+		ctx.Mu.RLock()
+		state := ctx.State
+		ctx.Mu.RUnlock()
+		if state == TransferLifecycleCompleted || state == TransferLifecycleProcessed || state == TransferLifecycleCancelled {
+			return
+		}
+	}
+
+	m.pauseMu.Lock()
+	if _, cancelled := m.cancelled[transferID]; cancelled {
+		m.pauseMu.Unlock()
+		return
+	}
+	m.cancelled[transferID] = struct{}{}
+	held := m.pausedJobs[transferID]
+	delete(m.pausedJobs, transferID)
+	if signal, ok := m.pauseSignals[transferID]; ok {
+		close(signal)
+		delete(m.pauseSignals, transferID)
+	}
+	m.pauseMu.Unlock()
+
+	for _, job := range held {
+		m.releaseJob(job)
+	}
+	m.releaseClaims(transferID)
+
+	// Transfers that never started downloading locally just won't start
+	if !tracked {
+		log.Debug("transfers").
+			Int64("transfer_id", transferID).
+			Msg("Cancelled transfer before its download started")
+		return
+	}
+
+	// The coordinator logs the cancellation
+	m.coordinator.FailTransfer(transferID, NewDownloadCancelledError(ctx.Name, "transfer cancelled"))
+	ctx.Mu.RLock()
+	cancelled := m.transferEvent(ctx, events.TransferCancelled, nil)
+	ctx.Mu.RUnlock()
+	m.publish(cancelled)
+}
+
+// IsPaused reports whether a transfer is paused
+func (m *Manager) IsPaused(transferID int64) bool {
+	m.pauseMu.Lock()
+	defer m.pauseMu.Unlock()
+	_, paused := m.pausedJobs[transferID]
+	return paused
+}
+
+// holdIfPaused keeps a job back if its transfer is paused, a maintenance
+// window is active or no download window is open, or drops it if the
+// transfer was cancelled, and reports whether it did
+func (m *Manager) holdIfPaused(job downloadJob) bool {
+	m.pauseMu.Lock()
+	defer m.pauseMu.Unlock()
+
+	if _, cancelled := m.cancelled[job.TransferID]; cancelled {
+		m.releaseJob(job)
+		return true
+	}
+	if jobs, paused := m.pausedJobs[job.TransferID]; paused {
+		m.pausedJobs[job.TransferID] = append(jobs, job)
+		return true
+	}
+	if m.maintenance {
+		m.maintenanceJobs = append(m.maintenanceJobs, job)
+		return true
+	}
+	if m.windowClosed {
+		m.windowJobs = append(m.windowJobs, job)
+		return true
+	}
+	return false
+}
+
+// pauseSignal returns a channel that is closed when the transfer is paused or
+// a maintenance window starts
+func (m *Manager) pauseSignal(transferID int64) <-chan struct{} {
+	m.pauseMu.Lock()
+	defer m.pauseMu.Unlock()
+
+	_, paused := m.pausedJobs[transferID]
+	_, cancelled := m.cancelled[transferID]
+	if paused || cancelled || m.maintenance {
+		closed := make(chan struct{})
+		close(closed)
+		return closed
+	}
+	signal, ok := m.pauseSignals[transferID]
+	if !ok {
+		signal = make(chan struct{})
+		m.pauseSignals[transferID] = signal
+	}
+	return signal
+}
+
+// releaseJob forgets the files of a job that will not be downloaded
+func (m *Manager) releaseJob(job downloadJob) {
+	if len(job.Batch) > 0 {
+		for _, file := range job.Batch {
+			m.activeFiles.Delete(file.FileID)
+		}
+		return
+	}
+	m.activeFiles.Delete(job.FileID)
+}
+
+// requeue puts a job that is still tracked as active back on the queue
+func (m *Manager) requeue(job downloadJob) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.running {
+		return
+	}
+	m.sendJob(job)
+}
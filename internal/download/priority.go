@@ -0,0 +1,112 @@
+package download
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/elsbrock/go-putio"
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// Priorities of transfers, the values of Transmission's bandwidthPriority.
+// Transfers with a higher priority are processed first and get free slots
+// in the download queue before those with a lower one.
+const (
+	PriorityLow    = -1
+	PriorityNormal = 0
+	PriorityHigh   = 1
+)
+
+// priorityLabelPrefix starts the labels that set a transfer's priority, such
+// as priority-high
+const priorityLabelPrefix = "priority-"
+
+// priorityNames are the names of the priorities in labels and logs
+var priorityNames = map[int]string{
+	PriorityLow:    "low",
+	PriorityNormal: "normal",
+	PriorityHigh:   "high",
+}
+
+// PriorityName returns low, normal or high
+func PriorityName(priority int) string {
+	return priorityNames[ClampPriority(priority)]
+}
+
+// PriorityLabel returns the label a transfer of a priority is tagged with,
+// or an empty string for normal priority
+func PriorityLabel(priority int) string {
+	if ClampPriority(priority) == PriorityNormal {
+		return ""
+	}
+	return priorityLabelPrefix + PriorityName(priority)
+}
+
+// ClampPriority maps any bandwidthPriority to low, normal or high
+func ClampPriority(priority int) int {
+	return max(PriorityLow, min(priority, PriorityHigh))
+}
+
+// PriorityFromLabels returns the priority set by a label such as
+// priority-high, and whether any label set one
+func PriorityFromLabels(labels []string) (int, bool) {
+	for _, label := range labels {
+		name, ok := strings.CutPrefix(strings.ToLower(strings.TrimSpace(label)), priorityLabelPrefix)
+		if !ok {
+			continue
+		}
+		for priority, n := range priorityNames {
+			if n == name {
+				return priority, true
+			}
+		}
+	}
+	return PriorityNormal, false
+}
+
+// Priority returns the priority of a transfer
+func (m *Manager) Priority(transferID int64) int {
+	note, _ := m.Annotation(transferID)
+	return note.Priority
+}
+
+// SetPriority changes the priority of a transfer. Queued jobs and downloads
+// waiting for a slot in the download queue are reordered right away.
+func (m *Manager) SetPriority(transferID int64, priority int) {
+	priority = ClampPriority(priority)
+	m.notes.mu.Lock()
+	note := m.notes.transfers[transferID]
+	if note.Priority == priority {
+		m.notes.mu.Unlock()
+		return
+	}
+	note.Priority = priority
+	if note.Empty() {
+		delete(m.notes.transfers, transferID)
+	} else {
+		note.UpdatedAt = time.Now()
+		m.notes.transfers[transferID] = note
+	}
+	m.notes.save()
+	m.notes.mu.Unlock()
+
+	log.Info("download").
+		Int64("transfer_id", transferID).
+		Str("priority", PriorityName(priority)).
+		Msg("Changed transfer priority")
+	m.jobs.reorder(m.Priority)
+	m.queue.wake()
+}
+
+// sortByPriority orders transfers by priority, highest first, keeping the
+// order of transfers with the same priority
+func (m *Manager) sortByPriority(transfers []*putio.Transfer) {
+	priorities := make(map[int64]int, len(transfers))
+	for _, t := range transfers {
+		priorities[t.ID] = m.Priority(t.ID)
+	}
+	sort.SliceStable(transfers, func(i, j int) bool {
+		return priorities[transfers[i].ID] > priorities[transfers[j].ID]
+	})
+}
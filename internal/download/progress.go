@@ -15,6 +15,7 @@ func (m *Manager) monitorGrabDownloadProgress(ctx context.Context, state *Downlo
 	go func() {
 		log.Info("download").
 			Str("file_name", state.Name).
+			Int64("transfer_id", state.TransferID).
 			Float64("size_mb", float64(fileSize)/1024/1024).
 			Msg("Starting download")
 
@@ -72,6 +73,7 @@ func (m *Manager) monitorGrabDownloadProgress(ctx context.Context, state *Downlo
 
 					log.Info("download").
 						Str("file_name", state.Name).
+						Int64("transfer_id", state.TransferID).
 						Float64("progress_percent", progress).
 						Float64("downloaded_mb", downloadedMB).
 						Float64("total_mb", totalMB).
@@ -82,6 +84,7 @@ func (m *Manager) monitorGrabDownloadProgress(ctx context.Context, state *Downlo
 			case <-ctx.Done():
 				log.Info("download").
 					Str("file_name", state.Name).
+					Int64("transfer_id", state.TransferID).
 					Msg("Download cancelled")
 				return
 			case <-done:
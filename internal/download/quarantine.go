@@ -0,0 +1,168 @@
+package download
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/config"
+	"github.com/elsbrock/plundrio/internal/events"
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// retryCycleDelay is how long after the last failure the failed files of a
+// transfer are downloaded again; each further cycle waits this much longer
+const retryCycleDelay = 5 * time.Minute
+
+// retryFailedTransfers downloads the failed files of transfers again once
+// their retry delay passed and retries are not backing off, and quarantines transfers whose files failed in
+// more than max-retry-cycles cycles instead of retrying them forever
+func (m *Manager) retryFailedTransfers() {
+	now := time.Now()
+	backingOff := m.retries.backingOff(now)
+	m.coordinator.GetAllTransfers(func(ctx *TransferContext) {
+		ctx.Mu.Lock()
+		defer ctx.Mu.Unlock()
+
+		// Retry only once no file of the transfer is downloading anymore
+		if ctx.State != TransferLifecycleFailed || len(ctx.failed) == 0 ||
+			ctx.CompletedFiles+ctx.FailedFiles+ctx.SkippedFiles < ctx.TotalFiles {
+			return
+		}
+		if ctx.RetryCycles >= m.cfg.MaxRetryCycles {
+			m.quarantine(ctx)
+			return
+		}
+		if now.Sub(ctx.failedAt) < retryCycleDelay*time.Duration(ctx.RetryCycles+1) || backingOff {
+			return
+		}
+
+		ctx.RetryCycles++
+		log.Info("transfers").
+			Int64("id", ctx.ID).
+			Str("name", ctx.Name).
+			Int("files", len(ctx.failed)).
+			Int("cycle", ctx.RetryCycles).
+			Int("max_cycles", m.cfg.MaxRetryCycles).
+			Msg("Downloading failed files again")
+		m.retryFailedFiles(ctx, nil)
+	})
+}
+
+// quarantine stops retrying a transfer whose files keep failing. It stays
+// quarantined until it is retried manually. The caller must hold ctx.Mu.
+func (m *Manager) quarantine(ctx *TransferContext) {
+	ctx.State = TransferLifecycleQuarantined
+	ctx.QuarantineReason = fmt.Sprintf("%d files still failed after %d retry cycles", len(ctx.failed), ctx.RetryCycles)
+	if ctx.Error != nil {
+		ctx.QuarantineReason += ": " + ctx.Error.Error()
+	}
+
+	log.Warn("transfers").
+		Int64("id", ctx.ID).
+		Str("name", ctx.Name).
+		Str("reason", ctx.QuarantineReason).
+		Msg("Transfer quarantined")
+	m.publish(m.transferEvent(ctx, events.TransferQuarantined, ctx.Error))
+
+	if m.cfg.PartialPolicy == config.PartialPolicyComplete && ctx.CompletedFiles > 0 {
+		m.completePartially(ctx)
+	}
+}
+
+// completePartially completes a quarantined transfer with the files that
+// could be downloaded, so *arr applications import those. The failed files
+// are left out of the verification and stay on Put.io. The caller must hold
+// ctx.Mu.
+func (m *Manager) completePartially(ctx *TransferContext) {
+	failed := make(map[int64]bool, len(ctx.failed))
+	for _, f := range ctx.failed {
+		failed[f.FileID] = true
+	}
+	wanted := ctx.wanted[:0]
+	for _, file := range ctx.wanted {
+		if !failed[file.FileID] {
+			wanted = append(wanted, file)
+		}
+	}
+	ctx.wanted = wanted
+	ctx.State = TransferLifecycleCompleted
+
+	log.Info("transfers").
+		Int64("id", ctx.ID).
+		Str("name", ctx.Name).
+		Int32("completed", ctx.CompletedFiles).
+		Int("failed", len(ctx.failed)).
+		Msg("Completing transfer without its failed files")
+
+	// CompleteTransfer needs ctx.Mu
+	go func() {
+		if err := m.coordinator.CompleteTransfer(ctx.ID); err != nil {
+			log.Error("transfers").
+				Int64("id", ctx.ID).
+				Err(err).
+				Msg("Failed to complete partial transfer")
+		}
+	}()
+}
+
+// RetryTransfer downloads the failed files of a failed or quarantined transfer
+// again right away. The retry cycles start over.
+func (m *Manager) RetryTransfer(transferID int64) error {
+	ctx, ok := m.coordinator.GetTransferContext(transferID)
+	if !ok {
+		return NewTransferNotFoundError(transferID)
+	}
+
+	ctx.Mu.Lock()
+	defer ctx.Mu.Unlock()
+
+	if ctx.State != TransferLifecycleFailed && ctx.State != TransferLifecycleQuarantined {
+		return fmt.Errorf("transfer %d is %s, only failed or quarantined transfers can be retried", transferID, ctx.State)
+	}
+	if len(ctx.failed) == 0 {
+		return fmt.Errorf("transfer %d has no failed files to retry", transferID)
+	}
+
+	log.Info("transfers").
+		Int64("id", ctx.ID).
+		Str("name", ctx.Name).
+		Int("files", len(ctx.failed)).
+		Str("state", ctx.State.String()).
+		Msg("Retrying failed files manually")
+	ctx.RetryCycles = 0
+	ctx.QuarantineReason = ""
+	m.retryFailedFiles(ctx, nil)
+	return nil
+}
+
+// retryFailedFiles puts the failed files of a transfer back into the download
+// queue, all of them if fileIDs is empty, and returns how many. The caller
+// must hold ctx.Mu.
+func (m *Manager) retryFailedFiles(ctx *TransferContext, fileIDs []int64) int {
+	var files []wantedFile
+	ctx.failed = slices.DeleteFunc(ctx.failed, func(f failedFile) bool {
+		if len(fileIDs) > 0 && !slices.Contains(fileIDs, f.FileID) {
+			return false
+		}
+		files = append(files, f.wantedFile)
+		return true
+	})
+	if len(files) == 0 {
+		return 0
+	}
+	ctx.FailedFiles = max(ctx.FailedFiles-int32(len(files)), 0)
+	ctx.State = TransferLifecycleDownloading
+	ctx.Error = nil
+	ctx.verifyFailures = 0
+
+	ids := make([]int64, 0, len(files))
+	for _, f := range files {
+		ids = append(ids, f.FileID)
+	}
+	m.failures.retrying(ids)
+
+	// Queueing may block, and the workers need ctx.Mu to finish files
+	go m.redownloadFiles(ctx.ID, files)
+	return len(files)
+}
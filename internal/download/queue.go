@@ -0,0 +1,108 @@
+package download
+
+import (
+	"context"
+	"sync"
+
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// downloadQueue caps the number of downloads running at once below the
+// worker count. Unlike volume slots the limit can change at runtime. Free
+// slots go to the waiting downloads of the highest priority first.
+type downloadQueue struct {
+	mu      sync.Mutex
+	running int
+	waiting map[int]int   // number of waiting downloads by transfer priority
+	changed chan struct{} // closed when a slot frees up, the limit or a priority changes
+}
+
+// outranked reports whether downloads of a higher priority are waiting.
+// q.mu must be held.
+func (q *downloadQueue) outranked(priority int) bool {
+	for p, n := range q.waiting {
+		if p > priority && n > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// wake lets downloads waiting for a slot check again
+func (q *downloadQueue) wake() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.changed != nil {
+		close(q.changed)
+		q.changed = nil
+	}
+}
+
+// acquireQueueSlot waits until fewer downloads run than the download queue
+// size and the system load allow and no download of a transfer with a higher priority waits,
+// and returns a function releasing the slot. It fails if ctx ends while
+// waiting.
+func (m *Manager) acquireQueueSlot(ctx context.Context, transferID int64) (func(), error) {
+	q := &m.queue
+	logged := false
+	waiting := false
+	var waitingAt int // priority the download waits at
+	for {
+		size := m.Settings().DownloadQueueSize
+		if limit := m.loadLimit(); limit > 0 && (size <= 0 || limit < size) {
+			size = limit
+		}
+		priority := m.Priority(transferID)
+
+		q.mu.Lock()
+		if waiting {
+			q.waiting[waitingAt]--
+			waiting = false
+		}
+		if size <= 0 || (q.running < size && !q.outranked(priority)) {
+			q.running++
+			q.mu.Unlock()
+			// Downloads of a lower priority may take the slots left
+			if logged {
+				q.wake()
+			}
+			return m.releaseQueueSlot, nil
+		}
+		if q.waiting == nil {
+			q.waiting = make(map[int]int)
+		}
+		q.waiting[priority]++
+		waiting, waitingAt = true, priority
+		if q.changed == nil {
+			q.changed = make(chan struct{})
+		}
+		changed := q.changed
+		q.mu.Unlock()
+
+		if !logged {
+			log.Debug("download").
+				Int("queue_size", size).
+				Int64("transfer_id", transferID).
+				Str("priority", PriorityName(priority)).
+				Msg("Waiting for a download queue slot")
+			logged = true
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			q.mu.Lock()
+			q.waiting[waitingAt]--
+			q.mu.Unlock()
+			q.wake()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// releaseQueueSlot frees the slot reserved by acquireQueueSlot
+func (m *Manager) releaseQueueSlot() {
+	m.queue.mu.Lock()
+	m.queue.running--
+	m.queue.mu.Unlock()
+	m.queue.wake()
+}
@@ -0,0 +1,400 @@
+package download
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/elsbrock/go-putio"
+	"github.com/elsbrock/plundrio/internal/events"
+	"github.com/elsbrock/plundrio/internal/log"
+	"github.com/elsbrock/plundrio/internal/state"
+)
+
+// QueueState is the name of the state database the transfers being
+// downloaded are kept in
+const QueueState = "queue"
+
+// Buckets of the queue database
+const (
+	queueTransfers = "transfers" // SavedTransfer by transfer ID
+	queueFiles     = "files"     // SavedFile by transfer and file ID
+)
+
+// States of the files of a saved transfer
+const (
+	SavedFileQueued    = "queued"
+	SavedFileCompleted = "completed"
+	SavedFileFailed    = "failed"
+)
+
+// SavedTransfer is a transfer being downloaded, kept so that it continues
+// right away on the next start instead of once put.io was checked
+type SavedTransfer struct {
+	Transfer       *putio.Transfer `json:"transfer"`
+	TargetDir      string          `json:"target_dir,omitempty"` // set if the transfer was moved to another directory
+	TotalFiles     int32           `json:"total_files"`
+	CompletedFiles int32           `json:"completed_files"`
+	FailedFiles    int32           `json:"failed_files"`
+	SkippedFiles   int32           `json:"skipped_files"`
+	TotalSize      int64           `json:"total_size"`
+	DownloadedSize int64           `json:"downloaded_size"`
+	RetryCycles    int             `json:"retry_cycles"`
+	StartTime      time.Time       `json:"start_time"`
+	Annotation     Annotation      `json:"annotation"` // notes and priority
+	SavedAt        time.Time       `json:"saved_at"`
+	Files          []SavedFile     `json:"-"` // kept apart, so that a finished file only rewrites itself
+}
+
+// SavedFile is a file of a saved transfer. The data downloaded so far is kept
+// in the partial file and its control file, which the downloaders continue
+// from.
+type SavedFile struct {
+	FileID     int64  `json:"file_id"`
+	Name       string `json:"name"` // path relative to the target directory
+	Size       int64  `json:"size"`
+	CRC32      string `json:"crc32,omitempty"`
+	State      string `json:"state"`      // SavedFileQueued, SavedFileCompleted or SavedFileFailed
+	Downloaded int64  `json:"downloaded"` // bytes downloaded when last saved
+	Error      string `json:"error,omitempty"`
+}
+
+// savedQueue keeps the transfers being downloaded in the state database
+type savedQueue struct {
+	mu sync.Mutex
+	db *state.DB // nil without a state directory or once closed
+}
+
+// newSavedQueue opens the database of the transfers being downloaded
+func newSavedQueue(stateDir string) *savedQueue {
+	q := &savedQueue{}
+	if stateDir == "" {
+		return q
+	}
+	store, err := state.New(stateDir)
+	if err == nil {
+		q.db, err = store.Open(QueueState)
+	}
+	if err != nil {
+		log.Warn("download").Err(err).Msg("Queue will not be saved")
+		return q
+	}
+	// Earlier versions saved a snapshot instead; its transfers are listed
+	// again from the provider
+	os.Remove(filepath.Join(stateDir, QueueState+".json"))
+	return q
+}
+
+// enabled reports whether transfers are saved
+func (q *savedQueue) enabled() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.db != nil
+}
+
+// update runs fn in a transaction, logging if it fails
+func (q *savedQueue) update(fn func(*state.Tx) error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.db == nil {
+		return
+	}
+	if err := q.db.Update(fn); err != nil {
+		log.Warn("download").Err(err).Msg("Failed to save queue")
+	}
+}
+
+// close closes the database; later changes are not saved
+func (q *savedQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.db == nil {
+		return
+	}
+	if err := q.db.Close(); err != nil {
+		log.Warn("download").Err(err).Msg("Failed to close queue")
+	}
+	q.db = nil
+}
+
+// load returns the saved transfers with their files, by transfer ID
+func (q *savedQueue) load() []SavedTransfer {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.db == nil {
+		return nil
+	}
+
+	var transfers []SavedTransfer
+	err := q.db.View(func(tx *state.Tx) error {
+		return tx.ForEach(queueTransfers, nil, func(key, value []byte) error {
+			var transfer SavedTransfer
+			if err := json.Unmarshal(value, &transfer); err != nil {
+				return err
+			}
+			err := tx.ForEach(queueFiles, key, func(_, value []byte) error {
+				var file SavedFile
+				if err := json.Unmarshal(value, &file); err != nil {
+					return err
+				}
+				transfer.Files = append(transfer.Files, file)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			transfers = append(transfers, transfer)
+			return nil
+		})
+	})
+	if err != nil {
+		log.Warn("download").Err(err).Msg("Failed to load saved queue")
+		return nil
+	}
+	return transfers
+}
+
+// savedTransfer returns what is saved of a transfer. Files queued by hand are
+// left out, they are queued again by hand. The caller must hold ctx.Mu.
+func (m *Manager) savedTransfer(ctx *TransferContext) (SavedTransfer, bool) {
+	if ctx.Manual || ctx.Transfer == nil {
+		return SavedTransfer{}, false
+	}
+	saved := SavedTransfer{
+		Transfer:       ctx.Transfer,
+		TotalFiles:     ctx.TotalFiles,
+		CompletedFiles: ctx.CompletedFiles,
+		FailedFiles:    ctx.FailedFiles,
+		SkippedFiles:   ctx.SkippedFiles,
+		TotalSize:      ctx.TotalSize,
+		DownloadedSize: ctx.DownloadedSize,
+		RetryCycles:    ctx.RetryCycles,
+		StartTime:      ctx.StartTime,
+		SavedAt:        time.Now(),
+	}
+	saved.TargetDir, _ = m.targetDirs.get(ctx.ID)
+	saved.Annotation, _ = m.Annotation(ctx.ID)
+	return saved, true
+}
+
+// saveQueued saves a transfer whose files were just queued, replacing what
+// was saved of it before
+func (m *Manager) saveQueued(transferID int64) {
+	ctx, ok := m.coordinator.GetTransferContext(transferID)
+	if !ok {
+		return
+	}
+	ctx.Mu.RLock()
+	saved, ok := m.savedTransfer(ctx)
+	wanted := slices.Clone(ctx.wanted)
+	ctx.Mu.RUnlock()
+	if !ok {
+		return
+	}
+
+	m.saved.update(func(tx *state.Tx) error {
+		key := state.Key(transferID)
+		if err := tx.Delete(queueFiles, key); err != nil {
+			return err
+		}
+		for _, file := range wanted {
+			err := tx.Put(queueFiles, state.Key(transferID, file.FileID), SavedFile{
+				FileID: file.FileID,
+				Name:   file.Name,
+				Size:   file.Size,
+				CRC32:  file.CRC32,
+				State:  SavedFileQueued,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Put(queueTransfers, key, saved)
+	})
+}
+
+// saveFileDone saves that a file of a transfer completed or failed, together
+// with the counts of its transfer
+func (m *Manager) saveFileDone(transferID, fileID int64, fileState string, fileErr error) {
+	ctx, ok := m.coordinator.GetTransferContext(transferID)
+	if !ok {
+		return
+	}
+	ctx.Mu.RLock()
+	saved, ok := m.savedTransfer(ctx)
+	ctx.Mu.RUnlock()
+	if !ok {
+		return
+	}
+
+	m.saved.update(func(tx *state.Tx) error {
+		key := state.Key(transferID, fileID)
+		var file SavedFile
+		if found, err := tx.Get(queueFiles, key, &file); err != nil || !found {
+			return err
+		}
+		file.State = fileState
+		file.Error = ""
+		if fileState == SavedFileCompleted {
+			file.Downloaded = file.Size
+		}
+		if fileErr != nil {
+			file.Error = fileErr.Error()
+		}
+		if err := tx.Put(queueFiles, key, file); err != nil {
+			return err
+		}
+		return tx.Put(queueTransfers, state.Key(transferID), saved)
+	})
+}
+
+// forgetSaved drops a transfer that is done with, or no longer downloaded
+func (m *Manager) forgetSaved(event events.Event) {
+	m.saved.update(func(tx *state.Tx) error {
+		key := state.Key(event.TransferID)
+		if err := tx.Delete(queueFiles, key); err != nil {
+			return err
+		}
+		return tx.Delete(queueTransfers, key)
+	})
+}
+
+// saveProgress saves how much of the files being downloaded is there, and
+// the downloaded bytes of their transfers
+func (m *Manager) saveProgress() {
+	files := m.inFlightFiles()
+	if len(files) == 0 {
+		return
+	}
+	transfers := make(map[int64]SavedTransfer)
+	for _, file := range files {
+		if _, ok := transfers[file.TransferID]; ok {
+			continue
+		}
+		if ctx, ok := m.coordinator.GetTransferContext(file.TransferID); ok {
+			ctx.Mu.RLock()
+			if saved, ok := m.savedTransfer(ctx); ok {
+				transfers[file.TransferID] = saved
+			}
+			ctx.Mu.RUnlock()
+		}
+	}
+
+	m.saved.update(func(tx *state.Tx) error {
+		for _, in := range files {
+			if _, ok := transfers[in.TransferID]; !ok {
+				continue
+			}
+			key := state.Key(in.TransferID, in.FileID)
+			var file SavedFile
+			found, err := tx.Get(queueFiles, key, &file)
+			if err != nil {
+				return err
+			}
+			if !found || file.Downloaded == in.Downloaded {
+				continue
+			}
+			file.Downloaded = in.Downloaded
+			if err := tx.Put(queueFiles, key, file); err != nil {
+				return err
+			}
+		}
+		for id, saved := range transfers {
+			// Transfers forgotten meanwhile stay forgotten
+			var last SavedTransfer
+			found, err := tx.Get(queueTransfers, state.Key(id), &last)
+			if err != nil {
+				return err
+			}
+			if !found {
+				continue
+			}
+			if err := tx.Put(queueTransfers, state.Key(id), saved); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// saveProgressPeriodically saves the progress of the files being downloaded
+// now and then, and once more before the queue is closed when stopping.
+// Queued, completed and failed files are saved as it happens.
+func (m *Manager) saveProgressPeriodically() {
+	ticker := time.NewTicker(m.dlConfig.QueueSaveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stopChan:
+			m.saveProgress()
+			return
+		case <-ticker.C:
+			m.saveProgress()
+		}
+	}
+}
+
+// resumeSavedTransfers continues downloading the transfers saved by the last
+// run without asking the provider for their files first. Files that were
+// downloaded completely are skipped as usual.
+func (p *TransferProcessor) resumeSavedTransfers() {
+	saved := p.manager.saved.load()
+	for _, transfer := range saved {
+		if transfer.Transfer == nil || len(transfer.Files) == 0 || p.isTransferBeingProcessed(transfer.Transfer.ID) {
+			continue
+		}
+		if !p.accept(transfer.Transfer) {
+			continue
+		}
+		// Directories set since, e.g. by a migration, take precedence
+		if _, ok := p.manager.targetDirs.get(transfer.Transfer.ID); !ok && transfer.TargetDir != "" {
+			p.manager.targetDirs.set(transfer.Transfer.ID, transfer.TargetDir)
+		}
+		// The priority decides where the jobs are queued
+		p.manager.restoreAnnotation(transfer.Transfer.ID, transfer.Annotation)
+
+		jobs := make([]downloadJob, 0, len(transfer.Files))
+		for _, file := range transfer.Files {
+			jobs = append(jobs, downloadJob{
+				FileID:     file.FileID,
+				Name:       file.Name,
+				TransferID: transfer.Transfer.ID,
+				Size:       file.Size,
+				CRC32:      file.CRC32,
+			})
+		}
+
+		log.Info("transfers").
+			Str("name", transfer.Transfer.Name).
+			Int64("id", transfer.Transfer.ID).
+			Int("files", len(jobs)).
+			Int32("completed", transfer.CompletedFiles).
+			Int32("failed", transfer.FailedFiles).
+			Int64("downloaded_bytes", transfer.DownloadedSize).
+			Msg("Resuming saved transfer")
+		p.manager.workerWg.Add(1)
+		go func(transfer *putio.Transfer) {
+			defer p.manager.workerWg.Done()
+			p.downloadTransfer(transfer, jobs)
+		}(transfer.Transfer)
+	}
+}
+
+// restoreAnnotation puts back the notes and priority of a saved transfer if
+// they were lost, e.g. with the notes document
+func (m *Manager) restoreAnnotation(transferID int64, note Annotation) {
+	if note.Empty() {
+		return
+	}
+	m.notes.mu.Lock()
+	defer m.notes.mu.Unlock()
+	if _, ok := m.notes.transfers[transferID]; ok {
+		return
+	}
+	m.notes.transfers[transferID] = note
+	m.notes.save()
+}
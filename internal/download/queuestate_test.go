@@ -0,0 +1,197 @@
+package download
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/elsbrock/go-putio"
+	"github.com/elsbrock/plundrio/internal/config"
+	"github.com/elsbrock/plundrio/internal/events"
+)
+
+// queueManager returns a manager saving its queue in stateDir with a
+// transfer of two files being downloaded
+func queueManager(t *testing.T, stateDir string) *Manager {
+	t.Helper()
+	m := &Manager{
+		cfg:        &config.Config{},
+		targetDir:  "/downloads",
+		targetDirs: newTargetDirOverrides(""),
+		notes:      newAnnotations(""),
+		saved:      newSavedQueue(stateDir),
+	}
+	t.Cleanup(m.saved.close)
+	m.coordinator = NewTransferCoordinator(m)
+	m.coordinator.transfers.Store(int64(1), &TransferContext{
+		ID:         1,
+		Name:       "Show",
+		Transfer:   &putio.Transfer{ID: 1, Name: "Show"},
+		TotalFiles: 2,
+		TotalSize:  300,
+		wanted: []wantedFile{
+			{FileID: 10, Name: "Show/e01.mkv", Size: 100, CRC32: "abc"},
+			{FileID: 11, Name: "Show/e02.mkv", Size: 200},
+		},
+	})
+	return m
+}
+
+// reopen closes the queue of m and returns what a new one loads
+func reopen(t *testing.T, m *Manager, stateDir string) []SavedTransfer {
+	t.Helper()
+	m.saved.close()
+	q := newSavedQueue(stateDir)
+	defer q.close()
+	return q.load()
+}
+
+func TestSavedQueue(t *testing.T) {
+	stateDir := t.TempDir()
+	m := queueManager(t, stateDir)
+	m.targetDirs.set(1, "/elsewhere")
+	m.notes.transfers[1] = Annotation{Priority: PriorityHigh}
+
+	m.saveQueued(1)
+	ctx, _ := m.coordinator.GetTransferContext(1)
+	ctx.CompletedFiles = 1
+	m.saveFileDone(1, 10, SavedFileCompleted, nil)
+	ctx.FailedFiles = 1
+	m.saveFileDone(1, 11, SavedFileFailed, errors.New("checksum mismatch"))
+	m.saveFileDone(1, 12, SavedFileCompleted, nil) // not queued, so not saved
+
+	saved := reopen(t, m, stateDir)
+	if len(saved) != 1 {
+		t.Fatalf("saved %d transfers, want 1", len(saved))
+	}
+	transfer := saved[0]
+	if transfer.Transfer.ID != 1 || transfer.TargetDir != "/elsewhere" || transfer.Annotation.Priority != PriorityHigh {
+		t.Errorf("transfer = %d in %q with priority %d, want 1 in /elsewhere with priority %d",
+			transfer.Transfer.ID, transfer.TargetDir, transfer.Annotation.Priority, PriorityHigh)
+	}
+	if transfer.TotalFiles != 2 || transfer.CompletedFiles != 1 || transfer.FailedFiles != 1 || transfer.TotalSize != 300 {
+		t.Errorf("counts = %d total, %d completed, %d failed, %d bytes, want 2, 1, 1, 300",
+			transfer.TotalFiles, transfer.CompletedFiles, transfer.FailedFiles, transfer.TotalSize)
+	}
+	want := []SavedFile{
+		{FileID: 10, Name: "Show/e01.mkv", Size: 100, CRC32: "abc", State: SavedFileCompleted, Downloaded: 100},
+		{FileID: 11, Name: "Show/e02.mkv", Size: 200, State: SavedFileFailed, Error: "checksum mismatch"},
+	}
+	if !reflect.DeepEqual(transfer.Files, want) {
+		t.Errorf("files = %+v, want %+v", transfer.Files, want)
+	}
+}
+
+func TestSavedQueueRequeue(t *testing.T) {
+	stateDir := t.TempDir()
+	m := queueManager(t, stateDir)
+	m.saveQueued(1)
+	m.saveFileDone(1, 10, SavedFileCompleted, nil)
+
+	// Queuing again replaces the files saved before
+	ctx, _ := m.coordinator.GetTransferContext(1)
+	ctx.wanted = ctx.wanted[1:]
+	m.saveQueued(1)
+
+	saved := reopen(t, m, stateDir)
+	if len(saved) != 1 || len(saved[0].Files) != 1 || saved[0].Files[0].FileID != 11 || saved[0].Files[0].State != SavedFileQueued {
+		t.Errorf("saved = %+v, want only file 11 queued", saved)
+	}
+}
+
+func TestSavedQueueProgress(t *testing.T) {
+	stateDir, dir := t.TempDir(), t.TempDir()
+	m := queueManager(t, stateDir)
+	m.claims = make(map[string]pathClaim)
+	m.saveQueued(1)
+
+	path := filepath.Join(dir, "e01.mkv")
+	if err := os.WriteFile(path, make([]byte, 40), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m.claims[path] = pathClaim{TransferID: 1, FileID: 10, Size: 100}
+	m.activeFiles.Store(int64(10), int64(1))
+	ctx, _ := m.coordinator.GetTransferContext(1)
+	ctx.DownloadedSize = 40
+	m.saveProgress()
+
+	saved := reopen(t, m, stateDir)
+	if len(saved) != 1 || saved[0].DownloadedSize != 40 {
+		t.Fatalf("saved = %+v, want 40 bytes downloaded", saved)
+	}
+	if file := saved[0].Files[0]; file.FileID != 10 || file.Downloaded != 40 || file.State != SavedFileQueued {
+		t.Errorf("file = %+v, want file 10 queued with 40 bytes", file)
+	}
+}
+
+func TestSavedQueueForget(t *testing.T) {
+	stateDir, dir := t.TempDir(), t.TempDir()
+	m := queueManager(t, stateDir)
+	m.claims = make(map[string]pathClaim)
+	m.saveQueued(1)
+	m.forgetSaved(events.Event{TransferID: 1})
+
+	// Progress of files still running does not bring the transfer back
+	path := filepath.Join(dir, "e01.mkv")
+	if err := os.WriteFile(path, make([]byte, 40), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m.claims[path] = pathClaim{TransferID: 1, FileID: 10, Size: 100}
+	m.activeFiles.Store(int64(10), int64(1))
+	m.saveProgress()
+	m.saveFileDone(1, 10, SavedFileCompleted, nil)
+
+	if saved := reopen(t, m, stateDir); len(saved) != 0 {
+		t.Errorf("saved = %+v, want nothing", saved)
+	}
+}
+
+func TestSavedQueueManual(t *testing.T) {
+	stateDir := t.TempDir()
+	m := queueManager(t, stateDir)
+	ctx, _ := m.coordinator.GetTransferContext(1)
+	ctx.Manual = true
+	m.saveQueued(1)
+
+	if saved := reopen(t, m, stateDir); len(saved) != 0 {
+		t.Errorf("saved = %+v, want files queued by hand left out", saved)
+	}
+}
+
+func TestSavedQueueWithoutStateDir(t *testing.T) {
+	m := queueManager(t, "")
+	m.saveQueued(1)
+	if m.saved.enabled() || m.saved.load() != nil {
+		t.Error("queue was saved without a state directory")
+	}
+}
+
+func TestSavedQueueReplacesSnapshot(t *testing.T) {
+	stateDir := t.TempDir()
+	snapshot := filepath.Join(stateDir, QueueState+".json")
+	if err := os.WriteFile(snapshot, []byte(`{}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	q := newSavedQueue(stateDir)
+	defer q.close()
+	if exists(snapshot) {
+		t.Error("snapshot of earlier versions was kept")
+	}
+}
+
+func TestRestoreAnnotation(t *testing.T) {
+	m := &Manager{notes: newAnnotations("")}
+	m.restoreAnnotation(1, Annotation{Notes: "saved", Priority: PriorityHigh, UpdatedAt: time.Now()})
+	m.restoreAnnotation(1, Annotation{Notes: "older", UpdatedAt: time.Now()})
+	m.restoreAnnotation(2, Annotation{})
+
+	if note, _ := m.Annotation(1); note.Notes != "saved" || note.Priority != PriorityHigh {
+		t.Errorf("annotation = %+v, want the first one restored", note)
+	}
+	if _, ok := m.Annotation(2); ok {
+		t.Error("empty annotation was restored")
+	}
+}
@@ -0,0 +1,207 @@
+package download
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/config"
+	"github.com/elsbrock/plundrio/internal/events"
+	"github.com/elsbrock/plundrio/internal/log"
+	"github.com/elsbrock/plundrio/internal/state"
+)
+
+// UsageState is the name of the state document counting the bytes each API
+// user downloaded per month
+const UsageState = "usage"
+
+// quotaRecheckInterval is how often adds held back by a quota check again
+const quotaRecheckInterval = 30 * time.Second
+
+// quotaPendingWindow is how long an added transfer the provider does not list
+// yet counts against the concurrent transfers of its user
+const quotaPendingWindow = time.Hour
+
+// ErrQuotaExceeded is returned when a user adds a transfer beyond their quota
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// Usage counts the bytes downloaded by each API user per month ("2006-01")
+type Usage struct {
+	Months map[string]map[string]int64 `json:"months"`
+}
+
+// quotas tracks how much each API user downloaded for their monthly quota
+type quotas struct {
+	mu      sync.Mutex
+	store   *state.Store // nil without a state directory
+	months  map[string]map[string]int64
+	reserve sync.Mutex // serializes quota checks with reserving transfers
+}
+
+// newQuotas loads the usage of earlier runs from the state directory
+func newQuotas(stateDir string) *quotas {
+	q := &quotas{months: make(map[string]map[string]int64)}
+	if stateDir == "" {
+		return q
+	}
+
+	store, err := state.New(stateDir)
+	if err != nil {
+		log.Warn("quota").Err(err).Msg("Monthly usage will not be remembered")
+		return q
+	}
+	q.store = store
+
+	var usage Usage
+	if err := store.Load(UsageState, &usage); err != nil {
+		log.Warn("quota").Err(err).Msg("Failed to load monthly usage")
+		return q
+	}
+	if usage.Months != nil {
+		q.months = usage.Months
+	}
+	return q
+}
+
+// month returns the key of the month a time falls in
+func month(t time.Time) string {
+	return t.Format("2006-01")
+}
+
+// recordUsage counts a completed transfer against the monthly quota of the
+// user who added it. Only this and the previous month are kept.
+func (m *Manager) recordUsage(event events.Event) {
+	if event.RequestedBy == "" || event.Size <= 0 {
+		return
+	}
+
+	q := m.quotas
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	current, previous := month(now), month(now.AddDate(0, -1, 0))
+	for key := range q.months {
+		if key != current && key != previous {
+			delete(q.months, key)
+		}
+	}
+	if q.months[current] == nil {
+		q.months[current] = make(map[string]int64)
+	}
+	q.months[current][event.RequestedBy] += event.Size
+
+	if q.store == nil {
+		return
+	}
+	if err := q.store.Save(UsageState, Usage{Months: q.months}); err != nil {
+		log.Warn("quota").Err(err).Msg("Failed to save monthly usage")
+	}
+}
+
+// MonthlyUsage returns the bytes a user downloaded this month
+func (m *Manager) MonthlyUsage(user string) int64 {
+	m.quotas.mu.Lock()
+	defer m.quotas.mu.Unlock()
+	return m.quotas.months[month(time.Now())][user]
+}
+
+// apiUser returns the configuration of an API user
+func (m *Manager) apiUser(name string) (config.APIUser, bool) {
+	for _, user := range m.cfg.APIUsers {
+		if user.Name == name {
+			return user, true
+		}
+	}
+	return config.APIUser{}, false
+}
+
+// ActiveTransfers counts the transfers a user added that are not downloaded
+// yet: those the provider lists and plundrio has not processed, and those
+// added recently the provider does not list yet
+func (m *Manager) ActiveTransfers(user string) int {
+	listed := make(map[int64]bool)
+	if processor := m.GetTransferProcessor(); processor != nil {
+		for _, t := range processor.GetTransfers() {
+			if _, processed := processor.processedTransfers.Load(t.ID); !processed {
+				listed[t.ID] = true
+			}
+		}
+	}
+
+	m.notes.mu.Lock()
+	defer m.notes.mu.Unlock()
+	active := 0
+	for id, note := range m.notes.transfers {
+		if note.RequestedBy == user && listed[id] {
+			active++
+		}
+	}
+	for _, note := range m.notes.pending {
+		if note.RequestedBy == user && time.Since(note.UpdatedAt) < quotaPendingWindow {
+			active++
+		}
+	}
+	return active
+}
+
+// QuotaExceeded returns an error wrapping ErrQuotaExceeded if a user may not
+// add another transfer right now, or nil if they may or have no quota
+func (m *Manager) QuotaExceeded(user string) error {
+	limits, ok := m.apiUser(user)
+	if !ok {
+		return nil
+	}
+	if limits.MaxTransfers > 0 {
+		if active := m.ActiveTransfers(user); active >= limits.MaxTransfers {
+			return fmt.Errorf("%w: %s has %d of %d transfers running", ErrQuotaExceeded, user, active, limits.MaxTransfers)
+		}
+	}
+	if limits.MonthlyGB > 0 {
+		if used := m.MonthlyUsage(user); used >= int64(limits.MonthlyGB)<<30 {
+			return fmt.Errorf("%w: %s downloaded %d of %d GB this month", ErrQuotaExceeded, user, used>>30, limits.MonthlyGB)
+		}
+	}
+	return nil
+}
+
+// QueuesOverQuota reports whether adds beyond a quota are held back until
+// the quota allows them instead of being rejected
+func (m *Manager) QueuesOverQuota() bool {
+	return m.cfg.QuotaAction == config.QuotaActionQueue
+}
+
+// reserveQuota checks the quota of the user adding a transfer and remembers
+// its annotation under key, so it counts against the quota right away. With
+// the queue action it waits until the quota allows the transfer, otherwise
+// it fails with ErrQuotaExceeded.
+func (m *Manager) reserveQuota(key string, note Annotation) error {
+	logged := false
+	for {
+		m.quotas.reserve.Lock()
+		err := m.QuotaExceeded(note.RequestedBy)
+		if err == nil {
+			m.annotateAdded(key, note)
+			m.quotas.reserve.Unlock()
+			return nil
+		}
+		m.quotas.reserve.Unlock()
+
+		if !m.QueuesOverQuota() {
+			return err
+		}
+		if !logged {
+			log.Info("quota").
+				Str("user", note.RequestedBy).
+				Err(err).
+				Msg("Holding back transfer until the quota allows it")
+			logged = true
+		}
+		select {
+		case <-time.After(quotaRecheckInterval):
+		case <-m.stopChan:
+			return err
+		}
+	}
+}
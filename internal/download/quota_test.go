@@ -0,0 +1,109 @@
+package download
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/config"
+	"github.com/elsbrock/plundrio/internal/events"
+)
+
+// quotaManager returns a manager whose user alice may run two transfers and
+// download 1 GB a month
+func quotaManager(stateDir, action string) *Manager {
+	return &Manager{
+		cfg: &config.Config{
+			APIUsers:    []config.APIUser{{Name: "alice", MaxTransfers: 2, MonthlyGB: 1}},
+			QuotaAction: action,
+		},
+		notes:    newAnnotations(""),
+		quotas:   newQuotas(stateDir),
+		stopChan: make(chan struct{}),
+	}
+}
+
+func TestRecordUsage(t *testing.T) {
+	stateDir := t.TempDir()
+	m := quotaManager(stateDir, config.QuotaActionReject)
+	old := month(time.Now().AddDate(0, -2, 0))
+	previous := month(time.Now().AddDate(0, -1, 0))
+	m.quotas.months[old] = map[string]int64{"alice": 1}
+	m.quotas.months[previous] = map[string]int64{"alice": 2}
+
+	m.recordUsage(events.Event{RequestedBy: "alice", Size: 100})
+	m.recordUsage(events.Event{RequestedBy: "alice", Size: 50})
+	m.recordUsage(events.Event{RequestedBy: "bob", Size: 10})
+	m.recordUsage(events.Event{Size: 1000})
+	m.recordUsage(events.Event{RequestedBy: "alice"})
+
+	// Usage survives a restart, months before the previous one do not
+	m = quotaManager(stateDir, config.QuotaActionReject)
+	if used := m.MonthlyUsage("alice"); used != 150 {
+		t.Errorf("usage of alice = %d, want 150", used)
+	}
+	if used := m.MonthlyUsage("bob"); used != 10 {
+		t.Errorf("usage of bob = %d, want 10", used)
+	}
+	if _, ok := m.quotas.months[old]; ok {
+		t.Errorf("usage of %s was kept", old)
+	}
+	if m.quotas.months[previous]["alice"] != 2 {
+		t.Errorf("usage of the previous month = %v, want it kept", m.quotas.months[previous])
+	}
+}
+
+func TestQuotaExceeded(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		user     string
+		pending  []time.Duration // ages of transfers alice added the provider does not list yet
+		usage    int64
+		exceeded bool
+	}{
+		{name: "within quota", user: "alice", pending: []time.Duration{0}, usage: 1<<30 - 1},
+		{name: "too many transfers", user: "alice", pending: []time.Duration{0, time.Minute}, exceeded: true},
+		{name: "transfers never listed", user: "alice", pending: []time.Duration{0, quotaPendingWindow + time.Minute}},
+		{name: "monthly usage", user: "alice", usage: 1 << 30, exceeded: true},
+		{name: "without quota", user: "bob", pending: []time.Duration{0, 0, 0}, usage: 1 << 40},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			m := quotaManager("", config.QuotaActionReject)
+			for i, age := range tt.pending {
+				m.notes.pending[string(rune('a'+i))] = Annotation{RequestedBy: tt.user, UpdatedAt: time.Now().Add(-age)}
+			}
+			m.quotas.months[month(time.Now())] = map[string]int64{tt.user: tt.usage}
+
+			err := m.QuotaExceeded(tt.user)
+			if exceeded := errors.Is(err, ErrQuotaExceeded); exceeded != tt.exceeded {
+				t.Errorf("QuotaExceeded = %v, want exceeded %v", err, tt.exceeded)
+			}
+		})
+	}
+}
+
+func TestReserveQuota(t *testing.T) {
+	m := quotaManager("", config.QuotaActionReject)
+	note := Annotation{RequestedBy: "alice"}
+	for _, key := range []string{"one", "two"} {
+		if err := m.reserveQuota(key, note); err != nil {
+			t.Fatalf("reserving %s failed: %v", key, err)
+		}
+	}
+
+	// Reserved transfers count right away
+	if err := m.reserveQuota("three", note); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("reserving a third transfer = %v, want %v", err, ErrQuotaExceeded)
+	}
+	if _, ok := m.notes.pending["three"]; ok {
+		t.Error("rejected transfer was reserved")
+	}
+
+	// Queued adds wait until the quota allows them or plundrio stops
+	m = quotaManager("", config.QuotaActionQueue)
+	m.quotas.months[month(time.Now())] = map[string]int64{"alice": 1 << 30}
+	close(m.stopChan)
+	if err := m.reserveQuota("one", note); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("reserving after stopping = %v, want %v", err, ErrQuotaExceeded)
+	}
+}
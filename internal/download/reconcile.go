@@ -0,0 +1,334 @@
+package download
+
+import (
+	"errors"
+	"time"
+
+	"github.com/elsbrock/go-putio"
+	"github.com/elsbrock/plundrio/internal/events"
+	"github.com/elsbrock/plundrio/internal/log"
+	"github.com/elsbrock/plundrio/internal/provider"
+)
+
+// Reasons of transfer.reconciled events
+const (
+	ReconcileRemovedRemotely = "removed_remotely" // transfer and files were deleted at the provider, the download was cancelled
+	ReconcileFilesAdded      = "files_added"      // files showed up at the provider after the download started and were queued
+	ReconcileStaleState      = "stale_state"      // local records of a transfer the provider no longer knows were dropped
+)
+
+// reconcilePeriodically compares local transfer state with the provider and
+// repairs what diverged, such as transfers deleted in the put.io web interface
+func (m *Manager) reconcilePeriodically() {
+	ticker := time.NewTicker(m.dlConfig.ReconcileInterval)
+	defer ticker.Stop()
+
+	stale := make(map[int64]bool) // transfers with stale records at the last reconciliation
+	for {
+		select {
+		case <-m.stopChan:
+			return
+		case <-ticker.C:
+			m.reconcile(stale)
+		}
+	}
+}
+
+// reconcile compares local transfer state with the provider once. Records
+// that look stale are only dropped if they still do at the next run, so
+// transfers added in the meantime are not mistaken for stale ones.
+func (m *Manager) reconcile(stale map[int64]bool) {
+	if m.InMaintenance() {
+		log.Debug("reconcile").Msg("Skipping reconciliation during maintenance window")
+		return
+	}
+
+	transfers, err := m.provider.ListTransfers(m.ctx)
+	if err != nil {
+		log.Error("reconcile").Err(err).Msg("Failed to get transfers")
+		return
+	}
+	listed := make(map[int64]bool, len(transfers))
+	for _, t := range transfers {
+		listed[t.ID] = true
+	}
+
+	var contexts []*TransferContext
+	m.coordinator.GetAllTransfers(func(ctx *TransferContext) {
+		contexts = append(contexts, ctx)
+	})
+
+	for _, ctx := range contexts {
+		select {
+		case <-m.stopChan:
+			return
+		default:
+		}
+
+		ctx.Mu.RLock()
+		state := ctx.State
+		fileID := ctx.FileID
+		ctx.Mu.RUnlock()
+
+		if state == TransferLifecycleCompleted || state == TransferLifecycleProcessed || state == TransferLifecycleCancelled || fileID == 0 {
+			continue
+		}
+		// Put.io forgets finished transfers after a while, only a transfer
+		// whose files are gone as well was removed
+		if !listed[ctx.ID] && m.removedRemotely(ctx) {
+			continue
+		}
+		if state == TransferLifecycleDownloading {
+			m.queueAddedFiles(ctx)
+		}
+	}
+
+	m.pruneStaleState(listed, stale)
+}
+
+// removedRemotely cancels the download of a transfer whose files no longer
+// exist at the provider and reports whether it did
+func (m *Manager) removedRemotely(ctx *TransferContext) bool {
+	if _, err := m.provider.GetFile(m.ctx, ctx.FileID); err == nil || !errors.Is(err, provider.ErrFileNotFound) {
+		if err != nil {
+			log.Debug("reconcile").
+				Int64("transfer_id", ctx.ID).
+				Err(err).
+				Msg("Failed to check transfer files")
+		}
+		return false
+	}
+
+	log.Warn("reconcile").
+		Int64("transfer_id", ctx.ID).
+		Str("name", ctx.Name).
+		Msg("Transfer was removed from the provider, cancelling its download")
+	m.CancelTransfer(ctx.ID)
+	m.publishReconciled(ctx, ReconcileRemovedRemotely, 0)
+	return true
+}
+
+// queueAddedFiles downloads files the provider lists for a transfer that were
+// not there when its download started
+func (m *Manager) queueAddedFiles(ctx *TransferContext) {
+	processor := m.GetTransferProcessor()
+	if processor == nil {
+		return
+	}
+
+	files, err := m.provider.GetAllTransferFiles(m.ctx, ctx.FileID)
+	if err != nil {
+		log.Debug("reconcile").
+			Int64("transfer_id", ctx.ID).
+			Err(err).
+			Msg("Failed to list transfer files")
+		return
+	}
+
+	ctx.Mu.RLock()
+	transfer := &putio.Transfer{ID: ctx.ID, Name: ctx.Name, FileID: ctx.FileID}
+	var added []*putio.File
+	if ctx.files != nil {
+		for _, file := range files {
+			if _, known := ctx.files[file.ID]; !known {
+				added = append(added, file)
+			}
+		}
+	}
+	ctx.Mu.RUnlock()
+	if len(added) == 0 {
+		return
+	}
+
+	var jobs []downloadJob
+	var size int64
+	for _, file := range added {
+		job := newDownloadJob(transfer, file)
+		if !m.claimPath(&job) {
+			continue
+		}
+		jobs = append(jobs, job)
+		size += job.Size
+	}
+
+	// The transfer may have finished meanwhile, its files are not touched then
+	ctx.Mu.Lock()
+	if ctx.State != TransferLifecycleDownloading {
+		ctx.Mu.Unlock()
+		return
+	}
+	for _, file := range added {
+		ctx.files[file.ID] = struct{}{}
+	}
+	for _, job := range jobs {
+		ctx.wanted = append(ctx.wanted, wantedFile{FileID: job.FileID, Name: job.Name, Size: job.Size})
+	}
+	ctx.TotalFiles += int32(len(jobs))
+	ctx.TotalSize += size
+	ctx.Mu.Unlock()
+
+	log.Info("reconcile").
+		Int64("transfer_id", ctx.ID).
+		Str("name", ctx.Name).
+		Int("files", len(jobs)).
+		Int64("size", size).
+		Msg("Transfer has new files at the provider, downloading them as well")
+	m.publishReconciled(ctx, ReconcileFilesAdded, size)
+
+	for _, job := range jobs {
+		if processor.shouldDownloadFile(job) {
+			processor.queueFileDownload(job)
+			continue
+		}
+		ctx.Mu.Lock()
+		ctx.DownloadedSize += job.Size
+		ctx.Mu.Unlock()
+		if err := m.coordinator.FileCompleted(ctx.ID); err != nil {
+			log.Error("reconcile").
+				Int64("transfer_id", ctx.ID).
+				Str("file_name", job.Name).
+				Err(err).
+				Msg("Failed to mark existing file as completed")
+		}
+	}
+}
+
+// pruneStaleState drops the records of transfers that neither the provider
+// nor the coordinator knows anymore, such as cancellations, pauses, target
+// directories and claimed paths of transfers deleted at the provider
+func (m *Manager) pruneStaleState(listed map[int64]bool, stale map[int64]bool) {
+	candidates := make(map[int64]bool)
+	for _, id := range m.recordedTransfers() {
+		if listed[id] || !m.forgettable(id) {
+			continue
+		}
+		candidates[id] = true
+	}
+
+	for id := range stale {
+		if !candidates[id] {
+			delete(stale, id)
+		}
+	}
+	for id := range candidates {
+		if !stale[id] {
+			stale[id] = true
+			continue
+		}
+		delete(stale, id)
+		m.forgetTransfer(id)
+	}
+}
+
+// recordedTransfers returns the IDs of all transfers with local records
+func (m *Manager) recordedTransfers() []int64 {
+	var ids []int64
+
+	m.pauseMu.Lock()
+	for id := range m.cancelled {
+		ids = append(ids, id)
+	}
+	for id := range m.pausedJobs {
+		ids = append(ids, id)
+	}
+	m.pauseMu.Unlock()
+
+	m.claimsMu.Lock()
+	for _, claim := range m.claims {
+		ids = append(ids, claim.TransferID)
+	}
+	m.claimsMu.Unlock()
+
+	for id := range m.targetDirs.all() {
+		ids = append(ids, id)
+	}
+	m.coordinator.GetAllTransfers(func(ctx *TransferContext) {
+		ids = append(ids, ctx.ID)
+	})
+	if processor := m.GetTransferProcessor(); processor != nil {
+		processor.retryAttempts.Range(func(key, value interface{}) bool {
+			ids = append(ids, key.(int64))
+			return true
+		})
+	}
+	return ids
+}
+
+// forgettable reports whether the records of a transfer the provider does
+// not list can be dropped: it was not downloaded, any download of it was
+// cancelled and none of its files is queued or downloading
+func (m *Manager) forgettable(transferID int64) bool {
+	if processor := m.GetTransferProcessor(); processor != nil {
+		if _, processed := processor.processedTransfers.Load(transferID); processed {
+			return false
+		}
+	}
+	if value, ok := m.coordinator.transfers.Load(transferID); ok {
+		ctx := value.(*TransferContext)
+		ctx.Mu.RLock()
+		cancelled := ctx.State == TransferLifecycleCancelled
+		ctx.Mu.RUnlock()
+		if !cancelled {
+			return false
+		}
+	}
+
+	active := false
+	m.activeFiles.Range(func(key, value interface{}) bool {
+		active = value.(int64) == transferID
+		return !active
+	})
+	return !active
+}
+
+// forgetTransfer drops all local records of a transfer
+func (m *Manager) forgetTransfer(transferID int64) {
+	m.pauseMu.Lock()
+	held := m.pausedJobs[transferID]
+	delete(m.pausedJobs, transferID)
+	delete(m.cancelled, transferID)
+	if signal, ok := m.pauseSignals[transferID]; ok {
+		close(signal)
+		delete(m.pauseSignals, transferID)
+	}
+	m.pauseMu.Unlock()
+
+	for _, job := range held {
+		m.releaseJob(job)
+	}
+	m.releaseClaims(transferID)
+	m.targetDirs.delete(transferID)
+	if processor := m.GetTransferProcessor(); processor != nil {
+		processor.retryAttempts.Delete(transferID)
+	}
+
+	event := events.Event{Type: events.TransferReconciled, TransferID: transferID, Reason: ReconcileStaleState}
+	if value, ok := m.coordinator.transfers.LoadAndDelete(transferID); ok {
+		ctx := value.(*TransferContext)
+		ctx.Mu.RLock()
+		event.Name = ctx.Name
+		if ctx.Transfer != nil {
+			event.Hash = ctx.Transfer.Hash
+		}
+		ctx.Mu.RUnlock()
+	}
+
+	log.Info("reconcile").
+		Int64("transfer_id", transferID).
+		Str("name", event.Name).
+		Msg("Dropped records of a transfer the provider no longer knows")
+	m.publish(event)
+}
+
+// publishReconciled publishes a transfer.reconciled event for a transfer.
+// size is the amount of data the correction concerns, if any.
+func (m *Manager) publishReconciled(ctx *TransferContext, reason string, size int64) {
+	ctx.Mu.RLock()
+	event := m.transferEvent(ctx, events.TransferReconciled, nil)
+	ctx.Mu.RUnlock()
+	event.Reason = reason
+	if size > 0 {
+		event.Size = size
+	}
+	m.publish(event)
+}
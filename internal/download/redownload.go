@@ -0,0 +1,110 @@
+package download
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/elsbrock/plundrio/internal/log"
+	"github.com/elsbrock/plundrio/internal/provider"
+)
+
+// FindFile returns the transfer and Put.io file ID of a local file, as long as
+// its transfer is still tracked
+func (m *Manager) FindFile(path string) (transferID, fileID int64, ok bool) {
+	path = filepath.Clean(path)
+	m.coordinator.GetAllTransfers(func(ctx *TransferContext) {
+		if ok {
+			return
+		}
+		ctx.Mu.RLock()
+		defer ctx.Mu.RUnlock()
+		dir := m.TargetDir(ctx.ID)
+		for _, file := range ctx.wanted {
+			if filepath.Join(dir, file.Name) == path {
+				transferID, fileID, ok = ctx.ID, file.FileID, true
+				return
+			}
+		}
+	})
+	return transferID, fileID, ok
+}
+
+// RedownloadFile deletes the local copy of a downloaded file, e.g. one found
+// to be corrupt, and downloads it again. This only works while the file still
+// exists on Put.io, which is the case for manually queued files, before
+// cleanup-on import deleted it and for partially completed transfers.
+func (m *Manager) RedownloadFile(transferID, fileID int64) error {
+	ctx, ok := m.coordinator.GetTransferContext(transferID)
+	if !ok {
+		return NewTransferNotFoundError(transferID)
+	}
+
+	ctx.Mu.RLock()
+	var file wantedFile
+	found := false
+	for _, f := range ctx.wanted {
+		if f.FileID == fileID {
+			file, found = f, true
+			break
+		}
+	}
+	for _, f := range ctx.failed {
+		if f.FileID == fileID {
+			found = false
+		}
+	}
+	state := ctx.State
+	ctx.Mu.RUnlock()
+	if !found {
+		return fmt.Errorf("file %d is not a downloaded file of transfer %d", fileID, transferID)
+	}
+	if state != TransferLifecycleProcessed && state != TransferLifecycleDownloading && state != TransferLifecycleFailed {
+		return fmt.Errorf("transfer %d is %s, files can only be downloaded again once it is processed, downloading or failed", transferID, state)
+	}
+	if _, active := m.activeFiles.Load(fileID); active {
+		return fmt.Errorf("file %d is already being downloaded", fileID)
+	}
+
+	// Check Put.io first, the local copy is better than nothing
+	if _, err := m.provider.GetFile(m.ctx, fileID); err != nil {
+		if errors.Is(err, provider.ErrFileNotFound) {
+			return NewFileMissingError(file.Name)
+		}
+		return fmt.Errorf("failed to get file: %w", err)
+	}
+
+	// Along with the local copy goes a partial download of it
+	path := filepath.Join(m.TargetDir(transferID), file.Name)
+	var paths []string
+	for _, p := range []string{path, m.incompletePath(path)} {
+		paths = append(paths, p)
+		for _, suffix := range controlSuffixes {
+			paths = append(paths, p+suffix)
+		}
+	}
+	for _, p := range paths {
+		if err := os.Remove(longPath(p)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to delete local copy: %w", err)
+		}
+	}
+
+	ctx.Mu.Lock()
+	if ctx.CompletedFiles > 0 {
+		ctx.CompletedFiles--
+	}
+	ctx.DownloadedSize = max(ctx.DownloadedSize-file.Size, 0)
+	ctx.State = TransferLifecycleDownloading
+	ctx.Mu.Unlock()
+
+	log.Info("download").
+		Str("file_name", file.Name).
+		Int64("transfer_id", transferID).
+		Int64("file_id", fileID).
+		Msg("Deleted local copy, downloading file again")
+
+	// Queueing may block while the workers are busy
+	go m.redownloadFiles(transferID, []wantedFile{file})
+	return nil
+}
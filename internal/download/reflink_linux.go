@@ -0,0 +1,16 @@
+//go:build linux
+
+package download
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// cloneFile makes dst share the data of src instead of copying it (FICLONE).
+// It fails on filesystems without reflink support, e.g. ext4, and when src
+// and dst are on different filesystems.
+func cloneFile(dst, src *os.File) error {
+	return unix.IoctlFileClone(int(dst.Fd()), int(src.Fd()))
+}
@@ -0,0 +1,167 @@
+package download
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/config"
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// RetentionEntry describes a local download considered by the retention policy
+type RetentionEntry struct {
+	Path      string  `json:"path"`
+	Category  string  `json:"category"`
+	Size      int64   `json:"size"`
+	AgeDays   float64 `json:"age_days"`
+	KeepDays  int     `json:"keep_days"`
+	Expired   bool    `json:"expired"`
+	InUse     bool    `json:"in_use"`
+	Imported  bool    `json:"imported"`
+	updatedAt time.Time
+}
+
+// RetentionReport lists all local downloads with their retention status.
+// Nothing is deleted, which makes it usable as a dry run.
+func (m *Manager) RetentionReport() ([]RetentionEntry, error) {
+	root := m.DefaultTargetDir()
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var report []RetentionEntry
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		// Category directories hold one download per entry
+		if days, ok := m.cfg.RetentionCategories[entry.Name()]; ok && entry.IsDir() {
+			children, err := os.ReadDir(filepath.Join(root, entry.Name()))
+			if err != nil {
+				return nil, err
+			}
+			for _, child := range children {
+				report = append(report, m.retentionEntry(filepath.Join(root, entry.Name(), child.Name()), entry.Name(), days))
+			}
+			continue
+		}
+		report = append(report, m.retentionEntry(filepath.Join(root, entry.Name()), "", m.cfg.RetentionDays))
+	}
+	return report, nil
+}
+
+// retentionEntry evaluates a single local download against its retention period
+func (m *Manager) retentionEntry(path, category string, keepDays int) RetentionEntry {
+	entry := RetentionEntry{
+		Path:     path,
+		Category: category,
+		KeepDays: keepDays,
+	}
+
+	// Walk the download to find its size, latest change and any partial files
+	filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		for _, suffix := range controlSuffixes {
+			if strings.HasSuffix(p, suffix) {
+				entry.InUse = true
+			}
+		}
+		if info, err := d.Info(); err == nil {
+			if !d.IsDir() {
+				entry.Size += info.Size()
+			}
+			if info.ModTime().After(entry.updatedAt) {
+				entry.updatedAt = info.ModTime()
+			}
+		}
+		return nil
+	})
+
+	// Downloads plundrio is still working on are never touched
+	name := filepath.Base(path)
+	m.coordinator.GetAllTransfers(func(ctx *TransferContext) {
+		ctx.Mu.RLock()
+		defer ctx.Mu.RUnlock()
+		if ctx.Name == name && ctx.State != TransferLifecycleProcessed {
+			entry.InUse = true
+		}
+	})
+
+	// Once imported, the retention period starts at the import
+	since := entry.updatedAt
+	if importedAt, ok := m.ImportedAt(path); ok {
+		entry.Imported = true
+		since = importedAt
+	} else if m.cfg.CleanupOn == config.CleanupOnImport && isImported(path) {
+		// Imported before the last restart, the import time is unknown
+		entry.Imported = true
+	}
+
+	entry.AgeDays = time.Since(since).Hours() / 24
+	entry.Expired = keepDays > 0 && !entry.InUse && entry.AgeDays >= float64(keepDays)
+
+	// When cleanup waits for imports, so does retention
+	if m.cfg.CleanupOn == config.CleanupOnImport && !entry.Imported {
+		entry.Expired = false
+	}
+	return entry
+}
+
+// enforceRetention deletes local downloads whose retention period has passed
+func (m *Manager) enforceRetention() {
+	report, err := m.RetentionReport()
+	if err != nil {
+		log.Error("retention").Err(err).Msg("Failed to evaluate retention policy")
+		return
+	}
+
+	for _, entry := range report {
+		if !entry.Expired {
+			continue
+		}
+
+		if m.Settings().RetentionDryRun {
+			log.Info("retention").
+				Str("path", entry.Path).
+				Str("category", entry.Category).
+				Int64("size", entry.Size).
+				Float64("age_days", entry.AgeDays).
+				Msg("Would delete expired download (dry run)")
+			continue
+		}
+
+		if err := os.RemoveAll(longPath(entry.Path)); err != nil {
+			log.Error("retention").
+				Str("path", entry.Path).
+				Err(err).
+				Msg("Failed to delete expired download")
+			continue
+		}
+		log.Info("retention").
+			Str("path", entry.Path).
+			Str("category", entry.Category).
+			Int64("size", entry.Size).
+			Float64("age_days", entry.AgeDays).
+			Msg("Deleted expired download")
+	}
+}
+
+// retentionEnabled reports whether any retention period is configured
+func (m *Manager) retentionEnabled() bool {
+	if m.cfg.RetentionDays > 0 {
+		return true
+	}
+	for _, days := range m.cfg.RetentionCategories {
+		if days > 0 {
+			return true
+		}
+	}
+	return false
+}
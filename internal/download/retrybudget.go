@@ -0,0 +1,140 @@
+package download
+
+import (
+	"sync"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+const (
+	retryBudgetWindow = time.Hour   // retries are counted over this period
+	retryBackoffMin   = time.Minute // first backoff once the budget is used up
+	retryBackoffMax   = time.Hour   // backoffs double up to this
+)
+
+// RetryBudgetState is how much of the retry budget is used and whether
+// retries are backing off
+type RetryBudgetState struct {
+	Limit           int        `json:"limit"` // retries per hour, 0 is unlimited
+	Used            int        `json:"used"`  // retries in the last hour
+	BackingOffUntil *time.Time `json:"backing_off_until,omitempty"`
+}
+
+// retryBudget caps how often downloads are retried per hour across all
+// transfers. Once it is used up, retries wait for a backoff, after which a
+// single retry probes whether put.io recovered. The backoff doubles every
+// time the budget is still used up until a download succeeds, so an outage
+// at put.io is not answered with a flood of retries.
+type retryBudget struct {
+	mu      sync.Mutex
+	limit   int           // retries per hour, 0 is unlimited
+	retries []time.Time   // of the last hour, oldest first
+	backoff time.Duration // the last backoff, 0 after a success
+	until   time.Time     // retries wait until then
+	probe   bool          // a retry may go ahead once the backoff ended
+}
+
+// prune drops retries older than the window. The caller must hold mu.
+func (b *retryBudget) prune(now time.Time) {
+	i := 0
+	for i < len(b.retries) && now.Sub(b.retries[i]) >= retryBudgetWindow {
+		i++
+	}
+	b.retries = b.retries[i:]
+}
+
+// take books a retry and returns zero, or returns how long to wait before
+// asking again if retries are backing off
+func (b *retryBudget) take(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.limit <= 0 {
+		return 0
+	}
+	if now.Before(b.until) {
+		return b.until.Sub(now)
+	}
+	b.prune(now)
+	if len(b.retries) < b.limit || b.probe {
+		b.retries = append(b.retries, now)
+		b.probe = false
+		return 0
+	}
+
+	b.backoff = min(max(b.backoff*2, retryBackoffMin), retryBackoffMax)
+	b.until = now.Add(b.backoff)
+	b.probe = true
+	log.Warn("download").
+		Int("retries", len(b.retries)).
+		Int("budget", b.limit).
+		Dur("backoff", b.backoff).
+		Time("until", b.until).
+		Msg("Retry budget used up, backing off")
+	return b.backoff
+}
+
+// backingOff reports whether retries wait for a backoff
+func (b *retryBudget) backingOff(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return now.Before(b.until)
+}
+
+// succeeded resets the backoff after a download completed
+func (b *retryBudget) succeeded() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.backoff = 0
+}
+
+// state returns how much of the budget is used
+func (b *retryBudget) state(now time.Time) RetryBudgetState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.prune(now)
+	state := RetryBudgetState{Limit: b.limit, Used: len(b.retries)}
+	if now.Before(b.until) {
+		until := b.until
+		state.BackingOffUntil = &until
+	}
+	return state
+}
+
+// RetryBudget returns how much of the retry budget is used and until when
+// retries are backing off
+func (m *Manager) RetryBudget() RetryBudgetState {
+	return m.retries.state(time.Now())
+}
+
+// waitForRetry waits before a download is retried: delay, or longer if the
+// retry budget is used up. It returns false if the download was stopped
+// in the meantime.
+func (m *Manager) waitForRetry(state *DownloadState, delay time.Duration) bool {
+	ctx, cancel := m.newStopContext(state.TransferID)
+	defer cancel()
+
+	for {
+		wait := m.retries.take(time.Now())
+		if wait == 0 {
+			break
+		}
+		log.Info("download").
+			Str("file_name", state.Name).
+			Int64("transfer_id", state.TransferID).
+			Dur("wait", wait).
+			Msg("Waiting for the retry backoff to end")
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(wait):
+		}
+	}
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(delay):
+		return true
+	}
+}
@@ -0,0 +1,100 @@
+package download
+
+import (
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/elsbrock/plundrio/internal/config"
+	"github.com/elsbrock/plundrio/internal/log"
+	"github.com/elsbrock/plundrio/internal/provider"
+)
+
+// providerRoute is a provider route with its expression compiled
+type providerRoute struct {
+	config.ProviderRoute
+	match *regexp.Regexp
+}
+
+// compileRoutes compiles the expressions of provider routes, leaving out
+// routes whose expression is invalid
+func compileRoutes(routes []config.ProviderRoute) []providerRoute {
+	compiled := make([]providerRoute, 0, len(routes))
+	for _, route := range routes {
+		r := providerRoute{ProviderRoute: route}
+		if route.Match != "" {
+			match, err := regexp.Compile(route.Match)
+			if err != nil {
+				log.Error("provider").Str("match", route.Match).Err(err).Msg("Ignoring provider route with invalid expression")
+				continue
+			}
+			r.match = match
+		}
+		compiled = append(compiled, r)
+	}
+	return compiled
+}
+
+// Route returns the provider a new transfer with the given name and category
+// goes to first, or an empty string if no provider route matches. Routes with
+// a category and an expression need both to match.
+func (m *Manager) Route(name, category string) string {
+	for _, route := range m.routes {
+		if route.Category != "" && !strings.EqualFold(route.Category, category) {
+			continue
+		}
+		if route.match != nil && !route.match.MatchString(name) {
+			continue
+		}
+		return route.Provider
+	}
+	return ""
+}
+
+// AddTransfer adds a transfer from a magnet link or a URL, to the provider
+// its category or name is routed to, with optional notes, metadata and the
+// user who added it. Transfers beyond the user's quota are rejected with
+// ErrQuotaExceeded or held back until the quota allows them.
+func (m *Manager) AddTransfer(link, category string, note Annotation) error {
+	key := ownedKey(link)
+	if err := m.reserveQuota(key, note); err != nil {
+		return err
+	}
+	m.owned.add(key)
+	if err := provider.AddTransferTo(m.ctx, m.provider, m.Route(TransferName(link), category), link, m.cfg.FolderID); err != nil {
+		m.forgetAdded(key)
+		return err
+	}
+	return nil
+}
+
+// AddTorrent adds a transfer from the contents of a .torrent file, to the
+// provider its category or name is routed to, with optional notes, metadata
+// and the user who added it. Quotas apply as with AddTransfer.
+func (m *Manager) AddTorrent(data []byte, filename, category string, note Annotation) error {
+	name := strings.TrimSuffix(filename, ".torrent")
+	hash := TorrentHash(data)
+	if err := m.reserveQuota(hash, note); err != nil {
+		return err
+	}
+	m.owned.add(hash)
+	if err := provider.AddTorrentTo(m.ctx, m.provider, m.Route(name, category), data, filename, m.cfg.FolderID); err != nil {
+		m.forgetAdded(hash)
+		return err
+	}
+	return nil
+}
+
+// TransferName returns the name of a transfer from its magnet link or URL:
+// the display name of a magnet link or the last element of a URL path
+func TransferName(link string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return link
+	}
+	if u.Scheme == "magnet" {
+		return u.Query().Get("dn")
+	}
+	return path.Base(u.Path)
+}
@@ -0,0 +1,78 @@
+package download
+
+import (
+	"context"
+	"errors"
+
+	"github.com/elsbrock/plundrio/internal/config"
+	"github.com/elsbrock/plundrio/internal/log"
+	"github.com/elsbrock/plundrio/internal/provider"
+	"github.com/elsbrock/plundrio/internal/scheduler"
+)
+
+// Scheduler returns the scheduler running recurring actions. Actions of
+// other components, such as reports, must be registered before Start.
+func (m *Manager) Scheduler() *scheduler.Scheduler {
+	return m.scheduler
+}
+
+// registerActions makes the manager's recurring work available to schedules
+func (m *Manager) registerActions() {
+	m.scheduler.Register(config.ActionScan, m.Scan)
+	m.scheduler.Register(config.ActionEmptyTrash, m.emptyTrash)
+	m.scheduler.Register(config.ActionCleanup, func(context.Context) error {
+		m.enforceRetention()
+		return nil
+	})
+	m.scheduler.Register(config.ActionMirror, m.mirror)
+}
+
+// startSchedules sets up the configured schedules and the fixed intervals of
+// empty-trash-interval, retention enforcement and mirror-interval
+func (m *Manager) startSchedules() {
+	if m.cfg.EmptyTrashInterval > 0 {
+		m.scheduler.AddInterval(config.ActionEmptyTrash, m.cfg.EmptyTrashInterval)
+	}
+	if m.retentionEnabled() {
+		m.scheduler.AddInterval(config.ActionCleanup, m.dlConfig.RetentionCheckInterval)
+	}
+	if len(m.cfg.Mirrors) > 0 && m.cfg.MirrorInterval > 0 {
+		m.scheduler.AddInterval(config.ActionMirror, m.cfg.MirrorInterval)
+	}
+	if err := m.scheduler.Set(m.cfg.Schedules); err != nil {
+		log.Error("scheduler").Err(err).Msg("Ignoring invalid schedules")
+	}
+
+	m.monitorWg.Add(1)
+	go func() {
+		defer m.monitorWg.Done()
+		// Expired downloads are deleted right away instead of an interval later
+		if m.retentionEnabled() {
+			m.enforceRetention()
+		}
+		// Mirrored folders catch up with changes made while stopped
+		if len(m.cfg.Mirrors) > 0 {
+			m.mirror(m.ctx)
+		}
+		m.scheduler.Run(m.stopChan)
+	}()
+}
+
+// emptyTrash empties the trash of every provider that has one, so deleted
+// files stop counting against quota
+func (m *Manager) emptyTrash(ctx context.Context) error {
+	var errs []error
+	for _, member := range provider.All(m.provider) {
+		trash, ok := member.(provider.Trash)
+		if !ok {
+			continue
+		}
+		if err := trash.EmptyTrash(ctx); err != nil {
+			log.Error("cleanup").Str("provider", member.Name()).Err(err).Msg("Failed to empty trash")
+			errs = append(errs, err)
+			continue
+		}
+		log.Info("cleanup").Str("provider", member.Name()).Msg("Emptied trash")
+	}
+	return errors.Join(errs...)
+}
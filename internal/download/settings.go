@@ -0,0 +1,79 @@
+package download
+
+import (
+	"fmt"
+
+	"github.com/elsbrock/plundrio/internal/config"
+)
+
+// Settings are the settings that can be changed while the manager is running.
+// Changes apply to downloads started afterwards and are not persisted.
+type Settings struct {
+	SpeedLimit        int    // Download speed limit per download in KB/s (0 means unlimited)
+	AltSpeedLimit     int    // Alternative speed limit per download in KB/s (0 means unlimited)
+	AltSpeedEnabled   bool   // Use the alternative speed limit instead of SpeedLimit
+	MaxDownloadRate   int    // Speed limit of all downloads together in KB/s (0 means unlimited)
+	DownloadQueueSize int    // Downloads running at once (0 means one per worker)
+	BandwidthStrategy string // How connections are shared between downloads
+	SkipTrash         bool   // Delete remote files permanently
+	RetentionDryRun   bool   // Only report expired downloads
+}
+
+// Settings returns the settings currently in effect
+func (m *Manager) Settings() Settings {
+	m.settingsMu.RLock()
+	defer m.settingsMu.RUnlock()
+
+	return Settings{
+		SpeedLimit:        m.cfg.SpeedLimit,
+		AltSpeedLimit:     m.cfg.AltSpeedLimit,
+		AltSpeedEnabled:   m.altSpeed,
+		MaxDownloadRate:   m.cfg.MaxDownloadRate,
+		DownloadQueueSize: m.cfg.DownloadQueueSize,
+		BandwidthStrategy: m.cfg.BandwidthStrategy,
+		SkipTrash:         m.cfg.SkipTrash,
+		RetentionDryRun:   m.cfg.RetentionDryRun,
+	}
+}
+
+// UpdateSettings validates and applies changed settings
+func (m *Manager) UpdateSettings(settings Settings) error {
+	if settings.SpeedLimit < 0 {
+		return fmt.Errorf("invalid speed limit %d", settings.SpeedLimit)
+	}
+	if settings.AltSpeedLimit < 0 {
+		return fmt.Errorf("invalid alternative speed limit %d", settings.AltSpeedLimit)
+	}
+	if settings.MaxDownloadRate < 0 {
+		return fmt.Errorf("invalid download rate %d", settings.MaxDownloadRate)
+	}
+	if settings.DownloadQueueSize < 0 {
+		return fmt.Errorf("invalid download queue size %d", settings.DownloadQueueSize)
+	}
+	if settings.BandwidthStrategy != config.BandwidthStrategyFair && settings.BandwidthStrategy != config.BandwidthStrategyFinishFirst {
+		return fmt.Errorf("invalid bandwidth strategy %q (use fair or finish-first)", settings.BandwidthStrategy)
+	}
+
+	m.settingsMu.Lock()
+	m.cfg.SpeedLimit = settings.SpeedLimit
+	m.cfg.AltSpeedLimit = settings.AltSpeedLimit
+	m.altSpeed = settings.AltSpeedEnabled
+	rateChanged := m.cfg.MaxDownloadRate != settings.MaxDownloadRate
+	m.cfg.MaxDownloadRate = settings.MaxDownloadRate
+	queueChanged := m.cfg.DownloadQueueSize != settings.DownloadQueueSize
+	m.cfg.DownloadQueueSize = settings.DownloadQueueSize
+	m.cfg.BandwidthStrategy = settings.BandwidthStrategy
+	m.cfg.SkipTrash = settings.SkipTrash
+	m.cfg.RetentionDryRun = settings.RetentionDryRun
+	m.settingsMu.Unlock()
+
+	// Let waiting downloads start if the queue grew
+	if queueChanged {
+		m.queue.wake()
+	}
+	// Unlike the per-download limits, the overall one applies to running downloads
+	if rateChanged {
+		m.applyOverallLimit()
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package download
+
+import (
+	"cmp"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/log"
+	"github.com/elsbrock/plundrio/internal/state"
+)
+
+// ShutdownState is the name of the state document the shutdown report is
+// written to
+const ShutdownState = "shutdown"
+
+// ShutdownReport describes what was going on when plundrio stopped, what it
+// kept in the state directory and what it picks up again on the next start
+type ShutdownReport struct {
+	StoppedAt   time.Time          `json:"stopped_at"`
+	InFlight    []InFlightFile     `json:"in_flight"`    // files queued or downloading when stopping
+	DroppedJobs int                `json:"dropped_jobs"` // queued jobs dropped, queued again once their transfers are listed
+	Transfers   []ShutdownTransfer `json:"transfers"`    // transfers not processed yet, downloaded on the next start
+	Completions []Completion       `json:"completions"`  // interrupted completions finished on the next start
+	Persisted   []PersistedState   `json:"persisted"`    // state documents kept for the next start
+}
+
+// InFlightFile is a file that was queued or downloading when stopping
+type InFlightFile struct {
+	TransferID int64  `json:"transfer_id"`
+	FileID     int64  `json:"file_id"`
+	Path       string `json:"path,omitempty"`
+	Size       int64  `json:"size,omitempty"`
+	Downloaded int64  `json:"downloaded_bytes"` // bytes already on disk
+	Resumable  bool   `json:"resumable"`        // the partial download continues where it stopped
+}
+
+// ShutdownTransfer is a transfer that was not processed yet when stopping
+type ShutdownTransfer struct {
+	ID              int64  `json:"id"`
+	Name            string `json:"name"`
+	State           string `json:"state"`
+	Paused          bool   `json:"paused"` // pauses are not kept, the transfer downloads again on the next start
+	TotalFiles      int32  `json:"total_files"`
+	CompletedFiles  int32  `json:"completed_files"`
+	FailedFiles     int32  `json:"failed_files"`
+	DownloadedBytes int64  `json:"downloaded_bytes"`
+	TotalBytes      int64  `json:"total_bytes"`
+}
+
+// PersistedState is a document in the state directory
+type PersistedState struct {
+	Name      string    `json:"name"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// inFlightFiles returns the files that are queued or downloading and how
+// much of them is on disk
+func (m *Manager) inFlightFiles() []InFlightFile {
+	m.claimsMu.Lock()
+	paths := make(map[int64]string, len(m.claims))
+	sizes := make(map[int64]int64, len(m.claims))
+	for path, claim := range m.claims {
+		paths[claim.FileID] = path
+		sizes[claim.FileID] = claim.Size
+	}
+	m.claimsMu.Unlock()
+
+	files := []InFlightFile{}
+	for _, active := range m.ActiveFiles() {
+		file := InFlightFile{
+			TransferID: active.TransferID,
+			FileID:     active.FileID,
+			Path:       paths[active.FileID],
+			Size:       sizes[active.FileID],
+		}
+		if file.Path != "" {
+			path := longPath(m.incompletePath(file.Path))
+			if info, err := os.Stat(path); err == nil {
+				file.Downloaded = info.Size()
+				file.Resumable = isPartial(path)
+			}
+		}
+		files = append(files, file)
+	}
+	slices.SortFunc(files, func(a, b InFlightFile) int {
+		if a.TransferID != b.TransferID {
+			return cmp.Compare(a.TransferID, b.TransferID)
+		}
+		return cmp.Compare(a.FileID, b.FileID)
+	})
+	return files
+}
+
+// unprocessedTransfers returns the transfers that were not processed yet
+func (m *Manager) unprocessedTransfers() []ShutdownTransfer {
+	transfers := []ShutdownTransfer{}
+	m.coordinator.GetAllTransfers(func(ctx *TransferContext) {
+		ctx.Mu.RLock()
+		defer ctx.Mu.RUnlock()
+		if ctx.State == TransferLifecycleProcessed {
+			return
+		}
+		transfers = append(transfers, ShutdownTransfer{
+			ID:              ctx.ID,
+			Name:            ctx.Name,
+			State:           ctx.State.String(),
+			TotalFiles:      ctx.TotalFiles,
+			CompletedFiles:  ctx.CompletedFiles,
+			FailedFiles:     ctx.FailedFiles,
+			DownloadedBytes: ctx.DownloadedSize,
+			TotalBytes:      ctx.TotalSize,
+		})
+	})
+	for i := range transfers {
+		transfers[i].Paused = m.IsPaused(transfers[i].ID)
+	}
+	slices.SortFunc(transfers, func(a, b ShutdownTransfer) int { return cmp.Compare(a.ID, b.ID) })
+	return transfers
+}
+
+// persistedStates lists the documents in the state directory
+func persistedStates(dir string) []PersistedState {
+	states := []PersistedState{}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return states
+	}
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || entry.IsDir() || name == ShutdownState {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		states = append(states, PersistedState{Name: name, UpdatedAt: info.ModTime()})
+	}
+	return states
+}
+
+// writeShutdownReport writes the report of a shutdown to the state directory,
+// with the files that were in flight when the shutdown began
+func (m *Manager) writeShutdownReport(inFlight []InFlightFile, droppedJobs int) {
+	if m.cfg.StateDir == "" {
+		return
+	}
+	report := ShutdownReport{
+		StoppedAt:   time.Now(),
+		InFlight:    inFlight,
+		DroppedJobs: droppedJobs,
+		Transfers:   m.unprocessedTransfers(),
+		Completions: m.completions.pending(),
+		Persisted:   persistedStates(m.cfg.StateDir),
+	}
+
+	store, err := state.New(m.cfg.StateDir)
+	if err == nil {
+		err = store.Save(ShutdownState, report)
+	}
+	if err != nil {
+		log.Warn("shutdown").Err(err).Msg("Failed to write shutdown report")
+		return
+	}
+	log.Info("shutdown").
+		Str("report", filepath.Join(m.cfg.StateDir, ShutdownState+".json")).
+		Int("in_flight", len(report.InFlight)).
+		Int("transfers", len(report.Transfers)).
+		Int("completions", len(report.Completions)).
+		Msg("Wrote shutdown report")
+}
@@ -0,0 +1,97 @@
+package download
+
+import (
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/events"
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// slowTransfer tracks a transfer whose speed is below the slow threshold
+type slowTransfer struct {
+	since   time.Time // First sample below the threshold
+	total   float64   // Sum of the samples in bytes per second
+	samples int
+	alerted bool
+}
+
+// detectSlowTransfersPeriodically samples transfer speeds and raises an alert
+// for transfers that stay below the slow threshold
+func (m *Manager) detectSlowTransfersPeriodically() {
+	ticker := time.NewTicker(m.dlConfig.SlowSpeedCheckInterval)
+	defer ticker.Stop()
+
+	slow := make(map[int64]*slowTransfer)
+	for {
+		select {
+		case <-m.stopChan:
+			return
+		case now := <-ticker.C:
+			m.checkSlowTransfers(slow, now)
+		}
+	}
+}
+
+// checkSlowTransfers compares the current speed of each downloading transfer
+// against the threshold. Transfers that are queued or paused are not sampled,
+// so only time spent actually downloading counts.
+func (m *Manager) checkSlowTransfers(slow map[int64]*slowTransfer, now time.Time) {
+	threshold := float64(m.cfg.SlowSpeedThreshold) * 1024
+	speeds := m.transferSpeeds()
+
+	for id := range slow {
+		if _, ok := speeds[id]; !ok {
+			delete(slow, id)
+		}
+	}
+
+	for id, speed := range speeds {
+		if speed >= threshold {
+			delete(slow, id)
+			continue
+		}
+
+		s, ok := slow[id]
+		if !ok {
+			s = &slowTransfer{since: now}
+			slow[id] = s
+		}
+		s.total += speed
+		s.samples++
+		if s.alerted || now.Sub(s.since) < m.cfg.SlowSpeedDuration {
+			continue
+		}
+		s.alerted = true
+
+		ctx, ok := m.coordinator.GetTransferContext(id)
+		if !ok {
+			continue
+		}
+		ctx.Mu.RLock()
+		event := m.transferEvent(ctx, events.TransferSlow, nil)
+		ctx.Mu.RUnlock()
+		event.Speed = s.total / float64(s.samples)
+		event.Duration = now.Sub(s.since)
+
+		log.Warn("download").
+			Int64("transfer_id", id).
+			Str("name", event.Name).
+			Float64("speed_kbps", event.Speed/1024).
+			Dur("duration", event.Duration).
+			Msg("Transfer is downloading slowly")
+		m.publish(event)
+	}
+}
+
+// transferSpeeds returns the current speed of each transfer with running
+// downloads in bytes per second
+func (m *Manager) transferSpeeds() map[int64]float64 {
+	speeds := make(map[int64]float64)
+	m.fileSpeeds.Range(func(key, value interface{}) bool {
+		if transferID, ok := m.activeFiles.Load(key); ok {
+			speeds[transferID.(int64)] += value.(float64)
+		}
+		return true
+	})
+	return speeds
+}
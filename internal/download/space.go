@@ -0,0 +1,107 @@
+package download
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// spaceNeeded returns the bytes a job still has to write to disk: its size
+// minus what a partial download already holds, which downloaders preallocate
+func (m *Manager) spaceNeeded(job downloadJob) int64 {
+	if len(job.Batch) > 0 {
+		var needed int64
+		for _, file := range job.Batch {
+			needed += m.spaceNeeded(file)
+		}
+		return needed
+	}
+	needed := job.Size
+	if info, err := os.Stat(longPath(m.incompletePath(m.jobPath(job)))); err == nil {
+		needed -= info.Size()
+	}
+	return max(needed, 0)
+}
+
+// fits reports whether the files of a job fit on the disk they are written to
+// while keeping disk-reserve-mb free, and how much space is needed
+// and free. Jobs fit if the free space is unknown.
+func (m *Manager) fits(job downloadJob) (bool, int64, int64) {
+	free, ok := freeSpace(filepath.Dir(m.incompletePath(m.jobPath(job))))
+	if !ok {
+		return true, 0, 0
+	}
+	needed := m.spaceNeeded(job)
+	return needed == 0 || free-needed >= int64(m.cfg.DiskReserveMB)<<20, needed, free
+}
+
+// holdForSpace holds back a job whose files do not fit on the disk of its
+// target directory. Held jobs are queued again once they fit, see
+// waitForSpace.
+func (m *Manager) holdForSpace(job downloadJob) bool {
+	fits, needed, free := m.fits(job)
+	if fits {
+		return false
+	}
+
+	m.pauseMu.Lock()
+	m.spaceJobs = append(m.spaceJobs, job)
+	m.pauseMu.Unlock()
+	log.Warn("download").
+		Str("file_name", job.Name).
+		Int64("transfer_id", job.TransferID).
+		Str("dir", filepath.Dir(m.incompletePath(m.jobPath(job)))).
+		Int64("needed_bytes", needed).
+		Int64("free_bytes", free).
+		Int("reserve_mb", m.cfg.DiskReserveMB).
+		Msg("Not enough disk space, download waits for space")
+	return true
+}
+
+// waitForSpace queues the jobs held back for disk space again once they fit
+func (m *Manager) waitForSpace() {
+	ticker := time.NewTicker(m.dlConfig.SpaceCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stopChan:
+			return
+		case <-ticker.C:
+			m.pauseMu.Lock()
+			jobs := m.spaceJobs
+			m.spaceJobs = nil
+			m.pauseMu.Unlock()
+
+			var held []downloadJob
+			for _, job := range jobs {
+				if fits, _, _ := m.fits(job); !fits {
+					held = append(held, job)
+					continue
+				}
+				log.Info("download").
+					Str("file_name", job.Name).
+					Int64("transfer_id", job.TransferID).
+					Msg("Enough disk space, queueing download again")
+				m.requeue(job)
+			}
+			m.pauseMu.Lock()
+			m.spaceJobs = append(m.spaceJobs, held...)
+			m.pauseMu.Unlock()
+		}
+	}
+}
+
+// WaitingForSpace reports whether downloads of a transfer wait for disk space
+func (m *Manager) WaitingForSpace(transferID int64) bool {
+	m.pauseMu.Lock()
+	defer m.pauseMu.Unlock()
+	for _, job := range m.spaceJobs {
+		if job.TransferID == transferID {
+			return true
+		}
+	}
+	return false
+}
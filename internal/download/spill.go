@@ -0,0 +1,214 @@
+package download
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// spillQueue keeps download jobs that do not fit into the in-memory queue on
+// disk, so that huge queues don't have to be held in memory. Each priority
+// has a file of its own; jobs of a higher priority are read back first, and
+// jobs of the same priority in the order they were written.
+type spillQueue struct {
+	files map[int]*spillFile // by priority
+}
+
+// newSpillQueue creates a spill queue backed by files named after path, such
+// as queue-high.spill for queue.spill. Jobs left over from a previous run are
+// discarded; their transfers are listed again on startup and the files
+// requeued.
+func newSpillQueue(path string) *spillQueue {
+	// Left over by versions that spilled all jobs into one file
+	os.Remove(path)
+	ext := filepath.Ext(path)
+	q := &spillQueue{files: make(map[int]*spillFile)}
+	for priority := PriorityLow; priority <= PriorityHigh; priority++ {
+		q.files[priority] = newSpillFile(strings.TrimSuffix(path, ext) + "-" + PriorityName(priority) + ext)
+	}
+	return q
+}
+
+// Len returns the number of spilled jobs
+func (q *spillQueue) Len() int {
+	n := 0
+	for _, file := range q.files {
+		n += file.Len()
+	}
+	return n
+}
+
+// Highest returns the highest priority with spilled jobs, and false if no
+// job is spilled
+func (q *spillQueue) Highest() (int, bool) {
+	for priority := PriorityHigh; priority >= PriorityLow; priority-- {
+		if q.files[priority].Len() > 0 {
+			return priority, true
+		}
+	}
+	return 0, false
+}
+
+// Push spills a job of a transfer with the given priority
+func (q *spillQueue) Push(job downloadJob, priority int) error {
+	return q.files[ClampPriority(priority)].Push(job)
+}
+
+// Pop reads back the oldest spilled job of the highest priority
+func (q *spillQueue) Pop() (downloadJob, bool) {
+	for priority := PriorityHigh; priority >= PriorityLow; priority-- {
+		if job, ok := q.files[priority].Pop(); ok {
+			return job, true
+		}
+	}
+	return downloadJob{}, false
+}
+
+// spillFile keeps spilled jobs of one priority in a file, one JSON document
+// per line. Jobs are read back in the order they were written.
+type spillFile struct {
+	mu     sync.Mutex
+	path   string
+	writer *os.File      // appends jobs, nil while the file does not exist
+	reader *bufio.Reader // reads jobs back from the start of the file
+	file   *os.File      // file behind reader
+	count  int           // jobs written but not read back yet
+}
+
+// newSpillFile creates a spill file at path, discarding jobs left over from a
+// previous run
+func newSpillFile(path string) *spillFile {
+	os.Remove(path)
+	return &spillFile{path: path}
+}
+
+// Len returns the number of jobs in the file
+func (q *spillFile) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.count
+}
+
+// Push appends a job to the file
+func (q *spillFile) Push(job downloadJob) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to encode job: %w", err)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.writer == nil {
+		writer, err := os.OpenFile(q.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND|os.O_TRUNC, 0640)
+		if err != nil {
+			return fmt.Errorf("failed to create spill file: %w", err)
+		}
+		file, err := os.Open(q.path)
+		if err != nil {
+			writer.Close()
+			return fmt.Errorf("failed to open spill file: %w", err)
+		}
+		q.writer, q.file, q.reader = writer, file, bufio.NewReader(file)
+	}
+
+	if _, err := q.writer.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write spill file: %w", err)
+	}
+	q.count++
+	return nil
+}
+
+// Pop reads back the oldest spilled job. The file is removed once all jobs
+// were read back.
+func (q *spillFile) Pop() (downloadJob, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var job downloadJob
+	for q.count > 0 {
+		line, err := q.reader.ReadBytes('\n')
+		if err != nil {
+			log.Error("download").Str("file", q.path).Err(err).Msg("Failed to read spilled jobs, dropping them")
+			q.count = 0
+			break
+		}
+		q.count--
+		if err := json.Unmarshal(line, &job); err != nil {
+			log.Error("download").Str("file", q.path).Err(err).Msg("Failed to decode spilled job")
+			continue
+		}
+		if q.count == 0 {
+			q.closeLocked()
+		}
+		return job, true
+	}
+	q.closeLocked()
+	return job, false
+}
+
+// closeLocked closes and removes the spill file. q.mu must be held.
+func (q *spillFile) closeLocked() {
+	if q.writer == nil {
+		return
+	}
+	q.writer.Close()
+	q.file.Close()
+	os.Remove(q.path)
+	q.writer, q.file, q.reader = nil, nil, nil
+}
+
+// sendJob puts a job on the queue, or spills it if the queue is full. It
+// returns false if the manager stopped before the job was queued. m.mu must
+// be held, so that no other sender fills the queue in between.
+func (m *Manager) sendJob(job downloadJob) bool {
+	priority := m.Priority(job.TransferID)
+	if m.spill != nil {
+		// Jobs line up behind spilled jobs of the same or a higher priority to
+		// keep the order, while jobs outranking all spilled ones pass them
+		spilled, ok := m.spill.Highest()
+		if (ok && spilled >= priority) || m.jobs.Len() >= m.jobs.Cap() {
+			err := m.spill.Push(job, priority)
+			if err == nil {
+				return true
+			}
+			log.Warn("download").Err(err).Msg("Failed to spill job, waiting for room in the queue")
+		}
+	}
+
+	return m.jobs.push(job, priority, m.stopChan)
+}
+
+// feedSpilledJobs moves spilled jobs back to the queue as room frees up, those
+// of the highest priority first. Jobs are queued with the priority their
+// transfer has by then, so changing it still reorders them once queued.
+func (m *Manager) feedSpilledJobs() {
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stopChan:
+			return
+		case <-ticker.C:
+		}
+
+		m.mu.Lock()
+		for m.running && m.jobs.Len() < m.jobs.Cap() {
+			job, ok := m.spill.Pop()
+			if !ok {
+				break
+			}
+			// All senders hold m.mu, so there is room for the job
+			m.jobs.push(job, m.Priority(job.TransferID), m.stopChan)
+		}
+		m.mu.Unlock()
+	}
+}
@@ -0,0 +1,157 @@
+package download
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// popAll reads back all spilled jobs and returns their file IDs
+func popAll(q *spillQueue) []int64 {
+	var ids []int64
+	for {
+		job, ok := q.Pop()
+		if !ok {
+			return ids
+		}
+		ids = append(ids, job.FileID)
+	}
+}
+
+func TestSpillQueue(t *testing.T) {
+	dir := t.TempDir()
+	q := newSpillQueue(filepath.Join(dir, "queue.spill"))
+	if _, ok := q.Highest(); ok {
+		t.Error("empty spill queue has a highest priority")
+	}
+
+	for _, job := range []struct {
+		id       int64
+		priority int
+	}{
+		{1, PriorityNormal},
+		{2, PriorityLow},
+		{3, PriorityHigh},
+		{4, PriorityNormal},
+		{5, PriorityHigh + 5}, // counts as high
+		{6, PriorityLow},
+	} {
+		if err := q.Push(downloadJob{FileID: job.id, Name: "file", TransferID: 1, Size: 10}, job.priority); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if q.Len() != 6 {
+		t.Errorf("Len() = %d, want 6", q.Len())
+	}
+	if priority, ok := q.Highest(); !ok || priority != PriorityHigh {
+		t.Errorf("Highest() = %d, %v, want %d", priority, ok, PriorityHigh)
+	}
+	if !exists(filepath.Join(dir, "queue-high.spill")) || exists(filepath.Join(dir, "queue.spill")) {
+		t.Error("jobs were not spilled into a file per priority")
+	}
+
+	// Jobs are read back in order, and can be spilled in between
+	job, ok := q.Pop()
+	if !ok || !reflect.DeepEqual(job, downloadJob{FileID: 3, Name: "file", TransferID: 1, Size: 10}) {
+		t.Errorf("Pop() = %+v, %v, want job 3", job, ok)
+	}
+	if err := q.Push(downloadJob{FileID: 7}, PriorityHigh); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := popAll(q), []int64{5, 7, 1, 4, 2, 6}; !reflect.DeepEqual(got, want) {
+		t.Errorf("popped %v, want %v", got, want)
+	}
+	if q.Len() != 0 {
+		t.Errorf("Len() = %d after popping all jobs, want 0", q.Len())
+	}
+
+	// Files are removed once read back, and created again when needed
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("spill files %v were left behind", entries)
+	}
+	if err := q.Push(downloadJob{FileID: 8}, PriorityNormal); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := popAll(q), []int64{8}; !reflect.DeepEqual(got, want) {
+		t.Errorf("popped %v, want %v", got, want)
+	}
+}
+
+func TestSpillQueueDiscardsLeftovers(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "queue.spill", "queue-low.spill", "queue-normal.spill", "queue-high.spill")
+
+	q := newSpillQueue(filepath.Join(dir, "queue.spill"))
+	if q.Len() != 0 {
+		t.Errorf("Len() = %d, want 0", q.Len())
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("spill files %v of an earlier run were kept", entries)
+	}
+}
+
+func TestSpillFileSkipsCorruptJobs(t *testing.T) {
+	q := newSpillFile(filepath.Join(t.TempDir(), "queue.spill"))
+	if err := q.Push(downloadJob{FileID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	q.writer.WriteString("not a job\n")
+	q.count++
+	if err := q.Push(downloadJob{FileID: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []int64
+	for {
+		job, ok := q.Pop()
+		if !ok {
+			break
+		}
+		ids = append(ids, job.FileID)
+	}
+	if want := []int64{1, 2}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("popped %v, want %v", ids, want)
+	}
+	if exists(q.path) {
+		t.Error("spill file was left behind")
+	}
+}
+
+func TestSendJob(t *testing.T) {
+	m := &Manager{
+		notes:    newAnnotations(""),
+		jobs:     newJobQueue(1),
+		spill:    newSpillQueue(filepath.Join(t.TempDir(), "queue.spill")),
+		stopChan: make(chan struct{}),
+	}
+	m.notes.transfers[2] = Annotation{Priority: PriorityHigh, UpdatedAt: time.Now()}
+	m.notes.transfers[3] = Annotation{Priority: PriorityLow, UpdatedAt: time.Now()}
+	send := func(fileID, transferID int64) {
+		t.Helper()
+		if !m.sendJob(downloadJob{FileID: fileID, TransferID: transferID}) {
+			t.Fatalf("job %d was not queued", fileID)
+		}
+	}
+	pop := func(want int64) {
+		t.Helper()
+		if job, ok := m.jobs.pop(m.stopChan); !ok || job.FileID != want {
+			t.Fatalf("queued job = %d, %v, want %d", job.FileID, ok, want)
+		}
+	}
+
+	send(1, 1) // queued
+	send(2, 1) // spilled, the queue is full
+	pop(1)
+	send(3, 2) // queued, it outranks the spilled job
+	pop(3)
+	send(4, 1) // spilled behind job 2 although there is room
+	send(5, 3) // spilled
+	if m.jobs.Len() != 0 {
+		t.Errorf("%d jobs queued, want none", m.jobs.Len())
+	}
+	if got, want := popAll(m.spill), []int64{2, 4, 5}; !reflect.DeepEqual(got, want) {
+		t.Errorf("spilled %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,95 @@
+package download
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of the download manager's activity
+type Stats struct {
+	Workers          int       `json:"workers"`
+	ActiveDownloads  int       `json:"active_downloads"`
+	ActiveFiles      int       `json:"active_files"`
+	QueuedJobs       int       `json:"queued_jobs"`
+	Transfers        int       `json:"transfers"`
+	Downloading      int       `json:"downloading"`
+	Failed           int       `json:"failed"`
+	Quarantined      int       `json:"quarantined"`
+	Processed        int       `json:"processed"`
+	DownloadedBytes  int64     `json:"downloaded_bytes"`
+	SpeedLimitKBps   int       `json:"speed_limit_kbps"`
+	UnthrottledUntil time.Time `json:"unthrottled_until,omitempty"`
+	Maintenance      bool      `json:"maintenance"`
+	WaitingForSpace  int       `json:"waiting_for_space"`     // downloads held back until they fit on the disk
+	LoadLimit        int       `json:"load_limit,omitempty"`  // downloads that may run at once while the system is busy
+	LoadReason       string    `json:"load_reason,omitempty"` // why the system counts as busy
+}
+
+// ActiveFile is a file currently being downloaded
+type ActiveFile struct {
+	FileID     int64 `json:"file_id"`
+	TransferID int64 `json:"transfer_id"`
+}
+
+// Stats returns a snapshot of the manager's activity
+func (m *Manager) Stats() Stats {
+	stats := Stats{
+		Workers:          m.workerCount(),
+		ActiveDownloads:  int(atomic.LoadInt32(&m.activeDownloads)),
+		QueuedJobs:       m.jobs.Len() + m.spilledJobs(),
+		SpeedLimitKBps:   m.speedLimit(),
+		UnthrottledUntil: m.UnthrottledUntil(),
+		Maintenance:      m.InMaintenance(),
+	}
+
+	stats.LoadLimit, stats.LoadReason = m.LoadThrottle()
+
+	m.pauseMu.Lock()
+	stats.WaitingForSpace = len(m.spaceJobs)
+	m.pauseMu.Unlock()
+
+	m.activeFiles.Range(func(_, _ interface{}) bool {
+		stats.ActiveFiles++
+		return true
+	})
+
+	m.coordinator.GetAllTransfers(func(ctx *TransferContext) {
+		ctx.Mu.RLock()
+		defer ctx.Mu.RUnlock()
+
+		stats.Transfers++
+		stats.DownloadedBytes += ctx.DownloadedSize
+		switch ctx.State {
+		case TransferLifecycleDownloading, TransferLifecycleCompleted:
+			stats.Downloading++
+		case TransferLifecycleFailed:
+			stats.Failed++
+		case TransferLifecycleQuarantined:
+			stats.Quarantined++
+		case TransferLifecycleProcessed:
+			stats.Processed++
+		}
+	})
+	return stats
+}
+
+// spilledJobs returns the number of jobs waiting in the spill file
+func (m *Manager) spilledJobs() int {
+	if m.spill == nil {
+		return 0
+	}
+	return m.spill.Len()
+}
+
+// ActiveFiles returns the files that are queued or being downloaded
+func (m *Manager) ActiveFiles() []ActiveFile {
+	var files []ActiveFile
+	m.activeFiles.Range(func(key, value interface{}) bool {
+		files = append(files, ActiveFile{
+			FileID:     key.(int64),
+			TransferID: value.(int64),
+		})
+		return true
+	})
+	return files
+}
@@ -0,0 +1,99 @@
+//go:build linux
+
+package download
+
+import (
+	"bufio"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// loadAverage returns the load average of the last minute per CPU from
+// /proc/loadavg, or false if it is unknown
+func loadAverage() (float64, bool) {
+	data, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0, false
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, false
+	}
+	load, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, false
+	}
+	return load / float64(runtime.NumCPU()), true
+}
+
+// memoryUsed returns the percentage of memory in use from /proc/meminfo,
+// counting memory the kernel can reclaim, such as the page cache, as
+// available, or false if it is unknown
+func memoryUsed() (int, bool) {
+	file, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, false
+	}
+	defer file.Close()
+
+	var total, available int64 = -1, -1
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		value, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			total = value
+		case "MemAvailable:":
+			available = value
+		}
+	}
+	if total <= 0 || available < 0 {
+		return 0, false
+	}
+	return int(100 - available*100/total), true
+}
+
+// diskCounters returns how many I/O requests the disk a path is on completed
+// and how many milliseconds they took in total from /proc/diskstats, or false
+// if the disk is unknown, e.g. for network filesystems
+func diskCounters(path string) (ios, ms uint64, ok bool) {
+	var stat unix.Stat_t
+	if err := unix.Stat(path, &stat); err != nil {
+		return 0, 0, false
+	}
+	major, minor := strconv.FormatUint(uint64(unix.Major(stat.Dev)), 10), strconv.FormatUint(uint64(unix.Minor(stat.Dev)), 10)
+
+	file, err := os.Open("/proc/diskstats")
+	if err != nil {
+		return 0, 0, false
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// major minor name reads merged sectors ms writes merged sectors ms ...
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 11 || fields[0] != major || fields[1] != minor {
+			continue
+		}
+		var counters [4]uint64
+		for i, field := range []int{3, 6, 7, 10} {
+			if counters[i], err = strconv.ParseUint(fields[field], 10, 64); err != nil {
+				return 0, 0, false
+			}
+		}
+		return counters[0] + counters[2], counters[1] + counters[3], true
+	}
+	return 0, 0, false
+}
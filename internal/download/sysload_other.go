@@ -0,0 +1,18 @@
+//go:build !linux
+
+package download
+
+// loadAverage is not known on this platform
+func loadAverage() (float64, bool) {
+	return 0, false
+}
+
+// memoryUsed is not known on this platform
+func memoryUsed() (int, bool) {
+	return 0, false
+}
+
+// diskCounters are not known on this platform
+func diskCounters(path string) (ios, ms uint64, ok bool) {
+	return 0, 0, false
+}
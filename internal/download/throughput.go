@@ -0,0 +1,254 @@
+package download
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/log"
+	"github.com/elsbrock/plundrio/internal/state"
+)
+
+// ThroughputState is the name of the state document holding the download
+// speed history
+const ThroughputState = "throughput"
+
+// Resolutions the download speed history is kept at
+const (
+	ResolutionSecond = "second"
+	ResolutionMinute = "minute"
+	ResolutionHour   = "hour"
+)
+
+// throughputResolutions are the resolutions the download speed is kept at
+// and for how many steps, finest first
+var throughputResolutions = []struct {
+	name   string
+	step   time.Duration
+	length int
+}{
+	{ResolutionSecond, time.Second, 15 * 60}, // 15 minutes
+	{ResolutionMinute, time.Minute, 48 * 60}, // 2 days
+	{ResolutionHour, time.Hour, 90 * 24},     // 90 days
+}
+
+// ThroughputPoint is the average download speed of all transfers over a step
+type ThroughputPoint struct {
+	Time  time.Time `json:"time"`  // start of the step
+	Speed float64   `json:"speed"` // bytes per second
+	Bytes int64     `json:"bytes"` // downloaded during the step
+}
+
+// Throughput is the download speed history as kept in the state directory
+type Throughput struct {
+	Rings map[string]EncodedRing `json:"rings"` // by resolution
+}
+
+// EncodedRing is a speed ring in compact form. Speeds are whole bytes per
+// second, written as varints, so idle steps take a single byte.
+type EncodedRing struct {
+	Start  time.Time `json:"start"`  // start of the step after the last value
+	Values string    `json:"values"` // base64 of the speeds, oldest first
+}
+
+// speedRing keeps the average download speed of the last length steps
+type speedRing struct {
+	name    string
+	step    time.Duration
+	length  int
+	start   time.Time // start of the step being filled, zero before the first sample
+	sum     float64   // of the samples of the step being filled
+	samples int
+	values  []float64 // averages of the completed steps, oldest first
+}
+
+// add records a speed sample. Steps without samples, e.g. while plundrio
+// was not running, count as downloading nothing.
+func (r *speedRing) add(now time.Time, speed float64) {
+	step := now.Truncate(r.step)
+	if r.start.IsZero() {
+		r.start = step
+	}
+	if step.After(r.start) {
+		var average float64
+		if r.samples > 0 {
+			average = r.sum / float64(r.samples)
+		}
+		r.values = append(r.values, average)
+		gap := min(int(step.Sub(r.start)/r.step)-1, r.length)
+		for i := 0; i < gap; i++ {
+			r.values = append(r.values, 0)
+		}
+		if len(r.values) > r.length {
+			r.values = append(r.values[:0], r.values[len(r.values)-r.length:]...)
+		}
+		r.start, r.sum, r.samples = step, 0, 0
+	}
+	r.sum += speed
+	r.samples++
+}
+
+// points returns the completed steps that started at or after since
+func (r *speedRing) points(since time.Time) []ThroughputPoint {
+	points := make([]ThroughputPoint, 0, len(r.values))
+	for i, speed := range r.values {
+		at := r.start.Add(-time.Duration(len(r.values)-i) * r.step)
+		if at.Before(since) {
+			continue
+		}
+		points = append(points, ThroughputPoint{
+			Time:  at,
+			Speed: speed,
+			Bytes: int64(speed * r.step.Seconds()),
+		})
+	}
+	return points
+}
+
+// encode returns the ring in compact form
+func (r *speedRing) encode() EncodedRing {
+	buf := make([]byte, 0, len(r.values))
+	for _, speed := range r.values {
+		buf = binary.AppendUvarint(buf, uint64(math.Round(max(speed, 0))))
+	}
+	return EncodedRing{Start: r.start, Values: base64.StdEncoding.EncodeToString(buf)}
+}
+
+// decode restores the ring from compact form
+func (r *speedRing) decode(encoded EncodedRing) error {
+	buf, err := base64.StdEncoding.DecodeString(encoded.Values)
+	if err != nil {
+		return err
+	}
+	var values []float64
+	for len(buf) > 0 {
+		speed, n := binary.Uvarint(buf)
+		if n <= 0 {
+			return fmt.Errorf("corrupt %s speeds", r.name)
+		}
+		values = append(values, float64(speed))
+		buf = buf[n:]
+	}
+	if len(values) > r.length {
+		values = values[len(values)-r.length:]
+	}
+	r.start, r.values = encoded.Start, values
+	return nil
+}
+
+// throughput records the download speed of all transfers at several
+// resolutions and keeps it in the state directory, so the history survives
+// restarts
+type throughput struct {
+	mu    sync.Mutex
+	store *state.Store // nil without a state directory
+	rings []*speedRing
+}
+
+// newThroughput creates the speed history, loading what previous runs
+// recorded from the state directory
+func newThroughput(stateDir string) *throughput {
+	t := &throughput{}
+	for _, res := range throughputResolutions {
+		t.rings = append(t.rings, &speedRing{name: res.name, step: res.step, length: res.length})
+	}
+	if stateDir == "" {
+		return t
+	}
+
+	store, err := state.New(stateDir)
+	if err != nil {
+		log.Warn("throughput").Err(err).Msg("Speed history will not be kept")
+		return t
+	}
+	t.store = store
+
+	var saved Throughput
+	if err := store.Load(ThroughputState, &saved); err != nil {
+		log.Warn("throughput").Err(err).Msg("Failed to load speed history")
+		return t
+	}
+	for _, ring := range t.rings {
+		encoded, ok := saved.Rings[ring.name]
+		if !ok {
+			continue
+		}
+		if err := ring.decode(encoded); err != nil {
+			log.Warn("throughput").Str("resolution", ring.name).Err(err).Msg("Failed to load speed history")
+		}
+	}
+	return t
+}
+
+// add records the speed of all transfers
+func (t *throughput) add(now time.Time, speed float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, ring := range t.rings {
+		ring.add(now, speed)
+	}
+}
+
+// points returns the history at a resolution since a point in time
+func (t *throughput) points(resolution string, since time.Time) ([]ThroughputPoint, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, ring := range t.rings {
+		if ring.name == resolution {
+			return ring.points(since), nil
+		}
+	}
+	return nil, fmt.Errorf("unknown resolution %q (use second, minute or hour)", resolution)
+}
+
+// save writes the history to the state directory
+func (t *throughput) save() {
+	if t.store == nil {
+		return
+	}
+	t.mu.Lock()
+	saved := Throughput{Rings: make(map[string]EncodedRing, len(t.rings))}
+	for _, ring := range t.rings {
+		saved.Rings[ring.name] = ring.encode()
+	}
+	t.mu.Unlock()
+
+	if err := t.store.Save(ThroughputState, saved); err != nil {
+		log.Warn("throughput").Err(err).Msg("Failed to save speed history")
+	}
+}
+
+// Throughput returns the download speed history at a resolution (second,
+// minute or hour), oldest first, from since on
+func (m *Manager) Throughput(resolution string, since time.Time) ([]ThroughputPoint, error) {
+	return m.throughput.points(resolution, since)
+}
+
+// recordThroughputPeriodically samples the speed of all transfers every
+// second and saves the history now and then
+func (m *Manager) recordThroughputPeriodically() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	lastSave := time.Now()
+
+	for {
+		select {
+		case <-m.stopChan:
+			m.throughput.save()
+			return
+		case now := <-ticker.C:
+			var total float64
+			for _, speed := range m.transferSpeeds() {
+				total += speed
+			}
+			m.throughput.add(now, total)
+			if now.Sub(lastSave) >= m.dlConfig.ThroughputSaveInterval {
+				m.throughput.save()
+				lastSave = now
+			}
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package download
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSpeedRing(t *testing.T) {
+	t0 := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	r := &speedRing{name: ResolutionSecond, step: time.Second, length: 3}
+	r.add(t0, 10)
+	r.add(t0.Add(500*time.Millisecond), 20)
+	if points := r.points(time.Time{}); len(points) != 0 {
+		t.Errorf("points = %v before a step completed, want none", points)
+	}
+
+	// Steps are averaged, missed steps count as idle and the oldest are dropped
+	r.add(t0.Add(time.Second), 30)
+	r.add(t0.Add(4*time.Second), 40)
+	want := []ThroughputPoint{
+		{Time: t0.Add(time.Second), Speed: 30, Bytes: 30},
+		{Time: t0.Add(2 * time.Second), Speed: 0},
+		{Time: t0.Add(3 * time.Second), Speed: 0},
+	}
+	if got := r.points(time.Time{}); !reflect.DeepEqual(got, want) {
+		t.Errorf("points = %v, want %v", got, want)
+	}
+	if got := r.points(t0.Add(2 * time.Second)); !reflect.DeepEqual(got, want[1:]) {
+		t.Errorf("points since the second step = %v, want %v", got, want[1:])
+	}
+
+	// A long pause leaves only idle steps
+	r.add(t0.Add(time.Hour), 50)
+	if got := r.points(time.Time{}); len(got) != 3 || got[0].Speed != 0 || got[2].Time != t0.Add(time.Hour-time.Second) {
+		t.Errorf("points after a pause = %v, want three idle steps before it", got)
+	}
+}
+
+func TestSpeedRingEncoding(t *testing.T) {
+	t0 := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	r := &speedRing{name: ResolutionMinute, step: time.Minute, length: 4, start: t0, values: []float64{0, 1.4, 1.6, 300000}}
+	encoded := r.encode()
+
+	decoded := &speedRing{name: ResolutionMinute, step: time.Minute, length: 4}
+	if err := decoded.decode(encoded); err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.start.Equal(t0) || !reflect.DeepEqual(decoded.values, []float64{0, 1, 2, 300000}) {
+		t.Errorf("decoded ring = %v from %s, want whole speeds from %s", decoded.values, decoded.start, t0)
+	}
+
+	// Rings saved with more steps keep the newest
+	shorter := &speedRing{name: ResolutionMinute, step: time.Minute, length: 2}
+	if err := shorter.decode(encoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(shorter.values, []float64{2, 300000}) {
+		t.Errorf("decoded ring = %v, want the newest two speeds", shorter.values)
+	}
+
+	for _, values := range []string{"not base64!", "gA=="} {
+		if err := decoded.decode(EncodedRing{Values: values}); err == nil {
+			t.Errorf("decoding %q succeeded", values)
+		}
+	}
+}
+
+func TestThroughput(t *testing.T) {
+	stateDir := t.TempDir()
+	tp := newThroughput(stateDir)
+	t0 := time.Now().Truncate(time.Hour).Add(-time.Hour)
+	tp.add(t0, 1000)
+	tp.add(t0.Add(time.Hour), 0)
+	tp.save()
+
+	// The history survives a restart at every resolution
+	m := &Manager{throughput: newThroughput(stateDir)}
+	for _, tt := range []struct {
+		resolution string
+		points     int
+	}{
+		{ResolutionSecond, 15 * 60},
+		{ResolutionMinute, 60},
+		{ResolutionHour, 1},
+	} {
+		points, err := m.Throughput(tt.resolution, time.Time{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(points) != tt.points {
+			t.Errorf("%s points = %d, want %d", tt.resolution, len(points), tt.points)
+		}
+	}
+	if points, _ := m.Throughput(ResolutionHour, time.Time{}); len(points) != 1 || points[0].Speed != 1000 || !points[0].Time.Equal(t0) {
+		t.Errorf("hourly points = %v, want 1000 B/s at %s", points, t0)
+	}
+	if _, err := m.Throughput("day", time.Time{}); err == nil {
+		t.Error("unknown resolution was accepted")
+	}
+}
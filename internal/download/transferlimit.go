@@ -0,0 +1,190 @@
+package download
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// transferLimit enforces the speed limit of a transfer on all of its files
+// downloading at once
+type transferLimit struct {
+	limiter *rateLimiter        // shared by the native downloads of the transfer
+	gids    map[string]struct{} // aria2c downloads of the transfer, which split the limit
+	users   int                 // downloads of the transfer using the limit
+}
+
+// transferLimits are the limits of transfers with running downloads
+type transferLimits struct {
+	mu        sync.Mutex
+	transfers map[int64]*transferLimit
+}
+
+// TransferSpeedLimit returns the speed limit of a transfer in KB/s: the one
+// set for the transfer, or else the one of its category (0 means unlimited)
+func (m *Manager) TransferSpeedLimit(transferID int64) int {
+	if note, ok := m.Annotation(transferID); ok && note.SpeedLimit > 0 {
+		return note.SpeedLimit
+	}
+	return m.cfg.CategorySpeedLimits[m.Category(transferID)]
+}
+
+// transferSpeedLimit returns the speed limit of a transfer in KB/s currently
+// in effect, which unthrottling lifts like the others
+func (m *Manager) transferSpeedLimit(transferID int64) int {
+	if !m.UnthrottledUntil().IsZero() {
+		return 0
+	}
+	return m.TransferSpeedLimit(transferID)
+}
+
+// SetTransferSpeedLimit changes the speed limit of a transfer in KB/s, 0
+// falls back to the limit of its category. Running downloads of the
+// transfer are slowed down or sped up right away.
+func (m *Manager) SetTransferSpeedLimit(transferID int64, limit int) {
+	limit = max(limit, 0)
+	m.notes.mu.Lock()
+	note := m.notes.transfers[transferID]
+	if note.SpeedLimit == limit {
+		m.notes.mu.Unlock()
+		return
+	}
+	note.SpeedLimit = limit
+	if note.Empty() {
+		delete(m.notes.transfers, transferID)
+	} else {
+		note.UpdatedAt = time.Now()
+		m.notes.transfers[transferID] = note
+	}
+	m.notes.save()
+	m.notes.mu.Unlock()
+
+	log.Info("download").
+		Int64("transfer_id", transferID).
+		Int("speed_limit_kbps", limit).
+		Msg("Changed transfer speed limit")
+	m.applyTransferLimit(transferID)
+}
+
+// joinTransferLimit registers a download of a transfer and returns the
+// limiter it shares with the other downloads of the transfer. release must
+// be called once the download finished.
+func (m *Manager) joinTransferLimit(transferID int64) (limiter *rateLimiter, release func()) {
+	rate := float64(m.transferSpeedLimit(transferID)) * 1024
+
+	m.limits.mu.Lock()
+	defer m.limits.mu.Unlock()
+	limit, ok := m.limits.transfers[transferID]
+	if !ok {
+		limit = &transferLimit{limiter: &rateLimiter{rate: rate}, gids: make(map[string]struct{})}
+		m.limits.transfers[transferID] = limit
+	}
+	limit.users++
+
+	return limit.limiter, func() {
+		m.limits.mu.Lock()
+		defer m.limits.mu.Unlock()
+		limit.users--
+		if limit.users == 0 {
+			delete(m.limits.transfers, transferID)
+		}
+	}
+}
+
+// addAria2Download makes an aria2c download of a transfer share the speed
+// limit of the transfer until it is removed again with removeAria2Download
+func (m *Manager) addAria2Download(d *aria2Daemon, transferID int64, gid string) {
+	m.limits.mu.Lock()
+	if limit, ok := m.limits.transfers[transferID]; ok {
+		limit.gids[gid] = struct{}{}
+	}
+	m.limits.mu.Unlock()
+	m.splitAria2Limit(d, transferID)
+}
+
+// removeAria2Download gives the share of a finished aria2c download to the
+// other downloads of the transfer
+func (m *Manager) removeAria2Download(d *aria2Daemon, transferID int64, gid string) {
+	m.limits.mu.Lock()
+	if limit, ok := m.limits.transfers[transferID]; ok {
+		delete(limit.gids, gid)
+	}
+	m.limits.mu.Unlock()
+	m.splitAria2Limit(d, transferID)
+}
+
+// splitAria2Limit splits the speed limit of a transfer evenly between its
+// aria2c downloads, which aria2c cannot limit together
+func (m *Manager) splitAria2Limit(d *aria2Daemon, transferID int64) {
+	m.limits.mu.Lock()
+	limit, ok := m.limits.transfers[transferID]
+	var gids []string
+	if ok {
+		for gid := range limit.gids {
+			gids = append(gids, gid)
+		}
+	}
+	m.limits.mu.Unlock()
+	if len(gids) == 0 {
+		return
+	}
+
+	share := m.transferSpeedLimit(transferID) / len(gids)
+	if m.transferSpeedLimit(transferID) > 0 {
+		share = max(share, 1)
+	}
+	downloadLimit := aria2Limit(lowerLimit(m.speedLimit(), share))
+	ctx, cancel := context.WithTimeout(context.Background(), aria2RequestTimeout)
+	defer cancel()
+	for _, gid := range gids {
+		if err := d.changeOption(ctx, gid, map[string]string{"max-download-limit": downloadLimit}); err != nil {
+			log.Debug("download").Int64("transfer_id", transferID).Str("gid", gid).Err(err).Msg("Failed to change aria2c speed limit")
+		}
+	}
+}
+
+// applyTransferLimit hands a changed speed limit of a transfer to its
+// running downloads
+func (m *Manager) applyTransferLimit(transferID int64) {
+	m.limits.mu.Lock()
+	limit, ok := m.limits.transfers[transferID]
+	m.limits.mu.Unlock()
+	if !ok {
+		return
+	}
+	limit.limiter.setRate(float64(m.transferSpeedLimit(transferID)) * 1024)
+
+	m.aria2Mu.Lock()
+	d := m.aria2d
+	m.aria2Mu.Unlock()
+	if d != nil && d.running() {
+		m.splitAria2Limit(d, transferID)
+	}
+}
+
+// applyTransferLimits hands the speed limits of all transfers with running
+// downloads to them, e.g. after unthrottling started or ended
+func (m *Manager) applyTransferLimits() {
+	m.limits.mu.Lock()
+	ids := make([]int64, 0, len(m.limits.transfers))
+	for id := range m.limits.transfers {
+		ids = append(ids, id)
+	}
+	m.limits.mu.Unlock()
+	for _, id := range ids {
+		m.applyTransferLimit(id)
+	}
+}
+
+// lowerLimit returns the stricter of two speed limits, where 0 is unlimited
+func lowerLimit(a, b int) int {
+	if a <= 0 {
+		return b
+	}
+	if b <= 0 {
+		return a
+	}
+	return min(a, b)
+}
@@ -1,13 +1,17 @@
 package download
 
 import (
+	"context"
+	"fmt"
 	"os"
 	"path/filepath"
 	"sync"
 	"time"
 
 	"github.com/elsbrock/go-putio"
+	"github.com/elsbrock/plundrio/internal/events"
 	"github.com/elsbrock/plundrio/internal/log"
+	"github.com/elsbrock/plundrio/internal/provider"
 )
 
 // TransferProcessor handles the processing of Put.io transfers
@@ -16,6 +20,7 @@ type TransferProcessor struct {
 	transfers          map[string][]*putio.Transfer // Status -> Transfers
 	processedTransfers sync.Map                     // map[int64]bool - Tracks transfers that have been processed locally
 	retryAttempts      sync.Map                     // map[int64]int - Tracks retry attempts for errored transfers
+	ignored            sync.Map                     // map[int64]bool - Foreign transfers left alone, logged once
 	folderID           int64
 	targetDir          string
 }
@@ -80,6 +85,10 @@ func (m *Manager) monitorTransfers() {
 		Str("target_dir", processor.targetDir).
 		Msg("Transfer processor initialized")
 
+	// Transfers that were downloading when plundrio stopped continue right
+	// away, the initial check leaves them alone
+	processor.resumeSavedTransfers()
+
 	// Initial check
 	processor.checkTransfers()
 
@@ -93,15 +102,46 @@ func (m *Manager) monitorTransfers() {
 			return
 		case <-ticker.C:
 			processor.checkTransfers()
+		case done := <-m.scans:
+			log.Info("transfers").Msg("Scanning put.io folder on request")
+			processor.checkTransfers()
+			ticker.Reset(m.dlConfig.TransferCheckInterval)
+			close(done)
 		}
 	}
 }
 
+// Scan checks the put.io folder for new and finished transfers right away
+// instead of waiting for the next poll, and returns once it was checked
+func (m *Manager) Scan(ctx context.Context) error {
+	if m.InMaintenance() {
+		return fmt.Errorf("transfers are not checked during a maintenance window")
+	}
+	done := make(chan struct{})
+	select {
+	case m.scans <- done:
+	case <-m.stopChan:
+		return fmt.Errorf("download manager is stopping")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // checkTransfers looks for completed or seeding transfers and processes them
 func (p *TransferProcessor) checkTransfers() {
+	if p.manager.InMaintenance() {
+		log.Debug("transfers").Msg("Skipping transfer check during maintenance window")
+		return
+	}
 	log.Debug("transfers").Msg("Checking transfers")
 
-	transfers, err := p.manager.client.GetTransfers()
+	transfers, err := p.manager.provider.ListTransfers(p.manager.ctx)
 	if err != nil {
 		log.Error("transfers").Err(err).Msg("Failed to get transfers")
 		return
@@ -115,7 +155,9 @@ func (p *TransferProcessor) checkTransfers() {
 	p.transfers = make(map[string][]*putio.Transfer)
 
 	// Categorize transfers by status
+	listed := make(map[int64]bool, len(transfers))
 	for _, t := range transfers {
+		listed[t.ID] = true
 		if t.SaveParentID != p.folderID {
 			log.Debug("transfers").
 				Int64("transfer_id", t.ID).
@@ -127,12 +169,24 @@ func (p *TransferProcessor) checkTransfers() {
 		p.transfers[t.Status] = append(p.transfers[t.Status], t)
 	}
 
+	p.manager.sampleCloudSpeeds(transfers)
+	p.manager.notes.claim(transfers)
+
+	// Foreign transfers that are gone need not be remembered
+	p.ignored.Range(func(key, value interface{}) bool {
+		if !listed[key.(int64)] {
+			p.ignored.Delete(key)
+		}
+		return true
+	})
+
 	// Log transfer summary
 	p.logTransferSummary()
 
 	// Process transfers by status
 	p.processReadyTransfers()
 	p.processErroredTransfers()
+	p.manager.retryFailedTransfers()
 
 	// Check for transfers that are in "Completed" state but haven't been fully cleaned up
 	p.finalizeCompletedTransfers()
@@ -278,6 +332,7 @@ func (p *TransferProcessor) logAllTransfersDetails() {
 // processReadyTransfers handles completed and seeding transfers
 func (p *TransferProcessor) processReadyTransfers() {
 	readyTransfers := append(p.transfers["COMPLETED"], p.transfers["SEEDING"]...)
+	p.manager.sortByPriority(readyTransfers)
 
 	for _, transfer := range readyTransfers {
 		select {
@@ -285,7 +340,7 @@ func (p *TransferProcessor) processReadyTransfers() {
 			log.Debug("transfers").Msg("Stopping transfer processing")
 			return
 		default:
-			if p.isTransferBeingProcessed(transfer.ID) {
+			if p.isTransferBeingProcessed(transfer.ID) || !p.accept(transfer) {
 				continue
 			}
 			p.startTransferProcessing(transfer)
@@ -293,6 +348,22 @@ func (p *TransferProcessor) processReadyTransfers() {
 	}
 }
 
+// accept reports whether a transfer is handled by plundrio, logging foreign
+// transfers that are left alone once
+func (p *TransferProcessor) accept(transfer *putio.Transfer) bool {
+	if p.manager.acceptTransfer(transfer) {
+		return true
+	}
+	if _, logged := p.ignored.LoadOrStore(transfer.ID, true); !logged {
+		log.Info("transfers").
+			Str("name", transfer.Name).
+			Int64("id", transfer.ID).
+			Str("mode", p.manager.cfg.ForeignTransfers).
+			Msg("Leaving alone transfer not added through plundrio")
+	}
+	return false
+}
+
 // isTransferBeingProcessed checks if a transfer is already being handled
 func (p *TransferProcessor) isTransferBeingProcessed(transferID int64) bool {
 	if _, exists := p.manager.coordinator.GetTransferContext(transferID); exists {
@@ -329,7 +400,7 @@ func (p *TransferProcessor) processTransfer(transfer *putio.Transfer) {
 		Int64("file_id", transfer.FileID).
 		Msg("Processing transfer")
 
-	files, err := p.manager.client.GetAllTransferFiles(transfer.FileID)
+	files, err := p.manager.provider.GetAllTransferFiles(p.manager.ctx, transfer.FileID)
 	if err != nil {
 		p.handleTransferError(transfer, err)
 		return
@@ -341,13 +412,19 @@ func (p *TransferProcessor) processTransfer(transfer *putio.Transfer) {
 		return
 	}
 
+	p.downloadTransfer(transfer, newDownloadJobs(transfer, files))
+}
+
+// downloadTransfer starts tracking a transfer and queues the jobs of its
+// files that are not downloaded yet
+func (p *TransferProcessor) downloadTransfer(transfer *putio.Transfer, jobs []downloadJob) {
 	// Initialize transfer with total number of files
-	if !p.initializeTransfer(transfer, len(files)) {
+	if !p.initializeTransfer(transfer, len(jobs)) {
 		return
 	}
 
 	// Queue files that need downloading
-	filesToDownload := p.queueTransferFiles(transfer, files)
+	filesToDownload := p.queueTransferFiles(transfer, jobs)
 
 	// If no files need downloading (all exist), complete the transfer
 	if filesToDownload == 0 {
@@ -382,7 +459,7 @@ func (p *TransferProcessor) handleTransferError(transfer *putio.Transfer, err er
 }
 
 // queueTransferFiles processes files in a transfer and queues them for download
-func (p *TransferProcessor) queueTransferFiles(transfer *putio.Transfer, files []*putio.File) int {
+func (p *TransferProcessor) queueTransferFiles(transfer *putio.Transfer, files []downloadJob) int {
 	filesToDownload := 0
 
 	// Get the transfer context to update total size
@@ -394,16 +471,31 @@ func (p *TransferProcessor) queueTransferFiles(transfer *putio.Transfer, files [
 		return 0
 	}
 
-	// Calculate total size of all files
+	// Calculate total size of all files, resolve their local paths and
+	// remember them for verification
 	var totalSize int64
-	for _, file := range files {
-		totalSize += file.Size
+	jobs := make([]downloadJob, 0, len(files))
+	wanted := make([]wantedFile, 0, len(files))
+	known := make(map[int64]struct{}, len(files))
+	var collided []downloadJob
+	for _, job := range files {
+		totalSize += job.Size
+		known[job.FileID] = struct{}{}
+		if !p.manager.claimPath(&job) {
+			collided = append(collided, job)
+			continue
+		}
+		jobs = append(jobs, job)
+		wanted = append(wanted, wantedFile{FileID: job.FileID, Name: job.Name, Size: job.Size, CRC32: job.CRC32})
 	}
 
 	// Update the transfer context with total size
 	ctx.Mu.Lock()
 	ctx.TotalSize = totalSize
+	ctx.wanted = wanted
+	ctx.files = known
 	ctx.Mu.Unlock()
+	p.manager.saveQueued(transfer.ID)
 
 	log.Info("transfers").
 		Int64("transfer_id", transfer.ID).
@@ -411,74 +503,142 @@ func (p *TransferProcessor) queueTransferFiles(transfer *putio.Transfer, files [
 		Int("file_count", len(files)).
 		Msg("Updated transfer with total file size")
 
-	for _, file := range files {
-		if p.shouldDownloadFile(transfer, file) {
+	// Small files are collected into batches so they share one worker
+	var batch []downloadJob
+	flushBatch := func() {
+		p.queueBatchDownload(transfer, batch)
+		batch = nil
+	}
+
+	cfg := p.manager.dlConfig
+	for _, job := range jobs {
+		if p.shouldDownloadFile(job) {
 			filesToDownload++
-			p.queueFileDownload(transfer, file)
+			if job.Size < cfg.SmallFileThreshold {
+				batch = append(batch, job)
+				if len(batch) >= cfg.SmallFileBatchSize {
+					flushBatch()
+				}
+				continue
+			}
+			p.queueFileDownload(job)
 		} else {
 			// For files we don't need to download (already exist), mark as completed
 			// This ensures our file count tracking is accurate
 			if err := p.manager.coordinator.FileCompleted(transfer.ID); err != nil {
 				log.Error("transfers").
 					Int64("transfer_id", transfer.ID).
-					Str("file_name", file.Name).
+					Str("file_name", job.Name).
 					Err(err).
 					Msg("Failed to mark existing file as completed")
 			}
 
 			// For existing files, add their size to the downloaded size
 			ctx.Mu.Lock()
-			ctx.DownloadedSize += file.Size
+			ctx.DownloadedSize += job.Size
 			ctx.Mu.Unlock()
+			p.manager.saveFileDone(transfer.ID, job.FileID, SavedFileCompleted, nil)
 
 			log.Debug("transfers").
 				Int64("transfer_id", transfer.ID).
-				Str("file_name", file.Name).
-				Int64("file_size", file.Size).
+				Str("file_name", job.Name).
+				Int64("file_size", job.Size).
 				Msg("Added existing file size to downloaded total")
 		}
 	}
+	flushBatch()
+
+	// Files colliding with those of another transfer are left out
+	for _, job := range collided {
+		filesToDownload++
+		p.manager.publish(p.manager.fileEvent(events.FileSkipped, job, NewPathCollisionError(job.Name)))
+		p.manager.handleFileSkipped(job)
+	}
 	return filesToDownload
 }
 
 // shouldDownloadFile determines if a file needs to be downloaded
-func (p *TransferProcessor) shouldDownloadFile(transfer *putio.Transfer, file *putio.File) bool {
-	targetPath := filepath.Join(p.targetDir, transfer.Name, file.Name)
-	info, err := os.Stat(targetPath)
+func (p *TransferProcessor) shouldDownloadFile(job downloadJob) bool {
+	targetPath := p.manager.jobPath(job)
+	info, err := os.Stat(longPath(targetPath))
 
-	// Skip if file exists with correct size
-	if err == nil && info.Size() == file.Size {
+	// Skip if file exists with correct size, unless a downloader preallocated
+	// it and has not finished yet
+	if err == nil && info.Size() == job.Size && !isPartial(longPath(targetPath)) {
 		log.Info("transfers").
-			Str("file_name", file.Name).
-			Int64("file_id", file.ID).
+			Str("file_name", job.Name).
+			Int64("file_id", job.FileID).
 			Msg("File already exists, skipping download")
 		return false
 	}
 
 	// Skip if already being downloaded
-	if _, exists := p.manager.activeFiles.Load(file.ID); exists {
+	if _, exists := p.manager.activeFiles.Load(job.FileID); exists {
 		log.Debug("transfers").
-			Str("file_name", file.Name).
-			Int64("file_id", file.ID).
+			Str("file_name", job.Name).
+			Int64("file_id", job.FileID).
 			Msg("File already being downloaded")
 		return false
 	}
 
+	// Files found in the target directory on the first start are used instead
+	if os.IsNotExist(err) && p.manager.adoptExisting(job) {
+		return false
+	}
+
 	return true
 }
 
 // queueFileDownload adds a file to the download queue
-func (p *TransferProcessor) queueFileDownload(transfer *putio.Transfer, file *putio.File) {
-	p.manager.QueueDownload(downloadJob{
+func (p *TransferProcessor) queueFileDownload(job downloadJob) {
+	p.manager.QueueDownload(job)
+	log.Debug("transfers").
+		Str("file_name", job.Name).
+		Int64("file_id", job.FileID).
+		Int64("size", job.Size).
+		Msg("Queued file for download")
+}
+
+// queueBatchDownload adds a group of small files to the download queue as a single job
+func (p *TransferProcessor) queueBatchDownload(transfer *putio.Transfer, files []downloadJob) {
+	switch len(files) {
+	case 0:
+		return
+	case 1:
+		p.queueFileDownload(files[0])
+		return
+	}
+
+	batch := downloadJob{TransferID: transfer.ID, Batch: files}
+	for _, file := range files {
+		batch.Size += file.Size
+	}
+	p.manager.QueueDownload(batch)
+	log.Debug("transfers").
+		Int64("transfer_id", transfer.ID).
+		Int("files", len(files)).
+		Int64("size", batch.Size).
+		Msg("Queued small files as batch download")
+}
+
+// newDownloadJob creates a download job for a file of a transfer
+func newDownloadJob(transfer *putio.Transfer, file *putio.File) downloadJob {
+	return downloadJob{
 		FileID:     file.ID,
 		Name:       filepath.Join(transfer.Name, file.Name),
 		TransferID: transfer.ID,
-	})
-	log.Debug("transfers").
-		Str("file_name", file.Name).
-		Int64("file_id", file.ID).
-		Int64("size", file.Size).
-		Msg("Queued file for download")
+		Size:       file.Size,
+		CRC32:      file.CRC32,
+	}
+}
+
+// newDownloadJobs creates the download jobs of the files of a transfer
+func newDownloadJobs(transfer *putio.Transfer, files []*putio.File) []downloadJob {
+	jobs := make([]downloadJob, 0, len(files))
+	for _, file := range files {
+		jobs = append(jobs, newDownloadJob(transfer, file))
+	}
+	return jobs
 }
 
 // initializeTransfer sets up transfer tracking
@@ -508,6 +668,14 @@ func (p *TransferProcessor) processErroredTransfers() {
 	const maxRetryAttempts = 3 // Maximum number of retry attempts
 
 	for _, transfer := range p.transfers["ERROR"] {
+		// Errored transfers added elsewhere are left to whoever added them
+		if !p.accept(transfer) {
+			continue
+		}
+
+		// Providers that cannot retry transfers get them deleted right away
+		retrier, canRetry := provider.Of(p.manager.provider, transfer.ID).(provider.Retrier)
+
 		// Get current retry count
 		retryCountValue, exists := p.retryAttempts.Load(transfer.ID)
 		retryCount := 0
@@ -523,7 +691,7 @@ func (p *TransferProcessor) processErroredTransfers() {
 			Int("retry_count", retryCount)
 
 		// Check if we should retry or delete
-		if retryCount < maxRetryAttempts {
+		if canRetry && retryCount < maxRetryAttempts {
 			// Increment retry count
 			p.retryAttempts.Store(transfer.ID, retryCount+1)
 
@@ -531,7 +699,7 @@ func (p *TransferProcessor) processErroredTransfers() {
 			logger.Msgf("Transfer errored, retrying (attempt %d of %d)", retryCount+1, maxRetryAttempts)
 
 			// Attempt to retry the transfer
-			retried, err := p.manager.client.RetryTransfer(transfer.ID)
+			retried, err := retrier.RetryTransfer(p.manager.ctx, transfer.ID)
 			if err != nil {
 				log.Error("transfers").
 					Str("name", transfer.Name).
@@ -547,10 +715,10 @@ func (p *TransferProcessor) processErroredTransfers() {
 			}
 		} else {
 			// Log that we're giving up after max retries
-			logger.Msgf("Transfer errored, giving up after %d retry attempts", maxRetryAttempts)
+			logger.Msgf("Transfer errored, giving up after %d retry attempts", retryCount)
 
 			// Delete the transfer after max retries
-			if err := p.manager.client.DeleteTransfer(transfer.ID); err != nil {
+			if err := p.manager.provider.DeleteTransfer(p.manager.ctx, transfer.ID); err != nil {
 				log.Error("transfers").
 					Str("name", transfer.Name).
 					Int64("id", transfer.ID).
@@ -559,6 +727,17 @@ func (p *TransferProcessor) processErroredTransfers() {
 			} else {
 				// Clear retry counter after successful deletion
 				p.retryAttempts.Delete(transfer.ID)
+
+				p.manager.publish(events.Event{
+					Type:       events.TransferErrored,
+					TransferID: transfer.ID,
+					Hash:       transfer.Hash,
+					Name:       transfer.Name,
+					Category:   p.manager.Category(transfer.ID),
+					Size:       int64(transfer.Size),
+					Error:      transfer.ErrorMessage,
+					ErrorCode:  ErrorCodeRemoteFailed,
+				})
 				log.Info("transfers").
 					Str("name", transfer.Name).
 					Int64("id", transfer.ID).
@@ -585,6 +764,7 @@ func (p *TransferProcessor) MarkTransferProcessed(transferID int64, transfer *pu
 
 // RemoveProcessedTransfer removes a transfer from the processed list (called when torrent-remove is received)
 func (p *TransferProcessor) RemoveProcessedTransfer(transferID int64) {
+	p.manager.releaseClaims(transferID)
 	if _, existed := p.processedTransfers.LoadAndDelete(transferID); existed {
 		log.Info("transfers").
 			Int64("transfer_id", transferID).
@@ -0,0 +1,258 @@
+package download
+
+import (
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/log"
+	"github.com/elsbrock/plundrio/internal/state"
+)
+
+// TuningState is the name of the state document holding tuned settings
+const TuningState = "tuning"
+
+const (
+	// tuningSpeedWeight is the weight of a new speed sample in the running average
+	tuningSpeedWeight = 0.3
+
+	// tuningMinSamples is how many downloads with a connection count are
+	// needed before its speed is trusted
+	tuningMinSamples = 2
+
+	// tuningExploreEvery is how often a download capped at the learned
+	// connection count uses all connections it got instead, to keep learning
+	tuningExploreEvery = 5
+
+	// tuningMaxDownloads is how many downloads the failure rate of a server
+	// covers before older ones are phased out
+	tuningMaxDownloads = 100
+
+	// defaultRetryWait and maxRetryWait bound the seconds aria2c waits
+	// before retrying a failed connection
+	defaultRetryWait = 3
+	maxRetryWait     = 30
+)
+
+// Tuning holds download settings found by `plundrio speedtest` and learned
+// from downloads. The connection count is used on startup unless it is
+// configured explicitly; the server settings are always used.
+type Tuning struct {
+	Connections int       `json:"connections"`
+	Speed       float64   `json:"speed"` // bytes per second measured with Connections
+	MeasuredAt  time.Time `json:"measured_at"`
+
+	Servers map[string]*ServerTuning `json:"servers,omitempty"`
+}
+
+// ServerTuning is what was learned about downloads from one put.io server
+type ServerTuning struct {
+	Speeds    map[int]*SpeedSample `json:"speeds"`    // by connection count
+	Downloads int                  `json:"downloads"` // downloads the failure rate covers
+	Failures  int                  `json:"failures"`  // of those that failed transiently
+	UpdatedAt time.Time            `json:"updated_at"`
+}
+
+// SpeedSample is the running average speed of downloads with a connection count
+type SpeedSample struct {
+	Speed   float64 `json:"speed"` // bytes per second
+	Samples int     `json:"samples"`
+}
+
+// tuner learns per download server how many connections are worth using and
+// how often downloads fail, and keeps it in the state directory so a restart
+// does not start from scratch
+type tuner struct {
+	mu      sync.Mutex
+	store   *state.Store // nil without a state directory
+	servers map[string]*ServerTuning
+	dirty   bool
+	capped  int // downloads capped at the learned connection count
+}
+
+// newTuner creates a tuner, loading what previous runs learned from the state directory
+func newTuner(stateDir string) *tuner {
+	t := &tuner{servers: make(map[string]*ServerTuning)}
+	if stateDir == "" {
+		return t
+	}
+
+	store, err := state.New(stateDir)
+	if err != nil {
+		log.Warn("tuning").Err(err).Msg("Learned settings will not be kept")
+		return t
+	}
+	t.store = store
+
+	var tuning Tuning
+	if err := store.Load(TuningState, &tuning); err != nil {
+		log.Warn("tuning").Err(err).Msg("Failed to load learned settings")
+		return t
+	}
+	if tuning.Servers != nil {
+		t.servers = tuning.Servers
+	}
+	log.Debug("tuning").Int("servers", len(t.servers)).Msg("Loaded learned settings")
+	return t
+}
+
+// serverOf returns the server a download URL points to
+func serverOf(downloadURL string) string {
+	u, err := url.Parse(downloadURL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// server returns the tuning of a server, creating it if necessary. t.mu must be held.
+func (t *tuner) server(host string) *ServerTuning {
+	s, ok := t.servers[host]
+	if !ok {
+		s = &ServerTuning{Speeds: make(map[int]*SpeedSample)}
+		t.servers[host] = s
+	}
+	return s
+}
+
+// connections returns how many of the given connections a download from a
+// server should use: the fewest that reached 95% of the best speed seen from
+// it, unless not enough is known yet. Now and then all are used to keep
+// learning.
+func (t *tuner) connections(host string, available int) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, ok := t.servers[host]
+	if !ok {
+		return available
+	}
+
+	var best float64
+	trusted := 0
+	for _, sample := range s.Speeds {
+		if sample.Samples >= tuningMinSamples {
+			trusted++
+			best = max(best, sample.Speed)
+		}
+	}
+	if trusted < 2 {
+		return available
+	}
+
+	optimal := 0
+	for connections, sample := range s.Speeds {
+		if sample.Samples >= tuningMinSamples && sample.Speed >= best*0.95 && (optimal == 0 || connections < optimal) {
+			optimal = connections
+		}
+	}
+	if optimal == 0 || optimal >= available {
+		return available
+	}
+	if t.capped++; t.capped%tuningExploreEvery == 0 {
+		return available
+	}
+	return optimal
+}
+
+// retryWait returns how many seconds aria2c should wait before retrying a
+// failed connection to a server; the more often downloads from it failed,
+// the longer
+func (t *tuner) retryWait(host string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, ok := t.servers[host]
+	if !ok || s.Downloads == 0 {
+		return defaultRetryWait
+	}
+	rate := float64(s.Failures) / float64(s.Downloads)
+	return defaultRetryWait + int(rate*(maxRetryWait-defaultRetryWait))
+}
+
+// recordSuccess learns from a finished download from a server
+func (t *tuner) recordSuccess(host string, connections int, speed float64) {
+	if host == "" {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := t.server(host)
+	t.countDownload(s, false)
+	if speed <= 0 {
+		return
+	}
+	sample, ok := s.Speeds[connections]
+	if !ok {
+		s.Speeds[connections] = &SpeedSample{Speed: speed, Samples: 1}
+		return
+	}
+	sample.Speed += (speed - sample.Speed) * tuningSpeedWeight
+	sample.Samples++
+}
+
+// recordFailure learns from a download from a server that failed but may be retried
+func (t *tuner) recordFailure(host string) {
+	if host == "" {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.countDownload(t.server(host), true)
+}
+
+// countDownload adds a download to the failure rate of a server, phasing out
+// old ones. t.mu must be held.
+func (t *tuner) countDownload(s *ServerTuning, failed bool) {
+	s.Downloads++
+	if failed {
+		s.Failures++
+	}
+	if s.Downloads > tuningMaxDownloads {
+		s.Downloads /= 2
+		s.Failures /= 2
+	}
+	s.UpdatedAt = time.Now()
+	t.dirty = true
+}
+
+// save writes what was learned to the state directory. The speed test result
+// in the same document is left as it is.
+func (t *tuner) save() {
+	if t.store == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.dirty {
+		return
+	}
+
+	var tuning Tuning
+	if err := t.store.Load(TuningState, &tuning); err != nil {
+		log.Warn("tuning").Err(err).Msg("Failed to load learned settings, overwriting them")
+	}
+	tuning.Servers = t.servers
+	if err := t.store.Save(TuningState, tuning); err != nil {
+		log.Warn("tuning").Err(err).Msg("Failed to save learned settings")
+		return
+	}
+	t.dirty = false
+}
+
+// saveTuningPeriodically keeps the learned settings in the state directory up to date
+func (m *Manager) saveTuningPeriodically() {
+	ticker := time.NewTicker(m.dlConfig.TuningSaveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stopChan:
+			m.tuner.save()
+			return
+		case <-ticker.C:
+			m.tuner.save()
+		}
+	}
+}
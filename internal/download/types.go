@@ -13,6 +13,14 @@ type downloadJob struct {
 	Name       string
 	IsFolder   bool
 	TransferID int64 // Parent transfer ID for group tracking
+	Size       int64 // Expected file size in bytes
+
+	// CRC32 is the checksum the provider reports for the file, if any
+	CRC32 string
+
+	// Batch holds small files that are downloaded together by one worker.
+	// When set, the job itself does not refer to a single file.
+	Batch []downloadJob
 }
 
 // DownloadState tracks the progress of a file download
@@ -20,14 +28,19 @@ type DownloadState struct {
 	TransferID   int64
 	FileID       int64
 	Name         string
+	Size         int64  // expected size, 0 if unknown
+	CRC32        string // checksum the provider reports, if any
 	Progress     float64
 	ETA          time.Time
 	LastProgress time.Time
 	StartTime    time.Time
 
 	// Mutex to protect access to downloaded bytes counter
-	mu         sync.Mutex
-	downloaded int64
+	mu           sync.Mutex
+	downloaded   int64
+	speedSum     float64 // sum of the speeds aria2c reported, for the average speed
+	speedSamples int
+	mount        bool // written to a FUSE mount: in order, over one connection and without preallocation
 }
 
 // TransferLifecycleState represents the possible states of a transfer
@@ -39,7 +52,8 @@ const (
 	TransferLifecycleCompleted
 	TransferLifecycleFailed
 	TransferLifecycleCancelled
-	TransferLifecycleProcessed // Added: Transfer has been processed locally and can be shown as 100% complete
+	TransferLifecycleProcessed   // Added: Transfer has been processed locally and can be shown as 100% complete
+	TransferLifecycleQuarantined // Files kept failing; no more automatic retries until retried manually
 )
 
 // String returns a string representation of the transfer state
@@ -57,6 +71,8 @@ func (s TransferLifecycleState) String() string {
 		return "Cancelled"
 	case TransferLifecycleProcessed:
 		return "Processed"
+	case TransferLifecycleQuarantined:
+		return "Quarantined"
 	default:
 		return "Unknown"
 	}
@@ -69,12 +85,86 @@ type TransferContext struct {
 	FileID         int64
 	TotalFiles     int32
 	CompletedFiles int32
-	FailedFiles    int32 // Track number of failed files
-	TotalSize      int64 // Total size of all files in bytes
-	DownloadedSize int64 // Total downloaded bytes
+	FailedFiles    int32     // Track number of failed files
+	SkippedFiles   int32     // Files that disappeared from Put.io and are left out
+	TotalSize      int64     // Total size of all files in bytes
+	DownloadedSize int64     // Total downloaded bytes
 	StartTime      time.Time // When the download started
 	State          TransferLifecycleState
 	Error          error
 	Mu             sync.RWMutex
 	Transfer       *putio.Transfer // Original transfer for RPC visibility after processing
+	Manual         bool            // Queued from a file already on Put.io rather than a transfer; the file is kept there
+
+	wanted         []wantedFile       // Files that must be present before the transfer counts as completed
+	files          map[int64]struct{} // Files of the transfer at the provider, to notice files added later
+	verifyFailures int                // Number of times files were missing when completing the transfer
+
+	RetryCycles      int          // Times the failed files were downloaded again
+	QuarantineReason string       // Why the transfer was quarantined
+	failed           []failedFile // Files that failed to download, for the next retry cycle
+	failedAt         time.Time    // When the last file failed
+}
+
+// Outcomes of a transfer whose files are all done
+const (
+	OutcomeSuccess = "success" // every file was downloaded
+	OutcomePartial = "partial" // some files were downloaded, others failed
+	OutcomeFailure = "failure" // no file was downloaded
+)
+
+// Outcome returns how a transfer ended, or an empty string while its files
+// are still downloading or may be retried automatically. The caller must hold
+// ctx.Mu.
+func (ctx *TransferContext) Outcome() string {
+	switch ctx.State {
+	case TransferLifecycleProcessed:
+		if ctx.FailedFiles > 0 {
+			return OutcomePartial
+		}
+		return OutcomeSuccess
+	case TransferLifecycleQuarantined:
+		if ctx.CompletedFiles > 0 {
+			return OutcomePartial
+		}
+		return OutcomeFailure
+	}
+	return ""
+}
+
+// FailedFile is a file of a transfer that failed to download
+type FailedFile struct {
+	FileID    int64  `json:"file_id"`
+	Name      string `json:"name"`
+	Size      int64  `json:"size"`
+	Error     string `json:"error"`
+	ErrorCode string `json:"error_code"`
+}
+
+// failedFile is a file that failed to download with the reason
+type failedFile struct {
+	wantedFile
+	err error
+}
+
+// FailedFileDetails returns the files of a transfer that failed to download. The
+// caller must hold ctx.Mu.
+func (ctx *TransferContext) FailedFileDetails() []FailedFile {
+	files := make([]FailedFile, 0, len(ctx.failed))
+	for _, f := range ctx.failed {
+		file := FailedFile{FileID: f.FileID, Name: f.Name, Size: f.Size, ErrorCode: ErrorCode(f.err)}
+		if f.err != nil {
+			file.Error = f.err.Error()
+		}
+		files = append(files, file)
+	}
+	return files
+}
+
+// wantedFile is a file of a transfer that is verified before the transfer completes
+type wantedFile struct {
+	FileID int64
+	Name   string // Path relative to the target directory
+	Size   int64
+	CRC32  string
 }
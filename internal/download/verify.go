@@ -0,0 +1,84 @@
+package download
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// maxVerifyFailures is how often missing files are downloaded again before
+// the transfer is given up as failed
+const maxVerifyFailures = 3
+
+// unverifiedFiles returns the wanted files of a transfer that are missing,
+// have the wrong size or are still partial downloads. The caller must hold
+// ctx.Mu.
+func (m *Manager) unverifiedFiles(ctx *TransferContext) []wantedFile {
+	return missingFiles(m.TargetDir(ctx.ID), ctx.wanted)
+}
+
+// missingFiles returns the files that are missing in dir, have the wrong
+// size or are still being written
+func missingFiles(dir string, files []wantedFile) []wantedFile {
+	var missing []wantedFile
+	for _, file := range files {
+		path := longPath(filepath.Join(dir, file.Name))
+		info, err := statRetry(path)
+		if err != nil || info.Size() != file.Size {
+			missing = append(missing, file)
+			continue
+		}
+		if isPartial(path) {
+			missing = append(missing, file)
+		}
+	}
+	return missing
+}
+
+// verifyChecksum compares a downloaded file with the size and, if enabled
+// with verify-checksums, the CRC32 checksum the provider reports for it. A
+// file that differs is removed, so it is downloaded again from the start.
+func (m *Manager) verifyChecksum(state *DownloadState, targetPath string, info os.FileInfo) error {
+	var err error
+	if state.Size > 0 && info.Size() != state.Size {
+		err = NewChecksumMismatchError(state.Name, fmt.Sprintf("size is %d bytes instead of %d", info.Size(), state.Size))
+	} else if m.cfg.VerifyChecksums && state.CRC32 != "" {
+		sum, sumErr := fileCRC32(targetPath)
+		if sumErr != nil {
+			return NewFileSystemError(state.Name, sumErr)
+		}
+		if !strings.EqualFold(sum, state.CRC32) {
+			err = NewChecksumMismatchError(state.Name, fmt.Sprintf("CRC32 is %s instead of %s", sum, state.CRC32))
+		}
+	}
+	if err != nil {
+		log.Warn("download").
+			Str("file_name", state.Name).
+			Int64("transfer_id", state.TransferID).
+			Err(err).
+			Msg("Download does not match the provider, downloading it again")
+		os.Remove(longPath(targetPath))
+		return err
+	}
+	return nil
+}
+
+// redownloadFiles queues files that failed to download or verify again
+func (m *Manager) redownloadFiles(transferID int64, files []wantedFile) {
+	for _, file := range files {
+		log.Info("download").
+			Str("file_name", file.Name).
+			Int64("transfer_id", transferID).
+			Msg("Downloading file again")
+		m.QueueDownload(downloadJob{
+			FileID:     file.FileID,
+			Name:       file.Name,
+			TransferID: transferID,
+			Size:       file.Size,
+			CRC32:      file.CRC32,
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package download
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// volumeLimiter caps the number of downloads writing to the same volume at
+// the same time, so a slow disk is not slowed down further by seeking
+// between many files
+type volumeLimiter struct {
+	mu    sync.Mutex
+	slots map[string]chan struct{} // volume ID -> writer slots, nil if unlimited
+}
+
+// volumeWriters returns how many downloads may write to the volume with the
+// given ID at the same time (0 means unlimited)
+func (m *Manager) volumeWriters(id string) int {
+	for _, limit := range m.cfg.VolumeLimits {
+		if volumeID(filepath.Clean(limit.Path)) == id {
+			return limit.Writers
+		}
+	}
+	return m.cfg.VolumeWriters
+}
+
+// acquireVolume waits for a writer slot on the volume dir is on and returns
+// a function releasing it. It fails if ctx ends while waiting.
+func (m *Manager) acquireVolume(ctx context.Context, dir string) (func(), error) {
+	id := volumeID(dir)
+
+	m.volumes.mu.Lock()
+	if m.volumes.slots == nil {
+		m.volumes.slots = make(map[string]chan struct{})
+	}
+	slots, known := m.volumes.slots[id]
+	if !known {
+		if writers := m.volumeWriters(id); writers > 0 {
+			slots = make(chan struct{}, writers)
+		}
+		m.volumes.slots[id] = slots
+	}
+	m.volumes.mu.Unlock()
+
+	if slots == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	default:
+	}
+
+	log.Debug("download").
+		Str("dir", dir).
+		Int("writers", cap(slots)).
+		Msg("Waiting for other downloads to the same volume")
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package download
+
+import "path/filepath"
+
+// volumeID identifies the filesystem a path is on by its volume name, such
+// as a drive letter or UNC share
+func volumeID(path string) string {
+	return filepath.VolumeName(path)
+}
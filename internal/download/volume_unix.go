@@ -0,0 +1,28 @@
+//go:build unix
+
+package download
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+)
+
+// volumeID identifies the filesystem a path is on by its device number. The
+// path does not need to exist yet; its closest existing parent is used.
+func volumeID(path string) string {
+	for {
+		if info, err := os.Stat(path); err == nil {
+			if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+				return strconv.FormatUint(uint64(stat.Dev), 10)
+			}
+			return ""
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return ""
+		}
+		path = parent
+	}
+}
@@ -0,0 +1,254 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// Type identifies what happened
+type Type string
+
+// Transfer lifecycle events
+const (
+	TransferAdded       Type = "transfer.added"
+	TransferDownloading Type = "transfer.downloading"
+	TransferCompleted   Type = "transfer.completed"
+	TransferFailed      Type = "transfer.failed"  // local download failed
+	TransferErrored     Type = "transfer.errored" // Put.io gave up on the transfer
+	TransferImported    Type = "transfer.imported"
+	TransferRemoved     Type = "transfer.removed"
+	TransferPaused      Type = "transfer.paused"
+	TransferResumed     Type = "transfer.resumed"
+	TransferCancelled   Type = "transfer.cancelled"
+	TransferSlow        Type = "transfer.slow"        // speed stayed below the slow download threshold
+	TransferQuarantined Type = "transfer.quarantined" // files kept failing, no more automatic retries
+	TransferReconciled  Type = "transfer.reconciled"  // local state was corrected to match the provider, see Reason
+)
+
+// File lifecycle events
+const (
+	FileStarted   Type = "file.started"
+	FileCompleted Type = "file.completed"
+	FileFailed    Type = "file.failed"
+	FileSkipped   Type = "file.skipped" // file disappeared from Put.io and is left out
+)
+
+// System events
+const (
+	SystemStarted  Type = "system.started"
+	SystemStopping Type = "system.stopping"
+
+	SystemMaintenanceStarted Type = "system.maintenance.started" // downloads and polling paused for a maintenance window
+	SystemMaintenanceEnded   Type = "system.maintenance.ended"
+
+	SystemAuthRejected Type = "system.auth.rejected" // Put.io rejected the token, a new one is needed
+	SystemAuthRestored Type = "system.auth.restored"
+)
+
+// subscriptionBuffer is how many events a subscriber may lag behind before events are dropped
+const subscriptionBuffer = 256
+
+// Event describes something that happened to a transfer, a file or plundrio itself.
+// Fields that don't apply to an event type are left empty.
+type Event struct {
+	Type        Type              `json:"type"`
+	Time        time.Time         `json:"time"`
+	TransferID  int64             `json:"transfer_id,omitempty"`
+	Hash        string            `json:"hash,omitempty"`
+	Name        string            `json:"name,omitempty"`
+	Category    string            `json:"category,omitempty"`
+	Path        string            `json:"path,omitempty"`
+	FileID      int64             `json:"file_id,omitempty"`
+	FileName    string            `json:"file_name,omitempty"`
+	Size        int64             `json:"size,omitempty"`
+	Duration    time.Duration     `json:"duration,omitempty"`
+	Speed       float64           `json:"speed,omitempty"` // bytes per second
+	Error       string            `json:"error,omitempty"`
+	ErrorCode   string            `json:"error_code,omitempty"`   // stable classification of Error, see download.ErrorCode
+	Reason      string            `json:"reason,omitempty"`       // what was corrected, see download.Reconcile*
+	Notes       string            `json:"notes,omitempty"`        // notes attached to the transfer
+	Metadata    map[string]string `json:"metadata,omitempty"`     // metadata attached to the transfer
+	RequestedBy string            `json:"requested_by,omitempty"` // API user the transfer was added by
+}
+
+// Handler consumes events
+type Handler func(Event)
+
+// Bus delivers published events to all interested subscribers. Publishing
+// never blocks: each subscriber has its own buffer and events are dropped
+// for subscribers that fall too far behind.
+type Bus struct {
+	mu            sync.RWMutex
+	subscriptions map[*Subscription]struct{}
+}
+
+// Subscription receives the events it subscribed to until it is closed
+type Subscription struct {
+	name  string
+	types map[Type]struct{}
+	ch    chan Event
+	bus   *Bus
+	once  sync.Once
+}
+
+// NewBus creates an event bus without subscribers
+func NewBus() *Bus {
+	return &Bus{
+		subscriptions: make(map[*Subscription]struct{}),
+	}
+}
+
+// Subscribe registers a subscriber for the given event types, or for all
+// events if no types are given. The name identifies the subscriber in logs.
+func (b *Bus) Subscribe(name string, types ...Type) *Subscription {
+	sub := &Subscription{
+		name:  name,
+		types: make(map[Type]struct{}, len(types)),
+		ch:    make(chan Event, subscriptionBuffer),
+		bus:   b,
+	}
+	for _, t := range types {
+		sub.types[t] = struct{}{}
+	}
+
+	b.mu.Lock()
+	b.subscriptions[sub] = struct{}{}
+	b.mu.Unlock()
+
+	log.Debug("events").
+		Str("subscriber", name).
+		Interface("types", types).
+		Msg("Subscriber registered")
+
+	return sub
+}
+
+// Handle subscribes a handler that is called for each matching event, one at a time
+func (b *Bus) Handle(name string, handler Handler, types ...Type) *Subscription {
+	sub := b.Subscribe(name, types...)
+	go func() {
+		for event := range sub.ch {
+			handler(event)
+		}
+	}()
+	return sub
+}
+
+// Publish sends an event to all subscribers interested in its type. It is
+// lossy: events are dropped for subscribers whose buffer is full, so the bus
+// only suits consumers that can miss an event, such as notifications, pushes,
+// streams and the audit log. State that must not miss one is updated by the
+// publisher before publishing.
+func (b *Bus) Publish(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for sub := range b.subscriptions {
+		if !sub.wants(event.Type) {
+			continue
+		}
+		select {
+		case sub.ch <- event:
+		default:
+			log.Warn("events").
+				Str("subscriber", sub.name).
+				Str("type", string(event.Type)).
+				Msg("Subscriber is falling behind, dropping event")
+		}
+	}
+}
+
+// Close removes all subscribers
+func (b *Bus) Close() {
+	b.mu.RLock()
+	subs := make([]*Subscription, 0, len(b.subscriptions))
+	for sub := range b.subscriptions {
+		subs = append(subs, sub)
+	}
+	b.mu.RUnlock()
+
+	for _, sub := range subs {
+		sub.Close()
+	}
+}
+
+// Events returns the channel events are delivered on. It is closed when the subscription is closed.
+func (s *Subscription) Events() <-chan Event {
+	return s.ch
+}
+
+// Close unsubscribes from the bus
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.bus.mu.Lock()
+		delete(s.bus.subscriptions, s)
+		close(s.ch)
+		s.bus.mu.Unlock()
+	})
+}
+
+// wants reports whether the subscription is interested in an event type
+func (s *Subscription) wants(t Type) bool {
+	if len(s.types) == 0 {
+		return true
+	}
+	_, ok := s.types[t]
+	return ok
+}
+
+// Log writes events to the log, serving as an audit trail
+func Log(event Event) {
+	logger := log.Info
+	if event.Type == FileStarted || event.Type == FileCompleted {
+		logger = log.Debug
+	}
+	logger("events").
+		Str("type", string(event.Type)).
+		Int64("transfer_id", event.TransferID).
+		Str("name", event.Name).
+		Str("file_name", event.FileName).
+		Str("error", event.Error).
+		Str("error_code", event.ErrorCode).
+		Msg("Event")
+}
+
+// Recorder keeps the most recent events in memory
+type Recorder struct {
+	mu     sync.Mutex
+	events []Event
+	size   int
+}
+
+// NewRecorder creates a recorder keeping up to size events
+func NewRecorder(size int) *Recorder {
+	return &Recorder{
+		events: make([]Event, 0, size),
+		size:   size,
+	}
+}
+
+// Record stores an event, evicting the oldest one when full
+func (r *Recorder) Record(event Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.events) == r.size {
+		copy(r.events, r.events[1:])
+		r.events = r.events[:len(r.events)-1]
+	}
+	r.events = append(r.events, event)
+}
+
+// Events returns the recorded events, oldest first
+func (r *Recorder) Events() []Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Event(nil), r.events...)
+}
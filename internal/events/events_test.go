@@ -0,0 +1,99 @@
+package events
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBusDelivers(t *testing.T) {
+	bus := NewBus()
+	all := bus.Subscribe("all")
+	completed := bus.Subscribe("completed", TransferCompleted)
+
+	bus.Publish(Event{Type: TransferAdded, TransferID: 1})
+	bus.Publish(Event{Type: TransferCompleted, TransferID: 1})
+
+	if got := len(all.Events()); got != 2 {
+		t.Errorf("subscriber to all events got %d, want 2", got)
+	}
+	if got := len(completed.Events()); got != 1 {
+		t.Fatalf("subscriber to completions got %d events, want 1", got)
+	}
+	if event := <-completed.Events(); event.Type != TransferCompleted || event.Time.IsZero() {
+		t.Errorf("event = %+v, want a completion with its time set", event)
+	}
+
+	completed.Close()
+	completed.Close()
+	if _, open := <-completed.Events(); open {
+		t.Error("events of a closed subscription are still open")
+	}
+	// Publishing after a subscription closed must not panic
+	bus.Publish(Event{Type: TransferCompleted})
+}
+
+func TestBusDropsForSlowSubscribers(t *testing.T) {
+	bus := NewBus()
+	slow := bus.Subscribe("slow")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < subscriptionBuffer*2; i++ {
+			bus.Publish(Event{Type: FileCompleted, TransferID: int64(i)})
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Publish blocked on a subscriber that does not read")
+	}
+
+	if got := len(slow.Events()); got != subscriptionBuffer {
+		t.Errorf("slow subscriber has %d events, want %d", got, subscriptionBuffer)
+	}
+	// The oldest events are kept, later ones dropped
+	if event := <-slow.Events(); event.TransferID != 0 {
+		t.Errorf("first event is of transfer %d, want 0", event.TransferID)
+	}
+}
+
+func TestHandle(t *testing.T) {
+	bus := NewBus()
+	got := make(chan Event, 1)
+	sub := bus.Handle("handler", func(event Event) { got <- event }, TransferFailed)
+	defer sub.Close()
+
+	bus.Publish(Event{Type: TransferAdded})
+	bus.Publish(Event{Type: TransferFailed, TransferID: 7})
+	select {
+	case event := <-got:
+		if event.Type != TransferFailed || event.TransferID != 7 {
+			t.Errorf("handled %+v, want the failure of transfer 7", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler was not called")
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	r := NewRecorder(3)
+	for i := int64(1); i <= 5; i++ {
+		r.Record(Event{TransferID: i})
+	}
+
+	events := r.Events()
+	if len(events) != 3 {
+		t.Fatalf("recorded %d events, want 3", len(events))
+	}
+	for i, event := range events {
+		if want := int64(i + 3); event.TransferID != want {
+			t.Errorf("event %d is of transfer %d, want %d", i, event.TransferID, want)
+		}
+	}
+	// The returned events are a copy
+	events[0].TransferID = 99
+	if r.Events()[0].TransferID != 3 {
+		t.Error("changing the returned events changed the recorder")
+	}
+}
@@ -0,0 +1,53 @@
+package graphql
+
+import "fmt"
+
+// IntArg returns an integer argument, or def if it is not set. Literals are
+// parsed as int64 while JSON variables arrive as float64, so both are accepted.
+func IntArg(args map[string]interface{}, name string, def int) (int, error) {
+	switch v := args[name].(type) {
+	case nil:
+		return def, nil
+	case int64:
+		return int(v), nil
+	case float64:
+		if v != float64(int(v)) {
+			return 0, fmt.Errorf("argument %q must be an integer", name)
+		}
+		return int(v), nil
+	}
+	return 0, fmt.Errorf("argument %q must be an integer", name)
+}
+
+// StringArg returns a string argument, or def if it is not set
+func StringArg(args map[string]interface{}, name string, def string) (string, error) {
+	switch v := args[name].(type) {
+	case nil:
+		return def, nil
+	case string:
+		return v, nil
+	}
+	return "", fmt.Errorf("argument %q must be a string", name)
+}
+
+// StringListArg returns a list of strings argument. A single string is
+// treated as a list with one element, as GraphQL allows.
+func StringListArg(args map[string]interface{}, name string) ([]string, error) {
+	switch v := args[name].(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("argument %q must be a list of strings", name)
+			}
+			list = append(list, s)
+		}
+		return list, nil
+	}
+	return nil, fmt.Errorf("argument %q must be a list of strings", name)
+}
@@ -0,0 +1,471 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Resolver resolves a root field. The returned value may be a struct, a map
+// with string keys, a slice or a scalar; sub-selections are applied to
+// structs through their json field names.
+type Resolver func(ctx context.Context, args map[string]interface{}) (interface{}, error)
+
+// SubscriptionResolver starts a subscription. Each value received from the
+// channel is resolved against the selection and sent to the client. The
+// channel must be closed once ctx is done.
+type SubscriptionResolver func(ctx context.Context, args map[string]interface{}) (<-chan interface{}, error)
+
+// Schema maps root fields to their resolvers
+type Schema struct {
+	Query        map[string]Resolver
+	Mutation     map[string]Resolver
+	Subscription map[string]SubscriptionResolver
+}
+
+// Request is a GraphQL request as sent over HTTP
+type Request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+// Response is the result of executing a request
+type Response struct {
+	Data   interface{} `json:"data,omitempty"`
+	Errors []*Error    `json:"errors,omitempty"`
+}
+
+// Error is a GraphQL error with the path of the failing field
+type Error struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path,omitempty"`
+}
+
+// Error implements the error interface
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Prepare parses a request and selects the operation to execute
+func Prepare(req Request) (*Document, *Operation, error) {
+	doc, err := Parse(req.Query)
+	if err != nil {
+		return nil, nil, err
+	}
+	op, err := doc.Operation(req.OperationName)
+	if err != nil {
+		return nil, nil, err
+	}
+	return doc, op, nil
+}
+
+// Execute runs a query or mutation
+func (s *Schema) Execute(ctx context.Context, req Request) *Response {
+	doc, op, err := Prepare(req)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	var resolvers map[string]Resolver
+	switch op.Type {
+	case OperationQuery:
+		resolvers = s.Query
+	case OperationMutation:
+		resolvers = s.Mutation
+	default:
+		return errorResponse(fmt.Errorf("%s operations must be sent as a stream", op.Type))
+	}
+
+	e := newExecution(doc, op, req.Variables)
+	fields, err := e.collectFields(op.SelectionSet)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	data := newObject()
+	for _, field := range fields {
+		key := field.ResponseKey()
+		if field.Name == "__typename" {
+			data.set(key, rootTypeNames[op.Type])
+			continue
+		}
+
+		resolver, ok := resolvers[field.Name]
+		if !ok {
+			e.addError(fmt.Sprintf("unknown field %q on %s", field.Name, op.Type), []interface{}{key})
+			data.set(key, nil)
+			continue
+		}
+
+		args, err := e.arguments(field)
+		if err != nil {
+			e.addError(err.Error(), []interface{}{key})
+			data.set(key, nil)
+			continue
+		}
+
+		value, err := resolver(ctx, args)
+		if err != nil {
+			e.addError(err.Error(), []interface{}{key})
+			data.set(key, nil)
+			continue
+		}
+		data.set(key, e.complete(value, field, []interface{}{key}))
+	}
+
+	return &Response{Data: data, Errors: e.errors}
+}
+
+// Subscribe starts a subscription and returns a channel of responses, one
+// per event. The channel is closed when ctx is done or the source ends.
+func (s *Schema) Subscribe(ctx context.Context, req Request) (<-chan *Response, error) {
+	doc, op, err := Prepare(req)
+	if err != nil {
+		return nil, err
+	}
+	if op.Type != OperationSubscription {
+		return nil, fmt.Errorf("operation is a %s, not a subscription", op.Type)
+	}
+
+	e := newExecution(doc, op, req.Variables)
+	fields, err := e.collectFields(op.SelectionSet)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) != 1 {
+		return nil, fmt.Errorf("subscriptions must select exactly one field")
+	}
+	field := fields[0]
+
+	resolver, ok := s.Subscription[field.Name]
+	if !ok {
+		return nil, fmt.Errorf("unknown field %q on subscription", field.Name)
+	}
+	args, err := e.arguments(field)
+	if err != nil {
+		return nil, err
+	}
+	source, err := resolver(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make(chan *Response)
+	go func() {
+		defer close(responses)
+		for value := range source {
+			event := newExecution(doc, op, req.Variables)
+			data := newObject()
+			data.set(field.ResponseKey(), event.complete(value, field, []interface{}{field.ResponseKey()}))
+
+			select {
+			case responses <- &Response{Data: data, Errors: event.errors}:
+			case <-ctx.Done():
+				// Drain the source so its producer can finish
+				for range source {
+				}
+				return
+			}
+		}
+	}()
+	return responses, nil
+}
+
+// errorResponse creates a response for a request that could not be executed
+func errorResponse(err error) *Response {
+	return &Response{Errors: []*Error{{Message: err.Error()}}}
+}
+
+// execution holds the state of executing a single operation
+type execution struct {
+	doc       *Document
+	variables map[string]interface{}
+	errors    []*Error
+}
+
+// newExecution prepares the execution of an operation with the given variables
+func newExecution(doc *Document, op *Operation, variables map[string]interface{}) *execution {
+	merged := make(map[string]interface{}, len(op.Variables)+len(variables))
+	for name, value := range op.Variables {
+		merged[name] = value
+	}
+	for name, value := range variables {
+		merged[name] = value
+	}
+	return &execution{doc: doc, variables: merged}
+}
+
+// addError records a field error
+func (e *execution) addError(message string, path []interface{}) {
+	e.errors = append(e.errors, &Error{Message: message, Path: append([]interface{}{}, path...)})
+}
+
+// collectFields flattens fragments into the list of selected fields
+func (e *execution) collectFields(selections []Selection) ([]*Field, error) {
+	var fields []*Field
+	visited := make(map[string]bool)
+
+	var collect func([]Selection) error
+	collect = func(selections []Selection) error {
+		for _, selection := range selections {
+			switch {
+			case selection.Field != nil:
+				fields = append(fields, selection.Field)
+			case selection.InlineFragment != nil:
+				if err := collect(selection.InlineFragment); err != nil {
+					return err
+				}
+			default:
+				if visited[selection.FragmentSpread] {
+					continue
+				}
+				visited[selection.FragmentSpread] = true
+				fragment, ok := e.doc.Fragments[selection.FragmentSpread]
+				if !ok {
+					return fmt.Errorf("unknown fragment %q", selection.FragmentSpread)
+				}
+				if err := collect(fragment.SelectionSet); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	if err := collect(selections); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// arguments resolves the arguments of a field, substituting variables
+func (e *execution) arguments(field *Field) (map[string]interface{}, error) {
+	args := make(map[string]interface{}, len(field.Arguments))
+	for name, value := range field.Arguments {
+		resolved, err := e.value(value)
+		if err != nil {
+			return nil, err
+		}
+		args[name] = resolved
+	}
+	return args, nil
+}
+
+// value resolves variables inside an argument value
+func (e *execution) value(value Value) (interface{}, error) {
+	switch v := value.(type) {
+	case Variable:
+		resolved, ok := e.variables[string(v)]
+		if !ok {
+			return nil, fmt.Errorf("variable $%s is not defined", v)
+		}
+		if _, isVariable := resolved.(Variable); isVariable {
+			return nil, fmt.Errorf("variable $%s must not reference another variable", v)
+		}
+		// Default values are parsed literals that may still contain lists and objects
+		return e.value(resolved)
+	case []Value:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			resolved, err := e.value(item)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = resolved
+		}
+		return list, nil
+	case map[string]Value:
+		object := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			resolved, err := e.value(item)
+			if err != nil {
+				return nil, err
+			}
+			object[key] = resolved
+		}
+		return object, nil
+	}
+	return value, nil
+}
+
+// complete applies the selection of a field to its resolved value
+func (e *execution) complete(value interface{}, field *Field, path []interface{}) interface{} {
+	v := reflect.ValueOf(value)
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil
+	}
+
+	switch {
+	case v.Type() == timeType:
+		return v.Interface()
+	case (v.Kind() == reflect.Slice || v.Kind() == reflect.Array) && v.Type().Elem().Kind() != reflect.Uint8:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		list := make([]interface{}, v.Len())
+		for i := range list {
+			list[i] = e.complete(v.Index(i).Interface(), field, append(path[:len(path):len(path)], i))
+		}
+		return list
+	case v.Kind() == reflect.Struct || (v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String):
+		if len(field.SelectionSet) == 0 {
+			e.addError(fmt.Sprintf("field %q of type %s must have a selection of subfields", field.Name, typeName(v)), path)
+			return nil
+		}
+		return e.completeObject(v, field, path)
+	}
+
+	if len(field.SelectionSet) > 0 {
+		e.addError(fmt.Sprintf("field %q must not have a selection since it is a scalar", field.Name), path)
+		return nil
+	}
+	return v.Interface()
+}
+
+// completeObject resolves the selected fields of a struct or map
+func (e *execution) completeObject(v reflect.Value, field *Field, path []interface{}) interface{} {
+	fields, err := e.collectFields(field.SelectionSet)
+	if err != nil {
+		e.addError(err.Error(), path)
+		return nil
+	}
+
+	object := newObject()
+	for _, sub := range fields {
+		key := sub.ResponseKey()
+		subPath := append(path[:len(path):len(path)], key)
+
+		if sub.Name == "__typename" {
+			object.set(key, typeName(v))
+			continue
+		}
+		if len(sub.Arguments) > 0 {
+			e.addError(fmt.Sprintf("field %q does not take arguments", sub.Name), subPath)
+			object.set(key, nil)
+			continue
+		}
+
+		var child reflect.Value
+		if v.Kind() == reflect.Map {
+			child = v.MapIndex(reflect.ValueOf(sub.Name))
+			if !child.IsValid() {
+				object.set(key, nil)
+				continue
+			}
+		} else {
+			index, ok := jsonFields(v.Type())[sub.Name]
+			if !ok {
+				e.addError(fmt.Sprintf("unknown field %q on %s", sub.Name, typeName(v)), subPath)
+				object.set(key, nil)
+				continue
+			}
+			child = v.Field(index)
+		}
+		object.set(key, e.complete(child.Interface(), sub, subPath))
+	}
+	return object
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// rootTypeNames are the type names of the root operation types
+var rootTypeNames = map[string]string{
+	OperationQuery:        "Query",
+	OperationMutation:     "Mutation",
+	OperationSubscription: "Subscription",
+}
+
+// fieldCache maps struct types to their json field names and field indexes
+var fieldCache sync.Map // map[reflect.Type]map[string]int
+
+// jsonFields returns the exported fields of a struct type by json name
+func jsonFields(t reflect.Type) map[string]int {
+	if cached, ok := fieldCache.Load(t); ok {
+		return cached.(map[string]int)
+	}
+
+	fields := make(map[string]int)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := f.Name
+		if tag := f.Tag.Get("json"); tag != "" {
+			tagName, _, _ := strings.Cut(tag, ",")
+			if tagName == "-" {
+				continue
+			}
+			if tagName != "" {
+				name = tagName
+			}
+		}
+		fields[name] = i
+	}
+	fieldCache.Store(t, fields)
+	return fields
+}
+
+// typeName returns the GraphQL type name reported for a value
+func typeName(v reflect.Value) string {
+	if v.Kind() == reflect.Map {
+		return "Object"
+	}
+	return v.Type().Name()
+}
+
+// object is a JSON object that keeps the order of its keys, as GraphQL
+// requires results to follow the order of the selection
+type object struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+// newObject creates an empty ordered object
+func newObject() *object {
+	return &object{values: make(map[string]interface{})}
+}
+
+// set adds a key, keeping the position of keys that were already set
+func (o *object) set(key string, value interface{}) {
+	if _, exists := o.values[key]; !exists {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+// MarshalJSON encodes the object with keys in selection order
+func (o *object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(o.values[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
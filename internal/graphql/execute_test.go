@@ -0,0 +1,265 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+type testTransfer struct {
+	ID      int64             `json:"id"`
+	Name    string            `json:"name"`
+	Size    float64           `json:"size"`
+	Added   time.Time         `json:"added"`
+	Files   []testFile        `json:"files"`
+	Meta    map[string]string `json:"metadata"`
+	Secret  string            `json:"-"`
+	Hash    string
+	private string
+}
+
+type testFile struct {
+	Name string `json:"name"`
+}
+
+func testSchema() *Schema {
+	transfers := []testTransfer{
+		{ID: 1, Name: "one", Size: 1e10, Added: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), Files: []testFile{{"a.mkv"}}, Meta: map[string]string{"k": "v"}, Hash: "h1"},
+		{ID: 2, Name: "two"},
+	}
+	return &Schema{
+		Query: map[string]Resolver{
+			"transfers": func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+				return transfers, nil
+			},
+			"transfer": func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+				id, err := IntArg(args, "id", 0)
+				if err != nil {
+					return nil, err
+				}
+				for i := range transfers {
+					if transfers[i].ID == int64(id) {
+						return &transfers[i], nil
+					}
+				}
+				return nil, nil
+			},
+			"echo": func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+				return args, nil
+			},
+			"broken": func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+				return nil, errors.New("resolver failed")
+			},
+		},
+		Mutation: map[string]Resolver{
+			"pause": func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+				return StringListArg(args, "ids")
+			},
+		},
+		Subscription: map[string]SubscriptionResolver{
+			"ticks": func(ctx context.Context, args map[string]interface{}) (<-chan interface{}, error) {
+				n, err := IntArg(args, "count", 2)
+				if err != nil {
+					return nil, err
+				}
+				ch := make(chan interface{})
+				go func() {
+					defer close(ch)
+					for i := 1; i <= n; i++ {
+						select {
+						case ch <- testFile{Name: "tick"}:
+						case <-ctx.Done():
+							return
+						}
+					}
+				}()
+				return ch, nil
+			},
+		},
+	}
+}
+
+// execute runs a request and returns the response encoded as JSON
+func execute(t *testing.T, req Request) string {
+	t.Helper()
+	data, err := json.Marshal(testSchema().Execute(context.Background(), req))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestExecute(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		req  Request
+		want string
+	}{
+		{
+			name: "selection in order with aliases",
+			req:  Request{Query: `{ transfers { name key: id } }`},
+			want: `{"data":{"transfers":[{"name":"one","key":1},{"name":"two","key":2}]}}`,
+		},
+		{
+			name: "nested lists, maps, times and untagged fields",
+			req:  Request{Query: `{ transfer(id: 1) { size added files { name } metadata { k } Hash } }`},
+			want: `{"data":{"transfer":{"size":10000000000,"added":"2024-05-01T12:00:00Z","files":[{"name":"a.mkv"}],"metadata":{"k":"v"},"Hash":"h1"}}}`,
+		},
+		{
+			name: "type names",
+			req:  Request{Query: `{ __typename transfer(id: 2) { __typename } }`},
+			want: `{"data":{"__typename":"Query","transfer":{"__typename":"testTransfer"}}}`,
+		},
+		{
+			name: "null result",
+			req:  Request{Query: `{ transfer(id: 3) { id } }`},
+			want: `{"data":{"transfer":null}}`,
+		},
+		{
+			name: "fragments",
+			req:  Request{Query: `{ transfer(id: 1) { ...F ... on Transfer { id } ...F } } fragment F on Transfer { name }`},
+			want: `{"data":{"transfer":{"name":"one","id":1}}}`,
+		},
+		{
+			name: "variables override defaults and resolve inside values",
+			req: Request{
+				Query:     `query($id: Int = 2, $tag: String = "x") { transfer(id: $id) { name } echo(list: [$tag], object: {tag: $tag}) { list object { tag } } }`,
+				Variables: map[string]interface{}{"id": 1.0},
+			},
+			want: `{"data":{"transfer":{"name":"one"},"echo":{"list":["x"],"object":{"tag":"x"}}}}`,
+		},
+		{
+			name: "mutation",
+			req:  Request{Query: `mutation { pause(ids: "a") }`},
+			want: `{"data":{"pause":["a"]}}`,
+		},
+		{
+			name: "operation by name",
+			req:  Request{Query: `query A { transfer(id: 1) { id } } query B { transfer(id: 2) { id } }`, OperationName: "B"},
+			want: `{"data":{"transfer":{"id":2}}}`,
+		},
+		{
+			name: "field errors keep the other fields",
+			req:  Request{Query: `{ broken missing transfer(id: 1) { id nope secret private } }`},
+			want: `{"data":{"broken":null,"missing":null,"transfer":{"id":1,"nope":null,"secret":null,"private":null}},"errors":[` +
+				`{"message":"resolver failed","path":["broken"]},` +
+				`{"message":"unknown field \"missing\" on query","path":["missing"]},` +
+				`{"message":"unknown field \"nope\" on testTransfer","path":["transfer","nope"]},` +
+				`{"message":"unknown field \"secret\" on testTransfer","path":["transfer","secret"]},` +
+				`{"message":"unknown field \"private\" on testTransfer","path":["transfer","private"]}]}`,
+		},
+		{
+			name: "selections must match the type",
+			req:  Request{Query: `{ transfer(id: 1) { id { x } files } }`},
+			want: `{"data":{"transfer":{"id":null,"files":[null]}},"errors":[` +
+				`{"message":"field \"id\" must not have a selection since it is a scalar","path":["transfer","id"]},` +
+				`{"message":"field \"files\" of type testFile must have a selection of subfields","path":["transfer","files",0]}]}`,
+		},
+		{
+			name: "arguments of subfields",
+			req:  Request{Query: `{ transfer(id: 1) { name(x: 1) } }`},
+			want: `{"data":{"transfer":{"name":null}},"errors":[{"message":"field \"name\" does not take arguments","path":["transfer","name"]}]}`,
+		},
+		{
+			name: "bad argument",
+			req:  Request{Query: `{ transfer(id: 1.5) { id } }`},
+			want: `{"data":{"transfer":null},"errors":[{"message":"argument \"id\" must be an integer","path":["transfer"]}]}`,
+		},
+		{
+			name: "undefined variable",
+			req:  Request{Query: `{ transfer(id: $id) { id } }`},
+			want: `{"data":{"transfer":null},"errors":[{"message":"variable $id is not defined","path":["transfer"]}]}`,
+		},
+		{
+			name: "unknown fragment",
+			req:  Request{Query: `{ ...Missing }`},
+			want: `{"errors":[{"message":"unknown fragment \"Missing\""}]}`,
+		},
+		{
+			name: "syntax error",
+			req:  Request{Query: `{ transfers {`},
+			want: `{"errors":[{"message":"syntax error: unexpected end of document"}]}`,
+		},
+		{
+			name: "subscriptions are streamed",
+			req:  Request{Query: `subscription { ticks { name } }`},
+			want: `{"errors":[{"message":"subscription operations must be sent as a stream"}]}`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := execute(t, tt.req); got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecuteRecursiveFragment(t *testing.T) {
+	// A fragment spreading itself is expanded once instead of forever
+	got := execute(t, Request{Query: `{ transfer(id: 1) { ...F } } fragment F on Transfer { id ...F }`})
+	if want := `{"data":{"transfer":{"id":1}}}`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	responses, err := testSchema().Subscribe(ctx, Request{Query: `subscription { tick: ticks(count: 3) { name } }`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for response := range responses {
+		data, err := json.Marshal(response)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, string(data))
+	}
+	if len(got) != 3 {
+		t.Fatalf("got %d responses, want 3", len(got))
+	}
+	if want := `{"data":{"tick":{"name":"tick"}}}`; got[0] != want {
+		t.Errorf("got %s, want %s", got[0], want)
+	}
+}
+
+func TestSubscribeErrors(t *testing.T) {
+	for _, query := range []string{
+		`{ transfers { id } }`,
+		`subscription { ticks { name } __typename }`,
+		`subscription { missing }`,
+		`subscription { ticks(count: "x") { name } }`,
+	} {
+		if _, err := testSchema().Subscribe(context.Background(), Request{Query: query}); err == nil {
+			t.Errorf("Subscribe(%q) succeeded", query)
+		}
+	}
+}
+
+func TestSubscribeCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	responses, err := testSchema().Subscribe(ctx, Request{Query: `subscription { ticks(count: 1000) { name } }`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-responses
+	cancel()
+
+	// The channel is closed once the source ends after the cancellation
+	done := make(chan struct{})
+	go func() {
+		for range responses {
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("responses were not closed after cancelling")
+	}
+}
@@ -0,0 +1,672 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MaxDepth is how deeply selection sets, list and object values and types
+// may be nested. The parser recurses for each level, so without a limit a
+// document of a few megabytes of braces would overflow the stack.
+const MaxDepth = 64
+
+// Operation types
+const (
+	OperationQuery        = "query"
+	OperationMutation     = "mutation"
+	OperationSubscription = "subscription"
+)
+
+// Document is a parsed GraphQL request document
+type Document struct {
+	Operations []*Operation
+	Fragments  map[string]*Fragment
+}
+
+// Operation is a single query, mutation or subscription
+type Operation struct {
+	Type         string
+	Name         string
+	Variables    map[string]interface{} // default values of declared variables
+	SelectionSet []Selection
+}
+
+// Fragment is a named fragment definition
+type Fragment struct {
+	Name         string
+	SelectionSet []Selection
+}
+
+// Selection is a field, a fragment spread or an inline fragment
+type Selection struct {
+	Field          *Field
+	FragmentSpread string
+	InlineFragment []Selection
+}
+
+// Field is a selected field with its arguments and sub-selections
+type Field struct {
+	Alias        string
+	Name         string
+	Arguments    map[string]Value
+	SelectionSet []Selection
+}
+
+// ResponseKey returns the key the field is reported under
+func (f *Field) ResponseKey() string {
+	if f.Alias != "" {
+		return f.Alias
+	}
+	return f.Name
+}
+
+// Value is an argument value. Variables are resolved at execution time.
+type Value interface{}
+
+// Variable references an operation variable inside a value
+type Variable string
+
+// Operation returns the operation to execute. The name may be empty if the
+// document contains a single operation.
+func (d *Document) Operation(name string) (*Operation, error) {
+	if name == "" {
+		if len(d.Operations) != 1 {
+			return nil, fmt.Errorf("operation name is required when the document contains %d operations", len(d.Operations))
+		}
+		return d.Operations[0], nil
+	}
+	for _, op := range d.Operations {
+		if op.Name == name {
+			return op, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown operation %q", name)
+}
+
+// Parse parses a GraphQL request document
+func Parse(source string) (*Document, error) {
+	p := &parser{lexer: newLexer(source)}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	doc := &Document{Fragments: make(map[string]*Fragment)}
+	for p.tok.kind != tokenEOF {
+		switch {
+		case p.tok.is(tokenPunct, "{"):
+			selections, err := p.parseSelectionSet()
+			if err != nil {
+				return nil, err
+			}
+			doc.Operations = append(doc.Operations, &Operation{Type: OperationQuery, SelectionSet: selections})
+		case p.tok.is(tokenName, "fragment"):
+			fragment, err := p.parseFragment()
+			if err != nil {
+				return nil, err
+			}
+			doc.Fragments[fragment.Name] = fragment
+		case p.tok.kind == tokenName:
+			op, err := p.parseOperation()
+			if err != nil {
+				return nil, err
+			}
+			doc.Operations = append(doc.Operations, op)
+		default:
+			return nil, p.unexpected()
+		}
+	}
+
+	if len(doc.Operations) == 0 {
+		return nil, fmt.Errorf("document does not contain an operation")
+	}
+	return doc, nil
+}
+
+// parser is a recursive descent parser for executable GraphQL documents
+type parser struct {
+	lexer *lexer
+	tok   token
+	depth int // levels of nesting entered
+}
+
+// advance reads the next token
+func (p *parser) advance() error {
+	tok, err := p.lexer.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+// expect consumes a punctuator or fails
+func (p *parser) expect(punct string) error {
+	if !p.tok.is(tokenPunct, punct) {
+		return p.unexpected()
+	}
+	return p.advance()
+}
+
+// name consumes a name token and returns it
+func (p *parser) name() (string, error) {
+	if p.tok.kind != tokenName {
+		return "", p.unexpected()
+	}
+	name := p.tok.value
+	return name, p.advance()
+}
+
+// enter descends one level of nesting, failing beyond MaxDepth. Each call
+// must be followed by leave.
+func (p *parser) enter() error {
+	p.depth++
+	if p.depth > MaxDepth {
+		return fmt.Errorf("syntax error at position %d: document is nested deeper than %d levels", p.tok.pos, MaxDepth)
+	}
+	return nil
+}
+
+// leave returns from a level of nesting
+func (p *parser) leave() {
+	p.depth--
+}
+
+// unexpected reports the current token as a syntax error
+func (p *parser) unexpected() error {
+	if p.tok.kind == tokenEOF {
+		return fmt.Errorf("syntax error: unexpected end of document")
+	}
+	return fmt.Errorf("syntax error at position %d: unexpected %q", p.tok.pos, p.tok.value)
+}
+
+// parseOperation parses an operation definition with an explicit type
+func (p *parser) parseOperation() (*Operation, error) {
+	opType := p.tok.value
+	if opType != OperationQuery && opType != OperationMutation && opType != OperationSubscription {
+		return nil, p.unexpected()
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	op := &Operation{Type: opType, Variables: make(map[string]interface{})}
+	if p.tok.kind == tokenName {
+		op.Name = p.tok.value
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.tok.is(tokenPunct, "(") {
+		if err := p.parseVariableDefinitions(op); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.rejectDirectives(); err != nil {
+		return nil, err
+	}
+
+	selections, err := p.parseSelectionSet()
+	if err != nil {
+		return nil, err
+	}
+	op.SelectionSet = selections
+	return op, nil
+}
+
+// parseVariableDefinitions parses ($name: Type = default, ...). Types are not
+// checked, only default values are kept.
+func (p *parser) parseVariableDefinitions(op *Operation) error {
+	if err := p.expect("("); err != nil {
+		return err
+	}
+	for !p.tok.is(tokenPunct, ")") {
+		if err := p.expect("$"); err != nil {
+			return err
+		}
+		name, err := p.name()
+		if err != nil {
+			return err
+		}
+		if err := p.expect(":"); err != nil {
+			return err
+		}
+		if err := p.skipType(); err != nil {
+			return err
+		}
+		if p.tok.is(tokenPunct, "=") {
+			if err := p.advance(); err != nil {
+				return err
+			}
+			value, err := p.parseValue()
+			if err != nil {
+				return err
+			}
+			op.Variables[name] = value
+		}
+	}
+	return p.advance()
+}
+
+// skipType skips a type reference such as [String!]!
+func (p *parser) skipType() error {
+	if err := p.enter(); err != nil {
+		return err
+	}
+	defer p.leave()
+
+	if p.tok.is(tokenPunct, "[") {
+		if err := p.advance(); err != nil {
+			return err
+		}
+		if err := p.skipType(); err != nil {
+			return err
+		}
+		if err := p.expect("]"); err != nil {
+			return err
+		}
+	} else if _, err := p.name(); err != nil {
+		return err
+	}
+	if p.tok.is(tokenPunct, "!") {
+		return p.advance()
+	}
+	return nil
+}
+
+// rejectDirectives fails on directives, which are not supported
+func (p *parser) rejectDirectives() error {
+	if p.tok.is(tokenPunct, "@") {
+		return fmt.Errorf("syntax error at position %d: directives are not supported", p.tok.pos)
+	}
+	return nil
+}
+
+// parseFragment parses a named fragment definition
+func (p *parser) parseFragment() (*Fragment, error) {
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if !p.tok.is(tokenName, "on") {
+		return nil, p.unexpected()
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	if _, err := p.name(); err != nil {
+		return nil, err
+	}
+	if err := p.rejectDirectives(); err != nil {
+		return nil, err
+	}
+	selections, err := p.parseSelectionSet()
+	if err != nil {
+		return nil, err
+	}
+	return &Fragment{Name: name, SelectionSet: selections}, nil
+}
+
+// parseSelectionSet parses { selection ... }
+func (p *parser) parseSelectionSet() ([]Selection, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+
+	var selections []Selection
+	for !p.tok.is(tokenPunct, "}") {
+		selection, err := p.parseSelection()
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, selection)
+	}
+	if len(selections) == 0 {
+		return nil, fmt.Errorf("syntax error at position %d: empty selection set", p.tok.pos)
+	}
+	return selections, p.advance()
+}
+
+// parseSelection parses a field or fragment
+func (p *parser) parseSelection() (Selection, error) {
+	if p.tok.is(tokenPunct, "...") {
+		if err := p.advance(); err != nil {
+			return Selection{}, err
+		}
+
+		// Inline fragment, optionally with a type condition
+		if p.tok.is(tokenName, "on") || p.tok.is(tokenPunct, "{") {
+			if p.tok.is(tokenName, "on") {
+				if err := p.advance(); err != nil {
+					return Selection{}, err
+				}
+				if _, err := p.name(); err != nil {
+					return Selection{}, err
+				}
+			}
+			if err := p.rejectDirectives(); err != nil {
+				return Selection{}, err
+			}
+			selections, err := p.parseSelectionSet()
+			return Selection{InlineFragment: selections}, err
+		}
+
+		name, err := p.name()
+		if err != nil {
+			return Selection{}, err
+		}
+		return Selection{FragmentSpread: name}, p.rejectDirectives()
+	}
+
+	field, err := p.parseField()
+	return Selection{Field: field}, err
+}
+
+// parseField parses alias: name(arguments) { selections }
+func (p *parser) parseField() (*Field, error) {
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+
+	field := &Field{Name: name}
+	if p.tok.is(tokenPunct, ":") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		field.Alias = name
+		if field.Name, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.tok.is(tokenPunct, "(") {
+		if field.Arguments, err = p.parseArguments(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.rejectDirectives(); err != nil {
+		return nil, err
+	}
+
+	if p.tok.is(tokenPunct, "{") {
+		if field.SelectionSet, err = p.parseSelectionSet(); err != nil {
+			return nil, err
+		}
+	}
+	return field, nil
+}
+
+// parseArguments parses (name: value, ...)
+func (p *parser) parseArguments() (map[string]Value, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	args := make(map[string]Value)
+	for !p.tok.is(tokenPunct, ")") {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		if args[name], err = p.parseValue(); err != nil {
+			return nil, err
+		}
+	}
+	return args, p.advance()
+}
+
+// parseValue parses a literal value or variable reference
+func (p *parser) parseValue() (Value, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+
+	tok := p.tok
+	switch {
+	case tok.is(tokenPunct, "$"):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		return Variable(name), err
+
+	case tok.is(tokenPunct, "["):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		list := []Value{}
+		for !p.tok.is(tokenPunct, "]") {
+			value, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		return list, p.advance()
+
+	case tok.is(tokenPunct, "{"):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		object := make(map[string]Value)
+		for !p.tok.is(tokenPunct, "}") {
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			if object[name], err = p.parseValue(); err != nil {
+				return nil, err
+			}
+		}
+		return object, p.advance()
+
+	case tok.kind == tokenInt:
+		value, err := strconv.ParseInt(tok.value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer %q", tok.value)
+		}
+		return value, p.advance()
+
+	case tok.kind == tokenFloat:
+		value, err := strconv.ParseFloat(tok.value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", tok.value)
+		}
+		return value, p.advance()
+
+	case tok.kind == tokenString:
+		return tok.value, p.advance()
+
+	case tok.kind == tokenName:
+		// Booleans, null and enum values
+		var value Value
+		switch tok.value {
+		case "true":
+			value = true
+		case "false":
+			value = false
+		case "null":
+			value = nil
+		default:
+			value = tok.value
+		}
+		return value, p.advance()
+	}
+	return nil, p.unexpected()
+}
+
+// Token kinds
+const (
+	tokenEOF = iota
+	tokenPunct
+	tokenName
+	tokenInt
+	tokenFloat
+	tokenString
+)
+
+// token is a lexical token of a GraphQL document
+type token struct {
+	kind  int
+	value string
+	pos   int
+}
+
+// is reports whether the token has the given kind and value
+func (t token) is(kind int, value string) bool {
+	return t.kind == kind && t.value == value
+}
+
+// lexer splits a GraphQL document into tokens
+type lexer struct {
+	src string
+	pos int
+}
+
+// newLexer creates a lexer for a document
+func newLexer(src string) *lexer {
+	return &lexer{src: src}
+}
+
+// next returns the next token, skipping whitespace, commas and comments
+func (l *lexer) next() (token, error) {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',' {
+			l.pos++
+			continue
+		}
+		if c == '#' {
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+			continue
+		}
+		break
+	}
+	if l.pos >= len(l.src) {
+		return token{kind: tokenEOF, pos: l.pos}, nil
+	}
+
+	start := l.pos
+	c := l.src[l.pos]
+	switch {
+	case strings.HasPrefix(l.src[l.pos:], "..."):
+		l.pos += 3
+		return token{kind: tokenPunct, value: "...", pos: start}, nil
+	case strings.ContainsRune("!$():=@[]{}|", rune(c)):
+		l.pos++
+		return token{kind: tokenPunct, value: string(c), pos: start}, nil
+	case c == '_' || isLetter(c):
+		for l.pos < len(l.src) && (l.src[l.pos] == '_' || isLetter(l.src[l.pos]) || isDigit(l.src[l.pos])) {
+			l.pos++
+		}
+		return token{kind: tokenName, value: l.src[start:l.pos], pos: start}, nil
+	case c == '-' || isDigit(c):
+		return l.number()
+	case c == '"':
+		return l.string()
+	}
+	return token{}, fmt.Errorf("syntax error at position %d: unexpected character %q", start, c)
+}
+
+// number lexes an integer or float
+func (l *lexer) number() (token, error) {
+	start := l.pos
+	kind := tokenInt
+	if l.src[l.pos] == '-' {
+		l.pos++
+	}
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case isDigit(c):
+		case c == '.' || c == 'e' || c == 'E':
+			kind = tokenFloat
+		case (c == '+' || c == '-') && kind == tokenFloat:
+		default:
+			return token{kind: kind, value: l.src[start:l.pos], pos: start}, nil
+		}
+		l.pos++
+	}
+	return token{kind: kind, value: l.src[start:l.pos], pos: start}, nil
+}
+
+// string lexes a quoted string with escape sequences
+func (l *lexer) string() (token, error) {
+	start := l.pos
+	l.pos++ // opening quote
+
+	var sb strings.Builder
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch c {
+		case '"':
+			l.pos++
+			return token{kind: tokenString, value: sb.String(), pos: start}, nil
+		case '\n':
+			return token{}, fmt.Errorf("syntax error at position %d: unterminated string", start)
+		case '\\':
+			if l.pos+1 >= len(l.src) {
+				return token{}, fmt.Errorf("syntax error at position %d: unterminated string", start)
+			}
+			l.pos++
+			switch esc := l.src[l.pos]; esc {
+			case '"', '\\', '/':
+				sb.WriteByte(esc)
+			case 'b':
+				sb.WriteByte('\b')
+			case 'f':
+				sb.WriteByte('\f')
+			case 'n':
+				sb.WriteByte('\n')
+			case 'r':
+				sb.WriteByte('\r')
+			case 't':
+				sb.WriteByte('\t')
+			case 'u':
+				if l.pos+4 >= len(l.src) {
+					return token{}, fmt.Errorf("syntax error at position %d: invalid unicode escape", l.pos)
+				}
+				code, err := strconv.ParseUint(l.src[l.pos+1:l.pos+5], 16, 32)
+				if err != nil {
+					return token{}, fmt.Errorf("syntax error at position %d: invalid unicode escape", l.pos)
+				}
+				sb.WriteRune(rune(code))
+				l.pos += 4
+			default:
+				return token{}, fmt.Errorf("syntax error at position %d: invalid escape sequence", l.pos)
+			}
+		default:
+			sb.WriteByte(c)
+		}
+		l.pos++
+	}
+	return token{}, fmt.Errorf("syntax error at position %d: unterminated string", start)
+}
+
+// isLetter reports whether c is an ASCII letter
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// isDigit reports whether c is an ASCII digit
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
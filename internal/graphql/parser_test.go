@@ -0,0 +1,161 @@
+package graphql
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseOperations(t *testing.T) {
+	doc, err := Parse(`
+		# shorthand query
+		{ stats { activeDownloads } }
+		query Named($id: Int! = 7, $types: [String!]) { transfer(id: $id) { id } }
+		mutation Pause { pause(id: 1) }
+		subscription { events { type } }
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var types, names []string
+	for _, op := range doc.Operations {
+		types = append(types, op.Type)
+		names = append(names, op.Name)
+	}
+	if want := []string{OperationQuery, OperationQuery, OperationMutation, OperationSubscription}; !reflect.DeepEqual(types, want) {
+		t.Errorf("types = %v, want %v", types, want)
+	}
+	if want := []string{"", "Named", "Pause", ""}; !reflect.DeepEqual(names, want) {
+		t.Errorf("names = %v, want %v", names, want)
+	}
+
+	named, err := doc.Operation("Named")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]interface{}{"id": int64(7)}; !reflect.DeepEqual(named.Variables, want) {
+		t.Errorf("variables = %v, want %v", named.Variables, want)
+	}
+	if _, err := doc.Operation(""); err == nil {
+		t.Error("Operation(\"\") of a document with four operations succeeded")
+	}
+	if _, err := doc.Operation("Missing"); err == nil {
+		t.Error("Operation(\"Missing\") succeeded")
+	}
+}
+
+func TestParseField(t *testing.T) {
+	doc, err := Parse(`{ latest: history(limit: 5, types: ["transfer.added", "transfer.completed"], negative: -2,
+		ratio: 1.5e3, on: true, off: false, none: null, order: DESC, filter: {name: "a\"b\u00e9", ids: [1 2]}, ref: $v) {
+		type
+	} }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	field := doc.Operations[0].SelectionSet[0].Field
+	if field.Alias != "latest" || field.Name != "history" || field.ResponseKey() != "latest" {
+		t.Errorf("alias, name = %q, %q", field.Alias, field.Name)
+	}
+	want := map[string]Value{
+		"limit":    int64(5),
+		"types":    []Value{"transfer.added", "transfer.completed"},
+		"negative": int64(-2),
+		"ratio":    1500.0,
+		"on":       true,
+		"off":      false,
+		"none":     nil,
+		"order":    "DESC",
+		"filter":   map[string]Value{"name": "a\"bé", "ids": []Value{int64(1), int64(2)}},
+		"ref":      Variable("v"),
+	}
+	if !reflect.DeepEqual(field.Arguments, want) {
+		t.Errorf("arguments = %#v, want %#v", field.Arguments, want)
+	}
+	if len(field.SelectionSet) != 1 || field.SelectionSet[0].Field.Name != "type" {
+		t.Errorf("selection set = %+v", field.SelectionSet)
+	}
+}
+
+func TestParseFragments(t *testing.T) {
+	doc, err := Parse(`
+		{ transfers { ...Basic ... on Transfer { size } ... { paused } } }
+		fragment Basic on Transfer { id name }
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	selections := doc.Operations[0].SelectionSet[0].Field.SelectionSet
+	if len(selections) != 3 {
+		t.Fatalf("got %d selections, want 3", len(selections))
+	}
+	if selections[0].FragmentSpread != "Basic" {
+		t.Errorf("spread = %q, want Basic", selections[0].FragmentSpread)
+	}
+	if f := selections[1].InlineFragment; len(f) != 1 || f[0].Field.Name != "size" {
+		t.Errorf("inline fragment = %+v", f)
+	}
+	if f := selections[2].InlineFragment; len(f) != 1 || f[0].Field.Name != "paused" {
+		t.Errorf("inline fragment without type = %+v", f)
+	}
+	if fragment := doc.Fragments["Basic"]; fragment == nil || len(fragment.SelectionSet) != 2 {
+		t.Errorf("fragment = %+v", fragment)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, source := range []string{
+		"",
+		"fragment A on T { id }",
+		"{ }",
+		"{ id",
+		"{ id(x: ) }",
+		"{ id @skip(if: true) }",
+		"query @dir { id }",
+		"{ id(x: \"unterminated) }",
+		"{ id(x: \"bad \\q escape\") }",
+		"{ id(x: \"\\u12\") }",
+		"{ id(x: 99999999999999999999) }",
+		"{ id % }",
+		"query($a Int) { id }",
+		"fragment A T { id }",
+	} {
+		if _, err := Parse(source); err == nil {
+			t.Errorf("Parse(%q) succeeded", source)
+		}
+	}
+}
+
+func TestParseDepth(t *testing.T) {
+	nested := func(open, close string, levels int) string {
+		return strings.Repeat(open, levels) + strings.Repeat(close, levels)
+	}
+
+	// Selection sets count one level each, the value inside a field one more
+	for _, tt := range []struct {
+		name   string
+		source string
+		ok     bool
+	}{
+		{"selections at the limit", nested("{a", "}", MaxDepth), true},
+		{"selections beyond the limit", nested("{a", "}", MaxDepth+1), false},
+		{"lists at the limit", "{a(x: " + nested("[", "]", MaxDepth-1) + ")}", true},
+		{"lists beyond the limit", "{a(x: " + nested("[", "]", MaxDepth) + ")}", false},
+		{"objects beyond the limit", "{a(x: " + nested("{a:", "}", MaxDepth) + "1)}", false},
+		{"types beyond the limit", "query($a: " + nested("[", "]", MaxDepth+1) + ") {a}", false},
+		{"unterminated selections far beyond the limit", strings.Repeat("{a", 2_000_000), false},
+		{"unterminated lists far beyond the limit", "{a(x: " + strings.Repeat("[", 2_000_000), false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.source)
+			if tt.ok && err != nil {
+				t.Errorf("Parse failed: %v", err)
+			}
+			if !tt.ok && (err == nil || !strings.Contains(err.Error(), "nested deeper")) {
+				t.Errorf("Parse error = %v, want nesting error", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,261 @@
+// Package i18n translates the dashboard. It negotiates the language of a
+// request and merges the built-in translations with those contributed
+// through the API, falling back to English for missing messages.
+package i18n
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/elsbrock/plundrio/internal/log"
+	"github.com/elsbrock/plundrio/internal/state"
+)
+
+// State is the name of the state document holding contributed translations
+const State = "translations"
+
+// Default is the language used when none of the requested ones is available
+const Default = "en"
+
+// languageCode matches language tags such as de or pt-BR
+var languageCode = regexp.MustCompile(`^[a-z]{2,3}(-[A-Za-z0-9]{2,8})?$`)
+
+// placeholder matches the parameters of a message, such as {count}
+var placeholder = regexp.MustCompile(`\{[a-zA-Z]+\}`)
+
+// Language describes an available language and how much of it is translated
+type Language struct {
+	Code        string `json:"code"`
+	Name        string `json:"name"`
+	Translated  int    `json:"translated"`  // messages translated, the rest falls back to English
+	Total       int    `json:"total"`       // messages there are
+	Contributed bool   `json:"contributed"` // messages were contributed through the API
+}
+
+// Catalog holds the built-in and contributed translations
+type Catalog struct {
+	mu          sync.RWMutex
+	store       *state.Store // nil without a state directory
+	contributed map[string]map[string]string
+}
+
+// New loads the translations contributed in earlier runs from the state directory
+func New(stateDir string) *Catalog {
+	c := &Catalog{contributed: make(map[string]map[string]string)}
+	if stateDir == "" {
+		return c
+	}
+
+	store, err := state.New(stateDir)
+	if err != nil {
+		log.Warn("i18n").Err(err).Msg("Contributed translations will not be remembered")
+		return c
+	}
+	c.store = store
+	if err := store.Load(State, &c.contributed); err != nil {
+		log.Warn("i18n").Err(err).Msg("Failed to load contributed translations")
+	}
+	if c.contributed == nil {
+		c.contributed = make(map[string]map[string]string)
+	}
+	return c
+}
+
+// translation returns the messages of a language without fallback. c.mu must be held.
+func (c *Catalog) translation(lang string) map[string]string {
+	messages := make(map[string]string)
+	maps.Copy(messages, builtin[lang])
+	maps.Copy(messages, c.contributed[lang])
+	return messages
+}
+
+// Languages lists the available languages, English first
+func (c *Catalog) Languages() []Language {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	codes := make(map[string]bool)
+	for code := range builtin {
+		codes[code] = true
+	}
+	for code := range c.contributed {
+		codes[code] = true
+	}
+
+	total := len(builtin[Default])
+	languages := make([]Language, 0, len(codes))
+	for code := range codes {
+		messages := c.translation(code)
+		name := messages["language"]
+		if name == "" {
+			name = code
+		}
+		languages = append(languages, Language{
+			Code:        code,
+			Name:        name,
+			Translated:  len(messages),
+			Total:       total,
+			Contributed: len(c.contributed[code]) > 0,
+		})
+	}
+	sort.Slice(languages, func(i, j int) bool {
+		if (languages[i].Code == Default) != (languages[j].Code == Default) {
+			return languages[i].Code == Default
+		}
+		return languages[i].Code < languages[j].Code
+	})
+	return languages
+}
+
+// Available reports whether there are messages in a language
+func (c *Catalog) Available(lang string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return builtin[lang] != nil || c.contributed[lang] != nil
+}
+
+// Messages returns all messages in a language, in English where they are not
+// translated, and the keys of those that are not
+func (c *Catalog) Messages(lang string) (map[string]string, []string) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	messages := make(map[string]string, len(builtin[Default]))
+	maps.Copy(messages, builtin[Default])
+	translated := c.translation(lang)
+	var missing []string
+	for key := range builtin[Default] {
+		if text, ok := translated[key]; ok {
+			messages[key] = text
+		} else {
+			missing = append(missing, key)
+		}
+	}
+	sort.Strings(missing)
+	return messages, missing
+}
+
+// Negotiate picks the available language a client prefers most from an
+// Accept-Language header, matching de-AT to de if there is no de-AT
+func (c *Catalog) Negotiate(acceptLanguage string) string {
+	type preference struct {
+		code    string
+		quality float64
+	}
+	var prefs []preference
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		code, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		quality := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil {
+				quality = v
+			}
+		}
+		if code != "" && code != "*" && quality > 0 {
+			prefs = append(prefs, preference{code: code, quality: quality})
+		}
+	}
+	sort.SliceStable(prefs, func(i, j int) bool { return prefs[i].quality > prefs[j].quality })
+
+	for _, pref := range prefs {
+		if lang := c.Match(pref.code); lang != "" {
+			return lang
+		}
+	}
+	return Default
+}
+
+// Match returns the available language for a language tag, trying its
+// primary language if the tag itself is not available, or an empty string
+func (c *Catalog) Match(code string) string {
+	primary, region, hasRegion := strings.Cut(code, "-")
+	primary = strings.ToLower(primary)
+	if hasRegion {
+		if lang := primary + "-" + strings.ToUpper(region); c.Available(lang) {
+			return lang
+		}
+	}
+	if c.Available(primary) {
+		return primary
+	}
+	return ""
+}
+
+// Contribute adds or corrects messages of a language. Keys must be known
+// English messages and translations must use the same placeholders.
+// Messages not contributed keep their current translation.
+func (c *Catalog) Contribute(lang string, messages map[string]string) error {
+	if !languageCode.MatchString(lang) {
+		return fmt.Errorf("invalid language code %q, use a tag such as de or pt-BR", lang)
+	}
+	if len(messages) == 0 {
+		return fmt.Errorf("no messages")
+	}
+	for key, text := range messages {
+		english, ok := builtin[Default][key]
+		if !ok {
+			return fmt.Errorf("unknown message %q", key)
+		}
+		if strings.TrimSpace(text) == "" {
+			return fmt.Errorf("message %q is empty", key)
+		}
+		if !samePlaceholders(english, text) {
+			return fmt.Errorf("message %q must use the placeholders %s", key, strings.Join(placeholders(english), " "))
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.contributed[lang] == nil {
+		c.contributed[lang] = make(map[string]string)
+	}
+	maps.Copy(c.contributed[lang], messages)
+	c.save()
+
+	log.Info("i18n").
+		Str("lang", lang).
+		Int("messages", len(messages)).
+		Msg("Translation contributed")
+	return nil
+}
+
+// Remove drops the contributed messages of a language, leaving its built-in
+// translation if there is one, and reports whether there were any
+func (c *Catalog) Remove(lang string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.contributed[lang]; !ok {
+		return false
+	}
+	delete(c.contributed, lang)
+	c.save()
+	return true
+}
+
+// save writes the contributed translations to the state directory. c.mu must be held.
+func (c *Catalog) save() {
+	if c.store == nil {
+		return
+	}
+	if err := c.store.Save(State, c.contributed); err != nil {
+		log.Warn("i18n").Err(err).Msg("Failed to save contributed translations")
+	}
+}
+
+// placeholders returns the distinct placeholders of a message, sorted
+func placeholders(text string) []string {
+	found := placeholder.FindAllString(text, -1)
+	sort.Strings(found)
+	return slices.Compact(found)
+}
+
+// samePlaceholders reports whether a translation uses the placeholders of the original
+func samePlaceholders(original, translation string) bool {
+	return slices.Equal(placeholders(original), placeholders(translation))
+}
@@ -0,0 +1,279 @@
+package i18n
+
+// builtin holds the translations shipped with plundrio. English is complete
+// and defines the keys and placeholders every other language has to use.
+var builtin = map[string]map[string]string{
+	"en": {
+		"language":             "English",
+		"title":                "Plundrio Dashboard",
+		"allUsers":             "All users",
+		"enableNotifications":  "Enable notifications",
+		"disableNotifications": "Disable notifications",
+		"notificationsFailed":  "Failed to enable notifications: {error}",
+		"addURL":               "Add URL",
+		"redownloadFile":       "Re-download file",
+		"scan":                 "Scan put.io",
+		"unthrottle":           "Unthrottle 30 min",
+		"unthrottledUntil":     "Unthrottled until {time}",
+		"activeDownloads":      "active downloads",
+		"queueSpeed":           "Speed {speed}",
+		"queueSize":            "Queued {size} in {count} transfers",
+		"queueETA":             "Done in {eta}",
+		"authRejected":         "put.io rejected the token. Get a new one with",
+		"replaceToken":         "Replace token",
+		"retryBackoff":         "Too many downloads failed, retries are backing off until {time}",
+		"providers":            "Providers: {order}",
+		"routes":               "Routes: {routes}",
+		"routeCategory":        "category {category}",
+		"routeAnd":             "and",
+		"noDownloads":          "No active downloads",
+		"changeLocation":       "Change location",
+		"editNotes":            "Edit notes",
+		"addNotes":             "Add notes",
+		"requestedBy":          "requested by {user}",
+		"scheduledUntil":       "Scheduled, starts at {time}",
+		"waitingForSpace":      "Waiting for disk space",
+		"progress":             "put.io {cloud}% · local {local}%",
+		"eta":                  "ETA: {eta}",
+		"calculating":          "calculating...",
+		"promptLocation":       "Move download to directory:",
+		"promptNotes":          "Notes for this transfer:",
+		"promptURL":            "Magnet link or HTTP/FTP URL for put.io to fetch:",
+		"promptRedownload":     "Local path of the file to delete and download again:",
+		"promptToken":          "New put.io token:",
+		"actions":              "Actions",
+		"languageLabel":        "Language",
+		"refreshLabel":         "Refresh interval",
+		"refreshEvery":         "Every {seconds} s",
+		"refreshOff":           "No auto-refresh",
+		"throughputLabel":      "Download speed history",
+		"throughputRange":      "Time range",
+		"throughputSummary":    "Peak {peak} · {size} downloaded",
+		"range15m":             "Last 15 minutes",
+		"range2d":              "Last 2 days",
+		"range1w":              "Last week",
+		"range90d":             "Last 90 days",
+		"userFilter":           "Filter by user",
+		"queue":                "Queue",
+		"downloads":            "Downloads",
+		"history":              "History",
+		"historyOutcome":       "Filter by outcome",
+		"allOutcomes":          "All outcomes",
+		"outcomeCompleted":     "Completed",
+		"outcomeFailed":        "Failed",
+		"outcomeCancelled":     "Cancelled",
+		"historySearch":        "Search by name",
+		"noHistory":            "No finished downloads",
+		"historyStats":         "{size} in {duration} · {speed}",
+		"historyPage":          "{from}–{to} of {total}",
+		"previousPage":         "Previous",
+		"nextPage":             "Next",
+		"failures":             "Failed files",
+		"noFailures":           "No failed files",
+		"failureAttempts":      "failed {attempts}×",
+		"retryFailed":          "Retry failed",
+		"retryFile":            "Retry",
+		"retrying":             "Downloading again",
+		"failuresRetried":      "{files} files queued again",
+		"progressLabel":        "Download progress",
+		"pause":                "Pause",
+		"resume":               "Resume",
+		"cancel":               "Cancel",
+		"queuePosition":        "#{position} in queue",
+		"moveUp":               "Move up",
+		"moveDown":             "Move down",
+		"confirmCancel":        "Cancel {name} and remove it from put.io?",
+		"paused":               "Paused {name}",
+		"resumed":              "Resumed {name}",
+		"cancelled":            "Cancelled {name}",
+		"shortcuts":            "Keyboard shortcuts",
+		"shortcutAdd":          "Add a URL",
+		"shortcutMove":         "Next / previous download",
+		"shortcutPause":        "Pause or resume the selected download",
+		"shortcutCancel":       "Cancel the selected download",
+		"shortcutHelp":         "Show this help",
+		"close":                "Close",
+	},
+	"de": {
+		"language":             "Deutsch",
+		"title":                "Plundrio-Dashboard",
+		"allUsers":             "Alle Benutzer",
+		"enableNotifications":  "Benachrichtigungen aktivieren",
+		"disableNotifications": "Benachrichtigungen deaktivieren",
+		"notificationsFailed":  "Benachrichtigungen konnten nicht aktiviert werden: {error}",
+		"addURL":               "URL hinzufügen",
+		"redownloadFile":       "Datei neu laden",
+		"scan":                 "put.io durchsuchen",
+		"unthrottle":           "30 Min. ungedrosselt",
+		"unthrottledUntil":     "Ungedrosselt bis {time}",
+		"activeDownloads":      "aktive Downloads",
+		"queueSpeed":           "Geschwindigkeit {speed}",
+		"queueSize":            "{size} in {count} Transfers ausstehend",
+		"queueETA":             "Fertig in {eta}",
+		"authRejected":         "put.io hat den Token abgelehnt. Einen neuen gibt es mit",
+		"replaceToken":         "Token ersetzen",
+		"retryBackoff":         "Zu viele Downloads fehlgeschlagen, neue Versuche pausieren bis {time}",
+		"providers":            "Anbieter: {order}",
+		"routes":               "Regeln: {routes}",
+		"routeCategory":        "Kategorie {category}",
+		"routeAnd":             "und",
+		"noDownloads":          "Keine aktiven Downloads",
+		"changeLocation":       "Speicherort ändern",
+		"editNotes":            "Notizen bearbeiten",
+		"addNotes":             "Notizen hinzufügen",
+		"requestedBy":          "angefordert von {user}",
+		"scheduledUntil":       "Geplant, startet {time}",
+		"waitingForSpace":      "Wartet auf Speicherplatz",
+		"progress":             "put.io {cloud} % · lokal {local} %",
+		"eta":                  "Restzeit: {eta}",
+		"calculating":          "wird berechnet...",
+		"promptLocation":       "Download in dieses Verzeichnis verschieben:",
+		"promptNotes":          "Notizen zu diesem Transfer:",
+		"promptURL":            "Magnet-Link oder HTTP/FTP-URL, die put.io laden soll:",
+		"promptRedownload":     "Lokaler Pfad der Datei, die gelöscht und neu geladen werden soll:",
+		"promptToken":          "Neuer put.io-Token:",
+		"actions":              "Aktionen",
+		"languageLabel":        "Sprache",
+		"refreshLabel":         "Aktualisierungsintervall",
+		"refreshEvery":         "Alle {seconds} s",
+		"refreshOff":           "Keine automatische Aktualisierung",
+		"throughputLabel":      "Verlauf der Downloadgeschwindigkeit",
+		"throughputRange":      "Zeitraum",
+		"throughputSummary":    "Spitze {peak} · {size} geladen",
+		"range15m":             "Letzte 15 Minuten",
+		"range2d":              "Letzte 2 Tage",
+		"range1w":              "Letzte Woche",
+		"range90d":             "Letzte 90 Tage",
+		"userFilter":           "Nach Benutzer filtern",
+		"queue":                "Warteschlange",
+		"downloads":            "Downloads",
+		"history":              "Verlauf",
+		"historyOutcome":       "Nach Ergebnis filtern",
+		"allOutcomes":          "Alle Ergebnisse",
+		"outcomeCompleted":     "Abgeschlossen",
+		"outcomeFailed":        "Fehlgeschlagen",
+		"outcomeCancelled":     "Abgebrochen",
+		"historySearch":        "Nach Name suchen",
+		"noHistory":            "Keine beendeten Downloads",
+		"historyStats":         "{size} in {duration} · {speed}",
+		"historyPage":          "{from}–{to} von {total}",
+		"previousPage":         "Zurück",
+		"nextPage":             "Weiter",
+		"failures":             "Fehlgeschlagene Dateien",
+		"noFailures":           "Keine fehlgeschlagenen Dateien",
+		"failureAttempts":      "{attempts}× fehlgeschlagen",
+		"retryFailed":          "Fehlgeschlagene erneut versuchen",
+		"retryFile":            "Erneut versuchen",
+		"retrying":             "Wird erneut geladen",
+		"failuresRetried":      "{files} Dateien erneut eingereiht",
+		"progressLabel":        "Download-Fortschritt",
+		"pause":                "Anhalten",
+		"resume":               "Fortsetzen",
+		"cancel":               "Abbrechen",
+		"queuePosition":        "#{position} in der Warteschlange",
+		"moveUp":               "Nach oben",
+		"moveDown":             "Nach unten",
+		"confirmCancel":        "{name} abbrechen und von put.io entfernen?",
+		"paused":               "{name} angehalten",
+		"resumed":              "{name} fortgesetzt",
+		"cancelled":            "{name} abgebrochen",
+		"shortcuts":            "Tastenkürzel",
+		"shortcutAdd":          "URL hinzufügen",
+		"shortcutMove":         "Nächster / vorheriger Download",
+		"shortcutPause":        "Ausgewählten Download anhalten oder fortsetzen",
+		"shortcutCancel":       "Ausgewählten Download abbrechen",
+		"shortcutHelp":         "Diese Hilfe anzeigen",
+		"close":                "Schließen",
+	},
+	"fr": {
+		"language":             "Français",
+		"title":                "Tableau de bord Plundrio",
+		"allUsers":             "Tous les utilisateurs",
+		"enableNotifications":  "Activer les notifications",
+		"disableNotifications": "Désactiver les notifications",
+		"notificationsFailed":  "Impossible d'activer les notifications : {error}",
+		"addURL":               "Ajouter une URL",
+		"redownloadFile":       "Retélécharger un fichier",
+		"scan":                 "Analyser put.io",
+		"unthrottle":           "Sans limite 30 min",
+		"unthrottledUntil":     "Sans limite jusqu'à {time}",
+		"activeDownloads":      "téléchargements actifs",
+		"queueSpeed":           "Débit {speed}",
+		"queueSize":            "{size} en attente dans {count} transferts",
+		"queueETA":             "Terminé dans {eta}",
+		"authRejected":         "put.io a refusé le jeton. Obtenez-en un nouveau avec",
+		"replaceToken":         "Remplacer le jeton",
+		"retryBackoff":         "Trop de téléchargements ont échoué, nouvelles tentatives suspendues jusqu'à {time}",
+		"providers":            "Fournisseurs : {order}",
+		"routes":               "Règles : {routes}",
+		"routeCategory":        "catégorie {category}",
+		"routeAnd":             "et",
+		"noDownloads":          "Aucun téléchargement actif",
+		"changeLocation":       "Changer d'emplacement",
+		"editNotes":            "Modifier les notes",
+		"addNotes":             "Ajouter des notes",
+		"requestedBy":          "demandé par {user}",
+		"scheduledUntil":       "Planifié, démarre le {time}",
+		"waitingForSpace":      "En attente d'espace disque",
+		"progress":             "put.io {cloud} % · local {local} %",
+		"eta":                  "Temps restant : {eta}",
+		"calculating":          "calcul en cours...",
+		"promptLocation":       "Déplacer le téléchargement vers le dossier :",
+		"promptNotes":          "Notes pour ce transfert :",
+		"promptURL":            "Lien magnet ou URL HTTP/FTP que put.io doit récupérer :",
+		"promptRedownload":     "Chemin local du fichier à supprimer et retélécharger :",
+		"promptToken":          "Nouveau jeton put.io :",
+		"actions":              "Actions",
+		"languageLabel":        "Langue",
+		"refreshLabel":         "Intervalle d'actualisation",
+		"refreshEvery":         "Toutes les {seconds} s",
+		"refreshOff":           "Pas d'actualisation automatique",
+		"throughputLabel":      "Historique du débit",
+		"throughputRange":      "Période",
+		"throughputSummary":    "Pic {peak} · {size} téléchargés",
+		"range15m":             "15 dernières minutes",
+		"range2d":              "2 derniers jours",
+		"range1w":              "Dernière semaine",
+		"range90d":             "90 derniers jours",
+		"userFilter":           "Filtrer par utilisateur",
+		"queue":                "File d'attente",
+		"downloads":            "Téléchargements",
+		"history":              "Historique",
+		"historyOutcome":       "Filtrer par résultat",
+		"allOutcomes":          "Tous les résultats",
+		"outcomeCompleted":     "Terminé",
+		"outcomeFailed":        "Échoué",
+		"outcomeCancelled":     "Annulé",
+		"historySearch":        "Rechercher par nom",
+		"noHistory":            "Aucun téléchargement terminé",
+		"historyStats":         "{size} en {duration} · {speed}",
+		"historyPage":          "{from}–{to} sur {total}",
+		"previousPage":         "Précédent",
+		"nextPage":             "Suivant",
+		"failures":             "Fichiers en échec",
+		"noFailures":           "Aucun fichier en échec",
+		"failureAttempts":      "échoué {attempts}×",
+		"retryFailed":          "Réessayer les échecs",
+		"retryFile":            "Réessayer",
+		"retrying":             "Nouveau téléchargement en cours",
+		"failuresRetried":      "{files} fichiers remis en file d'attente",
+		"progressLabel":        "Progression du téléchargement",
+		"pause":                "Suspendre",
+		"resume":               "Reprendre",
+		"cancel":               "Annuler",
+		"queuePosition":        "n° {position} dans la file",
+		"moveUp":               "Monter",
+		"moveDown":             "Descendre",
+		"confirmCancel":        "Annuler {name} et le supprimer de put.io ?",
+		"paused":               "{name} suspendu",
+		"resumed":              "{name} repris",
+		"cancelled":            "{name} annulé",
+		"shortcuts":            "Raccourcis clavier",
+		"shortcutAdd":          "Ajouter une URL",
+		"shortcutMove":         "Téléchargement suivant / précédent",
+		"shortcutPause":        "Suspendre ou reprendre le téléchargement sélectionné",
+		"shortcutCancel":       "Annuler le téléchargement sélectionné",
+		"shortcutHelp":         "Afficher cette aide",
+		"close":                "Fermer",
+	},
+}
@@ -8,7 +8,16 @@ import (
 	"github.com/rs/zerolog"
 )
 
-var log zerolog.Logger
+var (
+	log zerolog.Logger
+
+	// consoleLevel is the level configured for the console output. The global
+	// level may be lower while log streams ask for more detail.
+	consoleLevel zerolog.Level
+
+	// configuredLevel is the level as it was configured
+	configuredLevel LogLevel
+)
 
 // LogLevel represents the logging level
 type LogLevel string
@@ -43,10 +52,15 @@ func configureLogger(level LogLevel) {
 		NoColor:    false, // Always use colors
 	}
 
-	log = zerolog.New(output).With().Timestamp().Logger()
+	// Only the console is filtered by the configured level, streams filter themselves
+	writer := zerolog.MultiLevelWriter(
+		&zerolog.FilteredLevelWriter{Writer: zerolog.LevelWriterAdapter{Writer: output}, Level: zerologLevel(level)},
+		hub,
+	)
+	log = zerolog.New(writer).With().Timestamp().Logger()
 
 	// Set log level
-	setLogLevel(level)
+	hub.setConsoleLevel(level)
 }
 
 // getLogLevel determines the log level from environment
@@ -57,26 +71,33 @@ func getLogLevel() LogLevel {
 	return LevelInfo
 }
 
-// setLogLevel sets the zerolog level
-func setLogLevel(level LogLevel) {
+// zerologLevel maps a log level to its zerolog level
+func zerologLevel(level LogLevel) zerolog.Level {
 	switch level {
 	case LevelDebug:
-		zerolog.SetGlobalLevel(zerolog.DebugLevel)
+		return zerolog.DebugLevel
 	case LevelInfo:
-		zerolog.SetGlobalLevel(zerolog.InfoLevel)
+		return zerolog.InfoLevel
 	case LevelWarn:
-		zerolog.SetGlobalLevel(zerolog.WarnLevel)
+		return zerolog.WarnLevel
 	case LevelError:
-		zerolog.SetGlobalLevel(zerolog.ErrorLevel)
+		return zerolog.ErrorLevel
 	case LevelFatal:
-		zerolog.SetGlobalLevel(zerolog.FatalLevel)
+		return zerolog.FatalLevel
 	case LevelNone:
-		zerolog.SetGlobalLevel(zerolog.Disabled)
+		return zerolog.Disabled
 	default:
-		zerolog.SetGlobalLevel(zerolog.InfoLevel)
+		return zerolog.InfoLevel
 	}
 }
 
+// GetLevel returns the configured log level
+func GetLevel() LogLevel {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	return configuredLevel
+}
+
 // SetLevel sets the global log level
 func SetLevel(level LogLevel) {
 	// Reconfigure the logger
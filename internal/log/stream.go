@@ -0,0 +1,226 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// streamHistorySize is how many recent entries are kept for new streams
+const streamHistorySize = 1000
+
+// streamBufferSize is how many entries a stream buffers before dropping
+const streamBufferSize = 256
+
+// Entry is a single log line as written by the logger
+type Entry struct {
+	Time      time.Time
+	Level     LogLevel
+	Component string
+	Raw       json.RawMessage // The complete line as JSON object
+	level     zerolog.Level
+}
+
+// Filter selects which entries a stream receives
+type Filter struct {
+	Level     LogLevel // Minimum level (empty means info)
+	Component string   // Only entries of this component (empty means all)
+}
+
+// matches reports whether an entry passes the filter
+func (f Filter) matches(e Entry) bool {
+	if e.level < zerologLevel(f.Level) {
+		return false
+	}
+	return f.Component == "" || f.Component == e.Component
+}
+
+// ParseLevel validates a log level name
+func ParseLevel(level string) (LogLevel, error) {
+	switch l := LogLevel(level); l {
+	case LevelDebug, LevelInfo, LevelWarn, LevelError, LevelFatal:
+		return l, nil
+	}
+	return "", fmt.Errorf("invalid log level %q (use debug, info, warn, error or fatal)", level)
+}
+
+// Stream receives log entries as they are written
+type Stream struct {
+	entries chan Entry
+	filter  Filter
+	once    sync.Once
+}
+
+// Entries returns the channel entries are delivered on
+func (s *Stream) Entries() <-chan Entry {
+	return s.entries
+}
+
+// Close stops the stream and closes its channel
+func (s *Stream) Close() {
+	s.once.Do(func() {
+		hub.mu.Lock()
+		delete(hub.streams, s)
+		close(s.entries)
+		hub.mu.Unlock()
+		hub.updateLevel()
+	})
+}
+
+// Subscribe starts a stream of entries matching the filter. It also returns
+// up to tail recent matching entries, oldest first, without gaps or overlap
+// with the stream. While a stream asks for a lower level than the configured
+// one, the logger produces those entries for it without printing them.
+func Subscribe(filter Filter, tail int) (*Stream, []Entry) {
+	s := &Stream{
+		entries: make(chan Entry, streamBufferSize),
+		filter:  filter,
+	}
+
+	hub.mu.Lock()
+	recent := hub.recent(filter, tail)
+	hub.streams[s] = struct{}{}
+	hub.mu.Unlock()
+
+	hub.updateLevel()
+	return s, recent
+}
+
+// Recent returns up to n recent entries matching the filter, oldest first
+func Recent(filter Filter, n int) []Entry {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	return hub.recent(filter, n)
+}
+
+// streamHub keeps recent entries and fans new ones out to streams
+type streamHub struct {
+	mu      sync.Mutex
+	history []Entry
+	next    int // Position of the next entry once history is full
+	streams map[*Stream]struct{}
+}
+
+var hub = &streamHub{
+	streams: make(map[*Stream]struct{}),
+}
+
+// Write records an entry; the logger writes each entry as a JSON object
+func (h *streamHub) Write(p []byte) (int, error) {
+	var fields struct {
+		Time      time.Time `json:"time"`
+		Level     string    `json:"level"`
+		Component string    `json:"component"`
+
+		// Transfers are logged as transfer_id, or as id by the transfer components
+		TransferID json.RawMessage `json:"transfer_id"`
+		ID         json.RawMessage `json:"id"`
+	}
+	if err := json.Unmarshal(p, &fields); err != nil {
+		// Never fail the other writers because of the stream
+		return len(p), nil
+	}
+
+	level, err := zerolog.ParseLevel(fields.Level)
+	if err != nil {
+		level = zerolog.NoLevel
+	}
+	entry := Entry{
+		Time:      fields.Time,
+		Level:     LogLevel(fields.Level),
+		Component: fields.Component,
+		Raw:       append(json.RawMessage(nil), trimNewline(p)...),
+		level:     level,
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// History only keeps what the console shows, as streams may temporarily lower the level
+	if level >= consoleLevel {
+		if id, ok := parseTransferID(fields.TransferID, fields.ID); ok {
+			transfers.add(id, entry)
+		}
+		if len(h.history) < streamHistorySize {
+			h.history = append(h.history, entry)
+		} else {
+			h.history[h.next] = entry
+			h.next = (h.next + 1) % streamHistorySize
+		}
+	}
+
+	for s := range h.streams {
+		if !s.filter.matches(entry) {
+			continue
+		}
+		select {
+		case s.entries <- entry:
+		default:
+			// Slow readers miss entries rather than block logging
+		}
+	}
+	return len(p), nil
+}
+
+// recent returns up to n recent entries matching the filter; h.mu must be held
+func (h *streamHub) recent(filter Filter, n int) []Entry {
+	if n <= 0 {
+		return nil
+	}
+	var matched []Entry
+	for i := range h.history {
+		entry := h.history[(h.next+i)%len(h.history)]
+		if filter.matches(entry) {
+			matched = append(matched, entry)
+		}
+	}
+	if len(matched) > n {
+		matched = matched[len(matched)-n:]
+	}
+	return matched
+}
+
+// setConsoleLevel changes the configured level and updates the global level
+func (h *streamHub) setConsoleLevel(level LogLevel) {
+	h.mu.Lock()
+	consoleLevel = zerologLevel(level)
+	configuredLevel = level
+	h.mu.Unlock()
+	h.updateLevel()
+}
+
+// updateLevel sets the global level to the lowest level anyone needs
+func (h *streamHub) updateLevel() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	level := consoleLevel
+	for s := range h.streams {
+		if l := zerologLevel(s.filter.Level); l < level {
+			level = l
+		}
+	}
+	zerolog.SetGlobalLevel(level)
+}
+
+// parseTransferID returns the first of the fields holding a transfer ID
+func parseTransferID(fields ...json.RawMessage) (int64, bool) {
+	for _, field := range fields {
+		var id int64
+		if len(field) > 0 && json.Unmarshal(field, &id) == nil && id != 0 {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// trimNewline trims the trailing newline of a log line
+func trimNewline(p []byte) []byte {
+	if len(p) > 0 && p[len(p)-1] == '\n' {
+		return p[:len(p)-1]
+	}
+	return p
+}
@@ -0,0 +1,113 @@
+package log
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// transferLogSize is how many entries are kept per transfer
+const transferLogSize = 500
+
+// transferLogLimit is how many transfers logs are kept for; the least
+// recently written ones are dropped first
+const transferLogLimit = 200
+
+// transferLogs keeps recent entries per transfer
+type transferLogs struct {
+	mu   sync.Mutex
+	logs map[int64]*transferLog
+}
+
+// transferLog is the ring of entries of a single transfer
+type transferLog struct {
+	entries []Entry
+	next    int // Position of the next entry once entries is full
+	updated time.Time
+}
+
+var transfers = &transferLogs{
+	logs: make(map[int64]*transferLog),
+}
+
+// TransferLog returns the captured entries of a transfer, oldest first. ok is
+// false if nothing was captured for it.
+func TransferLog(transferID int64) (entries []Entry, ok bool) {
+	transfers.mu.Lock()
+	defer transfers.mu.Unlock()
+
+	l, ok := transfers.logs[transferID]
+	if !ok {
+		return nil, false
+	}
+	entries = make([]Entry, 0, len(l.entries))
+	for i := range l.entries {
+		entries = append(entries, l.entries[(l.next+i)%len(l.entries)])
+	}
+	return entries, true
+}
+
+// TransferOutput captures output of an external program, such as aria2c, in
+// the log of a transfer without writing it to the regular log
+func TransferOutput(transferID int64, component, fileName, line string) {
+	if line == "" {
+		return
+	}
+	now := time.Now()
+	raw, err := json.Marshal(struct {
+		Level      string `json:"level"`
+		Component  string `json:"component"`
+		TransferID int64  `json:"transfer_id"`
+		FileName   string `json:"file_name,omitempty"`
+		Time       string `json:"time"`
+		Message    string `json:"message"`
+	}{string(LevelDebug), component, transferID, fileName, now.Format(time.RFC3339), line})
+	if err != nil {
+		return
+	}
+
+	transfers.add(transferID, Entry{
+		Time:      now,
+		Level:     LevelDebug,
+		Component: component,
+		Raw:       raw,
+		level:     zerolog.DebugLevel,
+	})
+}
+
+// add appends an entry to the log of a transfer
+func (t *transferLogs) add(transferID int64, entry Entry) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	l, ok := t.logs[transferID]
+	if !ok {
+		if len(t.logs) >= transferLogLimit {
+			t.evict()
+		}
+		l = &transferLog{}
+		t.logs[transferID] = l
+	}
+	l.updated = time.Now()
+
+	if len(l.entries) < transferLogSize {
+		l.entries = append(l.entries, entry)
+		return
+	}
+	l.entries[l.next] = entry
+	l.next = (l.next + 1) % transferLogSize
+}
+
+// evict drops the least recently written transfer log; t.mu must be held
+func (t *transferLogs) evict() {
+	var oldestID int64
+	var oldest time.Time
+	for id, l := range t.logs {
+		if oldest.IsZero() || l.updated.Before(oldest) {
+			oldestID, oldest = id, l.updated
+		}
+	}
+	delete(t.logs, oldestID)
+}
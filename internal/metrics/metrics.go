@@ -0,0 +1,181 @@
+// Package metrics keeps counters and latency histograms and writes them in
+// the Prometheus text exposition format. It covers what plundrio reports,
+// not the whole Prometheus data model.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds in seconds of the latency histograms
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// metric is a family of series that can be written out
+type metric interface {
+	write(w io.Writer)
+}
+
+var (
+	registryMu sync.Mutex
+	registry   []metric
+)
+
+func register(m metric) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = append(registry, m)
+}
+
+// Write writes all metrics in the Prometheus text format
+func Write(w io.Writer) {
+	registryMu.Lock()
+	metrics := append([]metric(nil), registry...)
+	registryMu.Unlock()
+
+	for _, m := range metrics {
+		m.write(w)
+	}
+}
+
+// family holds the series of a metric, one per combination of label values
+type family[T any] struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]*T // joined label values -> series
+}
+
+// get returns the series with the given label values, creating it if needed
+func (f *family[T]) get(values []string) *T {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", f.name, len(f.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.series == nil {
+		f.series = make(map[string]*T)
+	}
+	s, ok := f.series[key]
+	if !ok {
+		s = new(T)
+		f.series[key] = s
+	}
+	return s
+}
+
+// each calls fn for every series in a stable order. The caller must hold f.mu.
+func (f *family[T]) each(fn func(labels string, s *T)) {
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		pairs := make([]string, len(f.labels))
+		for i, value := range strings.Split(key, "\xff") {
+			pairs[i] = fmt.Sprintf("%s=%q", f.labels[i], value)
+		}
+		fn(strings.Join(pairs, ","), f.series[key])
+	}
+}
+
+// CounterVec counts events per combination of label values
+type CounterVec struct {
+	family[float64]
+}
+
+// NewCounterVec creates and registers a counter with the given labels
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{family[float64]{name: name, help: help, labels: labels}}
+	register(c)
+	return c
+}
+
+// Inc adds one to the counter with the given label values
+func (c *CounterVec) Inc(values ...string) {
+	v := c.get(values)
+	c.mu.Lock()
+	*v++
+	c.mu.Unlock()
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	c.each(func(labels string, v *float64) {
+		fmt.Fprintf(w, "%s{%s} %s\n", c.name, labels, formatFloat(*v))
+	})
+}
+
+// histogram is a single latency histogram
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// HistogramVec records latencies per combination of label values
+type HistogramVec struct {
+	family[histogram]
+}
+
+// NewHistogramVec creates and registers a latency histogram with the given labels
+func NewHistogramVec(name, help string, labels ...string) *HistogramVec {
+	h := &HistogramVec{family[histogram]{name: name, help: help, labels: labels}}
+	register(h)
+	return h
+}
+
+// Observe records a latency for the given label values
+func (h *HistogramVec) Observe(d time.Duration, values ...string) {
+	s := h.get(values)
+	seconds := d.Seconds()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s.counts == nil {
+		s.counts = make([]uint64, len(latencyBuckets))
+	}
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			s.counts[i]++
+			break
+		}
+	}
+	s.count++
+	s.sum += seconds
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	h.each(func(labels string, s *histogram) {
+		var cumulative uint64
+		for i, bound := range latencyBuckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", h.name, labels, formatFloat(bound), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", h.name, labels, s.count)
+		fmt.Fprintf(w, "%s_sum{%s} %s\n", h.name, labels, formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count{%s} %d\n", h.name, labels, s.count)
+	})
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	providerDuration = NewHistogramVec("plundrio_provider_request_duration_seconds",
+		"Latency of API requests to the providers.", "provider")
+	providerErrors = NewCounterVec("plundrio_provider_request_errors_total",
+		"API requests to the providers that failed or were answered with a server error.", "provider")
+
+	providerTime atomic.Int64 // total time spent in provider requests, in nanoseconds
+)
+
+// ProviderTime returns the total time spent in API requests to the
+// providers so far. The difference over a period tells how long requests
+// running during that period waited for providers.
+func ProviderTime() time.Duration {
+	return time.Duration(providerTime.Load())
+}
+
+// transport records the latency of the requests sent through it
+type transport struct {
+	provider string
+	base     http.RoundTripper
+}
+
+// Transport returns a round tripper recording the latency and errors of
+// requests to a provider before passing them on to base
+func Transport(provider string, base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{provider: provider, base: base}
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	elapsed := time.Since(start)
+
+	providerTime.Add(int64(elapsed))
+	providerDuration.Observe(elapsed, t.provider)
+	if err != nil || resp.StatusCode >= http.StatusInternalServerError {
+		providerErrors.Inc(t.provider)
+	}
+	return resp, err
+}
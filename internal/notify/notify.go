@@ -0,0 +1,208 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/events"
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// Event types sent as notifications
+const (
+	EventCompleted = "completed"
+	EventFailed    = "failed"
+	EventSlow      = "slow"
+	EventReport    = "report"
+)
+
+// Default templates used when none are configured
+const (
+	DefaultTitleTemplate   = `plundrio: {{.Name}} {{.Type}}`
+	DefaultBodyTemplate    = `{{if eq .Type "slow"}}{{.Name}} has been downloading at {{speed .Speed}} for {{duration .Duration}}{{else if .Error}}{{.Name}} failed: {{.Error}}{{else}}{{.Name}} ({{size .Size}}) downloaded in {{duration .Duration}} at {{speed .Speed}}{{end}}`
+	DefaultPayloadTemplate = `{"title": {{json .Title}}, "body": {{json .Body}}, "event": {{json .Type}}}`
+)
+
+// Event holds the data available to notification templates
+type Event struct {
+	Type     string        // Event type (completed, failed, slow, report)
+	Name     string        // Transfer name
+	Category string        // Transfer category, empty for the default target directory
+	Size     int64         // Total size in bytes
+	Duration time.Duration // Time spent downloading, or time spent below the threshold for slow transfers
+	Speed    float64       // Average speed in bytes per second over that time
+	Error    string        // Error message for failures
+
+	// Title and Body are the rendered title and body, available to the payload template
+	Title string
+	Body  string
+}
+
+// Templates configures how notifications are rendered
+type Templates struct {
+	Title   string
+	Body    string
+	Payload string
+}
+
+// Notifier sends rendered notifications to a webhook URL
+type Notifier struct {
+	url        string
+	title      *template.Template
+	body       *template.Template
+	payload    *template.Template
+	httpClient *http.Client
+}
+
+// funcs are the helper functions available in templates
+var funcs = template.FuncMap{
+	"size":     FormatSize,
+	"speed":    func(bytesPerSecond float64) string { return FormatSize(int64(bytesPerSecond)) + "/s" },
+	"duration": func(d time.Duration) string { return d.Round(time.Second).String() },
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// New creates a notifier posting to url. Empty templates fall back to the defaults.
+func New(url string, templates Templates) (*Notifier, error) {
+	parse := func(name, text, fallback string) (*template.Template, error) {
+		if text == "" {
+			text = fallback
+		}
+		tmpl, err := template.New(name).Funcs(funcs).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s template: %w", name, err)
+		}
+		return tmpl, nil
+	}
+
+	n := &Notifier{
+		url:        url,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+	var err error
+	if n.title, err = parse("title", templates.Title, DefaultTitleTemplate); err != nil {
+		return nil, err
+	}
+	if n.body, err = parse("body", templates.Body, DefaultBodyTemplate); err != nil {
+		return nil, err
+	}
+	if n.payload, err = parse("payload", templates.Payload, DefaultPayloadTemplate); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// Render renders the title, body and payload for an event
+func (n *Notifier) Render(event Event) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := n.title.Execute(&buf, event); err != nil {
+		return nil, fmt.Errorf("failed to render title: %w", err)
+	}
+	event.Title = buf.String()
+
+	buf.Reset()
+	if err := n.body.Execute(&buf, event); err != nil {
+		return nil, fmt.Errorf("failed to render body: %w", err)
+	}
+	event.Body = buf.String()
+
+	buf.Reset()
+	if err := n.payload.Execute(&buf, event); err != nil {
+		return nil, fmt.Errorf("failed to render payload: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Notify renders and sends a notification. Failures are logged, not returned.
+func (n *Notifier) Notify(event Event) {
+	payload, err := n.Render(event)
+	if err != nil {
+		log.Error("notify").Str("event", event.Type).Err(err).Msg("Failed to render notification")
+		return
+	}
+	n.send(event, payload)
+}
+
+// NotifyText sends a notification with a ready-made title and body, such as
+// a summary report. Only the payload template is applied.
+func (n *Notifier) NotifyText(eventType, title, body string) {
+	event := Event{Type: eventType, Name: title, Title: title, Body: body}
+
+	var buf bytes.Buffer
+	if err := n.payload.Execute(&buf, event); err != nil {
+		log.Error("notify").Str("event", eventType).Err(err).Msg("Failed to render notification")
+		return
+	}
+	n.send(event, buf.Bytes())
+}
+
+// send posts a rendered payload to the webhook. Failures are logged, not returned.
+func (n *Notifier) send(event Event, payload []byte) {
+	resp, err := n.httpClient.Post(n.url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		log.Error("notify").Str("event", event.Type).Err(err).Msg("Failed to send notification")
+		return
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		log.Error("notify").
+			Str("event", event.Type).
+			Int("status", resp.StatusCode).
+			Msg("Notification endpoint returned an error")
+		return
+	}
+
+	log.Debug("notify").
+		Str("event", event.Type).
+		Str("name", event.Name).
+		Msg("Notification sent")
+}
+
+// HandleEvent sends a notification for completed, failed, errored and slow transfers
+func (n *Notifier) HandleEvent(e events.Event) {
+	event := Event{
+		Type:     EventCompleted,
+		Name:     e.Name,
+		Category: e.Category,
+		Size:     e.Size,
+		Duration: e.Duration,
+		Speed:    e.Speed,
+		Error:    e.Error,
+	}
+
+	switch e.Type {
+	case events.TransferCompleted:
+	case events.TransferFailed, events.TransferErrored:
+		event.Type = EventFailed
+	case events.TransferSlow:
+		event.Type = EventSlow
+	default:
+		return
+	}
+	n.Notify(event)
+}
+
+// FormatSize formats a byte count in human-readable units
+func FormatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
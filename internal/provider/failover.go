@@ -0,0 +1,268 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/elsbrock/go-putio"
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// Router is a provider made of several providers, each handling the
+// transfers and files it came up with
+type Router interface {
+	Provider
+
+	// Providers returns the providers it is made of, the primary one first
+	Providers() []Provider
+
+	// For returns the provider a transfer or file came from, or the primary
+	// one if it is not known
+	For(id int64) Provider
+
+	// AddTransferTo and AddTorrentTo add a transfer to the provider with
+	// the given name first
+	AddTransferTo(ctx context.Context, name, url string, folderID int64) error
+	AddTorrentTo(ctx context.Context, name string, data []byte, filename string, folderID int64) error
+}
+
+// All returns the providers p is made of, or p itself
+func All(p Provider) []Provider {
+	if r, ok := p.(Router); ok {
+		return r.Providers()
+	}
+	return []Provider{p}
+}
+
+// Of returns the provider of p a transfer or file came from
+func Of(p Provider, id int64) Provider {
+	if r, ok := p.(Router); ok {
+		return r.For(id)
+	}
+	return p
+}
+
+// AddTransferTo adds a transfer to the provider of p with the given name
+// first, or to p if it is not made of several providers
+func AddTransferTo(ctx context.Context, p Provider, name, url string, folderID int64) error {
+	if r, ok := p.(Router); ok && name != "" {
+		return r.AddTransferTo(ctx, name, url, folderID)
+	}
+	return p.AddTransfer(ctx, url, folderID)
+}
+
+// AddTorrentTo adds a torrent file to the provider of p with the given name
+// first, or to p if it is not made of several providers
+func AddTorrentTo(ctx context.Context, p Provider, name string, data []byte, filename string, folderID int64) error {
+	if r, ok := p.(Router); ok && name != "" {
+		return r.AddTorrentTo(ctx, name, data, filename, folderID)
+	}
+	return p.AddTorrent(ctx, data, filename, folderID)
+}
+
+// Failover is a provider made of a primary provider and fallbacks. New
+// transfers go to the first provider that takes them, so a fallback steps in
+// when the primary rejects a magnet or is down. Transfers of all providers
+// are downloaded, each through the provider it was added to. Providers
+// included for routing only take transfers routed to them.
+type Failover struct {
+	providers []Provider
+	chain     int // the first chain providers take transfers in order
+
+	mu     sync.Mutex
+	origin map[int64]Provider             // transfer and file IDs -> provider they came from
+	last   map[Provider][]*putio.Transfer // last transfers listed per provider
+}
+
+var _ Router = (*Failover)(nil)
+
+// NewFailover creates a provider adding transfers to primary and, if it
+// fails, to the fallbacks in order
+func NewFailover(primary Provider, fallbacks ...Provider) *Failover {
+	return &Failover{
+		providers: append([]Provider{primary}, fallbacks...),
+		chain:     len(fallbacks) + 1,
+		origin:    make(map[int64]Provider),
+		last:      make(map[Provider][]*putio.Transfer),
+	}
+}
+
+// Name identifies the primary provider
+func (f *Failover) Name() string {
+	return f.providers[0].Name()
+}
+
+// Include adds a provider that only takes transfers routed to it with
+// AddTransferTo and AddTorrentTo. It must be called before f is used.
+func (f *Failover) Include(p Provider) {
+	f.providers = append(f.providers, p)
+}
+
+// Providers returns the primary provider, the fallbacks and the included
+// providers
+func (f *Failover) Providers() []Provider {
+	return f.providers
+}
+
+// For returns the provider a transfer or file came from
+func (f *Failover) For(id int64) Provider {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if p, ok := f.origin[id]; ok {
+		return p
+	}
+	return f.providers[0]
+}
+
+// remember notes which provider IDs came from
+func (f *Failover) remember(p Provider, ids ...int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, id := range ids {
+		if id != 0 {
+			f.origin[id] = p
+		}
+	}
+}
+
+// Authenticate checks the credentials of all providers. It fails only if
+// none of them works, a provider that is down now may be back later.
+func (f *Failover) Authenticate(ctx context.Context) error {
+	var errs []error
+	for _, p := range f.providers {
+		if err := p.Authenticate(ctx); err != nil {
+			log.Warn("provider").Str("provider", p.Name()).Err(err).Msg("Provider authentication failed")
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name(), err))
+		}
+	}
+	if len(errs) == len(f.providers) {
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
+// ListTransfers returns the transfers of all providers. While a provider
+// cannot be reached its transfers from the last listing are kept, so they
+// are not mistaken for removed ones.
+func (f *Failover) ListTransfers(ctx context.Context) ([]*putio.Transfer, error) {
+	var all []*putio.Transfer
+	var errs []error
+	for _, p := range f.providers {
+		transfers, err := p.ListTransfers(ctx)
+		if err != nil {
+			log.Warn("provider").Str("provider", p.Name()).Err(err).Msg("Failed to list transfers")
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name(), err))
+			f.mu.Lock()
+			transfers = f.last[p]
+			f.mu.Unlock()
+		} else {
+			f.mu.Lock()
+			f.last[p] = transfers
+			f.mu.Unlock()
+		}
+		for _, t := range transfers {
+			f.remember(p, t.ID, t.FileID)
+		}
+		all = append(all, transfers...)
+	}
+	if len(errs) == len(f.providers) {
+		return nil, errors.Join(errs...)
+	}
+	return all, nil
+}
+
+// add tries adding a transfer to each provider in turn until one takes it,
+// to the provider named first if given
+func (f *Failover) add(first, name string, add func(Provider) error) error {
+	order := make([]Provider, 0, f.chain+1)
+	for _, p := range f.providers {
+		if p.Name() == first {
+			order = append(order, p)
+		}
+	}
+	for _, p := range f.providers[:f.chain] {
+		if p.Name() != first {
+			order = append(order, p)
+		}
+	}
+
+	var errs []error
+	for i, p := range order {
+		err := add(p)
+		if err == nil {
+			if i > 0 {
+				log.Warn("provider").
+					Str("name", name).
+					Str("provider", p.Name()).
+					Msg("Transfer added to fallback provider")
+			} else if p.Name() == first {
+				log.Info("provider").
+					Str("name", name).
+					Str("provider", p.Name()).
+					Msg("Transfer routed to provider")
+			}
+			return nil
+		}
+		log.Warn("provider").
+			Str("name", name).
+			Str("provider", p.Name()).
+			Err(err).
+			Msg("Provider did not take transfer")
+		errs = append(errs, fmt.Errorf("%s: %w", p.Name(), err))
+	}
+	return errors.Join(errs...)
+}
+
+// AddTransfer adds a transfer to the first provider that takes it
+func (f *Failover) AddTransfer(ctx context.Context, url string, folderID int64) error {
+	return f.AddTransferTo(ctx, "", url, folderID)
+}
+
+// AddTransferTo adds a transfer to the provider with the given name, or if
+// it does not take it to the first other provider that does
+func (f *Failover) AddTransferTo(ctx context.Context, name, url string, folderID int64) error {
+	return f.add(name, url, func(p Provider) error { return p.AddTransfer(ctx, url, folderID) })
+}
+
+// AddTorrent adds a torrent file to the first provider that takes it
+func (f *Failover) AddTorrent(ctx context.Context, data []byte, filename string, folderID int64) error {
+	return f.AddTorrentTo(ctx, "", data, filename, folderID)
+}
+
+// AddTorrentTo adds a torrent file to the provider with the given name, or
+// if it does not take it to the first other provider that does
+func (f *Failover) AddTorrentTo(ctx context.Context, name string, data []byte, filename string, folderID int64) error {
+	return f.add(name, filename, func(p Provider) error { return p.AddTorrent(ctx, data, filename, folderID) })
+}
+
+// DeleteTransfer removes a transfer from the provider it came from
+func (f *Failover) DeleteTransfer(ctx context.Context, transferID int64) error {
+	return f.For(transferID).DeleteTransfer(ctx, transferID)
+}
+
+// GetFile returns a file or folder from the provider it came from
+func (f *Failover) GetFile(ctx context.Context, fileID int64) (*putio.File, error) {
+	return f.For(fileID).GetFile(ctx, fileID)
+}
+
+// GetAllTransferFiles returns the files of a transfer from the provider it came from
+func (f *Failover) GetAllTransferFiles(ctx context.Context, fileID int64) ([]*putio.File, error) {
+	p := f.For(fileID)
+	files, err := p.GetAllTransferFiles(ctx, fileID)
+	for _, file := range files {
+		f.remember(p, file.ID)
+	}
+	return files, err
+}
+
+// GetDownloadURL returns a download URL from the provider the file came from
+func (f *Failover) GetDownloadURL(ctx context.Context, fileID int64) (string, error) {
+	return f.For(fileID).GetDownloadURL(ctx, fileID)
+}
+
+// DeleteFile deletes a file or folder at the provider it came from
+func (f *Failover) DeleteFile(ctx context.Context, fileID int64) error {
+	return f.For(fileID).DeleteFile(ctx, fileID)
+}
@@ -0,0 +1,454 @@
+// Package premiumize is the Premiumize.me provider. Premiumize fetches
+// torrents and URLs as transfers into folders of its cloud storage and serves
+// their files through direct download links.
+package premiumize
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elsbrock/go-putio"
+	"github.com/elsbrock/plundrio/internal/log"
+	"github.com/elsbrock/plundrio/internal/metrics"
+	"github.com/elsbrock/plundrio/internal/provider"
+)
+
+// Name identifies the Premiumize provider
+const Name = "premiumize"
+
+const (
+	// baseURL is the Premiumize API
+	baseURL = "https://www.premiumize.me/api"
+
+	// requestTimeout bounds a single API request
+	requestTimeout = 30 * time.Second
+)
+
+// Client is the Premiumize provider
+var _ provider.Provider = (*Client)(nil)
+
+// Client talks to the Premiumize API. Premiumize identifies transfers, folders
+// and files by strings; they are mapped onto stable int64 IDs for the put.io
+// data model.
+type Client struct {
+	apiKey     string
+	folderID   int64 // reported as SaveParentID of all transfers
+	baseURL    string
+	httpClient *http.Client
+
+	mu    sync.Mutex
+	items map[int64]item // transfer, result, folder and file IDs -> Premiumize item
+}
+
+// item is a transfer, folder or file at Premiumize
+type item struct {
+	kind string // transfer, result, folder or file
+	id   string // Premiumize ID; for results the folder the transfer saved to
+	name string // for results the name of the transfer
+}
+
+// transfer is a transfer as listed by Premiumize
+type transfer struct {
+	ID       string  `json:"id"`
+	Name     string  `json:"name"`
+	Message  string  `json:"message"`
+	Status   string  `json:"status"`
+	Progress float64 `json:"progress"` // 0 to 1
+	Src      string  `json:"src"`
+	FolderID string  `json:"folder_id"`
+	FileID   string  `json:"file_id"` // set if the transfer saved a single file
+}
+
+// content is an entry of a folder listing
+type content struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Type string `json:"type"` // folder or file
+	Size int64  `json:"size"`
+	Link string `json:"link"`
+}
+
+// response is the envelope of all API answers
+type response struct {
+	Status  string `json:"status"` // success or error
+	Message string `json:"message"`
+}
+
+// apiError is an error answer of the Premiumize API
+type apiError struct {
+	Status  int
+	Message string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("Premiumize API error %d: %s", e.Status, e.Message)
+}
+
+// New creates a Premiumize provider with an API key. Transfers report
+// folderID as the folder they were saved to.
+func New(apiKey string, folderID int64) *Client {
+	return &Client{
+		apiKey:     apiKey,
+		folderID:   folderID,
+		baseURL:    baseURL,
+		httpClient: &http.Client{Timeout: requestTimeout, Transport: metrics.Transport(Name, nil)},
+		items:      make(map[int64]item),
+	}
+}
+
+// Name identifies Premiumize as provider
+func (c *Client) Name() string {
+	return Name
+}
+
+// Authenticate checks the API key by fetching the account info
+func (c *Client) Authenticate(ctx context.Context) error {
+	var account struct {
+		CustomerID   json.Number `json:"customer_id"`
+		PremiumUntil int64       `json:"premium_until"`
+	}
+	if err := c.get(ctx, "/account/info", nil, &account); err != nil {
+		return fmt.Errorf("authentication failed: %w", err)
+	}
+	if account.PremiumUntil < time.Now().Unix() {
+		log.Warn("premiumize").Str("customer_id", account.CustomerID.String()).Msg("Premiumize account is not premium, downloads will fail")
+	}
+	return nil
+}
+
+// ListTransfers returns all transfers of the account
+func (c *Client) ListTransfers(ctx context.Context) ([]*putio.Transfer, error) {
+	var list struct {
+		Transfers []transfer `json:"transfers"`
+	}
+	if err := c.get(ctx, "/transfer/list", nil, &list); err != nil {
+		return nil, err
+	}
+
+	transfers := make([]*putio.Transfer, 0, len(list.Transfers))
+	for _, t := range list.Transfers {
+		transfers = append(transfers, c.transfer(t))
+	}
+	return transfers, nil
+}
+
+// transfer maps a Premiumize transfer onto a put.io transfer and remembers its IDs
+func (c *Client) transfer(t transfer) *putio.Transfer {
+	result := &putio.Transfer{
+		ID:            c.remember(item{kind: "transfer", id: t.ID}),
+		Name:          t.Name,
+		PercentDone:   int(t.Progress * 100),
+		Status:        transferStatus(t.Status),
+		StatusMessage: t.Message,
+		SaveParentID:  c.folderID,
+		Source:        Name,
+	}
+	if strings.HasPrefix(t.Src, "magnet:") {
+		result.MagnetURI = t.Src
+	}
+	switch {
+	case result.Status == "ERROR":
+		result.ErrorMessage = "Premiumize: " + t.Status
+		if t.Message != "" {
+			result.ErrorMessage += ": " + t.Message
+		}
+	case result.Status != "COMPLETED" && result.Status != "SEEDING":
+	case t.FileID != "":
+		result.FileID = c.remember(item{kind: "file", id: t.FileID, name: t.Name})
+	case t.FolderID != "":
+		result.FileID = c.remember(item{kind: "result", id: t.FolderID, name: t.Name})
+	}
+	return result
+}
+
+// transferStatus maps a Premiumize transfer status onto a put.io transfer status
+func transferStatus(status string) string {
+	switch status {
+	case "finished":
+		return "COMPLETED"
+	case "seeding":
+		return "SEEDING"
+	case "running":
+		return "DOWNLOADING"
+	case "error", "banned", "timeout", "deleted":
+		return "ERROR"
+	default: // waiting, queued
+		return "IN_QUEUE"
+	}
+}
+
+// remember returns the stable ID of a Premiumize item and remembers it
+func (c *Client) remember(it item) int64 {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s:%s:%s", it.kind, it.id, it.name)
+	id := int64(h.Sum64() & (1<<63 - 1))
+
+	c.mu.Lock()
+	c.items[id] = it
+	c.mu.Unlock()
+	return id
+}
+
+// lookup returns the Premiumize item of an ID
+func (c *Client) lookup(id int64, kind string) (item, error) {
+	c.mu.Lock()
+	it, ok := c.items[id]
+	c.mu.Unlock()
+	if !ok || (kind != "" && it.kind != kind) {
+		return item{}, fmt.Errorf("%w: %d", provider.ErrFileNotFound, id)
+	}
+	return it, nil
+}
+
+// AddTransfer adds a transfer from a magnet link or a URL Premiumize fetches
+func (c *Client) AddTransfer(ctx context.Context, link string, folderID int64) error {
+	return c.post(ctx, "/transfer/create", url.Values{"src": {link}}, nil)
+}
+
+// AddTorrent adds a transfer from the contents of a .torrent file
+func (c *Client) AddTorrent(ctx context.Context, data []byte, filename string, folderID int64) error {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", filename)
+	if err != nil {
+		return err
+	}
+	if _, err := part.Write(data); err != nil {
+		return err
+	}
+	if err := form.Close(); err != nil {
+		return err
+	}
+	return c.do(ctx, http.MethodPost, "/transfer/create", nil, &body, form.FormDataContentType(), nil)
+}
+
+// DeleteTransfer removes a transfer from the transfer list, its files stay
+func (c *Client) DeleteTransfer(ctx context.Context, transferID int64) error {
+	it, err := c.lookup(transferID, "transfer")
+	if err != nil {
+		return nil
+	}
+	return c.post(ctx, "/transfer/delete", url.Values{"id": {it.id}}, nil)
+}
+
+// resolve returns the file or folder a transfer saved. A transfer may report
+// the folder it saved its result into rather than the result itself, so an
+// entry named like the transfer is looked for in it first.
+func (c *Client) resolve(ctx context.Context, it item) (content, error) {
+	switch it.kind {
+	case "file":
+		var details content
+		if err := c.get(ctx, "/item/details", url.Values{"id": {it.id}}, &details); err != nil {
+			return content{}, c.notFound(err)
+		}
+		details.Type = "file"
+		return details, nil
+	case "folder":
+		return content{ID: it.id, Name: it.name, Type: "folder"}, nil
+	case "result":
+		entries, name, err := c.list(ctx, it.id)
+		if err != nil {
+			return content{}, err
+		}
+		for _, entry := range entries {
+			if entry.Name == it.name {
+				return entry, nil
+			}
+		}
+		return content{ID: it.id, Name: name, Type: "folder"}, nil
+	}
+	return content{}, fmt.Errorf("%w: %s %s", provider.ErrFileNotFound, it.kind, it.id)
+}
+
+// list returns the entries and the name of a folder
+func (c *Client) list(ctx context.Context, folderID string) ([]content, string, error) {
+	var folder struct {
+		Name    string    `json:"name"`
+		Content []content `json:"content"`
+	}
+	if err := c.get(ctx, "/folder/list", url.Values{"id": {folderID}}, &folder); err != nil {
+		return nil, "", c.notFound(err)
+	}
+	return folder.Content, folder.Name, nil
+}
+
+// file maps a Premiumize file or folder onto a put.io file and remembers its ID
+func (c *Client) file(entry content, parentID int64) *putio.File {
+	file := &putio.File{Name: entry.Name, Size: entry.Size, ParentID: parentID}
+	if entry.Type == "folder" {
+		file.ContentType = "application/x-directory"
+		file.ID = c.remember(item{kind: "folder", id: entry.ID, name: entry.Name})
+	} else {
+		file.ID = c.remember(item{kind: "file", id: entry.ID, name: entry.Name})
+	}
+	return file
+}
+
+// GetFile returns the file or folder a transfer saved, or one below it
+func (c *Client) GetFile(ctx context.Context, fileID int64) (*putio.File, error) {
+	it, err := c.lookup(fileID, "")
+	if err != nil {
+		return nil, err
+	}
+	entry, err := c.resolve(ctx, it)
+	if err != nil {
+		return nil, err
+	}
+	file := c.file(entry, c.folderID)
+	file.ID = fileID
+	return file, nil
+}
+
+// GetAllTransferFiles returns the file with fileID, or all files below the
+// folder with fileID
+func (c *Client) GetAllTransferFiles(ctx context.Context, fileID int64) ([]*putio.File, error) {
+	it, err := c.lookup(fileID, "")
+	if err != nil {
+		return nil, err
+	}
+	entry, err := c.resolve(ctx, it)
+	if err != nil {
+		return nil, err
+	}
+	if entry.Type != "folder" {
+		file := c.file(entry, c.folderID)
+		file.ID = fileID
+		return []*putio.File{file}, nil
+	}
+
+	var files []*putio.File
+	var walk func(folderID string, parentID int64) error
+	walk = func(folderID string, parentID int64) error {
+		entries, _, err := c.list(ctx, folderID)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			file := c.file(e, parentID)
+			if file.IsDir() {
+				if err := walk(e.ID, file.ID); err != nil {
+					return err
+				}
+				continue
+			}
+			files = append(files, file)
+		}
+		return nil
+	}
+	if err := walk(entry.ID, fileID); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// GetDownloadURL returns the direct download link of a file
+func (c *Client) GetDownloadURL(ctx context.Context, fileID int64) (string, error) {
+	it, err := c.lookup(fileID, "")
+	if err != nil {
+		return "", err
+	}
+	entry, err := c.resolve(ctx, it)
+	if err != nil {
+		return "", err
+	}
+	if entry.Type == "folder" || entry.Link == "" {
+		return "", fmt.Errorf("Premiumize has no download link for %s", entry.Name)
+	}
+	return entry.Link, nil
+}
+
+// DeleteFile deletes the file or folder a transfer saved, or one below it
+func (c *Client) DeleteFile(ctx context.Context, fileID int64) error {
+	it, err := c.lookup(fileID, "")
+	if err != nil {
+		return nil
+	}
+	entry, err := c.resolve(ctx, it)
+	if errors.Is(err, provider.ErrFileNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if entry.Type == "folder" {
+		return c.post(ctx, "/folder/delete", url.Values{"id": {entry.ID}}, nil)
+	}
+	return c.post(ctx, "/item/delete", url.Values{"id": {entry.ID}}, nil)
+}
+
+// notFound wraps Premiumize errors about missing items in ErrFileNotFound
+func (c *Client) notFound(err error) error {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) && (apiErr.Status == http.StatusNotFound || strings.Contains(strings.ToLower(apiErr.Message), "not found")) {
+		return fmt.Errorf("%w: %v", provider.ErrFileNotFound, err)
+	}
+	return err
+}
+
+// get calls an API endpoint with GET
+func (c *Client) get(ctx context.Context, endpoint string, query url.Values, v interface{}) error {
+	return c.do(ctx, http.MethodGet, endpoint, query, nil, "", v)
+}
+
+// post calls an API endpoint with a form
+func (c *Client) post(ctx context.Context, endpoint string, form url.Values, v interface{}) error {
+	return c.do(ctx, http.MethodPost, endpoint, nil, strings.NewReader(form.Encode()), "application/x-www-form-urlencoded", v)
+}
+
+// do calls an API endpoint and decodes the JSON response into v if given.
+// Premiumize answers most errors with 200 OK and status "error".
+func (c *Client) do(ctx context.Context, method, endpoint string, query url.Values, body io.Reader, contentType string, v interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("apikey", c.apiKey)
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+endpoint+"?"+query.Encode(), body)
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		// The URL holds the API key
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return fmt.Errorf("%s %s: %w", method, endpoint, urlErr.Err)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	var envelope response
+	if err := json.Unmarshal(data, &envelope); err != nil || resp.StatusCode < 200 || resp.StatusCode > 299 || envelope.Status == "error" {
+		message := envelope.Message
+		if message == "" {
+			message = strings.TrimSpace(string(data))
+		}
+		return &apiError{Status: resp.StatusCode, Message: message}
+	}
+	if v == nil {
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,73 @@
+// Package provider defines the cloud services plundrio downloads from. A
+// provider fetches transfers, such as torrents, into its own storage and
+// serves their files for download; put.io is the original one.
+//
+// Transfers and files use the put.io data model, which the download manager
+// is built around: other providers map their transfers and files onto
+// putio.Transfer and putio.File, including the transfer statuses (IN_QUEUE,
+// DOWNLOADING, COMPLETED, SEEDING, ERROR) and the FileID of a finished
+// transfer pointing at its file or folder.
+package provider
+
+import (
+	"context"
+	"errors"
+
+	"github.com/elsbrock/go-putio"
+)
+
+// ErrFileNotFound is returned when a file no longer exists at the provider
+var ErrFileNotFound = errors.New("file not found at the provider")
+
+// Provider is a cloud service transfers are added to and downloaded from.
+// All methods but Name call the service and give up once ctx is done.
+type Provider interface {
+	// Name identifies the provider in logs and the API, e.g. putio
+	Name() string
+
+	// Authenticate checks the credentials of the provider
+	Authenticate(ctx context.Context) error
+
+	// ListTransfers returns all transfers of the account. Only those whose
+	// SaveParentID is the configured folder are downloaded; providers
+	// without folders report the folderID given to AddTransfer.
+	ListTransfers(ctx context.Context) ([]*putio.Transfer, error)
+
+	// AddTransfer adds a transfer from a magnet link or a URL the provider
+	// fetches. Providers without folders ignore folderID.
+	AddTransfer(ctx context.Context, url string, folderID int64) error
+
+	// AddTorrent adds a transfer from the contents of a .torrent file
+	AddTorrent(ctx context.Context, data []byte, filename string, folderID int64) error
+
+	// DeleteTransfer removes a transfer, but not its files
+	DeleteTransfer(ctx context.Context, transferID int64) error
+
+	// GetFile returns a file or folder. It returns an error wrapping
+	// ErrFileNotFound if the file is gone.
+	GetFile(ctx context.Context, fileID int64) (*putio.File, error)
+
+	// GetAllTransferFiles returns the file with fileID, or all files below
+	// the folder with fileID with their paths relative to it as names
+	GetAllTransferFiles(ctx context.Context, fileID int64) ([]*putio.File, error)
+
+	// GetDownloadURL returns a URL the file can be downloaded from. It
+	// returns an error wrapping ErrFileNotFound if the file is gone.
+	GetDownloadURL(ctx context.Context, fileID int64) (string, error)
+
+	// DeleteFile removes a downloaded file or folder. It returns nil or an
+	// error wrapping ErrFileNotFound if the file is already gone.
+	DeleteFile(ctx context.Context, fileID int64) error
+}
+
+// Retrier is a provider that can retry transfers it gave up on
+type Retrier interface {
+	RetryTransfer(ctx context.Context, transferID int64) (*putio.Transfer, error)
+}
+
+// Trash is a provider that keeps deleted files in a trash, counting against
+// the storage quota until it is emptied
+type Trash interface {
+	DeleteFilePermanently(ctx context.Context, fileID int64) error
+	EmptyTrash(ctx context.Context) error
+}
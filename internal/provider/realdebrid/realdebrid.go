@@ -0,0 +1,409 @@
+// Package realdebrid is the Real-Debrid provider. Real-Debrid downloads
+// torrents into its cache and serves their files through links that are
+// unrestricted into direct download URLs.
+package realdebrid
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elsbrock/go-putio"
+	"github.com/elsbrock/plundrio/internal/log"
+	"github.com/elsbrock/plundrio/internal/metrics"
+	"github.com/elsbrock/plundrio/internal/provider"
+)
+
+// Name identifies the Real-Debrid provider
+const Name = "realdebrid"
+
+const (
+	// baseURL is the Real-Debrid REST API
+	baseURL = "https://api.real-debrid.com/rest/1.0"
+
+	// pageSize is how many torrents are listed per request
+	pageSize = 100
+
+	// requestTimeout bounds a single API request
+	requestTimeout = 30 * time.Second
+)
+
+// Client is the Real-Debrid provider
+var _ provider.Provider = (*Client)(nil)
+
+// Client talks to the Real-Debrid API. Real-Debrid identifies torrents by
+// strings and their files by their index; both are mapped onto stable int64
+// IDs for the put.io data model.
+type Client struct {
+	token      string
+	folderID   int64 // reported as SaveParentID of all transfers
+	baseURL    string
+	httpClient *http.Client
+
+	mu       sync.Mutex
+	torrents map[int64]string  // transfer ID and folder file ID -> torrent ID
+	files    map[int64]fileRef // file ID -> torrent and link of the file
+}
+
+// fileRef locates a file of a torrent
+type fileRef struct {
+	torrentID string
+	name      string
+	size      int64
+	link      string // hoster link to unrestrict
+}
+
+// torrent is a torrent as listed by Real-Debrid
+type torrent struct {
+	ID       string   `json:"id"`
+	Filename string   `json:"filename"`
+	Hash     string   `json:"hash"`
+	Bytes    int64    `json:"bytes"`
+	Progress float64  `json:"progress"`
+	Status   string   `json:"status"`
+	Added    string   `json:"added"`
+	Speed    int      `json:"speed"`
+	Seeders  int      `json:"seeders"`
+	Links    []string `json:"links"`
+}
+
+// torrentInfo is a torrent with its files
+type torrentInfo struct {
+	torrent
+	Files []struct {
+		ID       int    `json:"id"`
+		Path     string `json:"path"`
+		Bytes    int64  `json:"bytes"`
+		Selected int    `json:"selected"`
+	} `json:"files"`
+}
+
+// apiError is an error answer of the Real-Debrid API
+type apiError struct {
+	Status  int
+	Message string `json:"error"`
+	Code    int    `json:"error_code"`
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("Real-Debrid API error %d (%d): %s", e.Status, e.Code, e.Message)
+}
+
+// New creates a Real-Debrid provider with an API token. Transfers report
+// folderID as the folder they were saved to.
+func New(token string, folderID int64) *Client {
+	return &Client{
+		token:      token,
+		folderID:   folderID,
+		baseURL:    baseURL,
+		httpClient: &http.Client{Timeout: requestTimeout, Transport: metrics.Transport(Name, nil)},
+		torrents:   make(map[int64]string),
+		files:      make(map[int64]fileRef),
+	}
+}
+
+// Name identifies Real-Debrid as provider
+func (c *Client) Name() string {
+	return Name
+}
+
+// Authenticate checks the API token by fetching the user
+func (c *Client) Authenticate(ctx context.Context) error {
+	var user struct {
+		Username string `json:"username"`
+		Type     string `json:"type"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/user", nil, "", &user); err != nil {
+		return fmt.Errorf("authentication failed: %w", err)
+	}
+	if user.Type != "premium" {
+		log.Warn("realdebrid").Str("username", user.Username).Msg("Real-Debrid account is not premium, downloads will fail")
+	}
+	return nil
+}
+
+// ListTransfers returns all torrents of the account. Torrents waiting for
+// their files to be selected get all files selected.
+func (c *Client) ListTransfers(ctx context.Context) ([]*putio.Transfer, error) {
+	var transfers []*putio.Transfer
+	for page := 1; ; page++ {
+		var torrents []torrent
+		query := fmt.Sprintf("/torrents?page=%d&limit=%d", page, pageSize)
+		if err := c.do(ctx, http.MethodGet, query, nil, "", &torrents); err != nil {
+			return nil, err
+		}
+		for _, t := range torrents {
+			if t.Status == "waiting_files_selection" {
+				c.selectFiles(ctx, t.ID)
+			}
+			transfers = append(transfers, c.transfer(t))
+		}
+		if len(torrents) < pageSize {
+			return transfers, nil
+		}
+	}
+}
+
+// selectFiles selects all files of a torrent for download, which
+// Real-Debrid requires before it starts
+func (c *Client) selectFiles(ctx context.Context, torrentID string) {
+	form := url.Values{"files": {"all"}}
+	if err := c.do(ctx, http.MethodPost, "/torrents/selectFiles/"+torrentID, strings.NewReader(form.Encode()), "application/x-www-form-urlencoded", nil); err != nil {
+		log.Error("realdebrid").Str("torrent_id", torrentID).Err(err).Msg("Failed to select files")
+		return
+	}
+	log.Debug("realdebrid").Str("torrent_id", torrentID).Msg("Selected all files")
+}
+
+// transfer maps a torrent onto a put.io transfer and remembers its IDs
+func (c *Client) transfer(t torrent) *putio.Transfer {
+	transfer := &putio.Transfer{
+		ID:            c.remember(t.ID, "transfer"),
+		Name:          t.Filename,
+		Hash:          t.Hash,
+		Size:          int(t.Bytes),
+		PercentDone:   int(t.Progress),
+		Status:        transferStatus(t.Status),
+		StatusMessage: t.Status,
+		DownloadSpeed: t.Speed,
+		SaveParentID:  c.folderID,
+		Source:        Name,
+	}
+	transfer.PeersSendingToUs = t.Seeders
+	if transfer.Status == "ERROR" {
+		transfer.ErrorMessage = "Real-Debrid: " + strings.ReplaceAll(t.Status, "_", " ")
+	}
+	if transfer.Status == "COMPLETED" {
+		transfer.FileID = c.remember(t.ID, "folder")
+	}
+	if added, err := time.Parse(time.RFC3339, t.Added); err == nil {
+		transfer.CreatedAt = &putio.Time{Time: added}
+	}
+	return transfer
+}
+
+// transferStatus maps a Real-Debrid torrent status onto a put.io transfer status
+func transferStatus(status string) string {
+	switch status {
+	case "downloaded":
+		return "COMPLETED"
+	case "downloading", "compressing", "uploading":
+		return "DOWNLOADING"
+	case "magnet_error", "error", "virus", "dead":
+		return "ERROR"
+	default: // magnet_conversion, waiting_files_selection, queued
+		return "IN_QUEUE"
+	}
+}
+
+// id derives a stable positive ID from a Real-Debrid torrent ID
+func id(kind, torrentID string, index int) int64 {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s:%s:%d", kind, torrentID, index)
+	return int64(h.Sum64() & (1<<63 - 1))
+}
+
+// remember returns the transfer or folder ID of a torrent and remembers it
+func (c *Client) remember(torrentID, kind string) int64 {
+	transferID := id(kind, torrentID, 0)
+	c.mu.Lock()
+	c.torrents[transferID] = torrentID
+	c.mu.Unlock()
+	return transferID
+}
+
+// torrentID returns the torrent of a transfer or folder ID
+func (c *Client) torrentID(transferID int64) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	torrentID, ok := c.torrents[transferID]
+	return torrentID, ok
+}
+
+// AddTransfer adds a torrent from a magnet link. Real-Debrid does not fetch
+// other URLs as transfers.
+func (c *Client) AddTransfer(ctx context.Context, link string, folderID int64) error {
+	if !strings.HasPrefix(link, "magnet:") {
+		return fmt.Errorf("Real-Debrid only accepts magnet links and torrent files")
+	}
+	form := url.Values{"magnet": {link}}
+	return c.do(ctx, http.MethodPost, "/torrents/addMagnet", strings.NewReader(form.Encode()), "application/x-www-form-urlencoded", nil)
+}
+
+// AddTorrent adds a torrent from the contents of a .torrent file
+func (c *Client) AddTorrent(ctx context.Context, data []byte, filename string, folderID int64) error {
+	return c.do(ctx, http.MethodPut, "/torrents/addTorrent", bytes.NewReader(data), "application/x-bittorrent", nil)
+}
+
+// DeleteTransfer deletes a torrent. Torrents that are already gone are not an error.
+func (c *Client) DeleteTransfer(ctx context.Context, transferID int64) error {
+	torrentID, ok := c.torrentID(transferID)
+	if !ok {
+		return nil
+	}
+	err := c.do(ctx, http.MethodDelete, "/torrents/delete/"+torrentID, nil, "", nil)
+	if isNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// DeleteFile deletes the torrent of a folder. Single files cannot be
+// deleted on Real-Debrid and are left alone.
+func (c *Client) DeleteFile(ctx context.Context, fileID int64) error {
+	return c.DeleteTransfer(ctx, fileID)
+}
+
+// GetFile returns the folder of a torrent or one of its files
+func (c *Client) GetFile(ctx context.Context, fileID int64) (*putio.File, error) {
+	if torrentID, ok := c.torrentID(fileID); ok {
+		info, err := c.info(ctx, torrentID)
+		if err != nil {
+			return nil, err
+		}
+		return &putio.File{
+			ID:          fileID,
+			Name:        info.Filename,
+			Size:        info.Bytes,
+			ContentType: "application/x-directory",
+			ParentID:    c.folderID,
+		}, nil
+	}
+
+	c.mu.Lock()
+	ref, ok := c.files[fileID]
+	c.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: file %d", provider.ErrFileNotFound, fileID)
+	}
+	return &putio.File{ID: fileID, Name: ref.name, Size: ref.size}, nil
+}
+
+// GetAllTransferFiles returns the selected files of the torrent of a folder,
+// or the single file with fileID
+func (c *Client) GetAllTransferFiles(ctx context.Context, fileID int64) ([]*putio.File, error) {
+	torrentID, ok := c.torrentID(fileID)
+	if !ok {
+		file, err := c.GetFile(ctx, fileID)
+		if err != nil {
+			return nil, err
+		}
+		return []*putio.File{file}, nil
+	}
+
+	info, err := c.info(ctx, torrentID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Real-Debrid has a link for each selected file, in the same order
+	var files []*putio.File
+	link := 0
+	for _, f := range info.Files {
+		if f.Selected != 1 {
+			continue
+		}
+		if link >= len(info.Links) {
+			return nil, fmt.Errorf("Real-Debrid has no link for %s yet", f.Path)
+		}
+		ref := fileRef{
+			torrentID: torrentID,
+			name:      path.Base(f.Path),
+			size:      f.Bytes,
+			link:      info.Links[link],
+		}
+		link++
+
+		id := id("file", torrentID, f.ID)
+		c.mu.Lock()
+		c.files[id] = ref
+		c.mu.Unlock()
+		files = append(files, &putio.File{ID: id, Name: ref.name, Size: ref.size, ParentID: fileID})
+	}
+	return files, nil
+}
+
+// info returns a torrent with its files
+func (c *Client) info(ctx context.Context, torrentID string) (*torrentInfo, error) {
+	var info torrentInfo
+	if err := c.do(ctx, http.MethodGet, "/torrents/info/"+torrentID, nil, "", &info); err != nil {
+		if isNotFound(err) {
+			return nil, fmt.Errorf("%w: %v", provider.ErrFileNotFound, err)
+		}
+		return nil, err
+	}
+	return &info, nil
+}
+
+// GetDownloadURL unrestricts the link of a file into a direct download URL
+func (c *Client) GetDownloadURL(ctx context.Context, fileID int64) (string, error) {
+	c.mu.Lock()
+	ref, ok := c.files[fileID]
+	c.mu.Unlock()
+	if !ok {
+		return "", fmt.Errorf("%w: file %d", provider.ErrFileNotFound, fileID)
+	}
+
+	var unrestricted struct {
+		Download string `json:"download"`
+	}
+	form := url.Values{"link": {ref.link}}
+	err := c.do(ctx, http.MethodPost, "/unrestrict/link", strings.NewReader(form.Encode()), "application/x-www-form-urlencoded", &unrestricted)
+	if err != nil {
+		if isNotFound(err) {
+			return "", fmt.Errorf("%w: %v", provider.ErrFileNotFound, err)
+		}
+		return "", err
+	}
+	return unrestricted.Download, nil
+}
+
+// isNotFound reports whether the Real-Debrid API answered with 404 Not Found
+func isNotFound(err error) bool {
+	var apiErr *apiError
+	return errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound
+}
+
+// do calls an API endpoint and decodes the JSON response into v if given
+func (c *Client) do(ctx context.Context, method, endpoint string, body io.Reader, contentType string, v interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+endpoint, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		apiErr := &apiError{Status: resp.StatusCode}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(data, apiErr) != nil || apiErr.Message == "" {
+			apiErr.Message = strings.TrimSpace(string(data))
+		}
+		return apiErr
+	}
+	if v == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,155 @@
+package push
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"testing"
+)
+
+// decodeTest decodes base64url test data
+func decodeTest(t *testing.T, s string) []byte {
+	t.Helper()
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// decrypt decrypts a message as the browser does, the reverse of encrypt
+func decrypt(t *testing.T, message []byte, userKey *ecdh.PrivateKey, authSecret []byte) []byte {
+	t.Helper()
+	if len(message) < 21 || len(message) < 21+int(message[20]) {
+		t.Fatalf("message of %d bytes is too short", len(message))
+	}
+	salt := message[:16]
+	if rs := binary.BigEndian.Uint32(message[16:20]); rs != recordSize {
+		t.Errorf("record size = %d, want %d", rs, recordSize)
+	}
+	serverKey, err := ecdh.P256().NewPublicKey(message[21 : 21+int(message[20])])
+	if err != nil {
+		t.Fatal(err)
+	}
+	shared, err := userKey.ECDH(serverKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyInfo := append([]byte("WebPush: info\x00"), userKey.PublicKey().Bytes()...)
+	keyInfo = append(keyInfo, serverKey.Bytes()...)
+	ikm := hkdf(authSecret, shared, keyInfo, 32)
+	block, err := aes.NewCipher(hkdf(salt, ikm, []byte("Content-Encoding: aes128gcm\x00"), 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := gcm.Open(nil, hkdf(salt, ikm, []byte("Content-Encoding: nonce\x00"), 12), message[21+int(message[20]):], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, found := bytes.CutSuffix(plaintext, []byte{0x02})
+	if !found {
+		t.Fatal("record does not end with the last record delimiter")
+	}
+	return payload
+}
+
+func TestSealRFC8291Example(t *testing.T) {
+	// The example of RFC 8291, section 5
+	serverKey, err := ecdh.P256().NewPrivateKey(decodeTest(t, "yfWPiYE-n46HLnH0KqZOF1fJJU3MYrct3AELtAQ-oRw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	userPublic, err := ecdh.P256().NewPublicKey(decodeTest(t, "BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	authSecret := decodeTest(t, "BTBZMqHH6r4Tts7J_aSIgg")
+	salt := decodeTest(t, "DGv6ra1nlYgDCS1FRnbzlw")
+	payload := []byte("When I grow up, I want to be a watermelon")
+
+	got, err := seal(payload, userPublic, authSecret, serverKey, salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "DGv6ra1nlYgDCS1FRnbzlwAAEABBBP4z9KsN6nGRTbVYI_c7VJSPQTBtkgcy27mlmlMoZIIgDll6e3vCYLocInmYWAmS6TlzAC8wEqKK6PBru3jl7A_yl95bQpu6cVPTpK4Mqgkf1CXztLVBSt2Ks3oZwbuwXPXLWyouBWLVWGNWQexSgSxsj_Qulcy4a-fN"
+	if encoded := base64.RawURLEncoding.EncodeToString(got); encoded != want {
+		t.Errorf("message = %s\nwant      %s", encoded, want)
+	}
+	if string(payload) != "When I grow up, I want to be a watermelon" {
+		t.Error("seal changed the payload")
+	}
+
+	userKey, err := ecdh.P256().NewPrivateKey(decodeTest(t, "q1dXpw3UpT5VOmu_cf_v6ih07Aems3njxI-JWgLcM94"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decrypted := decrypt(t, got, userKey, authSecret); !bytes.Equal(decrypted, payload) {
+		t.Errorf("decrypted %q, want %q", decrypted, payload)
+	}
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	userKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authSecret := make([]byte, 16)
+	rand.Read(authSecret)
+	keys := Keys{
+		P256dh: base64.RawURLEncoding.EncodeToString(userKey.PublicKey().Bytes()),
+		Auth:   base64.URLEncoding.EncodeToString(authSecret), // padded, as some browsers send it
+	}
+
+	payload := []byte(`{"title":"Download completed","body":"Show S01E01"}`)
+	first, err := encrypt(payload, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := decrypt(t, first, userKey, authSecret); !bytes.Equal(got, payload) {
+		t.Errorf("decrypted %q, want %q", got, payload)
+	}
+
+	// Every message has its own salt and key
+	second, err := encrypt(payload, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(first[:16], second[:16]) || bytes.Equal(first, second) {
+		t.Error("two messages share their salt")
+	}
+}
+
+func TestEncryptErrors(t *testing.T) {
+	userKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p256dh := base64.RawURLEncoding.EncodeToString(userKey.PublicKey().Bytes())
+	auth := base64.RawURLEncoding.EncodeToString(make([]byte, 16))
+
+	for _, tt := range []struct {
+		name    string
+		payload []byte
+		keys    Keys
+	}{
+		{"invalid key", nil, Keys{P256dh: "!", Auth: auth}},
+		{"key not on the curve", nil, Keys{P256dh: base64.RawURLEncoding.EncodeToString(make([]byte, 65)), Auth: auth}},
+		{"short auth secret", nil, Keys{P256dh: p256dh, Auth: "AAAA"}},
+		{"payload too large", make([]byte, recordSize), Keys{P256dh: p256dh, Auth: auth}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := encrypt(tt.payload, tt.keys); err == nil {
+				t.Error("encrypt succeeded")
+			}
+		})
+	}
+}
@@ -0,0 +1,294 @@
+package push
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/events"
+	"github.com/elsbrock/plundrio/internal/log"
+	"github.com/elsbrock/plundrio/internal/notify"
+	"github.com/elsbrock/plundrio/internal/state"
+)
+
+// State is the name of the state document holding the VAPID key and the
+// subscribed browsers
+const State = "push"
+
+// messageTTL is how long a push service keeps a notification for a browser
+// that is offline
+const messageTTL = 24 * time.Hour
+
+// Keys are the keys a browser encrypts its notifications with
+type Keys struct {
+	P256dh string `json:"p256dh"`
+	Auth   string `json:"auth"`
+}
+
+// Subscription is a browser subscribed to notifications, as returned by the
+// browser's PushManager
+type Subscription struct {
+	Endpoint  string    `json:"endpoint"`
+	Keys      Keys      `json:"keys"`
+	User      string    `json:"user,omitempty"` // API user subscribed, who only gets their own transfers
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Document is the state kept between runs
+type Document struct {
+	VAPIDKey      string         `json:"vapid_key"` // PKCS #8, base64
+	Subscriptions []Subscription `json:"subscriptions"`
+}
+
+// Message is the payload the service worker shows as notification
+type Message struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+	Tag   string `json:"tag,omitempty"` // replaces an earlier notification with the same tag
+	URL   string `json:"url"`           // opened when the notification is clicked
+}
+
+// Pusher sends Web Push notifications to browsers that subscribed on the dashboard
+type Pusher struct {
+	subject    string
+	key        *ecdsa.PrivateKey
+	publicKey  string // uncompressed point, base64url
+	httpClient *http.Client
+
+	mu            sync.Mutex
+	store         *state.Store // nil without a state directory
+	subscriptions []Subscription
+}
+
+// New loads the VAPID key and subscriptions from the state directory, creating
+// a key on first use. Without a state directory the key and subscriptions only
+// last until plundrio stops. subject is the contact push services reach the
+// operator at, a mailto: or https: URL.
+func New(stateDir, subject string) (*Pusher, error) {
+	if !strings.HasPrefix(subject, "mailto:") && !strings.HasPrefix(subject, "https:") {
+		return nil, fmt.Errorf("push subject must be a mailto: or https: URL")
+	}
+
+	p := &Pusher{
+		subject:    subject,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+
+	var doc Document
+	if stateDir != "" {
+		store, err := state.New(stateDir)
+		if err != nil {
+			return nil, err
+		}
+		if err := store.Load(State, &doc); err != nil {
+			return nil, err
+		}
+		p.store = store
+	}
+
+	if doc.VAPIDKey != "" {
+		der, err := base64.StdEncoding.DecodeString(doc.VAPIDKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid VAPID key: %w", err)
+		}
+		parsed, err := x509.ParsePKCS8PrivateKey(der)
+		if err != nil {
+			return nil, fmt.Errorf("invalid VAPID key: %w", err)
+		}
+		key, ok := parsed.(*ecdsa.PrivateKey)
+		if !ok || key.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("invalid VAPID key: not a P-256 key")
+		}
+		p.key = key
+		p.subscriptions = doc.Subscriptions
+	} else {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate VAPID key: %w", err)
+		}
+		p.key = key
+		log.Info("push").Msg("Generated a new VAPID key, browsers need to subscribe again")
+	}
+
+	public, err := p.key.PublicKey.ECDH()
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID key: %w", err)
+	}
+	p.publicKey = base64.RawURLEncoding.EncodeToString(public.Bytes())
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.save(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// PublicKey returns the VAPID public key browsers subscribe with
+func (p *Pusher) PublicKey() string {
+	return p.publicKey
+}
+
+// save writes the key and subscriptions to the state directory. p.mu must be held.
+func (p *Pusher) save() error {
+	if p.store == nil {
+		return nil
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(p.key)
+	if err != nil {
+		return fmt.Errorf("failed to encode VAPID key: %w", err)
+	}
+	return p.store.Save(State, Document{
+		VAPIDKey:      base64.StdEncoding.EncodeToString(der),
+		Subscriptions: p.subscriptions,
+	})
+}
+
+// Subscribe adds a browser or replaces its earlier subscription
+func (p *Pusher) Subscribe(sub Subscription) error {
+	if !strings.HasPrefix(sub.Endpoint, "https://") {
+		return fmt.Errorf("endpoint must be an https URL")
+	}
+	if _, err := encrypt(nil, sub.Keys); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.remove(sub.Endpoint)
+	sub.CreatedAt = time.Now()
+	p.subscriptions = append(p.subscriptions, sub)
+	if err := p.save(); err != nil {
+		log.Warn("push").Err(err).Msg("Failed to save push subscriptions")
+	}
+
+	log.Info("push").
+		Str("user", sub.User).
+		Int("subscriptions", len(p.subscriptions)).
+		Msg("Browser subscribed to notifications")
+	return nil
+}
+
+// Unsubscribe removes a browser and reports whether it was subscribed
+func (p *Pusher) Unsubscribe(endpoint string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.remove(endpoint) {
+		return false
+	}
+	if err := p.save(); err != nil {
+		log.Warn("push").Err(err).Msg("Failed to save push subscriptions")
+	}
+	return true
+}
+
+// remove drops the subscription of endpoint. p.mu must be held.
+func (p *Pusher) remove(endpoint string) bool {
+	for i, sub := range p.subscriptions {
+		if sub.Endpoint == endpoint {
+			p.subscriptions = append(p.subscriptions[:i], p.subscriptions[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Subscriptions returns how many browsers are subscribed
+func (p *Pusher) Subscriptions() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.subscriptions)
+}
+
+// HandleEvent notifies subscribed browsers of completed and failed transfers.
+// Browsers subscribed by an API user only hear of that user's transfers.
+func (p *Pusher) HandleEvent(e events.Event) {
+	msg := Message{Title: "Download completed", Tag: fmt.Sprintf("transfer-%d", e.TransferID), URL: "/"}
+	switch e.Type {
+	case events.TransferCompleted:
+		msg.Body = fmt.Sprintf("%s (%s)", e.Name, notify.FormatSize(e.Size))
+	case events.TransferFailed, events.TransferErrored:
+		msg.Title = "Download failed"
+		msg.Body = e.Name
+		if e.Error != "" {
+			msg.Body += ": " + e.Error
+		}
+	default:
+		return
+	}
+
+	p.mu.Lock()
+	var targets []Subscription
+	for _, sub := range p.subscriptions {
+		if sub.User == "" || sub.User == e.RequestedBy {
+			targets = append(targets, sub)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, sub := range targets {
+		p.Send(sub, msg)
+	}
+}
+
+// Send delivers a notification to one browser. Subscriptions the push
+// service no longer knows are removed; other failures are logged, not returned.
+func (p *Pusher) Send(sub Subscription, msg Message) {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	body, err := encrypt(payload, sub.Keys)
+	if err != nil {
+		log.Error("push").Err(err).Msg("Failed to encrypt notification")
+		return
+	}
+	auth, err := vapidAuthorization(p.key, p.publicKey, sub.Endpoint, p.subject)
+	if err != nil {
+		log.Error("push").Err(err).Msg("Failed to sign notification")
+		return
+	}
+
+	req, err := http.NewRequest(http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		log.Error("push").Err(err).Msg("Failed to send notification")
+		return
+	}
+	req.Header.Set("Authorization", auth)
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", fmt.Sprint(int(messageTTL.Seconds())))
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		log.Error("push").Err(err).Msg("Failed to send notification")
+		return
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		// The browser unsubscribed or the subscription expired
+		p.Unsubscribe(sub.Endpoint)
+		log.Info("push").Str("user", sub.User).Msg("Removed expired push subscription")
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		log.Error("push").
+			Int("status", resp.StatusCode).
+			Str("title", msg.Title).
+			Msg("Push service rejected notification")
+	default:
+		log.Debug("push").
+			Str("title", msg.Title).
+			Str("user", sub.User).
+			Msg("Notification pushed")
+	}
+}
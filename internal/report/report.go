@@ -0,0 +1,195 @@
+package report
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/config"
+	"github.com/elsbrock/plundrio/internal/events"
+	"github.com/elsbrock/plundrio/internal/notify"
+)
+
+// topCategories is how many categories a summary lists
+const topCategories = 5
+
+// CategoryCount is the number of downloads and bytes of one category
+type CategoryCount struct {
+	Name      string
+	Downloads int
+	Bytes     int64
+}
+
+// Summary describes the activity of one report period
+type Summary struct {
+	Period       string
+	Start        time.Time
+	End          time.Time
+	Completed    int
+	Failed       int
+	Bytes        int64
+	AverageSpeed float64         // Bytes per second over the time spent downloading
+	Categories   []CategoryCount // Categories with the most downloads first
+	Failures     []string        // Names of failed transfers
+}
+
+// Title returns a one-line title for the summary
+func (s Summary) Title() string {
+	return fmt.Sprintf("plundrio %s summary for %s", s.Period, s.Start.Format("2006-01-02"))
+}
+
+// Text renders the summary as human-readable text
+func (s Summary) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s to %s\n", s.Start.Format("2006-01-02 15:04"), s.End.Format("2006-01-02 15:04"))
+	fmt.Fprintf(&b, "Downloads completed: %d\n", s.Completed)
+	fmt.Fprintf(&b, "Failures: %d\n", s.Failed)
+	fmt.Fprintf(&b, "Downloaded: %s\n", notify.FormatSize(s.Bytes))
+	if s.Completed > 0 {
+		fmt.Fprintf(&b, "Average speed: %s/s\n", notify.FormatSize(int64(s.AverageSpeed)))
+	}
+	if len(s.Categories) > 0 {
+		b.WriteString("Top categories:\n")
+		for _, c := range s.Categories {
+			fmt.Fprintf(&b, "  %s: %d (%s)\n", c.Name, c.Downloads, notify.FormatSize(c.Bytes))
+		}
+	}
+	if len(s.Failures) > 0 {
+		b.WriteString("Failed transfers:\n")
+		for _, name := range s.Failures {
+			fmt.Fprintf(&b, "  %s\n", name)
+		}
+	}
+	return b.String()
+}
+
+// Collector counts transfer events and turns them into a summary at the end
+// of each report period
+type Collector struct {
+	period string
+
+	mu         sync.Mutex
+	start      time.Time
+	completed  int
+	bytes      int64
+	downloaded time.Duration
+	categories map[string]*CategoryCount
+	failures   []string
+}
+
+// NewCollector creates a collector for a daily or weekly period starting now
+func NewCollector(period string) *Collector {
+	c := &Collector{period: period}
+	c.reset(time.Now())
+	return c
+}
+
+// HandleEvent counts completed, failed and errored transfers
+func (c *Collector) HandleEvent(e events.Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch e.Type {
+	case events.TransferCompleted:
+		c.completed++
+		c.bytes += e.Size
+		c.downloaded += e.Duration
+
+		name := e.Category
+		if name == "" {
+			name = "default"
+		}
+		category, ok := c.categories[name]
+		if !ok {
+			category = &CategoryCount{Name: name}
+			c.categories[name] = category
+		}
+		category.Downloads++
+		category.Bytes += e.Size
+
+	case events.TransferFailed, events.TransferErrored:
+		c.failures = append(c.failures, e.Name)
+	}
+}
+
+// Summary returns the activity counted since the period started, up to end
+func (c *Collector) Summary(end time.Time) Summary {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.summary(end)
+}
+
+// summary builds the summary of the current period. The caller must hold mu.
+func (c *Collector) summary(end time.Time) Summary {
+	s := Summary{
+		Period:    c.period,
+		Start:     c.start,
+		End:       end,
+		Completed: c.completed,
+		Failed:    len(c.failures),
+		Bytes:     c.bytes,
+		Failures:  append([]string(nil), c.failures...),
+	}
+	if c.downloaded > 0 {
+		s.AverageSpeed = float64(c.bytes) / c.downloaded.Seconds()
+	}
+
+	for _, category := range c.categories {
+		s.Categories = append(s.Categories, *category)
+	}
+	sort.Slice(s.Categories, func(i, j int) bool {
+		if s.Categories[i].Downloads != s.Categories[j].Downloads {
+			return s.Categories[i].Downloads > s.Categories[j].Downloads
+		}
+		return s.Categories[i].Name < s.Categories[j].Name
+	})
+	if len(s.Categories) > topCategories {
+		s.Categories = s.Categories[:topCategories]
+	}
+	return s
+}
+
+// Run delivers a summary at the end of every period until stop is closed
+func (c *Collector) Run(stop <-chan struct{}, deliver func(Summary)) {
+	for {
+		end := nextBoundary(c.period, time.Now())
+		timer := time.NewTimer(time.Until(end))
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		c.mu.Lock()
+		summary := c.summary(end)
+		c.reset(end)
+		c.mu.Unlock()
+		deliver(summary)
+	}
+}
+
+// reset starts a new period. The caller must hold mu unless the collector is
+// not shared yet.
+func (c *Collector) reset(start time.Time) {
+	c.start = start
+	c.completed = 0
+	c.bytes = 0
+	c.downloaded = 0
+	c.categories = make(map[string]*CategoryCount)
+	c.failures = nil
+}
+
+// nextBoundary returns the next local midnight, or the next Monday midnight
+// for weekly reports
+func nextBoundary(period string, now time.Time) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+	if period == config.ReportPeriodWeekly {
+		for next.Weekday() != time.Monday {
+			next = next.AddDate(0, 0, 1)
+		}
+	}
+	return next
+}
@@ -0,0 +1,293 @@
+// Package scheduler runs recurring actions on cron expressions or fixed
+// intervals, so periodic work shares one timer instead of a ticker each
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/config"
+	"github.com/elsbrock/plundrio/internal/cron"
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// everyPrefix starts a fixed interval instead of a cron expression
+const everyPrefix = "@every "
+
+// Action is work a schedule can run. It should return once ctx is done.
+type Action func(ctx context.Context) error
+
+// Entry describes a schedule and when its action ran last
+type Entry struct {
+	Action    string     `json:"action"`
+	Cron      string     `json:"cron"`
+	Builtin   bool       `json:"builtin"` // derived from an interval option, not changeable through the API
+	NextRun   *time.Time `json:"next_run,omitempty"`
+	LastRun   *time.Time `json:"last_run,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+	Running   bool       `json:"running"`
+}
+
+// timing decides when a schedule is due
+type timing struct {
+	cron  *cron.Schedule // nil for fixed intervals
+	every time.Duration
+}
+
+// parseTiming parses a cron expression or "@every <duration>"
+func parseTiming(spec string) (timing, error) {
+	if rest, ok := strings.CutPrefix(strings.TrimSpace(spec), everyPrefix); ok {
+		every, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil || every < time.Minute {
+			return timing{}, fmt.Errorf("invalid interval %q: use a duration of at least 1m", spec)
+		}
+		return timing{every: every}, nil
+	}
+	schedule, err := cron.Parse(spec)
+	if err != nil {
+		return timing{}, err
+	}
+	return timing{cron: schedule}, nil
+}
+
+// Validate checks a schedule from the configuration: a known action and a
+// cron expression or "@every <duration>"
+func Validate(schedule config.Schedule) error {
+	if !slices.Contains(config.ScheduleActions, schedule.Action) {
+		return fmt.Errorf("unknown action %q (use %s)", schedule.Action, strings.Join(config.ScheduleActions, ", "))
+	}
+	_, err := parseTiming(schedule.Cron)
+	return err
+}
+
+// entry is a parsed schedule
+type entry struct {
+	config.Schedule
+	builtin bool
+	timing  timing
+	since   time.Time // minute of the last interval run, or when the schedule was set
+}
+
+// due reports whether the schedule runs in the minute now
+func (e *entry) due(now time.Time) bool {
+	if e.timing.cron != nil {
+		return e.timing.cron.Matches(now)
+	}
+	return now.Sub(e.since) >= e.timing.every
+}
+
+// next returns the next minute after now the schedule runs in
+func (e *entry) next(now time.Time) time.Time {
+	if e.timing.cron != nil {
+		return e.timing.cron.Next(now)
+	}
+	next := e.since.Add(e.timing.every)
+	if rounded := next.Truncate(time.Minute); rounded.Before(next) {
+		next = rounded.Add(time.Minute)
+	}
+	if !next.After(now) {
+		next = now.Truncate(time.Minute).Add(time.Minute)
+	}
+	return next
+}
+
+// run is the outcome of an action's last run
+type run struct {
+	at  time.Time
+	err error
+}
+
+// Scheduler runs registered actions whenever one of their schedules is due.
+// Schedules are checked at the start of every minute, and an action never
+// runs twice at once.
+type Scheduler struct {
+	mu      sync.Mutex
+	actions map[string]Action
+	entries []*entry
+	running map[string]bool
+	runs    map[string]run
+
+	ctx    context.Context // cancelled when Run returns
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New creates a scheduler without actions or schedules
+func New() *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{
+		actions: make(map[string]Action),
+		running: make(map[string]bool),
+		runs:    make(map[string]run),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// Register makes an action available to schedules
+func (s *Scheduler) Register(name string, action Action) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.actions[name] = action
+}
+
+// AddInterval runs an action at a fixed interval, for options such as
+// empty-trash-interval. Such schedules cannot be replaced with Set.
+func (s *Scheduler) AddInterval(action string, every time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, &entry{
+		Schedule: config.Schedule{Action: action, Cron: everyPrefix + every.String()},
+		builtin:  true,
+		timing:   timing{every: every},
+		since:    time.Now().Truncate(time.Minute),
+	})
+}
+
+// Set replaces all schedules except those added with AddInterval
+func (s *Scheduler) Set(schedules []config.Schedule) error {
+	now := time.Now().Truncate(time.Minute)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var entries []*entry
+	for _, e := range s.entries {
+		if e.builtin {
+			entries = append(entries, e)
+		}
+	}
+	for _, schedule := range schedules {
+		if _, ok := s.actions[schedule.Action]; !ok {
+			return fmt.Errorf("unknown action %q", schedule.Action)
+		}
+		t, err := parseTiming(schedule.Cron)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, &entry{Schedule: schedule, timing: t, since: now})
+	}
+	s.entries = entries
+	return nil
+}
+
+// Schedules returns the schedules that can be replaced with Set
+func (s *Scheduler) Schedules() []config.Schedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	schedules := make([]config.Schedule, 0, len(s.entries))
+	for _, e := range s.entries {
+		if !e.builtin {
+			schedules = append(schedules, e.Schedule)
+		}
+	}
+	return schedules
+}
+
+// Entries describes all schedules, including those added with AddInterval
+func (s *Scheduler) Entries() []Entry {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := make([]Entry, 0, len(s.entries))
+	for _, e := range s.entries {
+		entry := Entry{
+			Action:  e.Action,
+			Cron:    e.Cron,
+			Builtin: e.builtin,
+			Running: s.running[e.Action],
+		}
+		if next := e.next(now); !next.IsZero() {
+			entry.NextRun = &next
+		}
+		if last, ok := s.runs[e.Action]; ok {
+			entry.LastRun = &last.at
+			if last.err != nil {
+				entry.LastError = last.err.Error()
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// RunNow starts an action right away, outside of its schedules
+func (s *Scheduler) RunNow(action string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.actions[action]; !ok {
+		return fmt.Errorf("unknown action %q", action)
+	}
+	if s.running[action] {
+		return fmt.Errorf("%s is already running", action)
+	}
+	s.start(action, "")
+	return nil
+}
+
+// start runs an action in the background, spec is empty when run on request.
+// The caller must hold mu.
+func (s *Scheduler) start(action, spec string) {
+	fn := s.actions[action]
+	s.running[action] = true
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		if spec == "" {
+			log.Info("scheduler").Str("action", action).Msg("Running action on request")
+		} else {
+			log.Info("scheduler").Str("action", action).Str("cron", spec).Msg("Running scheduled action")
+		}
+		err := fn(s.ctx)
+		if err != nil {
+			log.Error("scheduler").Str("action", action).Err(err).Msg("Scheduled action failed")
+		}
+
+		s.mu.Lock()
+		s.running[action] = false
+		s.runs[action] = run{at: time.Now(), err: err}
+		s.mu.Unlock()
+	}()
+}
+
+// runDue starts the actions of all schedules due in the minute now
+func (s *Scheduler) runDue(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range s.entries {
+		if !e.due(now) {
+			continue
+		}
+		e.since = now
+		if s.running[e.Action] {
+			log.Debug("scheduler").Str("action", e.Action).Msg("Skipping scheduled action, still running")
+			continue
+		}
+		s.start(e.Action, e.Cron)
+	}
+}
+
+// Run checks the schedules at the start of every minute until stop is
+// closed, then cancels running actions and waits for them to return
+func (s *Scheduler) Run(stop <-chan struct{}) {
+	defer func() {
+		s.cancel()
+		s.wg.Wait()
+	}()
+
+	for {
+		now := time.Now()
+		timer := time.NewTimer(now.Truncate(time.Minute).Add(time.Minute).Sub(now))
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case now = <-timer.C:
+		}
+		s.runDue(now.Truncate(time.Minute))
+	}
+}
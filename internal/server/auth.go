@@ -0,0 +1,86 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/elsbrock/plundrio/internal/api"
+	"github.com/elsbrock/plundrio/internal/download"
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// Health states
+const (
+	healthOK             = "ok"
+	healthReauthenticate = "reauthenticate" // Put.io rejected the token
+)
+
+// HealthInfo describes whether plundrio can do its job
+type HealthInfo struct {
+	Status      string                    `json:"status"`
+	Maintenance bool                      `json:"maintenance"`
+	Auth        api.AuthState             `json:"auth"`
+	RetryBudget download.RetryBudgetState `json:"retry_budget"`
+}
+
+// handleHealth reports the health of plundrio. It answers 503 Service
+// Unavailable while Put.io rejects the token, so monitoring notices.
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	info := HealthInfo{
+		Status:      healthOK,
+		Maintenance: s.dlManager.InMaintenance(),
+		RetryBudget: s.dlManager.RetryBudget(),
+	}
+	if s.client != nil {
+		info.Auth = s.client.AuthState()
+	}
+	status := http.StatusOK
+	if info.Auth.Reauthenticate {
+		info.Status = healthReauthenticate
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(info)
+}
+
+// handleToken replaces the Put.io token without a restart.
+// It expects a POST with {"token": "..."}; the token is only used if Put.io accepts it.
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !s.requirePutio(w) {
+		return
+	}
+
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.client.SetToken(r.Context(), req.Token); err != nil {
+		if errors.Is(err, api.ErrTokenRejected) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	log.Info("auth").Msg("Put.io token replaced")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.client.AuthState())
+}
@@ -0,0 +1,290 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/elsbrock/plundrio/internal/download"
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// ConfigValue is a configuration value of the running daemon
+type ConfigValue struct {
+	Value   interface{} `json:"value"`
+	Mutable bool        `json:"mutable"` // Can be changed without a restart
+}
+
+// configSetting reads and, for settings that are safe to change while
+// running, applies a configuration value
+type configSetting struct {
+	get func() interface{}
+	set func(value string) error // nil if the setting requires a restart
+}
+
+// configSettings returns the settings exposed by the config API, keyed by
+// their name in the config file. Secrets such as the OAuth token, *arr API
+// keys and the notification webhook are left out.
+func (s *Server) configSettings() map[string]configSetting {
+	cfg := s.cfg
+	m := s.dlManager
+
+	// updateSettings changes a single runtime setting of the download manager
+	updateSettings := func(change func(*download.Settings) error) error {
+		settings := m.Settings()
+		if err := change(&settings); err != nil {
+			return err
+		}
+		return m.UpdateSettings(settings)
+	}
+
+	return map[string]configSetting{
+		"target":                {get: func() interface{} { return m.DefaultTargetDir() }},
+		"folder":                {get: func() interface{} { return cfg.PutioFolder }},
+		"provider":              {get: func() interface{} { return cfg.Provider }},
+		"fallback-providers":    {get: func() interface{} { return cfg.FallbackProviders }},
+		"provider-routes":       {get: func() interface{} { return cfg.ProviderRoutes }},
+		"listen":                {get: func() interface{} { return cfg.ListenAddr }},
+		"status-listen":         {get: func() interface{} { return cfg.StatusListen }},
+		"status-redact-names":   {get: func() interface{} { return cfg.StatusRedactNames }},
+		"workers":               {get: func() interface{} { return cfg.WorkerCount }},
+		"profile":               {get: func() interface{} { return cfg.Profile }},
+		"downloader":            {get: func() interface{} { return cfg.Downloader }},
+		"connections":           {get: func() interface{} { return cfg.Connections }},
+		"host-connections":      {get: func() interface{} { return cfg.HostConnections }},
+		"volume-writers":        {get: func() interface{} { return cfg.VolumeWriters }},
+		"volumes":               {get: func() interface{} { return cfg.VolumeLimits }},
+		"max-queued-jobs":       {get: func() interface{} { return cfg.MaxQueuedJobs }},
+		"max-load":              {get: func() interface{} { return cfg.MaxLoad }},
+		"max-memory-percent":    {get: func() interface{} { return cfg.MaxMemoryPercent }},
+		"max-disk-latency":      {get: func() interface{} { return cfg.MaxDiskLatency.String() }},
+		"empty-trash-interval":  {get: func() interface{} { return cfg.EmptyTrashInterval.String() }},
+		"mirrors":               {get: func() interface{} { return cfg.Mirrors }},
+		"mirror-interval":       {get: func() interface{} { return cfg.MirrorInterval.String() }},
+		"watch-dir":             {get: func() interface{} { return cfg.WatchDir }},
+		"watch-mode":            {get: func() interface{} { return cfg.WatchMode }},
+		"watch-poll-interval":   {get: func() interface{} { return cfg.WatchPollInterval.String() }},
+		"state-dir":             {get: func() interface{} { return cfg.StateDir }},
+		"disk-reserve-mb":       {get: func() interface{} { return cfg.DiskReserveMB }},
+		"history-days":          {get: func() interface{} { return cfg.HistoryDays }},
+		"migrate-mode":          {get: func() interface{} { return cfg.MigrateMode }},
+		"import-existing":       {get: func() interface{} { return cfg.ImportExisting }},
+		"target-type":           {get: func() interface{} { return cfg.TargetType }},
+		"incomplete-dir":        {get: func() interface{} { return cfg.IncompleteDir }},
+		"incomplete-suffix":     {get: func() interface{} { return cfg.IncompleteSuffix }},
+		"network-verify":        {get: func() interface{} { return cfg.NetworkVerify }},
+		"verify-checksums":      {get: func() interface{} { return cfg.VerifyChecksums }},
+		"collision-policy":      {get: func() interface{} { return cfg.CollisionPolicy }},
+		"copy-strategy":         {get: func() interface{} { return cfg.CopyStrategy }},
+		"retention-days":        {get: func() interface{} { return cfg.RetentionDays }},
+		"retention-categories":  {get: func() interface{} { return cfg.RetentionCategories }},
+		"category-speed-limits": {get: func() interface{} { return cfg.CategorySpeedLimits }},
+		"cleanup-on":            {get: func() interface{} { return cfg.CleanupOn }},
+		"push-subject":          {get: func() interface{} { return cfg.PushSubject }},
+		"progress-cloud-weight": {get: func() interface{} { return cfg.ProgressCloudWeight }},
+		"slow-speed-threshold":  {get: func() interface{} { return cfg.SlowSpeedThreshold }},
+		"slow-speed-duration":   {get: func() interface{} { return cfg.SlowSpeedDuration.String() }},
+		"max-retry-cycles":      {get: func() interface{} { return cfg.MaxRetryCycles }},
+		"retry-budget":          {get: func() interface{} { return cfg.RetryBudget }},
+		"partial-policy":        {get: func() interface{} { return cfg.PartialPolicy }},
+		"report-period":         {get: func() interface{} { return cfg.ReportPeriod }},
+		"report-file":           {get: func() interface{} { return cfg.ReportFile }},
+		"shared-target-dir":     {get: func() interface{} { return cfg.SharedTargetDir }},
+		"foreign-transfers":     {get: func() interface{} { return cfg.ForeignTransfers }},
+		"foreign-target-dir":    {get: func() interface{} { return cfg.ForeignTargetDir }},
+		"foreign-match":         {get: func() interface{} { return cfg.ForeignMatch }},
+		"cors-origins":          {get: func() interface{} { return cfg.CORSOrigins }},
+		"cors-headers":          {get: func() interface{} { return cfg.CORSHeaders }},
+		"api-users":             {get: func() interface{} { return cfg.APIUsers }},
+		"quota-action":          {get: func() interface{} { return cfg.QuotaAction }},
+		"log-level": {
+			get: func() interface{} { return log.GetLevel() },
+			set: func(value string) error {
+				level := log.LogLevel(value)
+				if level != log.LevelNone {
+					var err error
+					if level, err = log.ParseLevel(value); err != nil {
+						return err
+					}
+				}
+				log.SetLevel(level)
+				return nil
+			},
+		},
+		"speed-limit": {
+			get: func() interface{} { return m.Settings().SpeedLimit },
+			set: func(value string) error {
+				return updateSettings(func(settings *download.Settings) error {
+					limit, err := strconv.Atoi(value)
+					if err != nil {
+						return fmt.Errorf("invalid speed limit %q", value)
+					}
+					settings.SpeedLimit = limit
+					return nil
+				})
+			},
+		},
+		"alt-speed-limit": {
+			get: func() interface{} { return m.Settings().AltSpeedLimit },
+			set: func(value string) error {
+				return updateSettings(func(settings *download.Settings) error {
+					limit, err := strconv.Atoi(value)
+					if err != nil {
+						return fmt.Errorf("invalid speed limit %q", value)
+					}
+					settings.AltSpeedLimit = limit
+					return nil
+				})
+			},
+		},
+		"max-download-rate": {
+			get: func() interface{} { return m.Settings().MaxDownloadRate },
+			set: func(value string) error {
+				return updateSettings(func(settings *download.Settings) error {
+					rate, err := download.ParseRate(value)
+					if err != nil {
+						return err
+					}
+					settings.MaxDownloadRate = rate
+					return nil
+				})
+			},
+		},
+		"download-queue-size": {
+			get: func() interface{} { return m.Settings().DownloadQueueSize },
+			set: func(value string) error {
+				return updateSettings(func(settings *download.Settings) error {
+					size, err := strconv.Atoi(value)
+					if err != nil {
+						return fmt.Errorf("invalid queue size %q", value)
+					}
+					settings.DownloadQueueSize = size
+					return nil
+				})
+			},
+		},
+		"bandwidth-strategy": {
+			get: func() interface{} { return m.Settings().BandwidthStrategy },
+			set: func(value string) error {
+				return updateSettings(func(settings *download.Settings) error {
+					settings.BandwidthStrategy = value
+					return nil
+				})
+			},
+		},
+		"skip-trash": {
+			get: func() interface{} { return m.Settings().SkipTrash },
+			set: func(value string) error {
+				return updateSettings(func(settings *download.Settings) error {
+					skip, err := strconv.ParseBool(value)
+					if err != nil {
+						return fmt.Errorf("invalid boolean %q", value)
+					}
+					settings.SkipTrash = skip
+					return nil
+				})
+			},
+		},
+		"putio-debug": {
+			get: func() interface{} { return s.client != nil && s.client.Capturing() },
+			set: func(value string) error {
+				enabled, err := strconv.ParseBool(value)
+				if err != nil {
+					return fmt.Errorf("invalid boolean %q", value)
+				}
+				if s.client == nil {
+					return fmt.Errorf("put.io is not the provider")
+				}
+				s.client.SetCapture(enabled)
+				return nil
+			},
+		},
+		"retention-dry-run": {
+			get: func() interface{} { return m.Settings().RetentionDryRun },
+			set: func(value string) error {
+				return updateSettings(func(settings *download.Settings) error {
+					dryRun, err := strconv.ParseBool(value)
+					if err != nil {
+						return fmt.Errorf("invalid boolean %q", value)
+					}
+					settings.RetentionDryRun = dryRun
+					return nil
+				})
+			},
+		},
+	}
+}
+
+// handleConfig reads or changes configuration values of the running daemon.
+// GET returns all values, or a single one with ?key=name. POST with a JSON
+// body of the form {"key": "speed-limit", "value": "2048"} changes a value;
+// settings that require a restart are rejected with 409 Conflict.
+func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
+	settings := s.configSettings()
+
+	switch r.Method {
+	case http.MethodGet:
+		if key := r.URL.Query().Get("key"); key != "" {
+			setting, ok := settings[key]
+			if !ok {
+				http.Error(w, fmt.Sprintf("Unknown config key %q", key), http.StatusNotFound)
+				return
+			}
+			writeJSON(w, ConfigValue{Value: setting.get(), Mutable: setting.set != nil})
+			return
+		}
+
+		values := make(map[string]ConfigValue, len(settings))
+		for key, setting := range settings {
+			values[key] = ConfigValue{Value: setting.get(), Mutable: setting.set != nil}
+		}
+		writeJSON(w, values)
+
+	case http.MethodPost:
+		// Forms on other sites could change settings with the credentials
+		// the browser has for plundrio otherwise
+		if !isScriptRequest(r) {
+			http.Error(w, "Requests changing state need Content-Type: application/json or an X-Requested-With header", http.StatusUnsupportedMediaType)
+			return
+		}
+		var req struct {
+			Key   string `json:"key"`
+			Value string `json:"value"`
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxRequestBody)
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Key == "" {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		setting, ok := settings[req.Key]
+		if !ok {
+			http.Error(w, fmt.Sprintf("Unknown config key %q", req.Key), http.StatusNotFound)
+			return
+		}
+		if setting.set == nil {
+			http.Error(w, fmt.Sprintf("%s cannot be changed while running, edit the configuration and restart", req.Key), http.StatusConflict)
+			return
+		}
+		if err := setting.set(req.Value); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		log.Info("config").
+			Str("key", req.Key).
+			Str("value", req.Value).
+			Msg("Configuration changed through the API")
+		writeJSON(w, ConfigValue{Value: setting.get(), Mutable: true})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// writeJSON writes a value as JSON response
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
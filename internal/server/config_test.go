@@ -0,0 +1,44 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/elsbrock/plundrio/internal/config"
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+func TestHandleConfigPost(t *testing.T) {
+	defer log.SetLevel(log.GetLevel())
+	s := &Server{cfg: &config.Config{}}
+
+	for _, tt := range []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+	}{
+		{"json", "application/json", `{"key":"log-level","value":"warn"}`, http.StatusOK},
+		{"text form", "text/plain", `{"key":"log-level","value":"debug"}`, http.StatusUnsupportedMediaType},
+		{"url-encoded form", "application/x-www-form-urlencoded", "key=log-level&value=debug", http.StatusUnsupportedMediaType},
+		{"body too large", "application/json", `{"key":"log-level","value":"` + strings.Repeat("x", maxRequestBody) + `"}`, http.StatusBadRequest},
+		{"unknown key", "application/json", `{"key":"nope","value":"1"}`, http.StatusNotFound},
+		{"needs a restart", "application/json", `{"key":"workers","value":"1"}`, http.StatusConflict},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/config", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+			s.handleConfig(w, r)
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+		})
+	}
+	if got := log.GetLevel(); got != log.LevelWarn {
+		t.Errorf("log level = %s, want warn", got)
+	}
+}
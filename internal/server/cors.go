@@ -0,0 +1,56 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+)
+
+// withCORS adds CORS headers to API responses for the configured origins and
+// answers preflight requests, so browser apps on other origins can use the API
+func (s *Server) withCORS(next http.Handler) http.Handler {
+	if len(s.cfg.CORSOrigins) == 0 {
+		return next
+	}
+
+	allowHeaders := strings.Join(s.cfg.CORSHeaders, ", ")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" || !isAPIPath(r.URL.Path) || !s.corsAllowed(origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h := w.Header()
+		h.Add("Vary", "Origin")
+		h.Set("Access-Control-Allow-Origin", origin)
+
+		// Preflight requests are answered here instead of by the handler
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			h.Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+			if allowHeaders != "" {
+				h.Set("Access-Control-Allow-Headers", allowHeaders)
+			}
+			h.Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// corsAllowed reports whether an origin may call the API
+func (s *Server) corsAllowed(origin string) bool {
+	for _, allowed := range s.cfg.CORSOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// isAPIPath reports whether a path belongs to the API endpoints CORS applies to
+func isAPIPath(path string) bool {
+	return strings.HasPrefix(path, "/api/") || path == "/graphql" || strings.HasPrefix(path, "/graphql/")
+}
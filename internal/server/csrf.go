@@ -0,0 +1,44 @@
+package server
+
+import (
+	"mime"
+	"net/http"
+)
+
+// requestedWithHeader marks API requests sent by scripts. Like any custom
+// header, browsers only send it to another site after a CORS preflight.
+const requestedWithHeader = "X-Requested-With"
+
+// withCSRFProtection rejects API requests that change state unless they have
+// a JSON body or the X-Requested-With header. A page on another site can make
+// the browser send forms and simple requests with form or text bodies,
+// together with the credentials it has for plundrio, but not these without
+// the CORS preflight plundrio only answers for allowed origins.
+func withCSRFProtection(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isAPIPath(r.URL.Path) && !isSafeMethod(r.Method) && !isScriptRequest(r) {
+			http.Error(w, "Requests changing state need Content-Type: application/json or an X-Requested-With header", http.StatusUnsupportedMediaType)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isSafeMethod reports whether requests with the method only read state
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// isScriptRequest reports whether a request has a JSON body or the
+// X-Requested-With header, which a browser only sends for a script
+func isScriptRequest(r *http.Request) bool {
+	if r.Header.Get(requestedWithHeader) != "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/json"
+}
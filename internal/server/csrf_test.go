@@ -0,0 +1,52 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWithCSRFProtection(t *testing.T) {
+	handler := withCSRFProtection(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	for _, tt := range []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		requestedBy string
+		status      int
+	}{
+		{"json", http.MethodPost, "/api/token", "application/json", "", http.StatusNoContent},
+		{"json with charset", http.MethodPost, "/api/config", "application/json; charset=utf-8", "", http.StatusNoContent},
+		{"text form", http.MethodPost, "/api/token", "text/plain", "", http.StatusUnsupportedMediaType},
+		{"url-encoded form", http.MethodPost, "/api/config", "application/x-www-form-urlencoded", "", http.StatusUnsupportedMediaType},
+		{"multipart form", http.MethodPost, "/api/transfers/cancel", "multipart/form-data; boundary=x", "", http.StatusUnsupportedMediaType},
+		{"no body", http.MethodPost, "/api/scan", "", "", http.StatusUnsupportedMediaType},
+		{"no body from a script", http.MethodPost, "/api/scan", "", "fetch", http.StatusNoContent},
+		{"graphql form", http.MethodPost, "/graphql", "text/plain", "", http.StatusUnsupportedMediaType},
+		{"delete", http.MethodDelete, "/api/push/subscribe", "", "", http.StatusUnsupportedMediaType},
+		{"get", http.MethodGet, "/api/downloads", "", "", http.StatusNoContent},
+		{"preflight", http.MethodOptions, "/api/token", "", "", http.StatusNoContent},
+		{"transmission", http.MethodPost, "/transmission/rpc", "text/plain", "", http.StatusNoContent},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(`{"token":"x"}`))
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+			if tt.requestedBy != "" {
+				r.Header.Set("X-Requested-With", tt.requestedBy)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+		})
+	}
+}
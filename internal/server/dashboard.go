@@ -1,26 +1,133 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/elsbrock/go-putio"
 	"github.com/elsbrock/plundrio/internal/download"
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// Stages of a download shown on the dashboard
+const (
+	stageCloud = "cloud" // put.io is still working on the transfer
+	stageLocal = "local" // plundrio is downloading the files
 )
 
 // DownloadInfo represents a single active download for the dashboard
 type DownloadInfo struct {
+	ID              int64   `json:"id"`
 	Name            string  `json:"name"`
-	ProgressPercent float64 `json:"progress_percent"`
+	Stage           string  `json:"stage"`          // cloud or local
+	RemoteStatus    string  `json:"remote_status"`  // Transfer status on put.io, e.g. IN_QUEUE, DOWNLOADING, SEEDING, ERROR
+	RemoteMessage   string  `json:"remote_message"` // Status or error message from put.io
+	ErrorCode       string  `json:"error_code,omitempty"`
+	Provider        string  `json:"provider,omitempty"` // Provider the transfer was added to, only with fallback providers
+	DownloadDir     string  `json:"download_dir"`
+	ProgressPercent float64 `json:"progress_percent"`       // Local download progress
+	CloudProgress   float64 `json:"cloud_progress_percent"` // put.io's progress of the torrent
 	DownloadedMB    float64 `json:"downloaded_mb"`
 	TotalMB         float64 `json:"total_mb"`
 	SpeedMBps       float64 `json:"speed_mbps"`
 	ETA             string  `json:"eta"`
+	Paused          bool    `json:"paused"`
+	QueuePosition   int     `json:"queue_position,omitempty"` // place among transfers with queued files, starting at 1
+
+	ScheduledUntil  *time.Time `json:"scheduled_until,omitempty"`   // start of the next download window the download waits for
+	WaitingForSpace bool       `json:"waiting_for_space,omitempty"` // files wait until they fit on the disk
+
+	Notes       string            `json:"notes,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	RequestedBy string            `json:"requested_by,omitempty"` // API user the transfer was added by
+}
+
+// StatsInfo is the activity of the download manager together with the
+// combined speed and what is left of the whole queue
+type StatsInfo struct {
+	download.Stats
+	SpeedBps        float64 `json:"speed_bps"`        // current download speed of all transfers
+	QueuedBytes     int64   `json:"queued_bytes"`     // bytes left, including transfers put.io still fetches
+	QueuedTransfers int     `json:"queued_transfers"` // transfers with bytes left
+	ETASeconds      int64   `json:"eta_seconds"`      // time until the queue is downloaded, -1 while unknown
+	ETA             string  `json:"eta"`
+}
+
+// handleStats returns the manager's activity and the estimate for the whole queue
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	queue := s.dlManager.EstimateQueue()
+	info := StatsInfo{
+		Stats:           s.dlManager.Stats(),
+		SpeedBps:        queue.Speed,
+		QueuedBytes:     queue.QueuedBytes,
+		QueuedTransfers: queue.Transfers,
+		ETASeconds:      -1,
+		ETA:             "unknown",
+	}
+	if queue.Known {
+		info.ETASeconds = int64(queue.TimeLeft.Seconds())
+		info.ETA = formatDuration(int(info.ETASeconds))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
+
+// ThroughputInfo is the download speed history at one resolution
+type ThroughputInfo struct {
+	Resolution string                     `json:"resolution"`
+	Points     []download.ThroughputPoint `json:"points"`
+}
+
+// handleThroughput returns the download speed history of all transfers.
+// Query parameters: resolution (second, minute or hour; minute by default)
+// and period (how far back, e.g. 168h; everything kept by default).
+func (s *Server) handleThroughput(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	resolution := query.Get("resolution")
+	if resolution == "" {
+		resolution = download.ResolutionMinute
+	}
+	var since time.Time
+	if value := query.Get("period"); value != "" {
+		period, err := time.ParseDuration(value)
+		if err != nil || period <= 0 {
+			http.Error(w, "Invalid period parameter", http.StatusBadRequest)
+			return
+		}
+		since = time.Now().Add(-period)
+	}
+	points, err := s.dlManager.Throughput(resolution, since)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ThroughputInfo{Resolution: resolution, Points: points})
 }
 
-// handleDashboardAPI returns active downloads in JSON format
-func (s *Server) handleDashboardAPI(w http.ResponseWriter, r *http.Request) {
+// collectDownloads lists the transfers shown on the dashboard: those being
+// downloaded locally, ordered by ID, followed by those put.io is still
+// working on
+func (s *Server) collectDownloads() []DownloadInfo {
 	coordinator := s.dlManager.GetCoordinator()
 	downloads := make([]DownloadInfo, 0)
 
@@ -51,29 +158,439 @@ func (s *Server) handleDashboardAPI(w http.ResponseWriter, r *http.Request) {
 				}
 			}
 
-			downloads = append(downloads, DownloadInfo{
+			info := DownloadInfo{
+				ID:              ctx.ID,
 				Name:            ctx.Name,
+				Stage:           stageLocal,
+				Provider:        s.dlManager.ProviderOf(ctx.ID),
+				DownloadDir:     s.dlManager.TargetDir(ctx.ID),
 				ProgressPercent: progressPercent,
+				CloudProgress:   cloudProgress(ctx.Transfer) * 100,
 				DownloadedMB:    downloadedMB,
 				TotalMB:         totalMB,
 				SpeedMBps:       speedMBps,
 				ETA:             eta,
-			})
+				Paused:          s.dlManager.IsPaused(ctx.ID),
+				QueuePosition:   s.dlManager.QueuePosition(ctx.ID),
+			}
+			if until, ok := s.dlManager.ScheduledUntil(ctx.ID); ok {
+				info.ScheduledUntil = &until
+			}
+			info.WaitingForSpace = s.dlManager.WaitingForSpace(ctx.ID)
+			if ctx.Transfer != nil {
+				info.RemoteStatus = ctx.Transfer.Status
+				info.RemoteMessage = remoteMessage(ctx.Transfer)
+			}
+			if ctx.Error != nil {
+				info.ErrorCode = download.ErrorCode(ctx.Error)
+			}
+			info.Notes, info.Metadata, info.RequestedBy = s.annotation(ctx.ID)
+			downloads = append(downloads, info)
 		}
 	})
+	sort.Slice(downloads, func(i, j int) bool { return downloads[i].ID < downloads[j].ID })
+
+	// Add transfers that are not ready for download yet, or failed on put.io
+	if processor := s.dlManager.GetTransferProcessor(); processor != nil {
+		for _, t := range processor.GetTransfers() {
+			if _, exists := coordinator.GetTransferContext(t.ID); exists {
+				continue
+			}
+			if t.Status == "COMPLETED" || t.Status == "SEEDING" {
+				continue
+			}
+			eta := ""
+			if t.EstimatedTime > 0 {
+				eta = formatDuration(int(t.EstimatedTime))
+			}
+			notes, metadata, requestedBy := s.annotation(t.ID)
+			downloads = append(downloads, DownloadInfo{
+				ID:            t.ID,
+				Name:          t.Name,
+				Stage:         stageCloud,
+				Provider:      s.dlManager.ProviderOf(t.ID),
+				RemoteStatus:  t.Status,
+				RemoteMessage: remoteMessage(t),
+				ErrorCode:     s.errorCode(t),
+				DownloadDir:   s.dlManager.TargetDir(t.ID),
+				CloudProgress: float64(t.PercentDone),
+				TotalMB:       float64(t.Size) / 1024 / 1024,
+				SpeedMBps:     float64(t.DownloadSpeed) / 1024 / 1024,
+				ETA:           eta,
+				Paused:        s.dlManager.IsPaused(t.ID),
+				Notes:         notes,
+				Metadata:      metadata,
+				RequestedBy:   requestedBy,
+			})
+		}
+	}
+	return downloads
+}
+
+// annotation returns the notes and metadata attached to a transfer and the
+// user who added it
+func (s *Server) annotation(transferID int64) (string, map[string]string, string) {
+	note, _ := s.dlManager.Annotation(transferID)
+	return note.Notes, note.Metadata, note.RequestedBy
+}
+
+// remoteMessage returns the error message of a failed put.io transfer, or its status message
+func remoteMessage(t *putio.Transfer) string {
+	if t.ErrorMessage != "" {
+		return t.ErrorMessage
+	}
+	return t.StatusMessage
+}
+
+// errorCode returns the error code of a transfer: of its local download if
+// that failed, or remote-failed if put.io failed it
+func (s *Server) errorCode(t *putio.Transfer) string {
+	if ctx, ok := s.dlManager.GetCoordinator().GetTransferContext(t.ID); ok {
+		ctx.Mu.RLock()
+		err := ctx.Error
+		ctx.Mu.RUnlock()
+		if err != nil {
+			return download.ErrorCode(err)
+		}
+	}
+	if t.ErrorMessage != "" {
+		return download.ErrorCodeRemoteFailed
+	}
+	return ""
+}
+
+// handleTransferAdd adds a magnet link or an HTTP or FTP URL to Put.io, which
+// fetches it into the configured folder to be downloaded like any other transfer.
+// Transfers beyond the quota of the API user are refused, or accepted and
+// added in the background once the quota allows it with the queue action.
+// It expects a POST with a JSON body of the form {"url": "https://example.com/file.iso"},
+// an optional "category" to route the transfer to a provider and optional
+// "notes" and "metadata" to attach to it.
+func (s *Server) handleTransferAdd(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		URL      string            `json:"url"`
+		Category string            `json:"category"`
+		Notes    string            `json:"notes"`
+		Metadata map[string]string `json:"metadata"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || transferURLType(req.URL) == "" {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	note := download.Annotation{Notes: req.Notes, Metadata: req.Metadata, RequestedBy: requestUser(r)}
+	if err := s.dlManager.QuotaExceeded(note.RequestedBy); err != nil {
+		if !s.dlManager.QueuesOverQuota() {
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+		go func() {
+			if err := s.dlManager.AddTransfer(req.URL, req.Category, note); err != nil {
+				log.Error("server").Str("url", req.URL).Err(err).Msg("Failed to add transfer held back by quota")
+			}
+		}()
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	if err := s.dlManager.AddTransfer(req.URL, req.Category, note); err != nil {
+		if errors.Is(err, download.ErrQuotaExceeded) {
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+		log.Error("server").Str("url", req.URL).Err(err).Msg("Failed to add transfer")
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	log.Info("server").
+		Str("type", transferURLType(req.URL)).
+		Str("url", req.URL).
+		Str("user", requestUser(r)).
+		Int64("folder_id", s.cfg.FolderID).
+		Msg("Transfer added")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleTransferLocation changes the target directory of a transfer.
+// It expects a POST with a JSON body of the form {"id": 123, "location": "/path", "move": true}.
+func (s *Server) handleTransferLocation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		ID       int64  `json:"id"`
+		Location string `json:"location"`
+		Move     bool   `json:"move"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Location == "" {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	ctx, ok := s.dlManager.GetCoordinator().GetTransferContext(req.ID)
+	if !ok {
+		http.Error(w, "Transfer not found", http.StatusNotFound)
+		return
+	}
+
+	if err := s.dlManager.SetTargetDir(req.ID, ctx.Name, req.Location, req.Move); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleTransferNotes returns the notes and metadata of a transfer for a GET
+// with ?id=123, or replaces them for a POST with a JSON body of the form
+// {"id": 123, "notes": "...", "metadata": {"ticket": "42"}}. Empty notes and
+// metadata remove them.
+func (s *Server) handleTransferNotes(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid transfer ID", http.StatusBadRequest)
+			return
+		}
+		note, ok := s.dlManager.Annotation(id)
+		if !ok {
+			http.Error(w, "Transfer has no notes", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(note)
+
+	case http.MethodPost:
+		var req struct {
+			ID       int64             `json:"id"`
+			Notes    string            `json:"notes"`
+			Metadata map[string]string `json:"metadata"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID == 0 {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		for key := range req.Metadata {
+			if key == "" {
+				http.Error(w, "Metadata keys must not be empty", http.StatusBadRequest)
+				return
+			}
+		}
+		s.dlManager.SetAnnotation(req.ID, download.Annotation{Notes: req.Notes, Metadata: req.Metadata})
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleTransferPause pauses or resumes a transfer.
+// It expects a POST with a JSON body of the form {"id": 123}.
+func (s *Server) handleTransferPause(pause bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req struct {
+			ID int64 `json:"id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID == 0 {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		if pause {
+			s.dlManager.PauseTransfer(req.ID)
+		} else {
+			s.dlManager.ResumeTransfer(req.ID)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// handleTransferMove moves a transfer with queued files in the download queue.
+// It expects a POST with a JSON body of the form {"id": 123, "direction": "up"},
+// where direction is up, down, top or bottom.
+func (s *Server) handleTransferMove(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		ID        int64  `json:"id"`
+		Direction string `json:"direction"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID == 0 {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	switch req.Direction {
+	case download.MoveUp, download.MoveDown, download.MoveTop, download.MoveBottom:
+	default:
+		http.Error(w, "Invalid direction", http.StatusBadRequest)
+		return
+	}
+
+	if !s.dlManager.MoveInQueue(req.ID, req.Direction) {
+		http.Error(w, "Transfer has no queued files or cannot move further", http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleTransferCancel stops downloading a transfer and removes it from Put.io.
+// It expects a POST with a JSON body of the form {"id": 123, "delete_local_data": false}.
+func (s *Server) handleTransferCancel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		ID              int64 `json:"id"`
+		DeleteLocalData bool  `json:"delete_local_data"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID == 0 {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	transfer, err := s.findTransferByID(req.ID)
+	if err != nil {
+		http.Error(w, "Transfer not found", http.StatusNotFound)
+		return
+	}
+
+	s.removeTransfer(transfer, req.DeleteLocalData, "cancel")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleTransferRetry downloads the failed files of a failed or quarantined
+// transfer again. It expects a POST with a JSON body of the form {"id": 123}.
+func (s *Server) handleTransferRetry(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID == 0 {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.dlManager.RetryTransfer(req.ID); err != nil {
+		var downloadErr *download.DownloadError
+		if errors.As(err, &downloadErr) && downloadErr.Type == "TransferNotFound" {
+			http.Error(w, "Transfer not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// scanTimeout is how long a scan request waits for the put.io folder to be checked
+const scanTimeout = time.Minute
+
+// handleScan checks the put.io folder for new and finished transfers right
+// away instead of waiting for the next poll. It expects a POST and returns
+// once the folder was checked.
+func (s *Server) handleScan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), scanTimeout)
+	defer cancel()
+	if err := s.dlManager.Scan(ctx); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			http.Error(w, "Scan did not finish in time", http.StatusGatewayTimeout)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleRetentionReport returns the retention status of all local downloads.
+// It never deletes anything and can be used to preview the retention policy.
+func (s *Server) handleRetentionReport(w http.ResponseWriter, r *http.Request) {
+	report, err := s.dlManager.RetentionReport()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if report == nil {
+		report = []download.RetentionEntry{}
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(downloads)
+	json.NewEncoder(w).Encode(report)
+}
+
+// UnthrottleInfo describes the state of the temporary speed limit override
+type UnthrottleInfo struct {
+	Active bool   `json:"active"`
+	Until  string `json:"until,omitempty"`
+}
+
+// handleUnthrottle reports or changes the temporary speed limit override.
+// POST with ?minutes=N lifts the speed limit for N minutes, minutes=0 restores it.
+func (s *Server) handleUnthrottle(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		minutes, err := strconv.Atoi(r.URL.Query().Get("minutes"))
+		if err != nil || minutes < 0 {
+			http.Error(w, "Invalid minutes parameter", http.StatusBadRequest)
+			return
+		}
+		s.dlManager.Unthrottle(time.Duration(minutes) * time.Minute)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	info := UnthrottleInfo{}
+	if until := s.dlManager.UnthrottledUntil(); !until.IsZero() {
+		info.Active = true
+		info.Until = until.Format(time.RFC3339)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
 }
 
 // handleDashboard serves the dashboard HTML
 func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
 	html := `<!DOCTYPE html>
-<html>
+<html lang="{{lang}}">
 <head>
     <title>Plundrio Dashboard</title>
     <meta charset="UTF-8">
     <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <meta name="theme-color" content="#0f172a">
+    <link rel="manifest" href="/manifest.webmanifest">
+    <link rel="icon" href="/icon.svg" type="image/svg+xml">
+    <link rel="apple-touch-icon" href="/icon.svg">
     <style>
         * { margin: 0; padding: 0; box-sizing: border-box; }
         body {
@@ -104,18 +621,131 @@ func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
             font-size: 0.875rem;
             color: #94a3b8;
         }
+        .throughput {
+            background: #1e293b;
+            padding: 10px 20px;
+            border-radius: 8px;
+            border: 1px solid #334155;
+            margin-bottom: 20px;
+        }
+        .throughput-header {
+            display: flex;
+            align-items: center;
+            gap: 20px;
+            font-size: 0.875rem;
+            color: #94a3b8;
+        }
+        .throughput-header h2 {
+            font-size: 0.875rem;
+            font-weight: normal;
+        }
+        .throughput-header select {
+            margin-left: auto;
+        }
+        #throughput-chart {
+            width: 100%;
+            height: 60px;
+            margin-top: 8px;
+        }
+        .queue-stats {
+            display: flex;
+            gap: 20px;
+            background: #1e293b;
+            padding: 10px 20px;
+            border-radius: 8px;
+            border: 1px solid #334155;
+            margin-bottom: 20px;
+            font-size: 0.875rem;
+            color: #94a3b8;
+        }
         .active-count span {
             color: #667eea;
             font-weight: bold;
             font-size: 1.25rem;
             margin-right: 5px;
         }
+        .header-actions {
+            display: flex;
+            gap: 10px;
+            align-items: center;
+        }
+        .action-button {
+            background: #1e293b;
+            padding: 10px 20px;
+            border-radius: 8px;
+            border: 1px solid #334155;
+            font-size: 0.875rem;
+            color: #94a3b8;
+            cursor: pointer;
+        }
+        .action-button.active {
+            border-color: #10b981;
+            color: #10b981;
+        }
+        .auth-banner {
+            display: none;
+            justify-content: space-between;
+            align-items: center;
+            background: #450a0a;
+            border: 1px solid #dc2626;
+            border-radius: 8px;
+            padding: 10px 20px;
+            margin-bottom: 20px;
+            font-size: 0.875rem;
+            color: #fecaca;
+        }
+        .auth-banner.visible {
+            display: flex;
+        }
+        .backoff-banner {
+            display: none;
+            background: #451a03;
+            border: 1px solid #d97706;
+            border-radius: 8px;
+            padding: 10px 20px;
+            margin-bottom: 20px;
+            font-size: 0.875rem;
+            color: #fde68a;
+        }
+        .backoff-banner.visible {
+            display: block;
+        }
+        .provider-routes {
+            display: none;
+            margin-bottom: 20px;
+            font-size: 0.875rem;
+            color: #94a3b8;
+        }
+        .provider-routes.visible {
+            display: block;
+        }
         .downloads {
             background: #1e293b;
             border-radius: 10px;
             padding: 20px;
             border: 1px solid #334155;
         }
+        .tabs {
+            display: flex;
+            gap: 10px;
+            margin-bottom: 20px;
+        }
+        .history-filters {
+            display: flex;
+            gap: 10px;
+            margin-bottom: 15px;
+        }
+        .history-filters input {
+            flex: 1;
+        }
+        .history-pager {
+            display: flex;
+            justify-content: flex-end;
+            align-items: center;
+            gap: 10px;
+            font-size: 0.875rem;
+            color: #94a3b8;
+        }
         .download-item {
             background: #0f172a;
             padding: 15px;
@@ -140,6 +770,98 @@ func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
             height: 100%;
             transition: width 0.3s ease;
         }
+        .download-header {
+            display: flex;
+            justify-content: space-between;
+            align-items: baseline;
+        }
+        .progress-fill.cloud {
+            background: linear-gradient(90deg, #38bdf8 0%, #0ea5e9 100%);
+        }
+        .download-status {
+            font-size: 0.75rem;
+            color: #64748b;
+            margin-bottom: 6px;
+        }
+        .download-status.error {
+            color: #dc2626;
+        }
+        .download-dir {
+            font-size: 0.75rem;
+            color: #64748b;
+            cursor: pointer;
+        }
+        .download-notes {
+            display: block;
+            font-size: 0.75rem;
+            color: #94a3b8;
+            margin-bottom: 6px;
+            cursor: pointer;
+        }
+        .link-button {
+            background: none;
+            border: none;
+            padding: 0;
+            font-family: inherit;
+            text-align: left;
+        }
+        .download-actions {
+            display: flex;
+            gap: 8px;
+            margin-top: 10px;
+        }
+        .item-button {
+            background: #1e293b;
+            padding: 4px 12px;
+            border-radius: 6px;
+            border: 1px solid #334155;
+            font-size: 0.75rem;
+            color: #94a3b8;
+            cursor: pointer;
+        }
+        :focus-visible {
+            outline: 2px solid #667eea;
+            outline-offset: 2px;
+        }
+        .download-item:focus-visible {
+            border-color: #667eea;
+        }
+        .sr-only {
+            position: absolute;
+            width: 1px;
+            height: 1px;
+            overflow: hidden;
+            clip: rect(0 0 0 0);
+            white-space: nowrap;
+        }
+        .shortcuts {
+            background: #1e293b;
+            color: #e2e8f0;
+            border: 1px solid #334155;
+            border-radius: 10px;
+            padding: 20px;
+            margin: auto;
+        }
+        .shortcuts::backdrop {
+            background: rgba(15, 23, 42, 0.7);
+        }
+        .shortcuts h2 {
+            font-size: 1.125rem;
+            margin-bottom: 15px;
+        }
+        .shortcuts dl {
+            display: grid;
+            grid-template-columns: auto 1fr;
+            gap: 8px 20px;
+            margin-bottom: 20px;
+            font-size: 0.875rem;
+        }
+        .shortcuts kbd {
+            background: #0f172a;
+            border: 1px solid #334155;
+            border-radius: 4px;
+            padding: 2px 6px;
+        }
         .download-stats {
             display: flex;
             justify-content: space-between;
@@ -161,6 +883,10 @@ func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
             margin-left: 10px;
             animation: pulse 2s infinite;
         }
+        .refresh-indicator.paused {
+            background: #64748b;
+            animation: none;
+        }
         @keyframes pulse {
             0%, 100% { opacity: 1; }
             50% { opacity: 0.5; }
@@ -169,19 +895,146 @@ func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
 </head>
 <body>
     <div class="container">
-        <div class="header">
-            <h1>Plundrio Dashboard <span class="refresh-indicator"></span></h1>
-            <div class="active-count">
-                <span id="active-count">0</span> active downloads
+        <header class="header">
+            <h1><span data-i18n="title">Plundrio Dashboard</span> <span class="refresh-indicator" aria-hidden="true"></span></h1>
+            <div class="header-actions" role="toolbar" data-i18n-label="actions">
+                <select id="language" class="action-button" onchange="pickLanguage(this.value)" data-i18n-label="languageLabel"></select>
+                <select id="refresh" class="action-button" onchange="pickRefresh(this.value)" data-i18n-label="refreshLabel"></select>
+                <select id="user-filter" class="action-button" onchange="updateDashboard()" data-i18n-label="userFilter">
+                    <option value="" data-i18n="allUsers">All users</option>
+                </select>
+                <button id="push" class="action-button" onclick="togglePush()" data-i18n="enableNotifications" hidden>Enable notifications</button>
+                <button class="action-button" onclick="addTransfer()" data-i18n="addURL" aria-keyshortcuts="a">Add URL</button>
+                <button class="action-button" onclick="redownloadFile()" data-i18n="redownloadFile">Re-download file</button>
+                <button id="scan" class="action-button" onclick="scanFolder()" data-i18n="scan" aria-keyshortcuts="s">Scan put.io</button>
+                <button id="unthrottle" class="action-button" onclick="toggleUnthrottle()" data-i18n="unthrottle" aria-pressed="false">Unthrottle 30 min</button>
+                <button class="action-button" onclick="showShortcuts()" aria-keyshortcuts="?" data-i18n-label="shortcuts">?</button>
+                <div class="active-count">
+                    <span id="active-count">0</span> <span data-i18n="activeDownloads">active downloads</span>
+                </div>
             </div>
+        </header>
+
+        <div class="queue-stats" role="group" data-i18n-label="queue">
+            <span id="queue-speed"></span>
+            <span id="queue-size"></span>
+            <span id="queue-eta"></span>
         </div>
 
-        <div class="downloads">
-            <div id="downloads-list"></div>
+        <section class="throughput" aria-labelledby="throughput-title">
+            <div class="throughput-header">
+                <h2 id="throughput-title" data-i18n="throughputLabel">Download speed history</h2>
+                <span id="throughput-summary"></span>
+                <select id="throughput-range" class="action-button" onchange="updateThroughput()" data-i18n-label="throughputRange">
+                    <option value="second,15m" data-i18n="range15m">Last 15 minutes</option>
+                    <option value="minute,48h" data-i18n="range2d" selected>Last 2 days</option>
+                    <option value="hour,168h" data-i18n="range1w">Last week</option>
+                    <option value="hour,2160h" data-i18n="range90d">Last 90 days</option>
+                </select>
+            </div>
+            <svg id="throughput-chart" viewBox="0 0 100 40" preserveAspectRatio="none" role="img" data-i18n-label="throughputLabel">
+                <polyline id="throughput-line" fill="none" stroke="#10b981" stroke-width="1" vector-effect="non-scaling-stroke" points=""/>
+            </svg>
+        </section>
+
+        <div id="auth-banner" class="auth-banner" role="alert">
+            <span><span data-i18n="authRejected">put.io rejected the token. Get a new one with</span> <code>plundrio get-token</code>.</span>
+            <button class="action-button" onclick="replaceToken()" data-i18n="replaceToken">Replace token</button>
         </div>
+
+        <div id="backoff-banner" class="backoff-banner" role="status"></div>
+
+        <div id="provider-routes" class="provider-routes"></div>
+
+        <nav class="tabs" role="tablist">
+            <button id="downloads-tab" class="action-button active" role="tab" aria-selected="true" aria-controls="downloads-panel" onclick="showTab('downloads')" data-i18n="downloads">Downloads</button>
+            <button id="history-tab" class="action-button" role="tab" aria-selected="false" aria-controls="history-panel" onclick="showTab('history')" data-i18n="history">History</button>
+            <button id="failures-tab" class="action-button" role="tab" aria-selected="false" aria-controls="failures-panel" onclick="showTab('failures')" data-i18n="failures">Failed files</button>
+        </nav>
+
+        <main id="downloads-panel" class="downloads" role="tabpanel" aria-labelledby="downloads-tab">
+            <h2 id="downloads-title" class="sr-only" data-i18n="downloads">Downloads</h2>
+            <div id="downloads-list" role="list" aria-labelledby="downloads-title"></div>
+        </main>
+
+        <section id="history-panel" class="downloads" role="tabpanel" aria-labelledby="history-tab" hidden>
+            <h2 id="history-title" class="sr-only" data-i18n="history">History</h2>
+            <div class="history-filters">
+                <select id="history-outcome" class="action-button" onchange="resetHistory()" data-i18n-label="historyOutcome">
+                    <option value="" data-i18n="allOutcomes">All outcomes</option>
+                    <option value="completed" data-i18n="outcomeCompleted">Completed</option>
+                    <option value="failed" data-i18n="outcomeFailed">Failed</option>
+                    <option value="cancelled" data-i18n="outcomeCancelled">Cancelled</option>
+                </select>
+                <input id="history-search" class="action-button" type="search" oninput="resetHistory()" data-i18n-label="historySearch">
+            </div>
+            <div id="history-list" role="list" aria-labelledby="history-title"></div>
+            <div class="history-pager">
+                <span id="history-page"></span>
+                <button id="history-previous" class="item-button" onclick="pageHistory(-1)" data-i18n="previousPage">Previous</button>
+                <button id="history-next" class="item-button" onclick="pageHistory(1)" data-i18n="nextPage">Next</button>
+            </div>
+        </section>
+
+        <section id="failures-panel" class="downloads" role="tabpanel" aria-labelledby="failures-tab" hidden>
+            <h2 id="failures-title" class="sr-only" data-i18n="failures">Failed files</h2>
+            <div class="history-filters">
+                <button id="failures-retry" class="action-button" onclick="retryFailures([])" data-i18n="retryFailed">Retry failed</button>
+            </div>
+            <div id="failures-list" role="list" aria-labelledby="failures-title"></div>
+        </section>
+
+        <div id="announcer" class="sr-only" aria-live="polite"></div>
+
+        <dialog id="shortcuts" class="shortcuts" aria-labelledby="shortcuts-title">
+            <h2 id="shortcuts-title" data-i18n="shortcuts">Keyboard shortcuts</h2>
+            <dl>
+                <dt><kbd>a</kbd></dt><dd data-i18n="shortcutAdd">Add a URL</dd>
+                <dt><kbd>s</kbd></dt><dd data-i18n="scan">Scan put.io</dd>
+                <dt><kbd>j</kbd> <kbd>k</kbd></dt><dd data-i18n="shortcutMove">Next / previous download</dd>
+                <dt><kbd>p</kbd></dt><dd data-i18n="shortcutPause">Pause or resume the selected download</dd>
+                <dt><kbd>x</kbd></dt><dd data-i18n="shortcutCancel">Cancel the selected download</dd>
+                <dt><kbd>?</kbd></dt><dd data-i18n="shortcutHelp">Show this help</dd>
+            </dl>
+            <button class="action-button" onclick="document.getElementById('shortcuts').close()" data-i18n="close">Close</button>
+        </dialog>
     </div>
 
     <script>
+        const messages = {{messages}};
+
+        // t returns a message in the dashboard's language with {placeholders} filled in
+        function t(key, params) {
+            return (messages[key] || key).replace(/\{(\w+)\}/g, (match, name) => params && name in params ? params[name] : match);
+        }
+
+        document.title = t('title');
+        document.querySelectorAll('[data-i18n]').forEach(el => { el.textContent = t(el.dataset.i18n); });
+        document.querySelectorAll('[data-i18n-label]').forEach(el => { el.setAttribute('aria-label', t(el.dataset.i18nLabel)); });
+        document.getElementById('history-search').placeholder = t('historySearch');
+
+        function escapeHTML(s) {
+            return String(s).replace(/[&<>"']/g, c => '&#' + c.charCodeAt(0) + ';');
+        }
+
+        // announce tells screen reader users what an action did
+        function announce(text) {
+            document.getElementById('announcer').textContent = text;
+        }
+
+        function updateLanguages() {
+            fetch('/api/i18n')
+                .then(r => r.json())
+                .then(languages => {
+                    const select = document.getElementById('language');
+                    languages.forEach(l => select.add(new Option(l.name, l.code, false, l.code === document.documentElement.lang)));
+                });
+        }
+
+        function pickLanguage(lang) {
+            location.search = '?lang=' + encodeURIComponent(lang);
+        }
+
         function formatSize(mb) {
             if (mb >= 1024) {
                 return (mb / 1024).toFixed(2) + ' GB';
@@ -189,47 +1042,753 @@ func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
             return mb.toFixed(2) + ' MB';
         }
 
+        let annotations = {};
+        const knownUsers = new Set();
+
+        function notesLine(dl) {
+            const metadata = Object.entries(dl.metadata || {}).map(([key, value]) => key + ': ' + value);
+            const requestedBy = dl.requested_by ? t('requestedBy', { user: dl.requested_by }) : '';
+            return [dl.notes].concat(metadata, requestedBy).filter(Boolean).join(' · ') || t('addNotes');
+        }
+
+        function updateUserFilter(downloads) {
+            const select = document.getElementById('user-filter');
+            downloads.forEach(dl => {
+                if (dl.requested_by && !knownUsers.has(dl.requested_by)) {
+                    knownUsers.add(dl.requested_by);
+                    select.add(new Option(dl.requested_by, dl.requested_by));
+                }
+            });
+        }
+
+        const knownDownloads = new Map();
+        let downloadsCursor = '';
+        let downloadsUser = '';
+
         function updateDashboard() {
-            fetch('/api/downloads')
+            const user = document.getElementById('user-filter').value;
+            if (user !== downloadsUser) {
+                downloadsUser = user;
+                downloadsCursor = '';
+            }
+            const params = new URLSearchParams({ since: downloadsCursor });
+            if (user) {
+                params.set('user', user);
+            }
+            fetch('/api/downloads?' + params)
                 .then(r => r.json())
-                .then(downloads => {
+                .then(delta => {
+                    // Only downloads that changed since the last update are sent
+                    if (delta.cursor === downloadsCursor) {
+                        return;
+                    }
+                    downloadsCursor = delta.cursor;
+                    if (delta.full) {
+                        knownDownloads.clear();
+                    }
+                    delta.changed.forEach(dl => knownDownloads.set(dl.id, dl));
+                    const ids = new Set(delta.ids);
+                    for (const id of knownDownloads.keys()) {
+                        if (!ids.has(id)) {
+                            knownDownloads.delete(id);
+                        }
+                    }
+                    const downloads = delta.ids.map(id => knownDownloads.get(id));
+
+                    updateUserFilter(downloads);
                     const list = document.getElementById('downloads-list');
 
+                    // Re-rendering replaces the elements, so remember what had the focus
+                    const focused = document.activeElement;
+                    const focusedItem = focused && focused.closest ? focused.closest('.download-item') : null;
+                    const focusedAction = focusedItem && focused.dataset.action;
+
                     if (!downloads || downloads.length === 0) {
-                        list.innerHTML = '<div class="empty">No active downloads</div>';
+                        list.innerHTML = '<div class="empty" role="listitem">' + escapeHTML(t('noDownloads')) + '</div>';
                         document.getElementById('active-count').textContent = '0';
                         return;
                     }
 
+                    annotations = {};
+                    downloads.forEach(dl => { annotations[dl.id] = { notes: dl.notes || '', metadata: dl.metadata || {} }; });
                     list.innerHTML = downloads.map(dl => {
+                        const cloud = dl.stage === 'cloud';
+                        const failed = dl.remote_status === 'ERROR';
+                        const progress = cloud ? dl.cloud_progress_percent : dl.progress_percent;
+                        const status = dl.scheduled_until
+                            ? t('scheduledUntil', { time: new Date(dl.scheduled_until).toLocaleString(document.documentElement.lang) })
+                            : dl.waiting_for_space ? t('waitingForSpace')
+                            : dl.remote_status ? (dl.provider || 'put.io') + ': ' + dl.remote_status + (dl.remote_message ? ' – ' + dl.remote_message : '') : '';
                         return ` + "`" + `
-                            <div class="download-item">
-                                <div class="download-name">` + "${dl.name}" + `</div>
-                                <div class="progress-bar">
-                                    <div class="progress-fill" style="width: ` + "${dl.progress_percent}" + `%"></div>
+                            <div class="download-item" role="listitem" tabindex="0" data-id="` + "${dl.id}" + `" aria-label="` + "${escapeHTML(dl.name)}" + `">
+                                <div class="download-header">
+                                    <div class="download-name">` + "${escapeHTML(dl.name)}" + `</div>
+                                    <button class="download-dir link-button" data-action="location" title="` + "${escapeHTML(t('changeLocation'))}" + `">` + "${escapeHTML(dl.download_dir)}" + `</button>
+                                </div>
+                                <div class="download-status ` + "${failed ? 'error' : ''}" + `">` + "${escapeHTML(status)}" + `</div>
+                                <button class="download-notes link-button" data-action="notes" title="` + "${escapeHTML(t('editNotes'))}" + `">` + "${escapeHTML(notesLine(dl))}" + `</button>
+                                <div class="progress-bar" role="progressbar" aria-valuemin="0" aria-valuemax="100" aria-valuenow="` + "${progress.toFixed(0)}" + `" aria-label="` + "${escapeHTML(t('progressLabel'))}" + `">
+                                    <div class="progress-fill ` + "${cloud ? 'cloud' : ''}" + `" style="width: ` + "${progress}" + `%"></div>
                                 </div>
                                 <div class="download-stats">
-                                    <span>` + "${dl.progress_percent.toFixed(1)}" + `%</span>
-                                    <span>` + "${formatSize(dl.downloaded_mb)}" + ` / ` + "${formatSize(dl.total_mb)}" + `</span>
+                                    <span title="put.io / local">` + "${escapeHTML(t('progress', { cloud: dl.cloud_progress_percent.toFixed(0), local: dl.progress_percent.toFixed(1) }))}" + `</span>
+                                    <span>` + "${cloud ? formatSize(dl.total_mb) : formatSize(dl.downloaded_mb) + ' / ' + formatSize(dl.total_mb)}" + `</span>
                                     <span>` + "${(dl.speed_mbps || 0).toFixed(1)}" + ` MB/s</span>
-                                    <span>ETA: ` + "${dl.eta || 'calculating...'}" + `</span>
+                                    <span>` + "${escapeHTML(t('eta', { eta: dl.eta || (failed ? '-' : t('calculating')) }))}" + `</span>
+                                </div>
+                                <div class="download-actions">
+                                    ` + "${dl.queue_position ? '<span>' + escapeHTML(t('queuePosition', { position: dl.queue_position })) + '</span>' : ''}" + `
+                                    ` + "${dl.queue_position > 1 ? '<button class=\"item-button\" data-action=\"up\">' + escapeHTML(t('moveUp')) + '</button>' : ''}" + `
+                                    ` + "${dl.queue_position ? '<button class=\"item-button\" data-action=\"down\">' + escapeHTML(t('moveDown')) + '</button>' : ''}" + `
+                                    <button class="item-button" data-action="pause" aria-keyshortcuts="p" aria-pressed="` + "${dl.paused}" + `">` + "${escapeHTML(dl.paused ? t('resume') : t('pause'))}" + `</button>
+                                    <button class="item-button" data-action="cancel" aria-keyshortcuts="x">` + "${escapeHTML(t('cancel'))}" + `</button>
                                 </div>
                             </div>
                         ` + "`" + `;
                     }).join('');
 
+                    if (focusedItem) {
+                        const item = list.querySelector('[data-id="' + focusedItem.dataset.id + '"]');
+                        const target = item && (focusedAction ? item.querySelector('[data-action="' + focusedAction + '"]') : item);
+                        (target || list.querySelector('.download-item')).focus();
+                    }
+
                     document.getElementById('active-count').textContent = downloads.length;
                 });
         }
 
-        // Update every 2 seconds
-        updateDashboard();
-        setInterval(updateDashboard, 2000);
+        // Buttons of a download act on the download they belong to
+        document.getElementById('downloads-list').addEventListener('click', event => {
+            const button = event.target.closest('[data-action]');
+            const item = event.target.closest('.download-item');
+            if (!button || !item) {
+                return;
+            }
+            const dl = knownDownloads.get(Number(item.dataset.id));
+            if (!dl) {
+                return;
+            }
+            switch (button.dataset.action) {
+            case 'location':
+                changeLocation(dl.id, dl.download_dir);
+                break;
+            case 'notes':
+                editNotes(dl.id);
+                break;
+            case 'pause':
+                togglePause(dl);
+                break;
+            case 'cancel':
+                cancelTransfer(dl);
+                break;
+            case 'up':
+            case 'down':
+                moveInQueue(dl, button.dataset.action);
+                break;
+            }
+        });
+
+        const historyPageSize = 50;
+        let historyOffset = 0;
+        let currentTab = 'downloads';
+
+        function showTab(name) {
+            currentTab = name;
+            ['downloads', 'history', 'failures'].forEach(tab => {
+                const selected = tab === name;
+                document.getElementById(tab + '-tab').classList.toggle('active', selected);
+                document.getElementById(tab + '-tab').setAttribute('aria-selected', selected);
+                document.getElementById(tab + '-panel').hidden = !selected;
+            });
+            if (name === 'history') {
+                updateHistory();
+            }
+            if (name === 'failures') {
+                updateFailures();
+            }
+        }
+
+        function formatSeconds(seconds) {
+            if (seconds < 60) {
+                return seconds + ' s';
+            }
+            if (seconds < 3600) {
+                return Math.round(seconds / 60) + ' min';
+            }
+            return (seconds / 3600).toFixed(1) + ' h';
+        }
+
+        function resetHistory() {
+            historyOffset = 0;
+            updateHistory();
+        }
+
+        function pageHistory(step) {
+            historyOffset = Math.max(historyOffset + step * historyPageSize, 0);
+            updateHistory();
+        }
+
+        function updateHistory() {
+            const params = new URLSearchParams({ limit: historyPageSize, offset: historyOffset });
+            const outcome = document.getElementById('history-outcome').value;
+            const search = document.getElementById('history-search').value.trim();
+            const user = document.getElementById('user-filter').value;
+            if (outcome) {
+                params.set('outcome', outcome);
+            }
+            if (search) {
+                params.set('q', search);
+            }
+            if (user) {
+                params.set('user', user);
+            }
+            fetch('/api/history?' + params)
+                .then(r => r.json())
+                .then(page => {
+                    const list = document.getElementById('history-list');
+                    if (page.entries.length === 0) {
+                        list.innerHTML = '<div class="empty" role="listitem">' + escapeHTML(t('noHistory')) + '</div>';
+                    } else {
+                        list.innerHTML = page.entries.map(entry => {
+                            const outcome = t('outcome' + entry.outcome.charAt(0).toUpperCase() + entry.outcome.slice(1));
+                            const status = [new Date(entry.time).toLocaleString(document.documentElement.lang), outcome, entry.category, entry.requested_by ? t('requestedBy', { user: entry.requested_by }) : '']
+                                .filter(Boolean).join(' · ');
+                            const stats = t('historyStats', {
+                                size: formatSize(entry.size / 1024 / 1024),
+                                duration: formatSeconds(entry.duration_seconds),
+                                speed: formatSize(entry.speed_bps / 1024 / 1024) + '/s'
+                            });
+                            return '<div class="download-item" role="listitem">' +
+                                '<div class="download-name">' + escapeHTML(entry.name) + '</div>' +
+                                '<div class="download-status' + (entry.outcome === 'failed' ? ' error' : '') + '">' + escapeHTML(status) + '</div>' +
+                                (entry.error ? '<div class="download-status error">' + escapeHTML(entry.error) + '</div>' : '') +
+                                '<div class="download-stats"><span>' + escapeHTML(stats) + '</span></div>' +
+                                '</div>';
+                        }).join('');
+                    }
+                    const from = page.total === 0 ? 0 : page.offset + 1;
+                    const to = page.offset + page.entries.length;
+                    document.getElementById('history-page').textContent = t('historyPage', { from: from, to: to, total: page.total });
+                    document.getElementById('history-previous').disabled = page.offset === 0;
+                    document.getElementById('history-next').disabled = to >= page.total;
+                });
+        }
+
+        function updateFailures() {
+            fetch('/api/failures')
+                .then(r => r.json())
+                .then(files => {
+                    const list = document.getElementById('failures-list');
+                    document.getElementById('failures-retry').disabled = !files.some(file => !file.retrying);
+                    if (files.length === 0) {
+                        list.innerHTML = '<div class="empty" role="listitem">' + escapeHTML(t('noFailures')) + '</div>';
+                        return;
+                    }
+                    list.innerHTML = files.slice().reverse().map(file => {
+                        const status = [new Date(file.time).toLocaleString(document.documentElement.lang), file.transfer_name,
+                            formatSize(file.size / 1024 / 1024), t('failureAttempts', { attempts: file.attempts })].filter(Boolean).join(' · ');
+                        return '<div class="download-item" role="listitem" data-file-id="' + file.file_id + '">' +
+                            '<div class="download-name">' + escapeHTML(file.name) + '</div>' +
+                            '<div class="download-status">' + escapeHTML(status) + '</div>' +
+                            '<div class="download-status error">' + escapeHTML(file.error) + '</div>' +
+                            '<div class="download-actions">' + (file.retrying
+                                ? '<span>' + escapeHTML(t('retrying')) + '</span>'
+                                : '<button class="item-button" data-action="retry">' + escapeHTML(t('retryFile')) + '</button>') +
+                            '</div></div>';
+                    }).join('');
+                });
+        }
+
+        function retryFailures(fileIds) {
+            fetch('/api/failures/retry', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ file_ids: fileIds })
+            }).then(r => {
+                if (!r.ok) {
+                    r.text().then(alert);
+                    return;
+                }
+                r.json().then(result => announce(t('failuresRetried', { files: result.retried })));
+            }).then(() => {
+                updateFailures();
+                updateDashboard();
+            });
+        }
+
+        document.getElementById('failures-list').addEventListener('click', event => {
+            const button = event.target.closest('[data-action="retry"]');
+            const item = event.target.closest('.download-item');
+            if (button && item) {
+                retryFailures([Number(item.dataset.fileId)]);
+            }
+        });
+
+        function moveInQueue(dl, direction) {
+            fetch('/api/transfers/move', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ id: dl.id, direction: direction })
+            }).then(r => {
+                if (!r.ok && r.status !== 409) {
+                    r.text().then(alert);
+                    return;
+                }
+                updateDashboard();
+            });
+        }
+
+        function togglePause(dl) {
+            fetch(dl.paused ? '/api/transfers/resume' : '/api/transfers/pause', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ id: dl.id })
+            }).then(r => {
+                if (!r.ok) {
+                    r.text().then(alert);
+                    return;
+                }
+                announce(t(dl.paused ? 'resumed' : 'paused', { name: dl.name }));
+                updateDashboard();
+            });
+        }
+
+        function cancelTransfer(dl) {
+            if (!confirm(t('confirmCancel', { name: dl.name }))) {
+                return;
+            }
+            fetch('/api/transfers/cancel', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ id: dl.id })
+            }).then(r => {
+                if (!r.ok) {
+                    r.text().then(alert);
+                    return;
+                }
+                announce(t('cancelled', { name: dl.name }));
+                updateDashboard();
+            });
+        }
+
+        // moveFocus focuses the next or previous download
+        function moveFocus(step) {
+            const items = Array.from(document.querySelectorAll('#downloads-list .download-item'));
+            if (items.length === 0) {
+                return;
+            }
+            const current = items.indexOf(document.activeElement.closest('.download-item'));
+            const next = current < 0 ? (step > 0 ? 0 : items.length - 1) : Math.min(Math.max(current + step, 0), items.length - 1);
+            items[next].focus();
+        }
+
+        let focusBeforeShortcuts = null;
+
+        function showShortcuts() {
+            focusBeforeShortcuts = document.activeElement;
+            document.getElementById('shortcuts').showModal();
+        }
+
+        document.getElementById('shortcuts').addEventListener('close', () => {
+            if (focusBeforeShortcuts) {
+                focusBeforeShortcuts.focus();
+            }
+        });
+
+        document.addEventListener('keydown', event => {
+            if (event.ctrlKey || event.metaKey || event.altKey || event.target.closest('input, textarea, select, dialog')) {
+                return;
+            }
+            const item = document.activeElement.closest('.download-item');
+            const dl = item ? knownDownloads.get(Number(item.dataset.id)) : null;
+            switch (event.key) {
+            case 'a':
+                addTransfer();
+                break;
+            case 's':
+                scanFolder();
+                break;
+            case 'j':
+                moveFocus(1);
+                break;
+            case 'k':
+                moveFocus(-1);
+                break;
+            case 'ArrowDown':
+            case 'ArrowUp':
+                if (!item) {
+                    return;
+                }
+                moveFocus(event.key === 'ArrowDown' ? 1 : -1);
+                break;
+            case 'p':
+                if (!dl) {
+                    return;
+                }
+                togglePause(dl);
+                break;
+            case 'x':
+            case 'Delete':
+                if (!dl) {
+                    return;
+                }
+                cancelTransfer(dl);
+                break;
+            case '?':
+                showShortcuts();
+                break;
+            default:
+                return;
+            }
+            event.preventDefault();
+        });
+
+        function changeLocation(id, current) {
+            const location = prompt(t('promptLocation'), current);
+            if (!location || location === current) {
+                return;
+            }
+            fetch('/api/transfers/location', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ id: id, location: location, move: true })
+            }).then(r => {
+                if (!r.ok) {
+                    r.text().then(alert);
+                }
+                updateDashboard();
+            });
+        }
+
+        function editNotes(id) {
+            const current = annotations[id] || { notes: '', metadata: {} };
+            const notes = prompt(t('promptNotes'), current.notes);
+            if (notes === null) {
+                return;
+            }
+            fetch('/api/transfers/notes', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ id: id, notes: notes.trim(), metadata: current.metadata })
+            }).then(r => {
+                if (!r.ok) {
+                    r.text().then(alert);
+                }
+                updateDashboard();
+            });
+        }
+
+        function addTransfer() {
+            const url = prompt(t('promptURL'));
+            if (!url) {
+                return;
+            }
+            fetch('/api/transfers/add', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ url: url.trim() })
+            }).then(r => {
+                if (!r.ok) {
+                    r.text().then(alert);
+                }
+                updateDashboard();
+            });
+        }
+
+        function redownloadFile() {
+            const path = prompt(t('promptRedownload'));
+            if (!path) {
+                return;
+            }
+            fetch('/api/files/redownload', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ path: path.trim() })
+            }).then(r => {
+                if (!r.ok) {
+                    r.text().then(alert);
+                }
+                updateDashboard();
+            });
+        }
+
+        function scanFolder() {
+            const button = document.getElementById('scan');
+            button.disabled = true;
+            fetch('/api/scan', { method: 'POST', headers: { 'X-Requested-With': 'fetch' } }).then(r => {
+                if (!r.ok) {
+                    r.text().then(alert);
+                }
+                button.disabled = false;
+                updateDashboard();
+            });
+        }
+
+        function updateStats() {
+            fetch('/api/stats')
+                .then(r => r.json())
+                .then(stats => {
+                    document.getElementById('queue-speed').textContent = t('queueSpeed', { speed: formatSize(stats.speed_bps / 1024 / 1024) + '/s' });
+                    document.getElementById('queue-size').textContent = t('queueSize', { size: formatSize(stats.queued_bytes / 1024 / 1024), count: stats.queued_transfers });
+                    document.getElementById('queue-eta').textContent = t('queueETA', { eta: stats.queued_bytes === 0 ? '-' : stats.eta });
+                });
+        }
+
+        // updateThroughput draws the speed history of the picked range. It
+        // changes slowly, so refresh() only updates it every 30 seconds.
+        let throughputUpdatedAt = 0;
+        function updateThroughput() {
+            throughputUpdatedAt = Date.now();
+            const [resolution, period] = document.getElementById('throughput-range').value.split(',');
+            fetch('/api/stats/throughput?resolution=' + resolution + '&period=' + period)
+                .then(r => r.json())
+                .then(history => {
+                    const points = history.points;
+                    const peak = points.reduce((max, p) => Math.max(max, p.speed), 0);
+                    const bytes = points.reduce((sum, p) => sum + p.bytes, 0);
+                    const line = points.map((p, i) => {
+                        const x = points.length > 1 ? i / (points.length - 1) * 100 : 0;
+                        const y = peak > 0 ? 40 - p.speed / peak * 38 : 40;
+                        return x.toFixed(2) + ',' + y.toFixed(2);
+                    });
+                    document.getElementById('throughput-line').setAttribute('points', line.join(' '));
+                    document.getElementById('throughput-summary').textContent = t('throughputSummary', {
+                        peak: formatSize(peak / 1024 / 1024) + '/s',
+                        size: formatSize(bytes / 1024 / 1024),
+                    });
+                });
+        }
+
+        function updateHealth() {
+            fetch('/api/health')
+                .then(r => r.json())
+                .then(health => {
+                    document.getElementById('auth-banner').classList.toggle('visible', health.status === 'reauthenticate');
+                    const until = health.retry_budget && health.retry_budget.backing_off_until;
+                    const backoff = document.getElementById('backoff-banner');
+                    backoff.classList.toggle('visible', !!until);
+                    backoff.textContent = until
+                        ? t('retryBackoff', { time: new Date(until).toLocaleTimeString(document.documentElement.lang) })
+                        : '';
+                });
+        }
+
+        function replaceToken() {
+            const token = prompt(t('promptToken'));
+            if (!token) {
+                return;
+            }
+            fetch('/api/token', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ token: token.trim() })
+            }).then(r => {
+                if (!r.ok) {
+                    r.text().then(alert);
+                }
+                updateHealth();
+            });
+        }
+
+        function updateProviders() {
+            fetch('/api/providers')
+                .then(r => r.json())
+                .then(info => {
+                    if (info.providers.length < 2) {
+                        return;
+                    }
+                    const routes = info.routes.map(route => {
+                        const rule = [route.category ? t('routeCategory', { category: route.category }) : '', route.match ? '/' + route.match + '/' : ''].filter(Boolean).join(' ' + t('routeAnd') + ' ');
+                        return rule + ' → ' + route.provider;
+                    });
+                    const order = info.providers.filter(p => p.role !== 'routed').map(p => p.name).join(' → ');
+                    const element = document.getElementById('provider-routes');
+                    element.textContent = t('providers', { order }) + (routes.length ? ' · ' + t('routes', { routes: routes.join(' · ') }) : '');
+                    element.classList.add('visible');
+                });
+        }
+
+        let unthrottleActive = false;
+
+        function renderUnthrottle(info) {
+            const button = document.getElementById('unthrottle');
+            unthrottleActive = info.active;
+            button.classList.toggle('active', info.active);
+            button.setAttribute('aria-pressed', info.active);
+            button.textContent = info.active
+                ? t('unthrottledUntil', { time: new Date(info.until).toLocaleTimeString(document.documentElement.lang) })
+                : t('unthrottle');
+        }
+
+        function updateUnthrottle() {
+            fetch('/api/unthrottle')
+                .then(r => r.json())
+                .then(renderUnthrottle);
+        }
+
+        function toggleUnthrottle() {
+            const minutes = unthrottleActive ? 0 : 30;
+            fetch('/api/unthrottle?minutes=' + minutes, { method: 'POST', headers: { 'X-Requested-With': 'fetch' } })
+                .then(r => r.json())
+                .then(renderUnthrottle);
+        }
+
+        let pushSubscription = null;
+
+        function base64UrlToBytes(s) {
+            const raw = atob(s.replace(/-/g, '+').replace(/_/g, '/'));
+            return Uint8Array.from(raw, c => c.charCodeAt(0));
+        }
+
+        function renderPush() {
+            document.getElementById('push').textContent = pushSubscription
+                ? t('disableNotifications')
+                : t('enableNotifications');
+        }
+
+        function setupPush() {
+            if (!('serviceWorker' in navigator)) {
+                return;
+            }
+            navigator.serviceWorker.register('/sw.js').then(registration => {
+                if (!('PushManager' in window)) {
+                    return;
+                }
+                fetch('/api/push')
+                    .then(r => r.json())
+                    .then(info => {
+                        if (!info.enabled) {
+                            return;
+                        }
+                        registration.pushManager.getSubscription().then(subscription => {
+                            pushSubscription = subscription;
+                            document.getElementById('push').hidden = false;
+                            renderPush();
+                        });
+                    });
+            });
+        }
+
+        function togglePush() {
+            if (pushSubscription) {
+                const endpoint = pushSubscription.endpoint;
+                pushSubscription.unsubscribe().then(() => {
+                    pushSubscription = null;
+                    renderPush();
+                    fetch('/api/push/unsubscribe', {
+                        method: 'POST',
+                        headers: { 'Content-Type': 'application/json' },
+                        body: JSON.stringify({ endpoint }),
+                    });
+                });
+                return;
+            }
+
+            Promise.all([navigator.serviceWorker.ready, fetch('/api/push').then(r => r.json())])
+                .then(([registration, info]) => registration.pushManager.subscribe({
+                    userVisibleOnly: true,
+                    applicationServerKey: base64UrlToBytes(info.public_key),
+                }))
+                .then(subscription => fetch('/api/push/subscribe', {
+                    method: 'POST',
+                    headers: { 'Content-Type': 'application/json' },
+                    body: JSON.stringify(subscription),
+                }).then(r => {
+                    if (!r.ok) {
+                        return r.text().then(text => { throw new Error(text); });
+                    }
+                    pushSubscription = subscription;
+                    renderPush();
+                }))
+                .catch(err => alert(t('notificationsFailed', { error: err.message })));
+        }
+
+        // The refresh interval is remembered in the browser, 0 turns polling off
+        const refreshKey = 'plundrio-refresh';
+        const refreshIntervals = [1000, 2000, 5000, 10000, 30000, 0];
+        let refreshInterval = parseInt(localStorage.getItem(refreshKey) || '2000', 10);
+        let refreshTimer = null;
+
+        function refresh() {
+            updateDashboard();
+            if (currentTab === 'history') {
+                updateHistory();
+            }
+            if (currentTab === 'failures') {
+                updateFailures();
+            }
+            updateStats();
+            updateUnthrottle();
+            updateHealth();
+            if (Date.now() - throughputUpdatedAt >= 30000) {
+                updateThroughput();
+            }
+        }
+
+        // schedulePolling polls at the picked interval, but not while the tab
+        // is hidden, so dashboards left open in the background cost nothing
+        function schedulePolling() {
+            clearInterval(refreshTimer);
+            refreshTimer = null;
+            const polling = refreshInterval > 0 && document.visibilityState === 'visible';
+            document.querySelector('.refresh-indicator').classList.toggle('paused', !polling);
+            if (polling) {
+                refreshTimer = setInterval(refresh, refreshInterval);
+            }
+        }
+
+        function setupRefresh() {
+            const select = document.getElementById('refresh');
+            if (!refreshIntervals.includes(refreshInterval)) {
+                refreshInterval = 2000;
+            }
+            refreshIntervals.forEach(ms => {
+                const label = ms > 0 ? t('refreshEvery', { seconds: ms / 1000 }) : t('refreshOff');
+                select.add(new Option(label, ms, false, ms === refreshInterval));
+            });
+        }
+
+        function pickRefresh(value) {
+            refreshInterval = parseInt(value, 10);
+            localStorage.setItem(refreshKey, refreshInterval);
+            schedulePolling();
+        }
+
+        // Catch up right away when the tab is shown or focused again
+        function resumePolling() {
+            if (document.visibilityState === 'visible' && refreshInterval > 0 && refreshTimer === null) {
+                refresh();
+                schedulePolling();
+            }
+        }
+
+        document.addEventListener('visibilitychange', () => {
+            if (document.visibilityState === 'visible') {
+                resumePolling();
+            } else {
+                schedulePolling();
+            }
+        });
+        window.addEventListener('focus', resumePolling);
+
+        setupPush();
+        setupRefresh();
+        updateLanguages();
+        refresh();
+        updateProviders();
+        schedulePolling();
     </script>
 </body>
 </html>`
 
+	// Fill in the language and its messages
+	lang := s.dashboardLanguage(w, r)
+	messages, _ := s.i18n.Messages(lang)
+	catalog, _ := json.Marshal(messages)
+	html = strings.NewReplacer("{{lang}}", lang, "{{messages}}", string(catalog)).Replace(html)
+
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Vary", "Accept-Language, Cookie")
 	w.Write([]byte(html))
 }
 
@@ -0,0 +1,192 @@
+package server
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/events"
+	"github.com/elsbrock/plundrio/internal/log"
+	"github.com/elsbrock/plundrio/internal/notify"
+)
+
+// defaultFeedLimit is how many completed downloads are listed when limit is not set
+const defaultFeedLimit = 50
+
+// rssFeed is an RSS 2.0 document
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	Description string  `xml:"description"`
+	Category    string  `xml:"category,omitempty"`
+	PubDate     string  `xml:"pubDate"`
+	GUID        rssGUID `xml:"guid"`
+}
+
+type rssGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+}
+
+// atomFeed is an Atom 1.0 document
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Link    atomLink    `xml:"link"`
+	Updated string      `xml:"updated"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	Title    string        `xml:"title"`
+	ID       string        `xml:"id"`
+	Link     atomLink      `xml:"link"`
+	Updated  string        `xml:"updated"`
+	Summary  string        `xml:"summary"`
+	Category *atomCategory `xml:"category,omitempty"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+// handleFeed serves recently completed downloads as RSS feed, or as Atom feed
+// with format=atom. Query parameters: category (only downloads of this
+// category) and limit (number of downloads).
+func (s *Server) handleFeed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format != "" && format != "rss" && format != "atom" {
+		http.Error(w, "Invalid format parameter (use rss or atom)", http.StatusBadRequest)
+		return
+	}
+	limit := defaultFeedLimit
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			http.Error(w, "Invalid limit parameter", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	completed := s.completedDownloads(query.Get("category"), limit)
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	link := fmt.Sprintf("%s://%s/", scheme, r.Host)
+	updated := time.Now()
+	if len(completed) > 0 {
+		updated = completed[0].Time
+	}
+
+	var doc interface{}
+	if format == "atom" {
+		w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+		feed := atomFeed{
+			Title:   "plundrio downloads",
+			ID:      link,
+			Link:    atomLink{Href: link},
+			Updated: updated.UTC().Format(time.RFC3339),
+		}
+		for _, event := range completed {
+			entry := atomEntry{
+				Title:   event.Name,
+				ID:      feedItemID(event),
+				Link:    atomLink{Href: link},
+				Updated: event.Time.UTC().Format(time.RFC3339),
+				Summary: feedSummary(event),
+			}
+			if event.Category != "" {
+				entry.Category = &atomCategory{Term: event.Category}
+			}
+			feed.Entries = append(feed.Entries, entry)
+		}
+		doc = feed
+	} else {
+		w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+		feed := rssFeed{
+			Version: "2.0",
+			Channel: rssChannel{
+				Title:         "plundrio downloads",
+				Link:          link,
+				Description:   "Downloads completed by plundrio",
+				LastBuildDate: updated.Format(time.RFC1123Z),
+			},
+		}
+		for _, event := range completed {
+			feed.Channel.Items = append(feed.Channel.Items, rssItem{
+				Title:       event.Name,
+				Link:        link,
+				Description: feedSummary(event),
+				Category:    event.Category,
+				PubDate:     event.Time.Format(time.RFC1123Z),
+				GUID:        rssGUID{Value: feedItemID(event)},
+			})
+		}
+		doc = feed
+	}
+
+	w.Write([]byte(xml.Header))
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		log.Error("server").Err(err).Msg("Failed to encode feed")
+	}
+}
+
+// completedDownloads returns the most recently completed transfers of a
+// category (any category if empty), newest first
+func (s *Server) completedDownloads(category string, limit int) []events.Event {
+	history := s.dlManager.History()
+	var completed []events.Event
+	for i := len(history) - 1; i >= 0 && len(completed) < limit; i-- {
+		event := history[i]
+		if event.Type != events.TransferCompleted || (category != "" && event.Category != category) {
+			continue
+		}
+		completed = append(completed, event)
+	}
+	return completed
+}
+
+// feedItemID identifies a completed download across feed updates
+func feedItemID(event events.Event) string {
+	return fmt.Sprintf("plundrio:transfer:%d:%d", event.TransferID, event.Time.Unix())
+}
+
+// feedSummary describes a completed download in one line
+func feedSummary(event events.Event) string {
+	summary := fmt.Sprintf("%s downloaded in %s", notify.FormatSize(event.Size), event.Duration.Round(time.Second))
+	if event.Category != "" {
+		summary += " to " + event.Category
+	}
+	return summary
+}
@@ -0,0 +1,183 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/elsbrock/go-putio"
+	"github.com/elsbrock/plundrio/internal/download"
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// FileInfo describes a file or folder on Put.io
+type FileInfo struct {
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	Size     int64  `json:"size"`
+	Folder   bool   `json:"folder"`
+	ParentID int64  `json:"parent_id"`
+	Created  string `json:"created_at,omitempty"`
+}
+
+// newFileInfo converts a Put.io file for the API
+func newFileInfo(f *putio.File) FileInfo {
+	info := FileInfo{
+		ID:       f.ID,
+		Name:     f.Name,
+		Size:     f.Size,
+		Folder:   f.IsDir(),
+		ParentID: f.ParentID,
+	}
+	if f.CreatedAt != nil {
+		info.Created = f.CreatedAt.Format(time.RFC3339)
+	}
+	return info
+}
+
+// handleFileSearch searches the files of the Put.io account.
+// It expects a GET with the query in the q parameter.
+func (s *Server) handleFileSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !s.requirePutio(w) {
+		return
+	}
+
+	query := r.URL.Query().Get("q")
+	if query == "" {
+		http.Error(w, "Missing query", http.StatusBadRequest)
+		return
+	}
+
+	files, err := s.client.SearchFiles(r.Context(), query)
+	if err != nil {
+		log.Error("server").Str("query", query).Err(err).Msg("Failed to search files")
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	results := make([]FileInfo, 0, len(files))
+	for _, f := range files {
+		results = append(results, newFileInfo(f))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// handleFileDownload queues a file or folder already on Put.io for download,
+// into the shared target directory for files shared by friends. It expects a
+// POST with a JSON body of the form {"id": 123} and returns the ID the
+// download is tracked under.
+func (s *Server) handleFileDownload(shared bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !s.requirePutio(w) {
+			return
+		}
+
+		var req struct {
+			ID int64 `json:"id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID <= 0 {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		targetDir := ""
+		if shared {
+			targetDir = s.cfg.SharedTargetDir
+		}
+		transferID, err := s.dlManager.QueueFile(req.ID, targetDir)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int64{"transfer_id": transferID})
+	}
+}
+
+// handleFileRedownload deletes the local copy of a downloaded file and
+// downloads it again from Put.io. It expects a POST with a JSON body of the
+// form {"path": "/downloads/file.mkv"} or {"transfer_id": 123, "file_id": 456}.
+func (s *Server) handleFileRedownload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Path       string `json:"path"`
+		TransferID int64  `json:"transfer_id"`
+		FileID     int64  `json:"file_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || (req.Path == "" && (req.TransferID == 0 || req.FileID == 0)) {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if req.Path != "" {
+		var ok bool
+		if req.TransferID, req.FileID, ok = s.dlManager.FindFile(req.Path); !ok {
+			http.Error(w, "File not found in any tracked transfer", http.StatusNotFound)
+			return
+		}
+	}
+
+	if err := s.dlManager.RedownloadFile(req.TransferID, req.FileID); err != nil {
+		var downloadErr *download.DownloadError
+		switch {
+		case errors.As(err, &downloadErr) && downloadErr.Type == "TransferNotFound":
+			http.Error(w, "Transfer not found", http.StatusNotFound)
+		case errors.As(err, &downloadErr) && downloadErr.Type == "FileMissing":
+			http.Error(w, err.Error(), http.StatusGone)
+		default:
+			http.Error(w, err.Error(), http.StatusConflict)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SharedFileInfo describes a file or folder a friend shared with the account
+type SharedFileInfo struct {
+	FileInfo
+	Friend string `json:"friend"`
+}
+
+// handleSharedFiles lists the files and folders put.io friends shared with the account
+func (s *Server) handleSharedFiles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !s.requirePutio(w) {
+		return
+	}
+
+	files, err := s.client.SharedFiles(r.Context())
+	if err != nil {
+		log.Error("server").Err(err).Msg("Failed to list shared files")
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	results := make([]SharedFileInfo, 0, len(files))
+	for _, f := range files {
+		results = append(results, SharedFileInfo{FileInfo: newFileInfo(f.File), Friend: f.Friend})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
@@ -0,0 +1,625 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/elsbrock/go-putio"
+	"github.com/elsbrock/plundrio/internal/download"
+	"github.com/elsbrock/plundrio/internal/events"
+	"github.com/elsbrock/plundrio/internal/graphql"
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// graphqlSchema documents the types served by the GraphQL endpoint
+const graphqlSchema = `# Byte counts are Floats since they exceed the 32-bit range of Int
+
+type Query {
+  # requestedBy only returns transfers and events of transfers added by that API user
+  transfers(requestedBy: String): [Transfer!]!
+  transfer(id: Int!): Transfer
+  files(transferId: Int): [File!]!
+  history(limit: Int = 50, types: [String!], requestedBy: String): [Event!]!
+  stats: Stats!
+}
+
+type Subscription {
+  # Transfer, file and system events as they happen
+  events(types: [String!]): Event!
+  # Snapshots of all transfers, sent every interval seconds
+  transfers(interval: Int = 2): [Transfer!]!
+}
+
+type Transfer {
+  id: Int!
+  hash: String!
+  name: String!
+  status: String!          # Put.io status
+  localState: String!      # remote, initial, downloading, completed, failed, cancelled, processed, quarantined
+  paused: Boolean!
+  size: Float!             # bytes
+  percentDone: Int!        # Put.io progress
+  downloaded: Float!       # bytes downloaded locally
+  progress: Float!         # local progress in percent
+  speed: Float!            # average local download speed in bytes per second
+  downloadDir: String!
+  category: String!
+  error: String!
+  errorCode: String!       # remote-gone, disk-full, checksum-mismatch, rate-limited, aria2-missing, auth-failed, ...
+  files: FileCounts!
+  retryCycles: Int!        # times failed files were downloaded again
+  quarantineReason: String!
+  outcome: String!         # success, partial or failure once all files are done, else empty
+  failedFiles: [FailedFile!]!
+  notes: String!
+  metadata: [Metadata!]!
+  requestedBy: String!     # API user the transfer was added by
+  createdAt: String
+  finishedAt: String
+}
+
+type Metadata {
+  key: String!
+  value: String!
+}
+
+type FileCounts {
+  total: Int!
+  completed: Int!
+  failed: Int!
+  skipped: Int!            # no longer on put.io, left out
+}
+
+type FailedFile {
+  fileId: Int!
+  name: String!
+  size: Float!
+  error: String!
+  errorCode: String!
+}
+
+type File {
+  fileId: Int!
+  transferId: Int!
+  transferName: String!
+}
+
+type Event {
+  type: String!
+  time: String!
+  transferId: Int!
+  hash: String!
+  name: String!
+  category: String!
+  path: String!
+  fileId: Int!
+  fileName: String!
+  size: Float!
+  durationSeconds: Float!
+  speed: Float!
+  error: String!
+  errorCode: String!
+  reason: String!
+  notes: String!
+  metadata: [Metadata!]!
+  requestedBy: String!
+}
+
+type Stats {
+  workers: Int!
+  activeDownloads: Int!
+  activeFiles: Int!
+  queuedJobs: Int!
+  transfers: Int!
+  downloading: Int!
+  failed: Int!
+  quarantined: Int!
+  processed: Int!
+  downloadedBytes: Float!
+  speedLimitKBps: Int!
+  unthrottledUntil: String
+  maintenance: Boolean!
+}
+`
+
+// GraphQLTransfer is a transfer as exposed over GraphQL
+type GraphQLTransfer struct {
+	ID          int64             `json:"id"`
+	Hash        string            `json:"hash"`
+	Name        string            `json:"name"`
+	Status      string            `json:"status"`
+	LocalState  string            `json:"localState"`
+	Paused      bool              `json:"paused"`
+	Size        int64             `json:"size"`
+	PercentDone int               `json:"percentDone"`
+	Downloaded  int64             `json:"downloaded"`
+	Progress    float64           `json:"progress"`
+	Speed       float64           `json:"speed"`
+	DownloadDir string            `json:"downloadDir"`
+	Category    string            `json:"category"`
+	Error       string            `json:"error"`
+	ErrorCode   string            `json:"errorCode"`
+	Files       GraphQLFileCount  `json:"files"`
+	RetryCycles int               `json:"retryCycles"`
+	Quarantine  string            `json:"quarantineReason"`
+	Outcome     string            `json:"outcome"`
+	FailedFiles []GraphQLFailed   `json:"failedFiles"`
+	Notes       string            `json:"notes"`
+	Metadata    []GraphQLMetadata `json:"metadata"`
+	RequestedBy string            `json:"requestedBy"`
+	CreatedAt   *time.Time        `json:"createdAt"`
+	FinishedAt  *time.Time        `json:"finishedAt"`
+}
+
+// GraphQLFileCount summarizes the local files of a transfer
+type GraphQLFileCount struct {
+	Total     int32 `json:"total"`
+	Completed int32 `json:"completed"`
+	Failed    int32 `json:"failed"`
+	Skipped   int32 `json:"skipped"`
+}
+
+// GraphQLFailed is a file of a transfer that failed to download
+type GraphQLFailed struct {
+	FileID    int64  `json:"fileId"`
+	Name      string `json:"name"`
+	Size      int64  `json:"size"`
+	Error     string `json:"error"`
+	ErrorCode string `json:"errorCode"`
+}
+
+// GraphQLMetadata is a key/value pair attached to a transfer
+type GraphQLMetadata struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// GraphQLFile is a file being downloaded
+type GraphQLFile struct {
+	FileID       int64  `json:"fileId"`
+	TransferID   int64  `json:"transferId"`
+	TransferName string `json:"transferName"`
+}
+
+// GraphQLEvent is an event as exposed over GraphQL
+type GraphQLEvent struct {
+	Type            string            `json:"type"`
+	Time            time.Time         `json:"time"`
+	TransferID      int64             `json:"transferId"`
+	Hash            string            `json:"hash"`
+	Name            string            `json:"name"`
+	Category        string            `json:"category"`
+	Path            string            `json:"path"`
+	FileID          int64             `json:"fileId"`
+	FileName        string            `json:"fileName"`
+	Size            int64             `json:"size"`
+	DurationSeconds float64           `json:"durationSeconds"`
+	Speed           float64           `json:"speed"`
+	Error           string            `json:"error"`
+	ErrorCode       string            `json:"errorCode"`
+	Reason          string            `json:"reason"`
+	Notes           string            `json:"notes"`
+	Metadata        []GraphQLMetadata `json:"metadata"`
+	RequestedBy     string            `json:"requestedBy"`
+}
+
+// GraphQLStats is the download manager activity as exposed over GraphQL
+type GraphQLStats struct {
+	Workers          int        `json:"workers"`
+	ActiveDownloads  int        `json:"activeDownloads"`
+	ActiveFiles      int        `json:"activeFiles"`
+	QueuedJobs       int        `json:"queuedJobs"`
+	Transfers        int        `json:"transfers"`
+	Downloading      int        `json:"downloading"`
+	Failed           int        `json:"failed"`
+	Quarantined      int        `json:"quarantined"`
+	Processed        int        `json:"processed"`
+	DownloadedBytes  int64      `json:"downloadedBytes"`
+	SpeedLimitKBps   int        `json:"speedLimitKBps"`
+	UnthrottledUntil *time.Time `json:"unthrottledUntil"`
+	Maintenance      bool       `json:"maintenance"`
+}
+
+// newGraphQLSchema wires the GraphQL root fields to the download manager
+func (s *Server) newGraphQLSchema() *graphql.Schema {
+	return &graphql.Schema{
+		Query: map[string]graphql.Resolver{
+			"transfers": func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+				requestedBy, err := graphql.StringArg(args, "requestedBy", "")
+				if err != nil {
+					return nil, err
+				}
+				return s.graphqlTransfers(requestedBy), nil
+			},
+			"transfer": func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+				id, err := graphql.IntArg(args, "id", 0)
+				if err != nil {
+					return nil, err
+				}
+				for _, t := range s.graphqlTransfers("") {
+					if t.ID == int64(id) {
+						return t, nil
+					}
+				}
+				return nil, nil
+			},
+			"files": func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+				transferID, err := graphql.IntArg(args, "transferId", 0)
+				if err != nil {
+					return nil, err
+				}
+				return s.graphqlFiles(int64(transferID)), nil
+			},
+			"history": func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+				limit, err := graphql.IntArg(args, "limit", 50)
+				if err != nil {
+					return nil, err
+				}
+				types, err := graphql.StringListArg(args, "types")
+				if err != nil {
+					return nil, err
+				}
+				requestedBy, err := graphql.StringArg(args, "requestedBy", "")
+				if err != nil {
+					return nil, err
+				}
+				return s.graphqlHistory(limit, types, requestedBy), nil
+			},
+			"stats": func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+				return s.graphqlStats(), nil
+			},
+		},
+		Subscription: map[string]graphql.SubscriptionResolver{
+			"events":    s.subscribeEvents,
+			"transfers": s.subscribeTransfers,
+		},
+	}
+}
+
+// graphqlTransfers combines Put.io transfers with their local download state,
+// only of transfers added by the given API user if one is set
+func (s *Server) graphqlTransfers(requestedBy string) []GraphQLTransfer {
+	processor := s.dlManager.GetTransferProcessor()
+	if processor == nil {
+		return []GraphQLTransfer{}
+	}
+
+	transfers := processor.GetTransfers()
+	result := make([]GraphQLTransfer, 0, len(transfers))
+	for _, t := range transfers {
+		transfer := s.graphqlTransfer(t)
+		if requestedBy != "" && transfer.RequestedBy != requestedBy {
+			continue
+		}
+		result = append(result, transfer)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+// graphqlTransfer converts a single transfer
+func (s *Server) graphqlTransfer(t *putio.Transfer) GraphQLTransfer {
+	transfer := GraphQLTransfer{
+		ID:          t.ID,
+		Hash:        t.Hash,
+		Name:        t.Name,
+		Status:      t.Status,
+		LocalState:  "remote",
+		Paused:      s.dlManager.IsPaused(t.ID),
+		Size:        int64(t.Size),
+		PercentDone: t.PercentDone,
+		DownloadDir: s.dlManager.TargetDir(t.ID),
+		Category:    s.dlManager.Category(t.ID),
+		Error:       t.ErrorMessage,
+		FailedFiles: []GraphQLFailed{},
+	}
+	transfer.Notes, transfer.Metadata, transfer.RequestedBy = s.graphqlAnnotation(t.ID)
+	if t.ErrorMessage != "" {
+		transfer.ErrorCode = download.ErrorCodeRemoteFailed
+	}
+	if t.CreatedAt != nil && !t.CreatedAt.IsZero() {
+		transfer.CreatedAt = &t.CreatedAt.Time
+	}
+	if t.FinishedAt != nil && !t.FinishedAt.IsZero() {
+		transfer.FinishedAt = &t.FinishedAt.Time
+	}
+
+	if ctx, ok := s.dlManager.GetCoordinator().GetTransferContext(t.ID); ok {
+		ctx.Mu.RLock()
+		defer ctx.Mu.RUnlock()
+
+		transfer.LocalState = strings.ToLower(ctx.State.String())
+		transfer.Downloaded = ctx.DownloadedSize
+		transfer.Files = GraphQLFileCount{
+			Total:     ctx.TotalFiles,
+			Completed: ctx.CompletedFiles,
+			Failed:    ctx.FailedFiles,
+			Skipped:   ctx.SkippedFiles,
+		}
+		transfer.RetryCycles = ctx.RetryCycles
+		transfer.Quarantine = ctx.QuarantineReason
+		transfer.Outcome = ctx.Outcome()
+		for _, f := range ctx.FailedFileDetails() {
+			transfer.FailedFiles = append(transfer.FailedFiles, GraphQLFailed(f))
+		}
+		if ctx.TotalSize > 0 {
+			transfer.Progress = float64(ctx.DownloadedSize) / float64(ctx.TotalSize) * 100
+		}
+		if ctx.State == download.TransferLifecycleProcessed {
+			transfer.Progress = 100
+		}
+		if !ctx.StartTime.IsZero() {
+			if elapsed := time.Since(ctx.StartTime).Seconds(); elapsed > 0 {
+				transfer.Speed = float64(ctx.DownloadedSize) / elapsed
+			}
+		}
+		if ctx.Error != nil && transfer.Error == "" {
+			transfer.Error = ctx.Error.Error()
+			transfer.ErrorCode = download.ErrorCode(ctx.Error)
+		}
+	}
+	return transfer
+}
+
+// graphqlFiles lists the files being downloaded, optionally for a single transfer
+func (s *Server) graphqlFiles(transferID int64) []GraphQLFile {
+	coordinator := s.dlManager.GetCoordinator()
+	files := make([]GraphQLFile, 0)
+	for _, f := range s.dlManager.ActiveFiles() {
+		if transferID != 0 && f.TransferID != transferID {
+			continue
+		}
+		file := GraphQLFile{FileID: f.FileID, TransferID: f.TransferID}
+		if ctx, ok := coordinator.GetTransferContext(f.TransferID); ok {
+			file.TransferName = ctx.Name
+		}
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].FileID < files[j].FileID })
+	return files
+}
+
+// graphqlHistory returns the most recent transfer events, newest first, only
+// of transfers added by the given API user if one is set
+func (s *Server) graphqlHistory(limit int, types []string, requestedBy string) []GraphQLEvent {
+	history := s.dlManager.History()
+	result := make([]GraphQLEvent, 0, len(history))
+	for i := len(history) - 1; i >= 0 && (limit <= 0 || len(result) < limit); i-- {
+		if !matchesEventType(history[i].Type, types) || (requestedBy != "" && history[i].RequestedBy != requestedBy) {
+			continue
+		}
+		result = append(result, newGraphQLEvent(history[i]))
+	}
+	return result
+}
+
+// graphqlStats returns the current activity of the download manager
+func (s *Server) graphqlStats() GraphQLStats {
+	stats := s.dlManager.Stats()
+	result := GraphQLStats{
+		Workers:         stats.Workers,
+		ActiveDownloads: stats.ActiveDownloads,
+		ActiveFiles:     stats.ActiveFiles,
+		QueuedJobs:      stats.QueuedJobs,
+		Transfers:       stats.Transfers,
+		Downloading:     stats.Downloading,
+		Failed:          stats.Failed,
+		Quarantined:     stats.Quarantined,
+		Processed:       stats.Processed,
+		DownloadedBytes: stats.DownloadedBytes,
+		SpeedLimitKBps:  stats.SpeedLimitKBps,
+		Maintenance:     stats.Maintenance,
+	}
+	if !stats.UnthrottledUntil.IsZero() {
+		result.UnthrottledUntil = &stats.UnthrottledUntil
+	}
+	return result
+}
+
+// subscribeEvents streams events from the event bus
+func (s *Server) subscribeEvents(ctx context.Context, args map[string]interface{}) (<-chan interface{}, error) {
+	types, err := graphql.StringListArg(args, "types")
+	if err != nil {
+		return nil, err
+	}
+	busTypes := make([]events.Type, 0, len(types))
+	for _, t := range types {
+		busTypes = append(busTypes, events.Type(t))
+	}
+
+	sub := s.dlManager.Events().Subscribe("graphql", busTypes...)
+	out := make(chan interface{})
+	go func() {
+		defer close(out)
+		defer sub.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-sub.Events():
+				if !ok {
+					return
+				}
+				select {
+				case out <- newGraphQLEvent(event):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+// subscribeTransfers streams snapshots of all transfers at a fixed interval
+func (s *Server) subscribeTransfers(ctx context.Context, args map[string]interface{}) (<-chan interface{}, error) {
+	interval, err := graphql.IntArg(args, "interval", 2)
+	if err != nil {
+		return nil, err
+	}
+	if interval < 1 {
+		return nil, fmt.Errorf("interval must be at least 1 second")
+	}
+
+	out := make(chan interface{})
+	go func() {
+		defer close(out)
+		ticker := time.NewTicker(time.Duration(interval) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case out <- s.graphqlTransfers(""):
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// newGraphQLEvent converts a bus event
+func newGraphQLEvent(e events.Event) GraphQLEvent {
+	return GraphQLEvent{
+		Type:            string(e.Type),
+		Time:            e.Time,
+		TransferID:      e.TransferID,
+		Hash:            e.Hash,
+		Name:            e.Name,
+		Category:        e.Category,
+		Path:            e.Path,
+		FileID:          e.FileID,
+		FileName:        e.FileName,
+		Size:            e.Size,
+		DurationSeconds: e.Duration.Seconds(),
+		Speed:           e.Speed,
+		Error:           e.Error,
+		ErrorCode:       e.ErrorCode,
+		Reason:          e.Reason,
+		Notes:           e.Notes,
+		Metadata:        graphqlMetadata(e.Metadata),
+		RequestedBy:     e.RequestedBy,
+	}
+}
+
+// graphqlAnnotation returns the notes and metadata attached to a transfer and
+// the user who added it
+func (s *Server) graphqlAnnotation(transferID int64) (string, []GraphQLMetadata, string) {
+	note, _ := s.dlManager.Annotation(transferID)
+	return note.Notes, graphqlMetadata(note.Metadata), note.RequestedBy
+}
+
+// graphqlMetadata converts metadata to key/value pairs sorted by key
+func graphqlMetadata(metadata map[string]string) []GraphQLMetadata {
+	result := make([]GraphQLMetadata, 0, len(metadata))
+	for key, value := range metadata {
+		result = append(result, GraphQLMetadata{Key: key, Value: value})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Key < result[j].Key })
+	return result
+}
+
+// matchesEventType reports whether an event type is in the list, or the list is empty
+func matchesEventType(t events.Type, types []string) bool {
+	if len(types) == 0 {
+		return true
+	}
+	for _, want := range types {
+		if string(t) == want {
+			return true
+		}
+	}
+	return false
+}
+
+// handleGraphQL executes GraphQL queries. Requests are accepted as POST with a
+// JSON body or as GET with query parameters. Subscriptions are streamed as
+// server-sent events, one "next" event per result followed by "complete".
+func (s *Server) handleGraphQL(w http.ResponseWriter, r *http.Request) {
+	var req graphql.Request
+	switch r.Method {
+	case http.MethodPost:
+		r.Body = http.MaxBytesReader(w, r.Body, maxRequestBody)
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	case http.MethodGet:
+		req.Query = r.URL.Query().Get("query")
+		req.OperationName = r.URL.Query().Get("operationName")
+		if variables := r.URL.Query().Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+				http.Error(w, "Invalid variables", http.StatusBadRequest)
+				return
+			}
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	_, op, err := graphql.Prepare(req)
+	// Links and images on other sites can make the browser send GET requests
+	if err == nil && r.Method == http.MethodGet && op.Type == graphql.OperationMutation {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Mutations must be sent as POST", http.StatusMethodNotAllowed)
+		return
+	}
+	if err == nil && op.Type == graphql.OperationSubscription {
+		s.streamGraphQL(w, r, req)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.graphql.Execute(r.Context(), req))
+}
+
+// streamGraphQL runs a subscription until the client disconnects
+func (s *Server) streamGraphQL(w http.ResponseWriter, r *http.Request, req graphql.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	responses, err := s.graphql.Subscribe(r.Context(), req)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(graphql.Response{Errors: []*graphql.Error{{Message: err.Error()}}})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	flusher.Flush()
+
+	log.Debug("graphql").Str("remote_addr", r.RemoteAddr).Msg("Subscription started")
+	for response := range responses {
+		data, err := json.Marshal(response)
+		if err != nil {
+			log.Error("graphql").Err(err).Msg("Failed to encode subscription result")
+			continue
+		}
+		fmt.Fprintf(w, "event: next\ndata: %s\n\n", data)
+		flusher.Flush()
+	}
+	fmt.Fprint(w, "event: complete\ndata:\n\n")
+	flusher.Flush()
+	log.Debug("graphql").Str("remote_addr", r.RemoteAddr).Msg("Subscription ended")
+}
+
+// handleGraphQLSchema serves the schema in GraphQL SDL
+func (s *Server) handleGraphQLSchema(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprint(w, graphqlSchema)
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/elsbrock/plundrio/internal/graphql"
+)
+
+// graphqlServer returns a server answering GraphQL requests with a schema
+// that has a single query field
+func graphqlServer() *Server {
+	return &Server{graphql: &graphql.Schema{Query: map[string]graphql.Resolver{
+		"ping": func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+			return "pong", nil
+		},
+	}}}
+}
+
+func TestHandleGraphQL(t *testing.T) {
+	s := graphqlServer()
+
+	for _, tt := range []struct {
+		name   string
+		body   string
+		status int
+		want   string
+	}{
+		{"query", `{"query":"{ ping }"}`, http.StatusOK, `{"data":{"ping":"pong"}}`},
+		{"nested too deeply", `{"query":"` + strings.Repeat("{a", 100_000) + `"}`, http.StatusOK, "nested deeper than"},
+		{"body too large", `{"query":"{ ping }` + strings.Repeat(" ", maxRequestBody) + `"}`, http.StatusBadRequest, "Invalid request body"},
+		{"invalid body", `{"query":`, http.StatusBadRequest, "Invalid request body"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			s.handleGraphQL(w, r)
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if !strings.Contains(w.Body.String(), tt.want) {
+				t.Errorf("body = %.200s, want it to contain %q", w.Body.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleGraphQLGet(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/graphql?query=%7B+ping+%7D", nil)
+	w := httptest.NewRecorder()
+	graphqlServer().handleGraphQL(w, r)
+
+	var response graphql.Response
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := response.Data.(map[string]interface{}); data["ping"] != "pong" {
+		t.Errorf("data = %v, want ping: pong", response.Data)
+	}
+}
+
+func TestHandleGraphQLGetMutation(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/graphql?query=mutation+%7B+ping+%7D", nil)
+	w := httptest.NewRecorder()
+	graphqlServer().handleGraphQL(w, r)
+
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+}
@@ -3,8 +3,11 @@ package server
 import (
 	"encoding/json"
 	"net/http"
+	"time"
 
+	"github.com/elsbrock/plundrio/internal/download"
 	"github.com/elsbrock/plundrio/internal/log"
+	"github.com/elsbrock/plundrio/internal/metrics"
 )
 
 // handleRPC processes transmission-rpc requests
@@ -77,24 +80,47 @@ func (s *Server) handleRPC(w http.ResponseWriter, r *http.Request) {
 		RawJSON("arguments", req.Arguments).
 		Msg("Processing RPC method")
 
+	start := time.Now()
+	providerStart := metrics.ProviderTime()
 	switch req.Method {
 	case "torrent-add":
-		result, err = s.handleTorrentAdd(req.Arguments)
+		result, err = s.handleTorrentAdd(req.Arguments, requestUser(r))
 	case "torrent-get":
 		result, err = s.handleTorrentGet(req.Arguments)
 	case "torrent-remove":
 		result, err = s.handleTorrentRemove(req.Arguments)
+	case "torrent-set-location":
+		result, err = s.handleTorrentSetLocation(req.Arguments)
+	case "torrent-stop":
+		result, err = s.handleTorrentStop(req.Arguments)
+	case "torrent-start", "torrent-start-now":
+		result, err = s.handleTorrentStart(req.Arguments)
+	case "torrent-set":
+		result, err = s.handleTorrentSet(req.Arguments)
+	case "queue-move-top":
+		result, err = s.handleQueueMove(req.Arguments, download.MoveTop)
+	case "queue-move-up":
+		result, err = s.handleQueueMove(req.Arguments, download.MoveUp)
+	case "queue-move-down":
+		result, err = s.handleQueueMove(req.Arguments, download.MoveDown)
+	case "queue-move-bottom":
+		result, err = s.handleQueueMove(req.Arguments, download.MoveBottom)
 	case "session-get":
-		result = map[string]interface{}{
-			"download-dir":        s.cfg.TargetDir,
-			"version":             "2.94", // Transmission version to report
-			"rpc-version":         15,     // RPC version to report
-			"rpc-version-minimum": 1,
-		}
+		result, err = s.handleSessionGet(req.Arguments)
 		log.Debug("rpc").
 			Str("client_addr", r.RemoteAddr).
-			Str("download_dir", s.cfg.TargetDir).
+			Str("download_dir", s.dlManager.DefaultTargetDir()).
 			Msg("Session information requested")
+	case "session-set":
+		result, err = s.handleSessionSet(req.Arguments)
+	case "session-stats":
+		result, err = s.handleSessionStats()
+	case "session-close":
+		result, err = s.handleSessionClose(r.RemoteAddr)
+	case "port-test":
+		result, err = s.handlePortTest()
+	case "blocklist-update":
+		result, err = s.handleBlocklistUpdate()
 	default:
 		// Return empty success for unsupported methods
 		result = struct{}{}
@@ -103,6 +129,7 @@ func (s *Server) handleRPC(w http.ResponseWriter, r *http.Request) {
 			Str("rpc_method", req.Method).
 			Msg("Unsupported RPC method called")
 	}
+	observeRPC(req.Method, r.RemoteAddr, start, providerStart, err)
 
 	// Send response
 	if err != nil {
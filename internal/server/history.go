@@ -0,0 +1,80 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/download"
+)
+
+// defaultHistoryLimit is how many downloads a history page lists when limit
+// is not set
+const defaultHistoryLimit = 50
+
+// HistoryPage is a page of the download history
+type HistoryPage struct {
+	Total   int                     `json:"total"` // downloads matching the filters
+	Offset  int                     `json:"offset"`
+	Limit   int                     `json:"limit"`
+	Entries []download.HistoryEntry `json:"entries"`
+}
+
+// handleHistory lists finished downloads, newest first. Query parameters:
+// outcome (completed, failed, cancelled), category, user, q (part of the
+// name), since (RFC 3339 time), limit and offset.
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	params := r.URL.Query()
+	query := download.HistoryQuery{
+		Outcome:     params.Get("outcome"),
+		Category:    params.Get("category"),
+		RequestedBy: params.Get("user"),
+		Search:      params.Get("q"),
+		Limit:       defaultHistoryLimit,
+	}
+	switch query.Outcome {
+	case "", download.OutcomeCompleted, download.OutcomeFailed, download.OutcomeCancelled:
+	default:
+		http.Error(w, "Invalid outcome parameter (use completed, failed or cancelled)", http.StatusBadRequest)
+		return
+	}
+	if value := params.Get("since"); value != "" {
+		since, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, "Invalid since parameter (use an RFC 3339 time)", http.StatusBadRequest)
+			return
+		}
+		query.Since = since
+	}
+	if value := params.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			http.Error(w, "Invalid limit parameter", http.StatusBadRequest)
+			return
+		}
+		query.Limit = n
+	}
+	if value := params.Get("offset"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid offset parameter", http.StatusBadRequest)
+			return
+		}
+		query.Offset = n
+	}
+
+	entries, total := s.dlManager.DownloadHistory(query)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(HistoryPage{
+		Total:   total,
+		Offset:  query.Offset,
+		Limit:   query.Limit,
+		Entries: entries,
+	})
+}
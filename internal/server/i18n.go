@@ -0,0 +1,97 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// langCookie remembers the language picked on the dashboard
+const langCookie = "plundrio-lang"
+
+// dashboardLanguage returns the language to show the dashboard in: the one
+// picked with ?lang=, which is remembered in a cookie, the one picked
+// earlier, or the one the browser prefers
+func (s *Server) dashboardLanguage(w http.ResponseWriter, r *http.Request) string {
+	if picked := r.URL.Query().Get("lang"); picked != "" {
+		if lang := s.i18n.Match(picked); lang != "" {
+			http.SetCookie(w, &http.Cookie{
+				Name:     langCookie,
+				Value:    lang,
+				Path:     "/",
+				MaxAge:   int((365 * 24 * time.Hour).Seconds()),
+				SameSite: http.SameSiteLaxMode,
+			})
+			return lang
+		}
+	}
+	if cookie, err := r.Cookie(langCookie); err == nil {
+		if lang := s.i18n.Match(cookie.Value); lang != "" {
+			return lang
+		}
+	}
+	return s.i18n.Negotiate(r.Header.Get("Accept-Language"))
+}
+
+// Translation is the messages of a language, in English where they are not
+// translated yet
+type Translation struct {
+	Lang     string            `json:"lang"`
+	Messages map[string]string `json:"messages"`
+	Missing  []string          `json:"missing"` // keys of messages not translated yet
+}
+
+// handleLanguages lists the languages the dashboard is available in
+func (s *Server) handleLanguages(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.i18n.Languages())
+}
+
+// handleTranslation returns the messages of a language (GET), takes
+// contributed messages of the form {"messages": {"key": "text"}} (POST), or
+// removes those contributed (DELETE)
+func (s *Server) handleTranslation(w http.ResponseWriter, r *http.Request) {
+	lang := r.PathValue("lang")
+
+	switch r.Method {
+	case http.MethodGet:
+		if !s.i18n.Available(lang) {
+			http.Error(w, "Language not available", http.StatusNotFound)
+			return
+		}
+		messages, missing := s.i18n.Messages(lang)
+		if missing == nil {
+			missing = []string{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(Translation{Lang: lang, Messages: messages, Missing: missing})
+
+	case http.MethodPost:
+		var req struct {
+			Messages map[string]string `json:"messages"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		if err := s.i18n.Contribute(lang, req.Messages); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case http.MethodDelete:
+		if !s.i18n.Remove(lang) {
+			http.Error(w, "No contributed messages", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// defaultLogTail is how many recent log lines are returned when tail is not set
+const defaultLogTail = 100
+
+// handleLogs returns recent log lines as newline delimited JSON, one zerolog
+// object per line. Query parameters: level (minimum level), component, tail
+// (number of recent lines) and follow (keep streaming new lines).
+func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := log.Filter{Level: log.LevelInfo, Component: query.Get("component")}
+	if level := query.Get("level"); level != "" {
+		parsed, err := log.ParseLevel(level)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter.Level = parsed
+	}
+
+	tail := defaultLogTail
+	if value := query.Get("tail"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid tail parameter", http.StatusBadRequest)
+			return
+		}
+		tail = n
+	}
+	follow, _ := strconv.ParseBool(query.Get("follow"))
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if !follow {
+		for _, entry := range log.Recent(filter, tail) {
+			writeLogEntry(w, entry)
+		}
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	stream, recent := log.Subscribe(filter, tail)
+	defer stream.Close()
+
+	for _, entry := range recent {
+		writeLogEntry(w, entry)
+	}
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.stopChan:
+			return
+		case entry, ok := <-stream.Entries():
+			if !ok {
+				return
+			}
+			if err := writeLogEntry(w, entry); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// writeLogEntry writes a log entry as a single line
+func writeLogEntry(w http.ResponseWriter, entry log.Entry) error {
+	if _, err := w.Write(entry.Raw); err != nil {
+		return err
+	}
+	_, err := w.Write([]byte{'\n'})
+	return err
+}
+
+// handleTransferLog returns the log lines and aria2c output captured for a
+// single transfer as newline delimited JSON, oldest first. The optional tail
+// query parameter limits the response to the most recent lines.
+func (s *Server) handleTransferLog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid transfer ID", http.StatusBadRequest)
+		return
+	}
+
+	entries, ok := log.TransferLog(id)
+	if !ok {
+		http.Error(w, "No log captured for this transfer", http.StatusNotFound)
+		return
+	}
+
+	if value := r.URL.Query().Get("tail"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid tail parameter", http.StatusBadRequest)
+			return
+		}
+		if len(entries) > n {
+			entries = entries[len(entries)-n:]
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	for _, entry := range entries {
+		if err := writeLogEntry(w, entry); err != nil {
+			return
+		}
+	}
+}
+
+// handleDebugPutio returns the put.io API requests and responses captured
+// with putio-debug as a JSON file to attach to bug reports, oldest first.
+// DELETE forgets them.
+func (s *Server) handleDebugPutio(w http.ResponseWriter, r *http.Request) {
+	if !s.requirePutio(w) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodDelete:
+		s.client.ClearCaptured()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="plundrio-putio-debug.json"`)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(s.client.Captured())
+}
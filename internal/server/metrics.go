@@ -0,0 +1,78 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/log"
+	"github.com/elsbrock/plundrio/internal/metrics"
+)
+
+// slowRPCThreshold is how long an RPC request may take before it is logged
+// as slow. *arr applications give up on download clients after a while, so
+// slow requests are worth knowing about well before that.
+const slowRPCThreshold = 5 * time.Second
+
+var (
+	rpcDuration = metrics.NewHistogramVec("plundrio_rpc_request_duration_seconds",
+		"Latency of Transmission RPC requests by method.", "method")
+	rpcErrors = metrics.NewCounterVec("plundrio_rpc_errors_total",
+		"Transmission RPC requests answered with an error, by method.", "method")
+)
+
+// rpcMethods are the RPC methods with metrics of their own, all others are
+// counted as "other" so clients cannot create arbitrary series
+var rpcMethods = map[string]bool{
+	"torrent-add":          true,
+	"torrent-get":          true,
+	"torrent-remove":       true,
+	"torrent-set-location": true,
+	"torrent-stop":         true,
+	"torrent-start":        true,
+	"torrent-start-now":    true,
+	"session-get":          true,
+	"session-set":          true,
+	"session-stats":        true,
+	"session-close":        true,
+	"port-test":            true,
+	"blocklist-update":     true,
+}
+
+// observeRPC records the latency and outcome of an RPC request and logs it if
+// it was slow, along with how long providers took meanwhile. That time
+// includes provider requests of background work running at the same time, so
+// it tells whether plundrio or a provider was slow rather than exactly which
+// calls the request made.
+func observeRPC(method, clientAddr string, start time.Time, providerStart time.Duration, err error) {
+	elapsed := time.Since(start)
+	label := method
+	if !rpcMethods[label] {
+		label = "other"
+	}
+
+	rpcDuration.Observe(elapsed, label)
+	if err != nil {
+		rpcErrors.Inc(label)
+	}
+
+	if elapsed >= slowRPCThreshold {
+		log.Warn("rpc").
+			Str("client_addr", clientAddr).
+			Str("rpc_method", method).
+			Dur("duration", elapsed).
+			Dur("provider_time", metrics.ProviderTime()-providerStart).
+			Err(err).
+			Msg("Slow RPC request")
+	}
+}
+
+// handleMetrics serves the RPC and provider metrics in the Prometheus text format
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	metrics.Write(w)
+}
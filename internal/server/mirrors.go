@@ -0,0 +1,45 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// handleMirrors lists the mirrored folders with the files deleted locally,
+// which are not downloaded again
+func (s *Server) handleMirrors(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.dlManager.Mirrors())
+}
+
+// handleMirrorRestore has files deleted locally from a mirrored folder
+// downloaded again on its next check. It expects a POST with a JSON body of
+// the form {"folder": 123, "name": "file.mkv"}; without a name, all files
+// deleted locally are restored.
+func (s *Server) handleMirrorRestore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Folder int64  `json:"folder"`
+		Name   string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Folder == 0 {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	restored, err := s.dlManager.RestoreMirrored(req.Folder, req.Name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"restored": restored})
+}
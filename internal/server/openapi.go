@@ -0,0 +1,1379 @@
+package server
+
+import (
+	"net/http"
+)
+
+// openAPIDocument describes the management API in OpenAPI 3 format
+const openAPIDocument = `{
+  "openapi": "3.0.3",
+  "info": {
+    "title": "plundrio API",
+    "description": "Management API of the plundrio daemon. Transfers are added and removed through the Transmission RPC endpoint, the REST endpoints manage them and the GraphQL endpoint serves queries and live events. Requests other than GET, HEAD and OPTIONS to /api and /graphql must have a JSON body (Content-Type: application/json) or an X-Requested-With header, otherwise they are answered 415; GraphQL mutations are only accepted as POST.",
+    "version": "1.0"
+  },
+  "paths": {
+    "/api/downloads": {
+      "get": {
+        "summary": "List active downloads",
+        "description": "With since, only the downloads that changed since an earlier response are returned. Send the ETag as If-None-Match to get 304 while nothing changed.",
+        "tags": ["Transfers"],
+        "parameters": [
+          {"name": "user", "in": "query", "description": "Only transfers added by this API user", "schema": {"type": "string"}},
+          {"name": "since", "in": "query", "description": "Cursor of an earlier delta response; empty returns all downloads as delta", "schema": {"type": "string"}}
+        ],
+        "responses": {
+          "200": {
+            "description": "Transfers currently downloading, or a delta with since",
+            "content": {"application/json": {"schema": {"oneOf": [
+              {"type": "array", "items": {"$ref": "#/components/schemas/Download"}},
+              {"$ref": "#/components/schemas/DownloadsDelta"}
+            ]}}}
+          },
+          "304": {"description": "Nothing changed since the ETag"}
+        }
+      }
+    },
+    "/api/transfers/add": {
+      "post": {
+        "summary": "Add a magnet link or an HTTP/FTP URL",
+        "description": "put.io fetches the URL into the configured folder, and plundrio then downloads it like any other transfer.",
+        "tags": ["Transfers"],
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {"$ref": "#/components/schemas/AddRequest"}}}
+        },
+        "responses": {
+          "202": {"description": "Transfer exceeds the quota of the API user and is added once the quota allows it (quota-action queue)"},
+          "204": {"description": "Transfer added"},
+          "400": {"description": "Invalid request or unsupported URL"},
+          "429": {"description": "Transfer exceeds the quota of the API user"},
+          "502": {"description": "put.io rejected the transfer"}
+        }
+      }
+    },
+    "/api/providers": {
+      "get": {
+        "summary": "List the providers and provider routes",
+        "description": "Providers in the order new transfers are tried, and the routes sending transfers to a provider first.",
+        "tags": ["Transfers"],
+        "responses": {
+          "200": {"description": "Providers and routes", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Providers"}}}}
+        }
+      }
+    },
+    "/api/users": {
+      "get": {
+        "summary": "List the API users with their quotas and usage",
+        "tags": ["Transfers"],
+        "responses": {
+          "200": {"description": "API users", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/User"}}}}}
+        }
+      }
+    },
+    "/api/i18n": {
+      "get": {
+        "summary": "List the languages the dashboard is available in",
+        "tags": ["Translations"],
+        "responses": {
+          "200": {"description": "Languages", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Language"}}}}}
+        }
+      }
+    },
+    "/api/i18n/{lang}": {
+      "parameters": [
+        {"name": "lang", "in": "path", "required": true, "description": "Language tag such as de or pt-BR", "schema": {"type": "string"}}
+      ],
+      "get": {
+        "summary": "Get the dashboard messages of a language",
+        "tags": ["Translations"],
+        "responses": {
+          "200": {"description": "Messages, in English where not translated yet", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Translation"}}}},
+          "404": {"description": "Language not available"}
+        }
+      },
+      "post": {
+        "summary": "Contribute or correct messages of a language",
+        "description": "Keys must be those of the English messages, and translations must use the same placeholders. Messages not sent keep their translation.",
+        "tags": ["Translations"],
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {"type": "object", "required": ["messages"], "properties": {"messages": {"type": "object", "additionalProperties": {"type": "string"}}}}}}
+        },
+        "responses": {
+          "204": {"description": "Messages saved"},
+          "400": {"description": "Invalid language code, unknown key or placeholders that do not match"}
+        }
+      },
+      "delete": {
+        "summary": "Remove the contributed messages of a language",
+        "tags": ["Translations"],
+        "responses": {
+          "204": {"description": "Contributed messages removed"},
+          "404": {"description": "No contributed messages"}
+        }
+      }
+    },
+    "/api/push": {
+      "get": {
+        "summary": "Get the VAPID key browsers subscribe to Web Push notifications with",
+        "tags": ["Notifications"],
+        "responses": {
+          "200": {"description": "Web Push settings", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/PushInfo"}}}}
+        }
+      }
+    },
+    "/api/push/subscribe": {
+      "post": {
+        "summary": "Subscribe a browser to notifications of completed and failed transfers",
+        "description": "Browsers subscribed with an API token only hear of that user's transfers.",
+        "tags": ["Notifications"],
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {"$ref": "#/components/schemas/PushSubscription"}}}
+        },
+        "responses": {
+          "204": {"description": "Browser subscribed"},
+          "400": {"description": "Invalid subscription"},
+          "404": {"description": "Web Push is disabled"}
+        }
+      }
+    },
+    "/api/push/unsubscribe": {
+      "post": {
+        "summary": "Stop notifications to a browser",
+        "tags": ["Notifications"],
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {"type": "object", "required": ["endpoint"], "properties": {"endpoint": {"type": "string"}}}}}
+        },
+        "responses": {
+          "204": {"description": "Browser unsubscribed"},
+          "400": {"description": "Invalid request"},
+          "404": {"description": "Web Push is disabled or the browser is not subscribed"}
+        }
+      }
+    },
+    "/api/transfers/location": {
+      "post": {
+        "summary": "Change the download directory of a transfer",
+        "tags": ["Transfers"],
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {"$ref": "#/components/schemas/LocationRequest"}}}
+        },
+        "responses": {
+          "204": {"description": "Location changed"},
+          "400": {"description": "Invalid request or location"},
+          "404": {"description": "Transfer not found"}
+        }
+      }
+    },
+    "/api/transfers/notes": {
+      "get": {
+        "summary": "Get the notes and metadata of a transfer",
+        "tags": ["Transfers"],
+        "parameters": [
+          {"name": "id", "in": "query", "required": true, "schema": {"type": "integer", "format": "int64"}}
+        ],
+        "responses": {
+          "200": {"description": "Notes and metadata", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Annotation"}}}},
+          "400": {"description": "Invalid transfer ID"},
+          "404": {"description": "Transfer has no notes"}
+        }
+      },
+      "post": {
+        "summary": "Replace the notes and metadata of a transfer",
+        "description": "Notes and metadata are kept in the state directory and show on the dashboard, in events and over GraphQL. Empty notes and metadata remove them.",
+        "tags": ["Transfers"],
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {"$ref": "#/components/schemas/NotesRequest"}}}
+        },
+        "responses": {
+          "204": {"description": "Notes changed"},
+          "400": {"description": "Invalid request"}
+        }
+      }
+    },
+    "/api/transfers/pause": {
+      "post": {
+        "summary": "Pause a transfer",
+        "description": "Running files are interrupted and continue where they left off once the transfer is resumed.",
+        "tags": ["Transfers"],
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {"$ref": "#/components/schemas/TransferRequest"}}}
+        },
+        "responses": {
+          "204": {"description": "Transfer paused"},
+          "400": {"description": "Invalid request"}
+        }
+      }
+    },
+    "/api/transfers/resume": {
+      "post": {
+        "summary": "Resume a paused transfer",
+        "tags": ["Transfers"],
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {"$ref": "#/components/schemas/TransferRequest"}}}
+        },
+        "responses": {
+          "204": {"description": "Transfer resumed"},
+          "400": {"description": "Invalid request"}
+        }
+      }
+    },
+    "/api/transfers/move": {
+      "post": {
+        "summary": "Move a transfer in the download queue",
+        "description": "Moves a transfer with queued files one place up or down, or to the top or bottom of the download queue. Moving past a transfer of another priority takes its priority.",
+        "tags": ["Transfers"],
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {"$ref": "#/components/schemas/MoveRequest"}}}
+        },
+        "responses": {
+          "204": {"description": "Transfer moved"},
+          "400": {"description": "Invalid request"},
+          "409": {"description": "Transfer has no queued files or cannot move further"}
+        }
+      }
+    },
+    "/api/transfers/cancel": {
+      "post": {
+        "summary": "Cancel a transfer",
+        "description": "Stops the local downloads of the transfer and removes it and its files from Put.io.",
+        "tags": ["Transfers"],
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {"$ref": "#/components/schemas/CancelRequest"}}}
+        },
+        "responses": {
+          "204": {"description": "Transfer cancelled"},
+          "400": {"description": "Invalid request"},
+          "404": {"description": "Transfer not found"}
+        }
+      }
+    },
+    "/api/transfers/retry": {
+      "post": {
+        "summary": "Retry the failed files of a transfer",
+        "description": "Downloads the failed files of a failed or quarantined transfer again. Transfers are quarantined once their files failed in max-retry-cycles automatic retries.",
+        "tags": ["Transfers"],
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {"$ref": "#/components/schemas/TransferRequest"}}}
+        },
+        "responses": {
+          "204": {"description": "Failed files queued again"},
+          "400": {"description": "Invalid request"},
+          "404": {"description": "Transfer not found"},
+          "409": {"description": "Transfer is not failed or quarantined, or has no failed files"}
+        }
+      }
+    },
+    "/api/scan": {
+      "post": {
+        "summary": "Check the put.io folder right away",
+        "description": "Looks for new and finished transfers in the put.io folder instead of waiting for the next poll, e.g. right after adding a transfer in the put.io web interface. Returns once the folder was checked.",
+        "tags": ["Transfers"],
+        "responses": {
+          "204": {"description": "Folder checked"},
+          "409": {"description": "Not possible during a maintenance window or while stopping"},
+          "504": {"description": "The check did not finish in time"}
+        }
+      }
+    },
+    "/api/stats": {
+      "get": {
+        "summary": "Get the download manager's activity, the combined speed and the estimate for the whole queue",
+        "tags": ["Transfers"],
+        "responses": {
+          "200": {"description": "Statistics", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Stats"}}}}
+        }
+      }
+    },
+    "/api/stats/throughput": {
+      "get": {
+        "summary": "Get the download speed history",
+        "description": "The combined speed of all transfers, averaged per second for 15 minutes, per minute for 2 days and per hour for 90 days. Kept in the state directory, so it survives restarts.",
+        "tags": ["Transfers"],
+        "parameters": [
+          {"name": "resolution", "in": "query", "description": "Length of a step, minute by default", "schema": {"type": "string", "enum": ["second", "minute", "hour"]}},
+          {"name": "period", "in": "query", "description": "How far back, as Go duration, e.g. 168h; everything kept by default", "schema": {"type": "string"}}
+        ],
+        "responses": {
+          "200": {"description": "Speed history, oldest first", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Throughput"}}}},
+          "400": {"description": "Invalid resolution or period"}
+        }
+      }
+    },
+    "/status.json": {
+      "get": {
+        "summary": "Get the figures of the read-only status page",
+        "description": "Counts and speeds for homelab dashboards, readable from any origin. Also served on status-listen, which serves nothing else. Transfer names are replaced with status-redact-names.",
+        "tags": ["Transfers"],
+        "responses": {
+          "200": {"description": "Status", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Status"}}}}
+        }
+      }
+    },
+    "/api/widget": {
+      "get": {
+        "summary": "Get the summary for homelab dashboard widgets",
+        "description": "Active and queued transfers, the speed, the bytes left and the transfer completed last, readable from any origin. Also served on status-listen.",
+        "tags": ["Transfers"],
+        "parameters": [
+          {"name": "format", "in": "query", "description": "json (default) for raw numbers, list for formatted labels and values", "schema": {"type": "string", "enum": ["json", "list"]}}
+        ],
+        "responses": {
+          "200": {"description": "Summary", "content": {"application/json": {"schema": {"oneOf": [
+            {"$ref": "#/components/schemas/Widget"},
+            {"type": "array", "items": {"type": "object", "properties": {"label": {"type": "string"}, "value": {"type": "string"}}}}
+          ]}}}},
+          "400": {"description": "Invalid format parameter"}
+        }
+      }
+    },
+    "/api/widget/discover": {
+      "get": {
+        "summary": "List the widget endpoints with configuration for Homepage, Dashy and Organizr",
+        "tags": ["Transfers"],
+        "responses": {
+          "200": {"description": "Widget endpoints", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/WidgetDiscovery"}}}}
+        }
+      }
+    },
+    "/api/unthrottle": {
+      "get": {
+        "summary": "Get the temporary speed limit override",
+        "tags": ["Bandwidth"],
+        "responses": {
+          "200": {
+            "description": "Override status",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Unthrottle"}}}
+          }
+        }
+      },
+      "post": {
+        "summary": "Lift the speed limit temporarily",
+        "tags": ["Bandwidth"],
+        "parameters": [
+          {
+            "name": "minutes",
+            "in": "query",
+            "required": true,
+            "description": "How long to lift the limit for, 0 restores it right away",
+            "schema": {"type": "integer", "minimum": 0}
+          }
+        ],
+        "responses": {
+          "200": {
+            "description": "Override status",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Unthrottle"}}}
+          },
+          "400": {"description": "Invalid minutes parameter"}
+        }
+      }
+    },
+    "/api/files/search": {
+      "get": {
+        "summary": "Search the files of the put.io account",
+        "description": "Returns the first 50 files and folders matching the query anywhere in the account, as found by put.io's search.",
+        "tags": ["Files"],
+        "parameters": [
+          {"name": "q", "in": "query", "required": true, "description": "Search query", "schema": {"type": "string"}}
+        ],
+        "responses": {
+          "200": {
+            "description": "Matching files and folders",
+            "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/File"}}}}
+          },
+          "400": {"description": "Missing query"},
+          "502": {"description": "put.io search failed"}
+        }
+      }
+    },
+    "/api/files/download": {
+      "post": {
+        "summary": "Download a file or folder that is already on put.io",
+        "description": "The files are downloaded like those of a finished transfer, but kept on put.io afterwards. The download is tracked under the negated file ID.",
+        "tags": ["Files"],
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {"$ref": "#/components/schemas/TransferRequest"}}}
+        },
+        "responses": {
+          "200": {
+            "description": "Download queued",
+            "content": {"application/json": {"schema": {"type": "object", "properties": {"transfer_id": {"type": "integer", "format": "int64"}}}}}
+          },
+          "400": {"description": "Invalid request, unknown file or already queued"}
+        }
+      }
+    },
+    "/api/files/redownload": {
+      "post": {
+        "summary": "Download a downloaded file again",
+        "description": "Deletes the local copy of a file, e.g. one found to be corrupt, and downloads it again. The file is given by its local path or by transfer and file ID, its transfer must still be tracked and the file must still exist on put.io.",
+        "tags": ["Files"],
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {"$ref": "#/components/schemas/RedownloadRequest"}}}
+        },
+        "responses": {
+          "204": {"description": "File queued again"},
+          "400": {"description": "Invalid request"},
+          "404": {"description": "File or transfer not found"},
+          "409": {"description": "The file cannot be downloaded again right now"},
+          "410": {"description": "The file no longer exists on put.io"}
+        }
+      }
+    },
+    "/api/files/shared": {
+      "get": {
+        "summary": "List files shared by put.io friends",
+        "tags": ["Files"],
+        "responses": {
+          "200": {
+            "description": "Files and folders friends shared with the account",
+            "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/SharedFile"}}}}
+          },
+          "502": {"description": "Listing the files on put.io failed"}
+        }
+      }
+    },
+    "/api/files/shared/download": {
+      "post": {
+        "summary": "Download a file or folder shared by a friend",
+        "description": "Like /api/files/download, but the files are stored in the configured shared-target-dir.",
+        "tags": ["Files"],
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {"$ref": "#/components/schemas/TransferRequest"}}}
+        },
+        "responses": {
+          "200": {
+            "description": "Download queued",
+            "content": {"application/json": {"schema": {"type": "object", "properties": {"transfer_id": {"type": "integer", "format": "int64"}}}}}
+          },
+          "400": {"description": "Invalid request, unknown file or already queued"}
+        }
+      }
+    },
+    "/api/schedules": {
+      "get": {
+        "summary": "List the schedules with their next and last runs",
+        "description": "Includes the schedules of empty-trash-interval, mirror-interval and the retention policy, marked as builtin.",
+        "tags": ["Schedules"],
+        "responses": {
+          "200": {"description": "Schedules", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/ScheduleEntry"}}}}}
+        }
+      },
+      "put": {
+        "summary": "Replace the schedules",
+        "description": "Replaces all schedules except builtin ones until plundrio restarts.",
+        "tags": ["Schedules"],
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Schedule"}}}}
+        },
+        "responses": {
+          "200": {"description": "Schedules in effect", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/ScheduleEntry"}}}}},
+          "400": {"description": "Unknown action or invalid cron expression"}
+        }
+      }
+    },
+    "/api/schedules/run": {
+      "post": {
+        "summary": "Run an action now",
+        "description": "Starts the action in the background, outside of its schedules.",
+        "tags": ["Schedules"],
+        "parameters": [
+          {"name": "action", "in": "query", "required": true, "schema": {"type": "string", "enum": ["scan", "empty-trash", "cleanup", "report", "mirror"]}}
+        ],
+        "responses": {
+          "202": {"description": "Action started"},
+          "400": {"description": "Invalid action"},
+          "409": {"description": "Action already running or not available, e.g. report without a report schedule or report-period"}
+        }
+      }
+    },
+    "/api/retention": {
+      "get": {
+        "summary": "Report the retention status of local downloads",
+        "description": "Nothing is deleted, so this can be used to preview the retention policy.",
+        "tags": ["Retention"],
+        "responses": {
+          "200": {
+            "description": "All local downloads",
+            "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/RetentionEntry"}}}}
+          }
+        }
+      }
+    },
+    "/api/feed": {
+      "get": {
+        "summary": "Feed of completed downloads",
+        "description": "Lists recently completed downloads with their size, category and completion time as RSS or Atom feed for feed readers and automations.",
+        "tags": ["Transfers"],
+        "parameters": [
+          {"name": "format", "in": "query", "description": "Feed format", "schema": {"type": "string", "enum": ["rss", "atom"], "default": "rss"}},
+          {"name": "category", "in": "query", "description": "Only downloads of this category", "schema": {"type": "string"}},
+          {"name": "limit", "in": "query", "description": "Number of downloads", "schema": {"type": "integer", "minimum": 1, "default": 50}}
+        ],
+        "responses": {
+          "200": {
+            "description": "Feed, newest download first",
+            "content": {
+              "application/rss+xml": {"schema": {"type": "string"}},
+              "application/atom+xml": {"schema": {"type": "string"}}
+            }
+          },
+          "400": {"description": "Invalid format or limit parameter"}
+        }
+      }
+    },
+    "/api/history": {
+      "get": {
+        "summary": "Download history",
+        "description": "Lists completed, failed and cancelled downloads, newest first. Downloads are kept for history-days.",
+        "tags": ["Transfers"],
+        "parameters": [
+          {"name": "outcome", "in": "query", "description": "Only downloads with this outcome", "schema": {"type": "string", "enum": ["completed", "failed", "cancelled"]}},
+          {"name": "category", "in": "query", "description": "Only downloads of this category", "schema": {"type": "string"}},
+          {"name": "user", "in": "query", "description": "Only downloads added by this API user", "schema": {"type": "string"}},
+          {"name": "q", "in": "query", "description": "Only downloads with this text in their name, ignoring case", "schema": {"type": "string"}},
+          {"name": "since", "in": "query", "description": "Only downloads finished at or after this time", "schema": {"type": "string", "format": "date-time"}},
+          {"name": "limit", "in": "query", "description": "Number of downloads", "schema": {"type": "integer", "minimum": 1, "default": 50}},
+          {"name": "offset", "in": "query", "description": "Number of matching downloads to skip", "schema": {"type": "integer", "minimum": 0, "default": 0}}
+        ],
+        "responses": {
+          "200": {
+            "description": "Page of the download history",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/HistoryPage"}}}
+          },
+          "400": {"description": "Invalid outcome, since, limit or offset parameter"}
+        }
+      }
+    },
+    "/api/mirrors": {
+      "get": {
+        "summary": "List mirrored folders",
+        "description": "Lists the put.io folders configured in mirrors with what their last check found, including the files deleted locally, which are not downloaded again.",
+        "tags": ["Files"],
+        "responses": {
+          "200": {
+            "description": "Mirrored folders",
+            "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/MirrorStatus"}}}}
+          }
+        }
+      }
+    },
+    "/api/mirrors/restore": {
+      "post": {
+        "summary": "Download files deleted locally again",
+        "description": "Drops the tombstone of a file deleted locally from a mirrored folder, or those of all its files without a name, so that the next check of the folder downloads them again.",
+        "tags": ["Files"],
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {"$ref": "#/components/schemas/MirrorRestoreRequest"}}}
+        },
+        "responses": {
+          "200": {
+            "description": "Number of files restored",
+            "content": {"application/json": {"schema": {"type": "object", "properties": {"restored": {"type": "integer"}}}}}
+          },
+          "400": {"description": "Invalid request"},
+          "404": {"description": "Folder is not mirrored"}
+        }
+      }
+    },
+    "/api/failures": {
+      "get": {
+        "summary": "List failed files",
+        "description": "Lists the files that failed to download after all their attempts, oldest first. Files are kept across restarts until they are downloaded.",
+        "tags": ["Transfers"],
+        "responses": {
+          "200": {
+            "description": "Failed files",
+            "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Failure"}}}}
+          }
+        }
+      }
+    },
+    "/api/failures/retry": {
+      "post": {
+        "summary": "Retry failed files",
+        "description": "Downloads failed files again, all of them without file IDs. Files of transfers that are no longer tracked are queued like files downloaded by hand and kept on put.io. Files that are already downloading again are left alone.",
+        "tags": ["Transfers"],
+        "requestBody": {
+          "content": {"application/json": {"schema": {"$ref": "#/components/schemas/FailureRetryRequest"}}}
+        },
+        "responses": {
+          "200": {
+            "description": "Number of files queued again",
+            "content": {"application/json": {"schema": {"type": "object", "properties": {"retried": {"type": "integer"}}}}}
+          },
+          "400": {"description": "Invalid request"},
+          "409": {"description": "Files could not be queued again"}
+        }
+      }
+    },
+    "/api/config": {
+      "get": {
+        "summary": "Read configuration values",
+        "description": "Returns all values keyed by their name in the config file, or a single one with key. Secrets are not included.",
+        "tags": ["Config"],
+        "parameters": [
+          {"name": "key", "in": "query", "description": "Return only this value", "schema": {"type": "string"}}
+        ],
+        "responses": {
+          "200": {
+            "description": "Configuration values",
+            "content": {"application/json": {"schema": {"oneOf": [
+              {"type": "object", "additionalProperties": {"$ref": "#/components/schemas/ConfigValue"}},
+              {"$ref": "#/components/schemas/ConfigValue"}
+            ]}}}
+          },
+          "404": {"description": "Unknown config key"}
+        }
+      },
+      "post": {
+        "summary": "Change a configuration value",
+        "description": "Applies a mutable setting right away. Changes last until the daemon restarts.",
+        "tags": ["Config"],
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {"$ref": "#/components/schemas/ConfigChange"}}}
+        },
+        "responses": {
+          "200": {
+            "description": "Value now in effect",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/ConfigValue"}}}
+          },
+          "400": {"description": "Invalid value"},
+          "404": {"description": "Unknown config key"},
+          "409": {"description": "Setting requires a restart"}
+        }
+      }
+    },
+    "/api/debug/putio": {
+      "get": {
+        "summary": "Download captured put.io API exchanges",
+        "description": "Returns the last 200 put.io API requests and responses captured while putio-debug is enabled, oldest first, as a file to attach to bug reports. Tokens, cookies and passwords are redacted and bodies are cut at 16 KiB.",
+        "tags": ["Logs"],
+        "responses": {
+          "200": {
+            "description": "Captured exchanges",
+            "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/PutioExchange"}}}}
+          }
+        }
+      },
+      "delete": {
+        "summary": "Forget captured put.io API exchanges",
+        "tags": ["Logs"],
+        "responses": {
+          "204": {"description": "Captured exchanges forgotten"}
+        }
+      }
+    },
+    "/api/health": {
+      "get": {
+        "summary": "Check the health of the daemon",
+        "description": "Reports whether put.io accepts the token. The token is checked on startup, periodically and on every put.io request.",
+        "tags": ["Auth"],
+        "responses": {
+          "200": {
+            "description": "Healthy",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Health"}}}
+          },
+          "503": {
+            "description": "put.io rejected the token, reauthenticate and replace it",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Health"}}}
+          }
+        }
+      }
+    },
+    "/api/token": {
+      "post": {
+        "summary": "Replace the put.io token",
+        "description": "Switches to a new token without a restart once put.io accepted it. The token lasts until the daemon restarts unless it is changed in the config file too.",
+        "tags": ["Auth"],
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {"$ref": "#/components/schemas/TokenRequest"}}}
+        },
+        "responses": {
+          "200": {
+            "description": "Token replaced",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/AuthState"}}}
+          },
+          "400": {"description": "Invalid request or token rejected by put.io"},
+          "502": {"description": "put.io could not be reached to check the token"}
+        }
+      }
+    },
+    "/api/logs": {
+      "get": {
+        "summary": "Read or stream daemon logs",
+        "description": "Returns log lines as newline delimited JSON objects. With follow, new lines are streamed until the client disconnects.",
+        "tags": ["Logs"],
+        "parameters": [
+          {"name": "level", "in": "query", "description": "Minimum level", "schema": {"type": "string", "enum": ["debug", "info", "warn", "error", "fatal"], "default": "info"}},
+          {"name": "component", "in": "query", "description": "Only lines of this component", "schema": {"type": "string"}},
+          {"name": "tail", "in": "query", "description": "Number of recent lines", "schema": {"type": "integer", "minimum": 0, "default": 100}},
+          {"name": "follow", "in": "query", "description": "Keep streaming new lines", "schema": {"type": "boolean", "default": false}}
+        ],
+        "responses": {
+          "200": {"description": "Log lines", "content": {"application/x-ndjson": {"schema": {"type": "string"}}}},
+          "400": {"description": "Invalid level or tail parameter"}
+        }
+      }
+    },
+    "/metrics": {
+      "get": {
+        "summary": "Prometheus metrics",
+        "description": "Latency and errors of Transmission RPC requests per method (plundrio_rpc_request_duration_seconds, plundrio_rpc_errors_total) and of API requests to the providers (plundrio_provider_request_duration_seconds, plundrio_provider_request_errors_total) in the Prometheus text format.",
+        "tags": ["Logs"],
+        "responses": {
+          "200": {"description": "Metrics", "content": {"text/plain": {"schema": {"type": "string"}}}}
+        }
+      }
+    },
+    "/api/transfers/{id}/log": {
+      "get": {
+        "summary": "Read the log of a transfer",
+        "description": "Returns the log lines and aria2c output captured for a transfer as newline delimited JSON objects, oldest first.",
+        "tags": ["Logs"],
+        "parameters": [
+          {"name": "id", "in": "path", "required": true, "description": "Transfer ID", "schema": {"type": "integer", "format": "int64"}},
+          {"name": "tail", "in": "query", "description": "Only the most recent lines", "schema": {"type": "integer", "minimum": 0}}
+        ],
+        "responses": {
+          "200": {"description": "Log lines", "content": {"application/x-ndjson": {"schema": {"type": "string"}}}},
+          "400": {"description": "Invalid transfer ID or tail parameter"},
+          "404": {"description": "Nothing was captured for the transfer"}
+        }
+      }
+    },
+    "/graphql": {
+      "get": {
+        "summary": "Run a GraphQL query",
+        "tags": ["GraphQL"],
+        "parameters": [
+          {"name": "query", "in": "query", "required": true, "schema": {"type": "string"}},
+          {"name": "operationName", "in": "query", "schema": {"type": "string"}},
+          {"name": "variables", "in": "query", "description": "JSON encoded variables", "schema": {"type": "string"}}
+        ],
+        "responses": {
+          "200": {
+            "description": "Query result, or a stream of server-sent events for subscriptions",
+            "content": {
+              "application/json": {"schema": {"$ref": "#/components/schemas/GraphQLResponse"}},
+              "text/event-stream": {"schema": {"type": "string"}}
+            }
+          }
+        }
+      },
+      "post": {
+        "summary": "Run a GraphQL query",
+        "tags": ["GraphQL"],
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {"$ref": "#/components/schemas/GraphQLRequest"}}}
+        },
+        "responses": {
+          "200": {
+            "description": "Query result, or a stream of server-sent events for subscriptions",
+            "content": {
+              "application/json": {"schema": {"$ref": "#/components/schemas/GraphQLResponse"}},
+              "text/event-stream": {"schema": {"type": "string"}}
+            }
+          }
+        }
+      }
+    },
+    "/graphql/schema": {
+      "get": {
+        "summary": "Get the GraphQL schema",
+        "tags": ["GraphQL"],
+        "responses": {
+          "200": {"description": "Schema in GraphQL SDL", "content": {"text/plain": {"schema": {"type": "string"}}}}
+        }
+      }
+    },
+    "/transmission/rpc": {
+      "post": {
+        "summary": "Transmission RPC",
+        "description": "Subset of the Transmission RPC protocol used by *arr applications and remote GUIs: session-get, session-set, session-stats, session-close, port-test, blocklist-update, torrent-add, torrent-get, torrent-remove, torrent-set, torrent-set-location, torrent-stop, torrent-start, queue-move-top, queue-move-up, queue-move-down and queue-move-bottom. torrent-add and torrent-set take the priority from bandwidthPriority or a priority-high or priority-low label; torrent-set takes a speed limit for the transfer in KB/s from downloadLimit, and downloadLimited false falls back to the limit of its category; queue-move-up and queue-move-down move a transfer with queued files one place in the download queue; queue-move-top also raises it to high priority and moves it first, queue-move-bottom lowers it to low and moves it last. port-test reports the peer port as closed and blocklist-update an empty blocklist, since put.io connects to peers. session-close does not stop the daemon. torrent-add answers before the provider has taken the transfer, which is listed as queued until the provider lists it. torrent-get accepts hashes, numeric IDs and recently-active and returns only the requested fields. Other methods succeed without doing anything. Requests without a valid X-Transmission-Session-Id header are answered with 409 and the header to use.",
+        "tags": ["Transmission"],
+        "parameters": [
+          {"name": "X-Transmission-Session-Id", "in": "header", "schema": {"type": "string"}}
+        ],
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {"$ref": "#/components/schemas/RPCRequest"}}}
+        },
+        "responses": {
+          "200": {
+            "description": "RPC result",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/RPCResponse"}}}
+          },
+          "409": {"description": "Session ID missing, retry with the returned X-Transmission-Session-Id header"}
+        }
+      }
+    }
+  },
+  "components": {
+    "securitySchemes": {
+      "bearer": {"type": "http", "scheme": "bearer", "description": "Token of one of the api-users; transfers added with it are attributed to the user. Once api-users are configured, requests without a token are answered 401, except for /api/health, /metrics and the status page."},
+      "apiKey": {"type": "apiKey", "in": "header", "name": "X-Api-Key"}
+    },
+    "schemas": {
+      "Stats": {
+        "type": "object",
+        "properties": {
+          "workers": {"type": "integer"},
+          "active_downloads": {"type": "integer"},
+          "active_files": {"type": "integer"},
+          "queued_jobs": {"type": "integer"},
+          "transfers": {"type": "integer"},
+          "downloading": {"type": "integer"},
+          "failed": {"type": "integer"},
+          "quarantined": {"type": "integer"},
+          "processed": {"type": "integer"},
+          "downloaded_bytes": {"type": "integer", "format": "int64"},
+          "speed_limit_kbps": {"type": "integer"},
+          "unthrottled_until": {"type": "string", "format": "date-time"},
+          "maintenance": {"type": "boolean"},
+          "waiting_for_space": {"type": "integer", "description": "Downloads held back until they fit on the disk"},
+          "load_limit": {"type": "integer", "description": "Downloads that may run at once while the system is busy, missing if not limited"},
+          "load_reason": {"type": "string", "description": "Why the system counts as busy, e.g. load 3.10 above 2.00"},
+          "speed_bps": {"type": "number", "description": "Current download speed of all transfers in bytes per second"},
+          "queued_bytes": {"type": "integer", "format": "int64", "description": "Bytes left to download, including transfers put.io still fetches"},
+          "queued_transfers": {"type": "integer"},
+          "eta_seconds": {"type": "integer", "format": "int64", "description": "Time until the whole queue is downloaded, -1 while unknown"},
+          "eta": {"type": "string"}
+        }
+      },
+      "Status": {
+        "type": "object",
+        "properties": {
+          "status": {"type": "string", "enum": ["ok", "reauthenticate"]},
+          "maintenance": {"type": "boolean"},
+          "active_downloads": {"type": "integer"},
+          "queued_transfers": {"type": "integer"},
+          "queued_bytes": {"type": "integer", "format": "int64"},
+          "speed_bps": {"type": "number"},
+          "eta_seconds": {"type": "integer", "format": "int64", "description": "-1 while unknown"},
+          "transfers": {
+            "type": "array",
+            "items": {
+              "type": "object",
+              "properties": {
+                "name": {"type": "string", "description": "Transfer N with status-redact-names"},
+                "stage": {"type": "string", "enum": ["cloud", "local"]},
+                "progress_percent": {"type": "number"},
+                "speed_bps": {"type": "number"}
+              }
+            }
+          }
+        }
+      },
+      "Widget": {
+        "type": "object",
+        "properties": {
+          "status": {"type": "string", "enum": ["ok", "reauthenticate"]},
+          "active": {"type": "integer", "description": "Transfers downloading locally"},
+          "queued": {"type": "integer", "description": "Transfers with bytes left"},
+          "speed_bps": {"type": "number"},
+          "queued_bytes": {"type": "integer", "format": "int64"},
+          "eta_seconds": {"type": "integer", "format": "int64", "description": "-1 while unknown"},
+          "last_completed": {"type": "string", "description": "Empty if nothing completed yet"},
+          "last_completed_at": {"type": "string", "format": "date-time", "nullable": true}
+        }
+      },
+      "WidgetDiscovery": {
+        "type": "object",
+        "properties": {
+          "formats": {"type": "object", "additionalProperties": {"type": "string"}},
+          "dashboards": {
+            "type": "array",
+            "items": {
+              "type": "object",
+              "properties": {
+                "name": {"type": "string"},
+                "url": {"type": "string"},
+                "example": {"type": "string", "description": "Configuration to paste into the dashboard"}
+              }
+            }
+          }
+        }
+      },
+      "Throughput": {
+        "type": "object",
+        "properties": {
+          "resolution": {"type": "string", "enum": ["second", "minute", "hour"]},
+          "points": {"type": "array", "items": {"type": "object", "properties": {
+            "time": {"type": "string", "format": "date-time", "description": "Start of the step"},
+            "speed": {"type": "number", "description": "Average bytes per second"},
+            "bytes": {"type": "integer", "description": "Bytes downloaded during the step"}
+          }}}
+        }
+      },
+      "DownloadsDelta": {
+        "type": "object",
+        "properties": {
+          "cursor": {"type": "string", "description": "Pass as since in the next request"},
+          "full": {"type": "boolean", "description": "changed holds all downloads, forget the ones known before"},
+          "ids": {"type": "array", "items": {"type": "integer", "format": "int64"}, "description": "All downloads in the order shown; others were removed"},
+          "changed": {"type": "array", "items": {"$ref": "#/components/schemas/Download"}}
+        }
+      },
+      "Download": {
+        "type": "object",
+        "properties": {
+          "id": {"type": "integer", "format": "int64"},
+          "name": {"type": "string"},
+          "download_dir": {"type": "string"},
+          "stage": {"type": "string", "enum": ["cloud", "local"], "description": "Whether put.io is still working on the transfer or plundrio is downloading it"},
+          "remote_status": {"type": "string", "description": "Transfer status on put.io, e.g. IN_QUEUE, DOWNLOADING, SEEDING or ERROR"},
+          "remote_message": {"type": "string", "description": "Status or error message from put.io"},
+          "error_code": {"type": "string", "description": "Stable classification of the failure, if any", "enum": ["remote-gone", "remote-failed", "disk-full", "checksum-mismatch", "verify-failed", "rate-limited", "aria2-missing", "auth-failed", "url-expired", "network", "filesystem", "path-collision", "cancelled", "unknown"]},
+          "provider": {"type": "string", "description": "Provider the transfer was added to, only with fallback providers"},
+          "progress_percent": {"type": "number", "description": "Local download progress"},
+          "cloud_progress_percent": {"type": "number", "description": "put.io's progress of the torrent"},
+          "downloaded_mb": {"type": "number"},
+          "total_mb": {"type": "number"},
+          "speed_mbps": {"type": "number"},
+          "eta": {"type": "string"},
+          "queue_position": {"type": "integer", "description": "Place among transfers with queued files, starting at 1, if any of its files are queued"},
+          "scheduled_until": {"type": "string", "format": "date-time", "description": "Start of the next download window, if the download waits for one"},
+          "waiting_for_space": {"type": "boolean", "description": "Files of the download wait until they fit on the disk"},
+          "notes": {"type": "string"},
+          "metadata": {"type": "object", "additionalProperties": {"type": "string"}},
+          "requested_by": {"type": "string", "description": "API user the transfer was added by"}
+        }
+      },
+      "TransferRequest": {
+        "type": "object",
+        "required": ["id"],
+        "properties": {
+          "id": {"type": "integer", "format": "int64"}
+        }
+      },
+      "ConfigValue": {
+        "type": "object",
+        "properties": {
+          "value": {"description": "Current value"},
+          "mutable": {"type": "boolean", "description": "Can be changed without a restart"}
+        }
+      },
+      "ConfigChange": {
+        "type": "object",
+        "required": ["key", "value"],
+        "properties": {
+          "key": {"type": "string", "enum": ["log-level", "speed-limit", "alt-speed-limit", "max-download-rate", "download-queue-size", "bandwidth-strategy", "skip-trash", "retention-dry-run"]},
+          "value": {"type": "string"}
+        }
+      },
+      "RedownloadRequest": {
+        "type": "object",
+        "properties": {
+          "path": {"type": "string", "description": "Local path of the file"},
+          "transfer_id": {"type": "integer", "format": "int64"},
+          "file_id": {"type": "integer", "format": "int64", "description": "put.io file ID"}
+        }
+      },
+      "MoveRequest": {
+        "type": "object",
+        "required": ["id", "direction"],
+        "properties": {
+          "id": {"type": "integer", "format": "int64"},
+          "direction": {"type": "string", "enum": ["up", "down", "top", "bottom"]}
+        }
+      },
+      "CancelRequest": {
+        "type": "object",
+        "required": ["id"],
+        "properties": {
+          "id": {"type": "integer", "format": "int64"},
+          "delete_local_data": {"type": "boolean", "description": "Also delete files that were already downloaded"}
+        }
+      },
+      "AddRequest": {
+        "type": "object",
+        "required": ["url"],
+        "properties": {
+          "url": {"type": "string", "description": "Magnet link or http, https or ftp URL"},
+          "category": {"type": "string", "description": "Category used to route the transfer to a provider"},
+          "notes": {"type": "string", "description": "Free-form notes attached to the transfer"},
+          "metadata": {"type": "object", "additionalProperties": {"type": "string"}, "description": "Key/value metadata attached to the transfer, e.g. a ticket ID"}
+        }
+      },
+      "ProviderRoute": {
+        "type": "object",
+        "properties": {
+          "category": {"type": "string"},
+          "match": {"type": "string", "description": "Regular expression matching the transfer name"},
+          "provider": {"type": "string", "enum": ["putio", "realdebrid", "premiumize"]}
+        }
+      },
+      "Providers": {
+        "type": "object",
+        "properties": {
+          "providers": {
+            "type": "array",
+            "items": {
+              "type": "object",
+              "properties": {
+                "name": {"type": "string"},
+                "role": {"type": "string", "enum": ["primary", "fallback", "routed"]}
+              }
+            }
+          },
+          "routes": {"type": "array", "items": {"$ref": "#/components/schemas/ProviderRoute"}}
+        }
+      },
+      "File": {
+        "type": "object",
+        "properties": {
+          "id": {"type": "integer", "format": "int64"},
+          "name": {"type": "string"},
+          "size": {"type": "integer", "format": "int64"},
+          "folder": {"type": "boolean"},
+          "parent_id": {"type": "integer", "format": "int64"},
+          "created_at": {"type": "string", "format": "date-time"}
+        }
+      },
+      "SharedFile": {
+        "allOf": [
+          {"$ref": "#/components/schemas/File"},
+          {"type": "object", "properties": {"friend": {"type": "string", "description": "Name of the friend who shared it"}}}
+        ]
+      },
+      "Language": {
+        "type": "object",
+        "properties": {
+          "code": {"type": "string"},
+          "name": {"type": "string"},
+          "translated": {"type": "integer", "description": "Messages translated, the rest falls back to English"},
+          "total": {"type": "integer"},
+          "contributed": {"type": "boolean", "description": "Messages were contributed through the API"}
+        }
+      },
+      "Translation": {
+        "type": "object",
+        "properties": {
+          "lang": {"type": "string"},
+          "messages": {"type": "object", "additionalProperties": {"type": "string"}},
+          "missing": {"type": "array", "items": {"type": "string"}, "description": "Keys of messages not translated yet"}
+        }
+      },
+      "PushInfo": {
+        "type": "object",
+        "properties": {
+          "enabled": {"type": "boolean"},
+          "public_key": {"type": "string", "description": "VAPID application server key, base64url"},
+          "subscriptions": {"type": "integer", "description": "Subscribed browsers"}
+        }
+      },
+      "PushSubscription": {
+        "type": "object",
+        "description": "The JSON of a browser's PushSubscription",
+        "required": ["endpoint", "keys"],
+        "properties": {
+          "endpoint": {"type": "string"},
+          "keys": {"type": "object", "properties": {"p256dh": {"type": "string"}, "auth": {"type": "string"}}}
+        }
+      },
+      "User": {
+        "type": "object",
+        "properties": {
+          "name": {"type": "string"},
+          "active_transfers": {"type": "integer", "description": "Transfers added by the user that are not downloaded yet"},
+          "max_transfers": {"type": "integer", "description": "0 means unlimited"},
+          "monthly_bytes": {"type": "integer", "format": "int64", "description": "Bytes downloaded this calendar month"},
+          "monthly_gb": {"type": "integer", "description": "0 means unlimited"}
+        }
+      },
+      "Annotation": {
+        "type": "object",
+        "properties": {
+          "notes": {"type": "string"},
+          "metadata": {"type": "object", "additionalProperties": {"type": "string"}},
+          "requested_by": {"type": "string", "description": "API user the transfer was added by"},
+          "updated_at": {"type": "string", "format": "date-time"}
+        }
+      },
+      "NotesRequest": {
+        "type": "object",
+        "required": ["id"],
+        "properties": {
+          "id": {"type": "integer", "format": "int64"},
+          "notes": {"type": "string", "description": "Free-form notes"},
+          "metadata": {"type": "object", "additionalProperties": {"type": "string"}, "description": "Key/value metadata, e.g. source URL, requested-by user or ticket ID"}
+        }
+      },
+      "LocationRequest": {
+        "type": "object",
+        "required": ["id", "location"],
+        "properties": {
+          "id": {"type": "integer", "format": "int64"},
+          "location": {"type": "string", "description": "New download directory"},
+          "move": {"type": "boolean", "description": "Move files that were already downloaded"}
+        }
+      },
+      "PutioExchange": {
+        "type": "object",
+        "properties": {
+          "time": {"type": "string", "format": "date-time"},
+          "duration": {"type": "integer", "format": "int64", "description": "Nanoseconds"},
+          "method": {"type": "string"},
+          "url": {"type": "string"},
+          "request_headers": {"type": "object", "additionalProperties": {"type": "array", "items": {"type": "string"}}},
+          "request_body": {"type": "string"},
+          "status": {"type": "integer"},
+          "response_headers": {"type": "object", "additionalProperties": {"type": "array", "items": {"type": "string"}}},
+          "response_body": {"type": "string"},
+          "error": {"type": "string", "description": "The request failed without a response"}
+        }
+      },
+      "Health": {
+        "type": "object",
+        "properties": {
+          "status": {"type": "string", "enum": ["ok", "reauthenticate"]},
+          "maintenance": {"type": "boolean", "description": "A maintenance window is active"},
+          "auth": {"$ref": "#/components/schemas/AuthState"},
+          "retry_budget": {"$ref": "#/components/schemas/RetryBudget"}
+        }
+      },
+      "RetryBudget": {
+        "type": "object",
+        "properties": {
+          "limit": {"type": "integer", "description": "Download retries per hour across all transfers, 0 is unlimited"},
+          "used": {"type": "integer", "description": "Retries in the last hour"},
+          "backing_off_until": {"type": "string", "format": "date-time", "description": "Retries wait until then, missing unless backing off"}
+        }
+      },
+      "AuthState": {
+        "type": "object",
+        "properties": {
+          "valid": {"type": "boolean"},
+          "reauthenticate": {"type": "boolean", "description": "put.io rejected all tokens, a new one is needed"},
+          "username": {"type": "string"},
+          "checked_at": {"type": "string", "format": "date-time"},
+          "error": {"type": "string"},
+          "tokens": {"type": "array", "items": {"$ref": "#/components/schemas/TokenUsage"}}
+        }
+      },
+      "TokenUsage": {
+        "type": "object",
+        "properties": {
+          "token": {"type": "string", "description": "Last four characters of the token"},
+          "requests": {"type": "integer", "format": "int64"},
+          "rate_limited": {"type": "integer", "format": "int64", "description": "Requests answered with 429 Too Many Requests"},
+          "limited_until": {"type": "string", "format": "date-time", "description": "The token is rested until then"},
+          "rejected": {"type": "boolean"}
+        }
+      },
+      "TokenRequest": {
+        "type": "object",
+        "required": ["token"],
+        "properties": {
+          "token": {"type": "string", "description": "put.io OAuth token"}
+        }
+      },
+      "Unthrottle": {
+        "type": "object",
+        "properties": {
+          "active": {"type": "boolean"},
+          "until": {"type": "string", "format": "date-time"}
+        }
+      },
+      "Schedule": {
+        "type": "object",
+        "required": ["action", "cron"],
+        "properties": {
+          "action": {"type": "string", "enum": ["scan", "empty-trash", "cleanup", "report", "mirror"]},
+          "cron": {"type": "string", "description": "Cron expression (minute hour day month weekday), a shorthand such as @daily, or @every followed by a duration of at least 1m", "example": "*/30 * * * *"}
+        }
+      },
+      "ScheduleEntry": {
+        "type": "object",
+        "properties": {
+          "action": {"type": "string"},
+          "cron": {"type": "string"},
+          "builtin": {"type": "boolean", "description": "Derived from empty-trash-interval, mirror-interval or the retention policy, not changeable through the API"},
+          "next_run": {"type": "string", "format": "date-time"},
+          "last_run": {"type": "string", "format": "date-time"},
+          "last_error": {"type": "string"},
+          "running": {"type": "boolean"}
+        }
+      },
+      "RetentionEntry": {
+        "type": "object",
+        "properties": {
+          "path": {"type": "string"},
+          "category": {"type": "string"},
+          "size": {"type": "integer", "format": "int64"},
+          "age_days": {"type": "number"},
+          "keep_days": {"type": "integer"},
+          "expired": {"type": "boolean"},
+          "in_use": {"type": "boolean"},
+          "imported": {"type": "boolean"}
+        }
+      },
+      "HistoryPage": {
+        "type": "object",
+        "properties": {
+          "total": {"type": "integer", "description": "Downloads matching the filters"},
+          "offset": {"type": "integer"},
+          "limit": {"type": "integer"},
+          "entries": {"type": "array", "items": {"$ref": "#/components/schemas/HistoryEntry"}}
+        }
+      },
+      "HistoryEntry": {
+        "type": "object",
+        "properties": {
+          "time": {"type": "string", "format": "date-time", "description": "When the download finished"},
+          "transfer_id": {"type": "integer", "format": "int64"},
+          "name": {"type": "string"},
+          "category": {"type": "string"},
+          "outcome": {"type": "string", "enum": ["completed", "failed", "cancelled"]},
+          "size": {"type": "integer", "format": "int64"},
+          "duration_seconds": {"type": "integer", "format": "int64"},
+          "speed_bps": {"type": "number", "description": "Average speed in bytes per second"},
+          "error": {"type": "string"},
+          "error_code": {"type": "string"},
+          "requested_by": {"type": "string", "description": "API user the transfer was added by"}
+        }
+      },
+      "MirrorStatus": {
+        "type": "object",
+        "properties": {
+          "folder": {"type": "integer", "format": "int64", "description": "ID of the folder on put.io"},
+          "target": {"type": "string", "description": "Directory the folder is mirrored to, empty for the target directory"},
+          "delete": {"type": "boolean", "description": "Whether files deleted on put.io are deleted locally"},
+          "files": {"type": "integer", "description": "Files on put.io"},
+          "downloaded": {"type": "integer", "description": "Files downloaded completely"},
+          "tombstones": {"type": "array", "items": {"type": "string"}, "description": "Files deleted locally, which are not downloaded again"}
+        }
+      },
+      "MirrorRestoreRequest": {
+        "type": "object",
+        "required": ["folder"],
+        "properties": {
+          "folder": {"type": "integer", "format": "int64", "description": "ID of the mirrored folder"},
+          "name": {"type": "string", "description": "File to restore, all files deleted locally if empty"}
+        }
+      },
+      "Failure": {
+        "type": "object",
+        "properties": {
+          "time": {"type": "string", "format": "date-time", "description": "When the file failed last"},
+          "transfer_id": {"type": "integer", "format": "int64"},
+          "transfer_name": {"type": "string"},
+          "file_id": {"type": "integer", "format": "int64"},
+          "name": {"type": "string", "description": "Path relative to the target directory"},
+          "size": {"type": "integer", "format": "int64"},
+          "crc32": {"type": "string"},
+          "target_dir": {"type": "string"},
+          "error": {"type": "string"},
+          "error_code": {"type": "string"},
+          "attempts": {"type": "integer", "description": "Times the file failed"},
+          "retrying": {"type": "boolean", "description": "Queued again since it failed last"}
+        }
+      },
+      "FailureRetryRequest": {
+        "type": "object",
+        "properties": {
+          "file_ids": {"type": "array", "items": {"type": "integer", "format": "int64"}, "description": "Files to retry, all failed files if empty"}
+        }
+      },
+      "GraphQLRequest": {
+        "type": "object",
+        "required": ["query"],
+        "properties": {
+          "query": {"type": "string"},
+          "operationName": {"type": "string"},
+          "variables": {"type": "object", "additionalProperties": true}
+        }
+      },
+      "GraphQLResponse": {
+        "type": "object",
+        "properties": {
+          "data": {"type": "object", "additionalProperties": true},
+          "errors": {
+            "type": "array",
+            "items": {
+              "type": "object",
+              "properties": {
+                "message": {"type": "string"},
+                "path": {"type": "array", "items": {}}
+              }
+            }
+          }
+        }
+      },
+      "RPCRequest": {
+        "type": "object",
+        "required": ["method"],
+        "properties": {
+          "method": {"type": "string"},
+          "arguments": {"type": "object", "additionalProperties": true},
+          "tag": {"type": "integer"}
+        }
+      },
+      "RPCResponse": {
+        "type": "object",
+        "properties": {
+          "result": {"type": "string", "enum": ["success", "error"]},
+          "message": {"type": "string", "description": "Error message"},
+          "arguments": {"type": "object", "additionalProperties": true},
+          "tag": {"type": "integer"}
+        }
+      }
+    }
+  }
+}
+`
+
+// swaggerUIVersion is the Swagger UI release loaded by the docs page
+const swaggerUIVersion = "5.17.14"
+
+// handleOpenAPI serves the OpenAPI document of the management API
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(openAPIDocument))
+}
+
+// handleAPIDocs serves Swagger UI for exploring the management API
+func (s *Server) handleAPIDocs(w http.ResponseWriter, r *http.Request) {
+	html := `<!DOCTYPE html>
+<html>
+<head>
+    <title>Plundrio API</title>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@` + swaggerUIVersion + `/swagger-ui.css">
+</head>
+<body>
+    <div id="swagger-ui"></div>
+    <script src="https://unpkg.com/swagger-ui-dist@` + swaggerUIVersion + `/swagger-ui-bundle.js"></script>
+    <script>
+        window.ui = SwaggerUIBundle({
+            url: '/api/openapi.json',
+            dom_id: '#swagger-ui',
+            deepLinking: true
+        });
+    </script>
+</body>
+</html>`
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(html))
+}
@@ -0,0 +1,222 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elsbrock/go-putio"
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+const (
+	// pendingTimeout is how long an added transfer is shown before it is
+	// expected to be listed by the provider
+	pendingTimeout = 15 * time.Minute
+
+	// failedAddTTL is how long a transfer the provider did not take is shown
+	// with its error, so *arr applications notice and try another release
+	failedAddTTL = time.Hour
+
+	// firstPendingID is the first ID of added transfers not listed yet, far
+	// above the IDs providers use
+	firstPendingID = 1 << 40
+)
+
+// pendingAdd is a transfer added through torrent-add that the provider does
+// not list yet. torrent-add answers before the provider has taken it, so a
+// slow provider does not run into the client's timeout.
+type pendingAdd struct {
+	ID          int64
+	Hash        string // info hash, empty for URLs
+	Name        string
+	DownloadDir string
+	AddedAt     time.Time
+	SubmittedAt time.Time // when the provider took it, zero until then
+	Err         string    // why the provider did not take it
+
+	removed         bool // removed through torrent-remove, removed from the provider once listed
+	deleteLocalData bool
+}
+
+// pendingAdds are the transfers added through torrent-add that are not
+// listed by the provider yet
+type pendingAdds struct {
+	mu     sync.Mutex
+	nextID int64
+	adds   []*pendingAdd
+}
+
+// find returns the pending transfer with the given hash the provider has not
+// turned down
+func (p *pendingAdds) find(hash string) *pendingAdd {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, add := range p.adds {
+		if add.Hash != "" && strings.EqualFold(add.Hash, hash) && add.Err == "" && !add.removed {
+			return add
+		}
+	}
+	return nil
+}
+
+// remove removes the pending transfer with the given hash or ID and reports
+// whether there was one. Transfers the provider may still take are hidden
+// and removed from the provider once it lists them.
+func (p *pendingAdds) remove(id string, deleteLocalData bool) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, add := range p.adds {
+		if (add.Hash != "" && strings.EqualFold(add.Hash, id)) || strconv.FormatInt(add.ID, 10) == id {
+			if add.Err != "" {
+				p.adds = append(p.adds[:i], p.adds[i+1:]...)
+			} else {
+				add.removed = true
+				add.deleteLocalData = deleteLocalData
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// addedTorrent returns the torrent-add answer for a transfer that is listed
+// or pending with the given hash, or nil if there is none. Only transfers
+// known already are checked, the provider is not asked.
+func (s *Server) addedTorrent(hash string) map[string]interface{} {
+	if hash == "" {
+		return nil
+	}
+	if processor := s.dlManager.GetTransferProcessor(); processor != nil {
+		for _, t := range processor.GetTransfers() {
+			if strings.EqualFold(t.Hash, hash) {
+				return map[string]interface{}{"id": t.ID, "hashString": t.Hash, "name": t.Name}
+			}
+		}
+	}
+	if add := s.pending.find(hash); add != nil {
+		return map[string]interface{}{"id": add.ID, "hashString": add.Hash, "name": add.Name}
+	}
+	return nil
+}
+
+// submitAdd records a transfer as pending and hands it to the provider in
+// the background with add
+func (s *Server) submitAdd(hash, name, downloadDir string, add func() error) *pendingAdd {
+	// Adding a transfer again replaces an attempt that failed
+	if hash != "" {
+		s.pending.remove(hash, false)
+	}
+
+	s.pending.mu.Lock()
+	if s.pending.nextID == 0 {
+		s.pending.nextID = firstPendingID
+	}
+	pending := &pendingAdd{
+		ID:          s.pending.nextID,
+		Hash:        strings.ToLower(hash),
+		Name:        name,
+		DownloadDir: downloadDir,
+		AddedAt:     time.Now(),
+	}
+	s.pending.nextID++
+	s.pending.adds = append(s.pending.adds, pending)
+	s.pending.mu.Unlock()
+
+	go func() {
+		err := add()
+
+		s.pending.mu.Lock()
+		defer s.pending.mu.Unlock()
+		if err != nil {
+			pending.Err = err.Error()
+			log.Error("rpc").
+				Str("operation", "torrent-add").
+				Str("name", name).
+				Str("hash", hash).
+				Err(err).
+				Msg("Provider did not take transfer")
+			return
+		}
+		pending.SubmittedAt = time.Now()
+		log.Info("rpc").
+			Str("operation", "torrent-add").
+			Str("name", name).
+			Str("hash", hash).
+			Dur("duration", pending.SubmittedAt.Sub(pending.AddedAt)).
+			Msg("Transfer submitted to provider")
+	}()
+
+	return pending
+}
+
+// pendingTorrents returns the pending transfers matching ids in torrent-get
+// format. Transfers that are listed by now, transfers without a hash once
+// the provider took them and those that timed out are forgotten; listed
+// ones removed in the meantime are removed from the provider.
+func (s *Server) pendingTorrents(transfers []*putio.Transfer, ids torrentIDs, fields []string) []map[string]interface{} {
+	listed := make(map[string]*putio.Transfer, len(transfers))
+	for _, t := range transfers {
+		listed[strings.ToLower(t.Hash)] = t
+	}
+
+	s.pending.mu.Lock()
+	defer s.pending.mu.Unlock()
+
+	now := time.Now()
+	kept := s.pending.adds[:0]
+	var torrents []map[string]interface{}
+	for _, add := range s.pending.adds {
+		switch {
+		case add.Hash != "" && listed[add.Hash] != nil:
+			if add.removed {
+				go s.removeTransfer(listed[add.Hash], add.deleteLocalData, "torrent-remove")
+			}
+			continue
+		case add.Err != "" && now.Sub(add.AddedAt) > failedAddTTL:
+			continue
+		case !add.SubmittedAt.IsZero() && (add.Hash == "" || now.Sub(add.SubmittedAt) > pendingTimeout):
+			if add.Hash != "" {
+				log.Warn("rpc").
+					Str("name", add.Name).
+					Str("hash", add.Hash).
+					Msg("Added transfer was not listed by the provider in time")
+			}
+			continue
+		}
+		kept = append(kept, add)
+
+		if add.removed || !ids.matches(&putio.Transfer{ID: add.ID, Hash: add.Hash}) {
+			continue
+		}
+		status := 3 // TR_STATUS_DOWNLOAD_WAIT
+		if add.Err != "" {
+			status = 0 // TR_STATUS_STOPPED
+		}
+		torrents = append(torrents, filterFields(map[string]interface{}{
+			"id":             add.ID,
+			"hashString":     add.Hash,
+			"name":           add.Name,
+			"eta":            -1,
+			"status":         status,
+			"downloadDir":    add.DownloadDir,
+			"totalSize":      0,
+			"leftUntilDone":  0,
+			"uploadedEver":   0,
+			"downloadedEver": 0,
+			"percentDone":    0.0,
+			"rateDownload":   0,
+			"rateUpload":     0,
+			"uploadRatio":    0.0,
+			"error":          add.Err != "",
+			"errorString":    add.Err,
+			"isFinished":     false,
+			"addedDate":      add.AddedAt.Unix(),
+			"doneDate":       0,
+			"queuePosition":  0,
+		}, fields))
+	}
+	s.pending.adds = kept
+	return torrents
+}
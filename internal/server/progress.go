@@ -0,0 +1,40 @@
+package server
+
+import (
+	"github.com/elsbrock/go-putio"
+	"github.com/elsbrock/plundrio/internal/download"
+)
+
+// transferProgress is the progress of both halves of a transfer: put.io
+// downloading the torrent (cloud) and plundrio fetching the files (local)
+type transferProgress struct {
+	Cloud float64 // 0-1
+	Local float64 // 0-1
+}
+
+// cloudProgress returns put.io's progress of a transfer
+func cloudProgress(t *putio.Transfer) float64 {
+	if t == nil {
+		return 0
+	}
+	return float64(t.PercentDone) / 100
+}
+
+// localProgress returns the local download progress of a transfer context by
+// bytes, or by files if sizes are unknown. The caller must hold ctx.Mu.
+func localProgress(ctx *download.TransferContext) float64 {
+	if ctx.TotalSize > 0 {
+		return float64(ctx.DownloadedSize) / float64(ctx.TotalSize)
+	}
+	if files := ctx.TotalFiles - ctx.SkippedFiles; files > 0 {
+		return float64(ctx.CompletedFiles) / float64(files)
+	}
+	return 0
+}
+
+// combined weighs both halves into the single value reported as percentDone,
+// using the configured share of the cloud half
+func (s *Server) combined(p transferProgress) float64 {
+	weight := float64(s.cfg.ProgressCloudWeight) / 100
+	return weight*p.Cloud + (1-weight)*p.Local
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+
+	"github.com/elsbrock/plundrio/internal/config"
+	"github.com/elsbrock/plundrio/internal/provider"
+)
+
+// Roles of providers
+const (
+	providerPrimary  = "primary"  // takes new transfers first
+	providerFallback = "fallback" // takes new transfers the providers before it did not
+	providerRouted   = "routed"   // only takes transfers routed to it
+)
+
+// ProviderInfo is a provider plundrio adds transfers to
+type ProviderInfo struct {
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+// ProvidersInfo lists the providers and the routes sending new transfers to them
+type ProvidersInfo struct {
+	Providers []ProviderInfo         `json:"providers"`
+	Routes    []config.ProviderRoute `json:"routes"`
+}
+
+// handleProviders lists the providers and the provider routes, in the order
+// they are tried
+func (s *Server) handleProviders(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	info := ProvidersInfo{Routes: s.cfg.ProviderRoutes}
+	if info.Routes == nil {
+		info.Routes = []config.ProviderRoute{}
+	}
+	for i, p := range provider.All(s.dlManager.Provider()) {
+		role := providerRouted
+		switch {
+		case i == 0:
+			role = providerPrimary
+		case slices.Contains(s.cfg.FallbackProviders, p.Name()):
+			role = providerFallback
+		}
+		info.Providers = append(info.Providers, ProviderInfo{Name: p.Name(), Role: role})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/elsbrock/plundrio/internal/push"
+)
+
+// SetPush enables Web Push notifications for the dashboard. It must be called before Start.
+func (s *Server) SetPush(pusher *push.Pusher) {
+	s.push = pusher
+}
+
+// PushInfo tells the dashboard whether and with which key it can subscribe
+type PushInfo struct {
+	Enabled       bool   `json:"enabled"`
+	PublicKey     string `json:"public_key,omitempty"` // VAPID application server key, base64url
+	Subscriptions int    `json:"subscriptions"`
+}
+
+// handlePush returns the VAPID public key browsers subscribe with
+func (s *Server) handlePush(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	info := PushInfo{}
+	if s.push != nil {
+		info = PushInfo{Enabled: true, PublicKey: s.push.PublicKey(), Subscriptions: s.push.Subscriptions()}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
+
+// handlePushSubscribe subscribes a browser to notifications. It expects a
+// POST with the JSON of the browser's PushSubscription. Browsers subscribed
+// with an API token only hear of that user's transfers.
+func (s *Server) handlePushSubscribe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.push == nil {
+		http.Error(w, "Web Push is disabled", http.StatusNotFound)
+		return
+	}
+
+	var sub push.Subscription
+	if err := json.NewDecoder(r.Body).Decode(&sub); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	sub.User = requestUser(r)
+	if err := s.push.Subscribe(sub); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlePushUnsubscribe stops notifications to a browser.
+// It expects a POST with a JSON body of the form {"endpoint": "https://..."}.
+func (s *Server) handlePushUnsubscribe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.push == nil {
+		http.Error(w, "Web Push is disabled", http.StatusNotFound)
+		return
+	}
+
+	var req struct {
+		Endpoint string `json:"endpoint"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Endpoint == "" {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if !s.push.Unsubscribe(req.Endpoint) {
+		http.Error(w, "Browser is not subscribed", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleManifest serves the web app manifest that makes the dashboard installable
+func (s *Server) handleManifest(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/manifest+json")
+	w.Write([]byte(`{
+  "name": "Plundrio Dashboard",
+  "short_name": "plundrio",
+  "start_url": "/",
+  "scope": "/",
+  "display": "standalone",
+  "background_color": "#0f172a",
+  "theme_color": "#0f172a",
+  "icons": [
+    {"src": "/icon.svg", "sizes": "any", "type": "image/svg+xml", "purpose": "any maskable"}
+  ]
+}`))
+}
+
+// handleIcon serves the app icon
+func (s *Server) handleIcon(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Cache-Control", "max-age=86400")
+	w.Write([]byte(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 512 512">
+  <defs><linearGradient id="g" x1="0" y1="0" x2="1" y2="1"><stop offset="0" stop-color="#667eea"/><stop offset="1" stop-color="#764ba2"/></linearGradient></defs>
+  <rect width="512" height="512" fill="#0f172a"/>
+  <circle cx="256" cy="256" r="176" fill="url(#g)"/>
+  <path d="M256 150v170m-70-70l70 70 70-70M176 362h160" stroke="#fff" stroke-width="36" stroke-linecap="round" stroke-linejoin="round" fill="none"/>
+</svg>`))
+}
+
+// handleServiceWorker serves the service worker showing pushed notifications.
+// It caches nothing: the dashboard is only useful while plundrio is reachable.
+func (s *Server) handleServiceWorker(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/javascript")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write([]byte(`self.addEventListener('install', () => self.skipWaiting());
+self.addEventListener('activate', event => event.waitUntil(self.clients.claim()));
+
+// Browsers only offer to install apps whose service worker handles fetches
+self.addEventListener('fetch', () => {});
+
+self.addEventListener('push', event => {
+    const msg = event.data ? event.data.json() : { title: 'plundrio', body: '' };
+    event.waitUntil(self.registration.showNotification(msg.title, {
+        body: msg.body,
+        tag: msg.tag,
+        icon: '/icon.svg',
+        data: { url: msg.url || '/' },
+    }));
+});
+
+self.addEventListener('notificationclick', event => {
+    event.notification.close();
+    const url = event.notification.data.url;
+    event.waitUntil(self.clients.matchAll({ type: 'window' }).then(windows => {
+        for (const client of windows) {
+            if ('focus' in client) {
+                return client.focus();
+            }
+        }
+        return self.clients.openWindow(url);
+    }));
+});
+`))
+}
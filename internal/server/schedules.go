@@ -0,0 +1,64 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+
+	"github.com/elsbrock/plundrio/internal/config"
+	"github.com/elsbrock/plundrio/internal/scheduler"
+)
+
+// handleSchedules lists the schedules with their next and last runs, or
+// replaces them. PUT expects the full list as JSON array of
+// {"action": "scan", "cron": "*/30 * * * *"}; schedules derived from interval
+// options stay. Changes last until plundrio restarts.
+func (s *Server) handleSchedules(w http.ResponseWriter, r *http.Request) {
+	sched := s.dlManager.Scheduler()
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(sched.Entries())
+
+	case http.MethodPut:
+		var schedules []config.Schedule
+		if err := json.NewDecoder(r.Body).Decode(&schedules); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		for _, schedule := range schedules {
+			if err := scheduler.Validate(schedule); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if err := sched.Set(schedules); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(sched.Entries())
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleScheduleRun starts an action right away. It expects a POST with
+// ?action=scan and returns before the action finishes.
+func (s *Server) handleScheduleRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	action := r.URL.Query().Get("action")
+	if !slices.Contains(config.ScheduleActions, action) {
+		http.Error(w, "Invalid action parameter", http.StatusBadRequest)
+		return
+	}
+	if err := s.dlManager.Scheduler().RunNow(action); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
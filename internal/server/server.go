@@ -1,7 +1,9 @@
 package server
 
 import (
+	"context"
 	"net/http"
+	"sync"
 	"time"
 
 	_ "net/http/pprof"
@@ -9,7 +11,10 @@ import (
 	"github.com/elsbrock/plundrio/internal/api"
 	"github.com/elsbrock/plundrio/internal/config"
 	"github.com/elsbrock/plundrio/internal/download"
+	"github.com/elsbrock/plundrio/internal/graphql"
+	"github.com/elsbrock/plundrio/internal/i18n"
 	"github.com/elsbrock/plundrio/internal/log"
+	"github.com/elsbrock/plundrio/internal/push"
 )
 
 // Server handles transmission-rpc requests
@@ -17,21 +22,42 @@ type Server struct {
 	cfg          *config.Config
 	client       *api.Client
 	srv          *http.Server
+	statusSrv    *http.Server // nil without status-listen
 	quotaTicker  *time.Ticker
 	stopChan     chan struct{}
+	ctx          context.Context    // cancelled on stop, ends provider calls in flight
+	cancel       context.CancelFunc // cancels ctx
 	dlManager    *download.Manager
+	graphql      *graphql.Schema
 	quotaWarning bool // tracks if we've already warned about quota
+
+	sessionMu sync.Mutex    // serializes session-set requests
+	session   sessionLimits // limits switched off through session-set
+
+	pending pendingAdds // transfers added through torrent-add the provider does not list yet
+
+	push *push.Pusher // nil when Web Push is disabled
+
+	snapshots snapshots // recent downloads shared by all dashboard requests
+
+	i18n *i18n.Catalog // translations of the dashboard
 }
 
 // New creates a new RPC server
 func New(cfg *config.Config, client *api.Client, dlManager *download.Manager) *Server {
-	return &Server{
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Server{
 		cfg:         cfg,
 		client:      client,
 		stopChan:    make(chan struct{}),
+		ctx:         ctx,
+		cancel:      cancel,
 		dlManager:   dlManager,
 		quotaTicker: time.NewTicker(15 * time.Minute),
+		i18n:        i18n.New(cfg.StateDir),
 	}
+	s.graphql = s.newGraphQLSchema()
+	return s
 }
 
 // Start begins listening for RPC requests
@@ -39,16 +65,87 @@ func (s *Server) Start() error {
 	// Initialize server first
 	mux := http.NewServeMux()
 	mux.HandleFunc("/api/downloads", s.handleDashboardAPI)
+	mux.HandleFunc("/api/stats", s.handleStats)
+	mux.HandleFunc("/api/stats/throughput", s.handleThroughput)
+	mux.HandleFunc("/api/unthrottle", s.handleUnthrottle)
+	mux.HandleFunc("/api/scan", s.handleScan)
+	mux.HandleFunc("/api/health", s.handleHealth)
+	mux.HandleFunc("/api/token", s.handleToken)
+	mux.HandleFunc("/api/transfers/add", s.handleTransferAdd)
+	mux.HandleFunc("/api/providers", s.handleProviders)
+	mux.HandleFunc("/api/users", s.handleUsers)
+	mux.HandleFunc("/api/i18n", s.handleLanguages)
+	mux.HandleFunc("/api/i18n/{lang}", s.handleTranslation)
+	mux.HandleFunc("/api/push", s.handlePush)
+	mux.HandleFunc("/api/push/subscribe", s.handlePushSubscribe)
+	mux.HandleFunc("/api/push/unsubscribe", s.handlePushUnsubscribe)
+	mux.HandleFunc("/api/transfers/location", s.handleTransferLocation)
+	mux.HandleFunc("/api/transfers/notes", s.handleTransferNotes)
+	mux.HandleFunc("/api/transfers/pause", s.handleTransferPause(true))
+	mux.HandleFunc("/api/transfers/resume", s.handleTransferPause(false))
+	mux.HandleFunc("/api/transfers/cancel", s.handleTransferCancel)
+	mux.HandleFunc("/api/transfers/move", s.handleTransferMove)
+	mux.HandleFunc("/api/transfers/retry", s.handleTransferRetry)
+	mux.HandleFunc("/api/transfers/{id}/log", s.handleTransferLog)
+	mux.HandleFunc("/api/files/search", s.handleFileSearch)
+	mux.HandleFunc("/api/files/download", s.handleFileDownload(false))
+	mux.HandleFunc("/api/files/redownload", s.handleFileRedownload)
+	mux.HandleFunc("/api/files/shared", s.handleSharedFiles)
+	mux.HandleFunc("/api/files/shared/download", s.handleFileDownload(true))
+	mux.HandleFunc("/api/retention", s.handleRetentionReport)
+	mux.HandleFunc("/api/schedules", s.handleSchedules)
+	mux.HandleFunc("/api/schedules/run", s.handleScheduleRun)
+	mux.HandleFunc("/api/feed", s.handleFeed)
+	mux.HandleFunc("/api/history", s.handleHistory)
+	mux.HandleFunc("/api/mirrors", s.handleMirrors)
+	mux.HandleFunc("/api/mirrors/restore", s.handleMirrorRestore)
+	mux.HandleFunc("/api/failures", s.handleFailures)
+	mux.HandleFunc("/api/failures/retry", s.handleFailureRetry)
+	mux.HandleFunc("/api/logs", s.handleLogs)
+	mux.HandleFunc("/api/debug/putio", s.handleDebugPutio)
+	mux.HandleFunc("/api/config", s.handleConfig)
+	mux.HandleFunc("/api/openapi.json", s.handleOpenAPI)
+	mux.HandleFunc("/api/docs", s.handleAPIDocs)
+	mux.HandleFunc("/graphql", s.handleGraphQL)
+	mux.HandleFunc("/graphql/schema", s.handleGraphQLSchema)
 	mux.HandleFunc("/transmission/rpc", s.handleRPC)
+	mux.HandleFunc("/metrics", s.handleMetrics)
+	mux.HandleFunc("/status", s.handleStatusPage)
+	mux.HandleFunc("/status.json", s.handleStatusJSON)
+	mux.HandleFunc("/api/widget", s.handleWidget)
+	mux.HandleFunc("/api/widget/discover", s.handleWidgetDiscovery)
+	mux.HandleFunc("/manifest.webmanifest", s.handleManifest)
+	mux.HandleFunc("/icon.svg", s.handleIcon)
+	mux.HandleFunc("/sw.js", s.handleServiceWorker)
 	mux.HandleFunc("/", s.handleDashboard)
 
 	s.srv = &http.Server{
 		Addr:    s.cfg.ListenAddr,
-		Handler: mux,
+		Handler: s.withCORS(withCSRFProtection(s.withUsers(mux))),
+	}
+
+	// Only put.io has an account with a disk quota
+	if s.client != nil {
+		s.monitorAccount()
+	}
+
+	if s.cfg.StatusListen != "" {
+		s.statusSrv = &http.Server{
+			Addr:    s.cfg.StatusListen,
+			Handler: s.statusMux(),
+		}
+		go s.serveStatus()
 	}
 
+	log.Info("server").Str("addr", s.cfg.ListenAddr).Msg("Starting transmission-rpc server")
+	return s.srv.ListenAndServe()
+}
+
+// monitorAccount logs the Put.io account status and checks its disk quota
+// periodically
+func (s *Server) monitorAccount() {
 	// Get and log account info
-	account, err := s.client.GetAccountInfo()
+	account, err := s.client.GetAccountInfo(s.ctx)
 	if err != nil {
 		log.Warn("server").Err(err).Msg("Failed to get account info")
 	} else {
@@ -80,19 +177,20 @@ func (s *Server) Start() error {
 			}
 		}
 	}()
-
-	log.Info("server").Str("addr", s.cfg.ListenAddr).Msg("Starting transmission-rpc server")
-	return s.srv.ListenAndServe()
 }
 
 // Stop gracefully shuts down the server
 func (s *Server) Stop() error {
 	s.quotaTicker.Stop()
 	close(s.stopChan)
+	s.cancel()
 
 	// Stop the download manager
 	s.dlManager.Stop()
 
+	if s.statusSrv != nil {
+		s.statusSrv.Close()
+	}
 	if s.srv != nil {
 		return s.srv.Close()
 	}
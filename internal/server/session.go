@@ -0,0 +1,255 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	"github.com/elsbrock/go-putio"
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// Versions of Transmission and its RPC protocol reported to clients
+const (
+	transmissionVersion = "2.94"
+	rpcVersion          = 15
+	rpcVersionMinimum   = 1
+)
+
+// sessionLimits remembers the values of limits switched off through
+// session-set, as Transmission keeps e.g. speed-limit-down while
+// speed-limit-down-enabled is false but plundrio uses 0 for unlimited
+type sessionLimits struct {
+	speedLimit int
+	queueSize  int
+}
+
+// toggle applies a value and an enabled flag of a Transmission session
+// setting, either of which may be missing, to a limit where 0 means off
+func toggle(current int, remembered *int, value *int, enabled *bool) int {
+	on := current > 0
+	v := current
+	if !on {
+		v = *remembered
+	}
+	if value != nil {
+		v = *value
+	}
+	if enabled != nil {
+		on = *enabled
+	}
+
+	*remembered = v
+	if !on {
+		return 0
+	}
+	return v
+}
+
+// handleSessionGet processes session-get requests. The speed limits and the
+// download queue are plundrio's, upload and seeding settings are reported as
+// off since put.io does the seeding.
+func (s *Server) handleSessionGet(args json.RawMessage) (interface{}, error) {
+	var params struct {
+		Fields []string `json:"fields"`
+	}
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &params); err != nil {
+			return nil, fmt.Errorf("invalid arguments: %w", err)
+		}
+	}
+
+	settings := s.dlManager.Settings()
+	workers := s.dlManager.Stats().Workers
+
+	s.sessionMu.Lock()
+	speedLimit := settings.SpeedLimit
+	if speedLimit == 0 {
+		speedLimit = s.session.speedLimit
+	}
+	queueSize := settings.DownloadQueueSize
+	if queueSize == 0 {
+		queueSize = s.session.queueSize
+	}
+	s.sessionMu.Unlock()
+	if queueSize == 0 {
+		queueSize = workers
+	}
+
+	session := map[string]interface{}{
+		"download-dir":               s.dlManager.DefaultTargetDir(),
+		"speed-limit-down":           speedLimit,
+		"speed-limit-down-enabled":   settings.SpeedLimit > 0,
+		"speed-limit-up":             0,
+		"speed-limit-up-enabled":     false,
+		"alt-speed-down":             settings.AltSpeedLimit,
+		"alt-speed-up":               0,
+		"alt-speed-enabled":          settings.AltSpeedEnabled,
+		"alt-speed-time-enabled":     false,
+		"download-queue-size":        queueSize,
+		"download-queue-enabled":     settings.DownloadQueueSize > 0,
+		"seed-queue-size":            0,
+		"seed-queue-enabled":         false,
+		"queue-stalled-enabled":      false,
+		"seedRatioLimited":           false,
+		"idle-seeding-limit-enabled": false,
+		"start-added-torrents":       true,
+		"incomplete-dir-enabled":     false,
+		"rename-partial-files":       false,
+		"dht-enabled":                false,
+		"pex-enabled":                false,
+		"lpd-enabled":                false,
+		"utp-enabled":                false,
+		"port-forwarding-enabled":    false,
+		"peer-port":                  0,
+		"encryption":                 "preferred",
+		"blocklist-enabled":          false,
+		"blocklist-size":             0,
+		"blocklist-url":              "",
+		"units": map[string]interface{}{
+			"speed-units":  []string{"KiB/s", "MiB/s", "GiB/s", "TiB/s"},
+			"speed-bytes":  1024,
+			"size-units":   []string{"KiB", "MiB", "GiB", "TiB"},
+			"size-bytes":   1024,
+			"memory-units": []string{"KiB", "MiB", "GiB", "TiB"},
+			"memory-bytes": 1024,
+		},
+		"version":             transmissionVersion,
+		"rpc-version":         rpcVersion,
+		"rpc-version-minimum": rpcVersionMinimum,
+	}
+
+	if len(params.Fields) == 0 {
+		return session, nil
+	}
+	requested := make(map[string]interface{}, len(params.Fields))
+	for _, field := range params.Fields {
+		if value, ok := session[field]; ok {
+			requested[field] = value
+		}
+	}
+	return requested, nil
+}
+
+// handleSessionSet processes session-set requests by changing the matching
+// plundrio settings. Like the config API, changes last until the daemon
+// restarts. Settings plundrio has no equivalent for are ignored.
+func (s *Server) handleSessionSet(args json.RawMessage) (interface{}, error) {
+	var params struct {
+		DownloadDir          *string `json:"download-dir"`
+		SpeedLimitDown       *int    `json:"speed-limit-down"`
+		SpeedLimitDownOn     *bool   `json:"speed-limit-down-enabled"`
+		AltSpeedDown         *int    `json:"alt-speed-down"`
+		AltSpeedEnabled      *bool   `json:"alt-speed-enabled"`
+		DownloadQueueSize    *int    `json:"download-queue-size"`
+		DownloadQueueEnabled *bool   `json:"download-queue-enabled"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+
+	if params.DownloadDir != nil && *params.DownloadDir != s.dlManager.DefaultTargetDir() {
+		if !filepath.IsAbs(*params.DownloadDir) {
+			return nil, fmt.Errorf("download directory must be an absolute path: %s", *params.DownloadDir)
+		}
+		if err := s.dlManager.ChangeTargetDir(filepath.Clean(*params.DownloadDir)); err != nil {
+			return nil, fmt.Errorf("failed to change download directory: %w", err)
+		}
+	}
+
+	s.sessionMu.Lock()
+	defer s.sessionMu.Unlock()
+
+	settings := s.dlManager.Settings()
+	remembered := s.session
+	settings.SpeedLimit = toggle(settings.SpeedLimit, &remembered.speedLimit, params.SpeedLimitDown, params.SpeedLimitDownOn)
+	settings.DownloadQueueSize = toggle(settings.DownloadQueueSize, &remembered.queueSize, params.DownloadQueueSize, params.DownloadQueueEnabled)
+	if params.AltSpeedDown != nil {
+		settings.AltSpeedLimit = *params.AltSpeedDown
+	}
+	if params.AltSpeedEnabled != nil {
+		settings.AltSpeedEnabled = *params.AltSpeedEnabled
+	}
+	if err := s.dlManager.UpdateSettings(settings); err != nil {
+		return nil, err
+	}
+	s.session = remembered
+
+	log.Info("rpc").
+		Str("operation", "session-set").
+		Str("download_dir", s.dlManager.DefaultTargetDir()).
+		Int("speed_limit", settings.SpeedLimit).
+		Int("alt_speed_limit", settings.AltSpeedLimit).
+		Bool("alt_speed_enabled", settings.AltSpeedEnabled).
+		Int("download_queue_size", settings.DownloadQueueSize).
+		Msg("Session settings changed")
+
+	return struct{}{}, nil
+}
+
+// handleSessionStats processes session-stats requests, which web UIs poll
+// for their status bar. Speeds are put.io's like rateDownload in torrent-get.
+func (s *Server) handleSessionStats() (interface{}, error) {
+	var transfers []*putio.Transfer
+	if processor := s.dlManager.GetTransferProcessor(); processor != nil {
+		transfers = processor.GetTransfers()
+	}
+
+	var active, paused, downloadSpeed, uploadSpeed int
+	var uploaded int64
+	for _, t := range transfers {
+		switch {
+		case s.dlManager.IsPaused(t.ID):
+			paused++
+		case t.DownloadSpeed > 0 || t.UploadSpeed > 0:
+			active++
+		}
+		downloadSpeed += t.DownloadSpeed
+		uploadSpeed += t.UploadSpeed
+		uploaded += t.Uploaded
+	}
+
+	stats := map[string]interface{}{
+		"uploadedBytes":   uploaded,
+		"downloadedBytes": s.dlManager.Stats().DownloadedBytes,
+		"filesAdded":      len(transfers),
+		"sessionCount":    1,
+		"secondsActive":   0,
+	}
+	return map[string]interface{}{
+		"activeTorrentCount": active,
+		"pausedTorrentCount": paused,
+		"torrentCount":       len(transfers),
+		"downloadSpeed":      downloadSpeed,
+		"uploadSpeed":        uploadSpeed,
+		"cumulative-stats":   stats,
+		"current-stats":      stats,
+	}, nil
+}
+
+// handlePortTest processes port-test requests. plundrio takes no incoming
+// peer connections, put.io talks to the swarm, so there is no port that
+// could be open.
+func (s *Server) handlePortTest() (interface{}, error) {
+	return map[string]interface{}{
+		"port-is-open": false,
+	}, nil
+}
+
+// handleBlocklistUpdate processes blocklist-update requests. There are no
+// peers to block, so the blocklist is always empty.
+func (s *Server) handleBlocklistUpdate() (interface{}, error) {
+	return map[string]interface{}{
+		"blocklist-size": 0,
+	}, nil
+}
+
+// handleSessionClose processes session-close requests. Transmission shuts
+// down on them, but plundrio keeps running for its other clients; only the
+// client's session ends.
+func (s *Server) handleSessionClose(addr string) (interface{}, error) {
+	log.Info("rpc").
+		Str("client_addr", addr).
+		Msg("Client closed its session, daemon keeps running")
+	return struct{}{}, nil
+}
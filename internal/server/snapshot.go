@@ -0,0 +1,170 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// snapshotMaxAge is how long a snapshot of the downloads is served before it
+// is taken again, so dashboards open in many tabs share one
+const snapshotMaxAge = time.Second
+
+// snapshotEntry is a download with its JSON and the version it last changed in
+type snapshotEntry struct {
+	id          int64
+	requestedBy string
+	raw         json.RawMessage
+	version     uint64
+}
+
+// snapshot is the downloads at one point in time. It is never modified once
+// taken, so requests can use it without holding a lock.
+type snapshot struct {
+	epoch   int64  // identifies this run, cursors of earlier runs are ignored
+	version uint64 // the latest version any download changed in
+	entries []snapshotEntry
+}
+
+// cursor identifies the snapshot in ETags and delta requests
+func (sn *snapshot) cursor() string {
+	return fmt.Sprintf("%d.%d", sn.epoch, sn.version)
+}
+
+// snapshots takes snapshots of the downloads and remembers the version each
+// download last changed in
+type snapshots struct {
+	mu      sync.Mutex
+	current *snapshot
+	takenAt time.Time
+}
+
+// DownloadsDelta answers /api/downloads?since=cursor with the downloads that
+// changed since the cursor and the IDs of all downloads
+type DownloadsDelta struct {
+	Cursor  string            `json:"cursor"`  // pass as since in the next request
+	Full    bool              `json:"full"`    // changed holds all downloads, forget the ones known before
+	IDs     []int64           `json:"ids"`     // all downloads in the order shown; others were removed
+	Changed []json.RawMessage `json:"changed"` // downloads that changed since the cursor, see DownloadInfo
+}
+
+// downloadsSnapshot returns a recent snapshot of the downloads, taking a new
+// one if the last is older than snapshotMaxAge. A download whose JSON differs
+// from the last snapshot gets a new version, as does the snapshot when
+// downloads appear, disappear or change order.
+func (s *Server) downloadsSnapshot() *snapshot {
+	s.snapshots.mu.Lock()
+	defer s.snapshots.mu.Unlock()
+
+	prev := s.snapshots.current
+	if prev != nil && time.Since(s.snapshots.takenAt) < snapshotMaxAge {
+		return prev
+	}
+	if prev == nil {
+		prev = &snapshot{epoch: time.Now().UnixNano()}
+	}
+
+	known := make(map[int64]snapshotEntry, len(prev.entries))
+	for _, entry := range prev.entries {
+		known[entry.id] = entry
+	}
+
+	next := &snapshot{epoch: prev.epoch, version: prev.version}
+	version := prev.version + 1
+	changed := false
+	for _, info := range s.collectDownloads() {
+		raw, err := json.Marshal(info)
+		if err != nil {
+			continue
+		}
+		entry := snapshotEntry{id: info.ID, requestedBy: info.RequestedBy, raw: raw, version: version}
+		if old, ok := known[info.ID]; ok && bytes.Equal(old.raw, raw) {
+			entry.version = old.version
+		} else {
+			changed = true
+		}
+		next.entries = append(next.entries, entry)
+	}
+	if !changed && !slices.EqualFunc(prev.entries, next.entries, func(a, b snapshotEntry) bool { return a.id == b.id }) {
+		changed = true
+	}
+	if changed {
+		next.version = version
+	}
+
+	s.snapshots.current = next
+	s.snapshots.takenAt = time.Now()
+	return next
+}
+
+// handleDashboardAPI returns active downloads in JSON format: transfers put.io
+// is still working on, and transfers being downloaded locally. ?user=name
+// only returns the transfers added by an API user. With ?since=cursor only
+// the downloads that changed since an earlier response are returned, see
+// DownloadsDelta; an empty or outdated cursor returns all of them. Responses
+// carry an ETag, so unchanged downloads can be answered with 304 Not Modified.
+func (s *Server) handleDashboardAPI(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	user := query.Get("user")
+	sn := s.downloadsSnapshot()
+
+	etag := `"` + sn.cursor() + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if match := r.Header.Get("If-None-Match"); match != "" && strings.Contains(match, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	entries := make([]snapshotEntry, 0, len(sn.entries))
+	for _, entry := range sn.entries {
+		if user == "" || entry.requestedBy == user {
+			entries = append(entries, entry)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if _, delta := query["since"]; !delta {
+		list := make([]json.RawMessage, 0, len(entries))
+		for _, entry := range entries {
+			list = append(list, entry.raw)
+		}
+		json.NewEncoder(w).Encode(list)
+		return
+	}
+
+	since, full := sinceVersion(query.Get("since"), sn.epoch)
+	resp := DownloadsDelta{
+		Cursor:  sn.cursor(),
+		Full:    full,
+		IDs:     make([]int64, 0, len(entries)),
+		Changed: make([]json.RawMessage, 0),
+	}
+	for _, entry := range entries {
+		resp.IDs = append(resp.IDs, entry.id)
+		if full || entry.version > since {
+			resp.Changed = append(resp.Changed, entry.raw)
+		}
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// sinceVersion returns the version of a cursor, or true if all downloads have
+// to be sent because the cursor is empty, invalid or from an earlier run
+func sinceVersion(cursor string, epoch int64) (uint64, bool) {
+	epochPart, versionPart, ok := strings.Cut(cursor, ".")
+	if !ok || epochPart != strconv.FormatInt(epoch, 10) {
+		return 0, true
+	}
+	version, err := strconv.ParseUint(versionPart, 10, 64)
+	if err != nil {
+		return 0, true
+	}
+	return version, false
+}
@@ -0,0 +1,173 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+
+	"github.com/elsbrock/plundrio/internal/log"
+	"github.com/elsbrock/plundrio/internal/notify"
+)
+
+// StatusTransfer is a transfer as shown on the status page
+type StatusTransfer struct {
+	Name            string  `json:"name"` // "Transfer N" with status-redact-names
+	Stage           string  `json:"stage"`
+	ProgressPercent float64 `json:"progress_percent"`
+	SpeedBps        float64 `json:"speed_bps"`
+}
+
+// StatusInfo is what the read-only status page shows: counts and speeds,
+// and nothing that allows changing anything
+type StatusInfo struct {
+	Status          string           `json:"status"` // ok or reauthenticate
+	Maintenance     bool             `json:"maintenance"`
+	ActiveDownloads int              `json:"active_downloads"`
+	QueuedTransfers int              `json:"queued_transfers"`
+	QueuedBytes     int64            `json:"queued_bytes"`
+	SpeedBps        float64          `json:"speed_bps"`
+	ETASeconds      int64            `json:"eta_seconds"` // -1 while unknown
+	Transfers       []StatusTransfer `json:"transfers"`
+}
+
+// statusInfo collects the status page's figures
+func (s *Server) statusInfo() StatusInfo {
+	queue := s.dlManager.EstimateQueue()
+	info := StatusInfo{
+		Status:          healthOK,
+		Maintenance:     s.dlManager.InMaintenance(),
+		ActiveDownloads: s.dlManager.Stats().ActiveDownloads,
+		QueuedTransfers: queue.Transfers,
+		QueuedBytes:     queue.QueuedBytes,
+		SpeedBps:        queue.Speed,
+		ETASeconds:      -1,
+		Transfers:       make([]StatusTransfer, 0),
+	}
+	if queue.Known {
+		info.ETASeconds = int64(queue.TimeLeft.Seconds())
+	}
+	if s.client != nil && s.client.AuthState().Reauthenticate {
+		info.Status = healthReauthenticate
+	}
+
+	for i, dl := range s.collectDownloads() {
+		t := StatusTransfer{
+			Name:            dl.Name,
+			Stage:           dl.Stage,
+			ProgressPercent: dl.ProgressPercent,
+			SpeedBps:        dl.SpeedMBps * 1024 * 1024,
+		}
+		if dl.Stage == stageCloud {
+			t.ProgressPercent = dl.CloudProgress
+		}
+		if s.cfg.StatusRedactNames {
+			t.Name = fmt.Sprintf("Transfer %d", i+1)
+		}
+		info.Transfers = append(info.Transfers, t)
+	}
+	return info
+}
+
+// handleStatusJSON serves the status page's figures for dashboard widgets.
+// Any origin may read them, as they are public.
+func (s *Server) handleStatusJSON(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	json.NewEncoder(w).Encode(s.statusInfo())
+}
+
+// statusPage renders the status page. It refreshes itself, so it also works
+// in iframes of dashboards that do not run scripts.
+var statusPage = template.Must(template.New("status").Funcs(template.FuncMap{
+	"size":  notify.FormatSize,
+	"speed": func(bps float64) string { return notify.FormatSize(int64(bps)) + "/s" },
+	"eta": func(seconds int64) string {
+		if seconds < 0 {
+			return "unknown"
+		}
+		return formatDuration(int(seconds))
+	},
+	"percent": func(p float64) string { return fmt.Sprintf("%.0f%%", p) },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+    <title>plundrio status</title>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <meta http-equiv="refresh" content="10">
+    <style>
+        body {
+            font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, sans-serif;
+            background: #0f172a;
+            color: #e2e8f0;
+            margin: 0;
+            padding: 12px;
+            font-size: 0.875rem;
+        }
+        .figures { display: flex; flex-wrap: wrap; gap: 16px; margin-bottom: 12px; }
+        .figure span { display: block; color: #94a3b8; font-size: 0.75rem; }
+        .figure strong { font-size: 1.125rem; }
+        .warning { color: #fca5a5; margin-bottom: 12px; }
+        table { width: 100%; border-collapse: collapse; }
+        td { padding: 4px 0; border-top: 1px solid #334155; }
+        td.num { text-align: right; color: #94a3b8; white-space: nowrap; padding-left: 12px; }
+    </style>
+</head>
+<body>
+    {{if eq .Status "reauthenticate"}}<div class="warning" role="alert">put.io rejected the token</div>{{end}}
+    {{if .Maintenance}}<div class="warning">Paused for maintenance</div>{{end}}
+    <div class="figures">
+        <div class="figure"><span>Downloading</span><strong>{{.ActiveDownloads}}</strong></div>
+        <div class="figure"><span>Queued</span><strong>{{.QueuedTransfers}}</strong></div>
+        <div class="figure"><span>Speed</span><strong>{{speed .SpeedBps}}</strong></div>
+        <div class="figure"><span>Left</span><strong>{{size .QueuedBytes}}</strong></div>
+        <div class="figure"><span>Done in</span><strong>{{eta .ETASeconds}}</strong></div>
+    </div>
+    {{if .Transfers}}
+    <table>
+        {{range .Transfers}}
+        <tr><td>{{.Name}}</td><td class="num">{{.Stage}}</td><td class="num">{{percent .ProgressPercent}}</td><td class="num">{{speed .SpeedBps}}</td></tr>
+        {{end}}
+    </table>
+    {{end}}
+</body>
+</html>
+`))
+
+// handleStatusPage serves the read-only status page
+func (s *Server) handleStatusPage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := statusPage.Execute(w, s.statusInfo()); err != nil {
+		log.Error("server").Err(err).Msg("Failed to render status page")
+	}
+}
+
+// statusMux routes the read-only status page and dashboard widgets, and
+// nothing else
+func (s *Server) statusMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", s.handleStatusPage)
+	mux.HandleFunc("/status.json", s.handleStatusJSON)
+	mux.HandleFunc("/api/widget", s.handleWidget)
+	mux.HandleFunc("/api/widget/discover", s.handleWidgetDiscovery)
+	mux.Handle("/", http.RedirectHandler("/status", http.StatusFound))
+	return mux
+}
+
+// serveStatus serves only the status page on the status-listen address, so
+// it can be exposed to a homelab dashboard without exposing the controls
+func (s *Server) serveStatus() {
+	log.Info("server").Str("addr", s.cfg.StatusListen).Msg("Starting status page server")
+	if err := s.statusSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Error("server").Err(err).Str("addr", s.cfg.StatusListen).Msg("Status page server failed")
+	}
+}
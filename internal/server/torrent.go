@@ -5,14 +5,20 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/elsbrock/go-putio"
+	"github.com/elsbrock/plundrio/internal/download"
+	"github.com/elsbrock/plundrio/internal/events"
 	"github.com/elsbrock/plundrio/internal/log"
 )
 
-// findTransferByHash finds a transfer by its hash string
-// It searches both active Put.io transfers and locally processed transfers
+// findTransferByHash finds a transfer by its hash string, or by its ID as
+// sent by web UIs. It searches both active Put.io transfers and locally
+// processed transfers
 func (s *Server) findTransferByHash(hash string) (*putio.Transfer, error) {
 	// First check the processor's tracked transfers (includes processed ones)
 	processor := s.dlManager.GetTransferProcessor()
@@ -25,7 +31,7 @@ func (s *Server) findTransferByHash(hash string) (*putio.Transfer, error) {
 	}
 
 	// Fall back to direct Put.io API lookup
-	transfers, err := s.client.GetTransfers()
+	transfers, err := s.dlManager.Provider().ListTransfers(s.ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -34,24 +40,73 @@ func (s *Server) findTransferByHash(hash string) (*putio.Transfer, error) {
 			return t, nil
 		}
 	}
+	if id, err := strconv.ParseInt(hash, 10, 64); err == nil {
+		return s.findTransferByID(id)
+	}
 	return nil, fmt.Errorf("transfer not found with hash: %s", hash)
 }
 
-// handleTorrentAdd processes torrent-add requests
-func (s *Server) handleTorrentAdd(args json.RawMessage) (interface{}, error) {
+// findTransferByID looks up a transfer by its Put.io ID
+func (s *Server) findTransferByID(id int64) (*putio.Transfer, error) {
+	if processor := s.dlManager.GetTransferProcessor(); processor != nil {
+		for _, t := range processor.GetTransfers() {
+			if t.ID == id {
+				return t, nil
+			}
+		}
+	}
+
+	transfers, err := s.dlManager.Provider().ListTransfers(s.ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range transfers {
+		if t.ID == id {
+			return t, nil
+		}
+	}
+	return nil, fmt.Errorf("transfer not found with id: %d", id)
+}
+
+// handleTorrentAdd processes torrent-add requests of the given API user
+func (s *Server) handleTorrentAdd(args json.RawMessage, user string) (interface{}, error) {
 	var params struct {
-		Filename    string `json:"filename"`    // For .torrent files
-		MetaInfo    string `json:"metainfo"`    // Base64 encoded .torrent
-		MagnetLink  string `json:"magnetLink"`  // Magnet link
-		DownloadDir string `json:"downloadDir"` // Ignored, we use Put.io
+		Filename          string   `json:"filename"`          // For .torrent files
+		MetaInfo          string   `json:"metainfo"`          // Base64 encoded .torrent
+		MagnetLink        string   `json:"magnetLink"`        // Magnet link
+		DownloadDir       string   `json:"downloadDir"`       // Its last element is the category, used to route the transfer to a provider
+		BandwidthPriority *int     `json:"bandwidthPriority"` // -1 low, 0 normal, 1 high
+		Labels            []string `json:"labels"`            // priority-high and priority-low set the priority, too
 	}
 
 	if err := json.Unmarshal(args, &params); err != nil {
 		return nil, fmt.Errorf("invalid arguments: %w", err)
 	}
 	var name string
+	category := ""
+	if params.DownloadDir != "" {
+		category = filepath.Base(params.DownloadDir)
+	}
+
+	// Priority hints of the *arr applications: a priority label wins over
+	// bandwidthPriority
+	note := download.Annotation{RequestedBy: user}
+	if params.BandwidthPriority != nil {
+		note.Priority = download.ClampPriority(*params.BandwidthPriority)
+	}
+	if priority, ok := download.PriorityFromLabels(params.Labels); ok {
+		note.Priority = priority
+	}
 
-	// Handle .torrent file upload if metainfo is provided
+	// Transfers are downloaded to the default target directory until the
+	// provider lists them, whatever the client asked for
+	downloadDir := s.dlManager.DefaultTargetDir()
+
+	// Check the request right away, but hand the transfer to the provider in
+	// the background: *arr applications give up on slow download clients,
+	// and the transfer shows up in torrent-get in the meantime
+	var hash string
+	var add func() error
 	if params.MetaInfo != "" {
 		// Decode base64 torrent data
 		torrentData, err := base64.StdEncoding.DecodeString(params.MetaInfo)
@@ -59,60 +114,91 @@ func (s *Server) handleTorrentAdd(args json.RawMessage) (interface{}, error) {
 			return nil, fmt.Errorf("failed to decode torrent data: %w", err)
 		}
 
-		// Upload torrent file to Put.io
-		name = params.Filename
-		if name == "" {
-			name = "unknown.torrent"
+		filename := params.Filename
+		if filename == "" {
+			filename = "unknown.torrent"
 		}
-		if err := s.client.UploadFile(torrentData, name, s.cfg.FolderID); err != nil {
-			return nil, fmt.Errorf("failed to upload torrent: %w", err)
+		name = strings.TrimSuffix(filename, ".torrent")
+		hash = download.TorrentHash(torrentData)
+		add = func() error {
+			if err := s.dlManager.AddTorrent(torrentData, filename, category, note); err != nil {
+				return fmt.Errorf("failed to upload torrent: %w", err)
+			}
+			return nil
 		}
 
 		log.Info("rpc").
 			Str("operation", "torrent-add").
 			Str("type", "torrent").
-			Str("name", name).
+			Str("name", filename).
+			Str("hash", hash).
+			Str("user", user).
+			Str("priority", download.PriorityName(note.Priority)).
 			Int64("folder_id", s.cfg.FolderID).
-			Msg("Torrent file uploaded")
+			Msg("Torrent file accepted")
 	} else {
-		// Handle magnet links
+		// Handle magnet links and URLs for Put.io to fetch
+		var link string
 		if params.MagnetLink != "" {
-			name = params.MagnetLink
-		} else if params.Filename != "" && strings.HasPrefix(params.Filename, "magnet:") {
-			name = params.Filename
+			link = params.MagnetLink
+		} else if params.Filename != "" && transferURLType(params.Filename) != "" {
+			link = params.Filename
 		} else {
 			return nil, fmt.Errorf("invalid torrent or magnet link provided")
 		}
 
-		// Add magnet link to Put.io
-		if err := s.client.AddTransfer(name, s.cfg.FolderID); err != nil {
-			return nil, fmt.Errorf("failed to add transfer: %w", err)
+		hash = download.MagnetHash(link)
+		name = download.TransferName(link)
+		if name == "" {
+			name = hash
+		}
+		add = func() error {
+			if err := s.dlManager.AddTransfer(link, category, note); err != nil {
+				return fmt.Errorf("failed to add transfer: %w", err)
+			}
+			return nil
 		}
 
 		log.Info("rpc").
 			Str("operation", "torrent-add").
-			Str("type", "magnet").
-			Str("magnet", name).
+			Str("type", transferURLType(link)).
+			Str("url", link).
+			Str("hash", hash).
+			Str("user", user).
+			Str("priority", download.PriorityName(note.Priority)).
 			Int64("folder_id", s.cfg.FolderID).
-			Msg("Magnet link added")
+			Msg("Transfer accepted")
+	}
 
-		// Return success response
+	if existing := s.addedTorrent(hash); existing != nil {
 		return map[string]interface{}{
-			"torrent-added": map[string]interface{}{},
+			"torrent-duplicate": existing,
 		}, nil
 	}
 
-	// Return success response
+	// Transfers beyond the user's quota are refused right away, unless they
+	// are to wait for the quota in the background
+	if !s.dlManager.QueuesOverQuota() {
+		if err := s.dlManager.QuotaExceeded(user); err != nil {
+			return nil, err
+		}
+	}
+
+	pending := s.submitAdd(hash, name, downloadDir, add)
 	return map[string]interface{}{
-		"torrent-added": map[string]interface{}{},
+		"torrent-added": map[string]interface{}{
+			"id":         pending.ID,
+			"hashString": pending.Hash,
+			"name":       pending.Name,
+		},
 	}, nil
 }
 
 // handleTorrentGet processes torrent-get requests
 func (s *Server) handleTorrentGet(args json.RawMessage) (interface{}, error) {
 	var params struct {
-		IDs    []string `json:"ids"`
-		Fields []string `json:"fields"`
+		IDs    torrentIDs `json:"ids"`
+		Fields []string   `json:"fields"`
 	}
 
 	if err := json.Unmarshal(args, &params); err != nil {
@@ -154,71 +240,52 @@ func (s *Server) handleTorrentGet(args json.RawMessage) (interface{}, error) {
 
 	// Convert Put.io transfers to transmission format
 	torrents := make([]map[string]interface{}, 0, len(transfers))
+	// Transfers with queued downloads come first, in the order they download
+	queued := s.dlManager.QueuedTransfers()
 	for _, t := range transfers {
 		// Filter by IDs if specified
-		if len(params.IDs) > 0 {
-			found := false
-			for _, id := range params.IDs {
-				if id == t.Hash {
-					found = true
-					break
-				}
-			}
-			if !found {
-				continue
-			}
+		if !params.IDs.matches(t) {
+			continue
 		}
 
 		// Calculate combined progress
 		var percentDone float64
 		var status int
 		var leftUntilDone int64
+		var cloudLeft, localLeft int64 // bytes left for put.io and for the local download
+		errorString := t.ErrorMessage
+		outcome := ""
+		progress := transferProgress{Cloud: cloudProgress(t)}
 
 		// Check if we have a transfer context (transfer is being processed)
 		if ctx, exists := s.dlManager.GetCoordinator().GetTransferContext(t.ID); exists && ctx.TotalFiles > 0 {
 			// Get the context data
+			ctx.Mu.RLock()
 			totalSize := ctx.TotalSize
 			downloadedSize := ctx.DownloadedSize
-			totalFiles := ctx.TotalFiles
-			completedFiles := ctx.CompletedFiles
 			state := ctx.State
-
-			// Calculate total size (Put.io download + local download)
-			// If we have size information, use it; otherwise fall back to the transfer size
-			totalTransferSize := totalSize
-			if totalTransferSize == 0 {
-				totalTransferSize = int64(t.Size)
+			progress.Local = localProgress(ctx)
+			if state == download.TransferLifecycleQuarantined && errorString == "" {
+				errorString = ctx.QuarantineReason
 			}
+			outcome = ctx.Outcome()
+			ctx.Mu.RUnlock()
 
-			// The total download task is considered as two parts:
-			// 1. Put.io downloading the torrent (50% of the total task)
-			// 2. Local downloading from Put.io (50% of the total task)
-
-			// Calculate Put.io progress (0-50%)
-			putioProgress := float64(t.PercentDone) / 200.0 // Maps 0-100 to 0-0.5
-
-			// Calculate local download progress (0-50%)
-			var localProgress float64
-			if totalSize > 0 {
-				// If we have size information, use bytes downloaded
-				localProgress = float64(downloadedSize) / float64(totalSize) * 0.5 // Maps 0-1 to 0-0.5
-			} else if totalFiles > 0 {
-				// Fall back to file count if size information is not available
-				localProgress = float64(completedFiles) / float64(totalFiles) * 0.5 // Maps 0-1 to 0-0.5
-			}
-
-			// Combine the two progress values
-			percentDone = putioProgress + localProgress
+			// The total download task consists of two parts, weighed by progress-cloud-weight:
+			// 1. Put.io downloading the torrent
+			// 2. Local downloading from Put.io
+			percentDone = s.combined(progress)
 
 			// Calculate bytes left until done
 			// First, calculate how many bytes are left on Put.io side
-			putioLeftBytes := int64(float64(t.Size) * (1.0 - float64(t.PercentDone)/100.0))
+			putioLeftBytes := int64(float64(t.Size) * (1.0 - progress.Cloud))
 
 			// Then, calculate how many bytes are left on local download side
 			localLeftBytes := totalSize - downloadedSize
 
 			// Total bytes left is the sum of both
 			leftUntilDone = putioLeftBytes + localLeftBytes
+			cloudLeft, localLeft = putioLeftBytes, max(localLeftBytes, 0)
 
 			// Ensure leftUntilDone is never negative
 			if leftUntilDone < 0 {
@@ -226,13 +293,18 @@ func (s *Server) handleTorrentGet(args json.RawMessage) (interface{}, error) {
 			}
 
 			// Check if the transfer is in the Processed state
-			if state == 5 { // TransferLifecycleProcessed = 5
+			if state == download.TransferLifecycleProcessed {
 				// For transfers that have been processed locally, show as 100% complete
 				percentDone = 1.0 // 100%
+				progress.Local = 1.0
 				leftUntilDone = 0 // Nothing left to download
 				status = 6        // TR_STATUS_SEED (completed/seeding)
-			} else if state == 2 { // TransferLifecycleCompleted = 2
-				status = s.mapPutioStatus(t.Status)
+			} else if state == download.TransferLifecycleCompleted {
+				// Files are verified before the transfer is reported as done
+				status = 2 // TR_STATUS_CHECK
+			} else if state == download.TransferLifecycleQuarantined {
+				// Nothing happens until the transfer is retried manually
+				status = 0 // TR_STATUS_STOPPED
 			} else {
 				// If not all files are downloaded, show as downloading
 				status = 4 // TR_STATUS_DOWNLOAD
@@ -242,8 +314,8 @@ func (s *Server) handleTorrentGet(args json.RawMessage) (interface{}, error) {
 				Str("operation", "torrent-get").
 				Int64("id", t.ID).
 				Str("name", t.Name).
-				Float64("putio_progress", putioProgress*100).
-				Float64("local_progress", localProgress*100).
+				Float64("putio_progress", progress.Cloud*100).
+				Float64("local_progress", progress.Local*100).
 				Float64("combined_progress", percentDone*100).
 				Int64("left_until_done", leftUntilDone).
 				Msg("Calculated progress for transfer with context")
@@ -251,15 +323,18 @@ func (s *Server) handleTorrentGet(args json.RawMessage) (interface{}, error) {
 			// For transfers that are completed on put.io but have no corresponding entry in the processor
 			// (i.e., already downloaded), show as 100% complete with status "downloaded"
 			percentDone = 1.0 // 100%
+			progress.Local = 1.0
 			leftUntilDone = 0 // Nothing left to download
 			status = 6        // TR_STATUS_SEED (completed/seeding)
 		} else {
-			// For other transfers not being processed, just use put.io progress (0-50%)
-			putioProgress := float64(t.PercentDone) / 200.0 // Maps 0-100 to 0-0.5
-			percentDone = putioProgress
+			// For other transfers not being processed, only put.io has made progress
+			percentDone = s.combined(progress)
 
 			// Calculate bytes left on Put.io side only
-			leftUntilDone = int64(float64(t.Size) * (1.0 - float64(t.PercentDone)/100.0))
+			leftUntilDone = int64(float64(t.Size) * (1.0 - progress.Cloud))
+
+			// The whole transfer is downloaded locally afterwards
+			cloudLeft, localLeft = leftUntilDone, int64(t.Size)
 
 			status = s.mapPutioStatus(t.Status)
 
@@ -267,52 +342,75 @@ func (s *Server) handleTorrentGet(args json.RawMessage) (interface{}, error) {
 				Str("operation", "torrent-get").
 				Int64("id", t.ID).
 				Str("name", t.Name).
-				Float64("putio_progress", putioProgress*100).
+				Float64("putio_progress", progress.Cloud*100).
 				Float64("combined_progress", percentDone*100).
 				Int64("left_until_done", leftUntilDone).
 				Msg("Calculated progress for transfer without context")
 		}
 
+		// Paused downloads show as stopped until they are resumed
+		if s.dlManager.IsPaused(t.ID) && status != 6 {
+			status = 0 // TR_STATUS_STOPPED
+		}
+
+		// Estimate the time left of both halves while the transfer downloads
+		eta := int64(-1) // TR_ETA_NOT_AVAIL
+		if status == 3 || status == 4 {
+			eta = -2 // TR_ETA_UNKNOWN
+			if left, ok := s.dlManager.EstimateTimeLeft(t, cloudLeft, localLeft); ok {
+				eta = int64(left.Seconds())
+			}
+		}
+
 		// Determine if the torrent is finished (for *arr removal logic)
 		isFinished := status == 6 && percentDone >= 1.0
 
 		torrentInfo := map[string]interface{}{
-			"id":             t.ID,
-			"hashString":     t.Hash,
-			"name":           t.Name,
-			"eta":            t.EstimatedTime,
-			"status":         status,
-			"downloadDir":    s.cfg.TargetDir,
-			"totalSize":      t.Size,
-			"leftUntilDone":  leftUntilDone,
-			"uploadedEver":   t.Uploaded,
-			"downloadedEver": t.Downloaded,
-			"percentDone":    percentDone,
-			"rateDownload":   t.DownloadSpeed,
-			"rateUpload":     t.UploadSpeed,
+			"id":               t.ID,
+			"hashString":       t.Hash,
+			"name":             t.Name,
+			"eta":              eta,
+			"status":           status,
+			"downloadDir":      s.dlManager.TargetDir(t.ID),
+			"totalSize":        t.Size,
+			"leftUntilDone":    leftUntilDone,
+			"uploadedEver":     t.Uploaded,
+			"downloadedEver":   t.Downloaded,
+			"percentDone":      percentDone,
+			"cloudPercentDone": progress.Cloud, // Non-standard: put.io's progress of the torrent
+			"localPercentDone": progress.Local, // Non-standard: progress of the local download
+			"rateDownload":     t.DownloadSpeed,
+			"rateUpload":       t.UploadSpeed,
 			"uploadRatio": func() float64 {
 				if t.Size > 0 {
 					return float64(t.Uploaded) / float64(t.Size)
 				}
 				return 0
 			}(),
-			"error":         t.ErrorMessage != "",
-			"errorString":   t.ErrorMessage,
-			"isFinished":     isFinished,
+			"error":       errorString != "",
+			"errorString": errorString,
+			"errorCode":   s.errorCode(t), // Non-standard: stable classification of the error
+			"outcome":     outcome,        // Non-standard: success, partial or failure once all files are done
+			"isFinished":  isFinished,
 			"doneDate": func() int64 {
 				if t.FinishedAt == nil || t.FinishedAt.IsZero() {
 					return 0
 				}
 				return t.FinishedAt.Unix()
 			}(),
-			"seedRatioLimit": 0,                                      // Ratio of 0 = already met
-			"seedRatioMode":  1,                                      // 1 = per-torrent limit (use seedRatioLimit)
-			"secondsSeeding": int64(t.SecondsSeeding),                // How long it's been seeding
-			"seedIdleLimit":  1,                                      // 1 minute idle limit
-			"seedIdleMode":   1,                                      // 1 = per-torrent limit
+			"seedRatioLimit": 0,                       // Ratio of 0 = already met
+			"seedRatioMode":  1,                       // 1 = per-torrent limit (use seedRatioLimit)
+			"secondsSeeding": int64(t.SecondsSeeding), // How long it's been seeding
+			"seedIdleLimit":  1,                       // 1 minute idle limit
+			"seedIdleMode":   1,                       // 1 = per-torrent limit
 		}
 
-		torrents = append(torrents, torrentInfo)
+		queuePosition := slices.Index(queued, t.ID)
+		if queuePosition < 0 {
+			queuePosition = len(queued) + len(torrents)
+		}
+		s.webUIFields(torrentInfo, t, params.Fields, queuePosition)
+		torrents = append(torrents, filterFields(torrentInfo, params.Fields))
 
 		// Log each torrent being added to the response
 		log.Debug("rpc").
@@ -326,6 +424,9 @@ func (s *Server) handleTorrentGet(args json.RawMessage) (interface{}, error) {
 			Msg("Added torrent to response")
 	}
 
+	// Transfers added but not listed by the provider yet
+	torrents = append(torrents, s.pendingTorrents(transfers, params.IDs, params.Fields)...)
+
 	// Log the final count of torrents in the response
 	log.Debug("rpc").
 		Str("operation", "torrent-get").
@@ -335,6 +436,11 @@ func (s *Server) handleTorrentGet(args json.RawMessage) (interface{}, error) {
 	result := map[string]interface{}{
 		"torrents": torrents,
 	}
+	if slices.Contains(params.IDs, recentlyActive) {
+		// Removed torrents are not tracked, web UIs drop them on their next
+		// full refresh
+		result["removed"] = []int64{}
+	}
 
 	// Log the final response structure
 	resultBytes, _ := json.Marshal(result)
@@ -349,8 +455,8 @@ func (s *Server) handleTorrentGet(args json.RawMessage) (interface{}, error) {
 // handleTorrentRemove processes torrent-remove requests
 func (s *Server) handleTorrentRemove(args json.RawMessage) (interface{}, error) {
 	var params struct {
-		IDs             []string `json:"ids"`
-		DeleteLocalData bool     `json:"delete-local-data"`
+		IDs             torrentIDs `json:"ids"`
+		DeleteLocalData bool       `json:"delete-local-data"`
 	}
 
 	if err := json.Unmarshal(args, &params); err != nil {
@@ -358,6 +464,11 @@ func (s *Server) handleTorrentRemove(args json.RawMessage) (interface{}, error)
 	}
 
 	for _, hash := range params.IDs {
+		// Transfers the provider does not list yet are removed once it does
+		if s.pending.remove(hash, params.DeleteLocalData) {
+			continue
+		}
+
 		transfer, err := s.findTransferByHash(hash)
 		if err != nil {
 			log.Error("rpc").
@@ -367,60 +478,248 @@ func (s *Server) handleTorrentRemove(args json.RawMessage) (interface{}, error)
 				Msg("Failed to find transfer")
 			continue
 		}
+		s.removeTransfer(transfer, params.DeleteLocalData, "torrent-remove")
+	}
 
-		// Delete local files if requested
-		if params.DeleteLocalData {
-			localPath := s.cfg.TargetDir + "/" + transfer.Name
-			if err := os.RemoveAll(localPath); err != nil {
-				log.Error("rpc").
-					Str("operation", "torrent-remove").
-					Str("hash", hash).
-					Int64("transfer_id", transfer.ID).
-					Str("local_path", localPath).
-					Err(err).
-					Msg("Failed to delete local files")
-			} else {
-				log.Info("rpc").
-					Str("operation", "torrent-remove").
-					Str("hash", hash).
-					Int64("transfer_id", transfer.ID).
-					Str("local_path", localPath).
-					Msg("Deleted local files")
-			}
-		}
+	return struct{}{}, nil
+}
 
-		// Delete the files of the transfer from Put.io
-		if err := s.client.DeleteFile(transfer.FileID); err != nil {
-			log.Error("rpc").
-				Str("operation", "torrent-remove").
-				Str("hash", hash).
-				Int64("transfer_id", transfer.ID).
-				Err(err).
-				Msg("Failed to delete transfer files from Put.io")
-		}
+// removeTransfer stops the local downloads of a transfer and removes it and its
+// files from Put.io, optionally deleting the downloaded files as well
+func (s *Server) removeTransfer(transfer *putio.Transfer, deleteLocalData bool, operation string) {
+	s.dlManager.CancelTransfer(transfer.ID)
 
-		if err := s.client.DeleteTransfer(transfer.ID); err != nil {
+	// Delete local files if requested
+	if deleteLocalData {
+		localPath := filepath.Join(s.dlManager.TargetDir(transfer.ID), transfer.Name)
+		if err := os.RemoveAll(localPath); err != nil {
 			log.Error("rpc").
-				Str("operation", "torrent-remove").
-				Str("hash", hash).
+				Str("operation", operation).
+				Str("hash", transfer.Hash).
 				Int64("transfer_id", transfer.ID).
+				Str("local_path", localPath).
 				Err(err).
-				Msg("Failed to delete transfer")
+				Msg("Failed to delete local files")
 		} else {
 			log.Info("rpc").
-				Str("operation", "torrent-remove").
-				Str("hash", hash).
+				Str("operation", operation).
+				Str("hash", transfer.Hash).
 				Int64("transfer_id", transfer.ID).
-				Bool("delete_local_data", params.DeleteLocalData).
-				Msg("Transfer removed")
+				Str("local_path", localPath).
+				Msg("Deleted local files")
+		}
+	}
+
+	// Delete the files of the transfer from Put.io
+	if err := s.dlManager.DeleteRemoteFile(transfer.FileID); err != nil {
+		log.Error("rpc").
+			Str("operation", operation).
+			Str("hash", transfer.Hash).
+			Int64("transfer_id", transfer.ID).
+			Err(err).
+			Msg("Failed to delete transfer files from Put.io")
+	}
+
+	if err := s.dlManager.Provider().DeleteTransfer(s.ctx, transfer.ID); err != nil {
+		log.Error("rpc").
+			Str("operation", operation).
+			Str("hash", transfer.Hash).
+			Int64("transfer_id", transfer.ID).
+			Err(err).
+			Msg("Failed to delete transfer")
+	} else {
+		log.Info("rpc").
+			Str("operation", operation).
+			Str("hash", transfer.Hash).
+			Int64("transfer_id", transfer.ID).
+			Bool("delete_local_data", deleteLocalData).
+			Msg("Transfer removed")
+		s.dlManager.Publish(events.Event{
+			Type:       events.TransferRemoved,
+			TransferID: transfer.ID,
+			Hash:       transfer.Hash,
+			Name:       transfer.Name,
+		})
+	}
+
+	// Remove from processed transfers list so it stops showing in RPC
+	processor := s.dlManager.GetTransferProcessor()
+	if processor != nil {
+		processor.RemoveProcessedTransfer(transfer.ID)
+	}
+}
+
+// handleTorrentSetLocation processes torrent-set-location requests
+func (s *Server) handleTorrentSetLocation(args json.RawMessage) (interface{}, error) {
+	var params struct {
+		IDs      torrentIDs `json:"ids"`
+		Location string     `json:"location"`
+		Move     bool       `json:"move"`
+	}
+
+	if err := json.Unmarshal(args, &params); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+	if params.Location == "" {
+		return nil, fmt.Errorf("no location provided")
+	}
+
+	for _, hash := range params.IDs {
+		transfer, err := s.findTransferByHash(hash)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := s.dlManager.SetTargetDir(transfer.ID, transfer.Name, params.Location, params.Move); err != nil {
+			return nil, fmt.Errorf("failed to set location for %s: %w", transfer.Name, err)
+		}
+
+		log.Info("rpc").
+			Str("operation", "torrent-set-location").
+			Str("hash", hash).
+			Int64("transfer_id", transfer.ID).
+			Str("location", params.Location).
+			Bool("move", params.Move).
+			Msg("Transfer location changed")
+	}
+
+	return struct{}{}, nil
+}
+
+// handleTorrentStop processes torrent-stop requests by pausing the local download
+func (s *Server) handleTorrentStop(args json.RawMessage) (interface{}, error) {
+	return s.setTorrentsPaused(args, true)
+}
+
+// handleTorrentStart processes torrent-start requests by resuming the local download
+func (s *Server) handleTorrentStart(args json.RawMessage) (interface{}, error) {
+	return s.setTorrentsPaused(args, false)
+}
+
+// setTorrentsPaused pauses or resumes the given torrents, or all of them if no IDs are given
+func (s *Server) setTorrentsPaused(args json.RawMessage, pause bool) (interface{}, error) {
+	var params struct {
+		IDs torrentIDs `json:"ids"`
+	}
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &params); err != nil {
+			return nil, fmt.Errorf("invalid arguments: %w", err)
+		}
+	}
+
+	transfers, err := s.requestedTransfers(params.IDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, transfer := range transfers {
+		if pause {
+			s.dlManager.PauseTransfer(transfer.ID)
+		} else {
+			s.dlManager.ResumeTransfer(transfer.ID)
+		}
+	}
+
+	return struct{}{}, nil
+}
+
+// requestedTransfers looks up the transfers a request names, or returns all
+// of them if it names none
+func (s *Server) requestedTransfers(ids torrentIDs) ([]*putio.Transfer, error) {
+	var transfers []*putio.Transfer
+	if len(ids) == 0 {
+		if processor := s.dlManager.GetTransferProcessor(); processor != nil {
+			transfers = processor.GetTransfers()
+		}
+	}
+	for _, hash := range ids {
+		transfer, err := s.findTransferByHash(hash)
+		if err != nil {
+			return nil, err
 		}
+		transfers = append(transfers, transfer)
+	}
+	return transfers, nil
+}
+
+// handleTorrentSet processes torrent-set requests. Only the priority, set
+// through bandwidthPriority or a label such as priority-high, and the speed
+// limit, set through downloadLimit in KB/s and downloadLimited, are applied;
+// other fields are accepted and ignored.
+func (s *Server) handleTorrentSet(args json.RawMessage) (interface{}, error) {
+	var params struct {
+		IDs               torrentIDs `json:"ids"`
+		BandwidthPriority *int       `json:"bandwidthPriority"`
+		Labels            []string   `json:"labels"`
+		DownloadLimit     *int       `json:"downloadLimit"`
+		DownloadLimited   *bool      `json:"downloadLimited"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+
+	priority, setPriority := download.PriorityFromLabels(params.Labels)
+	if !setPriority && params.BandwidthPriority != nil {
+		priority, setPriority = download.ClampPriority(*params.BandwidthPriority), true
+	}
+	// Turning the limit off falls back to the limit of the category
+	var limit int
+	setLimit := false
+	if params.DownloadLimited != nil && !*params.DownloadLimited {
+		setLimit = true
+	} else if params.DownloadLimit != nil {
+		limit, setLimit = max(*params.DownloadLimit, 0), true
+	}
+	if !setPriority && !setLimit {
+		return struct{}{}, nil
+	}
 
-		// Remove from processed transfers list so it stops showing in RPC
-		processor := s.dlManager.GetTransferProcessor()
-		if processor != nil {
-			processor.RemoveProcessedTransfer(transfer.ID)
+	transfers, err := s.requestedTransfers(params.IDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, transfer := range transfers {
+		if setPriority {
+			s.dlManager.SetPriority(transfer.ID, priority)
+		}
+		if setLimit {
+			s.dlManager.SetTransferSpeedLimit(transfer.ID, limit)
 		}
 	}
+	return struct{}{}, nil
+}
 
+// handleQueueMove processes queue-move-top, queue-move-up, queue-move-down
+// and queue-move-bottom requests by moving the transfers in the download
+// queue. queue-move-top and queue-move-bottom, which Sonarr and Radarr send
+// for their First and Last priorities, also raise or lower the priority of
+// the transfers, so that it applies before their files are queued.
+func (s *Server) handleQueueMove(args json.RawMessage, direction string) (interface{}, error) {
+	var params struct {
+		IDs torrentIDs `json:"ids"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+	if len(params.IDs) == 0 {
+		return struct{}{}, nil
+	}
+
+	transfers, err := s.requestedTransfers(params.IDs)
+	if err != nil {
+		return nil, err
+	}
+	// Transfers moving down or to the top go last one first to keep their order
+	if direction == download.MoveTop || direction == download.MoveDown {
+		slices.Reverse(transfers)
+	}
+	for _, transfer := range transfers {
+		switch direction {
+		case download.MoveTop:
+			s.dlManager.SetPriority(transfer.ID, download.PriorityHigh)
+		case download.MoveBottom:
+			s.dlManager.SetPriority(transfer.ID, download.PriorityLow)
+		}
+		s.dlManager.MoveInQueue(transfer.ID, direction)
+	}
 	return struct{}{}, nil
 }
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// userKey is the context key of the user a request was made by
+type userKey struct{}
+
+// publicPaths are served without an API token even when api-users are
+// configured, so that monitoring and the browser keep working. None of them
+// adds transfers.
+var publicPaths = []string{
+	"/api/health",
+	"/metrics",
+	"/status",
+	"/status.json",
+	"/manifest.webmanifest",
+	"/icon.svg",
+	"/sw.js",
+}
+
+// withUsers identifies requests by the API token they carry when api-users
+// are configured: as Bearer token, in X-Api-Key, or as the password of
+// Transmission clients and browsers. Requests with an unknown token are
+// rejected, and so are those without one, as they would not count against
+// any quota, except for the public paths.
+func (s *Server) withUsers(next http.Handler) http.Handler {
+	if len(s.cfg.APIUsers) == 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := requestToken(r)
+		if token == "" {
+			if slices.Contains(publicPaths, r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Basic realm="plundrio"`)
+			http.Error(w, "API token required", http.StatusUnauthorized)
+			return
+		}
+
+		user, ok := s.userOf(token)
+		if !ok {
+			log.Warn("server").
+				Str("client_addr", r.RemoteAddr).
+				Str("path", r.URL.Path).
+				Msg("Rejected request with unknown API token")
+			w.Header().Set("WWW-Authenticate", `Basic realm="plundrio"`)
+			http.Error(w, "Unknown API token", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userKey{}, user)))
+	})
+}
+
+// userOf returns the name of the user with the given API token
+func (s *Server) userOf(token string) (string, bool) {
+	for _, user := range s.cfg.APIUsers {
+		if subtle.ConstantTimeCompare([]byte(user.Token), []byte(token)) == 1 {
+			return user.Name, true
+		}
+	}
+	return "", false
+}
+
+// requestToken returns the API token of a request, or an empty string if it has none
+func requestToken(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	if token := r.Header.Get("X-Api-Key"); token != "" {
+		return token
+	}
+	if _, password, ok := r.BasicAuth(); ok {
+		return password
+	}
+	return ""
+}
+
+// requestUser returns the user a request was made by, or an empty string
+// if no api-users are configured
+func requestUser(r *http.Request) string {
+	user, _ := r.Context().Value(userKey{}).(string)
+	return user
+}
+
+// UserInfo describes an API user and how much of their quota they use
+type UserInfo struct {
+	Name            string `json:"name"`
+	ActiveTransfers int    `json:"active_transfers"`
+	MaxTransfers    int    `json:"max_transfers"` // 0 means unlimited
+	MonthlyBytes    int64  `json:"monthly_bytes"` // downloaded this calendar month
+	MonthlyGB       int    `json:"monthly_gb"`    // 0 means unlimited
+}
+
+// handleUsers lists the API users with their quotas and usage
+func (s *Server) handleUsers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	users := make([]UserInfo, 0, len(s.cfg.APIUsers))
+	for _, user := range s.cfg.APIUsers {
+		users = append(users, UserInfo{
+			Name:            user.Name,
+			ActiveTransfers: s.dlManager.ActiveTransfers(user.Name),
+			MaxTransfers:    user.MaxTransfers,
+			MonthlyBytes:    s.dlManager.MonthlyUsage(user.Name),
+			MonthlyGB:       user.MonthlyGB,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(users)
+}
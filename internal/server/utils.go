@@ -2,10 +2,33 @@ package server
 
 import (
 	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/elsbrock/plundrio/internal/log"
 )
 
+// maxRequestBody is how large the body of an API request may be
+const maxRequestBody = 1 << 20
+
+// transferURLType returns "magnet" for magnet links and "url" for HTTP and FTP
+// URLs Put.io can fetch, or an empty string if Put.io cannot add the link
+func transferURLType(link string) string {
+	if strings.HasPrefix(link, "magnet:") {
+		return "magnet"
+	}
+	u, err := url.Parse(link)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https", "ftp":
+		return "url"
+	}
+	return ""
+}
+
 // mapPutioStatus converts Put.io transfer status to transmission status
 func (s *Server) mapPutioStatus(status string) int {
 	switch status {
@@ -26,9 +49,22 @@ func (s *Server) mapPutioStatus(status string) int {
 	}
 }
 
+// requirePutio answers 501 Not Implemented for features only put.io offers
+// when another provider is used
+func (s *Server) requirePutio(w http.ResponseWriter) bool {
+	if s.client != nil {
+		return true
+	}
+	http.Error(w, "Not available with provider "+s.dlManager.Provider().Name(), http.StatusNotImplemented)
+	return false
+}
+
 // checkDiskQuota checks disk usage and handles quota warnings
 func (s *Server) checkDiskQuota() (bool, error) {
-	account, err := s.client.GetAccountInfo()
+	if s.client == nil {
+		return false, nil
+	}
+	account, err := s.client.GetAccountInfo(s.ctx)
 	if err != nil {
 		return false, fmt.Errorf("failed to check disk quota: %w", err)
 	}
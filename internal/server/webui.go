@@ -0,0 +1,238 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+
+	"github.com/elsbrock/go-putio"
+	"github.com/elsbrock/plundrio/internal/download"
+)
+
+// recentlyActive is the ids value web UIs use to poll for changed torrents
+const recentlyActive = "recently-active"
+
+// torrentIDs are the torrents a request is about. Transmission accepts a
+// single ID, a list of IDs and hashes, or "recently-active"; *arr
+// applications send hashes while web UIs mostly send numeric IDs, which are
+// kept as decimal strings.
+type torrentIDs []string
+
+// UnmarshalJSON accepts every form of ids Transmission accepts
+func (ids *torrentIDs) UnmarshalJSON(data []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		raw = []json.RawMessage{data}
+	}
+
+	*ids = make(torrentIDs, 0, len(raw))
+	for _, r := range raw {
+		var id int64
+		if err := json.Unmarshal(r, &id); err == nil {
+			*ids = append(*ids, strconv.FormatInt(id, 10))
+			continue
+		}
+		var hash string
+		if err := json.Unmarshal(r, &hash); err != nil {
+			return fmt.Errorf("invalid torrent id %s", r)
+		}
+		*ids = append(*ids, hash)
+	}
+	return nil
+}
+
+// matches reports whether the IDs select a transfer. No IDs and
+// "recently-active" select all of them, as plundrio keeps no activity log.
+func (ids torrentIDs) matches(t *putio.Transfer) bool {
+	if len(ids) == 0 {
+		return true
+	}
+	id := strconv.FormatInt(t.ID, 10)
+	for _, want := range ids {
+		if want == recentlyActive || want == t.Hash || want == id {
+			return true
+		}
+	}
+	return false
+}
+
+// namesField reports whether a torrent-get request names a field. Expensive
+// fields such as the file list are only returned when asked for explicitly.
+func namesField(fields []string, names ...string) bool {
+	for _, name := range names {
+		if slices.Contains(fields, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// webUIFields adds the torrent-get fields full Transmission web UIs such as
+// Flood or transmission-web show on top of what *arr applications use.
+// put.io does the peer work, so peer, piece and tracker details are derived
+// from the transfer as far as possible and left empty otherwise.
+func (s *Server) webUIFields(info map[string]interface{}, t *putio.Transfer, fields []string, queuePosition int) {
+	totalSize := int64(t.Size)
+	left, _ := info["leftUntilDone"].(int64)
+	percentDone, _ := info["percentDone"].(float64)
+	doneDate, _ := info["doneDate"].(int64)
+
+	var addedDate int64
+	if t.CreatedAt != nil && !t.CreatedAt.IsZero() {
+		addedDate = t.CreatedAt.Unix()
+	}
+	// Report the transfer's own limit, or else the one of each download
+	speedLimit := s.dlManager.TransferSpeedLimit(t.ID)
+	if speedLimit == 0 {
+		speedLimit = s.dlManager.Settings().SpeedLimit
+	}
+
+	info["addedDate"] = addedDate
+	info["startDate"] = addedDate
+	info["activityDate"] = max(addedDate, doneDate)
+	info["dateCreated"] = 0
+	info["comment"] = ""
+	info["creator"] = ""
+	info["isPrivate"] = t.IsPrivate
+	info["isStalled"] = false
+	info["magnetLink"] = t.MagnetURI
+	priority := s.dlManager.Priority(t.ID)
+	info["labels"] = []string{}
+	if label := download.PriorityLabel(priority); label != "" {
+		info["labels"] = []string{label}
+	}
+	info["queuePosition"] = queuePosition
+	info["bandwidthPriority"] = priority
+	info["honorsSessionLimits"] = true
+	info["downloadLimit"] = speedLimit
+	info["downloadLimited"] = speedLimit > 0
+	info["uploadLimit"] = 0
+	info["uploadLimited"] = false
+	info["sizeWhenDone"] = totalSize
+	info["haveValid"] = max(totalSize-left, 0)
+	info["haveUnchecked"] = 0
+	info["desiredAvailable"] = left
+	info["corruptEver"] = 0
+	info["recheckProgress"] = 0
+	info["metadataPercentComplete"] = 1
+	info["peersConnected"] = t.PeersConnected
+	info["peersGettingFromUs"] = t.PeersGettingFromUs
+	info["peersSendingToUs"] = t.PeersSendingToUs
+	info["webseedsSendingToUs"] = 0
+	info["peers"] = []interface{}{}
+
+	trackers, trackerStats := trackerFields(t)
+	info["trackers"] = trackers
+	info["trackerStats"] = trackerStats
+
+	if namesField(fields, "pieces", "pieceCount", "pieceSize") {
+		pieces, count, size := pieceFields(totalSize, percentDone)
+		info["pieces"] = pieces
+		info["pieceCount"] = count
+		info["pieceSize"] = size
+	}
+
+	if namesField(fields, "files", "fileStats", "priorities", "wanted") {
+		transferFiles := s.dlManager.TransferFiles(t.ID)
+		files := make([]map[string]interface{}, 0, len(transferFiles))
+		stats := make([]map[string]interface{}, 0, len(transferFiles))
+		priorities := make([]int, 0, len(transferFiles))
+		wanted := make([]int, 0, len(transferFiles))
+		for _, f := range transferFiles {
+			files = append(files, map[string]interface{}{
+				"name":           f.Name,
+				"length":         f.Size,
+				"bytesCompleted": f.Completed,
+			})
+			stats = append(stats, map[string]interface{}{
+				"bytesCompleted": f.Completed,
+				"wanted":         true,
+				"priority":       0,
+			})
+			priorities = append(priorities, 0)
+			wanted = append(wanted, 1)
+		}
+		info["files"] = files
+		info["fileStats"] = stats
+		info["priorities"] = priorities
+		info["wanted"] = wanted
+	}
+}
+
+// trackerFields returns the trackers and tracker stats of a transfer, taken
+// from its magnet link and the tracker put.io reports
+func trackerFields(t *putio.Transfer) ([]map[string]interface{}, []map[string]interface{}) {
+	var announces []string
+	if magnet, err := url.Parse(t.MagnetURI); err == nil && magnet.Scheme == "magnet" {
+		announces = append(announces, magnet.Query()["tr"]...)
+	}
+	if t.Trackers != "" && !slices.Contains(announces, t.Trackers) {
+		announces = append(announces, t.Trackers)
+	}
+
+	trackers := make([]map[string]interface{}, 0, len(announces))
+	stats := make([]map[string]interface{}, 0, len(announces))
+	for i, announce := range announces {
+		host := announce
+		if u, err := url.Parse(announce); err == nil && u.Host != "" {
+			host = u.Host
+		}
+		trackers = append(trackers, map[string]interface{}{
+			"id":       i,
+			"announce": announce,
+			"scrape":   "",
+			"tier":     i,
+		})
+		stats = append(stats, map[string]interface{}{
+			"id":                    i,
+			"announce":              announce,
+			"host":                  host,
+			"scrape":                "",
+			"tier":                  i,
+			"isBackup":              false,
+			"hasAnnounced":          t.TrackerMessage != "",
+			"lastAnnounceResult":    t.TrackerMessage,
+			"lastAnnounceSucceeded": t.ErrorMessage == "",
+			"seederCount":           -1,
+			"leecherCount":          -1,
+			"downloadCount":         -1,
+		})
+	}
+	return trackers, stats
+}
+
+// pieceFields returns a piece bitfield for a torrent of the given size that
+// is done to the given fraction. put.io does not report pieces, so the
+// pieces up to percentDone are marked as present. The piece size starts at
+// 1 MiB and doubles until there are at most 2048 pieces.
+func pieceFields(size int64, percentDone float64) (string, int, int64) {
+	pieceSize := int64(1 << 20)
+	for size/pieceSize >= 2048 {
+		pieceSize *= 2
+	}
+	count := int((size + pieceSize - 1) / pieceSize)
+
+	have := int(float64(count) * min(max(percentDone, 0), 1))
+	bitfield := make([]byte, (count+7)/8)
+	for i := 0; i < have; i++ {
+		bitfield[i/8] |= 0x80 >> (i % 8)
+	}
+	return base64.StdEncoding.EncodeToString(bitfield), count, pieceSize
+}
+
+// filterFields drops the fields a torrent-get request did not ask for
+func filterFields(info map[string]interface{}, fields []string) map[string]interface{} {
+	if len(fields) == 0 {
+		return info
+	}
+	filtered := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		if value, ok := info[field]; ok {
+			filtered[field] = value
+		}
+	}
+	return filtered
+}
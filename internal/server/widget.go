@@ -0,0 +1,178 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/notify"
+)
+
+// Widget is the compact summary homelab dashboard tiles show. Numbers are
+// raw, so dashboards can format them themselves, e.g. with Homepage's
+// customapi formats bytes and byterate.
+type Widget struct {
+	Status          string     `json:"status"` // ok or reauthenticate
+	Active          int        `json:"active"` // transfers downloading locally
+	Queued          int        `json:"queued"` // transfers with bytes left, including those put.io still fetches
+	SpeedBps        float64    `json:"speed_bps"`
+	QueuedBytes     int64      `json:"queued_bytes"`
+	ETASeconds      int64      `json:"eta_seconds"`    // -1 while unknown
+	LastCompleted   string     `json:"last_completed"` // name of the transfer completed last, empty if none
+	LastCompletedAt *time.Time `json:"last_completed_at"`
+}
+
+// WidgetItem is a line of the list format, for dashboards that show labels
+// and values as they are
+type WidgetItem struct {
+	Label string `json:"label"`
+	Value string `json:"value"`
+}
+
+// WidgetDashboard tells how to show plundrio on a homelab dashboard
+type WidgetDashboard struct {
+	Name    string `json:"name"`
+	URL     string `json:"url"`     // endpoint the widget reads
+	Example string `json:"example"` // configuration to paste into the dashboard
+}
+
+// WidgetDiscovery lists the widget endpoints and how dashboards use them
+type WidgetDiscovery struct {
+	Formats    map[string]string `json:"formats"` // format name to URL
+	Dashboards []WidgetDashboard `json:"dashboards"`
+}
+
+// widget collects the widget summary
+func (s *Server) widget() Widget {
+	status := s.statusInfo()
+	w := Widget{
+		Status:      status.Status,
+		Active:      status.ActiveDownloads,
+		Queued:      status.QueuedTransfers,
+		SpeedBps:    status.SpeedBps,
+		QueuedBytes: status.QueuedBytes,
+		ETASeconds:  status.ETASeconds,
+	}
+	if completed := s.completedDownloads("", 1); len(completed) > 0 {
+		w.LastCompleted = completed[0].Name
+		if s.cfg.StatusRedactNames {
+			w.LastCompleted = "Transfer"
+		}
+		w.LastCompletedAt = &completed[0].Time
+	}
+	return w
+}
+
+// widgetItems formats the widget summary as labels and values
+func widgetItems(w Widget) []WidgetItem {
+	eta := "unknown"
+	if w.ETASeconds >= 0 {
+		eta = formatDuration(int(w.ETASeconds))
+	}
+	last := "none"
+	if w.LastCompletedAt != nil {
+		last = fmt.Sprintf("%s (%s)", w.LastCompleted, w.LastCompletedAt.Local().Format("Jan 2 15:04"))
+	}
+	return []WidgetItem{
+		{Label: "Active", Value: fmt.Sprint(w.Active)},
+		{Label: "Queued", Value: fmt.Sprint(w.Queued)},
+		{Label: "Speed", Value: notify.FormatSize(int64(w.SpeedBps)) + "/s"},
+		{Label: "Left", Value: notify.FormatSize(w.QueuedBytes)},
+		{Label: "Done in", Value: eta},
+		{Label: "Last completed", Value: last},
+	}
+}
+
+// handleWidget serves the widget summary, as flat object or with
+// format=list as list of labels and values. Any origin may read it, as it
+// is public like the status page.
+func (s *Server) handleWidget(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var resp interface{}
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "json":
+		resp = s.widget()
+	case "list":
+		resp = widgetItems(s.widget())
+	default:
+		http.Error(w, "Invalid format parameter (use json or list)", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleWidgetDiscovery lists the widget endpoints with configuration for
+// popular homelab dashboards, using the address the request came in on
+func (s *Server) handleWidgetDiscovery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	base := fmt.Sprintf("%s://%s", scheme, r.Host)
+	jsonURL := base + "/api/widget"
+	listURL := base + "/api/widget?format=list"
+	statusURL := base + "/status"
+
+	discovery := WidgetDiscovery{
+		Formats: map[string]string{
+			"json":   jsonURL,
+			"list":   listURL,
+			"status": statusURL,
+		},
+		Dashboards: []WidgetDashboard{
+			{
+				Name: "Homepage",
+				URL:  jsonURL,
+				Example: fmt.Sprintf(`widget:
+  type: customapi
+  url: %s
+  refreshInterval: 10000
+  mappings:
+    - field: active
+      label: Active
+      format: number
+    - field: speed_bps
+      label: Speed
+      format: byterate
+    - field: queued_bytes
+      label: Queued
+      format: bytes
+    - field: last_completed
+      label: Last
+`, jsonURL),
+			},
+			{
+				Name: "Dashy",
+				URL:  statusURL,
+				Example: fmt.Sprintf(`widgets:
+  - type: iframe
+    options:
+      url: %s
+      frameHeight: 220
+`, statusURL),
+			},
+			{
+				Name: "Organizr",
+				URL:  statusURL,
+				Example: fmt.Sprintf(`Add a tab with type iframe and the URL %s, or a homepage item
+of type Custom HTML with <iframe src="%s"></iframe>
+`, statusURL, statusURL),
+			},
+		},
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	json.NewEncoder(w).Encode(discovery)
+}
@@ -0,0 +1,145 @@
+// Package speedtest measures how fast a file downloads with a given number of
+// parallel connections, the way aria2c splits downloads into segments
+package speedtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// readBufferSize is how much is read from a connection at once
+const readBufferSize = 64 * 1024
+
+// Result is the outcome of a speed test with one connection count
+type Result struct {
+	Connections int           `json:"connections"`
+	Bytes       int64         `json:"bytes"`
+	Duration    time.Duration `json:"duration"`
+	Speed       float64       `json:"speed"`      // bytes per second
+	FirstByte   time.Duration `json:"first_byte"` // slowest time to the first byte of a connection
+	Failures    int           `json:"failures"`   // connections that failed
+}
+
+// Run downloads the file at url of the given size for at most duration, split
+// into as many segments as connections, each fetched with its own range
+// request. The data is discarded.
+func Run(ctx context.Context, client *http.Client, url string, size int64, connections int, duration time.Duration) (Result, error) {
+	if connections < 1 {
+		return Result{}, fmt.Errorf("invalid connection count: %d", connections)
+	}
+	if size < int64(connections) {
+		return Result{}, fmt.Errorf("file too small for %d connections", connections)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+
+	result := Result{Connections: connections}
+	var (
+		mu        sync.Mutex
+		wg        sync.WaitGroup
+		total     int64
+		lastErr   error
+		segment   = size / int64(connections)
+		startTime = time.Now()
+	)
+	for i := 0; i < connections; i++ {
+		start := int64(i) * segment
+		end := start + segment - 1
+		if i == connections-1 {
+			end = size - 1
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			firstByte, err := fetchRange(ctx, client, url, start, end, &total)
+			mu.Lock()
+			defer mu.Unlock()
+			if firstByte > result.FirstByte {
+				result.FirstByte = firstByte
+			}
+			if err != nil && ctx.Err() == nil {
+				result.Failures++
+				lastErr = err
+			}
+		}()
+	}
+	wg.Wait()
+
+	result.Duration = time.Since(startTime)
+	result.Bytes = atomic.LoadInt64(&total)
+	if seconds := result.Duration.Seconds(); seconds > 0 {
+		result.Speed = float64(result.Bytes) / seconds
+	}
+	if result.Failures == connections {
+		return result, fmt.Errorf("all connections failed: %w", lastErr)
+	}
+	return result, nil
+}
+
+// fetchRange downloads the bytes from start to end, adding what was read to
+// total, and returns how long it took to receive the first byte
+func fetchRange(ctx context.Context, client *http.Client, url string, start, end int64, total *int64) (time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+
+	requested := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return 0, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	var firstByte time.Duration
+	buf := make([]byte, readBufferSize)
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			if firstByte == 0 {
+				firstByte = time.Since(requested)
+			}
+			atomic.AddInt64(total, int64(n))
+		}
+		if errors.Is(err, io.EOF) {
+			return firstByte, nil
+		}
+		if err != nil {
+			return firstByte, err
+		}
+	}
+}
+
+// Recommend returns the fewest connections that reach at least 95% of the
+// best measured speed, as more connections only add load without a gain
+func Recommend(results []Result) (Result, bool) {
+	var best float64
+	for _, r := range results {
+		if r.Speed > best {
+			best = r.Speed
+		}
+	}
+	if best == 0 {
+		return Result{}, false
+	}
+
+	var recommended Result
+	for _, r := range results {
+		if r.Speed >= best*0.95 && (recommended.Connections == 0 || r.Connections < recommended.Connections) {
+			recommended = r
+		}
+	}
+	return recommended, true
+}
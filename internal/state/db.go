@@ -0,0 +1,129 @@
+package state
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// DB is an embedded database in the state directory for state that changes
+// with every download. Unlike the documents of a Store, which are rewritten
+// as a whole, it is changed in transactions that either apply completely or
+// not at all, even if plundrio is killed halfway.
+type DB struct {
+	bolt *bolt.DB
+}
+
+// Open opens the named database in the state directory, creating it if
+// necessary. It fails if another process has it open.
+func (s *Store) Open(name string) (*DB, error) {
+	path := filepath.Join(s.dir, name+".db")
+	db, err := bolt.Open(path, 0640, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state database %s: %w", name, err)
+	}
+	return &DB{bolt: db}, nil
+}
+
+// Close closes the database
+func (d *DB) Close() error {
+	return d.bolt.Close()
+}
+
+// Update runs fn in a read-write transaction, which is committed if fn
+// returns nil and rolled back otherwise
+func (d *DB) Update(fn func(*Tx) error) error {
+	return d.bolt.Update(func(tx *bolt.Tx) error { return fn(&Tx{tx: tx}) })
+}
+
+// View runs fn in a read-only transaction
+func (d *DB) View(fn func(*Tx) error) error {
+	return d.bolt.View(func(tx *bolt.Tx) error { return fn(&Tx{tx: tx}) })
+}
+
+// Tx is a transaction on a DB. Values are stored as JSON in named buckets,
+// which are created when first written to.
+type Tx struct {
+	tx *bolt.Tx
+}
+
+// Key builds a key from IDs, which must not be negative. Keys sort by their
+// IDs in order, so that all keys starting with the same IDs can be listed or
+// deleted together.
+func Key(ids ...int64) []byte {
+	key := make([]byte, 0, 8*len(ids))
+	for _, id := range ids {
+		key = binary.BigEndian.AppendUint64(key, uint64(id))
+	}
+	return key
+}
+
+// Put stores v under key in bucket
+func (t *Tx) Put(bucket string, key []byte, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", bucket, err)
+	}
+	b, err := t.tx.CreateBucketIfNotExists([]byte(bucket))
+	if err != nil {
+		return fmt.Errorf("failed to create bucket %s: %w", bucket, err)
+	}
+	if err := b.Put(key, data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", bucket, err)
+	}
+	return nil
+}
+
+// Get reads the value under key in bucket into v, and reports whether there
+// is one
+func (t *Tx) Get(bucket string, key []byte, v interface{}) (bool, error) {
+	b := t.tx.Bucket([]byte(bucket))
+	if b == nil {
+		return false, nil
+	}
+	data := b.Get(key)
+	if data == nil {
+		return false, nil
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return false, fmt.Errorf("failed to decode %s: %w", bucket, err)
+	}
+	return true, nil
+}
+
+// ForEach calls fn with the value of every key in bucket starting with
+// prefix, in the order of their keys, until fn returns an error. The value
+// is only valid until fn returns.
+func (t *Tx) ForEach(bucket string, prefix []byte, fn func(key, value []byte) error) error {
+	b := t.tx.Bucket([]byte(bucket))
+	if b == nil {
+		return nil
+	}
+	c := b.Cursor()
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		if err := fn(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes all keys in bucket starting with prefix
+func (t *Tx) Delete(bucket string, prefix []byte) error {
+	b := t.tx.Bucket([]byte(bucket))
+	if b == nil {
+		return nil
+	}
+	c := b.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Seek(prefix) {
+		if err := c.Delete(); err != nil {
+			return fmt.Errorf("failed to delete from %s: %w", bucket, err)
+		}
+	}
+	return nil
+}
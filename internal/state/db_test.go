@@ -0,0 +1,186 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type record struct {
+	Name string `json:"name"`
+}
+
+// openDB opens a database in a temporary state directory
+func openDB(t *testing.T) (*Store, *DB) {
+	t.Helper()
+	store, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := store.Open("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return store, db
+}
+
+// names returns the names of the records in bucket under prefix, in order
+func names(t *testing.T, db *DB, bucket string, prefix []byte) []string {
+	t.Helper()
+	var names []string
+	err := db.View(func(tx *Tx) error {
+		return tx.ForEach(bucket, prefix, func(key, value []byte) error {
+			var r record
+			if err := json.Unmarshal(value, &r); err != nil {
+				return err
+			}
+			names = append(names, r.Name)
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return names
+}
+
+func TestKey(t *testing.T) {
+	if got := Key(); len(got) != 0 {
+		t.Errorf("Key() = %x, want an empty key", got)
+	}
+	if got, want := Key(1, 258), []byte{0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 1, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Key(1, 258) = %x, want %x", got, want)
+	}
+}
+
+func TestDB(t *testing.T) {
+	_, db := openDB(t)
+
+	err := db.Update(func(tx *Tx) error {
+		// Put in another order than the keys sort in
+		for _, r := range []struct {
+			key  []byte
+			name string
+		}{
+			{Key(2, 1), "2/1"},
+			{Key(1, 300), "1/300"},
+			{Key(1, 2), "1/2"},
+			{Key(256), "256"},
+			{Key(1), "1"},
+		} {
+			if err := tx.Put("records", r.key, record{Name: r.name}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := names(t, db, "records", nil), []string{"1", "1/2", "1/300", "2/1", "256"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("all records = %v, want %v", got, want)
+	}
+	if got, want := names(t, db, "records", Key(1)), []string{"1", "1/2", "1/300"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("records of 1 = %v, want %v", got, want)
+	}
+	if got := names(t, db, "missing", nil); got != nil {
+		t.Errorf("records of a missing bucket = %v, want none", got)
+	}
+
+	err = db.View(func(tx *Tx) error {
+		var r record
+		if found, err := tx.Get("records", Key(1, 300), &r); err != nil || !found || r.Name != "1/300" {
+			t.Errorf("Get = %v, %v, %v, want 1/300", r, found, err)
+		}
+		if found, err := tx.Get("records", Key(3), &r); err != nil || found {
+			t.Errorf("Get of a missing key = %v, %v, want not found", found, err)
+		}
+		if found, err := tx.Get("missing", Key(1), &r); err != nil || found {
+			t.Errorf("Get from a missing bucket = %v, %v, want not found", found, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Deleting a prefix leaves the other keys
+	err = db.Update(func(tx *Tx) error {
+		if err := tx.Delete("missing", Key(1)); err != nil {
+			return err
+		}
+		return tx.Delete("records", Key(1))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := names(t, db, "records", nil), []string{"2/1", "256"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("records after deleting 1 = %v, want %v", got, want)
+	}
+}
+
+func TestDBRollback(t *testing.T) {
+	_, db := openDB(t)
+
+	failed := errors.New("failed")
+	err := db.Update(func(tx *Tx) error {
+		if err := tx.Put("records", Key(1), record{Name: "1"}); err != nil {
+			return err
+		}
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("Update = %v, want %v", err, failed)
+	}
+	if got := names(t, db, "records", nil); got != nil {
+		t.Errorf("records after a failed update = %v, want none", got)
+	}
+}
+
+func TestDBReopen(t *testing.T) {
+	store, db := openDB(t)
+	err := db.Update(func(tx *Tx) error {
+		return tx.Put("records", Key(1), record{Name: "1"})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another process cannot open it meanwhile
+	if other, err := store.Open("test"); err == nil {
+		other.Close()
+		t.Error("database was opened twice")
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db, err = store.Open("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if got, want := names(t, db, "records", nil), []string{"1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("records after reopening = %v, want %v", got, want)
+	}
+}
+
+func TestDBDecodeError(t *testing.T) {
+	_, db := openDB(t)
+	err := db.Update(func(tx *Tx) error {
+		return tx.Put("records", Key(1), "not a record")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.View(func(tx *Tx) error {
+		_, err := tx.Get("records", Key(1), &record{})
+		return err
+	})
+	if err == nil {
+		t.Error("Get of a value of another type succeeded")
+	}
+}
@@ -0,0 +1,42 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "state")
+	store, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A missing document leaves the value untouched
+	r := record{Name: "default"}
+	if err := store.Load("missing", &r); err != nil || r.Name != "default" {
+		t.Errorf("Load(missing) = %v, %+v, want the default", err, r)
+	}
+
+	if err := store.Save("doc", record{Name: "saved"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "doc.json.tmp")); !os.IsNotExist(err) {
+		t.Error("temporary file was left behind")
+	}
+	var loaded record
+	if err := store.Load("doc", &loaded); err != nil || loaded.Name != "saved" {
+		t.Errorf("Load(doc) = %v, %+v, want the saved record", err, loaded)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "corrupt.json"), []byte("{"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Load("corrupt", &loaded); err == nil {
+		t.Error("loading a corrupt document succeeded")
+	}
+	if err := store.Save("unencodable", func() {}); err == nil {
+		t.Error("saving a value JSON cannot encode succeeded")
+	}
+}
@@ -0,0 +1,67 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Health is the health of the daemon
+type Health struct {
+	Status      string    `json:"status"` // ok or reauthenticate
+	Maintenance bool      `json:"maintenance"`
+	Auth        AuthState `json:"auth"`
+}
+
+// AuthState is what the daemon knows about its put.io token
+type AuthState struct {
+	Valid          bool      `json:"valid"`
+	Reauthenticate bool      `json:"reauthenticate"` // put.io rejected all tokens, a new one is needed
+	Username       string    `json:"username"`
+	CheckedAt      time.Time `json:"checked_at"`
+	Error          string    `json:"error"`
+
+	Tokens []TokenUsage `json:"tokens"`
+}
+
+// TokenUsage is how much the daemon used one of its put.io tokens
+type TokenUsage struct {
+	Token        string     `json:"token"` // last four characters
+	Requests     int64      `json:"requests"`
+	RateLimited  int64      `json:"rate_limited"` // requests answered with 429 Too Many Requests
+	LimitedUntil *time.Time `json:"limited_until"`
+	Rejected     bool       `json:"rejected"`
+}
+
+// Health returns the health of the daemon. An unhealthy daemon is not an
+// error; check Status.
+func (c *Client) Health(ctx context.Context) (*Health, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/api/health", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	// The daemon answers 503 with the health report while it needs a new token
+	if resp.StatusCode == http.StatusServiceUnavailable {
+		resp.StatusCode = http.StatusOK
+	}
+
+	var health Health
+	if err := decodeResponse(resp, &health); err != nil {
+		return nil, err
+	}
+	return &health, nil
+}
+
+// SetToken replaces the put.io token of the running daemon. The daemon only
+// uses it once put.io accepted it, and until it restarts.
+func (c *Client) SetToken(ctx context.Context, token string) (*AuthState, error) {
+	var state AuthState
+	if err := c.do(ctx, http.MethodPost, "/api/token", map[string]string{"token": token}, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
@@ -0,0 +1,42 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// ConfigValue is a configuration value of the daemon
+type ConfigValue struct {
+	Value   interface{} `json:"value"`
+	Mutable bool        `json:"mutable"` // Can be changed without a restart
+}
+
+// Config returns all configuration values of the daemon, keyed by their name
+// in the config file. Secrets are not included.
+func (c *Client) Config(ctx context.Context) (map[string]ConfigValue, error) {
+	var values map[string]ConfigValue
+	err := c.do(ctx, http.MethodGet, "/api/config", nil, &values)
+	return values, err
+}
+
+// ConfigValue returns a single configuration value, or ErrNotFound
+func (c *Client) ConfigValue(ctx context.Context, key string) (*ConfigValue, error) {
+	var value ConfigValue
+	if err := c.do(ctx, http.MethodGet, "/api/config?key="+url.QueryEscape(key), nil, &value); err != nil {
+		return nil, err
+	}
+	return &value, nil
+}
+
+// SetConfig changes a configuration value of the running daemon and returns
+// the value now in effect. Only mutable settings can be changed; they apply
+// right away and last until the daemon restarts.
+func (c *Client) SetConfig(ctx context.Context, key, value string) (*ConfigValue, error) {
+	var result ConfigValue
+	err := c.do(ctx, http.MethodPost, "/api/config", map[string]string{"key": key, "value": value}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
@@ -0,0 +1,65 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// RemoteFile is a file or folder on Put.io
+type RemoteFile struct {
+	ID        int64  `json:"id"`
+	Name      string `json:"name"`
+	Size      int64  `json:"size"`
+	Folder    bool   `json:"folder"`
+	ParentID  int64  `json:"parent_id"`
+	CreatedAt string `json:"created_at"`
+}
+
+// SearchFiles searches the files and folders of the Put.io account
+func (c *Client) SearchFiles(ctx context.Context, query string) ([]RemoteFile, error) {
+	var files []RemoteFile
+	err := c.do(ctx, http.MethodGet, "/api/files/search?q="+url.QueryEscape(query), nil, &files)
+	return files, err
+}
+
+// DownloadFile queues a file or folder already on Put.io for download and
+// returns the ID the download is tracked under. Unlike transfers, the file is
+// kept on Put.io afterwards.
+func (c *Client) DownloadFile(ctx context.Context, fileID int64) (int64, error) {
+	var result struct {
+		TransferID int64 `json:"transfer_id"`
+	}
+	err := c.do(ctx, http.MethodPost, "/api/files/download", map[string]int64{"id": fileID}, &result)
+	return result.TransferID, err
+}
+
+// RedownloadFile deletes the local copy of a downloaded file and downloads it
+// again, as long as it still exists on Put.io
+func (c *Client) RedownloadFile(ctx context.Context, path string) error {
+	return c.post(ctx, "/api/files/redownload", map[string]string{"path": path})
+}
+
+// SharedFile is a file or folder a put.io friend shared with the account
+type SharedFile struct {
+	RemoteFile
+	Friend string `json:"friend"`
+}
+
+// SharedFiles lists the files and folders put.io friends shared with the account
+func (c *Client) SharedFiles(ctx context.Context) ([]SharedFile, error) {
+	var files []SharedFile
+	err := c.do(ctx, http.MethodGet, "/api/files/shared", nil, &files)
+	return files, err
+}
+
+// DownloadSharedFile queues a file or folder shared by a friend for download
+// into the daemon's shared target directory and returns the ID the download
+// is tracked under
+func (c *Client) DownloadSharedFile(ctx context.Context, fileID int64) (int64, error) {
+	var result struct {
+		TransferID int64 `json:"transfer_id"`
+	}
+	err := c.do(ctx, http.MethodPost, "/api/files/shared/download", map[string]int64{"id": fileID}, &result)
+	return result.TransferID, err
+}
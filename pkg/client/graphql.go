@@ -0,0 +1,288 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Transfer is a transfer with its Put.io and local download state
+type Transfer struct {
+	ID          int64        `json:"id"`
+	Hash        string       `json:"hash"`
+	Name        string       `json:"name"`
+	Status      string       `json:"status"`     // Put.io status
+	LocalState  string       `json:"localState"` // remote, initial, downloading, completed, failed, cancelled, processed, quarantined
+	Paused      bool         `json:"paused"`
+	Size        int64        `json:"size"`
+	PercentDone int          `json:"percentDone"` // Put.io progress
+	Downloaded  int64        `json:"downloaded"`  // Bytes downloaded locally
+	Progress    float64      `json:"progress"`    // Local progress in percent
+	Speed       float64      `json:"speed"`       // Average local download speed in bytes per second
+	DownloadDir string       `json:"downloadDir"`
+	Category    string       `json:"category"`
+	Error       string       `json:"error"`
+	ErrorCode   string       `json:"errorCode"` // Stable classification of Error, e.g. disk-full
+	Files       FileCounts   `json:"files"`
+	RetryCycles int          `json:"retryCycles"`      // Times failed files were downloaded again
+	Quarantine  string       `json:"quarantineReason"` // Why the transfer was quarantined
+	Outcome     string       `json:"outcome"`          // success, partial or failure once all files are done
+	FailedFiles []FailedFile `json:"failedFiles"`
+	CreatedAt   *time.Time   `json:"createdAt"`
+	FinishedAt  *time.Time   `json:"finishedAt"`
+}
+
+// FileCounts summarizes the local files of a transfer
+type FileCounts struct {
+	Total     int `json:"total"`
+	Completed int `json:"completed"`
+	Failed    int `json:"failed"`
+	Skipped   int `json:"skipped"` // No longer on put.io, left out
+}
+
+// FailedFile is a file of a transfer that failed to download
+type FailedFile struct {
+	FileID    int64  `json:"fileId"`
+	Name      string `json:"name"`
+	Size      int64  `json:"size"`
+	Error     string `json:"error"`
+	ErrorCode string `json:"errorCode"`
+}
+
+// File is a file being downloaded
+type File struct {
+	FileID       int64  `json:"fileId"`
+	TransferID   int64  `json:"transferId"`
+	TransferName string `json:"transferName"`
+}
+
+// Event is something that happened to a transfer, a file or the daemon
+type Event struct {
+	Type            string    `json:"type"`
+	Time            time.Time `json:"time"`
+	TransferID      int64     `json:"transferId"`
+	Hash            string    `json:"hash"`
+	Name            string    `json:"name"`
+	Category        string    `json:"category"`
+	Path            string    `json:"path"`
+	FileID          int64     `json:"fileId"`
+	FileName        string    `json:"fileName"`
+	Size            int64     `json:"size"`
+	DurationSeconds float64   `json:"durationSeconds"`
+	Speed           float64   `json:"speed"`
+	Error           string    `json:"error"`
+	ErrorCode       string    `json:"errorCode"`
+}
+
+// Stats is a snapshot of the daemon's download activity
+type Stats struct {
+	Workers          int        `json:"workers"`
+	ActiveDownloads  int        `json:"activeDownloads"`
+	ActiveFiles      int        `json:"activeFiles"`
+	QueuedJobs       int        `json:"queuedJobs"`
+	Transfers        int        `json:"transfers"`
+	Downloading      int        `json:"downloading"`
+	Failed           int        `json:"failed"`
+	Quarantined      int        `json:"quarantined"`
+	Processed        int        `json:"processed"`
+	DownloadedBytes  int64      `json:"downloadedBytes"`
+	SpeedLimitKBps   int        `json:"speedLimitKBps"`
+	UnthrottledUntil *time.Time `json:"unthrottledUntil"`
+}
+
+// GraphQL selections for the types above
+const (
+	transferFields = `id hash name status localState paused size percentDone downloaded progress speed
+		downloadDir category error errorCode files { total completed failed skipped } retryCycles quarantineReason outcome
+		failedFiles { fileId name size error errorCode } createdAt finishedAt`
+	eventFields = `type time transferId hash name category path fileId fileName size durationSeconds speed error errorCode`
+	statsFields = `workers activeDownloads activeFiles queuedJobs transfers downloading failed quarantined processed
+		downloadedBytes speedLimitKBps unthrottledUntil`
+)
+
+// ListTransfers returns all transfers known to the daemon
+func (c *Client) ListTransfers(ctx context.Context) ([]Transfer, error) {
+	var data struct {
+		Transfers []Transfer `json:"transfers"`
+	}
+	err := c.query(ctx, `{ transfers { `+transferFields+` } }`, nil, &data)
+	return data.Transfers, err
+}
+
+// GetTransfer returns a single transfer, or ErrNotFound
+func (c *Client) GetTransfer(ctx context.Context, id int64) (*Transfer, error) {
+	var data struct {
+		Transfer *Transfer `json:"transfer"`
+	}
+	err := c.query(ctx, `query ($id: Int!) { transfer(id: $id) { `+transferFields+` } }`,
+		map[string]interface{}{"id": id}, &data)
+	if err != nil {
+		return nil, err
+	}
+	if data.Transfer == nil {
+		return nil, ErrNotFound
+	}
+	return data.Transfer, nil
+}
+
+// ListFiles returns the files being downloaded, for a single transfer if transferID is not 0
+func (c *Client) ListFiles(ctx context.Context, transferID int64) ([]File, error) {
+	var data struct {
+		Files []File `json:"files"`
+	}
+	err := c.query(ctx, `query ($id: Int) { files(transferId: $id) { fileId transferId transferName } }`,
+		map[string]interface{}{"id": transferID}, &data)
+	return data.Files, err
+}
+
+// History returns the most recent transfer events, newest first
+func (c *Client) History(ctx context.Context, limit int) ([]Event, error) {
+	var data struct {
+		History []Event `json:"history"`
+	}
+	err := c.query(ctx, `query ($limit: Int) { history(limit: $limit) { `+eventFields+` } }`,
+		map[string]interface{}{"limit": limit}, &data)
+	return data.History, err
+}
+
+// Stats returns the current download activity
+func (c *Client) Stats(ctx context.Context) (*Stats, error) {
+	var data struct {
+		Stats *Stats `json:"stats"`
+	}
+	if err := c.query(ctx, `{ stats { `+statsFields+` } }`, nil, &data); err != nil {
+		return nil, err
+	}
+	return data.Stats, nil
+}
+
+// StreamEvents calls fn for each event until ctx is cancelled or the
+// connection ends. If types are given, only events of those types (such as
+// "transfer.completed") are delivered.
+func (c *Client) StreamEvents(ctx context.Context, fn func(Event), types ...string) error {
+	body, err := json.Marshal(graphqlRequest{
+		Query:     `subscription ($types: [String!]) { events(types: $types) { ` + eventFields + ` } }`,
+		Variables: map[string]interface{}{"types": types},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/graphql", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		var result graphqlResponse
+		if err := decodeResponse(resp, &result); err != nil {
+			return err
+		}
+		return result.err()
+	}
+
+	// Read server-sent events: "event: <name>" and "data: <json>" lines
+	// separated by blank lines
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	var name, payload string
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event:"):
+			name = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			payload += strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		case line == "":
+			if name == "complete" {
+				return nil
+			}
+			if name == "next" && payload != "" {
+				var result struct {
+					graphqlResponse
+					Data struct {
+						Events Event `json:"events"`
+					} `json:"data"`
+				}
+				if err := json.Unmarshal([]byte(payload), &result); err != nil {
+					return fmt.Errorf("invalid event: %w", err)
+				}
+				if err := result.err(); err != nil {
+					return err
+				}
+				fn(result.Data.Events)
+			}
+			name, payload = "", ""
+		}
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return scanner.Err()
+}
+
+// graphqlRequest is the body of a GraphQL request
+type graphqlRequest struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables,omitempty"`
+}
+
+// graphqlResponse holds the errors of a GraphQL response
+type graphqlResponse struct {
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// err returns the first GraphQL error, if any
+func (r *graphqlResponse) err() error {
+	if len(r.Errors) == 0 {
+		return nil
+	}
+	return fmt.Errorf("graphql: %s", r.Errors[0].Message)
+}
+
+// query runs a GraphQL query and decodes its data into v
+func (c *Client) query(ctx context.Context, query string, variables map[string]interface{}, v interface{}) error {
+	body, err := json.Marshal(graphqlRequest{Query: query, Variables: variables})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/graphql", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	var result struct {
+		graphqlResponse
+		Data json.RawMessage `json:"data"`
+	}
+	if err := decodeResponse(resp, &result); err != nil {
+		return err
+	}
+	if err := result.err(); err != nil {
+		return err
+	}
+	return json.Unmarshal(result.Data, v)
+}
@@ -0,0 +1,107 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// LogEntry is a log line of the daemon
+type LogEntry struct {
+	Time      time.Time
+	Level     string
+	Component string
+	Message   string
+	Raw       json.RawMessage // The complete line as JSON object, including all fields
+}
+
+// LogOptions selects which log lines are returned
+type LogOptions struct {
+	Level     string // Minimum level: debug, info, warn, error or fatal (empty means info)
+	Component string // Only lines of this component (empty means all)
+	Tail      int    // Number of recent lines to start with
+	Follow    bool   // Keep streaming new lines until ctx is cancelled
+}
+
+// Logs calls fn for each log line of the daemon matching the options. When
+// following, it blocks until ctx is cancelled or the connection ends.
+func (c *Client) Logs(ctx context.Context, opts LogOptions, fn func(LogEntry)) error {
+	query := url.Values{}
+	if opts.Level != "" {
+		query.Set("level", opts.Level)
+	}
+	if opts.Component != "" {
+		query.Set("component", opts.Component)
+	}
+	query.Set("tail", strconv.Itoa(opts.Tail))
+	query.Set("follow", strconv.FormatBool(opts.Follow))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/api/logs?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+
+	return c.readLogs(ctx, req, fn)
+}
+
+// TransferLog calls fn for each log line and aria2c output line captured for
+// a transfer, oldest first. tail limits the lines to the most recent ones (0
+// returns all). It returns ErrNotFound if nothing was captured for the transfer.
+func (c *Client) TransferLog(ctx context.Context, id int64, tail int, fn func(LogEntry)) error {
+	path := fmt.Sprintf("%s/api/transfers/%d/log", c.baseURL, id)
+	if tail > 0 {
+		path += "?tail=" + strconv.Itoa(tail)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+	return c.readLogs(ctx, req, fn)
+}
+
+// readLogs sends a request for newline delimited log lines and calls fn for each
+func (c *Client) readLogs(ctx context.Context, req *http.Request, fn func(LogEntry)) error {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return decodeResponse(resp, nil)
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var fields struct {
+			Time      time.Time `json:"time"`
+			Level     string    `json:"level"`
+			Component string    `json:"component"`
+			Message   string    `json:"message"`
+		}
+		if err := json.Unmarshal(line, &fields); err != nil {
+			return fmt.Errorf("invalid log line: %w", err)
+		}
+		fn(LogEntry{
+			Time:      fields.Time,
+			Level:     fields.Level,
+			Component: fields.Component,
+			Message:   fields.Message,
+			Raw:       append(json.RawMessage(nil), line...),
+		})
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return scanner.Err()
+}